@@ -8,6 +8,8 @@ import (
 	"sync"
 	"syscall"
 	"time"
+	// the operator image has no time zone database for the maintenance windows
+	_ "time/tzdata"
 
 	"github.com/zalando/postgres-operator/pkg/controller"
 	"github.com/zalando/postgres-operator/pkg/spec"
@@ -12,8 +12,58 @@ const (
 	ClusterStatusInvalid      = "Invalid"
 )
 
+// ClusterConditionInstancesReady etc : conditions of a Postgres cluster reported in the status
+const (
+	ClusterConditionInstancesReady       = "InstancesReady"
+	ClusterConditionParametersApplied    = "ParametersApplied"
+	ClusterConditionRestartPending       = "RestartPending"
+	ClusterConditionInitScriptsCompleted = "InitScriptsCompleted"
+	ClusterConditionStorageClassMatches  = "StorageClassMatches"
+	ClusterConditionLeaderElected        = "LeaderElected"
+	ClusterConditionReadOnly             = "ReadOnly"
+	ClusterConditionBackupVerified       = "BackupVerified"
+
+	ClusterConditionReasonAllInstancesReady       = "AllInstancesReady"
+	ClusterConditionReasonInstancesNotReady       = "InstancesNotReady"
+	ClusterConditionReasonAllParametersApplied    = "AllParametersApplied"
+	ClusterConditionReasonParametersDeferred      = "ParametersDeferred"
+	ClusterConditionReasonRollingUpdateDeferred   = "RollingUpdateDeferred"
+	ClusterConditionReasonNoRestartPending        = "NoRestartPending"
+	ClusterConditionReasonInitScriptsPending      = "InitScriptsPending"
+	ClusterConditionReasonAllInitScriptsCompleted = "AllInitScriptsCompleted"
+	ClusterConditionReasonStorageClassesMatch     = "StorageClassesMatch"
+	ClusterConditionReasonMigrationRequired       = "MigrationRequired"
+	ClusterConditionReasonSingleLeader            = "SingleLeader"
+	ClusterConditionReasonMultipleLeaders         = "MultipleLeaders"
+	ClusterConditionReasonNoLeader                = "NoLeader"
+	ClusterConditionReasonReadOnlyRequested       = "ReadOnlyRequested"
+	ClusterConditionReasonReadWrite               = "ReadWrite"
+	ClusterConditionReasonBackupRestored          = "BackupRestored"
+	ClusterConditionReasonBackupNotRestored       = "BackupNotRestored"
+)
+
+// MemberStateUnknown is reported as role and state of the members when the Patroni API cannot be reached
+const MemberStateUnknown = "unknown"
+
+// LoadBalancerStateProvisioning etc : states of the load balancers reported in the status
+const (
+	LoadBalancerStateProvisioning = "provisioning"
+	LoadBalancerStateReady        = "ready"
+)
+
+// synchronous modes of Patroni reported in the cluster status
+const (
+	SynchronousModeOff    = "off"
+	SynchronousModeOn     = "on"
+	SynchronousModeStrict = "strict"
+)
+
 const (
 	serviceNameMaxLength   = 63
 	clusterNameMaxLength   = serviceNameMaxLength - len("-repl")
 	serviceNameRegexString = `^[a-z]([-a-z0-9]*[a-z0-9])?$`
+	s3BucketRegexString    = `^[a-z0-9][-.a-z0-9]{1,61}[a-z0-9]$`
+	gsBucketRegexString    = `^[a-z0-9][-_.a-z0-9]{1,220}[a-z0-9]$`
+	// the volume name "tablespace-<name>" must be a valid DNS label
+	tablespaceNameRegexString = `^[a-z][a-z0-9_]{0,51}$`
 )
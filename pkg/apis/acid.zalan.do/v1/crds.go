@@ -106,7 +106,35 @@ var OperatorConfigCRDResourceColumns = []apiextv1.CustomResourceColumnDefinition
 
 var min0 = 0.0
 var min1 = 1.0
+var maxSessionAffinityTimeout = 86400.0
+var maxPort = 65535.0
+var max100 = 100.0
 var minDisable = -1.0
+var minTerminationGracePeriod = 30.0
+var maxProbeInitialDelay = 3600.0
+
+var probeValidation = apiextv1.JSONSchemaProps{
+	Type: "object",
+	Properties: map[string]apiextv1.JSONSchemaProps{
+		"failureThreshold": {
+			Type:    "integer",
+			Minimum: &min1,
+		},
+		"initialDelaySeconds": {
+			Type:    "integer",
+			Minimum: &min0,
+			Maximum: &maxProbeInitialDelay,
+		},
+		"periodSeconds": {
+			Type:    "integer",
+			Minimum: &min1,
+		},
+		"timeoutSeconds": {
+			Type:    "integer",
+			Minimum: &min1,
+		},
+	},
+}
 
 // PostgresCRDResourceValidation to check applied manifest parameters
 var PostgresCRDResourceValidation = apiextv1.CustomResourceValidation{
@@ -162,6 +190,9 @@ var PostgresCRDResourceValidation = apiextv1.CustomResourceValidation{
 									"subPath": {
 										Type: "string",
 									},
+									"restartOnChange": {
+										Type: "boolean",
+									},
 								},
 							},
 						},
@@ -176,6 +207,98 @@ var PostgresCRDResourceValidation = apiextv1.CustomResourceValidation{
 							},
 						},
 					},
+					"args": {
+						Type: "array",
+						Items: &apiextv1.JSONSchemaPropsOrArray{
+							Schema: &apiextv1.JSONSchemaProps{
+								Type: "string",
+							},
+						},
+					},
+					"audit": {
+						Type: "object",
+						Properties: map[string]apiextv1.JSONSchemaProps{
+							"log": {
+								Type: "array",
+								Items: &apiextv1.JSONSchemaPropsOrArray{
+									Schema: &apiextv1.JSONSchemaProps{
+										Type: "string",
+										Enum: []apiextv1.JSON{
+											{
+												Raw: []byte(`"all"`),
+											},
+											{
+												Raw: []byte(`"ddl"`),
+											},
+											{
+												Raw: []byte(`"function"`),
+											},
+											{
+												Raw: []byte(`"misc"`),
+											},
+											{
+												Raw: []byte(`"misc_set"`),
+											},
+											{
+												Raw: []byte(`"none"`),
+											},
+											{
+												Raw: []byte(`"read"`),
+											},
+											{
+												Raw: []byte(`"role"`),
+											},
+											{
+												Raw: []byte(`"write"`),
+											},
+										},
+									},
+								},
+							},
+							"logCatalog": {
+								Type: "boolean",
+							},
+							"logParameter": {
+								Type: "boolean",
+							},
+							"logRelation": {
+								Type: "boolean",
+							},
+							"role": {
+								Type: "string",
+							},
+						},
+					},
+					"backupVerification": {
+						Type:     "object",
+						Required: []string{"schedule"},
+						Properties: map[string]apiextv1.JSONSchemaProps{
+							"query": {
+								Type: "string",
+							},
+							"schedule": {
+								Type:    "string",
+								Pattern: "^(\\d+|\\*)(/\\d+)?(\\s+(\\d+|\\*)(/\\d+)?){4}$",
+							},
+						},
+					},
+					"cascadingReplicas": {
+						Type: "array",
+						Items: &apiextv1.JSONSchemaPropsOrArray{
+							Schema: &apiextv1.JSONSchemaProps{
+								Type:     "object",
+								Required: []string{"pod", "replicateFrom"},
+								Properties: map[string]apiextv1.JSONSchemaProps{
+									"pod": {
+										Type: "string",
+									},
+									"replicateFrom": {
+										Type: "string",
+									},
+								},
+							},
+						},
+					},
 					"clone": {
 						Type:     "object",
 						Required: []string{"cluster"},
@@ -209,9 +332,35 @@ var PostgresCRDResourceValidation = apiextv1.CustomResourceValidation{
 							},
 						},
 					},
+					"command": {
+						Type: "array",
+						Items: &apiextv1.JSONSchemaPropsOrArray{
+							Schema: &apiextv1.JSONSchemaProps{
+								Type: "string",
+							},
+						},
+					},
 					"connectionPooler": {
 						Type: "object",
 						Properties: map[string]apiextv1.JSONSchemaProps{
+							"autoscaling": {
+								Type:     "object",
+								Required: []string{"maxReplicas"},
+								Properties: map[string]apiextv1.JSONSchemaProps{
+									"maxReplicas": {
+										Type:    "integer",
+										Minimum: &min1,
+									},
+									"minReplicas": {
+										Type:    "integer",
+										Minimum: &min1,
+									},
+									"targetCPUUtilizationPercentage": {
+										Type:    "integer",
+										Minimum: &min1,
+									},
+								},
+							},
 							"dockerImage": {
 								Type: "string",
 							},
@@ -271,6 +420,10 @@ var PostgresCRDResourceValidation = apiextv1.CustomResourceValidation{
 									},
 								},
 							},
+							"restartSchedule": {
+								Type:    "string",
+								Pattern: "^(\\d+|\\*)(/\\d+)?(\\s+(\\d+|\\*)(/\\d+)?){4}$",
+							},
 							"schema": {
 								Type: "string",
 							},
@@ -279,6 +432,18 @@ var PostgresCRDResourceValidation = apiextv1.CustomResourceValidation{
 							},
 						},
 					},
+					"createPatroniRole": {
+						Type: "boolean",
+					},
+					"createServiceAccount": {
+						Type: "boolean",
+					},
+					"deferRestartParameters": {
+						Type: "boolean",
+					},
+					"deferRollingUpdates": {
+						Type: "boolean",
+					},
 					"databases": {
 						Type: "object",
 						AdditionalProperties: &apiextv1.JSONSchemaPropsOrBool{
@@ -288,9 +453,67 @@ var PostgresCRDResourceValidation = apiextv1.CustomResourceValidation{
 							},
 						},
 					},
+					"dnsConfig": {
+						Type: "object",
+						Properties: map[string]apiextv1.JSONSchemaProps{
+							"nameservers": {
+								Type: "array",
+								Items: &apiextv1.JSONSchemaPropsOrArray{
+									Schema: &apiextv1.JSONSchemaProps{
+										Type: "string",
+									},
+								},
+							},
+							"options": {
+								Type: "array",
+								Items: &apiextv1.JSONSchemaPropsOrArray{
+									Schema: &apiextv1.JSONSchemaProps{
+										Type:     "object",
+										Required: []string{"name"},
+										Properties: map[string]apiextv1.JSONSchemaProps{
+											"name": {
+												Type: "string",
+											},
+											"value": {
+												Type: "string",
+											},
+										},
+									},
+								},
+							},
+							"searches": {
+								Type: "array",
+								Items: &apiextv1.JSONSchemaPropsOrArray{
+									Schema: &apiextv1.JSONSchemaProps{
+										Type: "string",
+									},
+								},
+							},
+						},
+					},
+					"dnsPolicy": {
+						Type: "string",
+						Enum: []apiextv1.JSON{
+							{
+								Raw: []byte(`"ClusterFirst"`),
+							},
+							{
+								Raw: []byte(`"ClusterFirstWithHostNet"`),
+							},
+							{
+								Raw: []byte(`"Default"`),
+							},
+							{
+								Raw: []byte(`"None"`),
+							},
+						},
+					},
 					"dockerImage": {
 						Type: "string",
 					},
+					"enableBackupRole": {
+						Type: "boolean",
+					},
 					"enableConnectionPooler": {
 						Type: "boolean",
 					},
@@ -303,12 +526,104 @@ var PostgresCRDResourceValidation = apiextv1.CustomResourceValidation{
 					"enableMasterLoadBalancer": {
 						Type: "boolean",
 					},
+					"enableMasterNodePort": {
+						Type: "boolean",
+					},
+					"enableMemoryTuning": {
+						Type: "boolean",
+					},
+					"enableMonitoringRole": {
+						Type: "boolean",
+					},
+					"enablePodAntiAffinity": {
+						Type: "boolean",
+					},
+					"enablePodServices": {
+						Type: "boolean",
+					},
+					"enablePreStopSwitchover": {
+						Type: "boolean",
+					},
 					"enableReplicaLoadBalancer": {
 						Type: "boolean",
 					},
+					"enableReplicaService": {
+						Type: "boolean",
+					},
 					"enableShmVolume": {
 						Type: "boolean",
 					},
+					"env": {
+						Type: "array",
+						Items: &apiextv1.JSONSchemaPropsOrArray{
+							Schema: &apiextv1.JSONSchemaProps{
+								Type:                   "object",
+								Required:               []string{"name"},
+								XPreserveUnknownFields: util.True(),
+							},
+						},
+					},
+					"externalSecrets": {
+						Type: "object",
+						AdditionalProperties: &apiextv1.JSONSchemaPropsOrBool{
+							Schema: &apiextv1.JSONSchemaProps{
+								Type:     "object",
+								Required: []string{"secretName"},
+								Properties: map[string]apiextv1.JSONSchemaProps{
+									"passwordKey": {
+										Type: "string",
+									},
+									"secretName": {
+										Type: "string",
+									},
+								},
+							},
+						},
+					},
+					"hostAliases": {
+						Type: "array",
+						Items: &apiextv1.JSONSchemaPropsOrArray{
+							Schema: &apiextv1.JSONSchemaProps{
+								Type:     "object",
+								Required: []string{"ip", "hostnames"},
+								Properties: map[string]apiextv1.JSONSchemaProps{
+									"hostnames": {
+										Type: "array",
+										Items: &apiextv1.JSONSchemaPropsOrArray{
+											Schema: &apiextv1.JSONSchemaProps{
+												Type: "string",
+											},
+										},
+									},
+									"ip": {
+										Type: "string",
+									},
+								},
+							},
+						},
+					},
+					"imagePullSecrets": {
+						Type: "array",
+						Items: &apiextv1.JSONSchemaPropsOrArray{
+							Schema: &apiextv1.JSONSchemaProps{
+								Type:     "object",
+								Required: []string{"name"},
+								Properties: map[string]apiextv1.JSONSchemaProps{
+									"name": {
+										Type: "string",
+									},
+								},
+							},
+						},
+					},
+					"inheritedLabels": {
+						Type: "array",
+						Items: &apiextv1.JSONSchemaPropsOrArray{
+							Schema: &apiextv1.JSONSchemaProps{
+								Type: "string",
+							},
+						},
+					},
 					"init_containers": {
 						Type:        "array",
 						Description: "Deprecated",
@@ -328,6 +643,30 @@ var PostgresCRDResourceValidation = apiextv1.CustomResourceValidation{
 							},
 						},
 					},
+					"initScripts": {
+						Type: "array",
+						Items: &apiextv1.JSONSchemaPropsOrArray{
+							Schema: &apiextv1.JSONSchemaProps{
+								Type:     "object",
+								Required: []string{"name", "configMap", "key"},
+								Properties: map[string]apiextv1.JSONSchemaProps{
+									"configMap": {
+										Type: "string",
+									},
+									"database": {
+										Type: "string",
+									},
+									"key": {
+										Type: "string",
+									},
+									"name": {
+										Type: "string",
+									},
+								},
+							},
+						},
+					},
+					"livenessProbe": probeValidation,
 					"logicalBackupSchedule": {
 						Type:    "string",
 						Pattern: "^(\\d+|\\*)(/\\d+)?(\\s+(\\d+|\\*)(/\\d+)?){4}$",
@@ -341,13 +680,118 @@ var PostgresCRDResourceValidation = apiextv1.CustomResourceValidation{
 							},
 						},
 					},
+					"maintenanceWindowsTimezone": {
+						Type: "string",
+					},
+					"manageVolumes": {
+						Type: "boolean",
+					},
+					"masterDNSNameFormat": {
+						Type: "string",
+					},
+					"masterTCPRoute": {
+						Type:     "object",
+						Required: []string{"gatewayName"},
+						Properties: map[string]apiextv1.JSONSchemaProps{
+							"gatewayName": {
+								Type: "string",
+							},
+							"gatewayNamespace": {
+								Type: "string",
+							},
+							"sectionName": {
+								Type: "string",
+							},
+						},
+					},
+					"maxUnavailableReplicas": {
+						Type:    "integer",
+						Minimum: &min1,
+					},
+					"metricsExporter": {
+						Type:     "object",
+						Required: []string{"sidecar", "port"},
+						Properties: map[string]apiextv1.JSONSchemaProps{
+							"livenessProbe": probeValidation,
+							"path": {
+								Type:    "string",
+								Pattern: "^/",
+							},
+							"podMonitor": {
+								Type: "boolean",
+							},
+							"port": {
+								Type:    "integer",
+								Minimum: &min1,
+								Maximum: &maxPort,
+							},
+							"readinessProbe": probeValidation,
+							"sidecar": {
+								Type: "string",
+							},
+						},
+					},
+					"minReadySeconds": {
+						Type:    "integer",
+						Minimum: &min0,
+					},
+					"noFailover": {
+						Type: "object",
+						Properties: map[string]apiextv1.JSONSchemaProps{
+							"pods": {
+								Type: "array",
+								Items: &apiextv1.JSONSchemaPropsOrArray{
+									Schema: &apiextv1.JSONSchemaProps{
+										Type: "string",
+									},
+								},
+							},
+							"zones": {
+								Type: "array",
+								Items: &apiextv1.JSONSchemaPropsOrArray{
+									Schema: &apiextv1.JSONSchemaProps{
+										Type: "string",
+									},
+								},
+							},
+						},
+					},
 					"numberOfInstances": {
 						Type:    "integer",
 						Minimum: &min0,
 					},
+					"passwordEncryption": {
+						Type: "string",
+						Enum: []apiextv1.JSON{
+							{
+								Raw: []byte(`"md5"`),
+							},
+							{
+								Raw: []byte(`"scram-sha-256"`),
+							},
+						},
+					},
 					"patroni": {
 						Type: "object",
 						Properties: map[string]apiextv1.JSONSchemaProps{
+							"api_tls": {
+								Type:     "object",
+								Required: []string{"secretName"},
+								Properties: map[string]apiextv1.JSONSchemaProps{
+									"secretName": {
+										Type: "string",
+									},
+									"certificateFile": {
+										Type: "string",
+									},
+									"privateKeyFile": {
+										Type: "string",
+									},
+									"caFile": {
+										Type: "string",
+									},
+								},
+							},
 							"initdb": {
 								Type: "object",
 								AdditionalProperties: &apiextv1.JSONSchemaPropsOrBool{
@@ -360,7 +804,8 @@ var PostgresCRDResourceValidation = apiextv1.CustomResourceValidation{
 								Type: "integer",
 							},
 							"maximum_lag_on_failover": {
-								Type: "integer",
+								Type:    "integer",
+								Minimum: &min0,
 							},
 							"pg_hba": {
 								Type: "array",
@@ -370,6 +815,14 @@ var PostgresCRDResourceValidation = apiextv1.CustomResourceValidation{
 									},
 								},
 							},
+							"pg_ident": {
+								Type: "array",
+								Items: &apiextv1.JSONSchemaPropsOrArray{
+									Schema: &apiextv1.JSONSchemaProps{
+										Type: "string",
+									},
+								},
+							},
 							"retry_timeout": {
 								Type: "integer",
 							},
@@ -392,6 +845,10 @@ var PostgresCRDResourceValidation = apiextv1.CustomResourceValidation{
 							"synchronous_mode_strict": {
 								Type: "boolean",
 							},
+							"synchronous_node_count": {
+								Type:    "integer",
+								Minimum: &min1,
+							},
 							"ttl": {
 								Type: "integer",
 							},
@@ -405,6 +862,9 @@ var PostgresCRDResourceValidation = apiextv1.CustomResourceValidation{
 							},
 						},
 					},
+					"podAntiAffinityTopologyKey": {
+						Type: "string",
+					},
 					"pod_priority_class_name": {
 						Type:        "string",
 						Description: "Deprecated",
@@ -492,10 +952,76 @@ var PostgresCRDResourceValidation = apiextv1.CustomResourceValidation{
 							},
 						},
 					},
+					"readOnly": {
+						Type: "boolean",
+					},
+					"readinessProbe": probeValidation,
 					"replicaLoadBalancer": {
 						Type:        "boolean",
 						Description: "Deprecated",
 					},
+					"masterNodePort": {
+						Type:    "integer",
+						Minimum: &min1,
+						Maximum: &maxPort,
+					},
+					"replicaExternalTrafficPolicy": {
+						Type: "string",
+						Enum: []apiextv1.JSON{
+							{
+								Raw: []byte(`"Cluster"`),
+							},
+							{
+								Raw: []byte(`"Local"`),
+							},
+						},
+					},
+					"replicaServices": {
+						Type: "array",
+						Items: &apiextv1.JSONSchemaPropsOrArray{
+							Schema: &apiextv1.JSONSchemaProps{
+								Type:     "object",
+								Required: []string{"name", "members"},
+								Properties: map[string]apiextv1.JSONSchemaProps{
+									"name": {
+										Type:    "string",
+										Pattern: "^[a-z0-9]([-a-z0-9]*[a-z0-9])?$",
+									},
+									"members": {
+										Type: "string",
+										Enum: []apiextv1.JSON{
+											{
+												Raw: []byte(`"sync"`),
+											},
+											{
+												Raw: []byte(`"async"`),
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+					"replicaServiceMaxLag": {
+						Type:    "integer",
+						Minimum: &min0,
+					},
+					"replicaSessionAffinity": {
+						Type: "string",
+						Enum: []apiextv1.JSON{
+							{
+								Raw: []byte(`"None"`),
+							},
+							{
+								Raw: []byte(`"ClientIP"`),
+							},
+						},
+					},
+					"replicaSessionAffinityTimeoutSeconds": {
+						Type:    "integer",
+						Minimum: &min1,
+						Maximum: &maxSessionAffinityTimeout,
+					},
 					"resources": {
 						Type:     "object",
 						Required: []string{"requests", "limits"},
@@ -534,9 +1060,19 @@ var PostgresCRDResourceValidation = apiextv1.CustomResourceValidation{
 							},
 						},
 					},
+					"restartOnEnvSourceChange": {
+						Type: "boolean",
+					},
+					"retainedVolumeClaims": {
+						Type:    "integer",
+						Minimum: &min0,
+					},
 					"schedulerName": {
 						Type: "string",
 					},
+					"serviceAccountName": {
+						Type: "string",
+					},
 					"serviceAnnotations": {
 						Type: "object",
 						AdditionalProperties: &apiextv1.JSONSchemaPropsOrBool{
@@ -563,6 +1099,18 @@ var PostgresCRDResourceValidation = apiextv1.CustomResourceValidation{
 					"spiloFSGroup": {
 						Type: "integer",
 					},
+					"spiloFSGroupChangePolicy": {
+						Type: "string",
+						Enum: []apiextv1.JSON{
+							{
+								Raw: []byte(`"Always"`),
+							},
+							{
+								Raw: []byte(`"OnRootMismatch"`),
+							},
+						},
+					},
+					"startupProbe": probeValidation,
 					"standby": {
 						Type:     "object",
 						Required: []string{"s3_wal_path"},
@@ -572,9 +1120,36 @@ var PostgresCRDResourceValidation = apiextv1.CustomResourceValidation{
 							},
 						},
 					},
+					"tablespaces": {
+						Type: "array",
+						Items: &apiextv1.JSONSchemaPropsOrArray{
+							Schema: &apiextv1.JSONSchemaProps{
+								Type:     "object",
+								Required: []string{"name", "size"},
+								Properties: map[string]apiextv1.JSONSchemaProps{
+									"name": {
+										Type:    "string",
+										Pattern: "^[a-z][a-z0-9_]*$",
+									},
+									"size": {
+										Type:        "string",
+										Description: "Value must not be zero",
+										Pattern:     "^(\\d+(e\\d+)?|\\d+(\\.\\d+)?(e\\d+)?[EPTGMK]i?)$",
+									},
+									"storageClass": {
+										Type: "string",
+									},
+								},
+							},
+						},
+					},
 					"teamId": {
 						Type: "string",
 					},
+					"terminationGracePeriodSeconds": {
+						Type:    "integer",
+						Minimum: &minTerminationGracePeriod,
+					},
 					"tls": {
 						Type:     "object",
 						Required: []string{"secretName"},
@@ -681,6 +1256,14 @@ var PostgresCRDResourceValidation = apiextv1.CustomResourceValidation{
 							},
 						},
 					},
+					"nodeSelector": {
+						Type: "object",
+						AdditionalProperties: &apiextv1.JSONSchemaPropsOrBool{
+							Schema: &apiextv1.JSONSchemaProps{
+								Type: "string",
+							},
+						},
+					},
 					"tolerations": {
 						Type: "array",
 						Items: &apiextv1.JSONSchemaPropsOrArray{
@@ -730,6 +1313,36 @@ var PostgresCRDResourceValidation = apiextv1.CustomResourceValidation{
 						Type:        "boolean",
 						Description: "Deprecated",
 					},
+					"userConnectionLimits": {
+						Type: "object",
+						AdditionalProperties: &apiextv1.JSONSchemaPropsOrBool{
+							Schema: &apiextv1.JSONSchemaProps{
+								Type:    "integer",
+								Minimum: &minDisable,
+							},
+						},
+					},
+					"userParameters": {
+						Type: "object",
+						AdditionalProperties: &apiextv1.JSONSchemaPropsOrBool{
+							Schema: &apiextv1.JSONSchemaProps{
+								Type: "object",
+								AdditionalProperties: &apiextv1.JSONSchemaPropsOrBool{
+									Schema: &apiextv1.JSONSchemaProps{
+										Type: "string",
+									},
+								},
+							},
+						},
+					},
+					"userValidUntil": {
+						Type: "object",
+						AdditionalProperties: &apiextv1.JSONSchemaPropsOrBool{
+							Schema: &apiextv1.JSONSchemaProps{
+								Type: "string",
+							},
+						},
+					},
 					"users": {
 						Type: "object",
 						AdditionalProperties: &apiextv1.JSONSchemaPropsOrBool{
@@ -835,9 +1448,25 @@ var PostgresCRDResourceValidation = apiextv1.CustomResourceValidation{
 						Type:     "object",
 						Required: []string{"size"},
 						Properties: map[string]apiextv1.JSONSchemaProps{
+							"annotations": {
+								Type: "object",
+								AdditionalProperties: &apiextv1.JSONSchemaPropsOrBool{
+									Schema: &apiextv1.JSONSchemaProps{
+										Type: "string",
+									},
+								},
+							},
 							"iops": {
 								Type: "integer",
 							},
+							"labels": {
+								Type: "object",
+								AdditionalProperties: &apiextv1.JSONSchemaPropsOrBool{
+									Schema: &apiextv1.JSONSchemaProps{
+										Type: "string",
+									},
+								},
+							},
 							"size": {
 								Type:        "string",
 								Description: "Value must not be zero",
@@ -854,13 +1483,163 @@ var PostgresCRDResourceValidation = apiextv1.CustomResourceValidation{
 							},
 						},
 					},
+					"volumeSnapshots": {
+						Type:     "object",
+						Required: []string{"interval"},
+						Properties: map[string]apiextv1.JSONSchemaProps{
+							"interval": {
+								Type: "string",
+							},
+							"retention": {
+								Type:    "integer",
+								Minimum: &min0,
+							},
+							"volumeSnapshotClassName": {
+								Type: "string",
+							},
+						},
+					},
+					"walArchive": {
+						Type: "object",
+						Properties: map[string]apiextv1.JSONSchemaProps{
+							"gsBucket": {
+								Type:    "string",
+								Pattern: "^[a-z0-9][a-z0-9._-]*[a-z0-9]$",
+							},
+							"s3Bucket": {
+								Type:    "string",
+								Pattern: "^[a-z0-9][a-z0-9.-]*[a-z0-9]$",
+							},
+						},
+					},
 				},
 			},
 			"status": {
 				Type: "object",
-				AdditionalProperties: &apiextv1.JSONSchemaPropsOrBool{
-					Schema: &apiextv1.JSONSchemaProps{
+				Properties: map[string]apiextv1.JSONSchemaProps{
+					"PostgresClusterStatus": {
+						Type: "string",
+					},
+					"conditions": {
+						Type: "array",
+						Items: &apiextv1.JSONSchemaPropsOrArray{
+							Schema: &apiextv1.JSONSchemaProps{
+								Type:     "object",
+								Required: []string{"type", "status"},
+								Properties: map[string]apiextv1.JSONSchemaProps{
+									"lastTransitionTime": {
+										Type:   "string",
+										Format: "date-time",
+									},
+									"message": {
+										Type: "string",
+									},
+									"reason": {
+										Type: "string",
+									},
+									"status": {
+										Type: "string",
+									},
+									"type": {
+										Type: "string",
+									},
+								},
+							},
+						},
+					},
+					"initScripts": {
+						Type: "array",
+						Items: &apiextv1.JSONSchemaPropsOrArray{
+							Schema: &apiextv1.JSONSchemaProps{
+								Type: "string",
+							},
+						},
+					},
+					"loadBalancers": {
+						Type: "array",
+						Items: &apiextv1.JSONSchemaPropsOrArray{
+							Schema: &apiextv1.JSONSchemaProps{
+								Type:     "object",
+								Required: []string{"role", "state"},
+								Properties: map[string]apiextv1.JSONSchemaProps{
+									"addresses": {
+										Type: "array",
+										Items: &apiextv1.JSONSchemaPropsOrArray{
+											Schema: &apiextv1.JSONSchemaProps{
+												Type: "string",
+											},
+										},
+									},
+									"dnsName": {
+										Type: "string",
+									},
+									"role": {
+										Type: "string",
+									},
+									"state": {
+										Type: "string",
+									},
+								},
+							},
+						},
+					},
+					"maximumLagOnFailover": {
+						Type: "integer",
+					},
+					"members": {
+						Type: "array",
+						Items: &apiextv1.JSONSchemaPropsOrArray{
+							Schema: &apiextv1.JSONSchemaProps{
+								Type:     "object",
+								Required: []string{"name", "role", "state"},
+								Properties: map[string]apiextv1.JSONSchemaProps{
+									"lagBytes": {
+										Type: "integer",
+									},
+									"name": {
+										Type: "string",
+									},
+									"role": {
+										Type: "string",
+									},
+									"state": {
+										Type: "string",
+									},
+									"timeline": {
+										Type: "integer",
+									},
+								},
+							},
+						},
+					},
+					"observedGeneration": {
+						Type: "integer",
+					},
+					"promotionTime": {
+						Type:   "string",
+						Format: "date-time",
+					},
+					"replicationSlots": {
+						Type: "array",
+						Items: &apiextv1.JSONSchemaPropsOrArray{
+							Schema: &apiextv1.JSONSchemaProps{
+								Type: "string",
+							},
+						},
+					},
+					"synchronousMode": {
 						Type: "string",
+						Enum: []apiextv1.JSON{
+							{
+								Raw: []byte(`"off"`),
+							},
+							{
+								Raw: []byte(`"on"`),
+							},
+							{
+								Raw: []byte(`"strict"`),
+							},
+						},
 					},
 				},
 			},
@@ -930,6 +1709,9 @@ var OperatorConfigCRDResourceValidation = apiextv1.CustomResourceValidation{
 					"repair_period": {
 						Type: "string",
 					},
+					"full_resync_period": {
+						Type: "string",
+					},
 					"set_memory_request_to_limit": {
 						Type: "boolean",
 					},
@@ -1018,6 +1800,9 @@ var OperatorConfigCRDResourceValidation = apiextv1.CustomResourceValidation{
 							"enable_pod_antiaffinity": {
 								Type: "boolean",
 							},
+							"enable_pod_auto_heal": {
+								Type: "boolean",
+							},
 							"enable_pod_disruption_budget": {
 								Type: "boolean",
 							},
@@ -1062,6 +1847,14 @@ var OperatorConfigCRDResourceValidation = apiextv1.CustomResourceValidation{
 									},
 								},
 							},
+							"ignored_annotations": {
+								Type: "array",
+								Items: &apiextv1.JSONSchemaPropsOrArray{
+									Schema: &apiextv1.JSONSchemaProps{
+										Type: "string",
+									},
+								},
+							},
 							"inherited_annotations": {
 								Type: "array",
 								Items: &apiextv1.JSONSchemaPropsOrArray{
@@ -1207,12 +2000,38 @@ var OperatorConfigCRDResourceValidation = apiextv1.CustomResourceValidation{
 					"timeouts": {
 						Type: "object",
 						Properties: map[string]apiextv1.JSONSchemaProps{
+							"cluster_lock_timeout": {
+								Type: "string",
+							},
+							"db_long_statement_timeout": {
+								Type: "string",
+							},
+							"db_statement_timeout": {
+								Type: "string",
+							},
 							"pod_label_wait_timeout": {
 								Type: "string",
 							},
+							"pod_auto_heal_timeout": {
+								Type: "string",
+							},
 							"pod_deletion_wait_timeout": {
 								Type: "string",
 							},
+							"pod_ready_wait_interval": {
+								Type: "string",
+							},
+							"pod_ready_wait_jitter_percent": {
+								Type:    "integer",
+								Minimum: &min0,
+								Maximum: &max100,
+							},
+							"pod_ready_wait_max_interval": {
+								Type: "string",
+							},
+							"pod_ready_wait_timeout": {
+								Type: "string",
+							},
 							"ready_wait_interval": {
 								Type: "string",
 							},
@@ -1225,6 +2044,12 @@ var OperatorConfigCRDResourceValidation = apiextv1.CustomResourceValidation{
 							"resource_check_timeout": {
 								Type: "string",
 							},
+							"sync_long_step_timeout": {
+								Type: "string",
+							},
+							"sync_step_timeout": {
+								Type: "string",
+							},
 						},
 					},
 					"load_balancer": {
@@ -1488,6 +2313,9 @@ var OperatorConfigCRDResourceValidation = apiextv1.CustomResourceValidation{
 								Type:    "integer",
 								Minimum: &min1,
 							},
+							"connection_pooler_restart_image": {
+								Type: "string",
+							},
 							"connection_pooler_schema": {
 								Type: "string",
 							},
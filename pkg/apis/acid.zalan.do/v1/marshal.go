@@ -115,6 +115,84 @@ func (p *Postgresql) UnmarshalJSON(data []byte) error {
 		tmp2.Status = PostgresStatus{PostgresClusterStatus: ClusterStatusInvalid}
 	} else if err := validateCloneClusterDescription(tmp2.Spec.Clone); err != nil {
 
+		tmp2.Error = err.Error()
+		tmp2.Status.PostgresClusterStatus = ClusterStatusInvalid
+	} else if err := validateWALArchiveDescription(tmp2.Spec.WALArchive); err != nil {
+		tmp2.Error = err.Error()
+		tmp2.Status.PostgresClusterStatus = ClusterStatusInvalid
+	} else if err := validateTablespaces(tmp2.Spec.Tablespaces); err != nil {
+		tmp2.Error = err.Error()
+		tmp2.Status.PostgresClusterStatus = ClusterStatusInvalid
+	} else if err := validateDNS(tmp2.Spec.DNSPolicy, tmp2.Spec.DNSConfig); err != nil {
+		tmp2.Error = err.Error()
+		tmp2.Status.PostgresClusterStatus = ClusterStatusInvalid
+	} else if err := validateHostAliases(tmp2.Spec.HostAliases); err != nil {
+		tmp2.Error = err.Error()
+		tmp2.Status.PostgresClusterStatus = ClusterStatusInvalid
+	} else if err := validatePodAntiAffinityTopologyKey(tmp2.Spec.PodAntiAffinityTopologyKey); err != nil {
+		tmp2.Error = err.Error()
+		tmp2.Status.PostgresClusterStatus = ClusterStatusInvalid
+	} else if err := validateUserConnectionLimits(tmp2.Spec.Users, tmp2.Spec.UserConnectionLimits); err != nil {
+		tmp2.Error = err.Error()
+		tmp2.Status.PostgresClusterStatus = ClusterStatusInvalid
+	} else if err := validateUserValidUntil(tmp2.Spec.Users, tmp2.Spec.UserValidUntil); err != nil {
+		tmp2.Error = err.Error()
+		tmp2.Status.PostgresClusterStatus = ClusterStatusInvalid
+	} else if err := validateUserParameters(tmp2.Spec.Users, tmp2.Spec.UserParameters); err != nil {
+		tmp2.Error = err.Error()
+		tmp2.Status.PostgresClusterStatus = ClusterStatusInvalid
+	} else if err := validateConnectionPoolerAutoscaling(tmp2.Spec.ConnectionPooler); err != nil {
+		tmp2.Error = err.Error()
+		tmp2.Status.PostgresClusterStatus = ClusterStatusInvalid
+	} else if err := validateMaintenanceWindowsTimezone(tmp2.Spec.MaintenanceWindowsTimezone); err != nil {
+		tmp2.Error = err.Error()
+		tmp2.Status.PostgresClusterStatus = ClusterStatusInvalid
+	} else if err := validateInitScripts(tmp2.Spec.InitScripts); err != nil {
+		tmp2.Error = err.Error()
+		tmp2.Status.PostgresClusterStatus = ClusterStatusInvalid
+	} else if err := validateVolumeSnapshots(tmp2.Spec.VolumeSnapshots); err != nil {
+		tmp2.Error = err.Error()
+		tmp2.Status.PostgresClusterStatus = ClusterStatusInvalid
+	} else if err := validateTerminationGracePeriodSeconds(tmp2.Spec.TerminationGracePeriodSeconds); err != nil {
+		tmp2.Error = err.Error()
+		tmp2.Status.PostgresClusterStatus = ClusterStatusInvalid
+	} else if err := validateRetainedVolumeClaims(tmp2.Spec.RetainedVolumeClaims); err != nil {
+		tmp2.Error = err.Error()
+		tmp2.Status.PostgresClusterStatus = ClusterStatusInvalid
+	} else if err := validateVolumeMetadata(tmp2.Spec.Volume); err != nil {
+		tmp2.Error = err.Error()
+		tmp2.Status.PostgresClusterStatus = ClusterStatusInvalid
+	} else if err := validateEnv(tmp2.Spec.Env); err != nil {
+		tmp2.Error = err.Error()
+		tmp2.Status.PostgresClusterStatus = ClusterStatusInvalid
+	} else if err := validateProbe("readinessProbe", tmp2.Spec.ReadinessProbe); err != nil {
+		tmp2.Error = err.Error()
+		tmp2.Status.PostgresClusterStatus = ClusterStatusInvalid
+	} else if err := validateProbe("livenessProbe", tmp2.Spec.LivenessProbe); err != nil {
+		tmp2.Error = err.Error()
+		tmp2.Status.PostgresClusterStatus = ClusterStatusInvalid
+	} else if err := validateProbe("startupProbe", tmp2.Spec.StartupProbe); err != nil {
+		tmp2.Error = err.Error()
+		tmp2.Status.PostgresClusterStatus = ClusterStatusInvalid
+	} else if err := validateMetricsExporter(tmp2.Spec.MetricsExporter); err != nil {
+		tmp2.Error = err.Error()
+		tmp2.Status.PostgresClusterStatus = ClusterStatusInvalid
+	} else if err := validatePasswordEncryption(tmp2.Spec.PasswordEncryption, tmp2.Spec.Parameters); err != nil {
+		tmp2.Error = err.Error()
+		tmp2.Status.PostgresClusterStatus = ClusterStatusInvalid
+	} else if err := validateCascadingReplicas(tmp2.ObjectMeta.Name, tmp2.Spec.NumberOfInstances, tmp2.Spec.CascadingReplicas); err != nil {
+		tmp2.Error = err.Error()
+		tmp2.Status.PostgresClusterStatus = ClusterStatusInvalid
+	} else if err := validateReplicaServices(tmp2.ObjectMeta.Name, tmp2.Spec.ReplicaServices); err != nil {
+		tmp2.Error = err.Error()
+		tmp2.Status.PostgresClusterStatus = ClusterStatusInvalid
+	} else if err := validatePgIdent(tmp2.Spec.Patroni.PgIdent); err != nil {
+		tmp2.Error = err.Error()
+		tmp2.Status.PostgresClusterStatus = ClusterStatusInvalid
+	} else if err := validateSlots(tmp2.Spec.Patroni.Slots); err != nil {
+		tmp2.Error = err.Error()
+		tmp2.Status.PostgresClusterStatus = ClusterStatusInvalid
+	} else if err := validateMaximumLagOnFailover(tmp2.Spec.Patroni.MaximumLagOnFailover); err != nil {
 		tmp2.Error = err.Error()
 		tmp2.Status.PostgresClusterStatus = ClusterStatusInvalid
 	} else {
@@ -56,6 +56,7 @@ type KubernetesMetaConfiguration struct {
 	WatchedNamespace                       string                       `json:"watched_namespace,omitempty"`
 	PDBNameFormat                          config.StringTemplate        `json:"pdb_name_format,omitempty"`
 	EnablePodDisruptionBudget              *bool                        `json:"enable_pod_disruption_budget,omitempty"`
+	EnablePodAutoHeal                      bool                         `json:"enable_pod_auto_heal,omitempty"`
 	StorageResizeMode                      string                       `json:"storage_resize_mode,omitempty"`
 	EnableInitContainers                   *bool                        `json:"enable_init_containers,omitempty"`
 	EnableSidecars                         *bool                        `json:"enable_sidecars,omitempty"`
@@ -68,6 +69,7 @@ type KubernetesMetaConfiguration struct {
 	ClusterLabels                          map[string]string            `json:"cluster_labels,omitempty"`
 	InheritedLabels                        []string                     `json:"inherited_labels,omitempty"`
 	InheritedAnnotations                   []string                     `json:"inherited_annotations,omitempty"`
+	IgnoredAnnotations                     []string                     `json:"ignored_annotations,omitempty"`
 	DownscalerAnnotations                  []string                     `json:"downscaler_annotations,omitempty"`
 	ClusterNameLabel                       string                       `json:"cluster_name_label,omitempty"`
 	DeleteAnnotationDateKey                string                       `json:"delete_annotation_date_key,omitempty"`
@@ -97,12 +99,22 @@ type PostgresPodResourcesDefaults struct {
 
 // OperatorTimeouts defines the timeout of ResourceCheck, PodWait, ReadyWait
 type OperatorTimeouts struct {
-	ResourceCheckInterval  Duration `json:"resource_check_interval,omitempty"`
-	ResourceCheckTimeout   Duration `json:"resource_check_timeout,omitempty"`
-	PodLabelWaitTimeout    Duration `json:"pod_label_wait_timeout,omitempty"`
-	PodDeletionWaitTimeout Duration `json:"pod_deletion_wait_timeout,omitempty"`
-	ReadyWaitInterval      Duration `json:"ready_wait_interval,omitempty"`
-	ReadyWaitTimeout       Duration `json:"ready_wait_timeout,omitempty"`
+	ResourceCheckInterval     Duration `json:"resource_check_interval,omitempty"`
+	ResourceCheckTimeout      Duration `json:"resource_check_timeout,omitempty"`
+	PodLabelWaitTimeout       Duration `json:"pod_label_wait_timeout,omitempty"`
+	PodDeletionWaitTimeout    Duration `json:"pod_deletion_wait_timeout,omitempty"`
+	PodReadyWaitInterval      Duration `json:"pod_ready_wait_interval,omitempty"`
+	PodReadyWaitMaxInterval   Duration `json:"pod_ready_wait_max_interval,omitempty"`
+	PodReadyWaitTimeout       Duration `json:"pod_ready_wait_timeout,omitempty"`
+	PodReadyWaitJitterPercent *int32   `json:"pod_ready_wait_jitter_percent,omitempty"`
+	DBStatementTimeout        Duration `json:"db_statement_timeout,omitempty"`
+	DBLongStatementTimeout    Duration `json:"db_long_statement_timeout,omitempty"`
+	SyncStepTimeout           Duration `json:"sync_step_timeout,omitempty"`
+	SyncLongStepTimeout       Duration `json:"sync_long_step_timeout,omitempty"`
+	ClusterLockTimeout        Duration `json:"cluster_lock_timeout,omitempty"`
+	PodAutoHealTimeout        Duration `json:"pod_auto_heal_timeout,omitempty"`
+	ReadyWaitInterval         Duration `json:"ready_wait_interval,omitempty"`
+	ReadyWaitTimeout          Duration `json:"ready_wait_timeout,omitempty"`
 }
 
 // LoadBalancerConfiguration defines the LB configuration
@@ -183,6 +195,7 @@ type ConnectionPoolerConfiguration struct {
 	DefaultMemoryRequest string `json:"connection_pooler_default_memory_request,omitempty"`
 	DefaultCPULimit      string `json:"connection_pooler_default_cpu_limit,omitempty"`
 	DefaultMemoryLimit   string `json:"connection_pooler_default_memory_limit,omitempty"`
+	RestartImage         string `json:"connection_pooler_restart_image,omitempty"`
 }
 
 // OperatorLogicalBackupConfiguration defines configuration for logical backup
@@ -214,6 +227,7 @@ type OperatorConfigurationData struct {
 	MaxInstances               int32                              `json:"max_instances,omitempty"`
 	ResyncPeriod               Duration                           `json:"resync_period,omitempty"`
 	RepairPeriod               Duration                           `json:"repair_period,omitempty"`
+	FullResyncPeriod           Duration                           `json:"full_resync_period,omitempty"`
 	SetMemoryRequestToLimit    bool                               `json:"set_memory_request_to_limit,omitempty"`
 	ShmVolume                  *bool                              `json:"enable_shm_volume,omitempty"`
 	SidecarImages              map[string]string                  `json:"sidecar_docker_images,omitempty"` // deprecated in favour of SidecarContainers
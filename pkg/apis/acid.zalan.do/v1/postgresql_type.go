@@ -39,6 +39,8 @@ type PostgresSpec struct {
 	SpiloRunAsUser  *int64 `json:"spiloRunAsUser,omitempty"`
 	SpiloRunAsGroup *int64 `json:"spiloRunAsGroup,omitempty"`
 	SpiloFSGroup    *int64 `json:"spiloFSGroup,omitempty"`
+	// OnRootMismatch skips the recursive change of the volume ownership when the root directory already has the fsGroup
+	SpiloFSGroupChangePolicy v1.PodFSGroupChangePolicy `json:"spiloFSGroupChangePolicy,omitempty"`
 
 	// vars that enable load balancers are pointers because it is important to know if any of them is omitted from the Postgres manifest
 	// in that case the var evaluates to nil and the value is taken from the operator config
@@ -50,9 +52,143 @@ type PostgresSpec struct {
 	UseLoadBalancer     *bool `json:"useLoadBalancer,omitempty"`
 	ReplicaLoadBalancer *bool `json:"replicaLoadBalancer,omitempty"`
 
+	// expose the master service on every node, a load balancer takes precedence if enabled
+	EnableMasterNodePort *bool  `json:"enableMasterNodePort,omitempty"`
+	MasterNodePort       *int32 `json:"masterNodePort,omitempty"`
+
+	// route of a Gateway API gateway to the master service, an alternative to a load balancer or a node port
+	MasterTCPRoute *MasterTCPRoute `json:"masterTCPRoute,omitempty"`
+
+	// external DNS name of the master service as a template of {cluster}, {team} and {hostedzone}, published for
+	// any service type, it takes precedence over the master_dns_name_format of the configuration
+	MasterDNSNameFormat string `json:"masterDNSNameFormat,omitempty"`
+
 	// load balancers' source ranges are the same for master and replica services
 	AllowedSourceRanges []string `json:"allowedSourceRanges"`
 
+	// session affinity of the replica service, either "None" or "ClientIP"
+	ReplicaSessionAffinity               string `json:"replicaSessionAffinity,omitempty"`
+	ReplicaSessionAffinityTimeoutSeconds *int32 `json:"replicaSessionAffinityTimeoutSeconds,omitempty"`
+
+	// external traffic policy of the replica load balancer, "Local" preserves the source IPs of the clients,
+	// defaults to the external_traffic_policy of the configuration
+	ReplicaExternalTrafficPolicy string `json:"replicaExternalTrafficPolicy,omitempty"`
+
+	// replicas lagging behind the primary by more bytes are left out of the replica service endpoint
+	ReplicaServiceMaxLag *int64 `json:"replicaServiceMaxLag,omitempty"`
+
+	// the replica service and endpoint are created unless explicitly disabled
+	EnableReplicaService *bool `json:"enableReplicaService,omitempty"`
+
+	// a ClusterIP service per pod, named after the pod, e.g. to debug or read from a specific replica
+	EnablePodServices bool `json:"enablePodServices,omitempty"`
+
+	// additional replica services routing only to the synchronous standbys or only to the asynchronous replicas
+	ReplicaServices []ReplicaService `json:"replicaServices,omitempty"`
+
+	// node labels the Postgres pods are scheduled on, changing them moves the pods with a rolling update
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// required pod anti-affinity keeps the pods of the cluster in distinct topology domains, e.g. nodes
+	EnablePodAntiAffinity      *bool  `json:"enablePodAntiAffinity,omitempty"`
+	PodAntiAffinityTopologyKey string `json:"podAntiAffinityTopologyKey,omitempty"`
+
+	// connection limits of the manifest users, -1 removes the limit, users not listed keep their current limit
+	UserConnectionLimits map[string]int64 `json:"userConnectionLimits,omitempty"`
+
+	// expiry of the manifest users as RFC 3339 timestamps, "infinity" removes it, users not listed keep their current one
+	UserValidUntil map[string]string `json:"userValidUntil,omitempty"`
+
+	// role level settings (ALTER ROLE ... SET) of the manifest users, settings missing from a listed user are reset,
+	// an empty map resets all of them, users not listed keep their current settings
+	UserParameters map[string]map[string]string `json:"userParameters,omitempty"`
+
+	// passwords of the manifest users read from externally managed secrets instead of being generated,
+	// the operator neither creates nor deletes these secrets
+	ExternalSecrets map[string]ExternalSecret `json:"externalSecrets,omitempty"`
+
+	// environment variables of the Postgres container, either values or references to secrets and config maps,
+	// a changed content of the referenced objects only rolls the pods when requested
+	Env                      []v1.EnvVar `json:"env,omitempty"`
+	RestartOnEnvSourceChange bool        `json:"restartOnEnvSourceChange,omitempty"`
+
+	// secrets to pull the Spilo image and the sidecar images from private registries
+	ImagePullSecrets []v1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+
+	// probes of the Postgres container against the Patroni API, the container has no probes without them
+	ReadinessProbe *Probe `json:"readinessProbe,omitempty"`
+	LivenessProbe  *Probe `json:"livenessProbe,omitempty"`
+	// holds back the liveness probe until the first successful check, so slow starts of large databases survive
+	StartupProbe *Probe `json:"startupProbe,omitempty"`
+
+	// metrics port of an exporter sidecar, exposed on the services and probed over HTTP
+	MetricsExporter *MetricsExporter `json:"metricsExporter,omitempty"`
+
+	// manage a monitoring role with pg_monitor membership and the pg_stat_statements extension
+	EnableMonitoringRole bool `json:"enableMonitoringRole,omitempty"`
+
+	// manage a backup role with the read grants pg_dump needs on the databases of the manifest
+	EnableBackupRole bool `json:"enableBackupRole,omitempty"`
+
+	// audit logging with pgaudit, the library is preloaded and the extension installed into the databases
+	Audit *Audit `json:"audit,omitempty"`
+
+	// time given to Postgres to shut down cleanly, defaults to the pod_terminate_grace_period of the configuration
+	TerminationGracePeriodSeconds *int64 `json:"terminationGracePeriodSeconds,omitempty"`
+
+	// time a recreated pod has to stay ready before the rolling update moves on to the next one
+	MinReadySeconds *int32 `json:"minReadySeconds,omitempty"`
+
+	// number of replicas recreated at once by a rolling update, capped so that a majority of the instances stays up
+	MaxUnavailableReplicas *int32 `json:"maxUnavailableReplicas,omitempty"`
+
+	// derive shared_buffers, effective_cache_size and maintenance_work_mem from the memory limit of the Postgres
+	// container, parameters of the manifest take precedence
+	EnableMemoryTuning bool `json:"enableMemoryTuning,omitempty"`
+
+	// switch the leader over to a replica before its Postgres container stops
+	EnablePreStopSwitchover bool `json:"enablePreStopSwitchover,omitempty"`
+
+	// quiesce the cluster for maintenance by making new transactions read-only, reverted when switched off
+	ReadOnly bool `json:"readOnly,omitempty"`
+
+	// entrypoint and its arguments of the Postgres container replacing the ones of the Spilo image, e.g. to run a
+	// wrapper script, changing them rolls the pods
+	Command []string `json:"command,omitempty"`
+	Args    []string `json:"args,omitempty"`
+
+	// method the passwords of the roles are encrypted with, roles using another one get their password set again
+	PasswordEncryption string `json:"passwordEncryption,omitempty"`
+
+	// pods never promoted by Patroni, selected by name or by the zone of their node
+	NoFailover *NoFailover `json:"noFailover,omitempty"`
+
+	// replicas streaming from another replica instead of the leader, they are never promoted either
+	CascadingReplicas []CascadingReplica `json:"cascadingReplicas,omitempty"`
+
+	// SQL scripts run once after the cluster has been created
+	InitScripts []InitScript `json:"initScripts,omitempty"`
+
+	// scheduled snapshots of a replica's data volume through the snapshot API of the CSI driver
+	VolumeSnapshots *VolumeSnapshots `json:"volumeSnapshots,omitempty"`
+
+	// scheduled restores of the latest backup into a throwaway pod, verified by a query
+	BackupVerification *BackupVerification `json:"backupVerification,omitempty"`
+
+	// volumes are left to an external storage controller when explicitly disabled
+	ManageVolumes *bool `json:"manageVolumes,omitempty"`
+
+	// number of volume claims of pods removed by a scale-down kept for a quick scale-up, all are kept without it
+	RetainedVolumeClaims *int32 `json:"retainedVolumeClaims,omitempty"`
+
+	// keys of the manifest labels copied to all objects of the cluster, next to the inherited_labels of the configuration
+	InheritedLabels []string `json:"inheritedLabels,omitempty"`
+
+	// postpone the changes of parameters requiring a restart and the rolling updates to the maintenance windows
+	DeferRestartParameters     bool   `json:"deferRestartParameters,omitempty"`
+	DeferRollingUpdates        bool   `json:"deferRollingUpdates,omitempty"`
+	MaintenanceWindowsTimezone string `json:"maintenanceWindowsTimezone,omitempty"`
+
 	NumberOfInstances     int32                       `json:"numberOfInstances"`
 	Users                 map[string]UserFlags        `json:"users,omitempty"`
 	MaintenanceWindows    []MaintenanceWindow         `json:"maintenanceWindows,omitempty"`
@@ -63,6 +199,9 @@ type PostgresSpec struct {
 	SchedulerName         *string                     `json:"schedulerName,omitempty"`
 	NodeAffinity          *v1.NodeAffinity            `json:"nodeAffinity,omitempty"`
 	Tolerations           []v1.Toleration             `json:"tolerations,omitempty"`
+	DNSPolicy             v1.DNSPolicy                `json:"dnsPolicy,omitempty"`
+	DNSConfig             *v1.PodDNSConfig            `json:"dnsConfig,omitempty"`
+	HostAliases           []v1.HostAlias              `json:"hostAliases,omitempty"`
 	Sidecars              []Sidecar                   `json:"sidecars,omitempty"`
 	InitContainers        []v1.Container              `json:"initContainers,omitempty"`
 	PodPriorityClassName  string                      `json:"podPriorityClassName,omitempty"`
@@ -74,6 +213,15 @@ type PostgresSpec struct {
 	ServiceAnnotations    map[string]string           `json:"serviceAnnotations,omitempty"`
 	TLS                   *TLSDescription             `json:"tls,omitempty"`
 	AdditionalVolumes     []AdditionalVolume          `json:"additionalVolumes,omitempty"`
+	WALArchive            *WALArchiveDescription      `json:"walArchive,omitempty"`
+	Tablespaces           []Tablespace                `json:"tablespaces,omitempty"`
+
+	// service account of the Postgres pods, defaults to the pod_service_account_name of the configuration
+	ServiceAccountName   string `json:"serviceAccountName,omitempty"`
+	CreateServiceAccount bool   `json:"createServiceAccount,omitempty"`
+
+	// role with the access Patroni needs to the Kubernetes API, bound to the service account of the pods
+	CreatePatroniRole bool `json:"createPatroniRole,omitempty"`
 
 	// deprecated json tags
 	InitContainersOld       []v1.Container `json:"init_containers,omitempty"`
@@ -119,6 +267,9 @@ type Volume struct {
 	Iops         *int64 `json:"iops,omitempty"`
 	Throughput   *int64 `json:"throughput,omitempty"`
 	VolumeType   string `json:"type,omitempty"`
+	// set on the existing volume claims of the cluster, not on the template of the statefulset
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
 }
 
 // AdditionalVolume specs additional optional volumes for statefulset
@@ -128,6 +279,7 @@ type AdditionalVolume struct {
 	SubPath          string          `json:"subPath,omitempty"`
 	TargetContainers []string        `json:"targetContainers"`
 	VolumeSource     v1.VolumeSource `json:"volumeSource"`
+	RestartOnChange  bool            `json:"restartOnChange,omitempty"`
 }
 
 // PostgresqlParam describes PostgreSQL version and pairs of configuration parameter name - values.
@@ -152,13 +304,24 @@ type Resources struct {
 type Patroni struct {
 	InitDB                map[string]string            `json:"initdb,omitempty"`
 	PgHba                 []string                     `json:"pg_hba,omitempty"`
+	PgIdent               []string                     `json:"pg_ident,omitempty"`
 	TTL                   uint32                       `json:"ttl,omitempty"`
 	LoopWait              uint32                       `json:"loop_wait,omitempty"`
 	RetryTimeout          uint32                       `json:"retry_timeout,omitempty"`
-	MaximumLagOnFailover  float32                      `json:"maximum_lag_on_failover,omitempty"` // float32 because https://github.com/kubernetes/kubernetes/issues/30213
+	MaximumLagOnFailover  *int64                       `json:"maximum_lag_on_failover,omitempty"`
 	Slots                 map[string]map[string]string `json:"slots,omitempty"`
-	SynchronousMode       bool                         `json:"synchronous_mode,omitempty"`
+	SynchronousMode       *bool                        `json:"synchronous_mode,omitempty"`
 	SynchronousModeStrict bool                         `json:"synchronous_mode_strict,omitempty"`
+	SynchronousNodeCount  uint32                       `json:"synchronous_node_count,omitempty"`
+	APITLS                *PatroniAPITLS               `json:"api_tls,omitempty"`
+}
+
+// PatroniAPITLS describes the secret with the certificate the Patroni REST API is served with
+type PatroniAPITLS struct {
+	SecretName      string `json:"secretName"`
+	CertificateFile string `json:"certificateFile,omitempty"`
+	PrivateKeyFile  string `json:"privateKeyFile,omitempty"`
+	CAFile          string `json:"caFile,omitempty"`
 }
 
 // StandbyDescription contains s3 wal path
@@ -166,6 +329,106 @@ type StandbyDescription struct {
 	S3WalPath string `json:"s3_wal_path,omitempty"`
 }
 
+// WALArchiveDescription contains the WAL archive destination overriding the operator configuration
+type WALArchiveDescription struct {
+	S3Bucket string `json:"s3Bucket,omitempty"`
+	GSBucket string `json:"gsBucket,omitempty"`
+}
+
+// Tablespace describes a tablespace stored on its own volume
+type Tablespace struct {
+	Name         string `json:"name"`
+	Size         string `json:"size"`
+	StorageClass string `json:"storageClass,omitempty"`
+}
+
+// ExternalSecret references the secret in the cluster's namespace holding the password of a user
+type ExternalSecret struct {
+	SecretName  string `json:"secretName"`
+	PasswordKey string `json:"passwordKey,omitempty"`
+}
+
+// InitScript references a SQL script in a config map of the cluster's namespace
+type InitScript struct {
+	Name      string `json:"name"`
+	Database  string `json:"database,omitempty"`
+	ConfigMap string `json:"configMap"`
+	Key       string `json:"key"`
+}
+
+// VolumeSnapshots describes how often the data volume is snapshotted and how many snapshots are kept
+type VolumeSnapshots struct {
+	VolumeSnapshotClassName string `json:"volumeSnapshotClassName,omitempty"`
+	Interval                string `json:"interval"`
+	Retention               int32  `json:"retention,omitempty"`
+}
+
+// BackupVerification describes when the latest base backup is restored into a throwaway pod and the query that has
+// to succeed on the restored data
+type BackupVerification struct {
+	Schedule string `json:"schedule"`
+	Query    string `json:"query,omitempty"`
+}
+
+// MasterTCPRoute attaches a TCPRoute of the Gateway API to a listener of a gateway, the connections are routed to
+// the master service
+type MasterTCPRoute struct {
+	GatewayName      string `json:"gatewayName"`
+	GatewayNamespace string `json:"gatewayNamespace,omitempty"`
+	SectionName      string `json:"sectionName,omitempty"`
+}
+
+// Probe tunes the timing of a probe of the Postgres container, unset fields use the Kubernetes defaults
+type Probe struct {
+	InitialDelaySeconds int32 `json:"initialDelaySeconds,omitempty"`
+	TimeoutSeconds      int32 `json:"timeoutSeconds,omitempty"`
+	PeriodSeconds       int32 `json:"periodSeconds,omitempty"`
+	FailureThreshold    int32 `json:"failureThreshold,omitempty"`
+}
+
+// MetricsExporter describes the sidecar serving the metrics of the cluster, its port is added to the services
+// selecting the pods and the probes are sent to the metrics path. Prometheus can scrape the pods directly
+// through a PodMonitor.
+type MetricsExporter struct {
+	Sidecar        string `json:"sidecar"`
+	Port           int32  `json:"port"`
+	Path           string `json:"path,omitempty"`
+	ReadinessProbe *Probe `json:"readinessProbe,omitempty"`
+	LivenessProbe  *Probe `json:"livenessProbe,omitempty"`
+	PodMonitor     bool   `json:"podMonitor,omitempty"`
+}
+
+// Audit describes the pgaudit settings of the cluster. Log lists the statement classes written to the audit log,
+// the other fields map to the pgaudit.log_catalog, pgaudit.log_parameter, pgaudit.log_relation and pgaudit.role
+// parameters.
+type Audit struct {
+	Log          []string `json:"log,omitempty"`
+	LogCatalog   *bool    `json:"logCatalog,omitempty"`
+	LogParameter bool     `json:"logParameter,omitempty"`
+	LogRelation  bool     `json:"logRelation,omitempty"`
+	Role         string   `json:"role,omitempty"`
+}
+
+// NoFailover selects the pods tagged as nofailover in Patroni, either by their names or by the zones of the
+// nodes they run on
+type NoFailover struct {
+	Pods  []string `json:"pods,omitempty"`
+	Zones []string `json:"zones,omitempty"`
+}
+
+// CascadingReplica tags a pod of the cluster to replicate from another one in Patroni, both given by their names
+type CascadingReplica struct {
+	Pod           string `json:"pod"`
+	ReplicateFrom string `json:"replicateFrom"`
+}
+
+// ReplicaService is a replica service selecting either the synchronous standbys or the asynchronous replicas,
+// named after the replica service with the given suffix
+type ReplicaService struct {
+	Name    string `json:"name"`
+	Members string `json:"members"`
+}
+
 // TLSDescription specs TLS properties
 type TLSDescription struct {
 	SecretName      string `json:"secretName,omitempty"`
@@ -201,7 +464,43 @@ type UserFlags []string
 
 // PostgresStatus contains status of the PostgreSQL cluster (running, creation failed etc.)
 type PostgresStatus struct {
-	PostgresClusterStatus string `json:"PostgresClusterStatus"`
+	PostgresClusterStatus string               `json:"PostgresClusterStatus"`
+	Conditions            []ClusterCondition   `json:"conditions,omitempty"`
+	InitScripts           []string             `json:"initScripts,omitempty"`
+	Members               []MemberStatus       `json:"members,omitempty"`
+	PromotionTime         *metav1.Time         `json:"promotionTime,omitempty"`
+	SynchronousMode       string               `json:"synchronousMode,omitempty"`
+	MaximumLagOnFailover  *int64               `json:"maximumLagOnFailover,omitempty"`
+	LoadBalancers         []LoadBalancerStatus `json:"loadBalancers,omitempty"`
+	ReplicationSlots      []string             `json:"replicationSlots,omitempty"`
+	ObservedGeneration    int64                `json:"observedGeneration,omitempty"`
+}
+
+// ClusterCondition reports a detail of the cluster state observed during the last sync
+type ClusterCondition struct {
+	Type               string             `json:"type"`
+	Status             v1.ConditionStatus `json:"status"`
+	Reason             string             `json:"reason,omitempty"`
+	Message            string             `json:"message,omitempty"`
+	LastTransitionTime metav1.Time        `json:"lastTransitionTime,omitempty"`
+}
+
+// MemberStatus reports the Patroni role, state and replication lag of a cluster member observed during the last sync
+type MemberStatus struct {
+	Name     string `json:"name"`
+	Role     string `json:"role"`
+	State    string `json:"state"`
+	Timeline int    `json:"timeline,omitempty"`
+	LagBytes *int64 `json:"lagBytes,omitempty"`
+}
+
+// LoadBalancerStatus reports the addresses of the load balancer of the master or replica service observed during the
+// last sync
+type LoadBalancerStatus struct {
+	Role      string   `json:"role"`
+	State     string   `json:"state"`
+	DNSName   string   `json:"dnsName,omitempty"`
+	Addresses []string `json:"addresses,omitempty"`
 }
 
 // ConnectionPooler Options for connection pooler
@@ -223,4 +522,16 @@ type ConnectionPooler struct {
 	MaxDBConnections  *int32 `json:"maxDBConnections,omitempty"`
 
 	Resources `json:"resources,omitempty"`
+
+	Autoscaling *ConnectionPoolerAutoscaling `json:"autoscaling,omitempty"`
+
+	// cron schedule of a job restarting the connection pooler deployments, no restarts if empty
+	RestartSchedule string `json:"restartSchedule,omitempty"`
+}
+
+// ConnectionPoolerAutoscaling describes the horizontal pod autoscaler of the connection pooler deployment
+type ConnectionPoolerAutoscaling struct {
+	MinReplicas                    *int32 `json:"minReplicas,omitempty"`
+	MaxReplicas                    int32  `json:"maxReplicas"`
+	TargetCPUUtilizationPercentage *int32 `json:"targetCPUUtilizationPercentage,omitempty"`
 }
@@ -2,16 +2,25 @@ package v1
 
 import (
 	"fmt"
+	"net"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
+	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 var (
 	weekdays         = map[string]int{"Sun": 0, "Mon": 1, "Tue": 2, "Wed": 3, "Thu": 4, "Fri": 5, "Sat": 6}
 	serviceNameRegex = regexp.MustCompile(serviceNameRegexString)
+	s3BucketRegex    = regexp.MustCompile(s3BucketRegexString)
+	gsBucketRegex    = regexp.MustCompile(gsBucketRegexString)
+	tablespaceRegex  = regexp.MustCompile(tablespaceNameRegexString)
+	parameterRegex   = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_.]*$`)
+	slotNameRegex    = regexp.MustCompile(`^[a-z0-9_]{1,63}$`)
 )
 
 // Clone convenience wrapper around DeepCopy
@@ -84,6 +93,435 @@ func validateCloneClusterDescription(clone *CloneDescription) error {
 	return nil
 }
 
+func validateWALArchiveDescription(walArchive *WALArchiveDescription) error {
+	if walArchive == nil {
+		return nil
+	}
+	if walArchive.S3Bucket != "" && walArchive.GSBucket != "" {
+		return fmt.Errorf("only one of the WAL archive buckets s3Bucket and gsBucket can be specified")
+	}
+	if walArchive.S3Bucket != "" {
+		if !s3BucketRegex.MatchString(walArchive.S3Bucket) || strings.Contains(walArchive.S3Bucket, "..") {
+			return fmt.Errorf("WAL archive S3 bucket %q is not a valid bucket name, regex used for validation is %q",
+				walArchive.S3Bucket, s3BucketRegexString)
+		}
+	}
+	if walArchive.GSBucket != "" {
+		if !gsBucketRegex.MatchString(walArchive.GSBucket) || strings.Contains(walArchive.GSBucket, "..") {
+			return fmt.Errorf("WAL archive GS bucket %q is not a valid bucket name, regex used for validation is %q",
+				walArchive.GSBucket, gsBucketRegexString)
+		}
+	}
+	return nil
+}
+
+func validateTablespaces(tablespaces []Tablespace) error {
+	names := make(map[string]bool)
+	for _, tablespace := range tablespaces {
+		if !tablespaceRegex.MatchString(tablespace.Name) {
+			return fmt.Errorf("tablespace name %q is not valid, regex used for validation is %q",
+				tablespace.Name, tablespaceNameRegexString)
+		}
+		if strings.HasPrefix(tablespace.Name, "pg_") {
+			return fmt.Errorf("tablespace name %q is reserved, the prefix \"pg_\" is used by system tablespaces",
+				tablespace.Name)
+		}
+		if names[tablespace.Name] {
+			return fmt.Errorf("tablespace %q is defined more than once", tablespace.Name)
+		}
+		names[tablespace.Name] = true
+	}
+	return nil
+}
+
+func validateDNS(dnsPolicy v1.DNSPolicy, dnsConfig *v1.PodDNSConfig) error {
+	if dnsPolicy == v1.DNSNone && (dnsConfig == nil || len(dnsConfig.Nameservers) == 0) {
+		return fmt.Errorf("dnsConfig with at least one nameserver is required when dnsPolicy is %q", v1.DNSNone)
+	}
+	return nil
+}
+
+func validateHostAliases(hostAliases []v1.HostAlias) error {
+	for _, hostAlias := range hostAliases {
+		if net.ParseIP(hostAlias.IP) == nil {
+			return fmt.Errorf("host alias IP %q is not a valid IP address", hostAlias.IP)
+		}
+		if len(hostAlias.Hostnames) == 0 {
+			return fmt.Errorf("host alias for IP %q has no hostnames", hostAlias.IP)
+		}
+	}
+	return nil
+}
+
+func validatePodAntiAffinityTopologyKey(topologyKey string) error {
+	if topologyKey == "" {
+		return nil
+	}
+	if errs := validation.IsQualifiedName(topologyKey); len(errs) > 0 {
+		return fmt.Errorf("podAntiAffinityTopologyKey %q is not a valid label key: %s", topologyKey, strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// validateVolumeMetadata checks the labels and annotations set on the volume claims, the API server refuses a patch
+// with an invalid key or label value
+func validateVolumeMetadata(volume Volume) error {
+	for key, value := range volume.Labels {
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return fmt.Errorf("volume label %q is not a valid label key: %s", key, strings.Join(errs, "; "))
+		}
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			return fmt.Errorf("volume label %q has an invalid value %q: %s", key, value, strings.Join(errs, "; "))
+		}
+	}
+	for key := range volume.Annotations {
+		if errs := validation.IsQualifiedName(strings.ToLower(key)); len(errs) > 0 {
+			return fmt.Errorf("volume annotation %q is not a valid annotation key: %s", key, strings.Join(errs, "; "))
+		}
+	}
+	return nil
+}
+
+func validateUserConnectionLimits(users map[string]UserFlags, connectionLimits map[string]int64) error {
+	for username, limit := range connectionLimits {
+		if _, ok := users[username]; !ok {
+			return fmt.Errorf("connection limit defined for user %q which is not listed in users", username)
+		}
+		if limit < -1 {
+			return fmt.Errorf("connection limit %d of user %q is not valid, use -1 for no limit", limit, username)
+		}
+	}
+	return nil
+}
+
+func validateUserValidUntil(users map[string]UserFlags, validUntil map[string]string) error {
+	for username, expiry := range validUntil {
+		if _, ok := users[username]; !ok {
+			return fmt.Errorf("expiry defined for user %q which is not listed in users", username)
+		}
+		if expiry == "infinity" {
+			continue
+		}
+		if _, err := time.Parse(time.RFC3339, expiry); err != nil {
+			return fmt.Errorf("expiry %q of user %q is neither an RFC 3339 timestamp nor \"infinity\"", expiry, username)
+		}
+	}
+	return nil
+}
+
+func validateUserParameters(users map[string]UserFlags, userParameters map[string]map[string]string) error {
+	for username, parameters := range userParameters {
+		if _, ok := users[username]; !ok {
+			return fmt.Errorf("parameters defined for user %q which is not listed in users", username)
+		}
+		for name, value := range parameters {
+			if !parameterRegex.MatchString(name) {
+				return fmt.Errorf("parameter %q of user %q is not a valid parameter name", name, username)
+			}
+			if strings.TrimSpace(value) == "" {
+				return fmt.Errorf("parameter %q of user %q has an empty value", name, username)
+			}
+		}
+	}
+	return nil
+}
+
+const maxProbeInitialDelaySeconds = 3600
+
+func validateProbe(name string, probe *Probe) error {
+	if probe == nil {
+		return nil
+	}
+	if probe.InitialDelaySeconds < 0 || probe.InitialDelaySeconds > maxProbeInitialDelaySeconds {
+		return fmt.Errorf("%s initialDelaySeconds must be between 0 and %d", name, maxProbeInitialDelaySeconds)
+	}
+	if probe.TimeoutSeconds < 0 || probe.PeriodSeconds < 0 || probe.FailureThreshold < 0 {
+		return fmt.Errorf("%s timeoutSeconds, periodSeconds and failureThreshold must be positive", name)
+	}
+	if probe.TimeoutSeconds > 0 && probe.PeriodSeconds > 0 && probe.TimeoutSeconds > probe.PeriodSeconds {
+		return fmt.Errorf("%s timeoutSeconds %d exceeds periodSeconds %d", name, probe.TimeoutSeconds, probe.PeriodSeconds)
+	}
+	return nil
+}
+
+func validateMetricsExporter(exporter *MetricsExporter) error {
+	if exporter == nil {
+		return nil
+	}
+	if exporter.Sidecar == "" {
+		return fmt.Errorf("metricsExporter must name the sidecar running the exporter")
+	}
+	if exporter.Port < 1 || exporter.Port > 65535 {
+		return fmt.Errorf("metricsExporter port %d is not a valid port", exporter.Port)
+	}
+	// the ports of Postgres and the Patroni API
+	if exporter.Port == 5432 || exporter.Port == 8008 {
+		return fmt.Errorf("metricsExporter port %d is already used by the Postgres container", exporter.Port)
+	}
+	if exporter.Path != "" && !strings.HasPrefix(exporter.Path, "/") {
+		return fmt.Errorf("metricsExporter path %q must start with a slash", exporter.Path)
+	}
+	if err := validateProbe("metricsExporter readinessProbe", exporter.ReadinessProbe); err != nil {
+		return err
+	}
+	return validateProbe("metricsExporter livenessProbe", exporter.LivenessProbe)
+}
+
+func validateConnectionPoolerAutoscaling(connectionPooler *ConnectionPooler) error {
+	if connectionPooler == nil || connectionPooler.Autoscaling == nil {
+		return nil
+	}
+	autoscaling := connectionPooler.Autoscaling
+	if autoscaling.MinReplicas != nil && *autoscaling.MinReplicas > autoscaling.MaxReplicas {
+		return fmt.Errorf("connection pooler autoscaling minReplicas %d exceeds maxReplicas %d",
+			*autoscaling.MinReplicas, autoscaling.MaxReplicas)
+	}
+	return nil
+}
+
+func validateInitScripts(initScripts []InitScript) error {
+	names := make(map[string]bool, len(initScripts))
+	for _, script := range initScripts {
+		if script.Name == "" || script.ConfigMap == "" || script.Key == "" {
+			return fmt.Errorf("init scripts require a name, a config map and a key")
+		}
+		if names[script.Name] {
+			return fmt.Errorf("init script name %q is not unique", script.Name)
+		}
+		names[script.Name] = true
+	}
+	return nil
+}
+
+func validateVolumeSnapshots(snapshots *VolumeSnapshots) error {
+	if snapshots == nil {
+		return nil
+	}
+	interval, err := time.ParseDuration(snapshots.Interval)
+	if err != nil {
+		return fmt.Errorf("volumeSnapshots interval %q is not a valid duration: %v", snapshots.Interval, err)
+	}
+	if interval < time.Hour {
+		return fmt.Errorf("volumeSnapshots interval %q is shorter than one hour", snapshots.Interval)
+	}
+	if snapshots.Retention < 0 {
+		return fmt.Errorf("volumeSnapshots retention must not be negative, got %d", snapshots.Retention)
+	}
+	return nil
+}
+
+// Postgres needs some time for the shutdown checkpoint, a shorter grace period risks a crash recovery on start
+const minTerminationGracePeriodSeconds = 30
+
+func validateTerminationGracePeriodSeconds(gracePeriod *int64) error {
+	if gracePeriod != nil && *gracePeriod < minTerminationGracePeriodSeconds {
+		return fmt.Errorf("terminationGracePeriodSeconds must be at least %d, got %d", minTerminationGracePeriodSeconds, *gracePeriod)
+	}
+	return nil
+}
+
+// validateRetainedVolumeClaims rejects a negative number of retained volume claims
+func validateRetainedVolumeClaims(retained *int32) error {
+	if retained != nil && *retained < 0 {
+		return fmt.Errorf("retainedVolumeClaims must not be negative, got %d", *retained)
+	}
+	return nil
+}
+
+// validateEnv only allows references to secrets and config maps, Spilo does not need pod or resource fields
+func validateEnv(env []v1.EnvVar) error {
+	for _, envVar := range env {
+		if envVar.Name == "" {
+			return fmt.Errorf("environment variables require a name")
+		}
+		if envVar.ValueFrom == nil {
+			continue
+		}
+		if envVar.Value != "" {
+			return fmt.Errorf("environment variable %q can not have both a value and valueFrom", envVar.Name)
+		}
+		source := envVar.ValueFrom
+		if source.FieldRef != nil || source.ResourceFieldRef != nil {
+			return fmt.Errorf("environment variable %q can only reference secrets and config maps", envVar.Name)
+		}
+		if (source.SecretKeyRef == nil) == (source.ConfigMapKeyRef == nil) {
+			return fmt.Errorf("environment variable %q requires either a secretKeyRef or a configMapKeyRef", envVar.Name)
+		}
+	}
+	return nil
+}
+
+func validateMaintenanceWindowsTimezone(timezone string) error {
+	if timezone == "" {
+		return nil
+	}
+	if _, err := time.LoadLocation(timezone); err != nil {
+		return fmt.Errorf("maintenanceWindowsTimezone %q is not a valid time zone: %v", timezone, err)
+	}
+	return nil
+}
+
+// validatePasswordEncryption checks that the password encryption of the roles does not contradict the
+// password_encryption parameter, which Postgres uses for the passwords set by the users themselves
+func validatePasswordEncryption(encryption string, parameters map[string]string) error {
+	if encryption == "" {
+		return nil
+	}
+	if encryption != "md5" && encryption != "scram-sha-256" {
+		return fmt.Errorf("passwordEncryption %q must be either md5 or scram-sha-256", encryption)
+	}
+	if parameter, ok := parameters["password_encryption"]; ok && parameter != encryption {
+		return fmt.Errorf("passwordEncryption %q contradicts the password_encryption parameter %q", encryption, parameter)
+	}
+	return nil
+}
+
+// validateCascadingReplicas checks that every cascading replica and the pod it replicates from are instances of
+// the cluster, and that the replicas do not replicate from each other in a cycle
+func validateCascadingReplicas(name string, numberOfInstances int32, replicas []CascadingReplica) error {
+	instance := func(pod string) bool {
+		index, err := strconv.Atoi(strings.TrimPrefix(pod, name+"-"))
+		return err == nil && strings.HasPrefix(pod, name+"-") && index >= 0 && index < int(numberOfInstances)
+	}
+
+	replicateFrom := make(map[string]string, len(replicas))
+	for _, replica := range replicas {
+		if !instance(replica.Pod) {
+			return fmt.Errorf("cascading replica %q is not an instance of the cluster", replica.Pod)
+		}
+		if !instance(replica.ReplicateFrom) {
+			return fmt.Errorf("cascading replica %q replicates from %q, which is not an instance of the cluster",
+				replica.Pod, replica.ReplicateFrom)
+		}
+		if _, ok := replicateFrom[replica.Pod]; ok {
+			return fmt.Errorf("cascading replica %q is defined more than once", replica.Pod)
+		}
+		replicateFrom[replica.Pod] = replica.ReplicateFrom
+	}
+
+	for _, replica := range replicas {
+		seen := map[string]bool{replica.Pod: true}
+		for pod, ok := replica.ReplicateFrom, true; ok; pod, ok = replicateFrom[pod] {
+			if seen[pod] {
+				return fmt.Errorf("cascading replica %q replicates from itself through %q", replica.Pod, replica.ReplicateFrom)
+			}
+			seen[pod] = true
+		}
+	}
+	return nil
+}
+
+// validateReplicaServices checks that the additional replica services have distinct names, which together with the
+// name of the replica service form valid service names, and select either the sync or the async members
+func validateReplicaServices(name string, services []ReplicaService) error {
+	names := make(map[string]bool, len(services))
+	for _, service := range services {
+		serviceName := fmt.Sprintf("%s-repl-%s", name, service.Name)
+		if errs := validation.IsDNS1035Label(serviceName); service.Name == "" || len(errs) > 0 {
+			return fmt.Errorf("replica service %q is not a valid service name: %s", serviceName, strings.Join(errs, ", "))
+		}
+		if names[service.Name] {
+			return fmt.Errorf("replica service %q is defined more than once", serviceName)
+		}
+		names[service.Name] = true
+		if service.Members != "sync" && service.Members != "async" {
+			return fmt.Errorf("members %q of replica service %q must be either sync or async", service.Members, serviceName)
+		}
+	}
+	return nil
+}
+
+// validatePgIdent checks that every pg_ident line is a comment or a mapping with a map name, a system user
+// name and a database user name, where the names may be double quoted
+func validatePgIdent(lines []string) error {
+	for _, line := range lines {
+		if strings.ContainsAny(line, "\r\n") {
+			return fmt.Errorf("pg_ident line %q must not span multiple lines", line)
+		}
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		fields, err := pgIdentFields(trimmed)
+		if err != nil {
+			return fmt.Errorf("invalid pg_ident line %q: %v", line, err)
+		}
+		if len(fields) != 3 {
+			return fmt.Errorf("pg_ident line %q must consist of a map name, a system user name and a database user name", line)
+		}
+	}
+	return nil
+}
+
+// validateSlots checks the permanent replication slots, Postgres only allows lower case letters, digits and
+// underscores in slot names and a logical slot needs the database and output plugin it decodes with
+func validateSlots(slots map[string]map[string]string) error {
+	for name, attributes := range slots {
+		if !slotNameRegex.MatchString(name) {
+			return fmt.Errorf("replication slot name %q must consist of at most 63 lower case letters, digits and underscores", name)
+		}
+		switch attributes["type"] {
+		case "", "physical":
+		case "logical":
+			if attributes["database"] == "" || attributes["plugin"] == "" {
+				return fmt.Errorf("logical replication slot %q needs a database and a plugin", name)
+			}
+		default:
+			return fmt.Errorf("type %q of replication slot %q must be either logical or physical", attributes["type"], name)
+		}
+	}
+	return nil
+}
+
+// validateMaximumLagOnFailover checks that maximum_lag_on_failover is a number of bytes
+func validateMaximumLagOnFailover(maxLag *int64) error {
+	if maxLag != nil && *maxLag < 0 {
+		return fmt.Errorf("maximum_lag_on_failover %d must not be negative", *maxLag)
+	}
+	return nil
+}
+
+// pgIdentFields splits a pg_ident line into its whitespace separated fields, a trailing comment is dropped
+func pgIdentFields(line string) ([]string, error) {
+	var (
+		fields []string
+		field  strings.Builder
+		quoted bool
+		inside bool
+	)
+	for _, r := range line {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			inside = true
+			field.WriteRune(r)
+		case quoted:
+			field.WriteRune(r)
+		case r == '#':
+			if inside {
+				fields = append(fields, field.String())
+			}
+			return fields, nil
+		case r == ' ' || r == '\t':
+			if inside {
+				fields = append(fields, field.String())
+				field.Reset()
+				inside = false
+			}
+		default:
+			inside = true
+			field.WriteRune(r)
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if inside {
+		fields = append(fields, field.String())
+	}
+	return fields, nil
+}
+
 // Success of the current Status
 func (postgresStatus PostgresStatus) Success() bool {
 	return postgresStatus.PostgresClusterStatus != ClusterStatusAddFailed &&
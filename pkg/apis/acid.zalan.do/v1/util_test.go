@@ -5,10 +5,12 @@ import (
 	"encoding/json"
 	"errors"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/zalando/postgres-operator/pkg/util"
+	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -74,6 +76,41 @@ var cloneClusterDescriptions = []struct {
 	{"common cluster name", &CloneDescription{"foobar", "", "", "", "", "", "", nil}, nil},
 }
 
+var walArchiveDescriptions = []struct {
+	about string
+	in    *WALArchiveDescription
+	err   error
+}{
+	{"no WAL archive description", nil, nil},
+	{"valid S3 bucket", &WALArchiveDescription{S3Bucket: "my-wal.bucket"}, nil},
+	{"valid GS bucket", &WALArchiveDescription{GSBucket: "my_wal_bucket"}, nil},
+	{"expect error as both buckets are set", &WALArchiveDescription{S3Bucket: "my-wal-bucket", GSBucket: "my-wal-bucket"},
+		errors.New("only one of the WAL archive buckets s3Bucket and gsBucket can be specified")},
+	{"expect error as S3 bucket is an URL", &WALArchiveDescription{S3Bucket: "s3://my-wal-bucket"},
+		errors.New(`WAL archive S3 bucket "s3://my-wal-bucket" is not a valid bucket name, regex used for validation is "^[a-z0-9][-.a-z0-9]{1,61}[a-z0-9]$"`)},
+	{"expect error as S3 bucket contains underscores", &WALArchiveDescription{S3Bucket: "my_wal_bucket"},
+		errors.New(`WAL archive S3 bucket "my_wal_bucket" is not a valid bucket name, regex used for validation is "^[a-z0-9][-.a-z0-9]{1,61}[a-z0-9]$"`)},
+	{"expect error as S3 bucket contains adjacent periods", &WALArchiveDescription{S3Bucket: "my..bucket"},
+		errors.New(`WAL archive S3 bucket "my..bucket" is not a valid bucket name, regex used for validation is "^[a-z0-9][-.a-z0-9]{1,61}[a-z0-9]$"`)},
+	{"expect error as GS bucket is too short", &WALArchiveDescription{GSBucket: "ab"},
+		errors.New(`WAL archive GS bucket "ab" is not a valid bucket name, regex used for validation is "^[a-z0-9][-_.a-z0-9]{1,220}[a-z0-9]$"`)},
+}
+
+var tablespaces = []struct {
+	about string
+	in    []Tablespace
+	err   error
+}{
+	{"no tablespaces", nil, nil},
+	{"valid tablespaces", []Tablespace{{Name: "fast_ssd", Size: "10Gi"}, {Name: "archive", Size: "100Gi"}}, nil},
+	{"expect error as the name contains a dash", []Tablespace{{Name: "fast-ssd", Size: "10Gi"}},
+		errors.New(`tablespace name "fast-ssd" is not valid, regex used for validation is "^[a-z][a-z0-9_]{0,51}$"`)},
+	{"expect error as the name is reserved", []Tablespace{{Name: "pg_fast", Size: "10Gi"}},
+		errors.New(`tablespace name "pg_fast" is reserved, the prefix "pg_" is used by system tablespaces`)},
+	{"expect error as the name is duplicated", []Tablespace{{Name: "fast", Size: "10Gi"}, {Name: "fast", Size: "1Gi"}},
+		errors.New(`tablespace "fast" is defined more than once`)},
+}
+
 var maintenanceWindows = []struct {
 	about string
 	in    []byte
@@ -137,6 +174,7 @@ var postgresStatus = []struct {
 		PostgresStatus{PostgresClusterStatus: ClusterStatusUnknown}, nil}}
 
 var tmp postgresqlCopy
+var maxLagOnFailover = int64(33554432)
 var unmarshalCluster = []struct {
 	about   string
 	in      []byte
@@ -163,7 +201,7 @@ var unmarshalCluster = []struct {
 				"kind": "Postgresql","apiVersion": "acid.zalan.do/v1",
 				"metadata": {"name": "acid-testcluster1"}, "spec": {"teamId": 100}}`), &tmp).Error(),
 		},
-		marshal: []byte(`{"kind":"Postgresql","apiVersion":"acid.zalan.do/v1","metadata":{"name":"acid-testcluster1","creationTimestamp":null},"spec":{"postgresql":{"version":"","parameters":null},"volume":{"size":"","storageClass":""},"patroni":{"initdb":null,"pg_hba":null,"ttl":0,"loop_wait":0,"retry_timeout":0,"maximum_lag_on_failover":0,"slots":null},"resources":{"requests":{"cpu":"","memory":""},"limits":{"cpu":"","memory":""}},"teamId":"","allowedSourceRanges":null,"numberOfInstances":0,"users":null,"clone":null},"status":"Invalid"}`),
+		marshal: []byte(`{"kind":"Postgresql","apiVersion":"acid.zalan.do/v1","metadata":{"name":"acid-testcluster1","creationTimestamp":null},"spec":{"postgresql":{"version":"","parameters":null},"volume":{"size":"","storageClass":""},"patroni":{"initdb":null,"pg_hba":null,"ttl":0,"loop_wait":0,"retry_timeout":0,"slots":null},"resources":{"requests":{"cpu":"","memory":""},"limits":{"cpu":"","memory":""}},"teamId":"","allowedSourceRanges":null,"numberOfInstances":0,"users":null,"clone":null},"status":"Invalid"}`),
 		err:     nil},
 	{
 		about: "example with /status subresource",
@@ -184,7 +222,7 @@ var unmarshalCluster = []struct {
 				"kind": "Postgresql","apiVersion": "acid.zalan.do/v1",
 				"metadata": {"name": "acid-testcluster1"}, "spec": {"teamId": 100}}`), &tmp).Error(),
 		},
-		marshal: []byte(`{"kind":"Postgresql","apiVersion":"acid.zalan.do/v1","metadata":{"name":"acid-testcluster1","creationTimestamp":null},"spec":{"postgresql":{"version":"","parameters":null},"volume":{"size":"","storageClass":""},"patroni":{"initdb":null,"pg_hba":null,"ttl":0,"loop_wait":0,"retry_timeout":0,"maximum_lag_on_failover":0,"slots":null},"resources":{"requests":{"cpu":"","memory":""},"limits":{"cpu":"","memory":""}},"teamId":"","allowedSourceRanges":null,"numberOfInstances":0,"users":null,"clone":null},"status":{"PostgresClusterStatus":"Invalid"}}`),
+		marshal: []byte(`{"kind":"Postgresql","apiVersion":"acid.zalan.do/v1","metadata":{"name":"acid-testcluster1","creationTimestamp":null},"spec":{"postgresql":{"version":"","parameters":null},"volume":{"size":"","storageClass":""},"patroni":{"initdb":null,"pg_hba":null,"ttl":0,"loop_wait":0,"retry_timeout":0,"slots":null},"resources":{"requests":{"cpu":"","memory":""},"limits":{"cpu":"","memory":""}},"teamId":"","allowedSourceRanges":null,"numberOfInstances":0,"users":null,"clone":null},"status":{"PostgresClusterStatus":"Invalid"}}`),
 		err:     nil},
 	{
 		about: "example with detailed input manifest and deprecated pod_priority_class_name -> podPriorityClassName",
@@ -297,7 +335,7 @@ var unmarshalCluster = []struct {
 					TTL:                  30,
 					LoopWait:             10,
 					RetryTimeout:         10,
-					MaximumLagOnFailover: 33554432,
+					MaximumLagOnFailover: &maxLagOnFailover,
 					Slots:                map[string]map[string]string{"permanent_logical_1": {"type": "logical", "database": "foo", "plugin": "pgoutput"}},
 				},
 				Resources: Resources{
@@ -351,7 +389,7 @@ var unmarshalCluster = []struct {
 			Status: PostgresStatus{PostgresClusterStatus: ClusterStatusInvalid},
 			Error:  errors.New("name must match {TEAM}-{NAME} format").Error(),
 		},
-		marshal: []byte(`{"kind":"Postgresql","apiVersion":"acid.zalan.do/v1","metadata":{"name":"teapot-testcluster1","creationTimestamp":null},"spec":{"postgresql":{"version":"","parameters":null},"volume":{"size":"","storageClass":""},"patroni":{"initdb":null,"pg_hba":null,"ttl":0,"loop_wait":0,"retry_timeout":0,"maximum_lag_on_failover":0,"slots":null} ,"resources":{"requests":{"cpu":"","memory":""},"limits":{"cpu":"","memory":""}},"teamId":"acid","allowedSourceRanges":null,"numberOfInstances":0,"users":null,"clone":null},"status":{"PostgresClusterStatus":"Invalid"}}`),
+		marshal: []byte(`{"kind":"Postgresql","apiVersion":"acid.zalan.do/v1","metadata":{"name":"teapot-testcluster1","creationTimestamp":null},"spec":{"postgresql":{"version":"","parameters":null},"volume":{"size":"","storageClass":""},"patroni":{"initdb":null,"pg_hba":null,"ttl":0,"loop_wait":0,"retry_timeout":0,"slots":null} ,"resources":{"requests":{"cpu":"","memory":""},"limits":{"cpu":"","memory":""}},"teamId":"acid","allowedSourceRanges":null,"numberOfInstances":0,"users":null,"clone":null},"status":{"PostgresClusterStatus":"Invalid"}}`),
 		err:     nil},
 	{
 		about: "example with clone",
@@ -373,7 +411,7 @@ var unmarshalCluster = []struct {
 			},
 			Error: "",
 		},
-		marshal: []byte(`{"kind":"Postgresql","apiVersion":"acid.zalan.do/v1","metadata":{"name":"acid-testcluster1","creationTimestamp":null},"spec":{"postgresql":{"version":"","parameters":null},"volume":{"size":"","storageClass":""},"patroni":{"initdb":null,"pg_hba":null,"ttl":0,"loop_wait":0,"retry_timeout":0,"maximum_lag_on_failover":0,"slots":null},"resources":{"requests":{"cpu":"","memory":""},"limits":{"cpu":"","memory":""}},"teamId":"acid","allowedSourceRanges":null,"numberOfInstances":0,"users":null,"clone":{"cluster":"team-batman"}},"status":{"PostgresClusterStatus":""}}`),
+		marshal: []byte(`{"kind":"Postgresql","apiVersion":"acid.zalan.do/v1","metadata":{"name":"acid-testcluster1","creationTimestamp":null},"spec":{"postgresql":{"version":"","parameters":null},"volume":{"size":"","storageClass":""},"patroni":{"initdb":null,"pg_hba":null,"ttl":0,"loop_wait":0,"retry_timeout":0,"slots":null},"resources":{"requests":{"cpu":"","memory":""},"limits":{"cpu":"","memory":""}},"teamId":"acid","allowedSourceRanges":null,"numberOfInstances":0,"users":null,"clone":{"cluster":"team-batman"}},"status":{"PostgresClusterStatus":""}}`),
 		err:     nil},
 	{
 		about: "standby example",
@@ -395,7 +433,7 @@ var unmarshalCluster = []struct {
 			},
 			Error: "",
 		},
-		marshal: []byte(`{"kind":"Postgresql","apiVersion":"acid.zalan.do/v1","metadata":{"name":"acid-testcluster1","creationTimestamp":null},"spec":{"postgresql":{"version":"","parameters":null},"volume":{"size":"","storageClass":""},"patroni":{"initdb":null,"pg_hba":null,"ttl":0,"loop_wait":0,"retry_timeout":0,"maximum_lag_on_failover":0,"slots":null},"resources":{"requests":{"cpu":"","memory":""},"limits":{"cpu":"","memory":""}},"teamId":"acid","allowedSourceRanges":null,"numberOfInstances":0,"users":null,"standby":{"s3_wal_path":"s3://custom/path/to/bucket/"}},"status":{"PostgresClusterStatus":""}}`),
+		marshal: []byte(`{"kind":"Postgresql","apiVersion":"acid.zalan.do/v1","metadata":{"name":"acid-testcluster1","creationTimestamp":null},"spec":{"postgresql":{"version":"","parameters":null},"volume":{"size":"","storageClass":""},"patroni":{"initdb":null,"pg_hba":null,"ttl":0,"loop_wait":0,"retry_timeout":0,"slots":null},"resources":{"requests":{"cpu":"","memory":""},"limits":{"cpu":"","memory":""}},"teamId":"acid","allowedSourceRanges":null,"numberOfInstances":0,"users":null,"standby":{"s3_wal_path":"s3://custom/path/to/bucket/"}},"status":{"PostgresClusterStatus":""}}`),
 		err:     nil},
 	{
 		about:   "expect error on malformatted JSON",
@@ -405,7 +443,7 @@ var unmarshalCluster = []struct {
 		err:     errors.New("unexpected end of JSON input")},
 	{
 		about:   "expect error on JSON with field's value malformatted",
-		in:      []byte(`{"kind":"Postgresql","apiVersion":"acid.zalan.do/v1","metadata":{"name":"acid-testcluster","creationTimestamp":qaz},"spec":{"postgresql":{"version":"","parameters":null},"volume":{"size":"","storageClass":""},"patroni":{"initdb":null,"pg_hba":null,"ttl":0,"loop_wait":0,"retry_timeout":0,"maximum_lag_on_failover":0,"slots":null},"resources":{"requests":{"cpu":"","memory":""},"limits":{"cpu":"","memory":""}},"teamId":"acid","allowedSourceRanges":null,"numberOfInstances":0,"users":null,"clone":null},"status":{"PostgresClusterStatus":"Invalid"}}`),
+		in:      []byte(`{"kind":"Postgresql","apiVersion":"acid.zalan.do/v1","metadata":{"name":"acid-testcluster","creationTimestamp":qaz},"spec":{"postgresql":{"version":"","parameters":null},"volume":{"size":"","storageClass":""},"patroni":{"initdb":null,"pg_hba":null,"ttl":0,"loop_wait":0,"retry_timeout":0,"slots":null},"resources":{"requests":{"cpu":"","memory":""},"limits":{"cpu":"","memory":""}},"teamId":"acid","allowedSourceRanges":null,"numberOfInstances":0,"users":null,"clone":null},"status":{"PostgresClusterStatus":"Invalid"}}`),
 		out:     Postgresql{},
 		marshal: []byte{},
 		err:     errors.New("invalid character 'q' looking for beginning of value"),
@@ -658,6 +696,415 @@ func TestCloneClusterDescription(t *testing.T) {
 	}
 }
 
+func TestWALArchiveDescription(t *testing.T) {
+	for _, tt := range walArchiveDescriptions {
+		t.Run(tt.about, func(t *testing.T) {
+			if err := validateWALArchiveDescription(tt.in); err != nil {
+				if tt.err == nil || err.Error() != tt.err.Error() {
+					t.Errorf("validateWALArchiveDescription expected error: %v, got: %v", tt.err, err)
+				}
+			} else if tt.err != nil {
+				t.Errorf("Expected error: %v", tt.err)
+			}
+		})
+	}
+}
+
+func TestTablespaces(t *testing.T) {
+	for _, tt := range tablespaces {
+		t.Run(tt.about, func(t *testing.T) {
+			if err := validateTablespaces(tt.in); err != nil {
+				if tt.err == nil || err.Error() != tt.err.Error() {
+					t.Errorf("validateTablespaces expected error: %v, got: %v", tt.err, err)
+				}
+			} else if tt.err != nil {
+				t.Errorf("Expected error: %v", tt.err)
+			}
+		})
+	}
+}
+
+func TestValidateDNS(t *testing.T) {
+	if err := validateDNS(v1.DNSClusterFirst, nil); err != nil {
+		t.Errorf("validateDNS expected no error for the ClusterFirst policy, got: %v", err)
+	}
+	if err := validateDNS(v1.DNSNone, &v1.PodDNSConfig{Nameservers: []string{"10.0.0.10"}}); err != nil {
+		t.Errorf("validateDNS expected no error for the None policy with a nameserver, got: %v", err)
+	}
+	expected := `dnsConfig with at least one nameserver is required when dnsPolicy is "None"`
+	if err := validateDNS(v1.DNSNone, &v1.PodDNSConfig{Searches: []string{"svc.cluster.local"}}); err == nil || err.Error() != expected {
+		t.Errorf("validateDNS expected error: %v, got: %v", expected, err)
+	}
+}
+
+func TestValidateHostAliases(t *testing.T) {
+	if err := validateHostAliases([]v1.HostAlias{{IP: "10.2.3.4", Hostnames: []string{"legacy-db"}}}); err != nil {
+		t.Errorf("validateHostAliases expected no error, got: %v", err)
+	}
+	expected := `host alias IP "legacy-db" is not a valid IP address`
+	if err := validateHostAliases([]v1.HostAlias{{IP: "legacy-db", Hostnames: []string{"legacy-db"}}}); err == nil || err.Error() != expected {
+		t.Errorf("validateHostAliases expected error: %v, got: %v", expected, err)
+	}
+	expected = `host alias for IP "10.2.3.4" has no hostnames`
+	if err := validateHostAliases([]v1.HostAlias{{IP: "10.2.3.4"}}); err == nil || err.Error() != expected {
+		t.Errorf("validateHostAliases expected error: %v, got: %v", expected, err)
+	}
+}
+
+func TestValidatePodAntiAffinityTopologyKey(t *testing.T) {
+	for _, key := range []string{"", "kubernetes.io/hostname", "topology.kubernetes.io/zone"} {
+		if err := validatePodAntiAffinityTopologyKey(key); err != nil {
+			t.Errorf("validatePodAntiAffinityTopologyKey expected no error for %q, got: %v", key, err)
+		}
+	}
+	for _, key := range []string{"kubernetes.io/", "not a label"} {
+		if err := validatePodAntiAffinityTopologyKey(key); err == nil {
+			t.Errorf("validatePodAntiAffinityTopologyKey expected an error for %q", key)
+		}
+	}
+}
+
+func TestValidateUserConnectionLimits(t *testing.T) {
+	users := map[string]UserFlags{"app_user": {}}
+	if err := validateUserConnectionLimits(users, map[string]int64{"app_user": 10}); err != nil {
+		t.Errorf("validateUserConnectionLimits expected no error, got: %v", err)
+	}
+	if err := validateUserConnectionLimits(users, map[string]int64{"app_user": -1}); err != nil {
+		t.Errorf("validateUserConnectionLimits expected no error for an unlimited user, got: %v", err)
+	}
+	expected := `connection limit -2 of user "app_user" is not valid, use -1 for no limit`
+	if err := validateUserConnectionLimits(users, map[string]int64{"app_user": -2}); err == nil || err.Error() != expected {
+		t.Errorf("validateUserConnectionLimits expected error: %v, got: %v", expected, err)
+	}
+	expected = `connection limit defined for user "other_user" which is not listed in users`
+	if err := validateUserConnectionLimits(users, map[string]int64{"other_user": 5}); err == nil || err.Error() != expected {
+		t.Errorf("validateUserConnectionLimits expected error: %v, got: %v", expected, err)
+	}
+}
+
+func TestValidateConnectionPoolerAutoscaling(t *testing.T) {
+	minReplicas := int32(2)
+	pooler := &ConnectionPooler{Autoscaling: &ConnectionPoolerAutoscaling{MinReplicas: &minReplicas, MaxReplicas: 4}}
+	if err := validateConnectionPoolerAutoscaling(pooler); err != nil {
+		t.Errorf("validateConnectionPoolerAutoscaling expected no error, got: %v", err)
+	}
+	pooler.Autoscaling.MaxReplicas = 1
+	expected := "connection pooler autoscaling minReplicas 2 exceeds maxReplicas 1"
+	if err := validateConnectionPoolerAutoscaling(pooler); err == nil || err.Error() != expected {
+		t.Errorf("validateConnectionPoolerAutoscaling expected error: %v, got: %v", expected, err)
+	}
+}
+
+func TestValidateInitScripts(t *testing.T) {
+	initScripts := []InitScript{
+		{Name: "roles", ConfigMap: "init-sql", Key: "roles.sql"},
+		{Name: "seed", Database: "app", ConfigMap: "init-sql", Key: "seed.sql"},
+	}
+	if err := validateInitScripts(initScripts); err != nil {
+		t.Errorf("validateInitScripts expected no error, got: %v", err)
+	}
+
+	initScripts = append(initScripts, InitScript{Name: "seed", ConfigMap: "init-sql", Key: "more.sql"})
+	expected := `init script name "seed" is not unique`
+	if err := validateInitScripts(initScripts); err == nil || err.Error() != expected {
+		t.Errorf("validateInitScripts expected error: %v, got: %v", expected, err)
+	}
+
+	if err := validateInitScripts([]InitScript{{Name: "roles", ConfigMap: "init-sql"}}); err == nil {
+		t.Errorf("validateInitScripts expected an error for a missing key")
+	}
+}
+
+func TestValidateVolumeSnapshots(t *testing.T) {
+	for _, snapshots := range []*VolumeSnapshots{nil, {Interval: "24h"}, {Interval: "6h", Retention: 14}} {
+		if err := validateVolumeSnapshots(snapshots); err != nil {
+			t.Errorf("validateVolumeSnapshots expected no error for %#v, got: %v", snapshots, err)
+		}
+	}
+	for _, snapshots := range []*VolumeSnapshots{{}, {Interval: "daily"}, {Interval: "30m"}, {Interval: "24h", Retention: -1}} {
+		if err := validateVolumeSnapshots(snapshots); err == nil {
+			t.Errorf("validateVolumeSnapshots expected an error for %#v", snapshots)
+		}
+	}
+}
+
+func TestValidateTerminationGracePeriodSeconds(t *testing.T) {
+	minimum, long, short := int64(30), int64(600), int64(5)
+	for _, gracePeriod := range []*int64{nil, &minimum, &long} {
+		if err := validateTerminationGracePeriodSeconds(gracePeriod); err != nil {
+			t.Errorf("validateTerminationGracePeriodSeconds expected no error, got: %v", err)
+		}
+	}
+	expected := "terminationGracePeriodSeconds must be at least 30, got 5"
+	if err := validateTerminationGracePeriodSeconds(&short); err == nil || err.Error() != expected {
+		t.Errorf("validateTerminationGracePeriodSeconds expected error: %v, got: %v", expected, err)
+	}
+}
+
+func TestValidateRetainedVolumeClaims(t *testing.T) {
+	none, negative := int32(0), int32(-1)
+	for _, retained := range []*int32{nil, &none} {
+		if err := validateRetainedVolumeClaims(retained); err != nil {
+			t.Errorf("validateRetainedVolumeClaims expected no error, got: %v", err)
+		}
+	}
+	expected := "retainedVolumeClaims must not be negative, got -1"
+	if err := validateRetainedVolumeClaims(&negative); err == nil || err.Error() != expected {
+		t.Errorf("validateRetainedVolumeClaims expected error: %v, got: %v", expected, err)
+	}
+}
+
+func TestValidateVolumeMetadata(t *testing.T) {
+	volume := Volume{
+		Labels:      map[string]string{"team": "acid", "example.com/tier": ""},
+		Annotations: map[string]string{"example.com/backup": "daily, weekly"},
+	}
+	if err := validateVolumeMetadata(volume); err != nil {
+		t.Errorf("validateVolumeMetadata expected no error, got: %v", err)
+	}
+	volume.Labels["tier"] = "gold plated"
+	if err := validateVolumeMetadata(volume); err == nil || !strings.Contains(err.Error(), `volume label "tier" has an invalid value`) {
+		t.Errorf("validateVolumeMetadata expected an error for an invalid label value, got: %v", err)
+	}
+	delete(volume.Labels, "tier")
+	volume.Annotations["backup schedule"] = "daily"
+	if err := validateVolumeMetadata(volume); err == nil || !strings.Contains(err.Error(), `volume annotation "backup schedule" is not a valid annotation key`) {
+		t.Errorf("validateVolumeMetadata expected an error for an invalid annotation key, got: %v", err)
+	}
+}
+
+func TestValidateEnv(t *testing.T) {
+	env := []v1.EnvVar{
+		{Name: "AWS_REGION", Value: "eu-central-1"},
+		{Name: "AWS_SECRET_ACCESS_KEY", ValueFrom: &v1.EnvVarSource{
+			SecretKeyRef: &v1.SecretKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: "aws"}, Key: "secret"}}},
+		{Name: "BACKUP_SCHEDULE", ValueFrom: &v1.EnvVarSource{
+			ConfigMapKeyRef: &v1.ConfigMapKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: "backup"}, Key: "schedule"}}},
+	}
+	if err := validateEnv(env); err != nil {
+		t.Errorf("validateEnv expected no error, got: %v", err)
+	}
+
+	env = append(env, v1.EnvVar{Name: "NODE_NAME", ValueFrom: &v1.EnvVarSource{FieldRef: &v1.ObjectFieldSelector{FieldPath: "spec.nodeName"}}})
+	expected := `environment variable "NODE_NAME" can only reference secrets and config maps`
+	if err := validateEnv(env); err == nil || err.Error() != expected {
+		t.Errorf("validateEnv expected error: %v, got: %v", expected, err)
+	}
+
+	if err := validateEnv([]v1.EnvVar{{Name: "EMPTY", ValueFrom: &v1.EnvVarSource{}}}); err == nil {
+		t.Errorf("validateEnv expected an error for a valueFrom without a reference")
+	}
+}
+
+func TestValidateUserValidUntil(t *testing.T) {
+	users := map[string]UserFlags{"contractor": {"login"}}
+	if err := validateUserValidUntil(users, map[string]string{"contractor": "2021-06-30T18:00:00Z"}); err != nil {
+		t.Errorf("validateUserValidUntil expected no error, got: %v", err)
+	}
+	if err := validateUserValidUntil(users, map[string]string{"contractor": "infinity"}); err != nil {
+		t.Errorf("validateUserValidUntil expected no error for a role that never expires, got: %v", err)
+	}
+	expected := `expiry "next week" of user "contractor" is neither an RFC 3339 timestamp nor "infinity"`
+	if err := validateUserValidUntil(users, map[string]string{"contractor": "next week"}); err == nil || err.Error() != expected {
+		t.Errorf("validateUserValidUntil expected error: %v, got: %v", expected, err)
+	}
+	expected = `expiry defined for user "other_user" which is not listed in users`
+	if err := validateUserValidUntil(users, map[string]string{"other_user": "infinity"}); err == nil || err.Error() != expected {
+		t.Errorf("validateUserValidUntil expected error: %v, got: %v", expected, err)
+	}
+}
+
+func TestValidateUserParameters(t *testing.T) {
+	users := map[string]UserFlags{"app_user": {"login"}}
+	if err := validateUserParameters(users, map[string]map[string]string{"app_user": {"search_path": "app, public", "auto_explain.log_min_duration": "1s"}}); err != nil {
+		t.Errorf("validateUserParameters expected no error, got: %v", err)
+	}
+	if err := validateUserParameters(users, map[string]map[string]string{"app_user": {}}); err != nil {
+		t.Errorf("validateUserParameters expected no error for reset parameters, got: %v", err)
+	}
+	expected := `parameter "search_path; DROP" of user "app_user" is not a valid parameter name`
+	if err := validateUserParameters(users, map[string]map[string]string{"app_user": {"search_path; DROP": "app"}}); err == nil || err.Error() != expected {
+		t.Errorf("validateUserParameters expected error: %v, got: %v", expected, err)
+	}
+	expected = `parameter "search_path" of user "app_user" has an empty value`
+	if err := validateUserParameters(users, map[string]map[string]string{"app_user": {"search_path": " "}}); err == nil || err.Error() != expected {
+		t.Errorf("validateUserParameters expected error: %v, got: %v", expected, err)
+	}
+	expected = `parameters defined for user "other_user" which is not listed in users`
+	if err := validateUserParameters(users, map[string]map[string]string{"other_user": {"search_path": "app"}}); err == nil || err.Error() != expected {
+		t.Errorf("validateUserParameters expected error: %v, got: %v", expected, err)
+	}
+}
+
+func TestValidateProbe(t *testing.T) {
+	if err := validateProbe("readinessProbe", nil); err != nil {
+		t.Errorf("validateProbe expected no error without a probe, got: %v", err)
+	}
+	if err := validateProbe("readinessProbe", &Probe{InitialDelaySeconds: 300, TimeoutSeconds: 5, PeriodSeconds: 10}); err != nil {
+		t.Errorf("validateProbe expected no error, got: %v", err)
+	}
+	expected := "livenessProbe initialDelaySeconds must be between 0 and 3600"
+	if err := validateProbe("livenessProbe", &Probe{InitialDelaySeconds: 7200}); err == nil || err.Error() != expected {
+		t.Errorf("validateProbe expected error: %v, got: %v", expected, err)
+	}
+	expected = "readinessProbe timeoutSeconds 20 exceeds periodSeconds 10"
+	if err := validateProbe("readinessProbe", &Probe{TimeoutSeconds: 20, PeriodSeconds: 10}); err == nil || err.Error() != expected {
+		t.Errorf("validateProbe expected error: %v, got: %v", expected, err)
+	}
+}
+
+func TestValidateMetricsExporter(t *testing.T) {
+	if err := validateMetricsExporter(nil); err != nil {
+		t.Errorf("validateMetricsExporter expected no error without an exporter, got: %v", err)
+	}
+	if err := validateMetricsExporter(&MetricsExporter{Sidecar: "exporter", Port: 9187, Path: "/metrics", ReadinessProbe: &Probe{PeriodSeconds: 10}}); err != nil {
+		t.Errorf("validateMetricsExporter expected no error, got: %v", err)
+	}
+	expected := "metricsExporter port 8008 is already used by the Postgres container"
+	if err := validateMetricsExporter(&MetricsExporter{Sidecar: "exporter", Port: 8008}); err == nil || err.Error() != expected {
+		t.Errorf("validateMetricsExporter expected error: %v, got: %v", expected, err)
+	}
+	expected = `metricsExporter path "metrics" must start with a slash`
+	if err := validateMetricsExporter(&MetricsExporter{Sidecar: "exporter", Port: 9187, Path: "metrics"}); err == nil || err.Error() != expected {
+		t.Errorf("validateMetricsExporter expected error: %v, got: %v", expected, err)
+	}
+	expected = "metricsExporter livenessProbe timeoutSeconds 20 exceeds periodSeconds 10"
+	if err := validateMetricsExporter(&MetricsExporter{Sidecar: "exporter", Port: 9187, LivenessProbe: &Probe{TimeoutSeconds: 20, PeriodSeconds: 10}}); err == nil || err.Error() != expected {
+		t.Errorf("validateMetricsExporter expected error: %v, got: %v", expected, err)
+	}
+}
+
+func TestValidatePasswordEncryption(t *testing.T) {
+	if err := validatePasswordEncryption("scram-sha-256", map[string]string{"password_encryption": "scram-sha-256"}); err != nil {
+		t.Errorf("validatePasswordEncryption expected no error, got: %v", err)
+	}
+	expected := `passwordEncryption "scram-sha-256" contradicts the password_encryption parameter "md5"`
+	if err := validatePasswordEncryption("scram-sha-256", map[string]string{"password_encryption": "md5"}); err == nil || err.Error() != expected {
+		t.Errorf("validatePasswordEncryption expected error: %v, got: %v", expected, err)
+	}
+	if err := validatePasswordEncryption("sha1", nil); err == nil {
+		t.Errorf("validatePasswordEncryption expected an error for an unknown method")
+	}
+}
+
+func TestValidateCascadingReplicas(t *testing.T) {
+	replicas := []CascadingReplica{{Pod: "acid-test-2", ReplicateFrom: "acid-test-1"}, {Pod: "acid-test-3", ReplicateFrom: "acid-test-2"}}
+	if err := validateCascadingReplicas("acid-test", 4, replicas); err != nil {
+		t.Errorf("validateCascadingReplicas expected no error, got: %v", err)
+	}
+	expected := `cascading replica "acid-test-3" is not an instance of the cluster`
+	if err := validateCascadingReplicas("acid-test", 3, replicas); err == nil || err.Error() != expected {
+		t.Errorf("validateCascadingReplicas expected error: %v, got: %v", expected, err)
+	}
+	expected = `cascading replica "acid-test-1" replicates from "acid-other-0", which is not an instance of the cluster`
+	if err := validateCascadingReplicas("acid-test", 2, []CascadingReplica{{Pod: "acid-test-1", ReplicateFrom: "acid-other-0"}}); err == nil || err.Error() != expected {
+		t.Errorf("validateCascadingReplicas expected error: %v, got: %v", expected, err)
+	}
+	expected = `cascading replica "acid-test-1" replicates from itself through "acid-test-2"`
+	replicas = []CascadingReplica{{Pod: "acid-test-1", ReplicateFrom: "acid-test-2"}, {Pod: "acid-test-2", ReplicateFrom: "acid-test-1"}}
+	if err := validateCascadingReplicas("acid-test", 3, replicas); err == nil || err.Error() != expected {
+		t.Errorf("validateCascadingReplicas expected error: %v, got: %v", expected, err)
+	}
+}
+
+func TestValidateReplicaServices(t *testing.T) {
+	services := []ReplicaService{{Name: "sync", Members: "sync"}, {Name: "async", Members: "async"}}
+	if err := validateReplicaServices("acid-test", services); err != nil {
+		t.Errorf("validateReplicaServices expected no error, got: %v", err)
+	}
+
+	invalid := map[string][]ReplicaService{
+		`replica service "acid-test-repl-sync" is defined more than once`:                    {{Name: "sync", Members: "sync"}, {Name: "sync", Members: "async"}},
+		`members "all" of replica service "acid-test-repl-all" must be either sync or async`: {{Name: "all", Members: "all"}},
+		`replica service "acid-test-repl-Sync" is not a valid service name`:                  {{Name: "Sync", Members: "sync"}},
+	}
+	for expected, services := range invalid {
+		if err := validateReplicaServices("acid-test", services); err == nil || !strings.HasPrefix(err.Error(), expected) {
+			t.Errorf("validateReplicaServices expected error: %v, got: %v", expected, err)
+		}
+	}
+}
+
+func TestValidatePgIdent(t *testing.T) {
+	valid := []string{
+		"# kerberos principals",
+		"krb   /^(.*)@EXAMPLE\\.COM$   \\1",
+		`cert  "CN=app user"  app_user # client certificates`,
+		"",
+	}
+	if err := validatePgIdent(valid); err != nil {
+		t.Errorf("validatePgIdent expected no error, got: %v", err)
+	}
+
+	invalid := map[string]string{
+		"krb foo":                    `pg_ident line "krb foo" must consist of a map name, a system user name and a database user name`,
+		"krb foo bar baz":            `pg_ident line "krb foo bar baz" must consist of a map name, a system user name and a database user name`,
+		`cert "CN=app user app_user`: `invalid pg_ident line "cert \"CN=app user app_user": unterminated quote`,
+		"krb foo bar\nkrb bar foo":   `pg_ident line "krb foo bar\nkrb bar foo" must not span multiple lines`,
+	}
+	for line, expected := range invalid {
+		if err := validatePgIdent([]string{line}); err == nil || err.Error() != expected {
+			t.Errorf("validatePgIdent expected error: %v, got: %v", expected, err)
+		}
+	}
+}
+
+func TestValidateMaximumLagOnFailover(t *testing.T) {
+	if err := validateMaximumLagOnFailover(nil); err != nil {
+		t.Errorf("validateMaximumLagOnFailover expected no error without a value, got: %v", err)
+	}
+	for _, maxLag := range []int64{0, 1048576, 33554432} {
+		if err := validateMaximumLagOnFailover(&maxLag); err != nil {
+			t.Errorf("validateMaximumLagOnFailover expected no error for %v, got: %v", maxLag, err)
+		}
+	}
+	maxLag := int64(-1)
+	if err := validateMaximumLagOnFailover(&maxLag); err == nil {
+		t.Errorf("validateMaximumLagOnFailover expected an error for %v", maxLag)
+	}
+}
+
+func TestValidateSlots(t *testing.T) {
+	valid := map[string]map[string]string{
+		"cdc_orders": {"type": "logical", "database": "foo", "plugin": "pgoutput"},
+		"standby":    {"type": "physical"},
+		"archiver":   {},
+	}
+	if err := validateSlots(valid); err != nil {
+		t.Errorf("validateSlots expected no error, got: %v", err)
+	}
+
+	invalid := []struct {
+		name       string
+		attributes map[string]string
+		expected   string
+	}{
+		{"CDC", map[string]string{"type": "physical"},
+			`replication slot name "CDC" must consist of at most 63 lower case letters, digits and underscores`},
+		{"cdc", map[string]string{"type": "logical", "database": "foo"},
+			`logical replication slot "cdc" needs a database and a plugin`},
+		{"cdc", map[string]string{"type": "decoding"},
+			`type "decoding" of replication slot "cdc" must be either logical or physical`},
+	}
+	for _, tt := range invalid {
+		err := validateSlots(map[string]map[string]string{tt.name: tt.attributes})
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("validateSlots expected error: %v, got: %v", tt.expected, err)
+		}
+	}
+}
+
+func TestValidateMaintenanceWindowsTimezone(t *testing.T) {
+	for _, timezone := range []string{"", "UTC", "Europe/Berlin"} {
+		if err := validateMaintenanceWindowsTimezone(timezone); err != nil {
+			t.Errorf("validateMaintenanceWindowsTimezone expected no error for %q, got: %v", timezone, err)
+		}
+	}
+	if err := validateMaintenanceWindowsTimezone("Europe/Nowhere"); err == nil {
+		t.Errorf("validateMaintenanceWindowsTimezone expected an error for an unknown time zone")
+	}
+}
+
 func TestUnmarshalMaintenanceWindow(t *testing.T) {
 	for _, tt := range maintenanceWindows {
 		t.Run(tt.about, func(t *testing.T) {
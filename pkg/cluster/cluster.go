@@ -42,6 +42,7 @@ var (
 	alphaNumericRegexp    = regexp.MustCompile("^[a-zA-Z][a-zA-Z0-9]*$")
 	databaseNameRegexp    = regexp.MustCompile("^[a-zA-Z_][a-zA-Z0-9_]*$")
 	userRegexp            = regexp.MustCompile(`^[a-z0-9]([-_a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-_a-z0-9]*[a-z0-9])?)*$`)
+	libraryNameRegexp     = regexp.MustCompile(`^[a-zA-Z0-9_$][-a-zA-Z0-9_$./]*$`)
 	patroniObjectSuffixes = []string{"config", "failover", "sync"}
 )
 
@@ -53,6 +54,7 @@ type Config struct {
 	InfrastructureRoles          map[string]spec.PgUser // inherited from the controller
 	PodServiceAccount            *v1.ServiceAccount
 	PodServiceAccountRoleBinding *rbacv1.RoleBinding
+	SyncHooks                    SyncHooks // optional, invoked at the phases of a sync
 }
 
 type kubeResources struct {
@@ -78,7 +80,7 @@ type Cluster struct {
 	podSubscribers   map[spec.NamespacedName]chan PodEvent
 	podSubscribersMu sync.RWMutex
 	pgDb             *sql.DB
-	mu               sync.Mutex
+	mu               clusterMutex
 	userSyncStrategy spec.UserSyncer
 	deleteOptions    metav1.DeleteOptions
 	podEventsQueue   *cache.FIFO
@@ -92,12 +94,123 @@ type Cluster struct {
 	ConnectionPooler map[PostgresRole]*ConnectionPoolerObjects
 	EBSVolumes       map[string]volumes.VolumeProperties
 	VolumeResizer    volumes.VolumeResizer
+	tlsSecretHash    string // contents of the TLS secrets Postgres was last (re)loaded with
+
+	// serializes the updates following the roles of the pods, i.e. of the replica endpoint and the sync standby
+	// labels, pod events request them without the master mutex
+	podRolesMu      sync.Mutex
+	podRolesRefresh chan struct{}
+
+	// contents of the Patroni API TLS secret the client was configured with and the CA it trusts
+	patroniAPITLSHash string
+	patroniAPICA      []byte
+
+	// roles and databases were not synced while the database was inaccessible
+	databaseObjectsPending bool
+	// the members disagreed on the leader at the last sync, destructive operations are held back
+	leaderDiverged bool
+	// the standby section was removed from the manifest, the cluster is promoted by the next sync
+	standbyPromotionPending bool
+	// preloaded libraries removed from the manifest, they are kept until Postgres no longer loads them
+	removedLibraries map[string]bool
+	// a restart of Postgres changing the preloaded libraries is scheduled until then, while Postgres still loads
+	// other libraries than the manifest asks for afterwards another one is scheduled
+	librariesRestartAt time.Time
+	// end of the last successful full sync and whether it found objects deviating from the manifest, syncs of an
+	// unchanged manifest are skipped until the full_resync_period has passed unless it did
+	lastFullSync time.Time
+	syncDrift    bool
+
+	// runs a command in the Postgres container of a pod, replaced in tests
+	execCommand          func(podName *spec.NamespacedName, command ...string) (string, error)
+	execCommandWithInput func(podName *spec.NamespacedName, input string, command ...string) (string, error)
+	// opens the connection pool to Postgres, replaced in tests
+	openDb func(connstring string) (*sql.DB, error)
+}
+
+// clusterMutex is the master mutex of the cluster. Unlike sync.Mutex waiting for it can time out and the operation
+// holding it is known, so a hanging operation is reported instead of silently blocking the others. The zero value
+// is an unlocked mutex.
+type clusterMutex struct {
+	once   sync.Once
+	ch     chan struct{}
+	mu     sync.Mutex // protects the holder
+	holder string
+	since  time.Time
+}
+
+const (
+	// how often an operation waiting for the lock of the cluster reports the one holding it
+	clusterLockWaitWarningInterval = time.Minute
+	// an operation holding the lock of the cluster longer than that is reported when it releases the lock
+	clusterLockHeldWarningThreshold = 10 * time.Minute
+)
+
+// lock waits for the mutex until it is released
+func (m *clusterMutex) lock(operation string, logger *logrus.Entry) {
+	m.lockWithTimeout(operation, 0, logger)
+}
+
+// lockWithTimeout waits for the mutex, giving up after the timeout unless it is zero. Meanwhile, it periodically
+// logs the operation holding the mutex.
+func (m *clusterMutex) lockWithTimeout(operation string, timeout time.Duration, logger *logrus.Entry) error {
+	m.once.Do(func() { m.ch = make(chan struct{}, 1) })
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	ticker := time.NewTicker(clusterLockWaitWarningInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case m.ch <- struct{}{}:
+			m.mu.Lock()
+			m.holder, m.since = operation, time.Now()
+			m.mu.Unlock()
+			return nil
+		case <-ticker.C:
+			holder, held := m.heldBy()
+			logger.Warningf("%s is waiting for the lock of the cluster held by %s for %v", operation, holder,
+				held.Round(time.Second))
+		case <-expired:
+			holder, held := m.heldBy()
+			return fmt.Errorf("could not lock the cluster within %v, it is held by %s for %v", timeout, holder,
+				held.Round(time.Second))
+		}
+	}
+}
+
+// unlock releases the mutex and reports an operation that held it unusually long
+func (m *clusterMutex) unlock(logger *logrus.Entry) {
+	holder, held := m.heldBy()
+	if held > clusterLockHeldWarningThreshold {
+		logger.Warningf("%s held the lock of the cluster for %v", holder, held.Round(time.Second))
+	}
+	m.mu.Lock()
+	m.holder, m.since = "", time.Time{}
+	m.mu.Unlock()
+	<-m.ch
+}
+
+// heldBy returns the operation holding the mutex and for how long
+func (m *clusterMutex) heldBy() (string, time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.holder == "" {
+		return "", 0
+	}
+	return m.holder, time.Since(m.since)
 }
 
 type compareStatefulsetResult struct {
 	match         bool
 	replace       bool
 	rollingUpdate bool
+	scaleOnly     bool
 	reasons       []string
 }
 
@@ -113,11 +226,6 @@ func New(cfg Config, kubeClient k8sutil.KubernetesClient, pgSpec acidv1.Postgres
 
 		return fmt.Sprintf("%s-%s", e.PodName, e.ResourceVersion), nil
 	})
-	passwordEncryption, ok := pgSpec.Spec.PostgresqlParam.Parameters["password_encryption"]
-	if !ok {
-		passwordEncryption = "md5"
-	}
-
 	cluster := &Cluster{
 		Config:         cfg,
 		Postgresql:     pgSpec,
@@ -128,15 +236,20 @@ func New(cfg Config, kubeClient k8sutil.KubernetesClient, pgSpec acidv1.Postgres
 			Secrets:   make(map[types.UID]*v1.Secret),
 			Services:  make(map[PostgresRole]*v1.Service),
 			Endpoints: make(map[PostgresRole]*v1.Endpoints)},
-		userSyncStrategy: users.DefaultUserSyncStrategy{PasswordEncryption: passwordEncryption},
+		userSyncStrategy: users.DefaultUserSyncStrategy{},
 		deleteOptions:    metav1.DeleteOptions{PropagationPolicy: &deletePropagationPolicy},
 		podEventsQueue:   podEventsQueue,
 		KubeClient:       kubeClient,
+
+		podRolesRefresh: make(chan struct{}, 1),
 	}
 	cluster.logger = logger.WithField("pkg", "cluster").WithField("cluster-name", cluster.clusterName())
 	cluster.teamsAPIClient = teams.NewTeamsAPI(cfg.OpConfig.TeamsAPIUrl, logger)
 	cluster.oauthTokenGetter = newSecretOauthTokenGetter(&kubeClient, cfg.OpConfig.OAuthTokenSecretName)
 	cluster.patroni = patroni.New(cluster.logger)
+	cluster.execCommand = cluster.ExecCommand
+	cluster.execCommandWithInput = cluster.ExecCommandWithInput
+	cluster.openDb = func(connstring string) (*sql.DB, error) { return sql.Open("postgres", connstring) }
 	cluster.eventRecorder = eventRecorder
 
 	cluster.EBSVolumes = make(map[string]volumes.VolumeProperties)
@@ -156,6 +269,14 @@ func (c *Cluster) clusterNamespace() string {
 	return c.ObjectMeta.Namespace
 }
 
+// syncHooks returns the hooks of the operator configuration, every phase is allowed without them
+func (c *Cluster) syncHooks() SyncHooks {
+	if c.Config.SyncHooks == nil {
+		return NoopSyncHooks{}
+	}
+	return c.Config.SyncHooks
+}
+
 func (c *Cluster) teamName() string {
 	// TODO: check Teams API for the actual name (in case the user passes an integer Id).
 	return c.Spec.TeamID
@@ -207,6 +328,9 @@ func (c *Cluster) initUsers() error {
 		return fmt.Errorf("could not init robot users: %v", err)
 	}
 
+	c.initMonitoringUser()
+	c.initBackupUser()
+
 	if err := c.initHumanUsers(); err != nil {
 		return fmt.Errorf("could not init human users: %v", err)
 	}
@@ -216,8 +340,8 @@ func (c *Cluster) initUsers() error {
 
 // Create creates the new kubernetes objects associated with the cluster.
 func (c *Cluster) Create() error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	c.mu.lock("create", c.logger)
+	defer c.mu.unlock(c.logger)
 	var (
 		err error
 
@@ -237,11 +361,20 @@ func (c *Cluster) Create() error {
 	c.KubeClient.SetPostgresCRDStatus(c.clusterName(), acidv1.ClusterStatusCreating)
 	c.eventRecorder.Event(c.GetReference(), v1.EventTypeNormal, "Create", "Started creation of new cluster resources")
 
+	// without the pending condition the init scripts are still run below, but not retried on sync
+	if err = c.markInitScriptsPending(); err != nil {
+		c.logger.Warningf("could not mark init scripts as pending: %v", err)
+	}
+
 	if err = c.enforceMinResourceLimits(&c.Spec); err != nil {
 		return fmt.Errorf("could not enforce minimum resource limits: %v", err)
 	}
 
 	for _, role := range []PostgresRole{Master, Replica} {
+		if role == Replica && !replicaServiceEnabled(&c.Spec) {
+			c.logger.Infof("replica service is disabled, skipping replica service and endpoint")
+			continue
+		}
 
 		if c.Endpoints[role] != nil {
 			return fmt.Errorf("%s endpoint already exists in the cluster", role)
@@ -249,7 +382,7 @@ func (c *Cluster) Create() error {
 		if role == Master {
 			// replica endpoint will be created by the replica service. Master endpoint needs to be created by us,
 			// since the corresponding master service does not define any selectors.
-			ep, err = c.createEndpoint(role)
+			ep, err = c.createEndpoint(context.TODO(), role)
 			if err != nil {
 				return fmt.Errorf("could not create %s endpoint: %v", role, err)
 			}
@@ -260,7 +393,7 @@ func (c *Cluster) Create() error {
 		if c.Services[role] != nil {
 			return fmt.Errorf("service already exists in the cluster")
 		}
-		service, err = c.createService(role)
+		service, err = c.createService(context.TODO(), role)
 		if err != nil {
 			return fmt.Errorf("could not create %s service: %v", role, err)
 		}
@@ -273,7 +406,7 @@ func (c *Cluster) Create() error {
 	}
 	c.logger.Infof("users have been initialized")
 
-	if err = c.syncSecrets(); err != nil {
+	if err = c.syncSecrets(context.TODO()); err != nil {
 		return fmt.Errorf("could not create secrets: %v", err)
 	}
 	c.logger.Infof("secrets have been successfully created")
@@ -282,25 +415,46 @@ func (c *Cluster) Create() error {
 	if c.PodDisruptionBudget != nil {
 		return fmt.Errorf("pod disruption budget already exists in the cluster")
 	}
-	pdb, err := c.createPodDisruptionBudget()
+	pdb, err := c.createPodDisruptionBudget(context.TODO())
 	if err != nil {
 		return fmt.Errorf("could not create pod disruption budget: %v", err)
 	}
 	c.logger.Infof("pod disruption budget %q has been successfully created", util.NameFromMeta(pdb.ObjectMeta))
 
+	if err = c.syncServiceAccount(context.TODO()); err != nil {
+		return fmt.Errorf("could not create pod service account: %v", err)
+	}
+
+	if err = c.syncPatroniRole(context.TODO()); err != nil {
+		return fmt.Errorf("could not create Patroni role: %v", err)
+	}
+
+	if err = c.syncPatroniAPITLS(context.TODO()); err != nil {
+		c.logger.Warningf("could not configure the Patroni API certificate: %v", err)
+	}
+
 	if c.Statefulset != nil {
 		return fmt.Errorf("statefulset already exists in the cluster")
 	}
-	ss, err = c.createStatefulSet()
+	ss, err = c.createStatefulSet(context.TODO())
 	if err != nil {
 		return fmt.Errorf("could not create statefulset: %v", err)
 	}
 	c.logger.Infof("statefulset %q has been successfully created", util.NameFromMeta(ss.ObjectMeta))
 	c.eventRecorder.Eventf(c.GetReference(), v1.EventTypeNormal, "StatefulSet", "Statefulset %q has been successfully created", util.NameFromMeta(ss.ObjectMeta))
 
+	// the pods start with the current TLS certificate, a renewal from now on is reloaded by the sync
+	if c.Spec.TLS != nil && c.Spec.TLS.SecretName != "" {
+		if secrets, err := c.getTLSSecrets(context.TODO()); err != nil {
+			c.logger.Warningf("could not record the TLS certificate: %v", err)
+		} else {
+			c.tlsSecretHash = tlsSecretsHash(secrets)
+		}
+	}
+
 	c.logger.Info("waiting for the cluster being ready")
 
-	if err = c.waitStatefulsetPodsReady(); err != nil {
+	if err = c.waitStatefulsetPodsReady(context.TODO()); err != nil {
 		c.logger.Errorf("failed to create cluster: %v", err)
 		return err
 	}
@@ -309,29 +463,72 @@ func (c *Cluster) Create() error {
 
 	// create database objects unless we are running without pods or disabled
 	// that feature explicitly
-	if !(c.databaseAccessDisabled() || c.getNumberOfInstances(&c.Spec) <= 0 || c.Spec.StandbyCluster != nil) {
+	if c.databaseObjectsAccessible(&c.Spec) {
 		c.logger.Infof("Create roles")
 		if err = c.createRoles(); err != nil {
 			return fmt.Errorf("could not create users: %v", err)
 		}
 		c.logger.Infof("users have been successfully created")
 
-		if err = c.syncDatabases(); err != nil {
+		if err = c.syncDatabases(context.TODO()); err != nil {
 			return fmt.Errorf("could not sync databases: %v", err)
 		}
-		if err = c.syncPreparedDatabases(); err != nil {
+		if err = c.syncPreparedDatabases(context.TODO()); err != nil {
 			return fmt.Errorf("could not sync prepared databases: %v", err)
 		}
 		c.logger.Infof("databases have been successfully created")
+
+		if err = c.syncMonitoringExtension(context.TODO()); err != nil {
+			return fmt.Errorf("could not install monitoring extension: %v", err)
+		}
+		if err = c.syncAuditExtension(context.TODO()); err != nil {
+			return fmt.Errorf("could not install audit extension: %v", err)
+		}
+		if err = c.syncBackupGrants(context.TODO()); err != nil {
+			return fmt.Errorf("could not grant backup role privileges: %v", err)
+		}
+
+		if len(c.Spec.InitScripts) > 0 {
+			if err = c.runInitScripts(context.TODO()); err != nil {
+				return fmt.Errorf("could not run init scripts: %v", err)
+			}
+			c.logger.Infof("init scripts have been successfully run")
+		}
+	} else {
+		c.databaseObjectsPending = true
 	}
 
 	if c.Postgresql.Spec.EnableLogicalBackup {
-		if err := c.createLogicalBackupJob(); err != nil {
+		if err := c.createLogicalBackupJob(context.TODO()); err != nil {
 			return fmt.Errorf("could not create a k8s cron job for logical backups: %v", err)
 		}
 		c.logger.Info("a k8s cron job for logical backup has been successfully created")
 	}
 
+	if podMonitorEnabled(&c.Spec) {
+		if err := c.syncPodMonitor(context.TODO()); err != nil {
+			c.logger.Warningf("could not create pod monitor: %v", err)
+		}
+	}
+
+	if c.Spec.MasterTCPRoute != nil {
+		if err := c.syncMasterTCPRoute(context.TODO()); err != nil {
+			c.logger.Warningf("could not create master TCP route: %v", err)
+		}
+	}
+
+	if c.Spec.EnablePodServices {
+		if err := c.syncPodServices(context.TODO()); err != nil {
+			c.logger.Warningf("could not create pod services: %v", err)
+		}
+	}
+
+	if len(c.Spec.ReplicaServices) > 0 {
+		if err := c.syncReplicaServices(context.TODO()); err != nil {
+			c.logger.Warningf("could not create replica services: %v", err)
+		}
+	}
+
 	if err := c.listResources(); err != nil {
 		c.logger.Errorf("could not list resources: %v", err)
 	}
@@ -347,17 +544,65 @@ func (c *Cluster) Create() error {
 	return nil
 }
 
+// withStorageClassOf returns a copy of the desired volume claim template using the storage class of the current one
+func withStorageClassOf(current, desired v1.PersistentVolumeClaim) v1.PersistentVolumeClaim {
+	result := *desired.DeepCopy()
+	result.Spec.StorageClassName = current.Spec.StorageClassName
+
+	delete(result.Annotations, storageClassAnnotation)
+	if class, ok := current.Annotations[storageClassAnnotation]; ok {
+		if result.Annotations == nil {
+			result.Annotations = make(map[string]string)
+		}
+		result.Annotations[storageClassAnnotation] = class
+	}
+	if len(result.Annotations) == 0 && current.Annotations == nil {
+		result.Annotations = nil
+	}
+	return result
+}
+
+// compareAnnotations checks if the annotations are the same, skipping the keys
+// listed in the ignored_annotations option, e.g. ones added by a service mesh
+func (c *Cluster) compareAnnotations(old, new map[string]string) bool {
+	ignored := make(map[string]bool, len(c.OpConfig.IgnoredAnnotations)+1)
+	for _, key := range c.OpConfig.IgnoredAnnotations {
+		ignored[key] = true
+	}
+	// recorded by the operator after every change
+	ignored[constants.LastAppliedAnnotationKey] = true
+
+	for key, value := range old {
+		if ignored[key] {
+			continue
+		}
+		if newValue, ok := new[key]; !ok || newValue != value {
+			return false
+		}
+	}
+	for key := range new {
+		if ignored[key] {
+			continue
+		}
+		if _, ok := old[key]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
 func (c *Cluster) compareStatefulSetWith(statefulSet *appsv1.StatefulSet) *compareStatefulsetResult {
 	reasons := make([]string, 0)
-	var match, needsRollUpdate, needsReplace bool
+	var match, needsRollUpdate, needsReplace, replicasChanged bool
 
 	match = true
-	//TODO: improve me
+	// scaling only adds or removes pods, the existing ones keep running
 	if *c.Statefulset.Spec.Replicas != *statefulSet.Spec.Replicas {
-		match = false
+		replicasChanged = true
 		reasons = append(reasons, "new statefulset's number of replicas does not match the current one")
 	}
-	if !reflect.DeepEqual(c.Statefulset.Annotations, statefulSet.Annotations) {
+	if !c.compareAnnotations(c.Statefulset.Annotations, statefulSet.Annotations) {
 		match = false
 		reasons = append(reasons, "new statefulset's annotations does not match the current one")
 	}
@@ -369,12 +614,49 @@ func (c *Cluster) compareStatefulSetWith(statefulSet *appsv1.StatefulSet) *compa
 		c.logger.Warningf("statefulset %q has no container", util.NameFromMeta(c.Statefulset.ObjectMeta))
 		return &compareStatefulsetResult{}
 	}
+	// only the probes of the Postgres container are generated with all fields set, those of sidecars get defaulted
+	if len(statefulSet.Spec.Template.Spec.Containers) > 0 {
+		currentContainer := c.Statefulset.Spec.Template.Spec.Containers[0]
+		desiredContainer := statefulSet.Spec.Template.Spec.Containers[0]
+		if !reflect.DeepEqual(currentContainer.ReadinessProbe, desiredContainer.ReadinessProbe) {
+			needsRollUpdate = true
+			reasons = append(reasons, "new statefulset's postgres container readiness probe does not match the current one")
+		}
+		if !reflect.DeepEqual(currentContainer.LivenessProbe, desiredContainer.LivenessProbe) {
+			needsRollUpdate = true
+			reasons = append(reasons, "new statefulset's postgres container liveness probe does not match the current one")
+		}
+		if !reflect.DeepEqual(currentContainer.StartupProbe, desiredContainer.StartupProbe) {
+			needsRollUpdate = true
+			reasons = append(reasons, "new statefulset's postgres container startup probe does not match the current one")
+		}
+	}
+	// the probes of manifest sidecars are only generated for the metrics exporter, also with all fields set
+	probedSidecars := make([]string, 0, len(c.Spec.Sidecars)+1)
+	for _, sidecar := range c.Spec.Sidecars {
+		probedSidecars = append(probedSidecars, sidecar.Name)
+	}
+	if c.Spec.MetricsExporter != nil && !util.SliceContains(probedSidecars, c.Spec.MetricsExporter.Sidecar) {
+		probedSidecars = append(probedSidecars, c.Spec.MetricsExporter.Sidecar)
+	}
+	for _, name := range probedSidecars {
+		currentContainer := findContainer(c.Statefulset.Spec.Template.Spec.Containers, name)
+		desiredContainer := findContainer(statefulSet.Spec.Template.Spec.Containers, name)
+		// added or removed sidecars are already reported by the container comparison
+		if currentContainer == nil || desiredContainer == nil {
+			continue
+		}
+		if !reflect.DeepEqual(currentContainer.ReadinessProbe, desiredContainer.ReadinessProbe) ||
+			!reflect.DeepEqual(currentContainer.LivenessProbe, desiredContainer.LivenessProbe) {
+			needsRollUpdate = true
+			reasons = append(reasons, fmt.Sprintf("new statefulset's %s container probes do not match the current ones", name))
+		}
+	}
 	// In the comparisons below, the needsReplace and needsRollUpdate flags are never reset, since checks fall through
 	// and the combined effect of all the changes should be applied.
 	// TODO: make sure this is in sync with generatePodTemplate, ideally by using the same list of fields to generate
 	// the template and the diff
 	if c.Statefulset.Spec.Template.Spec.ServiceAccountName != statefulSet.Spec.Template.Spec.ServiceAccountName {
-		needsReplace = true
 		needsRollUpdate = true
 		reasons = append(reasons, "new statefulset's serviceAccountName service account name does not match the current one")
 	}
@@ -388,6 +670,21 @@ func (c *Cluster) compareStatefulSetWith(statefulSet *appsv1.StatefulSet) *compa
 		needsRollUpdate = true
 		reasons = append(reasons, "new statefulset's pod affinity does not match the current one")
 	}
+	if !sameTolerations(c.Statefulset.Spec.Template.Spec.Tolerations, statefulSet.Spec.Template.Spec.Tolerations) {
+		match = false
+		needsRollUpdate = true
+		reasons = append(reasons, "new statefulset's pod tolerations do not match the current ones")
+	}
+	if !reflect.DeepEqual(c.Statefulset.Spec.Template.Spec.NodeSelector, statefulSet.Spec.Template.Spec.NodeSelector) {
+		match = false
+		needsRollUpdate = true
+		reasons = append(reasons, "new statefulset's pod node selector does not match the current one")
+	}
+	// running pods keep working with the images they have pulled, only pods created later need the new secrets
+	if !reflect.DeepEqual(c.Statefulset.Spec.Template.Spec.ImagePullSecrets, statefulSet.Spec.Template.Spec.ImagePullSecrets) {
+		match = false
+		reasons = append(reasons, "new statefulset's image pull secrets do not match the current ones")
+	}
 
 	// Some generated fields like creationTimestamp make it not possible to use DeepCompare on Spec.Template.ObjectMeta
 	if !reflect.DeepEqual(c.Statefulset.Spec.Template.Labels, statefulSet.Spec.Template.Labels) {
@@ -408,23 +705,26 @@ func (c *Cluster) compareStatefulSetWith(statefulSet *appsv1.StatefulSet) *compa
 		}
 	}
 
-	if !reflect.DeepEqual(c.Statefulset.Spec.Template.Annotations, statefulSet.Spec.Template.Annotations) {
+	// the pod template is mutable, so changed annotations reach the pods via a rolling update
+	if !c.compareAnnotations(c.Statefulset.Spec.Template.Annotations, statefulSet.Spec.Template.Annotations) {
 		match = false
-		needsReplace = true
 		needsRollUpdate = true
 		reasons = append(reasons, "new statefulset's pod template metadata annotations does not match the current one")
 	}
-	if !reflect.DeepEqual(c.Statefulset.Spec.Template.Spec.SecurityContext, statefulSet.Spec.Template.Spec.SecurityContext) {
+	if changed := podSecurityContextChanges(c.Statefulset.Spec.Template.Spec.SecurityContext, statefulSet.Spec.Template.Spec.SecurityContext); len(changed) > 0 {
 		match = false
 		needsReplace = true
 		needsRollUpdate = true
-		reasons = append(reasons, "new statefulset's pod template security context in spec does not match the current one")
+		reasons = append(reasons, fmt.Sprintf("new statefulset's pod template security context (%s) does not match the current one",
+			strings.Join(changed, ", ")))
 	}
 	if len(c.Statefulset.Spec.VolumeClaimTemplates) != len(statefulSet.Spec.VolumeClaimTemplates) {
+		// pods have to be re-created to mount added tablespace volumes
 		needsReplace = true
+		needsRollUpdate = true
 		reasons = append(reasons, "new statefulset's volumeClaimTemplates contains different number of volumes to the old one")
 	}
-	for i := 0; i < len(c.Statefulset.Spec.VolumeClaimTemplates); i++ {
+	for i := 0; i < len(c.Statefulset.Spec.VolumeClaimTemplates) && i < len(statefulSet.Spec.VolumeClaimTemplates); i++ {
 		name := c.Statefulset.Spec.VolumeClaimTemplates[i].Name
 		// Some generated fields like creationTimestamp make it not possible to use DeepCompare on ObjectMeta
 		if name != statefulSet.Spec.VolumeClaimTemplates[i].Name {
@@ -432,11 +732,17 @@ func (c *Cluster) compareStatefulSetWith(statefulSet *appsv1.StatefulSet) *compa
 			reasons = append(reasons, fmt.Sprintf("new statefulset's name for volume %d does not match the current one", i))
 			continue
 		}
-		if !reflect.DeepEqual(c.Statefulset.Spec.VolumeClaimTemplates[i].Annotations, statefulSet.Spec.VolumeClaimTemplates[i].Annotations) {
+		desiredClaim := statefulSet.Spec.VolumeClaimTemplates[i]
+		// a replaced statefulset would only create new claims with the changed storage class, this is reported by
+		// syncStorageClass and only done when the migration is requested explicitly
+		if !c.storageClassMigrationAllowed() {
+			desiredClaim = withStorageClassOf(c.Statefulset.Spec.VolumeClaimTemplates[i], desiredClaim)
+		}
+		if !reflect.DeepEqual(c.Statefulset.Spec.VolumeClaimTemplates[i].Annotations, desiredClaim.Annotations) {
 			needsReplace = true
 			reasons = append(reasons, fmt.Sprintf("new statefulset's annotations for volume %q does not match the current one", name))
 		}
-		if !reflect.DeepEqual(c.Statefulset.Spec.VolumeClaimTemplates[i].Spec, statefulSet.Spec.VolumeClaimTemplates[i].Spec) {
+		if !reflect.DeepEqual(c.Statefulset.Spec.VolumeClaimTemplates[i].Spec, desiredClaim.Spec) {
 			name := c.Statefulset.Spec.VolumeClaimTemplates[i].Name
 			needsReplace = true
 			reasons = append(reasons, fmt.Sprintf("new statefulset's volumeClaimTemplates specification for volume %q does not match the current one", name))
@@ -445,13 +751,39 @@ func (c *Cluster) compareStatefulSetWith(statefulSet *appsv1.StatefulSet) *compa
 
 	// we assume any change in priority happens by rolling out a new priority class
 	// changing the priority value in an existing class is not supproted
+	// the pod template of a statefulset is mutable, so updating it is sufficient;
+	// the priority class of running pods is immutable, hence they have to be re-created
 	if c.Statefulset.Spec.Template.Spec.PriorityClassName != statefulSet.Spec.Template.Spec.PriorityClassName {
 		match = false
-		needsReplace = true
 		needsRollUpdate = true
 		reasons = append(reasons, "new statefulset's pod priority class in spec does not match the current one")
 	}
 
+	// pods only mount the volumes they were started with, e.g. a replaced TLS secret or an added configmap
+	if !reflect.DeepEqual(podVolumeSources(&c.Statefulset.Spec.Template), podVolumeSources(&statefulSet.Spec.Template)) {
+		match = false
+		needsRollUpdate = true
+		reasons = append(reasons, "new statefulset's volumes do not match the current ones")
+	}
+
+	// the DNS settings of running pods are immutable as well
+	if effectiveDNSPolicy(c.Statefulset.Spec.Template.Spec.DNSPolicy) != effectiveDNSPolicy(statefulSet.Spec.Template.Spec.DNSPolicy) {
+		match = false
+		needsRollUpdate = true
+		reasons = append(reasons, "new statefulset's pod DNS policy does not match the current one")
+	}
+	if !reflect.DeepEqual(c.Statefulset.Spec.Template.Spec.DNSConfig, statefulSet.Spec.Template.Spec.DNSConfig) {
+		match = false
+		needsRollUpdate = true
+		reasons = append(reasons, "new statefulset's pod DNS config does not match the current one")
+	}
+	// the hosts file of the pods is written when they start
+	if !reflect.DeepEqual(c.Statefulset.Spec.Template.Spec.HostAliases, statefulSet.Spec.Template.Spec.HostAliases) {
+		match = false
+		needsRollUpdate = true
+		reasons = append(reasons, "new statefulset's pod host aliases do not match the current ones")
+	}
+
 	// lazy Spilo update: modify the image in the statefulset itself but let its pods run with the old image
 	// until they are re-created for other reasons, for example node rotation
 	if c.OpConfig.EnableLazySpiloUpgrade && !reflect.DeepEqual(c.Statefulset.Spec.Template.Spec.Containers[0].Image, statefulSet.Spec.Template.Spec.Containers[0].Image) {
@@ -462,8 +794,13 @@ func (c *Cluster) compareStatefulSetWith(statefulSet *appsv1.StatefulSet) *compa
 	if needsRollUpdate || needsReplace {
 		match = false
 	}
+	// every other difference clears match or requires a rolling update or replacement
+	scaleOnly := replicasChanged && match
+	if replicasChanged {
+		match = false
+	}
 
-	return &compareStatefulsetResult{match: match, reasons: reasons, rollingUpdate: needsRollUpdate, replace: needsReplace}
+	return &compareStatefulsetResult{match: match, reasons: reasons, rollingUpdate: needsRollUpdate, replace: needsReplace, scaleOnly: scaleOnly}
 }
 
 type containerCondition func(a, b v1.Container) bool
@@ -495,11 +832,21 @@ func (c *Cluster) compareContainers(description string, setA, setB []v1.Containe
 		newCheck("new statefulset %s's %s (index %d) resources do not match the current ones",
 			func(a, b v1.Container) bool { return !compareResources(&a.Resources, &b.Resources) }),
 		newCheck("new statefulset %s's %s (index %d) environment does not match the current one",
-			func(a, b v1.Container) bool { return !reflect.DeepEqual(a.Env, b.Env) }),
+			func(a, b v1.Container) bool {
+				return len(removedEnvVars(a, b)) == 0 && !reflect.DeepEqual(withoutCloneEnvVars(a), withoutCloneEnvVars(b))
+			}),
 		newCheck("new statefulset %s's %s (index %d) environment sources do not match the current one",
 			func(a, b v1.Container) bool { return !reflect.DeepEqual(a.EnvFrom, b.EnvFrom) }),
 		newCheck("new statefulset %s's %s (index %d) security context does not match the current one",
 			func(a, b v1.Container) bool { return !reflect.DeepEqual(a.SecurityContext, b.SecurityContext) }),
+		newCheck("new statefulset %s's %s (index %d) lifecycle hooks do not match the current ones",
+			func(a, b v1.Container) bool { return !reflect.DeepEqual(a.Lifecycle, b.Lifecycle) }),
+		newCheck("new statefulset %s's %s (index %d) volume mounts do not match the current ones",
+			func(a, b v1.Container) bool { return !sameVolumeMounts(a.VolumeMounts, b.VolumeMounts) }),
+		newCheck("new statefulset %s's %s (index %d) command does not match the current one",
+			func(a, b v1.Container) bool { return !sameStrings(a.Command, b.Command) }),
+		newCheck("new statefulset %s's %s (index %d) args do not match the current ones",
+			func(a, b v1.Container) bool { return !sameStrings(a.Args, b.Args) }),
 	}
 
 	if !c.OpConfig.EnableLazySpiloUpgrade {
@@ -515,39 +862,197 @@ func (c *Cluster) compareContainers(description string, setA, setB []v1.Containe
 				reasons = append(reasons, fmt.Sprintf(check.reason, description, containerA.Name, index))
 			}
 		}
+		// running containers keep a removed variable until they are re-created, so name the ones to drop
+		if removed := removedEnvVars(containerA, containerB); len(removed) > 0 {
+			needsRollUpdate = true
+			reasons = append(reasons, fmt.Sprintf("new statefulset %s's %s (index %d) environment drops the variables %s",
+				description, containerA.Name, index, strings.Join(removed, ", ")))
+		}
 	}
 
 	return needsRollUpdate, reasons
 }
 
+// removedEnvVars returns the names of the current variables of the container missing from the desired ones,
+// the variables of a clone are only used to bootstrap the cluster and are not reported
+func removedEnvVars(current, desired v1.Container) []string {
+	desiredNames := make(map[string]bool, len(desired.Env))
+	for _, envVar := range desired.Env {
+		desiredNames[envVar.Name] = true
+	}
+
+	removed := make([]string, 0)
+	for _, envVar := range withoutCloneEnvVars(current) {
+		if !desiredNames[envVar.Name] {
+			removed = append(removed, envVar.Name)
+		}
+	}
+	return removed
+}
+
+// sameStrings compares two lists including their order, an empty list equals a missing one
+func sameStrings(a, b []string) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func findContainer(containers []v1.Container, name string) *v1.Container {
+	for i := range containers {
+		if containers[i].Name == name {
+			return &containers[i]
+		}
+	}
+	return nil
+}
+
+// podSecurityContextChanges lists the fields of the pod security context that differ,
+// so that the rolling update reason tells which user or group setting has changed
+func podSecurityContextChanges(current, desired *v1.PodSecurityContext) []string {
+	if reflect.DeepEqual(current, desired) {
+		return nil
+	}
+	if current == nil || desired == nil {
+		return []string{"securityContext"}
+	}
+
+	changed := make([]string, 0)
+	if !reflect.DeepEqual(current.RunAsUser, desired.RunAsUser) {
+		changed = append(changed, "runAsUser")
+	}
+	if !reflect.DeepEqual(current.RunAsGroup, desired.RunAsGroup) {
+		changed = append(changed, "runAsGroup")
+	}
+	if !reflect.DeepEqual(current.FSGroup, desired.FSGroup) {
+		changed = append(changed, "fsGroup")
+	}
+	if !reflect.DeepEqual(current.FSGroupChangePolicy, desired.FSGroupChangePolicy) {
+		changed = append(changed, "fsGroupChangePolicy")
+	}
+	if len(changed) == 0 {
+		changed = append(changed, "securityContext")
+	}
+	return changed
+}
+
+// compareResources tells whether the requests and the limits of both containers are the same, also when a container
+// has limits only, e.g. a sidecar whose memory limit has been raised
 func compareResources(a *v1.ResourceRequirements, b *v1.ResourceRequirements) bool {
-	equal := true
+	var requestsA, limitsA, requestsB, limitsB v1.ResourceList
 	if a != nil {
-		equal = compareResourcesAssumeFirstNotNil(a, b)
+		requestsA, limitsA = a.Requests, a.Limits
 	}
-	if equal && (b != nil) {
-		equal = compareResourcesAssumeFirstNotNil(b, a)
+	if b != nil {
+		requestsB, limitsB = b.Requests, b.Limits
 	}
-
-	return equal
+	return sameResourceList(requestsA, requestsB) && sameResourceList(limitsA, limitsB)
 }
 
-func compareResourcesAssumeFirstNotNil(a *v1.ResourceRequirements, b *v1.ResourceRequirements) bool {
-	if b == nil || (len(b.Requests) == 0) {
-		return len(a.Requests) == 0
+// sameResourceList compares the quantities of both lists, a resource missing in one of them differs
+func sameResourceList(a, b v1.ResourceList) bool {
+	if len(a) != len(b) {
+		return false
 	}
-	for k, v := range a.Requests {
-		if (&v).Cmp(b.Requests[k]) != 0 {
+	for name, quantity := range a {
+		other, ok := b[name]
+		if !ok || quantity.Cmp(other) != 0 {
 			return false
 		}
 	}
-	for k, v := range a.Limits {
-		if (&v).Cmp(b.Limits[k]) != 0 {
+	return true
+}
+
+// podVolumeSources maps the names of the volumes in the pod template to the kind and name of their source. Fields
+// defaulted by the API server, like the file mode of secrets and configmaps, are left out to not report a false diff.
+func podVolumeSources(template *v1.PodTemplateSpec) map[string]string {
+	volumeSources := make(map[string]string)
+	for _, volume := range template.Spec.Volumes {
+		source := volume.VolumeSource
+		switch {
+		case source.Secret != nil:
+			volumeSources[volume.Name] = "secret/" + source.Secret.SecretName
+		case source.ConfigMap != nil:
+			volumeSources[volume.Name] = "configmap/" + source.ConfigMap.Name
+		case source.PersistentVolumeClaim != nil:
+			volumeSources[volume.Name] = "persistentvolumeclaim/" + source.PersistentVolumeClaim.ClaimName
+		case source.HostPath != nil:
+			volumeSources[volume.Name] = "hostpath/" + source.HostPath.Path
+		case source.EmptyDir != nil:
+			volumeSources[volume.Name] = "emptydir"
+		case source.Projected != nil:
+			sources := make([]string, 0, len(source.Projected.Sources))
+			for _, projection := range source.Projected.Sources {
+				if projection.Secret != nil {
+					sources = append(sources, "secret/"+projection.Secret.Name)
+				}
+				if projection.ConfigMap != nil {
+					sources = append(sources, "configmap/"+projection.ConfigMap.Name)
+				}
+			}
+			volumeSources[volume.Name] = "projected/" + strings.Join(sources, ",")
+		default:
+			volumeSources[volume.Name] = "other"
+		}
+	}
+	return volumeSources
+}
+
+// sameVolumeMounts compares the volume mounts of two containers regardless of their order
+func sameVolumeMounts(a, b []v1.VolumeMount) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	mounts := make(map[string]v1.VolumeMount, len(a))
+	for _, mount := range a {
+		mounts[mount.MountPath] = mount
+	}
+	for _, mount := range b {
+		current, exists := mounts[mount.MountPath]
+		if !exists || current.Name != mount.Name || current.SubPath != mount.SubPath || current.ReadOnly != mount.ReadOnly {
 			return false
 		}
 	}
 	return true
+}
+
+// sameTolerations compares the tolerations regardless of their order. The not-ready and unreachable tolerations
+// Kubernetes adds by default are ignored unless they are requested explicitly.
+func sameTolerations(current, desired []v1.Toleration) bool {
+	remaining := make([]v1.Toleration, len(desired))
+	copy(remaining, desired)
+
+	for _, toleration := range current {
+		found := false
+		for i := range remaining {
+			if equalTolerations(toleration, remaining[i]) {
+				remaining = append(remaining[:i], remaining[i+1:]...)
+				found = true
+				break
+			}
+		}
+		if !found && !isDefaultToleration(toleration) {
+			return false
+		}
+	}
+	return len(remaining) == 0
+}
 
+func equalTolerations(a, b v1.Toleration) bool {
+	return a.MatchToleration(&b) && reflect.DeepEqual(a.TolerationSeconds, b.TolerationSeconds)
+}
+
+func isDefaultToleration(toleration v1.Toleration) bool {
+	return (toleration.Key == v1.TaintNodeNotReady || toleration.Key == v1.TaintNodeUnreachable) &&
+		toleration.Operator == v1.TolerationOpExists && toleration.Effect == v1.TaintEffectNoExecute
+}
+
+// effectiveDNSPolicy returns the DNS policy Kubernetes applies when none is set
+func effectiveDNSPolicy(policy v1.DNSPolicy) v1.DNSPolicy {
+	if policy == "" {
+		return v1.DNSClusterFirst
+	}
+	return policy
 }
 
 func (c *Cluster) enforceMinResourceLimits(spec *acidv1.PostgresSpec) error {
@@ -598,11 +1103,13 @@ func (c *Cluster) Update(oldSpec, newSpec *acidv1.Postgresql) error {
 	updateFailed := false
 	syncStatetfulSet := false
 
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	c.mu.lock("update", c.logger)
+	defer c.mu.unlock(c.logger)
 
 	c.KubeClient.SetPostgresCRDStatus(c.clusterName(), acidv1.ClusterStatusUpdating)
 	c.setSpec(newSpec)
+	c.trackStandbyPromotion(&oldSpec.Spec, &newSpec.Spec)
+	c.trackRemovedLibraries(&oldSpec.Spec, &newSpec.Spec)
 
 	defer func() {
 		if updateFailed {
@@ -614,14 +1121,27 @@ func (c *Cluster) Update(oldSpec, newSpec *acidv1.Postgresql) error {
 
 	logNiceDiff(c.logger, oldSpec, newSpec)
 
-	if oldSpec.Spec.PostgresqlParam.PgVersion > newSpec.Spec.PostgresqlParam.PgVersion {
+	// the clone section only bootstraps a new cluster, the running one keeps its data
+	if !reflect.DeepEqual(oldSpec.Spec.Clone, newSpec.Spec.Clone) {
+		c.logger.Warningf("clone section change has no effect on the running cluster, it is only used at creation time")
+		c.eventRecorder.Event(c.GetReference(), v1.EventTypeWarning, "Clone",
+			"clone section change has no effect on the running cluster, it is only used at creation time")
+	}
+
+	// versions are compared as numbers, "9.6" is older than "10"
+	oldVersion, oldVersionErr := pgVersionNum(oldSpec.Spec.PostgresqlParam.PgVersion)
+	newVersion, newVersionErr := pgVersionNum(newSpec.Spec.PostgresqlParam.PgVersion)
+	if oldVersionErr != nil || newVersionErr != nil {
+		c.logger.Debugf("not comparing the postgresql versions %q and %q",
+			oldSpec.Spec.PostgresqlParam.PgVersion, newSpec.Spec.PostgresqlParam.PgVersion)
+	} else if oldVersion > newVersion {
 		c.logger.Warningf("postgresql version change(%q -> %q) has no effect",
 			oldSpec.Spec.PostgresqlParam.PgVersion, newSpec.Spec.PostgresqlParam.PgVersion)
 		c.eventRecorder.Eventf(c.GetReference(), v1.EventTypeWarning, "PostgreSQL", "postgresql version change(%q -> %q) has no effect",
 			oldSpec.Spec.PostgresqlParam.PgVersion, newSpec.Spec.PostgresqlParam.PgVersion)
 		// we need that hack to generate statefulset with the old version
 		newSpec.Spec.PostgresqlParam.PgVersion = oldSpec.Spec.PostgresqlParam.PgVersion
-	} else if oldSpec.Spec.PostgresqlParam.PgVersion < newSpec.Spec.PostgresqlParam.PgVersion {
+	} else if oldVersion < newVersion {
 		c.logger.Infof("postgresql version increased (%q -> %q), major version upgrade can be done manually after StatefulSet Sync",
 			oldSpec.Spec.PostgresqlParam.PgVersion, newSpec.Spec.PostgresqlParam.PgVersion)
 		syncStatetfulSet = true
@@ -629,8 +1149,9 @@ func (c *Cluster) Update(oldSpec, newSpec *acidv1.Postgresql) error {
 
 	// Service
 	if !reflect.DeepEqual(c.generateService(Master, &oldSpec.Spec), c.generateService(Master, &newSpec.Spec)) ||
-		!reflect.DeepEqual(c.generateService(Replica, &oldSpec.Spec), c.generateService(Replica, &newSpec.Spec)) {
-		if err := c.syncServices(); err != nil {
+		!reflect.DeepEqual(c.generateService(Replica, &oldSpec.Spec), c.generateService(Replica, &newSpec.Spec)) ||
+		replicaServiceEnabled(&oldSpec.Spec) != replicaServiceEnabled(&newSpec.Spec) {
+		if err := c.syncServices(context.TODO()); err != nil {
 			c.logger.Errorf("could not sync services: %v", err)
 			updateFailed = true
 		}
@@ -639,6 +1160,10 @@ func (c *Cluster) Update(oldSpec, newSpec *acidv1.Postgresql) error {
 	// connection pooler needs one system user created, which is done in
 	// initUsers. Check if it needs to be called.
 	sameUsers := reflect.DeepEqual(oldSpec.Spec.Users, newSpec.Spec.Users) &&
+		reflect.DeepEqual(oldSpec.Spec.UserConnectionLimits, newSpec.Spec.UserConnectionLimits) &&
+		reflect.DeepEqual(oldSpec.Spec.UserValidUntil, newSpec.Spec.UserValidUntil) &&
+		reflect.DeepEqual(oldSpec.Spec.UserParameters, newSpec.Spec.UserParameters) &&
+		reflect.DeepEqual(oldSpec.Spec.ExternalSecrets, newSpec.Spec.ExternalSecrets) &&
 		reflect.DeepEqual(oldSpec.Spec.PreparedDatabases, newSpec.Spec.PreparedDatabases)
 	needConnectionPooler := needMasterConnectionPoolerWorker(&newSpec.Spec) ||
 		needReplicaConnectionPoolerWorker(&newSpec.Spec)
@@ -651,16 +1176,28 @@ func (c *Cluster) Update(oldSpec, newSpec *acidv1.Postgresql) error {
 
 		c.logger.Debugf("syncing secrets")
 
-		//TODO: mind the secrets of the deleted/new users
-		if err := c.syncSecrets(); err != nil {
+		if err := c.syncSecrets(context.TODO()); err != nil {
 			c.logger.Errorf("could not sync secrets: %v", err)
 			updateFailed = true
 		}
 	}
 
+	// Patroni role, bound to the service account before the pods are rolled with it
+	if oldSpec.Spec.CreatePatroniRole && !newSpec.Spec.CreatePatroniRole {
+		if err := c.deletePatroniRole(); err != nil {
+			c.logger.Warningf("could not remove Patroni role: %v", err)
+		}
+	} else if oldSpec.Spec.CreatePatroniRole != newSpec.Spec.CreatePatroniRole ||
+		c.podServiceAccountName(&oldSpec.Spec) != c.podServiceAccountName(&newSpec.Spec) {
+		if err := c.syncPatroniRole(context.TODO()); err != nil {
+			c.logger.Errorf("could not sync Patroni role: %v", err)
+			updateFailed = true
+		}
+	}
+
 	// Volume
 	if c.OpConfig.StorageResizeMode != "off" {
-		c.syncVolumes()
+		c.syncVolumes(context.TODO())
 	} else {
 		c.logger.Infof("Storage resize is disabled (storage_resize_mode is off). Skipping volume sync.")
 	}
@@ -673,7 +1210,13 @@ func (c *Cluster) Update(oldSpec, newSpec *acidv1.Postgresql) error {
 			return
 		}
 
-		oldSs, err := c.generateStatefulSet(&oldSpec.Spec)
+		oldSourceChecksums, err := c.podSourceChecksums(context.TODO(), &oldSpec.Spec)
+		if err != nil {
+			c.logger.Errorf("could not generate old statefulset spec: %v", err)
+			updateFailed = true
+			return
+		}
+		oldSs, err := c.generateStatefulSet(&oldSpec.Spec, oldSourceChecksums)
 		if err != nil {
 			c.logger.Errorf("could not generate old statefulset spec: %v", err)
 			updateFailed = true
@@ -683,17 +1226,31 @@ func (c *Cluster) Update(oldSpec, newSpec *acidv1.Postgresql) error {
 		// update newSpec to for latter comparison with oldSpec
 		c.enforceMinResourceLimits(&newSpec.Spec)
 
-		newSs, err := c.generateStatefulSet(&newSpec.Spec)
+		newSourceChecksums, err := c.podSourceChecksums(context.TODO(), &newSpec.Spec)
+		if err != nil {
+			c.logger.Errorf("could not generate new statefulset spec: %v", err)
+			updateFailed = true
+			return
+		}
+		newSs, err := c.generateStatefulSet(&newSpec.Spec, newSourceChecksums)
 		if err != nil {
 			c.logger.Errorf("could not generate new statefulset spec: %v", err)
 			updateFailed = true
 			return
 		}
 		if syncStatetfulSet || !reflect.DeepEqual(oldSs, newSs) || !reflect.DeepEqual(oldSpec.Annotations, newSpec.Annotations) {
+			if err := c.syncServiceAccount(context.TODO()); err != nil {
+				c.logger.Errorf("could not sync pod service account: %v", err)
+				updateFailed = true
+				return
+			}
+			if err := c.syncPatroniAPITLS(context.TODO()); err != nil {
+				c.logger.Warningf("could not sync Patroni API certificate: %v", err)
+			}
 			c.logger.Debugf("syncing statefulsets")
 			syncStatetfulSet = false
 			// TODO: avoid generating the StatefulSet object twice by passing it to syncStatefulSet
-			if err := c.syncStatefulSet(); err != nil {
+			if err := c.syncStatefulSet(context.TODO()); err != nil {
 				c.logger.Errorf("could not sync statefulsets: %v", err)
 				updateFailed = true
 			}
@@ -703,19 +1260,114 @@ func (c *Cluster) Update(oldSpec, newSpec *acidv1.Postgresql) error {
 	// pod disruption budget
 	if oldSpec.Spec.NumberOfInstances != newSpec.Spec.NumberOfInstances {
 		c.logger.Debug("syncing pod disruption budgets")
-		if err := c.syncPodDisruptionBudget(true); err != nil {
+		if err := c.syncPodDisruptionBudget(context.TODO(), true); err != nil {
 			c.logger.Errorf("could not sync pod disruption budget: %v", err)
 			updateFailed = true
 		}
 	}
 
+	// volume claims of removed pods
+	if oldSpec.Spec.NumberOfInstances != newSpec.Spec.NumberOfInstances ||
+		!reflect.DeepEqual(oldSpec.Spec.RetainedVolumeClaims, newSpec.Spec.RetainedVolumeClaims) {
+		c.logger.Debug("syncing retained volume claims")
+		if err := c.syncRetainedVolumeClaims(context.TODO()); err != nil {
+			c.logger.Warningf("could not sync retained volume claims: %v", err)
+		}
+	}
+
+	// switchover
+	if oldSpec.Annotations[constants.SwitchoverCandidateAnnotationKey] != newSpec.Annotations[constants.SwitchoverCandidateAnnotationKey] {
+		c.logger.Debug("syncing switchover request")
+		if err := c.syncSwitchover(context.TODO()); err != nil {
+			c.logger.Errorf("could not switch over: %v", err)
+			updateFailed = true
+		}
+	}
+
+	// pod services follow the number of instances, a failure is retried on the next sync
+	if oldSpec.Spec.EnablePodServices != newSpec.Spec.EnablePodServices || newSpec.Spec.EnablePodServices &&
+		(oldSpec.Spec.NumberOfInstances != newSpec.Spec.NumberOfInstances ||
+			!reflect.DeepEqual(oldSpec.Spec.MetricsExporter, newSpec.Spec.MetricsExporter)) {
+		if err := c.syncPodServices(context.TODO()); err != nil {
+			c.logger.Warningf("could not sync pod services: %v", err)
+		}
+	}
+
+	// replica services, a failure is retried on the next sync
+	if !reflect.DeepEqual(oldSpec.Spec.ReplicaServices, newSpec.Spec.ReplicaServices) ||
+		!reflect.DeepEqual(oldSpec.Spec.MetricsExporter, newSpec.Spec.MetricsExporter) {
+		if err := c.syncReplicaServices(context.TODO()); err != nil {
+			c.logger.Warningf("could not sync replica services: %v", err)
+		}
+	}
+
+	// permanent replication slots, a failure is retried on the next sync
+	if !reflect.DeepEqual(oldSpec.Spec.Patroni.Slots, newSpec.Spec.Patroni.Slots) {
+		if err := c.syncReplicationSlots(context.TODO()); err != nil {
+			c.logger.Warningf("could not sync replication slots: %v", err)
+		}
+	}
+
+	// maximum lag on failover, a failure is retried on the next sync
+	if !reflect.DeepEqual(oldSpec.Spec.Patroni.MaximumLagOnFailover, newSpec.Spec.Patroni.MaximumLagOnFailover) {
+		if err := c.syncMaximumLagOnFailover(context.TODO()); err != nil {
+			c.logger.Warningf("could not sync maximum_lag_on_failover: %v", err)
+		}
+	}
+
+	// replica endpoint, a failure is retried on the next sync
+	if !reflect.DeepEqual(oldSpec.Spec.ReplicaServiceMaxLag, newSpec.Spec.ReplicaServiceMaxLag) {
+		if err := c.syncReplicaEndpoint(context.TODO()); err != nil {
+			c.logger.Warningf("could not sync replica endpoint: %v", err)
+		}
+	}
+
+	// pod monitor, a failure to create or update it is retried on the next sync
+	if !reflect.DeepEqual(oldSpec.Spec.MetricsExporter, newSpec.Spec.MetricsExporter) {
+		if err := c.syncPodMonitor(context.TODO()); err != nil {
+			c.logger.Warningf("could not sync pod monitor: %v", err)
+		}
+	}
+
+	// master TCP route, a failure is retried on the next sync
+	if !reflect.DeepEqual(oldSpec.Spec.MasterTCPRoute, newSpec.Spec.MasterTCPRoute) {
+		if err := c.syncMasterTCPRoute(context.TODO()); err != nil {
+			c.logger.Warningf("could not sync master TCP route: %v", err)
+		}
+	}
+
+	// read-only state, a failure is retried on the next sync
+	if oldSpec.Spec.ReadOnly != newSpec.Spec.ReadOnly {
+		if err := c.syncReadOnly(context.TODO()); err != nil {
+			c.logger.Warningf("could not sync read-only state: %v", err)
+		}
+	}
+
+	// audit logging, the settings are reloaded while a newly preloaded library waits for the scheduled restart
+	if !reflect.DeepEqual(oldSpec.Spec.Audit, newSpec.Spec.Audit) {
+		c.logger.Debug("syncing audit logging")
+		if newSpec.Spec.Audit == nil {
+			if err := c.disableAuditLogging(context.TODO()); err != nil {
+				c.logger.Errorf("could not disable audit logging: %v", err)
+				updateFailed = true
+			}
+		} else if err := c.checkAndSetGlobalPostgreSQLConfiguration(context.TODO()); err != nil {
+			c.logger.Errorf("could not set audit logging configuration: %v", err)
+			updateFailed = true
+		} else if c.databaseObjectsAccessible(&c.Spec) {
+			if err := c.syncAuditExtension(context.TODO()); err != nil {
+				c.logger.Warningf("could not sync audit extension: %v", err)
+			}
+		}
+	}
+
 	// logical backup job
 	func() {
 
 		// create if it did not exist
 		if !oldSpec.Spec.EnableLogicalBackup && newSpec.Spec.EnableLogicalBackup {
 			c.logger.Debugf("creating backup cron job")
-			if err := c.createLogicalBackupJob(); err != nil {
+			if err := c.createLogicalBackupJob(context.TODO()); err != nil {
 				c.logger.Errorf("could not create a k8s cron job for logical backups: %v", err)
 				updateFailed = true
 				return
@@ -725,7 +1377,7 @@ func (c *Cluster) Update(oldSpec, newSpec *acidv1.Postgresql) error {
 		// delete if no longer needed
 		if oldSpec.Spec.EnableLogicalBackup && !newSpec.Spec.EnableLogicalBackup {
 			c.logger.Debugf("deleting backup cron job")
-			if err := c.deleteLogicalBackupJob(); err != nil {
+			if err := c.deleteLogicalBackupJob(context.TODO()); err != nil {
 				c.logger.Errorf("could not delete a k8s cron job for logical backups: %v", err)
 				updateFailed = true
 				return
@@ -738,7 +1390,7 @@ func (c *Cluster) Update(oldSpec, newSpec *acidv1.Postgresql) error {
 		if (oldSpec.Spec.EnableLogicalBackup && newSpec.Spec.EnableLogicalBackup) &&
 			(newSpec.Spec.LogicalBackupSchedule != oldSpec.Spec.LogicalBackupSchedule) {
 			c.logger.Debugf("updating schedule of the backup cron job")
-			if err := c.syncLogicalBackupJob(); err != nil {
+			if err := c.syncLogicalBackupJob(context.TODO()); err != nil {
 				c.logger.Errorf("could not sync logical backup jobs: %v", err)
 				updateFailed = true
 			}
@@ -746,24 +1398,45 @@ func (c *Cluster) Update(oldSpec, newSpec *acidv1.Postgresql) error {
 
 	}()
 
+	// backup verification job, a failure is retried on the next sync
+	if !reflect.DeepEqual(oldSpec.Spec.BackupVerification, newSpec.Spec.BackupVerification) {
+		if newSpec.Spec.BackupVerification == nil {
+			if err := c.deleteBackupVerificationJob(context.TODO()); err != nil {
+				c.logger.Warningf("could not delete backup verification job: %v", err)
+			}
+		} else if err := c.syncBackupVerification(context.TODO()); err != nil {
+			c.logger.Warningf("could not sync backup verification job: %v", err)
+		}
+	}
+
 	// Roles and Databases
-	if !(c.databaseAccessDisabled() || c.getNumberOfInstances(&c.Spec) <= 0 || c.Spec.StandbyCluster != nil) {
+	if !c.databaseObjectsAccessible(&c.Spec) {
+		c.logger.Debugf("database is not accessible, roles and databases are synced once it is")
+		c.databaseObjectsPending = true
+	} else if c.databaseObjectsPending {
+		// changes made while the database was not accessible are not visible in the spec difference
+		c.logger.Infof("database is accessible again, syncing all roles and databases")
+		if err := c.syncDatabaseObjects(context.TODO()); err != nil {
+			c.logger.Errorf("could not sync database objects: %v", err)
+			updateFailed = true
+		}
+	} else {
 		c.logger.Debugf("syncing roles")
-		if err := c.syncRoles(); err != nil {
+		if err := c.syncRoles(context.TODO()); err != nil {
 			c.logger.Errorf("could not sync roles: %v", err)
 			updateFailed = true
 		}
 		if !reflect.DeepEqual(oldSpec.Spec.Databases, newSpec.Spec.Databases) ||
 			!reflect.DeepEqual(oldSpec.Spec.PreparedDatabases, newSpec.Spec.PreparedDatabases) {
 			c.logger.Infof("syncing databases")
-			if err := c.syncDatabases(); err != nil {
+			if err := c.syncDatabases(context.TODO()); err != nil {
 				c.logger.Errorf("could not sync databases: %v", err)
 				updateFailed = true
 			}
 		}
 		if !reflect.DeepEqual(oldSpec.Spec.PreparedDatabases, newSpec.Spec.PreparedDatabases) {
 			c.logger.Infof("syncing prepared databases")
-			if err := c.syncPreparedDatabases(); err != nil {
+			if err := c.syncPreparedDatabases(context.TODO()); err != nil {
 				c.logger.Errorf("could not sync prepared databases: %v", err)
 				updateFailed = true
 			}
@@ -776,10 +1449,15 @@ func (c *Cluster) Update(oldSpec, newSpec *acidv1.Postgresql) error {
 	// check which databases we need to process, but even repeating the whole
 	// installation process should be good enough.
 
-	if _, err := c.syncConnectionPooler(oldSpec, newSpec, c.installLookupFunction); err != nil {
+	if _, err := c.syncConnectionPooler(context.TODO(), oldSpec, newSpec, c.installLookupFunction); err != nil {
 		c.logger.Errorf("could not sync connection pooler: %v", err)
 		updateFailed = true
 	}
+	if connectionPoolerRestartScheduled(&oldSpec.Spec) || connectionPoolerRestartScheduled(&newSpec.Spec) {
+		if err := c.syncConnectionPoolerRestartJob(context.TODO()); err != nil {
+			c.logger.Warningf("could not sync connection pooler restart job: %v", err)
+		}
+	}
 
 	return nil
 }
@@ -804,20 +1482,29 @@ func syncResources(a, b *v1.ResourceRequirements) bool {
 // before the pods, it will be re-created by the current master pod and will remain, obstructing the
 // creation of the new cluster with the same name. Therefore, the endpoints should be deleted last.
 func (c *Cluster) Delete() {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	c.mu.lock("delete", c.logger)
+	defer c.mu.unlock(c.logger)
 	c.eventRecorder.Event(c.GetReference(), v1.EventTypeNormal, "Delete", "Started deletion of new cluster resources")
 
 	// delete the backup job before the stateful set of the cluster to prevent connections to non-existing pods
 	// deleting the cron job also removes pods and batch jobs it created
-	if err := c.deleteLogicalBackupJob(); err != nil {
+	if err := c.deleteLogicalBackupJob(context.TODO()); err != nil {
 		c.logger.Warningf("could not remove the logical backup k8s cron job; %v", err)
 	}
+	if c.Spec.BackupVerification != nil {
+		if err := c.deleteBackupVerificationJob(context.TODO()); err != nil {
+			c.logger.Warningf("could not remove the backup verification job: %v", err)
+		}
+	}
 
 	if err := c.deleteStatefulSet(); err != nil {
 		c.logger.Warningf("could not delete statefulset: %v", err)
 	}
 
+	if err := c.deleteVolumeSnapshots(context.TODO()); err != nil {
+		c.logger.Warningf("could not delete volume snapshots: %v", err)
+	}
+
 	if err := c.deleteSecrets(); err != nil {
 		c.logger.Warningf("could not delete secrets: %v", err)
 	}
@@ -827,6 +1514,12 @@ func (c *Cluster) Delete() {
 	}
 
 	for _, role := range []PostgresRole{Master, Replica} {
+		if role == Replica && !replicaServiceEnabled(&c.Spec) {
+			if err := c.removeReplicaService(context.TODO()); err != nil {
+				c.logger.Warningf("could not remove replica service: %v", err)
+			}
+			continue
+		}
 
 		if !c.patroniKubernetesUseConfigMaps() {
 			if err := c.deleteEndpoint(role); err != nil {
@@ -839,18 +1532,43 @@ func (c *Cluster) Delete() {
 		}
 	}
 
+	if err := c.deletePodServices(context.TODO(), nil); err != nil {
+		c.logger.Warningf("could not delete pod services: %v", err)
+	}
+
+	if err := c.deleteReplicaServices(context.TODO(), nil); err != nil {
+		c.logger.Warningf("could not delete replica services: %v", err)
+	}
+
 	if err := c.deletePatroniClusterObjects(); err != nil {
 		c.logger.Warningf("could not remove leftover patroni objects; %v", err)
 	}
 
+	if c.Spec.CreatePatroniRole {
+		if err := c.deletePatroniRole(); err != nil {
+			c.logger.Warningf("could not remove Patroni role: %v", err)
+		}
+	}
+
+	if err := c.deletePodMonitor(context.TODO()); err != nil {
+		c.logger.Warningf("could not remove pod monitor: %v", err)
+	}
+
+	if err := c.deleteMasterTCPRoute(context.TODO()); err != nil {
+		c.logger.Warningf("could not remove master TCP route: %v", err)
+	}
+
 	// Delete connection pooler objects anyway, even if it's not mentioned in the
 	// manifest, just to not keep orphaned components in case if something went
 	// wrong
 	for _, role := range [2]PostgresRole{Master, Replica} {
-		if err := c.deleteConnectionPooler(role); err != nil {
+		if err := c.deleteConnectionPooler(context.TODO(), role); err != nil {
 			c.logger.Warningf("could not remove connection pooler: %v", err)
 		}
 	}
+	if err := c.deleteConnectionPoolerRestartJob(context.TODO()); err != nil {
+		c.logger.Warningf("could not remove connection pooler restart job: %v", err)
+	}
 
 }
 
@@ -882,12 +1600,69 @@ func (c *Cluster) processPodEvent(obj interface{}) error {
 		subscriber <- event
 	}
 
+	// a pod changing its role or state may change the replicas serving the replica endpoint or services
+	c.requestPodRolesRefresh()
+
 	return nil
 }
 
 // Run starts the pod event dispatching for the given cluster.
 func (c *Cluster) Run(stopCh <-chan struct{}) {
 	go c.processPodEventQueue(stopCh)
+	go c.processPodRolesRefresh(stopCh)
+}
+
+// requestPodRolesRefresh asks for an update of the replica endpoint and the sync standby labels without waiting for
+// it, requests made while one is pending are merged
+func (c *Cluster) requestPodRolesRefresh() {
+	select {
+	case c.podRolesRefresh <- struct{}{}:
+	default:
+	}
+}
+
+// processPodRolesRefresh updates the replica endpoint and the sync standby labels on request, so that replicas
+// leaving or joining the cluster or changing their role between two syncs do not wait for the next one. It works on
+// a copy of the spec, as it does not hold the lock of the cluster.
+func (c *Cluster) processPodRolesRefresh(stopCh <-chan struct{}) {
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-c.podRolesRefresh:
+			pgSpec, err := c.GetSpec()
+			if err != nil {
+				c.logger.Warningf("could not get the spec to follow the roles of the pods: %v", err)
+				continue
+			}
+			c.refreshPodRoles(&pgSpec.Spec)
+		}
+	}
+}
+
+// refreshPodRoles updates the objects following the roles of the pods, a failure is left to the next sync
+func (c *Cluster) refreshPodRoles(pgSpec *acidv1.PostgresSpec) {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+	if c.OpConfig.SyncStepTimeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), c.OpConfig.SyncStepTimeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	defer cancel()
+
+	if replicaServiceEnabled(pgSpec) && replicaLagGateEnabled(pgSpec) {
+		if _, err := c.updateReplicaEndpoint(ctx, pgSpec); err != nil {
+			c.logger.Warningf("could not update replica endpoint: %v", err)
+		}
+	}
+	if len(pgSpec.ReplicaServices) > 0 {
+		if _, err := c.updateSyncStandbyLabels(ctx, pgSpec); err != nil {
+			c.logger.Warningf("could not update sync standby labels: %v", err)
+		}
+	}
 }
 
 func (c *Cluster) processPodEventQueue(stopCh <-chan struct{}) {
@@ -1065,6 +1840,30 @@ func (c *Cluster) initDefaultRoles(defaultRoles map[string]string, admin, prefix
 	return nil
 }
 
+// trackRemovedLibraries remembers the libraries removed from shared_preload_libraries of the manifest, so that they
+// are removed from the libraries Postgres loads, which keeps the ones Spilo preloads by default
+func (c *Cluster) trackRemovedLibraries(oldSpec, newSpec *acidv1.PostgresSpec) {
+	for _, library := range splitLibraries(oldSpec.Parameters[sharedPreloadLibrariesParameter]) {
+		if c.removedLibraries == nil {
+			c.removedLibraries = make(map[string]bool)
+		}
+		c.removedLibraries[library] = true
+	}
+	for _, library := range splitLibraries(newSpec.Parameters[sharedPreloadLibrariesParameter]) {
+		delete(c.removedLibraries, library)
+	}
+}
+
+// trackStandbyPromotion remembers that the standby section was removed from the manifest, only such a cluster is
+// checked for a promotion by the sync
+func (c *Cluster) trackStandbyPromotion(oldSpec, newSpec *acidv1.PostgresSpec) {
+	if newSpec.StandbyCluster != nil {
+		c.standbyPromotionPending = false
+	} else if oldSpec.StandbyCluster != nil {
+		c.standbyPromotionPending = true
+	}
+}
+
 func (c *Cluster) initRobotUsers() error {
 	for username, userFlags := range c.Spec.Users {
 		if !isValidUsername(username) {
@@ -1082,13 +1881,37 @@ func (c *Cluster) initRobotUsers() error {
 		if c.OpConfig.EnableAdminRoleForUsers {
 			adminRole = c.OpConfig.TeamAdminRole
 		}
+		password := util.RandomPassword(constants.PasswordLength)
+		if _, external := c.Spec.ExternalSecrets[username]; external {
+			// read from the external secret when syncing the secrets
+			password = ""
+		}
 		newRole := spec.PgUser{
 			Origin:    spec.RoleOriginManifest,
 			Name:      username,
-			Password:  util.RandomPassword(constants.PasswordLength),
+			Password:  password,
 			Flags:     flags,
 			AdminRole: adminRole,
 		}
+		if connectionLimit, ok := c.Spec.UserConnectionLimits[username]; ok {
+			newRole.ConnectionLimit = &connectionLimit
+		}
+		if expiry, ok := c.Spec.UserValidUntil[username]; ok {
+			validUntil := time.Time{}
+			if expiry != "infinity" {
+				if validUntil, err = time.Parse(time.RFC3339, expiry); err != nil {
+					return fmt.Errorf("invalid expiry for user %q: %v", username, err)
+				}
+			}
+			newRole.ValidUntil = &validUntil
+		}
+		if parameters, ok := c.Spec.UserParameters[username]; ok {
+			// an empty map is kept to reset all settings of the role
+			newRole.Parameters = make(map[string]string, len(parameters))
+			for name, value := range parameters {
+				newRole.Parameters[name] = value
+			}
+		}
 		if currentRole, present := c.pgUsers[username]; present {
 			c.pgUsers[username] = c.resolveNameConflict(&currentRole, &newRole)
 		} else {
@@ -1098,6 +1921,51 @@ func (c *Cluster) initRobotUsers() error {
 	return nil
 }
 
+// initMonitoringUser adds the read-only monitoring role as a member of pg_monitor. A manifest role of the same
+// name keeps its flags and only becomes a member of pg_monitor.
+func (c *Cluster) initMonitoringUser() {
+	if !c.Spec.EnableMonitoringRole {
+		return
+	}
+
+	username := constants.MonitoringUserName
+	if currentRole, present := c.pgUsers[username]; present {
+		if !util.SliceContains(currentRole.MemberOf, constants.MonitoringRoleName) {
+			currentRole.MemberOf = append(currentRole.MemberOf, constants.MonitoringRoleName)
+		}
+		c.pgUsers[username] = currentRole
+		return
+	}
+
+	c.pgUsers[username] = spec.PgUser{
+		Origin:   spec.RoleOriginSystem,
+		Name:     username,
+		Password: util.RandomPassword(constants.PasswordLength),
+		Flags:    []string{constants.RoleFlagLogin},
+		MemberOf: []string{constants.MonitoringRoleName},
+	}
+}
+
+// initBackupUser adds the login role pg_dump runs as, its read grants are given per database when syncing the
+// databases. A manifest role of the same name is left untouched.
+func (c *Cluster) initBackupUser() {
+	if !c.Spec.EnableBackupRole {
+		return
+	}
+
+	username := constants.BackupUserName
+	if _, present := c.pgUsers[username]; present {
+		return
+	}
+
+	c.pgUsers[username] = spec.PgUser{
+		Origin:   spec.RoleOriginSystem,
+		Name:     username,
+		Password: util.RandomPassword(constants.PasswordLength),
+		Flags:    []string{constants.RoleFlagLogin},
+	}
+}
+
 func (c *Cluster) initTeamMembers(teamID string, isPostgresSuperuserTeam bool) error {
 	teamMembers, err := c.getTeamMembers(teamID)
 
@@ -1264,7 +2132,7 @@ func (c *Cluster) GetStatus() *ClusterStatus {
 }
 
 // Switchover does a switchover (via Patroni) to a candidate pod
-func (c *Cluster) Switchover(curMaster *v1.Pod, candidate spec.NamespacedName) error {
+func (c *Cluster) Switchover(ctx context.Context, curMaster *v1.Pod, candidate spec.NamespacedName) error {
 
 	var err error
 	c.logger.Debugf("switching over from %q to %q", curMaster.Name, candidate)
@@ -1293,9 +2161,10 @@ func (c *Cluster) Switchover(curMaster *v1.Pod, candidate spec.NamespacedName) e
 		}
 	}()
 
-	if err = c.patroni.Switchover(curMaster, candidate.Name); err == nil {
+	if err = c.patroni.Switchover(ctx, curMaster, candidate.Name); err == nil {
 		c.logger.Debugf("successfully switched over from %q to %q", curMaster.Name, candidate)
 		c.eventRecorder.Eventf(c.GetReference(), v1.EventTypeNormal, "Switchover", "Successfully switched over from %q to %q", curMaster.Name, candidate)
+		c.requestPodRolesRefresh()
 		if err = <-podLabelErr; err != nil {
 			err = fmt.Errorf("could not get master pod label: %v", err)
 		}
@@ -1316,14 +2185,14 @@ func (c *Cluster) Switchover(curMaster *v1.Pod, candidate spec.NamespacedName) e
 
 }
 
-// Lock locks the cluster
-func (c *Cluster) Lock() {
-	c.mu.Lock()
+// Lock locks the cluster for the given operation
+func (c *Cluster) Lock(operation string) {
+	c.mu.lock(operation, c.logger)
 }
 
 // Unlock unlocks the cluster
 func (c *Cluster) Unlock() {
-	c.mu.Unlock()
+	c.mu.unlock(c.logger)
 }
 
 type simpleActionWithResult func() error
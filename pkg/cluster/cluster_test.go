@@ -1,17 +1,26 @@
 package cluster
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/lib/pq"
 	"github.com/sirupsen/logrus"
 	acidv1 "github.com/zalando/postgres-operator/pkg/apis/acid.zalan.do/v1"
 	"github.com/zalando/postgres-operator/pkg/spec"
+	"github.com/zalando/postgres-operator/pkg/util"
 	"github.com/zalando/postgres-operator/pkg/util/config"
 	"github.com/zalando/postgres-operator/pkg/util/constants"
 	"github.com/zalando/postgres-operator/pkg/util/k8sutil"
+	"github.com/zalando/postgres-operator/pkg/util/patroni"
 	"github.com/zalando/postgres-operator/pkg/util/teams"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/tools/record"
 )
@@ -56,7 +65,7 @@ func TestStatefulSetAnnotations(t *testing.T) {
 			Size: "1G",
 		},
 	}
-	ss, err := cl.generateStatefulSet(&spec)
+	ss, err := cl.generateStatefulSet(&spec, nil)
 	if err != nil {
 		t.Errorf("in %s no statefulset created %v", testName, err)
 	}
@@ -69,6 +78,1252 @@ func TestStatefulSetAnnotations(t *testing.T) {
 
 }
 
+func TestCompareStatefulSetPriorityClassName(t *testing.T) {
+	testName := "TestCompareStatefulSetPriorityClassName"
+	spec := acidv1.PostgresSpec{
+		TeamID: "myapp", NumberOfInstances: 1,
+		Resources: acidv1.Resources{
+			ResourceRequests: acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+			ResourceLimits:   acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+		},
+		Volume: acidv1.Volume{
+			Size: "1G",
+		},
+	}
+
+	tests := []struct {
+		subTest       string
+		current       string
+		desired       string
+		match         bool
+		rollingUpdate bool
+	}{
+		{
+			subTest:       "unchanged priority class",
+			current:       "high-priority",
+			desired:       "high-priority",
+			match:         true,
+			rollingUpdate: false,
+		},
+		{
+			subTest:       "priority class added",
+			current:       "",
+			desired:       "high-priority",
+			match:         false,
+			rollingUpdate: true,
+		},
+		{
+			subTest:       "priority class changed",
+			current:       "high-priority",
+			desired:       "low-priority",
+			match:         false,
+			rollingUpdate: true,
+		},
+		{
+			subTest:       "priority class removed",
+			current:       "high-priority",
+			desired:       "",
+			match:         false,
+			rollingUpdate: true,
+		},
+	}
+
+	for _, tt := range tests {
+		spec.PodPriorityClassName = tt.current
+		current, err := cl.generateStatefulSet(&spec, nil)
+		if err != nil {
+			t.Fatalf("%s [%s]: could not generate current statefulset: %v", testName, tt.subTest, err)
+		}
+		spec.PodPriorityClassName = tt.desired
+		desired, err := cl.generateStatefulSet(&spec, nil)
+		if err != nil {
+			t.Fatalf("%s [%s]: could not generate desired statefulset: %v", testName, tt.subTest, err)
+		}
+		if desired.Spec.Template.Spec.PriorityClassName != tt.desired {
+			t.Errorf("%s [%s]: expected priority class %q in pod template, got %q",
+				testName, tt.subTest, tt.desired, desired.Spec.Template.Spec.PriorityClassName)
+		}
+
+		cl.Statefulset = current
+		cmp := cl.compareStatefulSetWith(desired)
+		if cmp.match != tt.match {
+			t.Errorf("%s [%s]: expected match to be %t, got %t", testName, tt.subTest, tt.match, cmp.match)
+		}
+		if cmp.rollingUpdate != tt.rollingUpdate {
+			t.Errorf("%s [%s]: expected rolling update to be %t, got %t", testName, tt.subTest, tt.rollingUpdate, cmp.rollingUpdate)
+		}
+		// the pod template of a statefulset is mutable, no need to replace it
+		if cmp.replace {
+			t.Errorf("%s [%s]: changing the priority class should not replace the statefulset", testName, tt.subTest)
+		}
+	}
+	cl.Statefulset = nil
+}
+
+func TestCompareStatefulSetPodAnnotations(t *testing.T) {
+	testName := "TestCompareStatefulSetPodAnnotations"
+	spec := acidv1.PostgresSpec{
+		TeamID: "myapp", NumberOfInstances: 1,
+		Resources: acidv1.Resources{
+			ResourceRequests: acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+			ResourceLimits:   acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+		},
+		Volume: acidv1.Volume{
+			Size: "1G",
+		},
+	}
+	meshAnnotation := "sidecar.istio.io/status"
+	cl.OpConfig.IgnoredAnnotations = []string{meshAnnotation}
+	defer func() { cl.OpConfig.IgnoredAnnotations = nil }()
+
+	tests := []struct {
+		subTest       string
+		current       map[string]string
+		injected      map[string]string
+		desired       map[string]string
+		match         bool
+		rollingUpdate bool
+	}{
+		{
+			subTest:       "unchanged pod annotations",
+			current:       map[string]string{"sidecar.istio.io/inject": "false"},
+			desired:       map[string]string{"sidecar.istio.io/inject": "false"},
+			match:         true,
+			rollingUpdate: false,
+		},
+		{
+			subTest:       "pod annotation changed",
+			current:       map[string]string{"sidecar.istio.io/inject": "false"},
+			desired:       map[string]string{"sidecar.istio.io/inject": "true"},
+			match:         false,
+			rollingUpdate: true,
+		},
+		{
+			subTest:       "pod annotation removed",
+			current:       map[string]string{"sidecar.istio.io/inject": "false"},
+			desired:       nil,
+			match:         false,
+			rollingUpdate: true,
+		},
+		{
+			subTest:       "injected annotation is ignored",
+			current:       map[string]string{"sidecar.istio.io/inject": "true"},
+			injected:      map[string]string{meshAnnotation: "{\"version\":\"1\"}"},
+			desired:       map[string]string{"sidecar.istio.io/inject": "true"},
+			match:         true,
+			rollingUpdate: false,
+		},
+	}
+
+	for _, tt := range tests {
+		spec.PodAnnotations = tt.current
+		current, err := cl.generateStatefulSet(&spec, nil)
+		if err != nil {
+			t.Fatalf("%s [%s]: could not generate current statefulset: %v", testName, tt.subTest, err)
+		}
+		for k, v := range tt.injected {
+			current.Spec.Template.Annotations[k] = v
+		}
+		spec.PodAnnotations = tt.desired
+		desired, err := cl.generateStatefulSet(&spec, nil)
+		if err != nil {
+			t.Fatalf("%s [%s]: could not generate desired statefulset: %v", testName, tt.subTest, err)
+		}
+
+		cl.Statefulset = current
+		cmp := cl.compareStatefulSetWith(desired)
+		if cmp.match != tt.match {
+			t.Errorf("%s [%s]: expected match to be %t, got %t (reasons: %v)", testName, tt.subTest, tt.match, cmp.match, cmp.reasons)
+		}
+		if cmp.rollingUpdate != tt.rollingUpdate {
+			t.Errorf("%s [%s]: expected rolling update to be %t, got %t", testName, tt.subTest, tt.rollingUpdate, cmp.rollingUpdate)
+		}
+		if cmp.replace {
+			t.Errorf("%s [%s]: changing pod annotations should not replace the statefulset", testName, tt.subTest)
+		}
+	}
+	cl.Statefulset = nil
+}
+
+func TestCompareStatefulSetServiceAccount(t *testing.T) {
+	testName := "TestCompareStatefulSetServiceAccount"
+	spec := acidv1.PostgresSpec{
+		TeamID: "myapp", NumberOfInstances: 1,
+		Resources: acidv1.Resources{
+			ResourceRequests: acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+			ResourceLimits:   acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+		},
+		Volume: acidv1.Volume{
+			Size: "1G",
+		},
+	}
+	cl.OpConfig.PodServiceAccountName = "postgres-pod"
+	defer func() { cl.OpConfig.PodServiceAccountName = "" }()
+
+	current, err := cl.generateStatefulSet(&spec, nil)
+	if err != nil {
+		t.Fatalf("%s: could not generate current statefulset: %v", testName, err)
+	}
+	if current.Spec.Template.Spec.ServiceAccountName != "postgres-pod" {
+		t.Errorf("%s: expected the configured service account, got %q", testName, current.Spec.Template.Spec.ServiceAccountName)
+	}
+
+	spec.ServiceAccountName = "postgres-workload-identity"
+	desired, err := cl.generateStatefulSet(&spec, nil)
+	if err != nil {
+		t.Fatalf("%s: could not generate desired statefulset: %v", testName, err)
+	}
+	if desired.Spec.Template.Spec.ServiceAccountName != "postgres-workload-identity" {
+		t.Errorf("%s: expected the service account from the manifest, got %q", testName, desired.Spec.Template.Spec.ServiceAccountName)
+	}
+
+	cl.Statefulset = current
+	cmp := cl.compareStatefulSetWith(desired)
+	if cmp.match {
+		t.Errorf("%s: expected the changed service account to be detected", testName)
+	}
+	if !cmp.rollingUpdate {
+		t.Errorf("%s: expected a rolling update of the pods", testName)
+	}
+	if cmp.replace {
+		t.Errorf("%s: changing the service account should not replace the statefulset", testName)
+	}
+	cl.Statefulset = nil
+}
+
+func TestCompareStatefulSetClone(t *testing.T) {
+	testName := "TestCompareStatefulSetClone"
+	spec := acidv1.PostgresSpec{
+		TeamID: "myapp", NumberOfInstances: 1,
+		Resources: acidv1.Resources{
+			ResourceRequests: acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+			ResourceLimits:   acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+		},
+		Volume: acidv1.Volume{
+			Size: "1G",
+		},
+		Clone: &acidv1.CloneDescription{
+			ClusterName:  "acid-source-cluster",
+			EndTimestamp: "2020-02-04T12:49:03+00:00",
+			S3WalPath:    "s3://bucket/spilo/acid-source-cluster/wal/",
+		},
+	}
+
+	current, err := cl.generateStatefulSet(&spec, nil)
+	if err != nil {
+		t.Fatalf("%s: could not generate current statefulset: %v", testName, err)
+	}
+	env := current.Spec.Template.Spec.Containers[0].Env
+	found := false
+	for _, envVar := range env {
+		if envVar.Name == "CLONE_SCOPE" && envVar.Value == "acid-source-cluster" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("%s: expected the clone source in the environment of the new cluster, got %v", testName, env)
+	}
+
+	// a changed clone section of the running cluster does not roll the pods
+	spec.Clone = &acidv1.CloneDescription{
+		ClusterName:  "acid-other-cluster",
+		EndTimestamp: "2021-02-04T12:49:03+00:00",
+	}
+	desired, err := cl.generateStatefulSet(&spec, nil)
+	if err != nil {
+		t.Fatalf("%s: could not generate desired statefulset: %v", testName, err)
+	}
+
+	cl.Statefulset = current
+	cmp := cl.compareStatefulSetWith(desired)
+	if !cmp.match || cmp.rollingUpdate {
+		t.Errorf("%s: expected the changed clone section to be ignored (reasons: %v)", testName, cmp.reasons)
+	}
+	cl.Statefulset = nil
+
+	// only the clone variables of the Postgres container are ignored, a sidecar may use the prefix as well
+	sidecar := v1.Container{Name: "sidecar", Env: []v1.EnvVar{{Name: "CLONE_TOKEN", Value: "old"}}}
+	changedSidecar := v1.Container{Name: "sidecar", Env: []v1.EnvVar{{Name: "CLONE_TOKEN", Value: "new"}}}
+	if rollUpdate, reasons := cl.compareContainers("containers", []v1.Container{sidecar}, []v1.Container{changedSidecar}, false, nil); !rollUpdate {
+		t.Errorf("%s: expected the changed variable of the sidecar to roll the pods (reasons: %v)", testName, reasons)
+	}
+	if removed := removedEnvVars(sidecar, v1.Container{Name: "sidecar"}); len(removed) != 1 || removed[0] != "CLONE_TOKEN" {
+		t.Errorf("%s: expected the removed variable of the sidecar to be reported, got %v", testName, removed)
+	}
+}
+
+func TestCompareStatefulSetPreStopSwitchover(t *testing.T) {
+	testName := "TestCompareStatefulSetPreStopSwitchover"
+	spec := acidv1.PostgresSpec{
+		TeamID: "myapp", NumberOfInstances: 1,
+		Resources: acidv1.Resources{
+			ResourceRequests: acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+			ResourceLimits:   acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+		},
+		Volume: acidv1.Volume{
+			Size: "1G",
+		},
+	}
+
+	current, err := cl.generateStatefulSet(&spec, nil)
+	if err != nil {
+		t.Fatalf("%s: could not generate current statefulset: %v", testName, err)
+	}
+	if lifecycle := current.Spec.Template.Spec.Containers[0].Lifecycle; lifecycle != nil {
+		t.Errorf("%s: expected no lifecycle hooks by default, got %#v", testName, lifecycle)
+	}
+
+	spec.EnablePreStopSwitchover = true
+	desired, err := cl.generateStatefulSet(&spec, nil)
+	if err != nil {
+		t.Fatalf("%s: could not generate desired statefulset: %v", testName, err)
+	}
+	lifecycle := desired.Spec.Template.Spec.Containers[0].Lifecycle
+	if lifecycle == nil || lifecycle.PreStop == nil || lifecycle.PreStop.Exec == nil {
+		t.Fatalf("%s: expected a preStop hook, got %#v", testName, lifecycle)
+	}
+	command := strings.Join(lifecycle.PreStop.Exec.Command, " ")
+	if !strings.Contains(command, "http://localhost:8008/switchover") {
+		t.Errorf("%s: expected the preStop hook to call the Patroni switchover, got %q", testName, command)
+	}
+
+	cl.Statefulset = current
+	cmp := cl.compareStatefulSetWith(desired)
+	if cmp.match || !cmp.rollingUpdate {
+		t.Errorf("%s: expected the added preStop hook to roll the pods", testName)
+	}
+	expectedReason := "new statefulset containers's postgres (index 0) lifecycle hooks do not match the current ones"
+	if !util.SliceContains(cmp.reasons, expectedReason) {
+		t.Errorf("%s: expected reason %q, got %v", testName, expectedReason, cmp.reasons)
+	}
+	cl.Statefulset = nil
+}
+
+func TestCompareStatefulSetTerminationGracePeriod(t *testing.T) {
+	testName := "TestCompareStatefulSetTerminationGracePeriod"
+	spec := acidv1.PostgresSpec{
+		TeamID: "myapp", NumberOfInstances: 1,
+		Resources: acidv1.Resources{
+			ResourceRequests: acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+			ResourceLimits:   acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+		},
+		Volume: acidv1.Volume{
+			Size: "1G",
+		},
+	}
+
+	current, err := cl.generateStatefulSet(&spec, nil)
+	if err != nil {
+		t.Fatalf("%s: could not generate current statefulset: %v", testName, err)
+	}
+	defaultGracePeriod := int64(cl.OpConfig.PodTerminateGracePeriod.Seconds())
+	if gracePeriod := *current.Spec.Template.Spec.TerminationGracePeriodSeconds; gracePeriod != defaultGracePeriod {
+		t.Errorf("%s: expected the grace period %d of the configuration, got %d", testName, defaultGracePeriod, gracePeriod)
+	}
+
+	gracePeriod := int64(900)
+	spec.TerminationGracePeriodSeconds = &gracePeriod
+	desired, err := cl.generateStatefulSet(&spec, nil)
+	if err != nil {
+		t.Fatalf("%s: could not generate desired statefulset: %v", testName, err)
+	}
+	if *desired.Spec.Template.Spec.TerminationGracePeriodSeconds != gracePeriod {
+		t.Errorf("%s: expected the grace period %d of the manifest, got %d",
+			testName, gracePeriod, *desired.Spec.Template.Spec.TerminationGracePeriodSeconds)
+	}
+
+	cl.Statefulset = current
+	cmp := cl.compareStatefulSetWith(desired)
+	if cmp.match || !cmp.rollingUpdate {
+		t.Errorf("%s: expected the changed grace period to roll the pods", testName)
+	}
+	expectedReason := "new statefulset's terminationGracePeriodSeconds does not match the current one"
+	if !util.SliceContains(cmp.reasons, expectedReason) {
+		t.Errorf("%s: expected reason %q, got %v", testName, expectedReason, cmp.reasons)
+	}
+	cl.Statefulset = nil
+}
+
+func TestCompareStatefulSetNodeSelector(t *testing.T) {
+	testName := "TestCompareStatefulSetNodeSelector"
+	spec := acidv1.PostgresSpec{
+		TeamID: "myapp", NumberOfInstances: 1,
+		Resources: acidv1.Resources{
+			ResourceRequests: acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+			ResourceLimits:   acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+		},
+		Volume: acidv1.Volume{
+			Size: "1G",
+		},
+		NodeSelector: map[string]string{"pool": "default"},
+	}
+
+	current, err := cl.generateStatefulSet(&spec, nil)
+	if err != nil {
+		t.Fatalf("%s: could not generate current statefulset: %v", testName, err)
+	}
+	if !reflect.DeepEqual(current.Spec.Template.Spec.NodeSelector, spec.NodeSelector) {
+		t.Errorf("%s: expected node selector %v, got %v", testName, spec.NodeSelector, current.Spec.Template.Spec.NodeSelector)
+	}
+
+	spec.NodeSelector = map[string]string{"pool": "database"}
+	desired, err := cl.generateStatefulSet(&spec, nil)
+	if err != nil {
+		t.Fatalf("%s: could not generate desired statefulset: %v", testName, err)
+	}
+
+	cl.Statefulset = current
+	cmp := cl.compareStatefulSetWith(desired)
+	if cmp.match || !cmp.rollingUpdate || cmp.replace {
+		t.Errorf("%s: expected the changed node selector to roll the pods without replacing the statefulset", testName)
+	}
+	expectedReason := "new statefulset's pod node selector does not match the current one"
+	if !util.SliceContains(cmp.reasons, expectedReason) {
+		t.Errorf("%s: expected reason %q, got %v", testName, expectedReason, cmp.reasons)
+	}
+
+	// removing the node selector rolls the pods as well
+	spec.NodeSelector = nil
+	if desired, err = cl.generateStatefulSet(&spec, nil); err != nil {
+		t.Fatalf("%s: could not generate desired statefulset: %v", testName, err)
+	}
+	if cmp = cl.compareStatefulSetWith(desired); !cmp.rollingUpdate {
+		t.Errorf("%s: expected the removed node selector to roll the pods", testName)
+	}
+	cl.Statefulset = nil
+}
+
+func TestCompareStatefulSetImagePullSecrets(t *testing.T) {
+	testName := "TestCompareStatefulSetImagePullSecrets"
+	spec := acidv1.PostgresSpec{
+		TeamID: "myapp", NumberOfInstances: 1,
+		Resources: acidv1.Resources{
+			ResourceRequests: acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+			ResourceLimits:   acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+		},
+		Volume: acidv1.Volume{
+			Size: "1G",
+		},
+		ImagePullSecrets: []v1.LocalObjectReference{{Name: "registry-old"}},
+	}
+
+	current, err := cl.generateStatefulSet(&spec, nil)
+	if err != nil {
+		t.Fatalf("%s: could not generate current statefulset: %v", testName, err)
+	}
+	if !reflect.DeepEqual(current.Spec.Template.Spec.ImagePullSecrets, spec.ImagePullSecrets) {
+		t.Errorf("%s: expected image pull secrets %v, got %v", testName, spec.ImagePullSecrets, current.Spec.Template.Spec.ImagePullSecrets)
+	}
+
+	spec.ImagePullSecrets = []v1.LocalObjectReference{{Name: "registry-new"}}
+	desired, err := cl.generateStatefulSet(&spec, nil)
+	if err != nil {
+		t.Fatalf("%s: could not generate desired statefulset: %v", testName, err)
+	}
+
+	cl.Statefulset = current
+	cmp := cl.compareStatefulSetWith(desired)
+	if cmp.match || cmp.rollingUpdate || cmp.replace {
+		t.Errorf("%s: expected the changed image pull secrets to update the statefulset without rolling the pods", testName)
+	}
+	expectedReason := "new statefulset's image pull secrets do not match the current ones"
+	if !util.SliceContains(cmp.reasons, expectedReason) {
+		t.Errorf("%s: expected reason %q, got %v", testName, expectedReason, cmp.reasons)
+	}
+
+	spec.ImagePullSecrets = nil
+	if desired, err = cl.generateStatefulSet(&spec, nil); err != nil {
+		t.Fatalf("%s: could not generate desired statefulset: %v", testName, err)
+	}
+	if cmp = cl.compareStatefulSetWith(desired); cmp.match {
+		t.Errorf("%s: expected the removed image pull secrets to update the statefulset", testName)
+	}
+	cl.Statefulset = nil
+}
+
+func TestCompareStatefulSetProbes(t *testing.T) {
+	testName := "TestCompareStatefulSetProbes"
+	spec := acidv1.PostgresSpec{
+		TeamID: "myapp", NumberOfInstances: 1,
+		Resources: acidv1.Resources{
+			ResourceRequests: acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+			ResourceLimits:   acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+		},
+		Volume: acidv1.Volume{
+			Size: "1G",
+		},
+		ReadinessProbe: &acidv1.Probe{InitialDelaySeconds: 30},
+	}
+
+	current, err := cl.generateStatefulSet(&spec, nil)
+	if err != nil {
+		t.Fatalf("%s: could not generate current statefulset: %v", testName, err)
+	}
+	probe := current.Spec.Template.Spec.Containers[0].ReadinessProbe
+	if probe == nil || probe.HTTPGet == nil || probe.HTTPGet.Path != "/readiness" || probe.InitialDelaySeconds != 30 || probe.PeriodSeconds != 10 {
+		t.Errorf("%s: expected a readiness probe against the Patroni API with a delay of 30 seconds, got %#v", testName, probe)
+	}
+	if current.Spec.Template.Spec.Containers[0].LivenessProbe != nil {
+		t.Errorf("%s: expected no liveness probe when none is defined", testName)
+	}
+
+	spec.ReadinessProbe = &acidv1.Probe{InitialDelaySeconds: 300}
+	desired, err := cl.generateStatefulSet(&spec, nil)
+	if err != nil {
+		t.Fatalf("%s: could not generate desired statefulset: %v", testName, err)
+	}
+
+	cl.Statefulset = current
+	cmp := cl.compareStatefulSetWith(desired)
+	if cmp.match || !cmp.rollingUpdate || cmp.replace {
+		t.Errorf("%s: expected the changed readiness probe delay to roll the pods without replacing the statefulset", testName)
+	}
+	expectedReason := "new statefulset's postgres container readiness probe does not match the current one"
+	if !util.SliceContains(cmp.reasons, expectedReason) {
+		t.Errorf("%s: expected reason %q, got %v", testName, expectedReason, cmp.reasons)
+	}
+
+	// the probe of an unchanged spec compares equal, so it does not roll the pods on every sync
+	if cmp = cl.compareStatefulSetWith(current); !cmp.match {
+		t.Errorf("%s: expected an unchanged probe to match, reasons: %v", testName, cmp.reasons)
+	}
+
+	// a startup probe for a slow start rolls the pods as well
+	spec.ReadinessProbe = &acidv1.Probe{InitialDelaySeconds: 30}
+	spec.StartupProbe = &acidv1.Probe{PeriodSeconds: 10, FailureThreshold: 360}
+	desired, err = cl.generateStatefulSet(&spec, nil)
+	if err != nil {
+		t.Fatalf("%s: could not generate desired statefulset: %v", testName, err)
+	}
+	probe = desired.Spec.Template.Spec.Containers[0].StartupProbe
+	if probe == nil || probe.HTTPGet == nil || probe.HTTPGet.Path != "/liveness" || probe.FailureThreshold != 360 {
+		t.Errorf("%s: expected a startup probe against the Patroni API with 360 failures allowed, got %#v", testName, probe)
+	}
+	cmp = cl.compareStatefulSetWith(desired)
+	if cmp.match || !cmp.rollingUpdate || cmp.replace {
+		t.Errorf("%s: expected the added startup probe to roll the pods without replacing the statefulset", testName)
+	}
+	expectedReason = "new statefulset's postgres container startup probe does not match the current one"
+	if !util.SliceContains(cmp.reasons, expectedReason) {
+		t.Errorf("%s: expected reason %q, got %v", testName, expectedReason, cmp.reasons)
+	}
+	cl.Statefulset = nil
+}
+
+func TestCompareStatefulSetMetricsExporter(t *testing.T) {
+	testName := "TestCompareStatefulSetMetricsExporter"
+	spec := acidv1.PostgresSpec{
+		TeamID: "myapp", NumberOfInstances: 1,
+		Resources: acidv1.Resources{
+			ResourceRequests: acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+			ResourceLimits:   acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+		},
+		Volume: acidv1.Volume{
+			Size: "1G",
+		},
+		Sidecars: []acidv1.Sidecar{
+			{Name: "exporter", DockerImage: "prometheuscommunity/postgres-exporter:v0.9.0"},
+		},
+		MetricsExporter: &acidv1.MetricsExporter{
+			Sidecar:        "exporter",
+			Port:           9187,
+			ReadinessProbe: &acidv1.Probe{InitialDelaySeconds: 5},
+		},
+	}
+
+	current, err := cl.generateStatefulSet(&spec, nil)
+	if err != nil {
+		t.Fatalf("%s: could not generate current statefulset: %v", testName, err)
+	}
+	exporter := findContainer(current.Spec.Template.Spec.Containers, "exporter")
+	if exporter == nil {
+		t.Fatalf("%s: expected the exporter sidecar in the statefulset", testName)
+	}
+	expectedPorts := []v1.ContainerPort{{Name: "metrics", ContainerPort: 9187, Protocol: v1.ProtocolTCP}}
+	if !reflect.DeepEqual(exporter.Ports, expectedPorts) {
+		t.Errorf("%s: expected exporter ports %#v, got %#v", testName, expectedPorts, exporter.Ports)
+	}
+	probe := exporter.ReadinessProbe
+	if probe == nil || probe.HTTPGet == nil || probe.HTTPGet.Path != "/metrics" || probe.HTTPGet.Port.IntVal != 9187 || probe.InitialDelaySeconds != 5 {
+		t.Errorf("%s: expected a readiness probe against the metrics path, got %#v", testName, probe)
+	}
+	if len(spec.Sidecars[0].Ports) != 0 {
+		t.Errorf("%s: expected the sidecar definition to be left unchanged, got ports %#v", testName, spec.Sidecars[0].Ports)
+	}
+
+	spec.MetricsExporter.ReadinessProbe = &acidv1.Probe{InitialDelaySeconds: 5, PeriodSeconds: 30}
+	desired, err := cl.generateStatefulSet(&spec, nil)
+	if err != nil {
+		t.Fatalf("%s: could not generate desired statefulset: %v", testName, err)
+	}
+
+	oldSpec := cl.Spec
+	cl.Spec = spec
+	cl.Statefulset = current
+	defer func() {
+		cl.Spec = oldSpec
+		cl.Statefulset = nil
+	}()
+
+	cmp := cl.compareStatefulSetWith(desired)
+	if cmp.match || !cmp.rollingUpdate {
+		t.Errorf("%s: expected the changed exporter probe to roll the pods", testName)
+	}
+	expectedReason := "new statefulset's exporter container probes do not match the current ones"
+	if !util.SliceContains(cmp.reasons, expectedReason) {
+		t.Errorf("%s: expected reason %q, got %v", testName, expectedReason, cmp.reasons)
+	}
+
+	// the probes of an unchanged spec compare equal
+	if cmp = cl.compareStatefulSetWith(current); !cmp.match {
+		t.Errorf("%s: expected unchanged exporter probes to match, reasons: %v", testName, cmp.reasons)
+	}
+}
+
+func TestCompareStatefulSetSidecarResources(t *testing.T) {
+	testName := "TestCompareStatefulSetSidecarResources"
+	spec := acidv1.PostgresSpec{
+		TeamID: "myapp", NumberOfInstances: 1,
+		Resources: acidv1.Resources{
+			ResourceRequests: acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+			ResourceLimits:   acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+		},
+		Volume: acidv1.Volume{
+			Size: "1G",
+		},
+		Sidecars: []acidv1.Sidecar{
+			{
+				Name:        "wal-shipper",
+				DockerImage: "wal-shipper:1.0",
+				Resources: acidv1.Resources{
+					ResourceRequests: acidv1.ResourceDescription{CPU: "100m", Memory: "128Mi"},
+					ResourceLimits:   acidv1.ResourceDescription{CPU: "500m", Memory: "256Mi"},
+				},
+			},
+		},
+	}
+
+	current, err := cl.generateStatefulSet(&spec, nil)
+	if err != nil {
+		t.Fatalf("%s: could not generate current statefulset: %v", testName, err)
+	}
+
+	// only the memory limit of the sidecar is raised
+	spec.Sidecars[0].Resources.ResourceLimits.Memory = "512Mi"
+	desired, err := cl.generateStatefulSet(&spec, nil)
+	if err != nil {
+		t.Fatalf("%s: could not generate desired statefulset: %v", testName, err)
+	}
+	sidecar := findContainer(desired.Spec.Template.Spec.Containers, "wal-shipper")
+	if sidecar == nil {
+		t.Fatalf("%s: expected the sidecar in the statefulset", testName)
+	}
+	if limit := sidecar.Resources.Limits[v1.ResourceMemory]; limit.String() != "512Mi" {
+		t.Errorf("%s: expected a memory limit of 512Mi for the sidecar, got %s", testName, limit.String())
+	}
+
+	oldSpec := cl.Spec
+	cl.Spec = spec
+	cl.Statefulset = current
+	defer func() {
+		cl.Spec = oldSpec
+		cl.Statefulset = nil
+	}()
+
+	cmp := cl.compareStatefulSetWith(desired)
+	if cmp.match || !cmp.rollingUpdate || cmp.replace {
+		t.Errorf("%s: expected the changed sidecar resources to roll the pods without replacing the statefulset", testName)
+	}
+	expectedReasons := []string{"new statefulset containers's wal-shipper (index 1) resources do not match the current ones"}
+	if !reflect.DeepEqual(cmp.reasons, expectedReasons) {
+		t.Errorf("%s: expected reasons %v, got %v", testName, expectedReasons, cmp.reasons)
+	}
+
+	// the resources of an unchanged spec compare equal
+	if cmp = cl.compareStatefulSetWith(current); !cmp.match {
+		t.Errorf("%s: expected unchanged sidecar resources to match, reasons: %v", testName, cmp.reasons)
+	}
+}
+
+func TestCompareResources(t *testing.T) {
+	limits := func(memory string) *v1.ResourceRequirements {
+		return &v1.ResourceRequirements{Limits: v1.ResourceList{v1.ResourceMemory: resource.MustParse(memory)}}
+	}
+
+	tests := []struct {
+		about string
+		a     *v1.ResourceRequirements
+		b     *v1.ResourceRequirements
+		equal bool
+	}{
+		{"no resources", nil, &v1.ResourceRequirements{}, true},
+		{"same limits in other units", limits("1Gi"), limits("1024Mi"), true},
+		{"changed limits without requests", limits("256Mi"), limits("512Mi"), false},
+		{"added limits", &v1.ResourceRequirements{}, limits("256Mi"), false},
+		{"removed limits", limits("256Mi"), nil, false},
+	}
+	for _, tt := range tests {
+		if equal := compareResources(tt.a, tt.b); equal != tt.equal {
+			t.Errorf("TestCompareResources %s: expected %t, got %t", tt.about, tt.equal, equal)
+		}
+	}
+}
+
+func TestCompareStatefulSetStorageClass(t *testing.T) {
+	testName := "TestCompareStatefulSetStorageClass"
+	spec := acidv1.PostgresSpec{
+		TeamID: "myapp", NumberOfInstances: 1,
+		Resources: acidv1.Resources{
+			ResourceRequests: acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+			ResourceLimits:   acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+		},
+		Volume: acidv1.Volume{
+			Size:         "1G",
+			StorageClass: "standard",
+		},
+	}
+
+	current, err := cl.generateStatefulSet(&spec, nil)
+	if err != nil {
+		t.Fatalf("%s: could not generate current statefulset: %v", testName, err)
+	}
+	spec.Volume.StorageClass = "fast"
+	desired, err := cl.generateStatefulSet(&spec, nil)
+	if err != nil {
+		t.Fatalf("%s: could not generate desired statefulset: %v", testName, err)
+	}
+
+	cl.Statefulset = current
+	if cmp := cl.compareStatefulSetWith(desired); cmp.replace {
+		t.Errorf("%s: expected the changed storage class not to replace the statefulset without the migration annotation, reasons: %v",
+			testName, cmp.reasons)
+	}
+
+	cl.ObjectMeta.Annotations = map[string]string{constants.MigrateStorageClassAnnotationKey: "true"}
+	if cmp := cl.compareStatefulSetWith(desired); !cmp.replace {
+		t.Errorf("%s: expected the changed storage class to replace the statefulset with the migration annotation", testName)
+	}
+	cl.ObjectMeta.Annotations = nil
+	cl.Statefulset = nil
+}
+
+func TestCompareStatefulSetTolerations(t *testing.T) {
+	testName := "TestCompareStatefulSetTolerations"
+	dedicated := v1.Toleration{Key: "dedicated", Operator: v1.TolerationOpEqual, Value: "postgres", Effect: v1.TaintEffectNoSchedule}
+	spot := v1.Toleration{Key: "spot", Operator: v1.TolerationOpExists, Effect: v1.TaintEffectNoSchedule}
+	spec := acidv1.PostgresSpec{
+		TeamID: "myapp", NumberOfInstances: 1,
+		Resources: acidv1.Resources{
+			ResourceRequests: acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+			ResourceLimits:   acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+		},
+		Volume: acidv1.Volume{
+			Size: "1G",
+		},
+		Tolerations: []v1.Toleration{dedicated},
+	}
+
+	current, err := cl.generateStatefulSet(&spec, nil)
+	if err != nil {
+		t.Fatalf("%s: could not generate current statefulset: %v", testName, err)
+	}
+	cl.Statefulset = current
+	defer func() { cl.Statefulset = nil }()
+
+	spec.Tolerations = []v1.Toleration{dedicated, spot}
+	desired, err := cl.generateStatefulSet(&spec, nil)
+	if err != nil {
+		t.Fatalf("%s: could not generate desired statefulset: %v", testName, err)
+	}
+	cmp := cl.compareStatefulSetWith(desired)
+	if cmp.match || !cmp.rollingUpdate {
+		t.Errorf("%s: expected the added toleration to roll the pods", testName)
+	}
+	expectedReason := "new statefulset's pod tolerations do not match the current ones"
+	if !util.SliceContains(cmp.reasons, expectedReason) {
+		t.Errorf("%s: expected reason %q, got %v", testName, expectedReason, cmp.reasons)
+	}
+
+	// neither the order nor the tolerations added by Kubernetes make a difference
+	tolerationSeconds := int64(300)
+	cl.Statefulset = desired.DeepCopy()
+	cl.Statefulset.Spec.Template.Spec.Tolerations = []v1.Toleration{
+		spot,
+		{Key: v1.TaintNodeNotReady, Operator: v1.TolerationOpExists, Effect: v1.TaintEffectNoExecute, TolerationSeconds: &tolerationSeconds},
+		dedicated,
+		{Key: v1.TaintNodeUnreachable, Operator: v1.TolerationOpExists, Effect: v1.TaintEffectNoExecute, TolerationSeconds: &tolerationSeconds},
+	}
+	if cmp = cl.compareStatefulSetWith(desired); !cmp.match {
+		t.Errorf("%s: expected reordered and default tolerations to match, got %v", testName, cmp.reasons)
+	}
+}
+
+func TestCompareStatefulSetDNS(t *testing.T) {
+	testName := "TestCompareStatefulSetDNS"
+	spec := acidv1.PostgresSpec{
+		TeamID: "myapp", NumberOfInstances: 1,
+		Resources: acidv1.Resources{
+			ResourceRequests: acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+			ResourceLimits:   acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+		},
+		Volume: acidv1.Volume{
+			Size: "1G",
+		},
+	}
+	ndots := "2"
+	dnsConfig := &v1.PodDNSConfig{
+		Searches: []string{"svc.other-cluster.local"},
+		Options:  []v1.PodDNSConfigOption{{Name: "ndots", Value: &ndots}},
+	}
+
+	current, err := cl.generateStatefulSet(&spec, nil)
+	if err != nil {
+		t.Fatalf("%s: could not generate current statefulset: %v", testName, err)
+	}
+	// the API server sets the default DNS policy, which must not count as a change
+	current.Spec.Template.Spec.DNSPolicy = v1.DNSClusterFirst
+
+	spec.DNSConfig = dnsConfig
+	desired, err := cl.generateStatefulSet(&spec, nil)
+	if err != nil {
+		t.Fatalf("%s: could not generate desired statefulset: %v", testName, err)
+	}
+	if !reflect.DeepEqual(desired.Spec.Template.Spec.DNSConfig, dnsConfig) {
+		t.Errorf("%s: expected DNS config %#v in the pod template, got %#v", testName, dnsConfig, desired.Spec.Template.Spec.DNSConfig)
+	}
+
+	cl.Statefulset = current
+	cmp := cl.compareStatefulSetWith(desired)
+	if cmp.match {
+		t.Errorf("%s: expected the changed DNS config to be detected", testName)
+	}
+	if !cmp.rollingUpdate {
+		t.Errorf("%s: expected a rolling update of the pods", testName)
+	}
+	if cmp.replace {
+		t.Errorf("%s: changing the DNS config should not replace the statefulset", testName)
+	}
+
+	cl.Statefulset = desired
+	cmp = cl.compareStatefulSetWith(desired)
+	if !cmp.match {
+		t.Errorf("%s: expected an unchanged DNS config to match (reasons: %v)", testName, cmp.reasons)
+	}
+	cl.Statefulset = nil
+}
+
+func TestCompareStatefulSetHostAliases(t *testing.T) {
+	testName := "TestCompareStatefulSetHostAliases"
+	spec := acidv1.PostgresSpec{
+		TeamID: "myapp", NumberOfInstances: 1,
+		Resources: acidv1.Resources{
+			ResourceRequests: acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+			ResourceLimits:   acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+		},
+		Volume: acidv1.Volume{
+			Size: "1G",
+		},
+	}
+	hostAliases := []v1.HostAlias{{IP: "10.2.3.4", Hostnames: []string{"legacy-db", "legacy-db.example.org"}}}
+
+	current, err := cl.generateStatefulSet(&spec, nil)
+	if err != nil {
+		t.Fatalf("%s: could not generate current statefulset: %v", testName, err)
+	}
+
+	spec.HostAliases = hostAliases
+	desired, err := cl.generateStatefulSet(&spec, nil)
+	if err != nil {
+		t.Fatalf("%s: could not generate desired statefulset: %v", testName, err)
+	}
+	if !reflect.DeepEqual(desired.Spec.Template.Spec.HostAliases, hostAliases) {
+		t.Errorf("%s: expected host aliases %#v in the pod template, got %#v", testName, hostAliases, desired.Spec.Template.Spec.HostAliases)
+	}
+
+	cl.Statefulset = current
+	cmp := cl.compareStatefulSetWith(desired)
+	if cmp.match {
+		t.Errorf("%s: expected the added host alias to be detected", testName)
+	}
+	if !cmp.rollingUpdate {
+		t.Errorf("%s: expected a rolling update of the pods", testName)
+	}
+	if cmp.replace {
+		t.Errorf("%s: adding a host alias should not replace the statefulset", testName)
+	}
+
+	cl.Statefulset = desired
+	cmp = cl.compareStatefulSetWith(desired)
+	if !cmp.match {
+		t.Errorf("%s: expected unchanged host aliases to match (reasons: %v)", testName, cmp.reasons)
+	}
+	cl.Statefulset = nil
+}
+
+func TestCompareStatefulSetContainerArgs(t *testing.T) {
+	testName := "TestCompareStatefulSetContainerArgs"
+	spec := acidv1.PostgresSpec{
+		TeamID: "myapp", NumberOfInstances: 1,
+		Resources: acidv1.Resources{
+			ResourceRequests: acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+			ResourceLimits:   acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+		},
+		Volume: acidv1.Volume{
+			Size: "1G",
+		},
+	}
+	args := []string{"/bin/sh", "-c", "/scripts/wrapper.sh && exec /bin/sh /launch.sh init"}
+
+	current, err := cl.generateStatefulSet(&spec, nil)
+	if err != nil {
+		t.Fatalf("%s: could not generate current statefulset: %v", testName, err)
+	}
+
+	spec.Args = args
+	desired, err := cl.generateStatefulSet(&spec, nil)
+	if err != nil {
+		t.Fatalf("%s: could not generate desired statefulset: %v", testName, err)
+	}
+	container := desired.Spec.Template.Spec.Containers[0]
+	if container.Command != nil {
+		t.Errorf("%s: expected the command of the image to be kept, got %#v", testName, container.Command)
+	}
+	if !reflect.DeepEqual(container.Args, args) {
+		t.Errorf("%s: expected args %#v of the Postgres container, got %#v", testName, args, container.Args)
+	}
+	if !referencesSpiloEntrypoint(container.Command, container.Args) {
+		t.Errorf("%s: expected the args to reference the Spilo entrypoint", testName)
+	}
+
+	cl.Statefulset = current
+	cmp := cl.compareStatefulSetWith(desired)
+	if cmp.match {
+		t.Errorf("%s: expected the overridden args to be detected", testName)
+	}
+	if !cmp.rollingUpdate {
+		t.Errorf("%s: expected a rolling update of the pods", testName)
+	}
+
+	cl.Statefulset = desired
+	cmp = cl.compareStatefulSetWith(desired)
+	if !cmp.match {
+		t.Errorf("%s: expected unchanged args to match (reasons: %v)", testName, cmp.reasons)
+	}
+	cl.Statefulset = nil
+
+	if referencesSpiloEntrypoint([]string{"/scripts/wrapper.sh"}, nil) {
+		t.Errorf("%s: expected a command without the Spilo entrypoint to be reported", testName)
+	}
+}
+
+func TestCompareStatefulSetRemovedEnvVars(t *testing.T) {
+	testName := "TestCompareStatefulSetRemovedEnvVars"
+	spec := acidv1.PostgresSpec{
+		TeamID: "myapp", NumberOfInstances: 1,
+		Resources: acidv1.Resources{
+			ResourceRequests: acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+			ResourceLimits:   acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+		},
+		Volume: acidv1.Volume{
+			Size: "1G",
+		},
+		Env: []v1.EnvVar{
+			{Name: "CUSTOM_FOO", Value: "foo"},
+			{Name: "CUSTOM_BAR", Value: "bar"},
+		},
+	}
+
+	current, err := cl.generateStatefulSet(&spec, nil)
+	if err != nil {
+		t.Fatalf("%s: could not generate current statefulset: %v", testName, err)
+	}
+
+	spec.Env = []v1.EnvVar{{Name: "CUSTOM_FOO", Value: "foo"}}
+	desired, err := cl.generateStatefulSet(&spec, nil)
+	if err != nil {
+		t.Fatalf("%s: could not generate desired statefulset: %v", testName, err)
+	}
+	for _, envVar := range desired.Spec.Template.Spec.Containers[0].Env {
+		if envVar.Name == "CUSTOM_BAR" {
+			t.Errorf("%s: expected the removed variable to be excluded from the pod template", testName)
+		}
+	}
+
+	cl.Statefulset = current
+	cmp := cl.compareStatefulSetWith(desired)
+	if cmp.match || !cmp.rollingUpdate {
+		t.Errorf("%s: expected a rolling update to drop the removed variable", testName)
+	}
+	expectedReason := "new statefulset containers's postgres (index 0) environment drops the variables CUSTOM_BAR"
+	if !util.SliceContains(cmp.reasons, expectedReason) {
+		t.Errorf("%s: expected reason %q, got %v", testName, expectedReason, cmp.reasons)
+	}
+
+	cl.Statefulset = desired
+	cmp = cl.compareStatefulSetWith(desired)
+	if !cmp.match {
+		t.Errorf("%s: expected the unchanged environment to match (reasons: %v)", testName, cmp.reasons)
+	}
+	cl.Statefulset = nil
+}
+
+func TestCompareStatefulSetTLSSecret(t *testing.T) {
+	testName := "TestCompareStatefulSetTLSSecret"
+	spec := acidv1.PostgresSpec{
+		TeamID: "myapp", NumberOfInstances: 1,
+		Resources: acidv1.Resources{
+			ResourceRequests: acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+			ResourceLimits:   acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+		},
+		Volume: acidv1.Volume{
+			Size: "1G",
+		},
+		TLS: &acidv1.TLSDescription{SecretName: "acid-test-tls"},
+	}
+
+	current, err := cl.generateStatefulSet(&spec, nil)
+	if err != nil {
+		t.Fatalf("%s: could not generate current statefulset: %v", testName, err)
+	}
+	spec.TLS = &acidv1.TLSDescription{SecretName: "acid-test-tls-renewed"}
+	desired, err := cl.generateStatefulSet(&spec, nil)
+	if err != nil {
+		t.Fatalf("%s: could not generate desired statefulset: %v", testName, err)
+	}
+
+	cl.Statefulset = current
+	cmp := cl.compareStatefulSetWith(desired)
+	if cmp.match {
+		t.Errorf("%s: expected the replaced TLS secret to be detected", testName)
+	}
+	if !cmp.rollingUpdate {
+		t.Errorf("%s: expected a rolling update of the pods", testName)
+	}
+	cl.Statefulset = nil
+}
+
+func TestCompareStatefulSetAdditionalVolumes(t *testing.T) {
+	testName := "TestCompareStatefulSetAdditionalVolumes"
+	spec := acidv1.PostgresSpec{
+		TeamID: "myapp", NumberOfInstances: 1,
+		Resources: acidv1.Resources{
+			ResourceRequests: acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+			ResourceLimits:   acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+		},
+		Volume: acidv1.Volume{
+			Size: "1G",
+		},
+	}
+
+	current, err := cl.generateStatefulSet(&spec, nil)
+	if err != nil {
+		t.Fatalf("%s: could not generate current statefulset: %v", testName, err)
+	}
+	spec.AdditionalVolumes = []acidv1.AdditionalVolume{
+		{
+			Name:      "ca-bundle",
+			MountPath: "/etc/ssl/ca-bundle",
+			VolumeSource: v1.VolumeSource{
+				ConfigMap: &v1.ConfigMapVolumeSource{
+					LocalObjectReference: v1.LocalObjectReference{Name: "ca-bundle"},
+				},
+			},
+		},
+	}
+	desired, err := cl.generateStatefulSet(&spec, nil)
+	if err != nil {
+		t.Fatalf("%s: could not generate desired statefulset: %v", testName, err)
+	}
+
+	cl.Statefulset = current
+	cmp := cl.compareStatefulSetWith(desired)
+	if cmp.match {
+		t.Errorf("%s: expected the added configmap volume to be detected", testName)
+	}
+	if !cmp.rollingUpdate {
+		t.Errorf("%s: expected a rolling update of the pods", testName)
+	}
+	expectedReasons := []string{
+		"new statefulset's volumes do not match the current ones",
+		"new statefulset containers's postgres (index 0) volume mounts do not match the current ones",
+	}
+	for _, reason := range expectedReasons {
+		if !util.SliceContains(cmp.reasons, reason) {
+			t.Errorf("%s: expected reason %q, got %v", testName, reason, cmp.reasons)
+		}
+	}
+
+	cl.Statefulset = desired
+	if cmp = cl.compareStatefulSetWith(desired); !cmp.match {
+		t.Errorf("%s: expected unchanged volumes to match (reasons: %v)", testName, cmp.reasons)
+	}
+	cl.Statefulset = nil
+}
+
+func TestCompareStatefulSetSecurityContext(t *testing.T) {
+	testName := "TestCompareStatefulSetSecurityContext"
+	runAsUser := int64(101)
+	fsGroup := int64(103)
+	spec := acidv1.PostgresSpec{
+		TeamID: "myapp", NumberOfInstances: 1,
+		Resources: acidv1.Resources{
+			ResourceRequests: acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+			ResourceLimits:   acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+		},
+		Volume: acidv1.Volume{
+			Size: "1G",
+		},
+		SpiloRunAsUser: &runAsUser,
+		SpiloFSGroup:   &fsGroup,
+	}
+
+	current, err := cl.generateStatefulSet(&spec, nil)
+	if err != nil {
+		t.Fatalf("%s: could not generate current statefulset: %v", testName, err)
+	}
+	newRunAsUser := int64(1001)
+	spec.SpiloRunAsUser = &newRunAsUser
+	desired, err := cl.generateStatefulSet(&spec, nil)
+	if err != nil {
+		t.Fatalf("%s: could not generate desired statefulset: %v", testName, err)
+	}
+
+	cl.Statefulset = current
+	cmp := cl.compareStatefulSetWith(desired)
+	if cmp.match {
+		t.Errorf("%s: expected the changed runAsUser to be detected", testName)
+	}
+	if !cmp.rollingUpdate {
+		t.Errorf("%s: expected a rolling update of the pods", testName)
+	}
+	expectedReason := "new statefulset's pod template security context (runAsUser) does not match the current one"
+	if !util.SliceContains(cmp.reasons, expectedReason) {
+		t.Errorf("%s: expected reason %q, got %v", testName, expectedReason, cmp.reasons)
+	}
+
+	cl.Statefulset = desired
+	cmp = cl.compareStatefulSetWith(desired)
+	if !cmp.match {
+		t.Errorf("%s: expected an unchanged security context to match (reasons: %v)", testName, cmp.reasons)
+	}
+	cl.Statefulset = nil
+}
+
+func TestCompareStatefulSetFSGroupChangePolicy(t *testing.T) {
+	testName := "TestCompareStatefulSetFSGroupChangePolicy"
+	fsGroup := int64(103)
+	spec := acidv1.PostgresSpec{
+		TeamID: "myapp", NumberOfInstances: 1,
+		Resources: acidv1.Resources{
+			ResourceRequests: acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+			ResourceLimits:   acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+		},
+		Volume: acidv1.Volume{
+			Size: "1G",
+		},
+		SpiloFSGroup: &fsGroup,
+	}
+
+	current, err := cl.generateStatefulSet(&spec, nil)
+	if err != nil {
+		t.Fatalf("%s: could not generate current statefulset: %v", testName, err)
+	}
+	if current.Spec.Template.Spec.SecurityContext.FSGroupChangePolicy != nil {
+		t.Errorf("%s: expected no fsGroupChangePolicy by default", testName)
+	}
+
+	spec.SpiloFSGroupChangePolicy = v1.FSGroupChangeOnRootMismatch
+	desired, err := cl.generateStatefulSet(&spec, nil)
+	if err != nil {
+		t.Fatalf("%s: could not generate desired statefulset: %v", testName, err)
+	}
+	policy := desired.Spec.Template.Spec.SecurityContext.FSGroupChangePolicy
+	if policy == nil || *policy != v1.FSGroupChangeOnRootMismatch {
+		t.Errorf("%s: expected fsGroupChangePolicy %q, got %v", testName, v1.FSGroupChangeOnRootMismatch, policy)
+	}
+
+	cl.Statefulset = current
+	cmp := cl.compareStatefulSetWith(desired)
+	if cmp.match {
+		t.Errorf("%s: expected the changed fsGroupChangePolicy to be detected", testName)
+	}
+	expectedReason := "new statefulset's pod template security context (fsGroupChangePolicy) does not match the current one"
+	if !util.SliceContains(cmp.reasons, expectedReason) {
+		t.Errorf("%s: expected reason %q, got %v", testName, expectedReason, cmp.reasons)
+	}
+
+	cl.Statefulset = desired
+	cmp = cl.compareStatefulSetWith(desired)
+	if !cmp.match {
+		t.Errorf("%s: expected an unchanged fsGroupChangePolicy to match (reasons: %v)", testName, cmp.reasons)
+	}
+	cl.Statefulset = nil
+}
+
+func TestCompareStatefulSetPodAntiAffinity(t *testing.T) {
+	testName := "TestCompareStatefulSetPodAntiAffinity"
+	spec := acidv1.PostgresSpec{
+		TeamID: "myapp", NumberOfInstances: 2,
+		Resources: acidv1.Resources{
+			ResourceRequests: acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+			ResourceLimits:   acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+		},
+		Volume: acidv1.Volume{
+			Size: "1G",
+		},
+	}
+
+	current, err := cl.generateStatefulSet(&spec, nil)
+	if err != nil {
+		t.Fatalf("%s: could not generate current statefulset: %v", testName, err)
+	}
+
+	enablePodAntiAffinity := true
+	spec.EnablePodAntiAffinity = &enablePodAntiAffinity
+	spec.PodAntiAffinityTopologyKey = "topology.kubernetes.io/zone"
+	desired, err := cl.generateStatefulSet(&spec, nil)
+	if err != nil {
+		t.Fatalf("%s: could not generate desired statefulset: %v", testName, err)
+	}
+
+	affinity := desired.Spec.Template.Spec.Affinity
+	if affinity == nil || affinity.PodAntiAffinity == nil {
+		t.Fatalf("%s: expected pod anti-affinity in the pod template", testName)
+	}
+	terms := affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	if len(terms) != 1 {
+		t.Fatalf("%s: expected one required anti-affinity term, got %d", testName, len(terms))
+	}
+	if terms[0].TopologyKey != "topology.kubernetes.io/zone" {
+		t.Errorf("%s: expected topology key %q, got %q", testName, "topology.kubernetes.io/zone", terms[0].TopologyKey)
+	}
+	if !reflect.DeepEqual(terms[0].LabelSelector.MatchLabels, cl.labelsSet(true)) {
+		t.Errorf("%s: expected the anti-affinity to select the cluster pods, got %v", testName, terms[0].LabelSelector.MatchLabels)
+	}
+
+	cl.Statefulset = current
+	cmp := cl.compareStatefulSetWith(desired)
+	if cmp.match {
+		t.Errorf("%s: expected the enabled pod anti-affinity to be detected", testName)
+	}
+	if !cmp.rollingUpdate {
+		t.Errorf("%s: expected a rolling update of the pods", testName)
+	}
+
+	// a changed topology key rolls the pods as well
+	cl.Statefulset = desired
+	spec.PodAntiAffinityTopologyKey = "kubernetes.io/hostname"
+	changed, err := cl.generateStatefulSet(&spec, nil)
+	if err != nil {
+		t.Fatalf("%s: could not generate changed statefulset: %v", testName, err)
+	}
+	cmp = cl.compareStatefulSetWith(changed)
+	if cmp.match || !cmp.rollingUpdate {
+		t.Errorf("%s: expected the changed topology key to roll the pods", testName)
+	}
+	cl.Statefulset = nil
+}
+
 func TestInitRobotUsers(t *testing.T) {
 	testName := "TestInitRobotUsers"
 	tests := []struct {
@@ -127,6 +1382,85 @@ func TestInitRobotUsers(t *testing.T) {
 	}
 }
 
+func TestInitMonitoringUser(t *testing.T) {
+	testName := "TestInitMonitoringUser"
+	defer func() { cl.Spec.EnableMonitoringRole = false }()
+
+	// nothing is added unless enabled
+	cl.pgUsers = map[string]spec.PgUser{}
+	cl.initMonitoringUser()
+	if len(cl.pgUsers) != 0 {
+		t.Errorf("%s expected no monitoring role, got %#v", testName, cl.pgUsers)
+	}
+
+	cl.Spec.EnableMonitoringRole = true
+	cl.initMonitoringUser()
+	user, ok := cl.pgUsers[constants.MonitoringUserName]
+	if !ok {
+		t.Fatalf("%s expected the monitoring role, got %#v", testName, cl.pgUsers)
+	}
+	if user.Password == "" || !reflect.DeepEqual(user.Flags, []string{constants.RoleFlagLogin}) ||
+		!reflect.DeepEqual(user.MemberOf, []string{constants.MonitoringRoleName}) {
+		t.Errorf("%s expected a login role with a password and pg_monitor membership, got %#v", testName, user)
+	}
+
+	// a manifest role of the same name keeps its flags
+	manifestRole := spec.PgUser{Origin: spec.RoleOriginManifest, Name: constants.MonitoringUserName,
+		Password: "foo", Flags: []string{constants.RoleFlagLogin, constants.RoleFlagCreateDB}}
+	cl.pgUsers = map[string]spec.PgUser{constants.MonitoringUserName: manifestRole}
+	cl.initMonitoringUser()
+	manifestRole.MemberOf = []string{constants.MonitoringRoleName}
+	if !reflect.DeepEqual(cl.pgUsers[constants.MonitoringUserName], manifestRole) {
+		t.Errorf("%s expected %#v, got %#v", testName, manifestRole, cl.pgUsers[constants.MonitoringUserName])
+	}
+}
+
+func TestInitBackupUser(t *testing.T) {
+	testName := "TestInitBackupUser"
+	defer func() { cl.Spec.EnableBackupRole = false }()
+
+	// nothing is added unless enabled
+	cl.pgUsers = map[string]spec.PgUser{}
+	cl.initBackupUser()
+	if len(cl.pgUsers) != 0 {
+		t.Errorf("%s expected no backup role, got %#v", testName, cl.pgUsers)
+	}
+
+	cl.Spec.EnableBackupRole = true
+	cl.initBackupUser()
+	user, ok := cl.pgUsers[constants.BackupUserName]
+	if !ok {
+		t.Fatalf("%s expected the backup role, got %#v", testName, cl.pgUsers)
+	}
+	if user.Password == "" || !reflect.DeepEqual(user.Flags, []string{constants.RoleFlagLogin}) {
+		t.Errorf("%s expected a login role with a password, got %#v", testName, user)
+	}
+
+	// a manifest role of the same name is left untouched
+	manifestRole := spec.PgUser{Origin: spec.RoleOriginManifest, Name: constants.BackupUserName,
+		Password: "foo", Flags: []string{constants.RoleFlagLogin, constants.RoleFlagCreateDB}}
+	cl.pgUsers = map[string]spec.PgUser{constants.BackupUserName: manifestRole}
+	cl.initBackupUser()
+	if !reflect.DeepEqual(cl.pgUsers[constants.BackupUserName], manifestRole) {
+		t.Errorf("%s expected %#v, got %#v", testName, manifestRole, cl.pgUsers[constants.BackupUserName])
+	}
+}
+
+func TestBackupDatabases(t *testing.T) {
+	testName := "TestBackupDatabases"
+	defer func() {
+		cl.Spec.Databases = nil
+		cl.Spec.PreparedDatabases = nil
+	}()
+
+	cl.Spec.Databases = map[string]string{"foo": "foo_owner", "bar": "bar_owner"}
+	cl.Spec.PreparedDatabases = map[string]acidv1.PreparedDatabase{"baz": {}, "foo": {}}
+	expected := []string{"bar", "baz", "foo"}
+	if databases := cl.manifestDatabases(); !reflect.DeepEqual(databases, expected) {
+		t.Errorf("%s expected databases %v, got %v", testName, expected, databases)
+	}
+}
+
 type mockOAuthTokenGetter struct {
 }
 
@@ -845,3 +2179,360 @@ func TestPreparedDatabases(t *testing.T) {
 		}
 	}
 }
+
+type mockPatroni struct {
+	members    []patroni.ClusterMember
+	membersErr error
+	podMembers map[string][]patroni.ClusterMember // view of the cluster of single pods, overrides members
+	pgIdent    []string
+	pgIdentSet int
+	slots      map[string]map[string]string
+	slotsSet   []map[string]map[string]string
+	parameters map[string]string
+	setOptions map[string]string
+	standby    bool
+	promoted   int
+	restarts   map[string]time.Time
+	restartErr error
+	reloads    []string
+	syncMode   patroni.SynchronousMode
+	maxLag     int64
+	hang       bool
+	tlsConfig  *tls.Config
+}
+
+func (m *mockPatroni) Switchover(ctx context.Context, master *v1.Pod, candidate string) error {
+	return nil
+}
+
+func (m *mockPatroni) SetPostgresParameters(ctx context.Context, server *v1.Pod, options map[string]string) error {
+	m.setOptions = options
+	return nil
+}
+
+func (m *mockPatroni) GetPostgresParameters(ctx context.Context, server *v1.Pod) (map[string]string, error) {
+	return m.parameters, nil
+}
+
+func (m *mockPatroni) GetPatroniMemberState(ctx context.Context, pod *v1.Pod) (string, error) {
+	return "running", nil
+}
+
+func (m *mockPatroni) GetClusterMembers(ctx context.Context, server *v1.Pod) ([]patroni.ClusterMember, error) {
+	if members, ok := m.podMembers[server.Name]; ok {
+		return members, nil
+	}
+	return m.members, m.membersErr
+}
+
+func (m *mockPatroni) Reload(ctx context.Context, server *v1.Pod) error {
+	m.reloads = append(m.reloads, server.Name)
+	return nil
+}
+
+func (m *mockPatroni) IsStandbyCluster(ctx context.Context, server *v1.Pod) (bool, error) {
+	if m.hang {
+		<-ctx.Done()
+		return false, ctx.Err()
+	}
+	return m.standby, nil
+}
+
+func (m *mockPatroni) PromoteStandbyCluster(ctx context.Context, server *v1.Pod) error {
+	m.standby = false
+	m.promoted++
+	for i := range m.members {
+		if m.members[i].Role == "standby_leader" {
+			m.members[i].Role = "leader"
+		}
+	}
+	return nil
+}
+
+func (m *mockPatroni) GetSynchronousMode(ctx context.Context, server *v1.Pod) (patroni.SynchronousMode, error) {
+	if m.hang {
+		<-ctx.Done()
+		return patroni.SynchronousMode{}, ctx.Err()
+	}
+	return m.syncMode, nil
+}
+
+func (m *mockPatroni) SetSynchronousMode(ctx context.Context, server *v1.Pod, mode patroni.SynchronousMode) error {
+	m.syncMode = mode
+	return nil
+}
+
+func (m *mockPatroni) GetMaximumLagOnFailover(ctx context.Context, server *v1.Pod) (int64, error) {
+	return m.maxLag, nil
+}
+
+func (m *mockPatroni) SetMaximumLagOnFailover(ctx context.Context, server *v1.Pod, maxLag int64) error {
+	m.maxLag = maxLag
+	return nil
+}
+
+func (m *mockPatroni) GetPgIdent(ctx context.Context, server *v1.Pod) ([]string, error) {
+	return m.pgIdent, nil
+}
+
+func (m *mockPatroni) SetPgIdent(ctx context.Context, server *v1.Pod, lines []string) error {
+	m.pgIdent = lines
+	m.pgIdentSet++
+	return nil
+}
+
+func (m *mockPatroni) GetSlots(ctx context.Context, server *v1.Pod) (map[string]map[string]string, error) {
+	return m.slots, nil
+}
+
+func (m *mockPatroni) SetSlots(ctx context.Context, server *v1.Pod, slots map[string]map[string]string) error {
+	m.slotsSet = append(m.slotsSet, slots)
+	if m.slots == nil {
+		m.slots = make(map[string]map[string]string)
+	}
+	for name, attributes := range slots {
+		if attributes == nil {
+			delete(m.slots, name)
+			continue
+		}
+		m.slots[name] = attributes
+	}
+	return nil
+}
+
+func (m *mockPatroni) ConfigureTLS(config *tls.Config) {
+	m.tlsConfig = config
+}
+
+func (m *mockPatroni) ScheduleRestart(ctx context.Context, server *v1.Pod, at time.Time) error {
+	if m.restartErr != nil {
+		return m.restartErr
+	}
+	if m.restarts == nil {
+		m.restarts = make(map[string]time.Time)
+	}
+	m.restarts[server.Name] = at
+	return nil
+}
+
+func TestCheckSwitchoverCandidate(t *testing.T) {
+	testName := "TestCheckSwitchoverCandidate"
+	leader := patroni.ClusterMember{Name: "acid-test-0", Role: "leader", State: "running", Timeline: 3}
+	maxLag := int64(33554432)
+
+	tests := []struct {
+		subTest   string
+		candidate patroni.ClusterMember
+		maxLag    *int64
+		err       string
+	}{
+		{
+			subTest:   "healthy replica",
+			candidate: patroni.ClusterMember{Name: "acid-test-1", Role: "replica", State: "running", Timeline: 3, Lag: 0},
+		},
+		{
+			subTest:   "healthy synchronous standby",
+			candidate: patroni.ClusterMember{Name: "acid-test-1", Role: "sync_standby", State: "running", Timeline: 3, Lag: 0},
+		},
+		{
+			subTest:   "not a member of the Patroni cluster",
+			candidate: patroni.ClusterMember{Name: "acid-test-2", Role: "replica", State: "running", Timeline: 3},
+			err:       "pod is not a member of the Patroni cluster",
+		},
+		{
+			subTest:   "replica not running",
+			candidate: patroni.ClusterMember{Name: "acid-test-1", Role: "replica", State: "starting", Timeline: 3},
+			err:       `member is in state "starting", expected running`,
+		},
+		{
+			subTest:   "replica on another timeline",
+			candidate: patroni.ClusterMember{Name: "acid-test-1", Role: "replica", State: "running", Timeline: 2},
+			err:       "member is on timeline 2, leader is on timeline 3",
+		},
+		{
+			subTest:   "replica lagging behind the default maximum",
+			candidate: patroni.ClusterMember{Name: "acid-test-1", Role: "replica", State: "running", Timeline: 3, Lag: 2097152},
+			err:       "replication lag of 2097152 bytes exceeds the maximum of 1048576 bytes",
+		},
+		{
+			subTest:   "replica lag within the configured maximum",
+			candidate: patroni.ClusterMember{Name: "acid-test-1", Role: "replica", State: "running", Timeline: 3, Lag: 2097152},
+			maxLag:    &maxLag,
+		},
+	}
+
+	for _, tt := range tests {
+		members := []patroni.ClusterMember{leader, tt.candidate}
+		if tt.candidate.Name != "acid-test-1" {
+			members = []patroni.ClusterMember{leader}
+		}
+		cluster := New(
+			Config{
+				OpConfig: config.Config{
+					Auth: config.Auth{
+						SuperUsername:       superUserName,
+						ReplicationUsername: replicationUserName,
+					},
+				},
+			},
+			k8sutil.NewMockKubernetesClient(),
+			acidv1.Postgresql{
+				ObjectMeta: metav1.ObjectMeta{Name: "acid-test", Namespace: "test"},
+				Spec:       acidv1.PostgresSpec{Patroni: acidv1.Patroni{MaximumLagOnFailover: tt.maxLag}},
+			},
+			logger,
+			eventRecorder,
+		)
+		cluster.patroni = &mockPatroni{members: members}
+
+		err := cluster.checkSwitchoverCandidate(context.TODO(), &v1.Pod{}, "acid-test-1")
+		if tt.err == "" && err != nil {
+			t.Errorf("%s [%s]: expected no error, got %v", testName, tt.subTest, err)
+		}
+		if tt.err != "" && (err == nil || err.Error() != tt.err) {
+			t.Errorf("%s [%s]: expected error %q, got %v", testName, tt.subTest, tt.err, err)
+		}
+	}
+}
+
+func TestStatementTimeout(t *testing.T) {
+	testName := "TestStatementTimeout"
+	timeoutCluster := New(
+		Config{
+			OpConfig: config.Config{
+				Resources: config.Resources{
+					DBStatementTimeout:     time.Minute,
+					DBLongStatementTimeout: 10 * time.Minute,
+				},
+			},
+		}, k8sutil.NewMockKubernetesClient(), acidv1.Postgresql{}, logger, eventRecorder)
+
+	connString := timeoutCluster.pgConnectionString("")
+	if !strings.Contains(connString, "statement_timeout='60000'") {
+		t.Errorf("%s: expected statement_timeout of 60000ms in the connection string, got %q", testName, connString)
+	}
+	// the operator writes into a quiesced cluster
+	if !strings.Contains(connString, "default_transaction_read_only='off'") {
+		t.Errorf("%s: expected read-write sessions in the connection string, got %q", testName, connString)
+	}
+
+	tests := []struct {
+		subTest string
+		err     error
+		timeout time.Duration
+		result  string
+	}{
+		{
+			subTest: "statement canceled by the timeout",
+			err:     &pq.Error{Code: queryCanceledErrorCode, Message: "canceling statement due to statement timeout"},
+			timeout: 10 * time.Minute,
+			result:  "statement timeout of 10m0s exceeded: pq: canceling statement due to statement timeout",
+		},
+		{
+			subTest: "other database errors are kept",
+			err:     &pq.Error{Code: "42P04", Message: "database \"foo\" already exists"},
+			timeout: time.Minute,
+			result:  "pq: database \"foo\" already exists",
+		},
+		{
+			subTest: "non-database errors are kept",
+			err:     fmt.Errorf("connection refused"),
+			timeout: time.Minute,
+			result:  "connection refused",
+		},
+	}
+	for _, tt := range tests {
+		if err := statementTimeoutError(tt.err, tt.timeout); err.Error() != tt.result {
+			t.Errorf("%s [%s]: expected error %q, got %q", testName, tt.subTest, tt.result, err.Error())
+		}
+	}
+}
+
+func TestDatabaseObjectsAccessible(t *testing.T) {
+	testName := "TestDatabaseObjectsAccessible"
+	accessCluster := New(
+		Config{
+			OpConfig: config.Config{
+				EnableDBAccess: false,
+				Resources: config.Resources{
+					MinInstances: -1,
+					MaxInstances: -1,
+				},
+			},
+		}, k8sutil.NewMockKubernetesClient(), acidv1.Postgresql{}, logger, eventRecorder)
+	spec := acidv1.PostgresSpec{NumberOfInstances: 2}
+
+	tests := []struct {
+		subTest        string
+		enableDBAccess bool
+		instances      int32
+		standby        *acidv1.StandbyDescription
+		accessible     bool
+	}{
+		{
+			subTest:        "database access disabled",
+			enableDBAccess: false,
+			instances:      2,
+			accessible:     false,
+		},
+		{
+			subTest:        "database access enabled",
+			enableDBAccess: true,
+			instances:      2,
+			accessible:     true,
+		},
+		{
+			subTest:        "cluster without instances",
+			enableDBAccess: true,
+			instances:      0,
+			accessible:     false,
+		},
+		{
+			subTest:        "standby cluster",
+			enableDBAccess: true,
+			instances:      2,
+			standby:        &acidv1.StandbyDescription{S3WalPath: "s3://bucket/wal"},
+			accessible:     false,
+		},
+	}
+
+	for _, tt := range tests {
+		accessCluster.OpConfig.EnableDBAccess = tt.enableDBAccess
+		spec.NumberOfInstances = tt.instances
+		spec.StandbyCluster = tt.standby
+
+		accessible := accessCluster.databaseObjectsAccessible(&spec)
+		if accessible != tt.accessible {
+			t.Errorf("%s %s: expected accessible %t, got %t", testName, tt.subTest, tt.accessible, accessible)
+		}
+		// asking does not change the sync state
+		if accessCluster.databaseObjectsPending {
+			t.Errorf("%s %s: expected the database objects not to be marked as pending", testName, tt.subTest)
+		}
+	}
+}
+
+func TestClusterLockTimeout(t *testing.T) {
+	testName := "TestClusterLockTimeout"
+	var mu clusterMutex
+
+	mu.lock("update", logger)
+	if holder, _ := mu.heldBy(); holder != "update" {
+		t.Errorf("%s: expected the lock to be held by update, got %q", testName, holder)
+	}
+
+	// a sync gives up on the cluster locked by a hanging update
+	err := mu.lockWithTimeout("sync", 10*time.Millisecond, logger)
+	if err == nil || !strings.Contains(err.Error(), "it is held by update") {
+		t.Errorf("%s: expected the sync to time out on the lock held by update, got %v", testName, err)
+	}
+
+	mu.unlock(logger)
+	if err = mu.lockWithTimeout("sync", 10*time.Millisecond, logger); err != nil {
+		t.Errorf("%s: expected the sync to lock the released cluster, got %v", testName, err)
+	}
+	mu.unlock(logger)
+	if holder, held := mu.heldBy(); holder != "" || held != 0 {
+		t.Errorf("%s: expected the lock to be released, held by %q for %v", testName, holder, held)
+	}
+}
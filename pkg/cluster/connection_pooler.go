@@ -3,6 +3,7 @@ package cluster
 import (
 	"context"
 	"fmt"
+	"reflect"
 	"strings"
 
 	"github.com/r3labs/diff"
@@ -10,7 +11,11 @@ import (
 	acidzalando "github.com/zalando/postgres-operator/pkg/apis/acid.zalan.do"
 	acidv1 "github.com/zalando/postgres-operator/pkg/apis/acid.zalan.do/v1"
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
 	v1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
@@ -26,6 +31,7 @@ import (
 type ConnectionPoolerObjects struct {
 	Deployment  *appsv1.Deployment
 	Service     *v1.Service
+	Autoscaler  *autoscalingv1.HorizontalPodAutoscaler
 	Name        string
 	ClusterName string
 	Namespace   string
@@ -114,7 +120,7 @@ func (c *Cluster) createConnectionPooler(LookupFunction InstallFunction) (SyncRe
 	c.setProcessName("creating connection pooler")
 
 	//this is essentially sync with nil as oldSpec
-	if reason, err := c.syncConnectionPooler(nil, &c.Postgresql, LookupFunction); err != nil {
+	if reason, err := c.syncConnectionPooler(context.TODO(), nil, &c.Postgresql, LookupFunction); err != nil {
 		return reason, err
 	}
 	return reason, nil
@@ -325,6 +331,10 @@ func (c *Cluster) generateConnectionPoolerDeployment(connectionPooler *Connectio
 			k8sutil.Int32ToPointer(1))
 	}
 
+	if spec.ConnectionPooler.Autoscaling != nil && spec.ConnectionPooler.Autoscaling.MinReplicas != nil {
+		numberOfInstances = spec.ConnectionPooler.Autoscaling.MinReplicas
+	}
+
 	if *numberOfInstances < constants.ConnectionPoolerMinInstances {
 		msg := "Adjusted number of connection pooler instances from %d to %d"
 		c.logger.Warningf(msg, *numberOfInstances, constants.ConnectionPoolerMinInstances)
@@ -407,8 +417,41 @@ func (c *Cluster) generateConnectionPoolerService(connectionPooler *ConnectionPo
 	return service
 }
 
+// generateConnectionPoolerHPA generates the horizontal pod autoscaler scaling the connection pooler
+// deployment. The autoscaling/v1 API is used as it is served by all supported Kubernetes versions.
+func (c *Cluster) generateConnectionPoolerHPA(connectionPooler *ConnectionPoolerObjects) *autoscalingv1.HorizontalPodAutoscaler {
+	autoscaling := c.Spec.ConnectionPooler.Autoscaling
+
+	minReplicas := util.CoalesceInt32(autoscaling.MinReplicas, k8sutil.Int32ToPointer(constants.ConnectionPoolerMinInstances))
+	if *minReplicas > autoscaling.MaxReplicas {
+		minReplicas = k8sutil.Int32ToPointer(autoscaling.MaxReplicas)
+	}
+	targetCPUUtilization := util.CoalesceInt32(autoscaling.TargetCPUUtilizationPercentage,
+		k8sutil.Int32ToPointer(constants.ConnectionPoolerDefaultTargetCPUUtilization))
+
+	return &autoscalingv1.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            connectionPooler.Name,
+			Namespace:       connectionPooler.Namespace,
+			Labels:          c.connectionPoolerLabels(connectionPooler.Role, false).MatchLabels,
+			Annotations:     c.AnnotationsToPropagate(c.annotationsSet(nil)),
+			OwnerReferences: c.ownerReferences(),
+		},
+		Spec: autoscalingv1.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv1.CrossVersionObjectReference{
+				APIVersion: "apps/v1",
+				Kind:       "Deployment",
+				Name:       connectionPooler.Name,
+			},
+			MinReplicas:                    minReplicas,
+			MaxReplicas:                    autoscaling.MaxReplicas,
+			TargetCPUUtilizationPercentage: targetCPUUtilization,
+		},
+	}
+}
+
 //delete connection pooler
-func (c *Cluster) deleteConnectionPooler(role PostgresRole) (err error) {
+func (c *Cluster) deleteConnectionPooler(ctx context.Context, role PostgresRole) (err error) {
 	c.logger.Infof("deleting connection pooler spilo-role=%s", role)
 
 	// Lack of connection pooler objects is not a fatal error, just log it if
@@ -433,7 +476,7 @@ func (c *Cluster) deleteConnectionPooler(role PostgresRole) (err error) {
 
 		err = c.KubeClient.
 			Deployments(c.Namespace).
-			Delete(context.TODO(), deployment.Name, options)
+			Delete(ctx, deployment.Name, options)
 
 		if k8sutil.ResourceNotFound(err) {
 			c.logger.Debugf("connection pooler deployment was already deleted")
@@ -453,7 +496,7 @@ func (c *Cluster) deleteConnectionPooler(role PostgresRole) (err error) {
 
 		err = c.KubeClient.
 			Services(c.Namespace).
-			Delete(context.TODO(), service.Name, options)
+			Delete(ctx, service.Name, options)
 
 		if k8sutil.ResourceNotFound(err) {
 			c.logger.Debugf("connection pooler service was already deleted")
@@ -464,24 +507,41 @@ func (c *Cluster) deleteConnectionPooler(role PostgresRole) (err error) {
 		c.logger.Infof("connection pooler service %s has been deleted for role %s", service.Name, role)
 	}
 
+	// and for the horizontal pod autoscaler, which is left behind otherwise
+	autoscaler := c.ConnectionPooler[role].Autoscaler
+	if autoscaler != nil {
+		err = c.KubeClient.
+			HorizontalPodAutoscalers(c.Namespace).
+			Delete(ctx, autoscaler.Name, options)
+
+		if k8sutil.ResourceNotFound(err) {
+			c.logger.Debugf("connection pooler horizontal pod autoscaler was already deleted")
+		} else if err != nil {
+			return fmt.Errorf("could not delete connection pooler horizontal pod autoscaler: %v", err)
+		}
+
+		c.logger.Infof("connection pooler horizontal pod autoscaler %s has been deleted for role %s", autoscaler.Name, role)
+	}
+
 	c.ConnectionPooler[role].Deployment = nil
 	c.ConnectionPooler[role].Service = nil
+	c.ConnectionPooler[role].Autoscaler = nil
 	return nil
 }
 
 //delete connection pooler
-func (c *Cluster) deleteConnectionPoolerSecret() (err error) {
+func (c *Cluster) deleteConnectionPoolerSecret(ctx context.Context) (err error) {
 	// Repeat the same for the secret object
 	secretName := c.credentialSecretName(c.OpConfig.ConnectionPooler.User)
 
 	secret, err := c.KubeClient.
 		Secrets(c.Namespace).
-		Get(context.TODO(), secretName, metav1.GetOptions{})
+		Get(ctx, secretName, metav1.GetOptions{})
 
 	if err != nil {
 		c.logger.Debugf("could not get connection pooler secret %s: %v", secretName, err)
 	} else {
-		if err = c.deleteSecret(secret.UID, *secret); err != nil {
+		if err = c.deleteSecret(ctx, secret.UID, *secret); err != nil {
 			return fmt.Errorf("could not delete pooler secret: %v", err)
 		}
 	}
@@ -578,7 +638,8 @@ func needSyncConnectionPoolerDefaults(Config *Config, spec *acidv1.ConnectionPoo
 	if spec == nil {
 		spec = &acidv1.ConnectionPooler{}
 	}
-	if spec.NumberOfInstances == nil &&
+	// the number of instances is managed by the horizontal pod autoscaler if configured
+	if spec.NumberOfInstances == nil && spec.Autoscaling == nil &&
 		*deployment.Spec.Replicas != *config.NumberOfInstances {
 
 		sync = true
@@ -682,7 +743,7 @@ func logPoolerEssentials(log *logrus.Entry, oldSpec, newSpec *acidv1.Postgresql)
 	log.Debugf("syncing connection pooler from (%v, %v) to (%v, %v)", v[0], v[1], v[2], v[3])
 }
 
-func (c *Cluster) syncConnectionPooler(oldSpec, newSpec *acidv1.Postgresql, LookupFunction InstallFunction) (SyncReason, error) {
+func (c *Cluster) syncConnectionPooler(ctx context.Context, oldSpec, newSpec *acidv1.Postgresql, LookupFunction InstallFunction) (SyncReason, error) {
 
 	var reason SyncReason
 	var err error
@@ -787,7 +848,7 @@ func (c *Cluster) syncConnectionPooler(oldSpec, newSpec *acidv1.Postgresql, Look
 				}
 			}
 
-			if reason, err = c.syncConnectionPoolerWorker(oldSpec, newSpec, role); err != nil {
+			if reason, err = c.syncConnectionPoolerWorker(ctx, oldSpec, newSpec, role); err != nil {
 				c.logger.Errorf("could not sync connection pooler: %v", err)
 				return reason, err
 			}
@@ -797,7 +858,7 @@ func (c *Cluster) syncConnectionPooler(oldSpec, newSpec *acidv1.Postgresql, Look
 				(c.ConnectionPooler[role].Deployment != nil ||
 					c.ConnectionPooler[role].Service != nil) {
 
-				if err = c.deleteConnectionPooler(role); err != nil {
+				if err = c.deleteConnectionPooler(ctx, role); err != nil {
 					c.logger.Warningf("could not remove connection pooler: %v", err)
 				}
 			}
@@ -805,7 +866,7 @@ func (c *Cluster) syncConnectionPooler(oldSpec, newSpec *acidv1.Postgresql, Look
 	}
 	if !needMasterConnectionPoolerWorker(&newSpec.Spec) &&
 		!needReplicaConnectionPoolerWorker(&newSpec.Spec) {
-		if err = c.deleteConnectionPoolerSecret(); err != nil {
+		if err = c.deleteConnectionPoolerSecret(ctx); err != nil {
 			c.logger.Warningf("could not remove connection pooler secret: %v", err)
 		}
 	}
@@ -817,12 +878,12 @@ func (c *Cluster) syncConnectionPooler(oldSpec, newSpec *acidv1.Postgresql, Look
 // synchronizing the corresponding deployment, but in case of deployment or
 // service is missing, create it. After checking, also remember an object for
 // the future references.
-func (c *Cluster) syncConnectionPoolerWorker(oldSpec, newSpec *acidv1.Postgresql, role PostgresRole) (
+func (c *Cluster) syncConnectionPoolerWorker(ctx context.Context, oldSpec, newSpec *acidv1.Postgresql, role PostgresRole) (
 	SyncReason, error) {
 
 	deployment, err := c.KubeClient.
 		Deployments(c.Namespace).
-		Get(context.TODO(), c.connectionPoolerName(role), metav1.GetOptions{})
+		Get(ctx, c.connectionPoolerName(role), metav1.GetOptions{})
 
 	if err != nil && k8sutil.ResourceNotFound(err) {
 		msg := "deployment %s for connection pooler synchronization is not found, create it"
@@ -836,7 +897,7 @@ func (c *Cluster) syncConnectionPoolerWorker(oldSpec, newSpec *acidv1.Postgresql
 
 		deployment, err := c.KubeClient.
 			Deployments(deploymentSpec.Namespace).
-			Create(context.TODO(), deploymentSpec, metav1.CreateOptions{})
+			Create(ctx, deploymentSpec, metav1.CreateOptions{})
 
 		if err != nil {
 			return NoSync, err
@@ -889,6 +950,10 @@ func (c *Cluster) syncConnectionPoolerWorker(oldSpec, newSpec *acidv1.Postgresql
 				msg := "could not generate deployment for connection pooler: %v"
 				return reason, fmt.Errorf(msg, err)
 			}
+			// do not reset the number of replicas chosen by the horizontal pod autoscaler
+			if newConnectionPooler.Autoscaling != nil {
+				newDeploymentSpec.Spec.Replicas = nil
+			}
 
 			deployment, err := updateConnectionPoolerDeployment(c.KubeClient,
 				newDeploymentSpec)
@@ -911,7 +976,7 @@ func (c *Cluster) syncConnectionPoolerWorker(oldSpec, newSpec *acidv1.Postgresql
 
 	service, err := c.KubeClient.
 		Services(c.Namespace).
-		Get(context.TODO(), c.connectionPoolerName(role), metav1.GetOptions{})
+		Get(ctx, c.connectionPoolerName(role), metav1.GetOptions{})
 
 	if err != nil && k8sutil.ResourceNotFound(err) {
 		msg := "Service %s for connection pooler synchronization is not found, create it"
@@ -920,7 +985,7 @@ func (c *Cluster) syncConnectionPoolerWorker(oldSpec, newSpec *acidv1.Postgresql
 		serviceSpec := c.generateConnectionPoolerService(c.ConnectionPooler[role])
 		service, err := c.KubeClient.
 			Services(serviceSpec.Namespace).
-			Create(context.TODO(), serviceSpec, metav1.CreateOptions{})
+			Create(ctx, serviceSpec, metav1.CreateOptions{})
 
 		if err != nil {
 			return NoSync, err
@@ -935,5 +1000,320 @@ func (c *Cluster) syncConnectionPoolerWorker(oldSpec, newSpec *acidv1.Postgresql
 		c.ConnectionPooler[role].Service = service
 	}
 
+	if err = c.syncPoolerHPA(ctx, role); err != nil {
+		return NoSync, err
+	}
+
 	return NoSync, nil
 }
+
+// syncPoolerHPA creates or updates the horizontal pod autoscaler of the connection pooler deployment
+// and removes it once autoscaling is not configured anymore. Kubernetes clusters not serving the
+// autoscaling/v1 API only produce a warning.
+func (c *Cluster) syncPoolerHPA(ctx context.Context, role PostgresRole) error {
+	name := c.connectionPoolerName(role)
+
+	autoscaler, err := c.KubeClient.
+		HorizontalPodAutoscalers(c.Namespace).
+		Get(ctx, name, metav1.GetOptions{})
+	if err != nil && !k8sutil.ResourceNotFound(err) {
+		return fmt.Errorf("could not get connection pooler horizontal pod autoscaler: %v", err)
+	}
+	exists := err == nil
+
+	if c.Spec.ConnectionPooler == nil || c.Spec.ConnectionPooler.Autoscaling == nil {
+		if exists {
+			err = c.KubeClient.
+				HorizontalPodAutoscalers(c.Namespace).
+				Delete(ctx, name, c.deleteOptions)
+			if err != nil && !k8sutil.ResourceNotFound(err) {
+				return fmt.Errorf("could not delete connection pooler horizontal pod autoscaler: %v", err)
+			}
+			c.logger.Infof("connection pooler horizontal pod autoscaler %s has been deleted for role %s", name, role)
+		}
+		c.ConnectionPooler[role].Autoscaler = nil
+		return nil
+	}
+
+	desiredAutoscaler := c.generateConnectionPoolerHPA(c.ConnectionPooler[role])
+	if !exists {
+		autoscaler, err = c.KubeClient.
+			HorizontalPodAutoscalers(c.Namespace).
+			Create(ctx, desiredAutoscaler, metav1.CreateOptions{})
+		if k8sutil.ResourceNotFound(err) {
+			c.logger.Warningf("could not create connection pooler horizontal pod autoscaler, autoscaling/v1 API is not available: %v", err)
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("could not create connection pooler horizontal pod autoscaler: %v", err)
+		}
+		c.logger.Infof("connection pooler horizontal pod autoscaler %s has been created for role %s", name, role)
+	} else if !reflect.DeepEqual(autoscaler.Spec, desiredAutoscaler.Spec) {
+		desiredAutoscaler.ResourceVersion = autoscaler.ResourceVersion
+		autoscaler, err = c.KubeClient.
+			HorizontalPodAutoscalers(c.Namespace).
+			Update(ctx, desiredAutoscaler, metav1.UpdateOptions{})
+		if err != nil {
+			return fmt.Errorf("could not update connection pooler horizontal pod autoscaler: %v", err)
+		}
+		c.logger.Infof("connection pooler horizontal pod autoscaler %s has been updated for role %s", name, role)
+	}
+	c.ConnectionPooler[role].Autoscaler = autoscaler
+
+	return nil
+}
+
+// connectionPoolerRestartName is the name of the cron job restarting the connection poolers on a schedule, as well
+// as of the service account and role it runs with
+func (c *Cluster) connectionPoolerRestartName() string {
+	return c.Name + "-pooler-restart"
+}
+
+// connectionPoolerRestartScheduled tells whether the manifest asks for the periodic restart of the poolers
+func connectionPoolerRestartScheduled(spec *acidv1.PostgresSpec) bool {
+	return spec.ConnectionPooler != nil && spec.ConnectionPooler.RestartSchedule != ""
+}
+
+// connectionPoolerRestartDeployments lists the pooler deployments to restart, none without a restart schedule
+func (c *Cluster) connectionPoolerRestartDeployments() []string {
+	if !connectionPoolerRestartScheduled(&c.Spec) {
+		return nil
+	}
+	deployments := make([]string, 0, 2)
+	if needMasterConnectionPoolerWorker(&c.Spec) {
+		deployments = append(deployments, c.connectionPoolerName(Master))
+	}
+	if needReplicaConnectionPoolerWorker(&c.Spec) {
+		deployments = append(deployments, c.connectionPoolerName(Replica))
+	}
+	return deployments
+}
+
+// generateConnectionPoolerRestartRole only allows to restart the given pooler deployments
+func (c *Cluster) generateConnectionPoolerRestartRole(deployments []string) *rbacv1.Role {
+	return &rbacv1.Role{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      c.connectionPoolerRestartName(),
+			Namespace: c.Namespace,
+			Labels:    c.labelsSet(true),
+		},
+		Rules: []rbacv1.PolicyRule{
+			{
+				APIGroups:     []string{"apps"},
+				Resources:     []string{"deployments"},
+				ResourceNames: deployments,
+				Verbs:         []string{"get", "patch"},
+			},
+		},
+	}
+}
+
+// generateConnectionPoolerRestartJob runs a rolling restart of the pooler deployments on the restart schedule
+func (c *Cluster) generateConnectionPoolerRestartJob(deployments []string) *batchv1beta1.CronJob {
+	args := []string{"rollout", "restart", "--namespace", c.Namespace}
+	for _, deployment := range deployments {
+		args = append(args, "deployment/"+deployment)
+	}
+
+	return &batchv1beta1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        c.connectionPoolerRestartName(),
+			Namespace:   c.Namespace,
+			Labels:      c.labelsSet(true),
+			Annotations: c.annotationsSet(nil),
+		},
+		Spec: batchv1beta1.CronJobSpec{
+			Schedule:          c.Spec.ConnectionPooler.RestartSchedule,
+			ConcurrencyPolicy: batchv1beta1.ForbidConcurrent,
+			JobTemplate: batchv1beta1.JobTemplateSpec{
+				Spec: batchv1.JobSpec{
+					Template: v1.PodTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{
+							Labels: c.labelsSet(true),
+						},
+						Spec: v1.PodSpec{
+							ServiceAccountName: c.connectionPoolerRestartName(),
+							RestartPolicy:      v1.RestartPolicyNever,
+							Containers: []v1.Container{
+								{
+									Name:    "pooler-restart",
+									Image:   c.OpConfig.ConnectionPooler.RestartImage,
+									Command: []string{"kubectl"},
+									Args:    args,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// sameConnectionPoolerRestartJob only compares the generated fields, the rest is defaulted by Kubernetes
+func sameConnectionPoolerRestartJob(cur, new *batchv1beta1.CronJob) bool {
+	curPod := cur.Spec.JobTemplate.Spec.Template.Spec
+	newPod := new.Spec.JobTemplate.Spec.Template.Spec
+	if cur.Spec.Schedule != new.Spec.Schedule || curPod.ServiceAccountName != newPod.ServiceAccountName ||
+		len(curPod.Containers) != len(newPod.Containers) {
+		return false
+	}
+	for i := range curPod.Containers {
+		if curPod.Containers[i].Image != newPod.Containers[i].Image ||
+			!reflect.DeepEqual(curPod.Containers[i].Command, newPod.Containers[i].Command) ||
+			!reflect.DeepEqual(curPod.Containers[i].Args, newPod.Containers[i].Args) {
+			return false
+		}
+	}
+	return true
+}
+
+// syncConnectionPoolerRestartJob creates or updates the cron job restarting the connection pooler deployments on
+// the restart schedule of the manifest, together with the service account, role and role binding it runs with.
+// Objects of the same name not created by the operator are not taken over. Without deployments to restart the
+// objects are removed, the sync only calls it with a restart schedule.
+func (c *Cluster) syncConnectionPoolerRestartJob(ctx context.Context) error {
+	deployments := c.connectionPoolerRestartDeployments()
+	if len(deployments) == 0 {
+		return c.deleteConnectionPoolerRestartJob(ctx)
+	}
+	c.setProcessName("syncing connection pooler restart job")
+	name := c.connectionPoolerRestartName()
+
+	serviceAccount, err := c.KubeClient.ServiceAccounts(c.Namespace).Get(ctx, name, metav1.GetOptions{})
+	if k8sutil.ResourceNotFound(err) {
+		serviceAccount = &v1.ServiceAccount{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: c.Namespace,
+				Labels:    c.labelsSet(true),
+			},
+		}
+		if _, err = c.KubeClient.ServiceAccounts(c.Namespace).Create(ctx, serviceAccount, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("could not create service account %q: %v", name, err)
+		}
+		c.logger.Infof("service account %q of the connection pooler restart job has been created", name)
+	} else if err != nil {
+		return fmt.Errorf("could not get service account %q: %v", name, err)
+	} else if !c.hasClusterLabels(serviceAccount.Labels) {
+		return fmt.Errorf("service account %q exists and is not managed by the operator", name)
+	}
+
+	desiredRole := c.generateConnectionPoolerRestartRole(deployments)
+	role, err := c.KubeClient.Roles(c.Namespace).Get(ctx, name, metav1.GetOptions{})
+	if k8sutil.ResourceNotFound(err) {
+		if _, err = c.KubeClient.Roles(c.Namespace).Create(ctx, desiredRole, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("could not create role %q: %v", name, err)
+		}
+		c.logger.Infof("role %q of the connection pooler restart job has been created", name)
+	} else if err != nil {
+		return fmt.Errorf("could not get role %q: %v", name, err)
+	} else if !c.hasClusterLabels(role.Labels) {
+		return fmt.Errorf("role %q exists and is not managed by the operator", name)
+	} else if !reflect.DeepEqual(role.Rules, desiredRole.Rules) {
+		role.Rules = desiredRole.Rules
+		if _, err = c.KubeClient.Roles(c.Namespace).Update(ctx, role, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("could not update role %q: %v", name, err)
+		}
+		c.logger.Infof("role %q of the connection pooler restart job has been updated", name)
+	}
+
+	roleBinding, err := c.KubeClient.RoleBindings(c.Namespace).Get(ctx, name, metav1.GetOptions{})
+	if k8sutil.ResourceNotFound(err) {
+		roleBinding = &rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: c.Namespace,
+				Labels:    c.labelsSet(true),
+			},
+			RoleRef: rbacv1.RoleRef{
+				APIGroup: rbacv1.GroupName,
+				Kind:     "Role",
+				Name:     name,
+			},
+			Subjects: []rbacv1.Subject{
+				{
+					Kind:      rbacv1.ServiceAccountKind,
+					Name:      name,
+					Namespace: c.Namespace,
+				},
+			},
+		}
+		if _, err = c.KubeClient.RoleBindings(c.Namespace).Create(ctx, roleBinding, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("could not create role binding %q: %v", name, err)
+		}
+		c.logger.Infof("role binding %q of the connection pooler restart job has been created", name)
+	} else if err != nil {
+		return fmt.Errorf("could not get role binding %q: %v", name, err)
+	} else if !c.hasClusterLabels(roleBinding.Labels) {
+		return fmt.Errorf("role binding %q exists and is not managed by the operator", name)
+	}
+
+	desiredJob := c.generateConnectionPoolerRestartJob(deployments)
+	job, err := c.KubeClient.CronJobsGetter.CronJobs(c.Namespace).Get(ctx, name, metav1.GetOptions{})
+	if k8sutil.ResourceNotFound(err) {
+		if _, err = c.KubeClient.CronJobsGetter.CronJobs(c.Namespace).Create(ctx, desiredJob, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("could not create connection pooler restart job: %v", err)
+		}
+		c.logger.Infof("connection pooler restart job %q has been created", name)
+	} else if err != nil {
+		return fmt.Errorf("could not get connection pooler restart job: %v", err)
+	} else if !c.hasClusterLabels(job.Labels) {
+		return fmt.Errorf("cron job %q exists and is not managed by the operator", name)
+	} else if !sameConnectionPoolerRestartJob(job, desiredJob) {
+		job.Spec = desiredJob.Spec
+		if _, err = c.KubeClient.CronJobsGetter.CronJobs(c.Namespace).Update(ctx, job, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("could not update connection pooler restart job: %v", err)
+		}
+		c.logger.Infof("connection pooler restart job %q has been updated", name)
+	}
+
+	return nil
+}
+
+// deleteConnectionPoolerRestartJob removes the cron job restarting the poolers and the objects it runs with
+func (c *Cluster) deleteConnectionPoolerRestartJob(ctx context.Context) error {
+	name := c.connectionPoolerRestartName()
+
+	job, err := c.KubeClient.CronJobsGetter.CronJobs(c.Namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil && !k8sutil.ResourceNotFound(err) {
+		return fmt.Errorf("could not get connection pooler restart job: %v", err)
+	}
+	if err == nil && c.hasClusterLabels(job.Labels) {
+		if err = c.KubeClient.CronJobsGetter.CronJobs(c.Namespace).Delete(ctx, name, c.deleteOptions); err != nil {
+			return fmt.Errorf("could not delete connection pooler restart job: %v", err)
+		}
+		c.logger.Infof("connection pooler restart job %q has been deleted", name)
+	}
+
+	roleBinding, err := c.KubeClient.RoleBindings(c.Namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil && !k8sutil.ResourceNotFound(err) {
+		return fmt.Errorf("could not get role binding %q: %v", name, err)
+	}
+	if err == nil && c.hasClusterLabels(roleBinding.Labels) {
+		if err = c.KubeClient.RoleBindings(c.Namespace).Delete(ctx, name, c.deleteOptions); err != nil {
+			return fmt.Errorf("could not delete role binding %q: %v", name, err)
+		}
+	}
+
+	role, err := c.KubeClient.Roles(c.Namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil && !k8sutil.ResourceNotFound(err) {
+		return fmt.Errorf("could not get role %q: %v", name, err)
+	}
+	if err == nil && c.hasClusterLabels(role.Labels) {
+		if err = c.KubeClient.Roles(c.Namespace).Delete(ctx, name, c.deleteOptions); err != nil {
+			return fmt.Errorf("could not delete role %q: %v", name, err)
+		}
+	}
+
+	serviceAccount, err := c.KubeClient.ServiceAccounts(c.Namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil && !k8sutil.ResourceNotFound(err) {
+		return fmt.Errorf("could not get service account %q: %v", name, err)
+	}
+	if err == nil && c.hasClusterLabels(serviceAccount.Labels) {
+		if err = c.KubeClient.ServiceAccounts(c.Namespace).Delete(ctx, name, c.deleteOptions); err != nil {
+			return fmt.Errorf("could not delete service account %q: %v", name, err)
+		}
+	}
+
+	return nil
+}
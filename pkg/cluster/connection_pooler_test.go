@@ -1,6 +1,7 @@
 package cluster
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"strings"
@@ -265,11 +266,13 @@ func TestConnectionPoolerCreateDeletion(t *testing.T) {
 	namespace := "default"
 
 	client := k8sutil.KubernetesClient{
-		StatefulSetsGetter: clientSet.AppsV1(),
-		ServicesGetter:     clientSet.CoreV1(),
-		DeploymentsGetter:  clientSet.AppsV1(),
-		PostgresqlsGetter:  acidClientSet.AcidV1(),
-		SecretsGetter:      clientSet.CoreV1(),
+		StatefulSetsGetter:             clientSet.AppsV1(),
+		ResourceQuotasGetter:           clientSet.CoreV1(),
+		ServicesGetter:                 clientSet.CoreV1(),
+		DeploymentsGetter:              clientSet.AppsV1(),
+		PostgresqlsGetter:              acidClientSet.AcidV1(),
+		SecretsGetter:                  clientSet.CoreV1(),
+		HorizontalPodAutoscalersGetter: clientSet.AutoscalingV1(),
 	}
 
 	pg := acidv1.Postgresql{
@@ -312,9 +315,9 @@ func TestConnectionPoolerCreateDeletion(t *testing.T) {
 	cluster.Name = "acid-fake-cluster"
 	cluster.Namespace = "default"
 
-	_, err := cluster.createService(Master)
+	_, err := cluster.createService(context.TODO(), Master)
 	assert.NoError(t, err)
-	_, err = cluster.createStatefulSet()
+	_, err = cluster.createStatefulSet(context.TODO())
 	assert.NoError(t, err)
 
 	reason, err := cluster.createConnectionPooler(mockInstallLookupFunction)
@@ -353,13 +356,13 @@ func TestConnectionPoolerCreateDeletion(t *testing.T) {
 	}
 
 	// Delete connection pooler via sync
-	_, err = cluster.syncConnectionPooler(oldSpec, newSpec, mockInstallLookupFunction)
+	_, err = cluster.syncConnectionPooler(context.TODO(), oldSpec, newSpec, mockInstallLookupFunction)
 	if err != nil {
 		t.Errorf("%s: Cannot sync connection pooler, %s", testName, err)
 	}
 
 	for _, role := range [2]PostgresRole{Master, Replica} {
-		err = cluster.deleteConnectionPooler(role)
+		err = cluster.deleteConnectionPooler(context.TODO(), role)
 		if err != nil {
 			t.Errorf("%s: Cannot delete connection pooler, %s", testName, err)
 		}
@@ -374,11 +377,13 @@ func TestConnectionPoolerSync(t *testing.T) {
 	namespace := "default"
 
 	client := k8sutil.KubernetesClient{
-		StatefulSetsGetter: clientSet.AppsV1(),
-		ServicesGetter:     clientSet.CoreV1(),
-		DeploymentsGetter:  clientSet.AppsV1(),
-		PostgresqlsGetter:  acidClientSet.AcidV1(),
-		SecretsGetter:      clientSet.CoreV1(),
+		StatefulSetsGetter:             clientSet.AppsV1(),
+		ResourceQuotasGetter:           clientSet.CoreV1(),
+		ServicesGetter:                 clientSet.CoreV1(),
+		DeploymentsGetter:              clientSet.AppsV1(),
+		PostgresqlsGetter:              acidClientSet.AcidV1(),
+		SecretsGetter:                  clientSet.CoreV1(),
+		HorizontalPodAutoscalersGetter: clientSet.AutoscalingV1(),
 	}
 
 	pg := acidv1.Postgresql{
@@ -419,9 +424,9 @@ func TestConnectionPoolerSync(t *testing.T) {
 	cluster.Name = "acid-fake-cluster"
 	cluster.Namespace = "default"
 
-	_, err := cluster.createService(Master)
+	_, err := cluster.createService(context.TODO(), Master)
 	assert.NoError(t, err)
-	_, err = cluster.createStatefulSet()
+	_, err = cluster.createStatefulSet(context.TODO())
 	assert.NoError(t, err)
 
 	reason, err := cluster.createConnectionPooler(mockInstallLookupFunction)
@@ -643,7 +648,7 @@ func TestConnectionPoolerSync(t *testing.T) {
 
 		t.Logf("running test for %s [%s]", testName, tt.subTest)
 
-		reason, err := tt.cluster.syncConnectionPooler(tt.oldSpec,
+		reason, err := tt.cluster.syncConnectionPooler(context.TODO(), tt.oldSpec,
 			tt.newSpec, mockInstallLookupFunction)
 
 		if err := tt.check(tt.cluster, err, reason); err != nil {
@@ -653,6 +658,165 @@ func TestConnectionPoolerSync(t *testing.T) {
 	}
 }
 
+func TestConnectionPoolerHPASync(t *testing.T) {
+	clientSet := fake.NewSimpleClientset()
+	client := k8sutil.KubernetesClient{
+		HorizontalPodAutoscalersGetter: clientSet.AutoscalingV1(),
+	}
+	namespace := "default"
+
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "acid-fake-cluster",
+			Namespace: namespace,
+		},
+		Spec: acidv1.PostgresSpec{
+			EnableConnectionPooler: boolToPointer(true),
+			ConnectionPooler: &acidv1.ConnectionPooler{
+				Autoscaling: &acidv1.ConnectionPoolerAutoscaling{
+					MinReplicas: int32ToPointer(2),
+					MaxReplicas: 5,
+				},
+			},
+		},
+	}
+
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				Resources: config.Resources{
+					ClusterLabels:    map[string]string{"application": "spilo"},
+					ClusterNameLabel: "cluster-name",
+				},
+			},
+		}, client, pg, logger, eventRecorder)
+	cluster.ConnectionPooler = map[PostgresRole]*ConnectionPoolerObjects{
+		Master: {
+			Name:      cluster.connectionPoolerName(Master),
+			Namespace: namespace,
+			Role:      Master,
+		},
+	}
+
+	err := cluster.syncPoolerHPA(context.TODO(), Master)
+	assert.NoError(t, err)
+	hpa, err := client.HorizontalPodAutoscalers(namespace).Get(context.TODO(), cluster.connectionPoolerName(Master), metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "Deployment", hpa.Spec.ScaleTargetRef.Kind)
+	assert.Equal(t, cluster.connectionPoolerName(Master), hpa.Spec.ScaleTargetRef.Name)
+	assert.Equal(t, int32(2), *hpa.Spec.MinReplicas)
+	assert.Equal(t, int32(5), hpa.Spec.MaxReplicas)
+	assert.Equal(t, int32(80), *hpa.Spec.TargetCPUUtilizationPercentage)
+
+	// changed limits update the autoscaler
+	cluster.Spec.ConnectionPooler.Autoscaling.MaxReplicas = 10
+	cluster.Spec.ConnectionPooler.Autoscaling.TargetCPUUtilizationPercentage = int32ToPointer(60)
+	err = cluster.syncPoolerHPA(context.TODO(), Master)
+	assert.NoError(t, err)
+	hpa, err = client.HorizontalPodAutoscalers(namespace).Get(context.TODO(), cluster.connectionPoolerName(Master), metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(10), hpa.Spec.MaxReplicas)
+	assert.Equal(t, int32(60), *hpa.Spec.TargetCPUUtilizationPercentage)
+
+	// disabling autoscaling removes the autoscaler
+	cluster.Spec.ConnectionPooler.Autoscaling = nil
+	err = cluster.syncPoolerHPA(context.TODO(), Master)
+	assert.NoError(t, err)
+	_, err = client.HorizontalPodAutoscalers(namespace).Get(context.TODO(), cluster.connectionPoolerName(Master), metav1.GetOptions{})
+	assert.True(t, k8sutil.ResourceNotFound(err))
+	assert.Nil(t, cluster.ConnectionPooler[Master].Autoscaler)
+}
+
+func TestConnectionPoolerRestartJobSync(t *testing.T) {
+	clientSet := fake.NewSimpleClientset()
+	client := k8sutil.KubernetesClient{
+		CronJobsGetter:        clientSet.BatchV1beta1(),
+		RolesGetter:           clientSet.RbacV1(),
+		RoleBindingsGetter:    clientSet.RbacV1(),
+		ServiceAccountsGetter: clientSet.CoreV1(),
+	}
+	namespace := "default"
+
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "acid-fake-cluster",
+			Namespace: namespace,
+		},
+		Spec: acidv1.PostgresSpec{
+			EnableConnectionPooler: boolToPointer(true),
+			ConnectionPooler: &acidv1.ConnectionPooler{
+				RestartSchedule: "0 3 * * *",
+			},
+		},
+	}
+
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				ConnectionPooler: config.ConnectionPooler{
+					RestartImage: "bitnami/kubectl:1.19",
+				},
+				Resources: config.Resources{
+					ClusterLabels:    map[string]string{"application": "spilo"},
+					ClusterNameLabel: "cluster-name",
+				},
+			},
+		}, client, pg, logger, eventRecorder)
+	name := cluster.connectionPoolerRestartName()
+
+	err := cluster.syncConnectionPoolerRestartJob(context.TODO())
+	assert.NoError(t, err)
+	job, err := client.CronJobs(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "0 3 * * *", job.Spec.Schedule)
+	podSpec := job.Spec.JobTemplate.Spec.Template.Spec
+	assert.Equal(t, name, podSpec.ServiceAccountName)
+	assert.Equal(t, []string{"rollout", "restart", "--namespace", namespace, "deployment/acid-fake-cluster-pooler"},
+		podSpec.Containers[0].Args)
+	role, err := client.Roles(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"acid-fake-cluster-pooler"}, role.Rules[0].ResourceNames)
+	_, err = client.RoleBindings(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	assert.NoError(t, err)
+	_, err = client.ServiceAccounts(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	assert.NoError(t, err)
+
+	// enabling the replica pooler and changing the schedule updates the job and the role
+	cluster.Spec.EnableReplicaConnectionPooler = boolToPointer(true)
+	cluster.Spec.ConnectionPooler.RestartSchedule = "0 4 * * *"
+	err = cluster.syncConnectionPoolerRestartJob(context.TODO())
+	assert.NoError(t, err)
+	job, err = client.CronJobs(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "0 4 * * *", job.Spec.Schedule)
+	assert.Contains(t, job.Spec.JobTemplate.Spec.Template.Spec.Containers[0].Args, "deployment/acid-fake-cluster-pooler-repl")
+	role, err = client.Roles(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"acid-fake-cluster-pooler", "acid-fake-cluster-pooler-repl"}, role.Rules[0].ResourceNames)
+
+	// removing the schedule removes the job and the objects it runs with
+	cluster.Spec.ConnectionPooler.RestartSchedule = ""
+	err = cluster.syncConnectionPoolerRestartJob(context.TODO())
+	assert.NoError(t, err)
+	_, err = client.CronJobs(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	assert.True(t, k8sutil.ResourceNotFound(err))
+	_, err = client.Roles(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	assert.True(t, k8sutil.ResourceNotFound(err))
+	_, err = client.RoleBindings(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	assert.True(t, k8sutil.ResourceNotFound(err))
+	_, err = client.ServiceAccounts(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	assert.True(t, k8sutil.ResourceNotFound(err))
+
+	// a service account of the same name not created by the operator is not taken over
+	_, err = client.ServiceAccounts(namespace).Create(context.TODO(), &v1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+	}, metav1.CreateOptions{})
+	assert.NoError(t, err)
+	cluster.Spec.ConnectionPooler.RestartSchedule = "0 3 * * *"
+	err = cluster.syncConnectionPoolerRestartJob(context.TODO())
+	assert.EqualError(t, err, fmt.Sprintf("service account %q exists and is not managed by the operator", name))
+}
+
 func TestConnectionPoolerPodSpec(t *testing.T) {
 	testName := "Test connection pooler pod template generation"
 	var cluster = New(
@@ -2,6 +2,7 @@ package cluster
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"fmt"
 	"net"
@@ -10,7 +11,10 @@ import (
 	"time"
 
 	"github.com/lib/pq"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
+	acidv1 "github.com/zalando/postgres-operator/pkg/apis/acid.zalan.do/v1"
 	"github.com/zalando/postgres-operator/pkg/spec"
 	"github.com/zalando/postgres-operator/pkg/util/constants"
 	"github.com/zalando/postgres-operator/pkg/util/retryutil"
@@ -18,7 +22,8 @@ import (
 
 const (
 	getUserSQL = `SELECT a.rolname, COALESCE(a.rolpassword, ''), a.rolsuper, a.rolinherit,
-	        a.rolcreaterole, a.rolcreatedb, a.rolcanlogin, s.setconfig,
+	        a.rolcreaterole, a.rolcreatedb, a.rolcanlogin, a.rolreplication, a.rolbypassrls, a.rolconnlimit,
+	        NULLIF(a.rolvaliduntil, 'infinity'), s.setconfig,
 	        ARRAY(SELECT b.rolname
 	              FROM pg_catalog.pg_auth_members m
 	              JOIN pg_catalog.pg_authid b ON (m.roleid = b.oid)
@@ -32,12 +37,28 @@ const (
 			WHERE n.nspname !~ '^pg_' AND n.nspname <> 'information_schema' ORDER BY 1`
 	getExtensionsSQL = `SELECT e.extname, n.nspname FROM pg_catalog.pg_extension e
 	        LEFT JOIN pg_catalog.pg_namespace n ON n.oid = e.extnamespace ORDER BY 1;`
+	getTablespacesSQL      = `SELECT spcname FROM pg_catalog.pg_tablespace;`
+	getReplicationSlotsSQL = `SELECT slot_name, active,
+		COALESCE(pg_wal_lsn_diff(pg_current_wal_lsn(), restart_lsn), 0)::bigint AS retained_bytes
+		FROM pg_catalog.pg_replication_slots;`
+	getSharedPreloadLibrariesSQL = `SELECT current_setting('shared_preload_libraries');`
 
 	createDatabaseSQL       = `CREATE DATABASE "%s" OWNER "%s";`
 	createDatabaseSchemaSQL = `SET ROLE TO "%s"; CREATE SCHEMA IF NOT EXISTS "%s" AUTHORIZATION "%s"`
 	alterDatabaseOwnerSQL   = `ALTER DATABASE "%s" OWNER TO "%s";`
 	createExtensionSQL      = `CREATE EXTENSION IF NOT EXISTS "%s" SCHEMA "%s"`
 	alterExtensionSQL       = `ALTER EXTENSION "%s" SET SCHEMA "%s"`
+	createTablespaceSQL     = `CREATE TABLESPACE "%s" LOCATION '%s'`
+	setStatementTimeoutSQL  = `SET statement_timeout TO %d`
+
+	// grants to read every object pg_dump writes out, given again on each sync for new tables and schemas
+	grantBackupDatabaseSQL = `GRANT CONNECT ON DATABASE "%s" TO "%s"`
+	grantBackupSchemaSQL   = `GRANT USAGE ON SCHEMA "%[1]s" TO "%[2]s";
+			GRANT SELECT ON ALL TABLES IN SCHEMA "%[1]s" TO "%[2]s";
+			GRANT SELECT ON ALL SEQUENCES IN SCHEMA "%[1]s" TO "%[2]s";`
+
+	// SQLSTATE of a statement canceled by statement_timeout (or a user request)
+	queryCanceledErrorCode = "57014"
 
 	globalDefaultPrivilegesSQL = `SET ROLE TO "%s";
 			ALTER DEFAULT PRIVILEGES GRANT USAGE ON SCHEMAS TO "%s","%s";
@@ -84,28 +105,61 @@ func (c *Cluster) pgConnectionString(dbname string) string {
 		dbname = "postgres"
 	}
 
-	return fmt.Sprintf("host='%s' dbname='%s' sslmode=require user='%s' password='%s' connect_timeout='%d'",
+	// statement_timeout is passed as a run-time parameter, so that it applies to every
+	// session of the pool and not only to the one a SET statement happened to run in.
+	// The sessions of the operator write even while the cluster is quiesced with
+	// default_transaction_read_only, e.g. to create roles or to rotate passwords.
+	return fmt.Sprintf("host='%s' dbname='%s' sslmode=require user='%s' password='%s' connect_timeout='%d' statement_timeout='%d' default_transaction_read_only='off'",
 		fmt.Sprintf("%s.%s.svc.%s", c.Name, c.Namespace, c.OpConfig.ClusterDomain),
 		dbname,
 		c.systemUsers[constants.SuperuserKeyName].Name,
 		strings.Replace(password, "$", "\\$", -1),
-		constants.PostgresConnectTimeout/time.Second)
+		constants.PostgresConnectTimeout/time.Second,
+		c.OpConfig.DBStatementTimeout.Milliseconds())
 }
 
-func (c *Cluster) databaseAccessDisabled() bool {
-	if !c.OpConfig.EnableDBAccess {
-		c.logger.Debugf("database access is disabled")
+// execLongStatement runs a statement expected to take longer than the regular
+// statement timeout, i.e. CREATE DATABASE copying a big template database. It
+// pins a session of the pool to raise the timeout for this statement only.
+func (c *Cluster) execLongStatement(ctx context.Context, statement string) error {
+	conn, err := c.pgDb.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("could not get database connection: %v", err)
 	}
+	defer conn.Close()
 
-	return !c.OpConfig.EnableDBAccess
+	if _, err = conn.ExecContext(ctx, fmt.Sprintf(setStatementTimeoutSQL, c.OpConfig.DBLongStatementTimeout.Milliseconds())); err != nil {
+		return fmt.Errorf("could not set statement timeout: %v", err)
+	}
+	// reset the timeout before the session is returned to the pool
+	defer conn.ExecContext(ctx, fmt.Sprintf(setStatementTimeoutSQL, c.OpConfig.DBStatementTimeout.Milliseconds()))
+
+	_, err = conn.ExecContext(ctx, statement)
+	return statementTimeoutError(err, c.OpConfig.DBLongStatementTimeout)
 }
 
-func (c *Cluster) initDbConn() error {
-	if c.pgDb != nil {
-		return nil
+// statementTimeoutError replaces the error of a statement canceled by the
+// statement timeout with one naming the exceeded timeout
+func statementTimeoutError(err error, timeout time.Duration) error {
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == queryCanceledErrorCode {
+		return fmt.Errorf("statement timeout of %v exceeded: %v", timeout, err)
+	}
+	return err
+}
+
+// databaseObjectsAccessible tells whether the roles and databases of the cluster can be synced, i.e. the database
+// access is enabled and the cluster neither runs without instances nor as a standby. Callers skipping the database
+// objects mark them as pending, so that all roles and databases are synced once it becomes accessible again.
+func (c *Cluster) databaseObjectsAccessible(spec *acidv1.PostgresSpec) bool {
+	return !c.databaseAccessDisabled() && c.getNumberOfInstances(spec) > 0 && spec.StandbyCluster == nil
+}
+
+func (c *Cluster) databaseAccessDisabled() bool {
+	if !c.OpConfig.EnableDBAccess {
+		c.logger.Debugf("database access is disabled")
 	}
 
-	return c.initDbConnWithName("")
+	return !c.OpConfig.EnableDBAccess
 }
 
 // Worker function for connection initialization. This function does not check
@@ -121,7 +175,7 @@ func (c *Cluster) initDbConnWithName(dbname string) error {
 	finalerr := retryutil.Retry(constants.PostgresConnectTimeout, constants.PostgresConnectRetryTimeout,
 		func() (bool, error) {
 			var err error
-			conn, err = sql.Open("postgres", connstring)
+			conn, err = c.openDb(connstring)
 			if err == nil {
 				err = conn.Ping()
 			}
@@ -161,8 +215,30 @@ func (c *Cluster) initDbConnWithName(dbname string) error {
 	return nil
 }
 
-func (c *Cluster) connectionIsClosed() bool {
-	return c.pgDb == nil
+// withDbConn runs f connected to the given database, or the postgres database if empty. An already open
+// connection is set aside meanwhile and restored afterwards, the connection to the database is closed even if
+// f fails.
+func (c *Cluster) withDbConn(dbname string, f func() error) (err error) {
+	previousConn := c.pgDb
+	c.pgDb = nil
+	defer func() {
+		c.pgDb = previousConn
+	}()
+
+	if err = c.initDbConnWithName(dbname); err != nil {
+		return fmt.Errorf("could not init database connection to %q: %v", dbname, err)
+	}
+	defer func() {
+		if err2 := c.closeDbConn(); err2 != nil {
+			if err == nil {
+				err = fmt.Errorf("could not close database connection: %v", err2)
+			} else {
+				err = fmt.Errorf("could not close database connection: %v (prior error: %v)", err2, err)
+			}
+		}
+	}()
+
+	return f()
 }
 
 func (c *Cluster) closeDbConn() (err error) {
@@ -180,12 +256,12 @@ func (c *Cluster) closeDbConn() (err error) {
 	return nil
 }
 
-func (c *Cluster) readPgUsersFromDatabase(userNames []string) (users spec.PgUserMap, err error) {
+func (c *Cluster) readPgUsersFromDatabase(ctx context.Context, userNames []string) (users spec.PgUserMap, err error) {
 	c.setProcessName("reading users from the database")
 	var rows *sql.Rows
 	users = make(spec.PgUserMap)
-	if rows, err = c.pgDb.Query(getUserSQL, pq.Array(userNames)); err != nil {
-		return nil, fmt.Errorf("error when querying users: %v", err)
+	if rows, err = c.pgDb.QueryContext(ctx, getUserSQL, pq.Array(userNames)); err != nil {
+		return nil, fmt.Errorf("error when querying users: %v", statementTimeoutError(err, c.OpConfig.DBStatementTimeout))
 	}
 	defer func() {
 		if err2 := rows.Close(); err2 != nil {
@@ -197,18 +273,21 @@ func (c *Cluster) readPgUsersFromDatabase(userNames []string) (users spec.PgUser
 		var (
 			rolname, rolpassword                                          string
 			rolsuper, rolinherit, rolcreaterole, rolcreatedb, rolcanlogin bool
+			rolreplication, rolbypassrls                                  bool
+			rolconnlimit                                                  int64
+			rolvaliduntil                                                 sql.NullTime
 			roloptions, memberof                                          []string
 		)
-		err := rows.Scan(&rolname, &rolpassword, &rolsuper, &rolinherit,
-			&rolcreaterole, &rolcreatedb, &rolcanlogin, pq.Array(&roloptions), pq.Array(&memberof))
+		err := rows.Scan(&rolname, &rolpassword, &rolsuper, &rolinherit, &rolcreaterole, &rolcreatedb, &rolcanlogin,
+			&rolreplication, &rolbypassrls, &rolconnlimit, &rolvaliduntil, pq.Array(&roloptions), pq.Array(&memberof))
 		if err != nil {
 			return nil, fmt.Errorf("error when processing user rows: %v", err)
 		}
-		flags := makeUserFlags(rolsuper, rolinherit, rolcreaterole, rolcreatedb, rolcanlogin)
-		// XXX: the code assumes the password we get from pg_authid is always MD5
+		flags := makeUserFlags(rolsuper, rolinherit, rolcreaterole, rolcreatedb, rolcanlogin, rolreplication, rolbypassrls)
+		// the password is read as stored, with the prefix of its encryption method
 		parameters := make(map[string]string)
 		for _, option := range roloptions {
-			fields := strings.Split(option, "=")
+			fields := strings.SplitN(option, "=", 2)
 			if len(fields) != 2 {
 				c.logger.Warningf("skipping malformed option: %q", option)
 				continue
@@ -216,7 +295,10 @@ func (c *Cluster) readPgUsersFromDatabase(userNames []string) (users spec.PgUser
 			parameters[fields[0]] = fields[1]
 		}
 
-		users[rolname] = spec.PgUser{Name: rolname, Password: rolpassword, Flags: flags, MemberOf: memberof, Parameters: parameters}
+		// roles without an expiry are read with the zero time
+		validUntil := rolvaliduntil.Time
+		users[rolname] = spec.PgUser{Name: rolname, Password: rolpassword, Flags: flags, MemberOf: memberof, Parameters: parameters,
+			ConnectionLimit: &rolconnlimit, ValidUntil: &validUntil}
 	}
 
 	return users, nil
@@ -224,12 +306,12 @@ func (c *Cluster) readPgUsersFromDatabase(userNames []string) (users spec.PgUser
 
 // getDatabases returns the map of current databases with owners
 // The caller is responsible for opening and closing the database connection
-func (c *Cluster) getDatabases() (dbs map[string]string, err error) {
+func (c *Cluster) getDatabases(ctx context.Context) (dbs map[string]string, err error) {
 	var (
 		rows *sql.Rows
 	)
 
-	if rows, err = c.pgDb.Query(getDatabasesSQL); err != nil {
+	if rows, err = c.pgDb.QueryContext(ctx, getDatabasesSQL); err != nil {
 		return nil, fmt.Errorf("could not query database: %v", err)
 	}
 
@@ -259,24 +341,33 @@ func (c *Cluster) getDatabases() (dbs map[string]string, err error) {
 
 // executeCreateDatabase creates new database with the given owner.
 // The caller is responsible for opening and closing the database connection.
-func (c *Cluster) executeCreateDatabase(databaseName, owner string) error {
-	return c.execCreateOrAlterDatabase(databaseName, owner, createDatabaseSQL,
+func (c *Cluster) executeCreateDatabase(ctx context.Context, databaseName, owner string) error {
+	return c.execCreateOrAlterDatabase(ctx, databaseName, owner, createDatabaseSQL,
 		"creating database", "create database")
 }
 
 // executeAlterDatabaseOwner changes the owner of the given database.
 // The caller is responsible for opening and closing the database connection.
-func (c *Cluster) executeAlterDatabaseOwner(databaseName string, owner string) error {
-	return c.execCreateOrAlterDatabase(databaseName, owner, alterDatabaseOwnerSQL,
+func (c *Cluster) executeAlterDatabaseOwner(ctx context.Context, databaseName string, owner string) error {
+	return c.execCreateOrAlterDatabase(ctx, databaseName, owner, alterDatabaseOwnerSQL,
 		"changing owner for database", "alter database owner")
 }
 
-func (c *Cluster) execCreateOrAlterDatabase(databaseName, owner, statement, doing, operation string) error {
+func (c *Cluster) execCreateOrAlterDatabase(ctx context.Context, databaseName, owner, statement, doing, operation string) error {
 	if !c.databaseNameOwnerValid(databaseName, owner) {
 		return nil
 	}
 	c.logger.Infof("%s %q owner %q", doing, databaseName, owner)
-	if _, err := c.pgDb.Exec(fmt.Sprintf(statement, databaseName, owner)); err != nil {
+	query := fmt.Sprintf(statement, databaseName, owner)
+
+	var err error
+	if statement == createDatabaseSQL {
+		err = c.execLongStatement(ctx, query)
+	} else {
+		_, err = c.pgDb.ExecContext(ctx, query)
+		err = statementTimeoutError(err, c.OpConfig.DBStatementTimeout)
+	}
+	if err != nil {
 		return fmt.Errorf("could not execute %s: %v", operation, err)
 	}
 	return nil
@@ -297,13 +388,13 @@ func (c *Cluster) databaseNameOwnerValid(databaseName, owner string) bool {
 
 // getSchemas returns the list of current database schemas
 // The caller is responsible for opening and closing the database connection
-func (c *Cluster) getSchemas() (schemas []string, err error) {
+func (c *Cluster) getSchemas(ctx context.Context) (schemas []string, err error) {
 	var (
 		rows      *sql.Rows
 		dbschemas []string
 	)
 
-	if rows, err = c.pgDb.Query(getSchemasSQL); err != nil {
+	if rows, err = c.pgDb.QueryContext(ctx, getSchemasSQL); err != nil {
 		return nil, fmt.Errorf("could not query database schemas: %v", err)
 	}
 
@@ -331,25 +422,25 @@ func (c *Cluster) getSchemas() (schemas []string, err error) {
 
 // executeCreateDatabaseSchema creates new database schema with the given owner.
 // The caller is responsible for opening and closing the database connection.
-func (c *Cluster) executeCreateDatabaseSchema(databaseName, schemaName, dbOwner string, schemaOwner string) error {
-	return c.execCreateDatabaseSchema(databaseName, schemaName, dbOwner, schemaOwner, createDatabaseSchemaSQL,
+func (c *Cluster) executeCreateDatabaseSchema(ctx context.Context, databaseName, schemaName, dbOwner string, schemaOwner string) error {
+	return c.execCreateDatabaseSchema(ctx, databaseName, schemaName, dbOwner, schemaOwner, createDatabaseSchemaSQL,
 		"creating database schema", "create database schema")
 }
 
-func (c *Cluster) execCreateDatabaseSchema(databaseName, schemaName, dbOwner, schemaOwner, statement, doing, operation string) error {
+func (c *Cluster) execCreateDatabaseSchema(ctx context.Context, databaseName, schemaName, dbOwner, schemaOwner, statement, doing, operation string) error {
 	if !c.databaseSchemaNameValid(schemaName) {
 		return nil
 	}
 	c.logger.Infof("%s %q owner %q", doing, schemaName, schemaOwner)
-	if _, err := c.pgDb.Exec(fmt.Sprintf(statement, dbOwner, schemaName, schemaOwner)); err != nil {
-		return fmt.Errorf("could not execute %s: %v", operation, err)
+	if _, err := c.pgDb.ExecContext(ctx, fmt.Sprintf(statement, dbOwner, schemaName, schemaOwner)); err != nil {
+		return fmt.Errorf("could not execute %s: %v", operation, statementTimeoutError(err, c.OpConfig.DBStatementTimeout))
 	}
 
 	// set default privileges for schema
-	c.execAlterSchemaDefaultPrivileges(schemaName, schemaOwner, databaseName)
+	c.execAlterSchemaDefaultPrivileges(ctx, schemaName, schemaOwner, databaseName)
 	if schemaOwner != dbOwner {
-		c.execAlterSchemaDefaultPrivileges(schemaName, dbOwner, databaseName+"_"+schemaName)
-		c.execAlterSchemaDefaultPrivileges(schemaName, schemaOwner, databaseName+"_"+schemaName)
+		c.execAlterSchemaDefaultPrivileges(ctx, schemaName, dbOwner, databaseName+"_"+schemaName)
+		c.execAlterSchemaDefaultPrivileges(ctx, schemaName, schemaOwner, databaseName+"_"+schemaName)
 	}
 
 	return nil
@@ -363,8 +454,8 @@ func (c *Cluster) databaseSchemaNameValid(schemaName string) bool {
 	return true
 }
 
-func (c *Cluster) execAlterSchemaDefaultPrivileges(schemaName, owner, rolePrefix string) error {
-	if _, err := c.pgDb.Exec(fmt.Sprintf(schemaDefaultPrivilegesSQL, owner,
+func (c *Cluster) execAlterSchemaDefaultPrivileges(ctx context.Context, schemaName, owner, rolePrefix string) error {
+	if _, err := c.pgDb.ExecContext(ctx, fmt.Sprintf(schemaDefaultPrivilegesSQL, owner,
 		schemaName, rolePrefix+constants.ReaderRoleNameSuffix, rolePrefix+constants.WriterRoleNameSuffix, // schema
 		schemaName, rolePrefix+constants.ReaderRoleNameSuffix, // tables
 		schemaName, rolePrefix+constants.ReaderRoleNameSuffix, // sequences
@@ -378,8 +469,8 @@ func (c *Cluster) execAlterSchemaDefaultPrivileges(schemaName, owner, rolePrefix
 	return nil
 }
 
-func (c *Cluster) execAlterGlobalDefaultPrivileges(owner, rolePrefix string) error {
-	if _, err := c.pgDb.Exec(fmt.Sprintf(globalDefaultPrivilegesSQL, owner,
+func (c *Cluster) execAlterGlobalDefaultPrivileges(ctx context.Context, owner, rolePrefix string) error {
+	if _, err := c.pgDb.ExecContext(ctx, fmt.Sprintf(globalDefaultPrivilegesSQL, owner,
 		rolePrefix+constants.WriterRoleNameSuffix, rolePrefix+constants.ReaderRoleNameSuffix, // schemas
 		rolePrefix+constants.ReaderRoleNameSuffix,                                            // tables
 		rolePrefix+constants.ReaderRoleNameSuffix,                                            // sequences
@@ -393,7 +484,27 @@ func (c *Cluster) execAlterGlobalDefaultPrivileges(owner, rolePrefix string) err
 	return nil
 }
 
-func makeUserFlags(rolsuper, rolinherit, rolcreaterole, rolcreatedb, rolcanlogin bool) (result []string) {
+// executeGrantBackupPrivileges lets the backup role dump the database it is connected to.
+// The caller is responsible for opening and closing the database connection.
+func (c *Cluster) executeGrantBackupPrivileges(ctx context.Context, databaseName, backupUser string) error {
+	if _, err := c.pgDb.ExecContext(ctx, fmt.Sprintf(grantBackupDatabaseSQL, databaseName, backupUser)); err != nil {
+		return fmt.Errorf("could not grant connect on database %q: %v", databaseName, statementTimeoutError(err, c.OpConfig.DBStatementTimeout))
+	}
+
+	schemas, err := c.getSchemas(ctx)
+	if err != nil {
+		return fmt.Errorf("could not get current schemas: %v", err)
+	}
+	for _, schemaName := range schemas {
+		if _, err = c.pgDb.ExecContext(ctx, fmt.Sprintf(grantBackupSchemaSQL, schemaName, backupUser)); err != nil {
+			return fmt.Errorf("could not grant read access on schema %q: %v", schemaName, statementTimeoutError(err, c.OpConfig.DBStatementTimeout))
+		}
+	}
+
+	return nil
+}
+
+func makeUserFlags(rolsuper, rolinherit, rolcreaterole, rolcreatedb, rolcanlogin, rolreplication, rolbypassrls bool) (result []string) {
 	if rolsuper {
 		result = append(result, constants.RoleFlagSuperuser)
 	}
@@ -409,18 +520,24 @@ func makeUserFlags(rolsuper, rolinherit, rolcreaterole, rolcreatedb, rolcanlogin
 	if rolcanlogin {
 		result = append(result, constants.RoleFlagLogin)
 	}
+	if rolreplication {
+		result = append(result, constants.RoleFlagReplication)
+	}
+	if rolbypassrls {
+		result = append(result, constants.RoleFlagByPassRLS)
+	}
 
 	return result
 }
 
 // getExtension returns the list of current database extensions
 // The caller is responsible for opening and closing the database connection
-func (c *Cluster) getExtensions() (dbExtensions map[string]string, err error) {
+func (c *Cluster) getExtensions(ctx context.Context) (dbExtensions map[string]string, err error) {
 	var (
 		rows *sql.Rows
 	)
 
-	if rows, err = c.pgDb.Query(getExtensionsSQL); err != nil {
+	if rows, err = c.pgDb.QueryContext(ctx, getExtensionsSQL); err != nil {
 		return nil, fmt.Errorf("could not query database extensions: %v", err)
 	}
 
@@ -448,25 +565,125 @@ func (c *Cluster) getExtensions() (dbExtensions map[string]string, err error) {
 	return dbExtensions, err
 }
 
+// getSharedPreloadLibraries returns the libraries the running Postgres loaded, which differ from the configured
+// ones until Postgres is restarted.
+// The caller is responsible for opening and closing the database connection
+func (c *Cluster) getSharedPreloadLibraries(ctx context.Context) ([]string, error) {
+	var libraries string
+	if err := c.pgDb.QueryRowContext(ctx, getSharedPreloadLibrariesSQL).Scan(&libraries); err != nil {
+		return nil, fmt.Errorf("could not query shared_preload_libraries: %v", err)
+	}
+	return splitLibraries(libraries), nil
+}
+
+// replicationSlot is a replication slot of the primary and the amount of WAL it retains
+type replicationSlot struct {
+	Active        bool
+	RetainedBytes int64
+}
+
+// getReplicationSlots returns the replication slots of the primary
+// The caller is responsible for opening and closing the database connection
+func (c *Cluster) getReplicationSlots(ctx context.Context) (slots map[string]replicationSlot, err error) {
+	var (
+		rows *sql.Rows
+	)
+
+	if rows, err = c.pgDb.QueryContext(ctx, getReplicationSlotsSQL); err != nil {
+		return nil, fmt.Errorf("could not query replication slots: %v", err)
+	}
+
+	defer func() {
+		if err2 := rows.Close(); err2 != nil {
+			if err != nil {
+				err = fmt.Errorf("error when closing query cursor: %v, previous error: %v", err2, err)
+			} else {
+				err = fmt.Errorf("error when closing query cursor: %v", err2)
+			}
+		}
+	}()
+
+	slots = make(map[string]replicationSlot)
+
+	for rows.Next() {
+		var (
+			name string
+			slot replicationSlot
+		)
+
+		if err = rows.Scan(&name, &slot.Active, &slot.RetainedBytes); err != nil {
+			return nil, fmt.Errorf("error when processing row: %v", err)
+		}
+		slots[name] = slot
+	}
+
+	return slots, err
+}
+
+// getTablespaces returns the set of current tablespaces
+// The caller is responsible for opening and closing the database connection
+func (c *Cluster) getTablespaces(ctx context.Context) (tablespaces map[string]bool, err error) {
+	var (
+		rows *sql.Rows
+	)
+
+	if rows, err = c.pgDb.QueryContext(ctx, getTablespacesSQL); err != nil {
+		return nil, fmt.Errorf("could not query tablespaces: %v", err)
+	}
+
+	defer func() {
+		if err2 := rows.Close(); err2 != nil {
+			if err != nil {
+				err = fmt.Errorf("error when closing query cursor: %v, previous error: %v", err2, err)
+			} else {
+				err = fmt.Errorf("error when closing query cursor: %v", err2)
+			}
+		}
+	}()
+
+	tablespaces = make(map[string]bool)
+
+	for rows.Next() {
+		var tablespace string
+
+		if err = rows.Scan(&tablespace); err != nil {
+			return nil, fmt.Errorf("error when processing row: %v", err)
+		}
+		tablespaces[tablespace] = true
+	}
+
+	return tablespaces, err
+}
+
+// executeCreateTablespace creates a new tablespace in the given directory.
+// The caller is responsible for opening and closing the database connection.
+func (c *Cluster) executeCreateTablespace(ctx context.Context, name, location string) error {
+	c.logger.Infof("creating tablespace %q in %q", name, location)
+	if _, err := c.pgDb.ExecContext(ctx, fmt.Sprintf(createTablespaceSQL, name, location)); err != nil {
+		return fmt.Errorf("could not execute create tablespace: %v", statementTimeoutError(err, c.OpConfig.DBStatementTimeout))
+	}
+	return nil
+}
+
 // executeCreateExtension creates new extension in the given schema.
 // The caller is responsible for opening and closing the database connection.
-func (c *Cluster) executeCreateExtension(extName, schemaName string) error {
-	return c.execCreateOrAlterExtension(extName, schemaName, createExtensionSQL,
+func (c *Cluster) executeCreateExtension(ctx context.Context, extName, schemaName string) error {
+	return c.execCreateOrAlterExtension(ctx, extName, schemaName, createExtensionSQL,
 		"creating extension", "create extension")
 }
 
 // executeAlterExtension changes the schema of the given extension.
 // The caller is responsible for opening and closing the database connection.
-func (c *Cluster) executeAlterExtension(extName, schemaName string) error {
-	return c.execCreateOrAlterExtension(extName, schemaName, alterExtensionSQL,
+func (c *Cluster) executeAlterExtension(ctx context.Context, extName, schemaName string) error {
+	return c.execCreateOrAlterExtension(ctx, extName, schemaName, alterExtensionSQL,
 		"changing schema for extension", "alter extension schema")
 }
 
-func (c *Cluster) execCreateOrAlterExtension(extName, schemaName, statement, doing, operation string) error {
+func (c *Cluster) execCreateOrAlterExtension(ctx context.Context, extName, schemaName, statement, doing, operation string) error {
 
 	c.logger.Infof("%s %q schema %q", doing, extName, schemaName)
-	if _, err := c.pgDb.Exec(fmt.Sprintf(statement, extName, schemaName)); err != nil {
-		return fmt.Errorf("could not execute %s: %v", operation, err)
+	if _, err := c.pgDb.ExecContext(ctx, fmt.Sprintf(statement, extName, schemaName)); err != nil {
+		return fmt.Errorf("could not execute %s: %v", operation, statementTimeoutError(err, c.OpConfig.DBStatementTimeout))
 	}
 
 	return nil
@@ -479,37 +696,20 @@ func (c *Cluster) installLookupFunction(poolerSchema, poolerUser string, role Po
 
 	c.logger.Info("Installing lookup function")
 
-	// Open a new connection if not yet done. This connection will be used only
-	// to get the list of databases, not for the actuall installation.
-	if err := c.initDbConn(); err != nil {
-		return fmt.Errorf("could not init database connection")
-	}
-	defer func() {
-		if c.connectionIsClosed() {
-			return
-		}
-
-		if err := c.closeDbConn(); err != nil {
-			c.logger.Errorf("could not close database connection: %v", err)
-		}
-	}()
-
 	// List of databases we failed to process. At the moment it function just
 	// like a flag to retry on the next sync, but in the future we may want to
 	// retry only necessary parts, so let's keep the list.
 	failedDatabases := []string{}
-	currentDatabases, err := c.getDatabases()
+	var currentDatabases map[string]string
+	err := c.withDbConn("", func() (err error) {
+		currentDatabases, err = c.getDatabases(context.TODO())
+		return err
+	})
 	if err != nil {
 		msg := "could not get databases to install pooler lookup function: %v"
 		return fmt.Errorf(msg, err)
 	}
 
-	// We've got the list of target databases, now close this connection to
-	// open a new one to every each of them.
-	if err := c.closeDbConn(); err != nil {
-		c.logger.Errorf("could not close database connection: %v", err)
-	}
-
 	templater := template.Must(template.New("sql").Parse(connectionPoolerLookup))
 	params := TemplateParams{
 		"pooler_schema": poolerSchema,
@@ -539,22 +739,15 @@ func (c *Cluster) installLookupFunction(poolerSchema, poolerUser string, role Po
 			constants.PostgresConnectRetryTimeout,
 			func() (bool, error) {
 
-				// At this moment we are not connected to any database
-				if err := c.initDbConnWithName(dbname); err != nil {
-					msg := "could not init database connection to %s"
-					return false, fmt.Errorf(msg, dbname)
-				}
-				defer func() {
-					if err := c.closeDbConn(); err != nil {
-						msg := "could not close database connection: %v"
-						c.logger.Errorf(msg, err)
+				err = c.withDbConn(dbname, func() error {
+					if _, err := c.pgDb.Exec(stmtBytes.String()); err != nil {
+						return fmt.Errorf("could not execute sql statement %s: %v",
+							stmtBytes.String(), err)
 					}
-				}()
-
-				if _, err = c.pgDb.Exec(stmtBytes.String()); err != nil {
-					msg := fmt.Errorf("could not execute sql statement %s: %v",
-						stmtBytes.String(), err)
-					return false, msg
+					return nil
+				})
+				if err != nil {
+					return false, err
 				}
 
 				return true, nil
@@ -576,3 +769,84 @@ func (c *Cluster) installLookupFunction(poolerSchema, poolerUser string, role Po
 
 	return nil
 }
+
+// markInitScriptsPending reports the init scripts of a new cluster as pending in its status. Only clusters
+// carrying this condition run their init scripts on sync, so scripts added to an existing cluster never run.
+func (c *Cluster) markInitScriptsPending() error {
+	if len(c.Spec.InitScripts) == 0 {
+		return nil
+	}
+	return c.setCondition(acidv1.ClusterCondition{
+		Type:    acidv1.ClusterConditionInitScriptsCompleted,
+		Status:  v1.ConditionFalse,
+		Reason:  acidv1.ClusterConditionReasonInitScriptsPending,
+		Message: "waiting for the cluster to become ready to run the init scripts",
+	})
+}
+
+// initScriptsPending tells whether init scripts of the cluster creation are left to run
+func (c *Cluster) initScriptsPending() bool {
+	for _, condition := range c.Status.Conditions {
+		if condition.Type == acidv1.ClusterConditionInitScriptsCompleted {
+			return condition.Status == v1.ConditionFalse
+		}
+	}
+	return false
+}
+
+// runInitScripts runs the init scripts not recorded as completed in the cluster status yet. A script is
+// recorded right after it has run, should that fail the script runs again on the next attempt. Scripts
+// consisting of several statements run as one implicit transaction.
+func (c *Cluster) runInitScripts(ctx context.Context) error {
+	c.setProcessName("running init scripts")
+
+	completed := make(map[string]bool, len(c.Status.InitScripts))
+	for _, name := range c.Status.InitScripts {
+		completed[name] = true
+	}
+
+	for _, script := range c.Spec.InitScripts {
+		if completed[script.Name] {
+			continue
+		}
+		statement, err := c.initScriptSQL(ctx, script)
+		if err != nil {
+			return err
+		}
+		if err = c.executeInitScript(ctx, script.Database, statement); err != nil {
+			return fmt.Errorf("could not run init script %q: %v", script.Name, err)
+		}
+		c.logger.Infof("init script %q has been run", script.Name)
+
+		initScripts := append(append([]string{}, c.Status.InitScripts...), script.Name)
+		if _, err = c.KubeClient.SetPostgresCRDInitScripts(c.clusterName(), initScripts); err != nil {
+			return fmt.Errorf("could not record init script %q: %v", script.Name, err)
+		}
+		c.Status.InitScripts = initScripts
+	}
+
+	return c.setCondition(acidv1.ClusterCondition{
+		Type:   acidv1.ClusterConditionInitScriptsCompleted,
+		Status: v1.ConditionTrue,
+		Reason: acidv1.ClusterConditionReasonAllInitScriptsCompleted,
+	})
+}
+
+// initScriptSQL reads the statements of an init script from its config map
+func (c *Cluster) initScriptSQL(ctx context.Context, script acidv1.InitScript) (string, error) {
+	configMap, err := c.KubeClient.ConfigMaps(c.Namespace).Get(ctx, script.ConfigMap, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("could not get config map %q of init script %q: %v", script.ConfigMap, script.Name, err)
+	}
+	statement, ok := configMap.Data[script.Key]
+	if !ok {
+		return "", fmt.Errorf("config map %q has no key %q for init script %q", script.ConfigMap, script.Key, script.Name)
+	}
+	return statement, nil
+}
+
+func (c *Cluster) executeInitScript(ctx context.Context, database, statement string) error {
+	return c.withDbConn(database, func() error {
+		return c.execLongStatement(ctx, statement)
+	})
+}
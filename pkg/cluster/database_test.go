@@ -0,0 +1,71 @@
+package cluster
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	acidv1 "github.com/zalando/postgres-operator/pkg/apis/acid.zalan.do/v1"
+	"github.com/zalando/postgres-operator/pkg/util/k8sutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// fakeDriver opens connections to no server at all, so the connection handling can be tested without Postgres
+type fakeDriver struct{}
+
+type fakeConn struct{}
+
+func (d fakeDriver) Open(name string) (driver.Conn, error) {
+	return fakeConn{}, nil
+}
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c fakeConn) Close() error {
+	return nil
+}
+
+func (c fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not supported")
+}
+
+func init() {
+	sql.Register("fake", fakeDriver{})
+}
+
+func TestWithDbConn(t *testing.T) {
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "acid-test-cluster",
+			Namespace: "default",
+		},
+	}
+	var cluster = New(Config{}, k8sutil.KubernetesClient{}, pg, logger, eventRecorder)
+	cluster.openDb = func(connstring string) (*sql.DB, error) { return sql.Open("fake", connstring) }
+
+	// the connection of the caller is set aside and restored afterwards
+	callerConn, err := sql.Open("fake", "")
+	assert.NoError(t, err)
+	defer callerConn.Close()
+	cluster.pgDb = callerConn
+
+	for _, stepErr := range []error{nil, errors.New("step failed")} {
+		var stepConn *sql.DB
+		err = cluster.withDbConn("foo", func() error {
+			stepConn = cluster.pgDb
+			return stepErr
+		})
+		assert.Equal(t, stepErr, err)
+
+		// the connection to the database is closed on success and on error
+		assert.NotNil(t, stepConn)
+		assert.True(t, stepConn != callerConn)
+		assert.EqualError(t, stepConn.Ping(), "sql: database is closed")
+		assert.True(t, cluster.pgDb == callerConn)
+		assert.NoError(t, callerConn.Ping())
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"strings"
 
 	v1 "k8s.io/api/core/v1"
@@ -19,6 +20,18 @@ import (
 func (c *Cluster) ExecCommand(podName *spec.NamespacedName, command ...string) (string, error) {
 	c.setProcessName("executing command %q", strings.Join(command, " "))
 
+	return c.execInPod(podName, nil, command...)
+}
+
+// ExecCommandWithInput executes a command inside the pod and passes the input on its standard input, e.g. secrets
+// which must not show up in the arguments. Neither the arguments nor the input are reported as process name.
+func (c *Cluster) ExecCommandWithInput(podName *spec.NamespacedName, input string, command ...string) (string, error) {
+	c.setProcessName("executing command %q with input", command[0])
+
+	return c.execInPod(podName, strings.NewReader(input), command...)
+}
+
+func (c *Cluster) execInPod(podName *spec.NamespacedName, stdin io.Reader, command ...string) (string, error) {
 	var (
 		execOut bytes.Buffer
 		execErr bytes.Buffer
@@ -50,6 +63,7 @@ func (c *Cluster) ExecCommand(podName *spec.NamespacedName, command ...string) (
 	req.VersionedParams(&v1.PodExecOptions{
 		Container: pod.Spec.Containers[targetContainer].Name,
 		Command:   command,
+		Stdin:     stdin != nil,
 		Stdout:    true,
 		Stderr:    true,
 	}, scheme.ParameterCodec)
@@ -60,6 +74,7 @@ func (c *Cluster) ExecCommand(podName *spec.NamespacedName, command ...string) (
 	}
 
 	err = exec.Stream(remotecommand.StreamOptions{
+		Stdin:  stdin,
 		Stdout: &execOut,
 		Stderr: &execErr,
 		Tty:    false,
@@ -2,6 +2,7 @@ package cluster
 
 import (
 	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"path"
@@ -14,8 +15,11 @@ import (
 	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
 	policybeta1 "k8s.io/api/policy/v1beta1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
 
@@ -25,6 +29,7 @@ import (
 	"github.com/zalando/postgres-operator/pkg/util/config"
 	"github.com/zalando/postgres-operator/pkg/util/constants"
 	"github.com/zalando/postgres-operator/pkg/util/k8sutil"
+	"github.com/zalando/postgres-operator/pkg/util/patroni"
 	batchv1 "k8s.io/api/batch/v1"
 	batchv1beta1 "k8s.io/api/batch/v1beta1"
 	"k8s.io/apimachinery/pkg/labels"
@@ -32,14 +37,76 @@ import (
 
 const (
 	pgBinariesLocationTemplate       = "/usr/lib/postgresql/%v/bin"
+	spiloEntrypoint                  = "/launch.sh"
 	patroniPGBinariesParameterName   = "bin_dir"
 	patroniPGParametersParameterName = "parameters"
 	patroniPGHBAConfParameterName    = "pg_hba"
 	localHost                        = "127.0.0.1/32"
+	sharedPreloadLibrariesParameter  = "shared_preload_libraries"
+	loggingCollectorParameter        = "logging_collector"
+	auditLibrary                     = "pgaudit"
+	auditLogParameter                = "pgaudit.log"
+	readOnlyParameter                = "default_transaction_read_only"
+	defaultPatroniLoopWait           = 10
 	connectionPoolerContainer        = "connection-pooler"
 	pgPort                           = 5432
+	patroniPort                      = 8008
+	metricsPortName                  = "metrics"
+	defaultMetricsPath               = "/metrics"
+	storageClassAnnotation           = "volume.beta.kubernetes.io/storage-class"
 )
 
+// Patroni leaves pg_ident.conf untouched without any lines, so this one replaces the maps removed from the manifest
+const pgIdentEmptyComment = "# no user name maps defined in the manifest"
+
+const (
+	backupVerificationJobPrefix    = "backup-verification-"
+	defaultBackupVerificationQuery = "SELECT 1"
+	// the postgres user and group of the Spilo image, pg_ctl refuses to run as root
+	spiloUserID  int64 = 101
+	spiloGroupID int64 = 103
+)
+
+// backupVerificationScript fetches the latest base backup from the WAL archive of the cluster the way Spilo stores
+// it, recovers it to the end of the backup and runs the verification query against it. The backup is restored into
+// the data directory of Spilo, its configuration refers to pg_hba.conf and pg_ident.conf with absolute paths.
+const backupVerificationScript = `set -euo pipefail
+prefix="spilo/${WAL_BUCKET_SCOPE_PREFIX}${SCOPE}${WAL_BUCKET_SCOPE_SUFFIX}/wal/${PGVERSION}"
+if [ -n "${WAL_S3_BUCKET:-}" ]; then
+    export WALG_S3_PREFIX="s3://${WAL_S3_BUCKET}/${prefix}"
+else
+    export WALG_GS_PREFIX="gs://${WAL_GS_BUCKET}/${prefix}"
+fi
+export PGDATA=/home/postgres/pgdata/pgroot/data
+wal-g backup-fetch "$PGDATA" LATEST
+if [ "${PGVERSION%%.*}" -ge 12 ]; then
+    touch "$PGDATA/recovery.signal"
+    recovery_conf="$PGDATA/postgresql.auto.conf"
+else
+    recovery_conf="$PGDATA/recovery.conf"
+fi
+cat >> "$recovery_conf" <<'EOF'
+restore_command = 'wal-g wal-fetch "%f" "%p"'
+recovery_target = 'immediate'
+recovery_target_action = 'promote'
+EOF
+"/usr/lib/postgresql/${PGVERSION}/bin/pg_ctl" start -w -t 3600 -D "$PGDATA" \
+    -o "-c listen_addresses='' -c unix_socket_directories=/tmp -c archive_mode=off -c ssl=off"
+psql -h /tmp -d postgres -v ON_ERROR_STOP=1 -c "$VERIFY_QUERY"
+`
+
+var podMonitorResource = schema.GroupVersionResource{
+	Group:    "monitoring.coreos.com",
+	Version:  "v1",
+	Resource: "podmonitors",
+}
+
+var tcpRouteResource = schema.GroupVersionResource{
+	Group:    "gateway.networking.k8s.io",
+	Version:  "v1alpha2",
+	Resource: "tcproutes",
+}
+
 type pgUser struct {
 	Password string   `json:"password"`
 	Options  []string `json:"options"`
@@ -49,9 +116,10 @@ type patroniDCS struct {
 	TTL                      uint32                       `json:"ttl,omitempty"`
 	LoopWait                 uint32                       `json:"loop_wait,omitempty"`
 	RetryTimeout             uint32                       `json:"retry_timeout,omitempty"`
-	MaximumLagOnFailover     float32                      `json:"maximum_lag_on_failover,omitempty"`
+	MaximumLagOnFailover     int64                        `json:"maximum_lag_on_failover,omitempty"`
 	SynchronousMode          bool                         `json:"synchronous_mode,omitempty"`
 	SynchronousModeStrict    bool                         `json:"synchronous_mode_strict,omitempty"`
+	SynchronousNodeCount     uint32                       `json:"synchronous_node_count,omitempty"`
 	PGBootstrapConfiguration map[string]interface{}       `json:"postgresql,omitempty"`
 	Slots                    map[string]map[string]string `json:"slots,omitempty"`
 }
@@ -115,6 +183,10 @@ func (c *Cluster) servicePort(role PostgresRole) string {
 	return ""
 }
 
+func (c *Cluster) patroniRoleName() string {
+	return c.Name + "-patroni"
+}
+
 func (c *Cluster) podDisruptionBudgetName() string {
 	return c.OpConfig.PDBNameFormat.Format("cluster", c.Name)
 }
@@ -247,8 +319,8 @@ PatroniInitDBParams:
 		config.Bootstrap.Initdb = append(config.Bootstrap.Initdb, map[string]string{k: v})
 	}
 
-	if patroni.MaximumLagOnFailover >= 0 {
-		config.Bootstrap.DCS.MaximumLagOnFailover = patroni.MaximumLagOnFailover
+	if patroni.MaximumLagOnFailover != nil {
+		config.Bootstrap.DCS.MaximumLagOnFailover = *patroni.MaximumLagOnFailover
 	}
 	if patroni.LoopWait != 0 {
 		config.Bootstrap.DCS.LoopWait = patroni.LoopWait
@@ -262,12 +334,16 @@ PatroniInitDBParams:
 	if patroni.Slots != nil {
 		config.Bootstrap.DCS.Slots = patroni.Slots
 	}
-	if patroni.SynchronousMode {
-		config.Bootstrap.DCS.SynchronousMode = patroni.SynchronousMode
+	synchronousMode := patroni.SynchronousMode != nil && *patroni.SynchronousMode
+	if synchronousMode {
+		config.Bootstrap.DCS.SynchronousMode = synchronousMode
 	}
 	if patroni.SynchronousModeStrict != false {
 		config.Bootstrap.DCS.SynchronousModeStrict = patroni.SynchronousModeStrict
 	}
+	if synchronousMode && patroni.SynchronousNodeCount != 0 {
+		config.Bootstrap.DCS.SynchronousNodeCount = patroni.SynchronousNodeCount
+	}
 
 	config.PgLocalConfiguration = make(map[string]interface{})
 
@@ -307,6 +383,21 @@ PatroniInitDBParams:
 	return string(res), err
 }
 
+// postgresqlParam returns the Postgres parameters of the manifest with password_encryption following the password
+// encryption of the roles, so the passwords set by the users themselves are encrypted the same way
+func postgresqlParam(spec *acidv1.PostgresSpec) *acidv1.PostgresqlParam {
+	if _, ok := spec.Parameters["password_encryption"]; ok || spec.PasswordEncryption == "" {
+		return &spec.PostgresqlParam
+	}
+	pg := spec.PostgresqlParam
+	pg.Parameters = make(map[string]string, len(spec.Parameters)+1)
+	for name, value := range spec.Parameters {
+		pg.Parameters[name] = value
+	}
+	pg.Parameters["password_encryption"] = spec.PasswordEncryption
+	return &pg
+}
+
 func getLocalAndBoostrapPostgreSQLParameters(parameters map[string]string) (local, bootstrap map[string]string) {
 	local = make(map[string]string)
 	bootstrap = make(map[string]string)
@@ -386,6 +477,17 @@ func generatePodAffinity(labels labels.Set, topologyKey string, nodeAffinity *v1
 	return &podAffinity
 }
 
+// podAntiAffinity returns whether required pod anti-affinity is enabled and its topology key,
+// the settings in the manifest take precedence over the operator configuration
+func (c *Cluster) podAntiAffinity(spec *acidv1.PostgresSpec) (bool, string) {
+	enabled := c.OpConfig.EnablePodAntiAffinity
+	if spec.EnablePodAntiAffinity != nil {
+		enabled = *spec.EnablePodAntiAffinity
+	}
+
+	return enabled, util.Coalesce(spec.PodAntiAffinityTopologyKey, c.OpConfig.PodAntiAffinityTopologyKey)
+}
+
 func tolerations(tolerationsSpec *[]v1.Toleration, podToleration map[string]string) []v1.Toleration {
 	// allow to override tolerations by postgresql manifest
 	if len(*tolerationsSpec) > 0 {
@@ -423,6 +525,201 @@ func isBootstrapOnlyParameter(param string) bool {
 		param == "track_commit_timestamp"
 }
 
+// isLoggingParameter checks against the Postgres logging parameters. Those stay in the local configuration of the
+// pods, moving them to the bootstrap configuration would roll every cluster setting them, and a change is set
+// through the Patroni API in addition, so that it takes effect on the running pods.
+func isLoggingParameter(param string) bool {
+	return strings.HasPrefix(param, "log_") || param == loggingCollectorParameter
+}
+
+// isAuditParameter checks against the parameters of pgaudit
+func isAuditParameter(param string) bool {
+	return strings.HasPrefix(param, auditLibrary+".")
+}
+
+// isReloadParameter tells whether a parameter set through the Patroni API takes effect with a reload of Postgres,
+// all of the others require a restart
+func isReloadParameter(param string) bool {
+	return (isLoggingParameter(param) && param != loggingCollectorParameter) || isAuditParameter(param) ||
+		param == "effective_cache_size" || param == "maintenance_work_mem" || param == readOnlyParameter
+}
+
+// auditParameters derives the Postgres parameters of the audit section: pgaudit is added to the preloaded
+// libraries, which requires a restart, and the pgaudit settings take effect with a reload. Without the section
+// nothing is derived.
+func auditParameters(audit *acidv1.Audit) map[string]string {
+	if audit == nil {
+		return map[string]string{}
+	}
+
+	log := "none"
+	if len(audit.Log) > 0 {
+		log = strings.Join(audit.Log, ",")
+	}
+	logCatalog := true
+	if audit.LogCatalog != nil {
+		logCatalog = *audit.LogCatalog
+	}
+	parameters := map[string]string{
+		sharedPreloadLibrariesParameter: auditLibrary,
+		auditLogParameter:               log,
+		"pgaudit.log_catalog":           postgresBool(logCatalog),
+		"pgaudit.log_parameter":         postgresBool(audit.LogParameter),
+		"pgaudit.log_relation":          postgresBool(audit.LogRelation),
+	}
+	if audit.Role != "" {
+		parameters["pgaudit.role"] = audit.Role
+	}
+	return parameters
+}
+
+// postgresBool formats a boolean the way Postgres reports it
+func postgresBool(value bool) string {
+	if value {
+		return "on"
+	}
+	return "off"
+}
+
+// memoryTunedParameters derives the memory settings of Postgres from the memory limit of the Postgres container:
+// a quarter of it for shared_buffers, three quarters for effective_cache_size and 5%, at most 2GB, for
+// maintenance_work_mem. The values of the manifest parameters take precedence. Without a limit nothing is derived.
+func memoryTunedParameters(memoryLimit resource.Quantity, parameters map[string]string) map[string]string {
+	tuned := make(map[string]string)
+	limitMB := memoryLimit.Value() / (1024 * 1024)
+	if limitMB <= 0 {
+		return tuned
+	}
+
+	maintenanceWorkMemMB := limitMB * 5 / 100
+	if maintenanceWorkMemMB > 2048 {
+		maintenanceWorkMemMB = 2048
+	}
+	derived := map[string]int64{
+		"shared_buffers":       limitMB / 4,
+		"effective_cache_size": limitMB * 3 / 4,
+		"maintenance_work_mem": maintenanceWorkMemMB,
+	}
+	for name, valueMB := range derived {
+		if value, ok := parameters[name]; ok {
+			tuned[name] = value
+		} else if valueMB > 0 {
+			tuned[name] = fmt.Sprintf("%dMB", valueMB)
+		}
+	}
+	return tuned
+}
+
+// validateBootstrapOnlyParameter checks the value of a bootstrap only parameter against the
+// type and range Postgres expects, so a typo is reported before the Patroni API is called
+func validateBootstrapOnlyParameter(param, value string) error {
+	var min, max int
+
+	switch param {
+	case "max_connections":
+		min, max = 1, 262143
+	case "max_worker_processes", "max_prepared_transactions":
+		min, max = 0, 262143
+	case "max_locks_per_transaction":
+		min, max = 10, 2147483647
+	case "wal_level":
+		switch strings.ToLower(strings.TrimSpace(value)) {
+		case "minimal", "replica", "logical", "archive", "hot_standby":
+			return nil
+		}
+		return fmt.Errorf("invalid value %q for parameter %q: must be one of minimal, replica or logical", value, param)
+	case "wal_log_hints", "track_commit_timestamp":
+		if !isPostgresBool(value) {
+			return fmt.Errorf("invalid value %q for parameter %q: must be a boolean", value, param)
+		}
+		return nil
+	case sharedPreloadLibrariesParameter:
+		for _, library := range strings.Split(value, ",") {
+			if !libraryNameRegexp.MatchString(strings.TrimSpace(library)) {
+				return fmt.Errorf("invalid library %q for parameter %q", strings.TrimSpace(library), param)
+			}
+		}
+		return nil
+	default:
+		return nil
+	}
+
+	number, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return fmt.Errorf("invalid value %q for parameter %q: must be an integer", value, param)
+	}
+	if number < min || number > max {
+		return fmt.Errorf("invalid value %q for parameter %q: must be between %d and %d", value, param, min, max)
+	}
+	return nil
+}
+
+// splitLibraries returns the libraries of a shared_preload_libraries value in their order, without duplicates
+func splitLibraries(value string) []string {
+	libraries := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, library := range strings.Split(value, ",") {
+		library = strings.TrimSpace(library)
+		if library == "" || seen[library] {
+			continue
+		}
+		seen[library] = true
+		libraries = append(libraries, library)
+	}
+	return libraries
+}
+
+// mergeSharedPreloadLibraries appends the libraries of the manifest that are not loaded yet to the loaded ones, so
+// the libraries Spilo preloads by default are kept, and leaves out the loaded libraries that were removed from the
+// manifest. It returns the merged list along with the added and the removed libraries.
+func mergeSharedPreloadLibraries(loaded []string, desired string, removedLibraries map[string]bool) (string, []string,
+	[]string) {
+	desiredLibraries := splitLibraries(desired)
+	wanted := make(map[string]bool, len(desiredLibraries))
+	for _, library := range desiredLibraries {
+		wanted[library] = true
+	}
+
+	libraries := make([]string, 0, len(loaded))
+	removed := make([]string, 0)
+	isLoaded := make(map[string]bool, len(loaded))
+	for _, library := range loaded {
+		isLoaded[library] = true
+		if removedLibraries[library] && !wanted[library] {
+			removed = append(removed, library)
+			continue
+		}
+		libraries = append(libraries, library)
+	}
+
+	added := make([]string, 0)
+	for _, library := range desiredLibraries {
+		if !isLoaded[library] {
+			libraries = append(libraries, library)
+			added = append(added, library)
+		}
+	}
+	return strings.Join(libraries, ","), added, removed
+}
+
+// isPostgresBool mimics the boolean parsing of Postgres, which accepts unique prefixes as well
+func isPostgresBool(value string) bool {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return false
+	}
+	switch value {
+	case "1", "0", "on", "of", "off":
+		return true
+	}
+	for _, word := range []string{"true", "false", "yes", "no"} {
+		if strings.HasPrefix(word, value) {
+			return true
+		}
+	}
+	return false
+}
+
 func generateVolumeMounts(volume acidv1.Volume) []v1.VolumeMount {
 	return []v1.VolumeMount{
 		{
@@ -433,6 +730,33 @@ func generateVolumeMounts(volume acidv1.Volume) []v1.VolumeMount {
 	}
 }
 
+// tablespaceVolumeName returns the name of the volume holding the tablespace,
+// the tablespace name validation guarantees a valid DNS label
+func tablespaceVolumeName(name string) string {
+	return constants.TablespaceVolumePrefix + strings.Replace(name, "_", "-", -1)
+}
+
+func tablespaceMountPath(name string) string {
+	return path.Join(constants.TablespacesMount, name)
+}
+
+// tablespaceLocation returns the directory of the tablespace, Postgres needs
+// an empty directory owned by the postgres user, so it cannot be the mount point
+func tablespaceLocation(name string) string {
+	return path.Join(tablespaceMountPath(name), "data")
+}
+
+func generateTablespaceVolumeMounts(tablespaces []acidv1.Tablespace) []v1.VolumeMount {
+	volumeMounts := make([]v1.VolumeMount, 0, len(tablespaces))
+	for _, tablespace := range tablespaces {
+		volumeMounts = append(volumeMounts, v1.VolumeMount{
+			Name:      tablespaceVolumeName(tablespace.Name),
+			MountPath: tablespaceMountPath(tablespace.Name),
+		})
+	}
+	return volumeMounts
+}
+
 func generateContainer(
 	name string,
 	dockerImage *string,
@@ -472,6 +796,220 @@ func generateContainer(
 	}
 }
 
+// referencesSpiloEntrypoint tells whether the Spilo entrypoint, which starts Patroni, is still called by an overridden
+// command of the Postgres container. The Spilo image only defines a default command, so args replace it as well.
+func referencesSpiloEntrypoint(command, args []string) bool {
+	for _, arg := range append(append([]string{}, command...), args...) {
+		if strings.Contains(arg, spiloEntrypoint) {
+			return true
+		}
+	}
+	return false
+}
+
+// preStopSwitchoverLifecycle asks Patroni to hand the leader role of the stopping pod over to a replica.
+// Patroni rejects the request on replicas and without a suitable candidate, which must not block the shutdown.
+func preStopSwitchoverLifecycle(scheme v1.URIScheme) *v1.Lifecycle {
+	command := `curl -s -X POST -d "{\"leader\": \"$HOSTNAME\"}" http://localhost:8008/switchover || true`
+	if scheme == v1.URISchemeHTTPS {
+		// the certificate is issued for the pod, not for localhost
+		command = `curl -s -k -X POST -d "{\"leader\": \"$HOSTNAME\"}" https://localhost:8008/switchover || true`
+	}
+	return &v1.Lifecycle{
+		PreStop: &v1.Handler{
+			Exec: &v1.ExecAction{
+				Command: []string{"/bin/sh", "-c", command},
+			},
+		},
+	}
+}
+
+// patroniAPIScheme returns the scheme the Patroni REST API is served with
+func patroniAPIScheme(spec *acidv1.PostgresSpec) v1.URIScheme {
+	if spec.Patroni.APITLS != nil && spec.Patroni.APITLS.SecretName != "" {
+		return v1.URISchemeHTTPS
+	}
+	return v1.URISchemeHTTP
+}
+
+// generateHTTPProbe probes an HTTP endpoint of a container. All fields are set explicitly, including the
+// Kubernetes defaults, so that the probe of a running statefulset compares equal to a generated one.
+func generateHTTPProbe(path string, port int, scheme v1.URIScheme, probe *acidv1.Probe) *v1.Probe {
+	if probe == nil {
+		return nil
+	}
+	result := &v1.Probe{
+		Handler: v1.Handler{
+			HTTPGet: &v1.HTTPGetAction{
+				Path:   path,
+				Port:   intstr.FromInt(port),
+				Scheme: scheme,
+			},
+		},
+		InitialDelaySeconds: probe.InitialDelaySeconds,
+		TimeoutSeconds:      1,
+		PeriodSeconds:       10,
+		SuccessThreshold:    1,
+		FailureThreshold:    3,
+	}
+	if probe.TimeoutSeconds > 0 {
+		result.TimeoutSeconds = probe.TimeoutSeconds
+	}
+	if probe.PeriodSeconds > 0 {
+		result.PeriodSeconds = probe.PeriodSeconds
+	}
+	if probe.FailureThreshold > 0 {
+		result.FailureThreshold = probe.FailureThreshold
+	}
+	return result
+}
+
+// withMetricsExporter exposes the metrics port on the exporter sidecar and probes its metrics path
+func (c *Cluster) withMetricsExporter(containers []v1.Container, exporter *acidv1.MetricsExporter) []v1.Container {
+	if exporter == nil {
+		return containers
+	}
+	path := util.Coalesce(exporter.Path, defaultMetricsPath)
+
+	for i := range containers {
+		if containers[i].Name != exporter.Sidecar {
+			continue
+		}
+		hasPort := false
+		for _, port := range containers[i].Ports {
+			if port.ContainerPort == exporter.Port {
+				hasPort = true
+				break
+			}
+		}
+		if !hasPort {
+			// copy the ports, they are shared with the sidecar definition
+			ports := make([]v1.ContainerPort, 0, len(containers[i].Ports)+1)
+			ports = append(ports, containers[i].Ports...)
+			containers[i].Ports = append(ports, v1.ContainerPort{
+				Name:          metricsPortName,
+				ContainerPort: exporter.Port,
+				Protocol:      v1.ProtocolTCP,
+			})
+		}
+		containers[i].ReadinessProbe = generateHTTPProbe(path, int(exporter.Port), v1.URISchemeHTTP, exporter.ReadinessProbe)
+		containers[i].LivenessProbe = generateHTTPProbe(path, int(exporter.Port), v1.URISchemeHTTP, exporter.LivenessProbe)
+		return containers
+	}
+
+	c.logger.Warningf("metrics exporter sidecar %q is not defined, its port is not exposed", exporter.Sidecar)
+	return containers
+}
+
+// podMonitorEnabled tells if the pods of the cluster are scraped through a PodMonitor of the Prometheus operator
+func podMonitorEnabled(spec *acidv1.PostgresSpec) bool {
+	return spec.MetricsExporter != nil && spec.MetricsExporter.PodMonitor
+}
+
+// generatePodMonitor returns a PodMonitor scraping the metrics port of the pods, it is unstructured as the
+// Prometheus operator types are not a dependency of the operator
+func (c *Cluster) generatePodMonitor() *unstructured.Unstructured {
+	matchLabels := make(map[string]interface{})
+	for key, value := range c.labelsSet(false) {
+		matchLabels[key] = value
+	}
+
+	podMonitor := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": podMonitorResource.GroupVersion().String(),
+			"kind":       "PodMonitor",
+			"spec": map[string]interface{}{
+				"selector": map[string]interface{}{
+					"matchLabels": matchLabels,
+				},
+				"podMetricsEndpoints": []interface{}{
+					map[string]interface{}{
+						"port": metricsPortName,
+						"path": util.Coalesce(c.Spec.MetricsExporter.Path, defaultMetricsPath),
+					},
+				},
+			},
+		},
+	}
+	podMonitor.SetName(c.Name)
+	podMonitor.SetNamespace(c.Namespace)
+	podMonitor.SetLabels(c.labelsSet(true))
+
+	return podMonitor
+}
+
+// generateMasterTCPRoute returns a TCPRoute attached to the gateway of the manifest and routing to the master service,
+// it is unstructured as the Gateway API types are not a dependency of the operator
+func (c *Cluster) generateMasterTCPRoute() *unstructured.Unstructured {
+	parentRef := map[string]interface{}{
+		"name": c.Spec.MasterTCPRoute.GatewayName,
+	}
+	if c.Spec.MasterTCPRoute.GatewayNamespace != "" {
+		parentRef["namespace"] = c.Spec.MasterTCPRoute.GatewayNamespace
+	}
+	if c.Spec.MasterTCPRoute.SectionName != "" {
+		parentRef["sectionName"] = c.Spec.MasterTCPRoute.SectionName
+	}
+
+	tcpRoute := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": tcpRouteResource.GroupVersion().String(),
+			"kind":       "TCPRoute",
+			"spec": map[string]interface{}{
+				"parentRefs": []interface{}{parentRef},
+				"rules": []interface{}{
+					map[string]interface{}{
+						"backendRefs": []interface{}{
+							map[string]interface{}{
+								"name": c.serviceName(Master),
+								"port": int64(pgPort),
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	tcpRoute.SetName(c.serviceName(Master))
+	tcpRoute.SetNamespace(c.Namespace)
+	tcpRoute.SetLabels(c.labelsSet(true))
+
+	return tcpRoute
+}
+
+// tcpRouteManagedSpec returns the fields of the TCP route spec the operator sets, leaving out the group, kind and
+// weight the Gateway API defaults for the references
+func tcpRouteManagedSpec(tcpRoute *unstructured.Unstructured) map[string]interface{} {
+	pick := func(object interface{}, keys ...string) map[string]interface{} {
+		picked := make(map[string]interface{})
+		fields, _ := object.(map[string]interface{})
+		for _, key := range keys {
+			if value, ok := fields[key]; ok {
+				picked[key] = value
+			}
+		}
+		return picked
+	}
+
+	parentRefs := make([]interface{}, 0)
+	currentParentRefs, _, _ := unstructured.NestedSlice(tcpRoute.Object, "spec", "parentRefs")
+	for _, parentRef := range currentParentRefs {
+		parentRefs = append(parentRefs, pick(parentRef, "name", "namespace", "sectionName"))
+	}
+	rules := make([]interface{}, 0)
+	currentRules, _, _ := unstructured.NestedSlice(tcpRoute.Object, "spec", "rules")
+	for _, rule := range currentRules {
+		backendRefs := make([]interface{}, 0)
+		currentBackendRefs, _ := pick(rule, "backendRefs")["backendRefs"].([]interface{})
+		for _, backendRef := range currentBackendRefs {
+			backendRefs = append(backendRefs, pick(backendRef, "name", "port"))
+		}
+		rules = append(rules, backendRefs)
+	}
+
+	return map[string]interface{}{"parentRefs": parentRefs, "rules": rules}
+}
+
 func generateSidecarContainers(sidecars []acidv1.Sidecar,
 	defaultResources acidv1.Resources, startIndex int, logger *logrus.Entry) ([]v1.Container, error) {
 
@@ -570,8 +1108,14 @@ func (c *Cluster) generatePodTemplate(
 	spiloRunAsUser *int64,
 	spiloRunAsGroup *int64,
 	spiloFSGroup *int64,
+	spiloFSGroupChangePolicy v1.PodFSGroupChangePolicy,
 	nodeAffinity *v1.Affinity,
+	nodeSelector map[string]string,
+	imagePullSecrets []v1.LocalObjectReference,
 	schedulerName *string,
+	dnsPolicy v1.DNSPolicy,
+	dnsConfig *v1.PodDNSConfig,
+	hostAliases []v1.HostAlias,
 	terminateGracePeriod int64,
 	podServiceAccountName string,
 	kubeIAMRole string,
@@ -601,6 +1145,10 @@ func (c *Cluster) generatePodTemplate(
 		securityContext.FSGroup = spiloFSGroup
 	}
 
+	if spiloFSGroupChangePolicy != "" {
+		securityContext.FSGroupChangePolicy = &spiloFSGroupChangePolicy
+	}
+
 	podSpec := v1.PodSpec{
 		ServiceAccountName:            podServiceAccountName,
 		TerminationGracePeriodSeconds: &terminateGracePeriodSeconds,
@@ -610,10 +1158,27 @@ func (c *Cluster) generatePodTemplate(
 		SecurityContext:               &securityContext,
 	}
 
+	if len(nodeSelector) > 0 {
+		podSpec.NodeSelector = nodeSelector
+	}
+
+	if len(imagePullSecrets) > 0 {
+		podSpec.ImagePullSecrets = imagePullSecrets
+	}
+
 	if schedulerName != nil {
 		podSpec.SchedulerName = *schedulerName
 	}
 
+	if dnsPolicy != "" {
+		podSpec.DNSPolicy = dnsPolicy
+	}
+	podSpec.DNSConfig = dnsConfig
+
+	if len(hostAliases) > 0 {
+		podSpec.HostAliases = hostAliases
+	}
+
 	if shmVolume != nil && *shmVolume {
 		addShmVolume(&podSpec)
 	}
@@ -655,7 +1220,7 @@ func (c *Cluster) generatePodTemplate(
 }
 
 // generatePodEnvVars generates environment variables for the Spilo Pod
-func (c *Cluster) generateSpiloPodEnvVars(uid types.UID, spiloConfiguration string, cloneDescription *acidv1.CloneDescription, standbyDescription *acidv1.StandbyDescription, customPodEnvVarsList []v1.EnvVar) []v1.EnvVar {
+func (c *Cluster) generateSpiloPodEnvVars(uid types.UID, spiloConfiguration string, cloneDescription *acidv1.CloneDescription, standbyDescription *acidv1.StandbyDescription, walArchive *acidv1.WALArchiveDescription, customPodEnvVarsList []v1.EnvVar) []v1.EnvVar {
 	envVars := []v1.EnvVar{
 		{
 			Name:  "SCOPE",
@@ -753,6 +1318,30 @@ func (c *Cluster) generateSpiloPodEnvVars(uid types.UID, spiloConfiguration stri
 		envVars = append(envVars, v1.EnvVar{Name: "KUBERNETES_USE_CONFIGMAPS", Value: "true"})
 	}
 
+	// the operator tags every pod in its annotations, Patroni reads the tags when the container starts
+	if c.Spec.NoFailover != nil || len(c.Spec.CascadingReplicas) > 0 {
+		envVars = append(envVars, v1.EnvVar{
+			Name: "NOFAILOVER",
+			ValueFrom: &v1.EnvVarSource{
+				FieldRef: &v1.ObjectFieldSelector{
+					APIVersion: "v1",
+					FieldPath:  fmt.Sprintf("metadata.annotations['%s']", constants.NoFailoverAnnotationKey),
+				},
+			},
+		})
+	}
+	if len(c.Spec.CascadingReplicas) > 0 {
+		envVars = append(envVars, v1.EnvVar{
+			Name: "REPLICATEFROM",
+			ValueFrom: &v1.EnvVarSource{
+				FieldRef: &v1.ObjectFieldSelector{
+					APIVersion: "v1",
+					FieldPath:  fmt.Sprintf("metadata.annotations['%s']", constants.ReplicateFromAnnotationKey),
+				},
+			},
+		})
+	}
+
 	if cloneDescription != nil && cloneDescription.ClusterName != "" {
 		envVars = append(envVars, c.generateCloneEnvironment(cloneDescription)...)
 	}
@@ -767,14 +1356,16 @@ func (c *Cluster) generateSpiloPodEnvVars(uid types.UID, spiloConfiguration stri
 		envVars = append(envVars, customPodEnvVarsList...)
 	}
 
-	if c.OpConfig.WALES3Bucket != "" {
-		envVars = append(envVars, v1.EnvVar{Name: "WAL_S3_BUCKET", Value: c.OpConfig.WALES3Bucket})
+	walS3Bucket, walGSBucket := c.getWALArchiveBuckets(walArchive)
+
+	if walS3Bucket != "" {
+		envVars = append(envVars, v1.EnvVar{Name: "WAL_S3_BUCKET", Value: walS3Bucket})
 		envVars = append(envVars, v1.EnvVar{Name: "WAL_BUCKET_SCOPE_SUFFIX", Value: getBucketScopeSuffix(string(uid))})
 		envVars = append(envVars, v1.EnvVar{Name: "WAL_BUCKET_SCOPE_PREFIX", Value: ""})
 	}
 
-	if c.OpConfig.WALGSBucket != "" {
-		envVars = append(envVars, v1.EnvVar{Name: "WAL_GS_BUCKET", Value: c.OpConfig.WALGSBucket})
+	if walGSBucket != "" {
+		envVars = append(envVars, v1.EnvVar{Name: "WAL_GS_BUCKET", Value: walGSBucket})
 		envVars = append(envVars, v1.EnvVar{Name: "WAL_BUCKET_SCOPE_SUFFIX", Value: getBucketScopeSuffix(string(uid))})
 		envVars = append(envVars, v1.EnvVar{Name: "WAL_BUCKET_SCOPE_PREFIX", Value: ""})
 	}
@@ -792,6 +1383,15 @@ func (c *Cluster) generateSpiloPodEnvVars(uid types.UID, spiloConfiguration stri
 	return envVars
 }
 
+// getWALArchiveBuckets returns the buckets to archive WAL to, a destination defined
+// in the cluster manifest replaces the buckets from the operator configuration
+func (c *Cluster) getWALArchiveBuckets(walArchive *acidv1.WALArchiveDescription) (string, string) {
+	if walArchive != nil && (walArchive.S3Bucket != "" || walArchive.GSBucket != "") {
+		return walArchive.S3Bucket, walArchive.GSBucket
+	}
+	return c.OpConfig.WALES3Bucket, c.OpConfig.WALGSBucket
+}
+
 // deduplicateEnvVars makes sure there are no duplicate in the target envVar array. While Kubernetes already
 // deduplicates variables defined in a container, it leaves the last definition in the list and this behavior is not
 // well-documented, which means that the behavior can be reversed at some point (it may also start producing an error).
@@ -882,6 +1482,135 @@ func (c *Cluster) getPodEnvironmentSecretVariables() ([]v1.EnvVar, error) {
 	return secretPodEnvVarsList, nil
 }
 
+// checksumSource is a secret or config map, or a single key of it, the pods depend on
+type checksumSource struct {
+	kind     string
+	name     string
+	key      string
+	optional *bool
+}
+
+// podSourceChecksums returns the pod annotations with the checksums of the secrets and config maps the pods
+// of the spec depend on, so that a changed content results in a different pod template and rolls the pods
+func (c *Cluster) podSourceChecksums(ctx context.Context, spec *acidv1.PostgresSpec) (map[string]string, error) {
+	checksums := make(map[string]string)
+
+	if spec.RestartOnEnvSourceChange {
+		checksum, err := c.envSourceChecksum(ctx, spec.Env)
+		if err != nil {
+			return nil, fmt.Errorf("could not compute checksum of the environment variable sources: %v", err)
+		}
+		if checksum != "" {
+			checksums[constants.EnvChecksumAnnotationKey] = checksum
+		}
+	}
+
+	volumeChecksum, err := c.volumeSourceChecksum(ctx, spec.AdditionalVolumes)
+	if err != nil {
+		return nil, fmt.Errorf("could not compute checksum of the additional volume sources: %v", err)
+	}
+	if volumeChecksum != "" {
+		checksums[constants.VolumeChecksumAnnotationKey] = volumeChecksum
+	}
+
+	return checksums, nil
+}
+
+// envSourceChecksum hashes the content of the secrets and config maps referenced by the environment variables
+func (c *Cluster) envSourceChecksum(ctx context.Context, env []v1.EnvVar) (string, error) {
+	sources := make([]checksumSource, 0)
+	for _, envVar := range env {
+		if envVar.ValueFrom == nil {
+			continue
+		}
+		if ref := envVar.ValueFrom.SecretKeyRef; ref != nil {
+			sources = append(sources, checksumSource{kind: "secret", name: ref.Name, key: ref.Key, optional: ref.Optional})
+		}
+		if ref := envVar.ValueFrom.ConfigMapKeyRef; ref != nil {
+			sources = append(sources, checksumSource{kind: "configmap", name: ref.Name, key: ref.Key, optional: ref.Optional})
+		}
+	}
+	return c.sourcesChecksum(ctx, sources)
+}
+
+// volumeSourceChecksum hashes the content of the secrets and config maps mounted by the additional
+// volumes which opted in with restartOnChange
+func (c *Cluster) volumeSourceChecksum(ctx context.Context, volumes []acidv1.AdditionalVolume) (string, error) {
+	sources := make([]checksumSource, 0)
+	for _, volume := range volumes {
+		if !volume.RestartOnChange {
+			continue
+		}
+		if secret := volume.VolumeSource.Secret; secret != nil {
+			sources = append(sources, checksumSource{kind: "secret", name: secret.SecretName, optional: secret.Optional})
+		}
+		if cm := volume.VolumeSource.ConfigMap; cm != nil {
+			sources = append(sources, checksumSource{kind: "configmap", name: cm.Name, optional: cm.Optional})
+		}
+		if projected := volume.VolumeSource.Projected; projected != nil {
+			for _, projection := range projected.Sources {
+				if projection.Secret != nil {
+					sources = append(sources, checksumSource{kind: "secret", name: projection.Secret.Name, optional: projection.Secret.Optional})
+				}
+				if projection.ConfigMap != nil {
+					sources = append(sources, checksumSource{kind: "configmap", name: projection.ConfigMap.Name, optional: projection.ConfigMap.Optional})
+				}
+			}
+		}
+	}
+	return c.sourcesChecksum(ctx, sources)
+}
+
+// sourcesChecksum reads the sources from the namespace of the cluster and hashes their content,
+// missing optional sources are skipped and an empty checksum is returned if there is nothing to hash
+func (c *Cluster) sourcesChecksum(ctx context.Context, sources []checksumSource) (string, error) {
+	entries := make([]string, 0)
+
+	for _, source := range sources {
+		var data map[string]string
+		var err error
+
+		switch source.kind {
+		case "secret":
+			var secret *v1.Secret
+			secret, err = c.KubeClient.Secrets(c.Namespace).Get(ctx, source.name, metav1.GetOptions{})
+			if err == nil {
+				data = make(map[string]string, len(secret.Data))
+				for k, v := range secret.Data {
+					data[k] = string(v)
+				}
+			}
+		case "configmap":
+			var cm *v1.ConfigMap
+			cm, err = c.KubeClient.ConfigMaps(c.Namespace).Get(ctx, source.name, metav1.GetOptions{})
+			if err == nil {
+				data = cm.Data
+			}
+		}
+		if err != nil {
+			if k8sutil.ResourceNotFound(err) && source.optional != nil && *source.optional {
+				continue
+			}
+			return "", fmt.Errorf("could not get %s %q: %v", source.kind, source.name, err)
+		}
+
+		if source.key != "" {
+			entries = append(entries, fmt.Sprintf("%s/%s/%s=%s", source.kind, source.name, source.key, data[source.key]))
+			continue
+		}
+		for k, v := range data {
+			entries = append(entries, fmt.Sprintf("%s/%s/%s=%s", source.kind, source.name, k, v))
+		}
+	}
+
+	if len(entries) == 0 {
+		return "", nil
+	}
+	sort.Strings(entries)
+
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(strings.Join(entries, "\n")))), nil
+}
+
 func getSidecarContainer(sidecar acidv1.Sidecar, index int, resources *v1.ResourceRequirements) *v1.Container {
 	name := sidecar.Name
 	if name == "" {
@@ -927,7 +1656,75 @@ func extractPgVersionFromBinPath(binPath string, template string) (string, error
 	return fmt.Sprintf("%v", pgVersion), nil
 }
 
-func (c *Cluster) generateStatefulSet(spec *acidv1.PostgresSpec) (*appsv1.StatefulSet, error) {
+// pgVersionNum converts a major version of the manifest like "9.6" or "13" into the form of server_version_num, so
+// that versions can be compared, a minor version of Postgres 10 and later is ignored
+func pgVersionNum(version string) (int, error) {
+	parts := strings.SplitN(version, ".", 3)
+	major, err := strconv.Atoi(parts[0])
+	if err != nil || major <= 0 {
+		return 0, fmt.Errorf("%q is not a Postgres major version", version)
+	}
+	if major >= 10 {
+		return major * 10000, nil
+	}
+	if len(parts) < 2 {
+		return 0, fmt.Errorf("Postgres version %q lacks the second part of the major version", version)
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil || minor < 0 {
+		return 0, fmt.Errorf("%q is not a Postgres major version", version)
+	}
+	return major*10000 + minor*100, nil
+}
+
+// statefulSetPgVersion returns the Postgres major version the pods of the statefulset start, taken from the
+// PGVERSION variable or the binary directory of the Spilo configuration, which takes precedence. It is empty if
+// neither is set.
+func statefulSetPgVersion(sset *appsv1.StatefulSet) string {
+	var version string
+	for _, container := range sset.Spec.Template.Spec.Containers {
+		if container.Name != constants.PostgresContainerName {
+			continue
+		}
+		for _, env := range container.Env {
+			switch env.Name {
+			case "PGVERSION":
+				if version == "" {
+					version = env.Value
+				}
+			case "SPILO_CONFIGURATION":
+				config := spiloConfiguration{}
+				if err := json.Unmarshal([]byte(env.Value), &config); err != nil {
+					continue
+				}
+				binDir, ok := config.PgLocalConfiguration[patroniPGBinariesParameterName].(string)
+				if !ok {
+					continue
+				}
+				if binVersion, err := extractPgVersionFromBinPath(binDir, pgBinariesLocationTemplate); err == nil {
+					return binVersion
+				}
+			}
+		}
+	}
+	return version
+}
+
+// podServiceAccountName returns the service account of the Postgres pods, the one set in the manifest takes precedence
+func (c *Cluster) podServiceAccountName(spec *acidv1.PostgresSpec) string {
+	return util.Coalesce(spec.ServiceAccountName, c.OpConfig.PodServiceAccountName)
+}
+
+func (c *Cluster) podTerminateGracePeriodSeconds(spec *acidv1.PostgresSpec) int64 {
+	if spec.TerminationGracePeriodSeconds != nil {
+		return *spec.TerminationGracePeriodSeconds
+	}
+	return int64(c.OpConfig.PodTerminateGracePeriod.Seconds())
+}
+
+// generateStatefulSet expects the checksums of the secrets and config maps the pods depend on, as returned by
+// podSourceChecksums, since reading them from the K8s API belongs to the caller
+func (c *Cluster) generateStatefulSet(spec *acidv1.PostgresSpec, sourceChecksums map[string]string) (*appsv1.StatefulSet, error) {
 
 	var (
 		err                 error
@@ -1034,6 +1831,11 @@ func (c *Cluster) generateStatefulSet(spec *acidv1.PostgresSpec) (*appsv1.Statef
 	sort.Slice(customPodEnvVarsList,
 		func(i, j int) bool { return customPodEnvVarsList[i].Name < customPodEnvVarsList[j].Name })
 
+	// variables from the manifest go first to take priority over the operator wide ones
+	if len(spec.Env) > 0 {
+		customPodEnvVarsList = append(append([]v1.EnvVar{}, spec.Env...), customPodEnvVarsList...)
+	}
+
 	if spec.StandbyCluster != nil && spec.StandbyCluster.S3WalPath == "" {
 		return nil, fmt.Errorf("s3_wal_path is empty for standby cluster")
 	}
@@ -1060,7 +1862,7 @@ func (c *Cluster) generateStatefulSet(spec *acidv1.PostgresSpec) (*appsv1.Statef
 		}
 	}
 
-	spiloConfiguration, err := generateSpiloJSONConfiguration(&spec.PostgresqlParam, &spec.Patroni, c.OpConfig.PamRoleName, c.OpConfig.EnablePgVersionEnvVar, c.logger)
+	spiloConfiguration, err := generateSpiloJSONConfiguration(postgresqlParam(spec), &spec.Patroni, c.OpConfig.PamRoleName, c.OpConfig.EnablePgVersionEnvVar, c.logger)
 	if err != nil {
 		return nil, fmt.Errorf("could not generate Spilo JSON configuration: %v", err)
 	}
@@ -1071,6 +1873,7 @@ func (c *Cluster) generateStatefulSet(spec *acidv1.PostgresSpec) (*appsv1.Statef
 		spiloConfiguration,
 		spec.Clone,
 		spec.StandbyCluster,
+		spec.WALArchive,
 		customPodEnvVarsList,
 	)
 
@@ -1094,13 +1897,14 @@ func (c *Cluster) generateStatefulSet(spec *acidv1.PostgresSpec) (*appsv1.Statef
 	}
 
 	volumeMounts := generateVolumeMounts(spec.Volume)
+	volumeMounts = append(volumeMounts, generateTablespaceVolumeMounts(spec.Tablespaces)...)
 
 	// configure TLS with a custom secret volume
 	if spec.TLS != nil && spec.TLS.SecretName != "" {
 		// this is combined with the FSGroup in the section above
 		// to give read access to the postgres user
 		defaultMode := int32(0640)
-		mountPath := "/tls"
+		mountPath := constants.TLSMountPath
 		additionalVolumes = append(additionalVolumes, acidv1.AdditionalVolume{
 			Name:      spec.TLS.SecretName,
 			MountPath: mountPath,
@@ -1150,6 +1954,30 @@ func (c *Cluster) generateStatefulSet(spec *acidv1.PostgresSpec) (*appsv1.Statef
 		}
 	}
 
+	// serve the Patroni REST API with the certificate of a secret
+	if apiTLS := spec.Patroni.APITLS; apiTLS != nil && apiTLS.SecretName != "" {
+		defaultMode := int32(0640)
+		mountPath := constants.PatroniAPITLSMountPath
+		additionalVolumes = append(additionalVolumes, acidv1.AdditionalVolume{
+			Name:      constants.PatroniAPITLSVolume,
+			MountPath: mountPath,
+			VolumeSource: v1.VolumeSource{
+				Secret: &v1.SecretVolumeSource{
+					SecretName:  apiTLS.SecretName,
+					DefaultMode: &defaultMode,
+				},
+			},
+		})
+		spiloEnvVars = append(
+			spiloEnvVars,
+			v1.EnvVar{Name: patroni.RestAPICertificateEnvVar, Value: ensurePath(apiTLS.CertificateFile, mountPath, "tls.crt")},
+			v1.EnvVar{Name: "SSL_RESTAPI_PRIVATE_KEY_FILE", Value: ensurePath(apiTLS.PrivateKeyFile, mountPath, "tls.key")},
+		)
+		if apiTLS.CAFile != "" {
+			spiloEnvVars = append(spiloEnvVars, v1.EnvVar{Name: "SSL_RESTAPI_CA_FILE", Value: ensurePath(apiTLS.CAFile, mountPath, "")})
+		}
+	}
+
 	// generate the spilo container
 	c.logger.Debugf("Generating Spilo container, environment variables")
 	c.logger.Debugf("%v", spiloEnvVars)
@@ -1162,6 +1990,19 @@ func (c *Cluster) generateStatefulSet(spec *acidv1.PostgresSpec) (*appsv1.Statef
 		c.OpConfig.Resources.SpiloPrivileged,
 		generateCapabilities(c.OpConfig.AdditionalPodCapabilities),
 	)
+	if spec.EnablePreStopSwitchover {
+		spiloContainer.Lifecycle = preStopSwitchoverLifecycle(patroniAPIScheme(spec))
+	}
+	if len(spec.Command) > 0 || len(spec.Args) > 0 {
+		if !referencesSpiloEntrypoint(spec.Command, spec.Args) {
+			c.logger.Warningf("command and args of the Postgres container do not reference the Spilo entrypoint %s, Patroni may not be started", spiloEntrypoint)
+		}
+		spiloContainer.Command = spec.Command
+		spiloContainer.Args = spec.Args
+	}
+	spiloContainer.ReadinessProbe = generateHTTPProbe("/readiness", patroniPort, patroniAPIScheme(spec), spec.ReadinessProbe)
+	spiloContainer.LivenessProbe = generateHTTPProbe("/liveness", patroniPort, patroniAPIScheme(spec), spec.LivenessProbe)
+	spiloContainer.StartupProbe = generateHTTPProbe("/liveness", patroniPort, patroniAPIScheme(spec), spec.StartupProbe)
 
 	// generate container specs for sidecars specified in the cluster manifest
 	clusterSpecificSidecars := []v1.Container{}
@@ -1219,12 +2060,24 @@ func (c *Cluster) generateStatefulSet(spec *acidv1.PostgresSpec) (*appsv1.Statef
 	}
 
 	sidecarContainers = patchSidecarContainers(sidecarContainers, volumeMounts, c.OpConfig.SuperUsername, c.credentialSecretName(c.OpConfig.SuperUsername), c.logger)
+	sidecarContainers = c.withMetricsExporter(sidecarContainers, spec.MetricsExporter)
 
 	tolerationSpec := tolerations(&spec.Tolerations, c.OpConfig.PodToleration)
 	effectivePodPriorityClassName := util.Coalesce(spec.PodPriorityClassName, c.OpConfig.PodPriorityClassName)
 
 	podAnnotations := c.generatePodAnnotations(spec)
 
+	if len(sourceChecksums) > 0 {
+		if podAnnotations == nil {
+			podAnnotations = make(map[string]string)
+		}
+		for k, v := range sourceChecksums {
+			podAnnotations[k] = v
+		}
+	}
+
+	enablePodAntiAffinity, podAntiAffinityTopologyKey := c.podAntiAffinity(spec)
+
 	// generate pod template for the statefulset, based on the spilo container and sidecars
 	podTemplate, err = c.generatePodTemplate(
 		c.Namespace,
@@ -1237,15 +2090,21 @@ func (c *Cluster) generateStatefulSet(spec *acidv1.PostgresSpec) (*appsv1.Statef
 		effectiveRunAsUser,
 		effectiveRunAsGroup,
 		effectiveFSGroup,
+		spec.SpiloFSGroupChangePolicy,
 		nodeAffinity(c.OpConfig.NodeReadinessLabel, spec.NodeAffinity),
+		spec.NodeSelector,
+		spec.ImagePullSecrets,
 		spec.SchedulerName,
-		int64(c.OpConfig.PodTerminateGracePeriod.Seconds()),
-		c.OpConfig.PodServiceAccountName,
+		spec.DNSPolicy,
+		spec.DNSConfig,
+		spec.HostAliases,
+		c.podTerminateGracePeriodSeconds(spec),
+		c.podServiceAccountName(spec),
 		c.OpConfig.KubeIAMRole,
 		effectivePodPriorityClassName,
 		mountShmVolumeNeeded(c.OpConfig, spec),
-		c.OpConfig.EnablePodAntiAffinity,
-		c.OpConfig.PodAntiAffinityTopologyKey,
+		enablePodAntiAffinity,
+		podAntiAffinityTopologyKey,
 		c.OpConfig.AdditionalSecretMount,
 		c.OpConfig.AdditionalSecretMountPath,
 		additionalVolumes)
@@ -1254,10 +2113,19 @@ func (c *Cluster) generateStatefulSet(spec *acidv1.PostgresSpec) (*appsv1.Statef
 		return nil, fmt.Errorf("could not generate pod template: %v", err)
 	}
 
-	if volumeClaimTemplate, err = generatePersistentVolumeClaimTemplate(spec.Volume.Size,
-		spec.Volume.StorageClass); err != nil {
+	if volumeClaimTemplate, err = generatePersistentVolumeClaimTemplate(constants.DataVolumeName,
+		spec.Volume.Size, spec.Volume.StorageClass); err != nil {
 		return nil, fmt.Errorf("could not generate volume claim template: %v", err)
 	}
+	volumeClaimTemplates := []v1.PersistentVolumeClaim{*volumeClaimTemplate}
+
+	for _, tablespace := range spec.Tablespaces {
+		if volumeClaimTemplate, err = generatePersistentVolumeClaimTemplate(tablespaceVolumeName(tablespace.Name),
+			tablespace.Size, tablespace.StorageClass); err != nil {
+			return nil, fmt.Errorf("could not generate volume claim template for tablespace %q: %v", tablespace.Name, err)
+		}
+		volumeClaimTemplates = append(volumeClaimTemplates, *volumeClaimTemplate)
+	}
 
 	numberOfInstances := c.getNumberOfInstances(spec)
 
@@ -1291,7 +2159,7 @@ func (c *Cluster) generateStatefulSet(spec *acidv1.PostgresSpec) (*appsv1.Statef
 			Selector:             c.labelsSelector(),
 			ServiceName:          c.serviceName(Master),
 			Template:             *podTemplate,
-			VolumeClaimTemplates: []v1.PersistentVolumeClaim{*volumeClaimTemplate},
+			VolumeClaimTemplates: volumeClaimTemplates,
 			UpdateStrategy:       updateStrategy,
 			PodManagementPolicy:  podManagementPolicy,
 		},
@@ -1439,6 +2307,8 @@ func (c *Cluster) addAdditionalVolumes(podSpec *v1.PodSpec,
 
 	volumes := podSpec.Volumes
 	mountPaths := map[string]acidv1.AdditionalVolume{}
+	// only the accepted volumes get mounted, a mount without its volume would make the pod invalid
+	mountedVolumes := make([]acidv1.AdditionalVolume, 0, len(additionalVolumes))
 	for i, v := range additionalVolumes {
 		if previousVolume, exist := mountPaths[v.MountPath]; exist {
 			msg := "Volume %+v cannot be mounted to the same path as %+v"
@@ -1446,8 +2316,8 @@ func (c *Cluster) addAdditionalVolumes(podSpec *v1.PodSpec,
 			continue
 		}
 
-		if v.MountPath == constants.PostgresDataMount {
-			msg := "Cannot mount volume on postgresql data directory, %+v"
+		if mountsOverDataDirectory(v.MountPath) {
+			msg := "Cannot mount volume on or below postgresql data directory, %+v"
 			c.logger.Warningf(msg, v)
 			continue
 		}
@@ -1474,13 +2344,14 @@ func (c *Cluster) addAdditionalVolumes(podSpec *v1.PodSpec,
 		)
 
 		mountPaths[v.MountPath] = v
+		mountedVolumes = append(mountedVolumes, additionalVolumes[i])
 	}
 
-	c.logger.Infof("Mount additional volumes: %+v", additionalVolumes)
+	c.logger.Infof("Mount additional volumes: %+v", mountedVolumes)
 
 	for i := range podSpec.Containers {
 		mounts := podSpec.Containers[i].VolumeMounts
-		for _, v := range additionalVolumes {
+		for _, v := range mountedVolumes {
 			for _, target := range v.TargetContainers {
 				if podSpec.Containers[i].Name == target || target == "all" {
 					mounts = append(mounts, v1.VolumeMount{
@@ -1497,16 +2368,22 @@ func (c *Cluster) addAdditionalVolumes(podSpec *v1.PodSpec,
 	podSpec.Volumes = volumes
 }
 
-func generatePersistentVolumeClaimTemplate(volumeSize, volumeStorageClass string) (*v1.PersistentVolumeClaim, error) {
+// mountsOverDataDirectory tells whether a volume mounted at the path would hide the data volume or a part of it
+func mountsOverDataDirectory(mountPath string) bool {
+	cleanPath := path.Clean(mountPath)
+	return cleanPath == constants.PostgresDataMount || strings.HasPrefix(cleanPath, constants.PostgresDataMount+"/")
+}
+
+func generatePersistentVolumeClaimTemplate(volumeName, volumeSize, volumeStorageClass string) (*v1.PersistentVolumeClaim, error) {
 
 	var storageClassName *string
 
 	metadata := metav1.ObjectMeta{
-		Name: constants.DataVolumeName,
+		Name: volumeName,
 	}
 	if volumeStorageClass != "" {
 		// TODO: remove the old annotation, switching completely to the StorageClassName field.
-		metadata.Annotations = map[string]string{"volume.beta.kubernetes.io/storage-class": volumeStorageClass}
+		metadata.Annotations = map[string]string{storageClassAnnotation: volumeStorageClass}
 		storageClassName = &volumeStorageClass
 	} else {
 		metadata.Annotations = map[string]string{"volume.alpha.kubernetes.io/storage-class": "default"}
@@ -1540,6 +2417,10 @@ func (c *Cluster) generateUserSecrets() map[string]*v1.Secret {
 	secrets := make(map[string]*v1.Secret, len(c.pgUsers))
 	namespace := c.Namespace
 	for username, pgUser := range c.pgUsers {
+		// the secrets of users with an external secret are managed outside of the operator
+		if _, external := c.Spec.ExternalSecrets[username]; external {
+			continue
+		}
 		//Skip users with no password i.e. human users (they'll be authenticated using pam)
 		secret := c.generateSingleUserSecret(namespace, pgUser)
 		if secret != nil {
@@ -1598,6 +2479,17 @@ func (c *Cluster) generateSingleUserSecret(namespace string, pgUser spec.PgUser)
 	return &secret
 }
 
+// replicaServiceEnabled returns false only if the replica service is explicitly disabled in the manifest
+func replicaServiceEnabled(spec *acidv1.PostgresSpec) bool {
+	return spec.EnableReplicaService == nil || *spec.EnableReplicaService
+}
+
+// replicaLagGateEnabled returns true if the manifest limits the replication lag of the replicas serving the replica
+// service, the operator maintains the replica endpoint then instead of the service selector
+func replicaLagGateEnabled(spec *acidv1.PostgresSpec) bool {
+	return spec.ReplicaServiceMaxLag != nil
+}
+
 func (c *Cluster) shouldCreateLoadBalancerForService(role PostgresRole, spec *acidv1.PostgresSpec) bool {
 
 	switch role {
@@ -1632,7 +2524,9 @@ func (c *Cluster) generateService(role PostgresRole, spec *acidv1.PostgresSpec)
 		Type:  v1.ServiceTypeClusterIP,
 	}
 
-	if role == Replica || c.patroniKubernetesUseConfigMaps() {
+	if role == Replica && replicaLagGateEnabled(spec) {
+		c.logger.Debugf("replica endpoint is maintained by the operator, no selector for the replica service")
+	} else if role == Replica || c.patroniKubernetesUseConfigMaps() {
 		serviceSpec.Selector = c.roleLabelsSet(false, role)
 	}
 
@@ -1648,14 +2542,48 @@ func (c *Cluster) generateService(role PostgresRole, spec *acidv1.PostgresSpec)
 		}
 
 		c.logger.Debugf("final load balancer source ranges as seen in a service spec (not necessarily applied): %q", serviceSpec.LoadBalancerSourceRanges)
-		serviceSpec.ExternalTrafficPolicy = v1.ServiceExternalTrafficPolicyType(c.OpConfig.ExternalTrafficPolicy)
+		externalTrafficPolicy := c.OpConfig.ExternalTrafficPolicy
+		if role == Replica {
+			externalTrafficPolicy = util.Coalesce(spec.ReplicaExternalTrafficPolicy, externalTrafficPolicy)
+		}
+		serviceSpec.ExternalTrafficPolicy = v1.ServiceExternalTrafficPolicyType(externalTrafficPolicy)
 		serviceSpec.Type = v1.ServiceTypeLoadBalancer
+	} else if role == Master && spec.EnableMasterNodePort != nil && *spec.EnableMasterNodePort {
+		serviceSpec.Type = v1.ServiceTypeNodePort
 	} else if role == Replica {
 		// before PR #258, the replica service was only created if allocated a LB
 		// now we always create the service but warn if the LB is absent
 		c.logger.Debugf("No load balancer created for the replica service")
 	}
 
+	// load balancers allocate a node port as well, so a fixed one applies to both types
+	if role == Master && spec.MasterNodePort != nil && serviceSpec.Type != v1.ServiceTypeClusterIP {
+		serviceSpec.Ports[0].NodePort = *spec.MasterNodePort
+	}
+
+	if role == Replica && spec.ReplicaSessionAffinity == string(v1.ServiceAffinityClientIP) {
+		// set the timeout explicitly, otherwise resetting it to the default would not be patched
+		timeout := v1.DefaultClientIPServiceAffinitySeconds
+		if spec.ReplicaSessionAffinityTimeoutSeconds != nil {
+			timeout = *spec.ReplicaSessionAffinityTimeoutSeconds
+		}
+		serviceSpec.SessionAffinity = v1.ServiceAffinityClientIP
+		serviceSpec.SessionAffinityConfig = &v1.SessionAffinityConfig{
+			ClientIP: &v1.ClientIPConfig{
+				TimeoutSeconds: &timeout,
+			},
+		}
+	}
+
+	// the endpoints of a service without selector are maintained by Patroni and only have the Postgres port
+	if spec.MetricsExporter != nil && len(serviceSpec.Selector) > 0 {
+		serviceSpec.Ports = append(serviceSpec.Ports, v1.ServicePort{
+			Name:       metricsPortName,
+			Port:       spec.MetricsExporter.Port,
+			TargetPort: intstr.IntOrString{IntVal: spec.MetricsExporter.Port},
+		})
+	}
+
 	service := &v1.Service{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:        c.serviceName(role),
@@ -1669,6 +2597,77 @@ func (c *Cluster) generateService(role PostgresRole, spec *acidv1.PostgresSpec)
 	return service
 }
 
+// podServiceName returns the name of the service of a single pod, which is the name of the pod
+func (c *Cluster) podServiceName(ordinal int32) string {
+	return fmt.Sprintf("%s-%d", c.statefulSetName(), ordinal)
+}
+
+// generatePodService generates the ClusterIP service selecting only the pod with the given ordinal
+func (c *Cluster) generatePodService(ordinal int32, spec *acidv1.PostgresSpec) *v1.Service {
+	name := c.podServiceName(ordinal)
+	selector := c.labelsSet(false)
+	selector[appsv1.StatefulSetPodNameLabel] = name
+
+	ports := []v1.ServicePort{{Name: "postgresql", Port: pgPort, TargetPort: intstr.IntOrString{IntVal: pgPort}}}
+	if spec.MetricsExporter != nil {
+		ports = append(ports, v1.ServicePort{
+			Name:       metricsPortName,
+			Port:       spec.MetricsExporter.Port,
+			TargetPort: intstr.IntOrString{IntVal: spec.MetricsExporter.Port},
+		})
+	}
+
+	return &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   c.Namespace,
+			Labels:      c.labelsSet(true),
+			Annotations: c.annotationsSet(nil),
+		},
+		Spec: v1.ServiceSpec{
+			Type:     v1.ServiceTypeClusterIP,
+			Selector: selector,
+			Ports:    ports,
+		},
+	}
+}
+
+// replicaServiceName returns the name of an additional replica service, the name of the replica service followed
+// by the name given in the manifest
+func (c *Cluster) replicaServiceName(name string) string {
+	return fmt.Sprintf("%s-%s", c.serviceName(Replica), name)
+}
+
+// generateReplicaService generates the ClusterIP service selecting either the replicas labeled as synchronous
+// standbys or the other ones
+func (c *Cluster) generateReplicaService(replicaService acidv1.ReplicaService, spec *acidv1.PostgresSpec) *v1.Service {
+	selector := c.roleLabelsSet(false, Replica)
+	selector[constants.SyncStandbyLabelKey] = fmt.Sprintf("%t", replicaService.Members == "sync")
+
+	ports := []v1.ServicePort{{Name: "postgresql", Port: 5432, TargetPort: intstr.IntOrString{IntVal: 5432}}}
+	if spec.MetricsExporter != nil {
+		ports = append(ports, v1.ServicePort{
+			Name:       metricsPortName,
+			Port:       spec.MetricsExporter.Port,
+			TargetPort: intstr.IntOrString{IntVal: spec.MetricsExporter.Port},
+		})
+	}
+
+	return &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        c.replicaServiceName(replicaService.Name),
+			Namespace:   c.Namespace,
+			Labels:      c.roleLabelsSet(true, Replica),
+			Annotations: c.annotationsSet(nil),
+		},
+		Spec: v1.ServiceSpec{
+			Type:     v1.ServiceTypeClusterIP,
+			Selector: selector,
+			Ports:    ports,
+		},
+	}
+}
+
 func (c *Cluster) generateServiceAnnotations(role PostgresRole, spec *acidv1.PostgresSpec) map[string]string {
 	annotations := make(map[string]string)
 
@@ -1684,7 +2683,7 @@ func (c *Cluster) generateServiceAnnotations(role PostgresRole, spec *acidv1.Pos
 	if c.shouldCreateLoadBalancerForService(role, spec) {
 		var dnsName string
 		if role == Master {
-			dnsName = c.masterDNSName()
+			dnsName = c.masterDNSName(spec)
 		} else {
 			dnsName = c.replicaDNSName()
 		}
@@ -1696,6 +2695,9 @@ func (c *Cluster) generateServiceAnnotations(role PostgresRole, spec *acidv1.Pos
 		}
 		// External DNS name annotation is not customizable
 		annotations[constants.ZalandoDNSNameAnnotation] = dnsName
+	} else if role == Master && spec.MasterDNSNameFormat != "" {
+		// a DNS name requested in the manifest is published for any type of the master service
+		annotations[constants.ZalandoDNSNameAnnotation] = c.masterDNSName(spec)
 	}
 
 	if len(annotations) == 0 {
@@ -1720,6 +2722,72 @@ func (c *Cluster) generateEndpoint(role PostgresRole, subsets []v1.EndpointSubse
 	return endpoints
 }
 
+// generatePatroniRole grants the access to the Kubernetes API that Patroni needs as DCS, the same rules as the
+// postgres-pod cluster role of the operator manifests
+func (c *Cluster) generatePatroniRole() *rbacv1.Role {
+	allVerbs := []string{"create", "delete", "deletecollection", "get", "list", "patch", "update", "watch"}
+	rules := make([]rbacv1.PolicyRule, 0)
+	if c.patroniKubernetesUseConfigMaps() {
+		rules = append(rules,
+			rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"configmaps"}, Verbs: allVerbs},
+			rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"endpoints"}, Verbs: []string{"get"}})
+	} else {
+		rules = append(rules,
+			rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"endpoints"}, Verbs: allVerbs})
+	}
+	rules = append(rules,
+		rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get", "list", "patch", "update", "watch"}},
+		rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"services"}, Verbs: []string{"create"}})
+
+	return &rbacv1.Role{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      c.patroniRoleName(),
+			Namespace: c.Namespace,
+			Labels:    c.labelsSet(true),
+		},
+		Rules: rules,
+	}
+}
+
+// generatePatroniRoleBinding binds the Patroni role to the service account of the pods
+func (c *Cluster) generatePatroniRoleBinding() *rbacv1.RoleBinding {
+	return &rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      c.patroniRoleName(),
+			Namespace: c.Namespace,
+			Labels:    c.labelsSet(true),
+		},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     "Role",
+			Name:     c.patroniRoleName(),
+		},
+		Subjects: []rbacv1.Subject{
+			{
+				Kind:      rbacv1.ServiceAccountKind,
+				Name:      c.podServiceAccountName(&c.Spec),
+				Namespace: c.Namespace,
+			},
+		},
+	}
+}
+
+// withoutCloneEnvVars drops the variables describing the clone source from the Postgres container. Spilo only reads
+// them to bootstrap a new cluster, so changing them must not roll the pods of a running one. The variables of other
+// containers are kept, a sidecar may use the same prefix for its own settings.
+func withoutCloneEnvVars(container v1.Container) []v1.EnvVar {
+	if container.Name != constants.PostgresContainerName {
+		return container.Env
+	}
+	result := make([]v1.EnvVar, 0, len(container.Env))
+	for _, envVar := range container.Env {
+		if !strings.HasPrefix(envVar.Name, "CLONE_") {
+			result = append(result, envVar)
+		}
+	}
+	return result
+}
+
 func (c *Cluster) generateCloneEnvironment(description *acidv1.CloneDescription) []v1.EnvVar {
 	result := make([]v1.EnvVar, 0)
 
@@ -1950,8 +3018,14 @@ func (c *Cluster) generateLogicalBackupJob() (*batchv1beta1.CronJob, error) {
 		nil,
 		nil,
 		nil,
+		"",
 		nodeAffinity(c.OpConfig.NodeReadinessLabel, nil),
 		nil,
+		nil,
+		nil,
+		"",
+		nil,
+		nil,
 		int64(c.OpConfig.PodTerminateGracePeriod.Seconds()),
 		c.OpConfig.PodServiceAccountName,
 		c.OpConfig.KubeIAMRole,
@@ -2104,6 +3178,188 @@ func (c *Cluster) getLogicalBackupJobName() (jobName string) {
 	return c.OpConfig.LogicalBackupJobPrefix + c.clusterName().Name
 }
 
+// generateBackupVerificationJob returns the cron job restoring the latest base backup of the cluster into a
+// throwaway pod on the schedule of the manifest. The restored data lives in an ephemeral volume of the size of the
+// cluster volume and is gone with the pod, only the last job is kept to report its result.
+func (c *Cluster) generateBackupVerificationJob() (*batchv1beta1.CronJob, error) {
+	verification := c.Spec.BackupVerification
+	if verification == nil {
+		return nil, fmt.Errorf("no backup verification defined in the manifest")
+	}
+
+	walS3Bucket, walGSBucket := c.getWALArchiveBuckets(c.Spec.WALArchive)
+	if walS3Bucket == "" && walGSBucket == "" {
+		return nil, fmt.Errorf("no WAL archive bucket to restore the backups from")
+	}
+
+	// restoring the backup takes the same resources as the Postgres container
+	resourceRequirements, err := generateResourceRequirements(c.Spec.Resources, c.makeDefaultResources())
+	if err != nil {
+		return nil, fmt.Errorf("could not generate resource requirements for backup verification pods: %v", err)
+	}
+
+	envVars, err := c.generateBackupVerificationPodEnvVars(walS3Bucket, walGSBucket)
+	if err != nil {
+		return nil, err
+	}
+
+	volumeClaim, err := generatePersistentVolumeClaimTemplate(constants.DataVolumeName, c.Spec.Volume.Size, c.Spec.Volume.StorageClass)
+	if err != nil {
+		return nil, fmt.Errorf("could not generate volume claim template for backup verification pods: %v", err)
+	}
+
+	effectiveDockerImage := util.Coalesce(c.Spec.DockerImage, c.OpConfig.DockerImage)
+	verificationContainer := generateContainer(
+		"backup-verification",
+		&effectiveDockerImage,
+		resourceRequirements,
+		envVars,
+		[]v1.VolumeMount{{Name: constants.DataVolumeName, MountPath: constants.PostgresDataMount}},
+		false,
+		v1.Capabilities{},
+	)
+	verificationContainer.Ports = nil
+	verificationContainer.Command = []string{"/bin/bash", "-c", backupVerificationScript}
+
+	jobLabels := c.backupVerificationLabels()
+
+	runAsUser := spiloUserID
+	if c.OpConfig.Resources.SpiloRunAsUser != nil {
+		runAsUser = *c.OpConfig.Resources.SpiloRunAsUser
+	}
+	fsGroup := spiloGroupID
+	if c.OpConfig.Resources.SpiloFSGroup != nil {
+		fsGroup = *c.OpConfig.Resources.SpiloFSGroup
+	}
+
+	podTemplate, err := c.generatePodTemplate(
+		c.Namespace,
+		jobLabels,
+		c.generatePodAnnotations(&c.Spec),
+		verificationContainer,
+		[]v1.Container{},
+		[]v1.Container{},
+		&[]v1.Toleration{},
+		&runAsUser,
+		nil,
+		&fsGroup,
+		"",
+		nodeAffinity(c.OpConfig.NodeReadinessLabel, nil),
+		nil,
+		nil,
+		nil,
+		"",
+		nil,
+		nil,
+		int64(c.OpConfig.PodTerminateGracePeriod.Seconds()),
+		c.OpConfig.PodServiceAccountName,
+		c.OpConfig.KubeIAMRole,
+		"",
+		util.False(),
+		false,
+		"",
+		c.OpConfig.AdditionalSecretMount,
+		c.OpConfig.AdditionalSecretMountPath,
+		[]acidv1.AdditionalVolume{})
+	if err != nil {
+		return nil, fmt.Errorf("could not generate pod template for backup verification pod: %v", err)
+	}
+	podTemplate.Spec.RestartPolicy = v1.RestartPolicyNever
+	podTemplate.Spec.Volumes = append(podTemplate.Spec.Volumes, v1.Volume{
+		Name: constants.DataVolumeName,
+		VolumeSource: v1.VolumeSource{
+			Ephemeral: &v1.EphemeralVolumeSource{
+				VolumeClaimTemplate: &v1.PersistentVolumeClaimTemplate{
+					ObjectMeta: metav1.ObjectMeta{Labels: jobLabels},
+					Spec:       volumeClaim.Spec,
+				},
+			},
+		},
+	})
+
+	// a failed restore is reported instead of retried, the next attempt follows the schedule
+	backoffLimit := int32(0)
+	historyLimit := int32(1)
+	cronJob := &batchv1beta1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        c.getBackupVerificationJobName(),
+			Namespace:   c.Namespace,
+			Labels:      c.labelsSet(true),
+			Annotations: c.annotationsSet(nil),
+		},
+		Spec: batchv1beta1.CronJobSpec{
+			Schedule:          verification.Schedule,
+			ConcurrencyPolicy: batchv1beta1.ForbidConcurrent,
+			JobTemplate: batchv1beta1.JobTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: jobLabels,
+				},
+				Spec: batchv1.JobSpec{
+					BackoffLimit: &backoffLimit,
+					Template:     *podTemplate,
+				},
+			},
+			SuccessfulJobsHistoryLimit: &historyLimit,
+			FailedJobsHistoryLimit:     &historyLimit,
+		},
+	}
+
+	return cronJob, nil
+}
+
+// generateBackupVerificationPodEnvVars returns the location of the backups as Spilo derives it and the query to
+// run. The variables of the manifest and the pod environment follow, e.g. for the credentials of the bucket.
+func (c *Cluster) generateBackupVerificationPodEnvVars(walS3Bucket, walGSBucket string) ([]v1.EnvVar, error) {
+	query := c.Spec.BackupVerification.Query
+	if query == "" {
+		query = defaultBackupVerificationQuery
+	}
+
+	envVars := []v1.EnvVar{
+		{Name: "SCOPE", Value: c.Name},
+		{Name: "PGVERSION", Value: c.Spec.PgVersion},
+		{Name: "PGUSER", Value: c.OpConfig.SuperUsername},
+		{Name: "WAL_BUCKET_SCOPE_PREFIX", Value: ""},
+		{Name: "WAL_BUCKET_SCOPE_SUFFIX", Value: getBucketScopeSuffix(string(c.Postgresql.GetUID()))},
+		{Name: "VERIFY_QUERY", Value: query},
+	}
+	if walS3Bucket != "" {
+		envVars = append(envVars, v1.EnvVar{Name: "WAL_S3_BUCKET", Value: walS3Bucket})
+	} else {
+		envVars = append(envVars, v1.EnvVar{Name: "WAL_GS_BUCKET", Value: walGSBucket})
+	}
+	if c.OpConfig.GCPCredentials != "" {
+		envVars = append(envVars, v1.EnvVar{Name: "GOOGLE_APPLICATION_CREDENTIALS", Value: c.OpConfig.GCPCredentials})
+	}
+
+	configMapEnvVarsList, err := c.getPodEnvironmentConfigMapVariables()
+	if err != nil {
+		return nil, err
+	}
+	secretEnvVarsList, err := c.getPodEnvironmentSecretVariables()
+	if err != nil {
+		return nil, err
+	}
+	envVars = append(envVars, c.Spec.Env...)
+	envVars = append(envVars, configMapEnvVarsList...)
+	envVars = append(envVars, secretEnvVarsList...)
+
+	return deduplicateEnvVars(envVars, "backup-verification", c.logger), nil
+}
+
+// getBackupVerificationJobName returns the name of the backup verification cron job of the cluster
+func (c *Cluster) getBackupVerificationJobName() string {
+	return backupVerificationJobPrefix + c.clusterName().Name
+}
+
+// backupVerificationLabels returns the labels of the jobs and pods verifying the backups of the cluster
+func (c *Cluster) backupVerificationLabels() labels.Set {
+	return labels.Set{
+		c.OpConfig.ClusterNameLabel: c.Name,
+		"application":               "spilo-backup-verification",
+	}
+}
+
 // Return an array of ownerReferences to make an arbitraty object dependent on
 // the StatefulSet. Dependency is made on StatefulSet instead of PostgreSQL CRD
 // while the former is represent the actual state, and only it's deletion means
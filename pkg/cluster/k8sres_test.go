@@ -40,6 +40,7 @@ func toIntStr(val int) *intstr.IntOrString {
 }
 
 func TestGenerateSpiloJSONConfiguration(t *testing.T) {
+	maxLagOnFailover := int64(33554432)
 	var cluster = New(
 		Config{
 			OpConfig: config.Config{
@@ -81,8 +82,8 @@ func TestGenerateSpiloJSONConfiguration(t *testing.T) {
 				TTL:                   30,
 				LoopWait:              10,
 				RetryTimeout:          10,
-				MaximumLagOnFailover:  33554432,
-				SynchronousMode:       true,
+				MaximumLagOnFailover:  &maxLagOnFailover,
+				SynchronousMode:       util.True(),
 				SynchronousModeStrict: true,
 				Slots:                 map[string]map[string]string{"permanent_logical_1": {"type": "logical", "database": "foo", "plugin": "pgoutput"}},
 			},
@@ -90,6 +91,17 @@ func TestGenerateSpiloJSONConfiguration(t *testing.T) {
 			opConfig: config.Config{},
 			result:   `{"postgresql":{"bin_dir":"/usr/lib/postgresql/11/bin","pg_hba":["hostssl all all 0.0.0.0/0 md5","host    all all 0.0.0.0/0 md5"]},"bootstrap":{"initdb":[{"auth-host":"md5"},{"auth-local":"trust"},"data-checksums",{"encoding":"UTF8"},{"locale":"en_US.UTF-8"}],"users":{"zalandos":{"password":"","options":["CREATEDB","NOLOGIN"]}},"dcs":{"ttl":30,"loop_wait":10,"retry_timeout":10,"maximum_lag_on_failover":33554432,"synchronous_mode":true,"synchronous_mode_strict":true,"slots":{"permanent_logical_1":{"database":"foo","plugin":"pgoutput","type":"logical"}}}}}`,
 		},
+		{
+			subtest: "Logging parameters kept in the local configuration",
+			pgParam: &acidv1.PostgresqlParam{
+				PgVersion:  "11",
+				Parameters: map[string]string{"log_statement": "ddl", "logging_collector": "on", "work_mem": "16MB"},
+			},
+			patroni:  &acidv1.Patroni{},
+			role:     "zalandos",
+			opConfig: config.Config{},
+			result:   `{"postgresql":{"bin_dir":"/usr/lib/postgresql/11/bin","parameters":{"log_statement":"ddl","logging_collector":"on","work_mem":"16MB"}},"bootstrap":{"initdb":[{"auth-host":"md5"},{"auth-local":"trust"}],"users":{"zalandos":{"password":"","options":["CREATEDB","NOLOGIN"]}},"dcs":{}}}`,
+		},
 	}
 	for _, tt := range tests {
 		cluster.OpConfig = tt.opConfig
@@ -158,6 +170,24 @@ func TestGenerateSpiloPodEnvVars(t *testing.T) {
 		},
 	}
 
+	expectedValuesManifestS3Bucket := []ExpectedValue{
+		ExpectedValue{
+			envIndex:       15,
+			envVarConstant: "WAL_S3_BUCKET",
+			envVarValue:    "cluster-s3-bucket",
+		},
+		ExpectedValue{
+			envIndex:       16,
+			envVarConstant: "WAL_BUCKET_SCOPE_SUFFIX",
+			envVarValue:    "/SomeUUID",
+		},
+		ExpectedValue{
+			envIndex:       17,
+			envVarConstant: "WAL_BUCKET_SCOPE_PREFIX",
+			envVarValue:    "",
+		},
+	}
+
 	testName := "TestGenerateSpiloPodEnvVars"
 	tests := []struct {
 		subTest            string
@@ -166,6 +196,7 @@ func TestGenerateSpiloPodEnvVars(t *testing.T) {
 		spiloConfig        string
 		cloneDescription   *acidv1.CloneDescription
 		standbyDescription *acidv1.StandbyDescription
+		walArchive         *acidv1.WALArchiveDescription
 		customEnvList      []v1.EnvVar
 		expectedValues     []ExpectedValue
 	}{
@@ -194,12 +225,25 @@ func TestGenerateSpiloPodEnvVars(t *testing.T) {
 			customEnvList:      []v1.EnvVar{},
 			expectedValues:     expectedValuesGCPCreds,
 		},
+		{
+			subTest: "Will replace WAL_GS_BUCKET with WAL_S3_BUCKET from the manifest",
+			opConfig: config.Config{
+				WALGSBucket: "wale-gs-bucket",
+			},
+			uid:                "SomeUUID",
+			spiloConfig:        "someConfig",
+			cloneDescription:   &acidv1.CloneDescription{},
+			standbyDescription: &acidv1.StandbyDescription{},
+			walArchive:         &acidv1.WALArchiveDescription{S3Bucket: "cluster-s3-bucket"},
+			customEnvList:      []v1.EnvVar{},
+			expectedValues:     expectedValuesManifestS3Bucket,
+		},
 	}
 
 	for _, tt := range tests {
 		cluster.OpConfig = tt.opConfig
 
-		actualEnvs := cluster.generateSpiloPodEnvVars(tt.uid, tt.spiloConfig, tt.cloneDescription, tt.standbyDescription, tt.customEnvList)
+		actualEnvs := cluster.generateSpiloPodEnvVars(tt.uid, tt.spiloConfig, tt.cloneDescription, tt.standbyDescription, tt.walArchive, tt.customEnvList)
 
 		for _, ev := range tt.expectedValues {
 			env := actualEnvs[ev.envIndex]
@@ -217,6 +261,90 @@ func TestGenerateSpiloPodEnvVars(t *testing.T) {
 	}
 }
 
+func TestValidateBootstrapOnlyParameter(t *testing.T) {
+	tests := []struct {
+		param string
+		value string
+		err   string
+	}{
+		{param: "max_connections", value: "100"},
+		{param: "max_connections", value: "abc", err: `invalid value "abc" for parameter "max_connections": must be an integer`},
+		{param: "max_connections", value: "0", err: `invalid value "0" for parameter "max_connections": must be between 1 and 262143`},
+		{param: "max_prepared_transactions", value: "0"},
+		{param: "max_locks_per_transaction", value: "5", err: `invalid value "5" for parameter "max_locks_per_transaction": must be between 10 and 2147483647`},
+		{param: "wal_level", value: "logical"},
+		{param: "wal_level", value: "full", err: `invalid value "full" for parameter "wal_level": must be one of minimal, replica or logical`},
+		{param: "wal_log_hints", value: "on"},
+		{param: "track_commit_timestamp", value: "False"},
+		{param: "track_commit_timestamp", value: "enabled", err: `invalid value "enabled" for parameter "track_commit_timestamp": must be a boolean`},
+		{param: "shared_buffers", value: "abc"},
+		{param: "shared_preload_libraries", value: "bg_mon, pg_stat_statements,$libdir/plugins/auto_explain"},
+		{param: "shared_preload_libraries", value: "bg_mon,,pg_cron", err: `invalid library "" for parameter "shared_preload_libraries"`},
+		{param: "shared_preload_libraries", value: "bg_mon;pg_cron", err: `invalid library "bg_mon;pg_cron" for parameter "shared_preload_libraries"`},
+	}
+
+	for _, tt := range tests {
+		err := validateBootstrapOnlyParameter(tt.param, tt.value)
+		if tt.err == "" && err != nil {
+			t.Errorf("TestValidateBootstrapOnlyParameter: unexpected error for %s=%q: %v", tt.param, tt.value, err)
+		}
+		if tt.err != "" && (err == nil || err.Error() != tt.err) {
+			t.Errorf("TestValidateBootstrapOnlyParameter: expected error %q for %s=%q, got %v", tt.err, tt.param, tt.value, err)
+		}
+	}
+}
+
+func TestMemoryTunedParameters(t *testing.T) {
+	tests := []struct {
+		subTest     string
+		memoryLimit string
+		parameters  map[string]string
+		tuned       map[string]string
+	}{
+		{
+			subTest:     "derived from the memory limit",
+			memoryLimit: "4Gi",
+			tuned: map[string]string{
+				"shared_buffers":       "1024MB",
+				"effective_cache_size": "3072MB",
+				"maintenance_work_mem": "204MB",
+			},
+		},
+		{
+			subTest:     "maintenance_work_mem capped",
+			memoryLimit: "64Gi",
+			tuned: map[string]string{
+				"shared_buffers":       "16384MB",
+				"effective_cache_size": "49152MB",
+				"maintenance_work_mem": "2048MB",
+			},
+		},
+		{
+			subTest:     "manifest parameters take precedence",
+			memoryLimit: "4Gi",
+			parameters:  map[string]string{"shared_buffers": "512MB", "work_mem": "16MB"},
+			tuned: map[string]string{
+				"shared_buffers":       "512MB",
+				"effective_cache_size": "3072MB",
+				"maintenance_work_mem": "204MB",
+			},
+		},
+		{
+			subTest:     "no memory limit",
+			memoryLimit: "0",
+			parameters:  map[string]string{"shared_buffers": "512MB"},
+			tuned:       map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.subTest, func(t *testing.T) {
+			tuned := memoryTunedParameters(resource.MustParse(tt.memoryLimit), tt.parameters)
+			assert.Equal(t, tt.tuned, tuned)
+		})
+	}
+}
+
 func TestCreateLoadBalancerLogic(t *testing.T) {
 	var cluster = New(
 		Config{
@@ -556,6 +684,52 @@ func TestExtractPgVersionFromBinPath(t *testing.T) {
 	}
 }
 
+func TestPgVersionNum(t *testing.T) {
+	tests := []struct {
+		version  string
+		expected int
+	}{
+		{"9.5", 90500},
+		{"9.6", 90600},
+		{"10", 100000},
+		{"13", 130000},
+		{"13.2", 130000},
+	}
+	for _, tt := range tests {
+		versionNum, err := pgVersionNum(tt.version)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.expected, versionNum, "version %q", tt.version)
+	}
+
+	for _, version := range []string{"", "9", "nine", "-1", "9.x"} {
+		_, err := pgVersionNum(version)
+		assert.Error(t, err, "version %q", version)
+	}
+}
+
+func TestStatefulSetPgVersion(t *testing.T) {
+	statefulSet := func(env ...v1.EnvVar) *appsv1.StatefulSet {
+		return &appsv1.StatefulSet{
+			Spec: appsv1.StatefulSetSpec{
+				Template: v1.PodTemplateSpec{
+					Spec: v1.PodSpec{
+						Containers: []v1.Container{{Name: constants.PostgresContainerName, Env: env}},
+					},
+				},
+			},
+		}
+	}
+
+	assert.Equal(t, "", statefulSetPgVersion(statefulSet()))
+	assert.Equal(t, "12", statefulSetPgVersion(statefulSet(v1.EnvVar{Name: "PGVERSION", Value: "12"})))
+	assert.Equal(t, "9.6", statefulSetPgVersion(statefulSet(
+		v1.EnvVar{Name: "SPILO_CONFIGURATION", Value: `{"postgresql":{"bin_dir":"/usr/lib/postgresql/9.6/bin"}}`})))
+	// the binary directory takes precedence
+	assert.Equal(t, "11", statefulSetPgVersion(statefulSet(
+		v1.EnvVar{Name: "PGVERSION", Value: "12"},
+		v1.EnvVar{Name: "SPILO_CONFIGURATION", Value: `{"postgresql":{"bin_dir":"/usr/lib/postgresql/11/bin"}}`})))
+}
+
 func TestSecretVolume(t *testing.T) {
 	testName := "TestSecretVolume"
 	tests := []struct {
@@ -921,7 +1095,7 @@ func TestNodeAffinity(t *testing.T) {
 		},
 	}
 	spec = makeSpec(nodeAff)
-	s, err := cluster.generateStatefulSet(&spec)
+	s, err := cluster.generateStatefulSet(&spec, nil)
 	if err != nil {
 		assert.NoError(t, err)
 	}
@@ -1001,7 +1175,7 @@ func TestTLS(t *testing.T) {
 			},
 		}, k8sutil.KubernetesClient{}, acidv1.Postgresql{}, logger, eventRecorder)
 	spec = makeSpec(acidv1.TLSDescription{SecretName: "my-secret", CAFile: "ca.crt"})
-	s, err := cluster.generateStatefulSet(&spec)
+	s, err := cluster.generateStatefulSet(&spec, nil)
 	if err != nil {
 		assert.NoError(t, err)
 	}
@@ -1043,6 +1217,258 @@ func TestTLS(t *testing.T) {
 	assert.Contains(t, s.Spec.Template.Spec.Containers[0].Env, v1.EnvVar{Name: "SSL_CA_FILE", Value: "/tls/ca.crt"})
 }
 
+func TestPatroniAPITLS(t *testing.T) {
+	cluster := New(
+		Config{
+			OpConfig: config.Config{
+				PodManagementPolicy: "ordered_ready",
+				ProtectedRoles:      []string{"admin"},
+				Auth: config.Auth{
+					SuperUsername:       superUserName,
+					ReplicationUsername: replicationUserName,
+				},
+			},
+		}, k8sutil.KubernetesClient{}, acidv1.Postgresql{}, logger, eventRecorder)
+	spec := acidv1.PostgresSpec{
+		TeamID: "myapp", NumberOfInstances: 1,
+		Resources: acidv1.Resources{
+			ResourceRequests: acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+			ResourceLimits:   acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+		},
+		Volume: acidv1.Volume{
+			Size: "1G",
+		},
+		Patroni: acidv1.Patroni{
+			APITLS: &acidv1.PatroniAPITLS{SecretName: "my-secret", CAFile: "ca.crt"},
+		},
+		EnablePreStopSwitchover: true,
+		ReadinessProbe:          &acidv1.Probe{},
+		LivenessProbe:           &acidv1.Probe{},
+	}
+	s, err := cluster.generateStatefulSet(&spec, nil)
+	assert.NoError(t, err)
+
+	defaultMode := int32(0640)
+	assert.Contains(t, s.Spec.Template.Spec.Volumes, v1.Volume{
+		Name: "patroni-api-tls",
+		VolumeSource: v1.VolumeSource{
+			Secret: &v1.SecretVolumeSource{
+				SecretName:  "my-secret",
+				DefaultMode: &defaultMode,
+			},
+		},
+	}, "the pod gets a volume with the secret of the REST API")
+
+	container := s.Spec.Template.Spec.Containers[0]
+	assert.Contains(t, container.VolumeMounts, v1.VolumeMount{MountPath: "/tls-patroni-api", Name: "patroni-api-tls"})
+	assert.Contains(t, container.Env, v1.EnvVar{Name: "SSL_RESTAPI_CERTIFICATE_FILE", Value: "/tls-patroni-api/tls.crt"})
+	assert.Contains(t, container.Env, v1.EnvVar{Name: "SSL_RESTAPI_PRIVATE_KEY_FILE", Value: "/tls-patroni-api/tls.key"})
+	assert.Contains(t, container.Env, v1.EnvVar{Name: "SSL_RESTAPI_CA_FILE", Value: "/tls-patroni-api/ca.crt"})
+	assert.Equal(t, v1.URISchemeHTTPS, container.ReadinessProbe.HTTPGet.Scheme, "the readiness probe uses https")
+	assert.Equal(t, v1.URISchemeHTTPS, container.LivenessProbe.HTTPGet.Scheme, "the liveness probe uses https")
+	assert.Contains(t, container.Lifecycle.PreStop.Exec.Command[2], "https://localhost:8008/switchover")
+}
+
+func TestEnvValueFrom(t *testing.T) {
+	client, clientSet := newFakeK8sSecretsClient()
+	namespace := "default"
+
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "aws-credentials", Namespace: namespace},
+		Data:       map[string][]byte{"secret": []byte("first")},
+	}
+	if _, err := clientSet.CoreV1().Secrets(namespace).Create(context.TODO(), secret, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("could not create secret: %v", err)
+	}
+
+	envVar := v1.EnvVar{
+		Name: "AWS_SECRET_ACCESS_KEY",
+		ValueFrom: &v1.EnvVarSource{
+			SecretKeyRef: &v1.SecretKeySelector{
+				LocalObjectReference: v1.LocalObjectReference{Name: "aws-credentials"},
+				Key:                  "secret",
+			},
+		},
+	}
+	spec := acidv1.PostgresSpec{
+		TeamID: "myapp", NumberOfInstances: 1,
+		Resources: acidv1.Resources{
+			ResourceRequests: acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+			ResourceLimits:   acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+		},
+		Volume: acidv1.Volume{
+			Size: "1G",
+		},
+		Env:                      []v1.EnvVar{envVar},
+		RestartOnEnvSourceChange: true,
+	}
+
+	cluster := New(
+		Config{
+			OpConfig: config.Config{
+				PodManagementPolicy: "ordered_ready",
+				ProtectedRoles:      []string{"admin"},
+				Auth: config.Auth{
+					SuperUsername:       superUserName,
+					ReplicationUsername: replicationUserName,
+				},
+			},
+		}, client, acidv1.Postgresql{ObjectMeta: metav1.ObjectMeta{Name: "acid-test-cluster", Namespace: namespace}}, logger, eventRecorder)
+
+	checksums, err := cluster.podSourceChecksums(context.TODO(), &spec)
+	assert.NoError(t, err)
+	s, err := cluster.generateStatefulSet(&spec, checksums)
+	assert.NoError(t, err)
+	assert.Contains(t, s.Spec.Template.Spec.Containers[0].Env, envVar, "the pod gets the variable referencing the secret")
+
+	checksum := s.Spec.Template.Annotations[constants.EnvChecksumAnnotationKey]
+	assert.NotEmpty(t, checksum, "the pod template gets a checksum of the referenced secret")
+
+	secret.Data["secret"] = []byte("second")
+	if _, err := clientSet.CoreV1().Secrets(namespace).Update(context.TODO(), secret, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("could not update secret: %v", err)
+	}
+	checksums, err = cluster.podSourceChecksums(context.TODO(), &spec)
+	assert.NoError(t, err)
+	s, err = cluster.generateStatefulSet(&spec, checksums)
+	assert.NoError(t, err)
+	assert.NotEqual(t, checksum, s.Spec.Template.Annotations[constants.EnvChecksumAnnotationKey], "the checksum changes with the secret content")
+
+	spec.RestartOnEnvSourceChange = false
+	checksums, err = cluster.podSourceChecksums(context.TODO(), &spec)
+	assert.NoError(t, err)
+	s, err = cluster.generateStatefulSet(&spec, checksums)
+	assert.NoError(t, err)
+	assert.NotContains(t, s.Spec.Template.Annotations, constants.EnvChecksumAnnotationKey, "no checksum without restartOnEnvSourceChange")
+}
+
+func TestAdditionalVolumeChecksum(t *testing.T) {
+	client, clientSet := newFakeK8sSecretsClient()
+	client.ConfigMapsGetter = clientSet.CoreV1()
+	namespace := "default"
+
+	cm := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "pg-hba", Namespace: namespace},
+		Data:       map[string]string{"pg_hba.conf": "hostssl all all 0.0.0.0/0 md5"},
+	}
+	if _, err := clientSet.CoreV1().ConfigMaps(namespace).Create(context.TODO(), cm, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("could not create config map: %v", err)
+	}
+
+	spec := acidv1.PostgresSpec{
+		TeamID: "myapp", NumberOfInstances: 1,
+		Resources: acidv1.Resources{
+			ResourceRequests: acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+			ResourceLimits:   acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+		},
+		Volume: acidv1.Volume{
+			Size: "1G",
+		},
+		AdditionalVolumes: []acidv1.AdditionalVolume{
+			{
+				Name:      "pg-hba",
+				MountPath: "/etc/pg-hba",
+				VolumeSource: v1.VolumeSource{
+					ConfigMap: &v1.ConfigMapVolumeSource{
+						LocalObjectReference: v1.LocalObjectReference{Name: "pg-hba"},
+					},
+				},
+			},
+			{
+				Name:      "optional",
+				MountPath: "/etc/optional",
+				VolumeSource: v1.VolumeSource{
+					Secret: &v1.SecretVolumeSource{
+						SecretName: "does-not-exist",
+						Optional:   util.True(),
+					},
+				},
+				RestartOnChange: true,
+			},
+		},
+	}
+
+	cluster := New(
+		Config{
+			OpConfig: config.Config{
+				PodManagementPolicy: "ordered_ready",
+				ProtectedRoles:      []string{"admin"},
+				Auth: config.Auth{
+					SuperUsername:       superUserName,
+					ReplicationUsername: replicationUserName,
+				},
+			},
+		}, client, acidv1.Postgresql{ObjectMeta: metav1.ObjectMeta{Name: "acid-test-cluster", Namespace: namespace}}, logger, eventRecorder)
+
+	checksums, err := cluster.podSourceChecksums(context.TODO(), &spec)
+	assert.NoError(t, err)
+	s, err := cluster.generateStatefulSet(&spec, checksums)
+	assert.NoError(t, err)
+	assert.NotContains(t, s.Spec.Template.Annotations, constants.VolumeChecksumAnnotationKey, "no checksum without opted in sources")
+
+	spec.AdditionalVolumes[0].RestartOnChange = true
+	checksums, err = cluster.podSourceChecksums(context.TODO(), &spec)
+	assert.NoError(t, err)
+	s, err = cluster.generateStatefulSet(&spec, checksums)
+	assert.NoError(t, err)
+	checksum := s.Spec.Template.Annotations[constants.VolumeChecksumAnnotationKey]
+	assert.NotEmpty(t, checksum, "the pod template gets a checksum of the mounted config map")
+
+	cm.Data["pg_hba.conf"] = "hostssl all all 0.0.0.0/0 scram-sha-256"
+	if _, err := clientSet.CoreV1().ConfigMaps(namespace).Update(context.TODO(), cm, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("could not update config map: %v", err)
+	}
+	checksums, err = cluster.podSourceChecksums(context.TODO(), &spec)
+	assert.NoError(t, err)
+	s, err = cluster.generateStatefulSet(&spec, checksums)
+	assert.NoError(t, err)
+	assert.NotEqual(t, checksum, s.Spec.Template.Annotations[constants.VolumeChecksumAnnotationKey], "the checksum changes with the config map content")
+}
+
+func TestTablespaceVolumes(t *testing.T) {
+	spec := acidv1.PostgresSpec{
+		TeamID: "myapp", NumberOfInstances: 1,
+		Resources: acidv1.Resources{
+			ResourceRequests: acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+			ResourceLimits:   acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+		},
+		Volume: acidv1.Volume{
+			Size: "1G",
+		},
+		Tablespaces: []acidv1.Tablespace{
+			{Name: "fast_ssd", Size: "5G", StorageClass: "ssd"},
+		},
+	}
+
+	cluster := New(
+		Config{
+			OpConfig: config.Config{
+				PodManagementPolicy: "ordered_ready",
+				ProtectedRoles:      []string{"admin"},
+				Auth: config.Auth{
+					SuperUsername:       superUserName,
+					ReplicationUsername: replicationUserName,
+				},
+			},
+		}, k8sutil.KubernetesClient{}, acidv1.Postgresql{}, logger, eventRecorder)
+
+	s, err := cluster.generateStatefulSet(&spec, nil)
+	assert.NoError(t, err)
+
+	assert.Len(t, s.Spec.VolumeClaimTemplates, 2, "a volume claim template is added for the tablespace")
+	assert.Equal(t, constants.DataVolumeName, s.Spec.VolumeClaimTemplates[0].Name)
+	volumeClaimTemplate := s.Spec.VolumeClaimTemplates[1]
+	assert.Equal(t, "tablespace-fast-ssd", volumeClaimTemplate.Name)
+	assert.Equal(t, "ssd", *volumeClaimTemplate.Spec.StorageClassName)
+	assert.Equal(t, resource.MustParse("5G"), volumeClaimTemplate.Spec.Resources.Requests[v1.ResourceStorage])
+
+	assert.Contains(t, s.Spec.Template.Spec.Containers[0].VolumeMounts, v1.VolumeMount{
+		Name:      "tablespace-fast-ssd",
+		MountPath: "/home/postgres/tablespaces/fast_ssd",
+	}, "the tablespace volume gets mounted")
+	assert.Equal(t, "/home/postgres/tablespaces/fast_ssd/data", tablespaceLocation("fast_ssd"))
+}
+
 func TestAdditionalVolume(t *testing.T) {
 	testName := "TestAdditionalVolume"
 	tests := []struct {
@@ -1212,6 +1638,49 @@ func TestAdditionalVolume(t *testing.T) {
 	}
 }
 
+func TestAdditionalVolumeOnDataDirectory(t *testing.T) {
+	testName := "TestAdditionalVolumeOnDataDirectory"
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				ProtectedRoles: []string{"admin"},
+				Auth: config.Auth{
+					SuperUsername:       superUserName,
+					ReplicationUsername: replicationUserName,
+				},
+			},
+		}, k8sutil.KubernetesClient{}, acidv1.Postgresql{}, logger, eventRecorder)
+
+	tests := []struct {
+		mountPath string
+		mounted   bool
+	}{
+		{mountPath: "/home/postgres/pgdata", mounted: false},
+		{mountPath: "/home/postgres/pgdata/", mounted: false},
+		{mountPath: "/home/postgres/pgdata/pgroot/data", mounted: false},
+		{mountPath: "/home/postgres/pgdata-scripts", mounted: true},
+		{mountPath: "/etc/ssl/ca-bundle", mounted: true},
+	}
+	for _, tt := range tests {
+		podSpec := &v1.PodSpec{
+			Containers: []v1.Container{{Name: "postgres"}},
+		}
+		cluster.addAdditionalVolumes(podSpec, []acidv1.AdditionalVolume{
+			{
+				Name:      "test",
+				MountPath: tt.mountPath,
+				VolumeSource: v1.VolumeSource{
+					EmptyDir: &v1.EmptyDirVolumeSource{},
+				},
+			},
+		})
+		mounted := len(podSpec.Volumes) == 1
+		if mounted != tt.mounted || len(podSpec.Containers[0].VolumeMounts) != len(podSpec.Volumes) {
+			t.Errorf("%s: expected volume mounted at %q to be added: %t, got %t", testName, tt.mountPath, tt.mounted, mounted)
+		}
+	}
+}
+
 // inject sidecars through all available mechanisms and check the resulting container specs
 func TestSidecars(t *testing.T) {
 	var err error
@@ -1305,7 +1774,7 @@ func TestSidecars(t *testing.T) {
 			},
 		}, k8sutil.KubernetesClient{}, acidv1.Postgresql{}, logger, eventRecorder)
 
-	s, err := cluster.generateStatefulSet(&spec)
+	s, err := cluster.generateStatefulSet(&spec, nil)
 	assert.NoError(t, err)
 
 	env := []v1.EnvVar{
@@ -1490,6 +1959,55 @@ func TestGenerateService(t *testing.T) {
 
 }
 
+func TestGenerateServiceSessionAffinity(t *testing.T) {
+	cluster := New(
+		Config{
+			OpConfig: config.Config{
+				PodManagementPolicy: "ordered_ready",
+				Auth: config.Auth{
+					SuperUsername:       superUserName,
+					ReplicationUsername: replicationUserName,
+				},
+			},
+		}, k8sutil.KubernetesClient{}, acidv1.Postgresql{}, logger, eventRecorder)
+
+	timeout := int32(600)
+	spec := acidv1.PostgresSpec{
+		TeamID: "myapp", NumberOfInstances: 2,
+		ReplicaSessionAffinity:               "ClientIP",
+		ReplicaSessionAffinityTimeoutSeconds: &timeout,
+	}
+
+	// session affinity applies to the replica service only
+	master := cluster.generateService(Master, &spec)
+	assert.Equal(t, v1.ServiceAffinity(""), master.Spec.SessionAffinity)
+	assert.Nil(t, master.Spec.SessionAffinityConfig)
+
+	enabled := cluster.generateService(Replica, &spec)
+	assert.Equal(t, v1.ServiceAffinityClientIP, enabled.Spec.SessionAffinity)
+	assert.Equal(t, timeout, *enabled.Spec.SessionAffinityConfig.ClientIP.TimeoutSeconds)
+
+	// omitted timeout falls back to the Kubernetes default
+	spec.ReplicaSessionAffinityTimeoutSeconds = nil
+	defaultTimeout := cluster.generateService(Replica, &spec)
+	assert.Equal(t, v1.DefaultClientIPServiceAffinitySeconds, *defaultTimeout.Spec.SessionAffinityConfig.ClientIP.TimeoutSeconds)
+	match, _ := k8sutil.SameService(enabled, defaultTimeout)
+	assert.False(t, match, "changing the session affinity timeout should be detected")
+
+	// toggle session affinity off
+	spec.ReplicaSessionAffinity = "None"
+	disabled := cluster.generateService(Replica, &spec)
+	assert.Equal(t, v1.ServiceAffinity(""), disabled.Spec.SessionAffinity)
+	assert.Nil(t, disabled.Spec.SessionAffinityConfig)
+	match, _ = k8sutil.SameService(enabled, disabled)
+	assert.False(t, match, "disabling session affinity should be detected")
+
+	// and on again
+	spec.ReplicaSessionAffinity = "ClientIP"
+	match, _ = k8sutil.SameService(disabled, cluster.generateService(Replica, &spec))
+	assert.False(t, match, "enabling session affinity should be detected")
+}
+
 func TestGenerateCapabilities(t *testing.T) {
 
 	testName := "TestGenerateCapabilities"
@@ -4,23 +4,62 @@ import (
 	"context"
 	"fmt"
 	"math/rand"
+	"sync"
 	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 
 	"github.com/zalando/postgres-operator/pkg/spec"
 	"github.com/zalando/postgres-operator/pkg/util"
+	"github.com/zalando/postgres-operator/pkg/util/constants"
+	"github.com/zalando/postgres-operator/pkg/util/patroni"
 	"github.com/zalando/postgres-operator/pkg/util/retryutil"
 )
 
-func (c *Cluster) listPods() ([]v1.Pod, error) {
+// node labels carrying the zone, the deprecated one is only read when the other is missing
+var zoneLabels = []string{"topology.kubernetes.io/zone", "failure-domain.beta.kubernetes.io/zone"}
+
+// sets the nofailover and replicatefrom tags in the local configuration of Patroni, given the configuration file,
+// the nofailover tag and the member to replicate from, which is removed if empty
+const setPatroniTagsScript = `import sys, yaml
+config_file, nofailover, replicatefrom = sys.argv[1:4]
+with open(config_file) as f:
+    config = yaml.safe_load(f)
+tags = config.get('tags') or {}
+tags['nofailover'] = nofailover == 'true'
+if replicatefrom:
+    tags['replicatefrom'] = replicatefrom
+else:
+    tags.pop('replicatefrom', None)
+config['tags'] = tags
+with open(config_file, 'w') as f:
+    yaml.safe_dump(config, f, default_flow_style=False)
+`
+
+// sets passwords in the authentication section of the local configuration of Patroni, given the configuration file.
+// The passwords are read from the standard input as JSON object of the user, i.e. superuser or replication, and its
+// password, so that they do not show up in the process list of the pod.
+const setPatroniPasswordsScript = `import json, sys, yaml
+config_file = sys.argv[1]
+passwords = json.load(sys.stdin)
+with open(config_file) as f:
+    config = yaml.safe_load(f)
+authentication = config['postgresql']['authentication']
+for user, password in passwords.items():
+    authentication[user]['password'] = password
+with open(config_file, 'w') as f:
+    yaml.safe_dump(config, f, default_flow_style=False)
+`
+
+func (c *Cluster) listPods(ctx context.Context) ([]v1.Pod, error) {
 	listOptions := metav1.ListOptions{
 		LabelSelector: c.labelsSet(false).String(),
 	}
 
-	pods, err := c.KubeClient.Pods(c.Namespace).List(context.TODO(), listOptions)
+	pods, err := c.KubeClient.Pods(c.Namespace).List(ctx, listOptions)
 	if err != nil {
 		return nil, fmt.Errorf("could not get list of pods: %v", err)
 	}
@@ -28,12 +67,12 @@ func (c *Cluster) listPods() ([]v1.Pod, error) {
 	return pods.Items, nil
 }
 
-func (c *Cluster) getRolePods(role PostgresRole) ([]v1.Pod, error) {
+func (c *Cluster) getRolePods(ctx context.Context, role PostgresRole) ([]v1.Pod, error) {
 	listOptions := metav1.ListOptions{
 		LabelSelector: c.roleLabelsSet(false, role).String(),
 	}
 
-	pods, err := c.KubeClient.Pods(c.Namespace).List(context.TODO(), listOptions)
+	pods, err := c.KubeClient.Pods(c.Namespace).List(ctx, listOptions)
 	if err != nil {
 		return nil, fmt.Errorf("could not get list of pods: %v", err)
 	}
@@ -47,7 +86,7 @@ func (c *Cluster) getRolePods(role PostgresRole) ([]v1.Pod, error) {
 
 func (c *Cluster) deletePods() error {
 	c.logger.Debugln("deleting pods")
-	pods, err := c.listPods()
+	pods, err := c.listPods(context.TODO())
 	if err != nil {
 		return err
 	}
@@ -128,9 +167,10 @@ func (c *Cluster) movePodFromEndOfLifeNode(pod *v1.Pod) (*v1.Pod, error) {
 	c.setProcessName("moving pod %q out of end-of-life node %q", podName, pod.Spec.NodeName)
 	c.logger.Infof("moving pod %q out of the end-of-life node %q", podName, pod.Spec.NodeName)
 
-	if newPod, err = c.recreatePod(podName); err != nil {
+	if newPod, err = c.recreatePod(context.TODO(), podName); err != nil {
 		return nil, fmt.Errorf("could not move pod: %v", err)
 	}
+	c.syncRecreatedPodTags(context.TODO())
 
 	if newPod.Spec.NodeName == pod.Spec.NodeName {
 		return nil, fmt.Errorf("pod %q remained on the same node", podName)
@@ -151,11 +191,11 @@ func (c *Cluster) movePodFromEndOfLifeNode(pod *v1.Pod) (*v1.Pod, error) {
 func (c *Cluster) masterCandidate(oldNodeName string) (*v1.Pod, error) {
 
 	// Wait until at least one replica pod will come up
-	if err := c.waitForAnyReplicaLabelReady(); err != nil {
+	if err := c.waitForAnyReplicaLabelReady(context.TODO()); err != nil {
 		c.logger.Warningf("could not find at least one ready replica: %v", err)
 	}
 
-	replicas, err := c.getRolePods(Replica)
+	replicas, err := c.getRolePods(context.TODO(), Replica)
 	if err != nil {
 		return nil, fmt.Errorf("could not get replica pods: %v", err)
 	}
@@ -243,13 +283,344 @@ func (c *Cluster) MigrateMasterPod(podName spec.NamespacedName) error {
 	}
 
 	masterCandidateName := util.NameFromMeta(masterCandidatePod.ObjectMeta)
-	if err := c.Switchover(oldMaster, masterCandidateName); err != nil {
+	if err := c.Switchover(context.TODO(), oldMaster, masterCandidateName); err != nil {
 		return fmt.Errorf("could not failover to pod %q: %v", masterCandidateName, err)
 	}
 
 	return nil
 }
 
+// syncSwitchover moves the master role to the pod requested via the switchover annotation
+// of the Postgres manifest and removes the annotation once the request has been served
+func (c *Cluster) syncSwitchover(ctx context.Context) error {
+	candidateName := c.ObjectMeta.Annotations[constants.SwitchoverCandidateAnnotationKey]
+	if candidateName == "" {
+		return nil
+	}
+	if c.leaderDiverged {
+		return fmt.Errorf("Patroni cluster diverged, switchover to %q postponed", candidateName)
+	}
+
+	masterPods, err := c.getRolePods(ctx, Master)
+	if err != nil {
+		return fmt.Errorf("could not get master pod: %v", err)
+	}
+	if len(masterPods) == 0 {
+		return fmt.Errorf("no master pod found")
+	}
+	masterPod := &masterPods[0]
+
+	if masterPod.Name == candidateName {
+		c.logger.Infof("pod %q is already the master, no switchover needed", candidateName)
+		return c.removeSwitchoverAnnotation(ctx)
+	}
+
+	pods, err := c.listPods(ctx)
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, pod := range pods {
+		if pod.Name == candidateName {
+			found = true
+			break
+		}
+	}
+	if !found {
+		// the request can never be fulfilled, do not retry it on the next sync
+		c.logger.Warningf("switchover candidate %q is not a pod of the cluster, ignoring the switchover request", candidateName)
+		c.eventRecorder.Eventf(c.GetReference(), v1.EventTypeWarning, "Switchover",
+			"Switchover candidate %q is not a pod of the cluster", candidateName)
+		return c.removeSwitchoverAnnotation(ctx)
+	}
+
+	if err := c.checkSwitchoverCandidate(ctx, masterPod, candidateName); err != nil {
+		return fmt.Errorf("pod %q is not a suitable switchover candidate: %v", candidateName, err)
+	}
+
+	candidate := spec.NamespacedName{Namespace: c.Namespace, Name: candidateName}
+	if err := c.Switchover(ctx, masterPod, candidate); err != nil {
+		return err
+	}
+
+	return c.removeSwitchoverAnnotation(ctx)
+}
+
+// syncPatroniTags tags the pods selected in the manifest as nofailover, the cascading replicas additionally with
+// the member they replicate from, and untags the others. The tags are kept in annotations of the pod, which reach
+// Patroni when the container starts, and are written into the configuration of the running Patroni, which is
+// reloaded, so no pod is restarted. The leader can not be tagged, it keeps running untagged until it is a replica
+// after a switchover. While the cluster is diverged the tags are kept.
+func (c *Cluster) syncPatroniTags(ctx context.Context) error {
+	pods, err := c.listPods(ctx)
+	if err != nil {
+		return err
+	}
+
+	tagged, err := c.noFailoverPods(ctx, pods)
+	if err != nil {
+		return err
+	}
+	replicateFrom := c.replicateFromPods(pods)
+	for pod := range replicateFrom {
+		tagged[pod] = true
+	}
+
+	for i, pod := range pods {
+		podName := util.NameFromMeta(pod.ObjectMeta)
+		noFailover := tagged[pod.Name]
+		tags := make(map[string]string)
+		removedTags := make([]string, 0)
+		if noFailover != (pod.Annotations[constants.NoFailoverAnnotationKey] == "true") {
+			tags[constants.NoFailoverAnnotationKey] = fmt.Sprintf("%t", noFailover)
+		}
+		if member, ok := replicateFrom[pod.Name]; ok && member != pod.Annotations[constants.ReplicateFromAnnotationKey] {
+			tags[constants.ReplicateFromAnnotationKey] = member
+		} else if _, tagged := pod.Annotations[constants.ReplicateFromAnnotationKey]; !ok && tagged {
+			removedTags = append(removedTags, constants.ReplicateFromAnnotationKey)
+		}
+		if len(tags) == 0 && len(removedTags) == 0 {
+			continue
+		}
+
+		if noFailover && PostgresRole(pod.Labels[c.OpConfig.PodRoleLabel]) == Master {
+			c.logger.Warningf("pod %q is the leader and can not be tagged as nofailover, switch over to another pod first", podName)
+			c.eventRecorder.Eventf(c.GetReference(), v1.EventTypeWarning, "NoFailover",
+				"Leader %q can not be tagged as nofailover, switch over to another pod first", pod.Name)
+			continue
+		}
+		if c.leaderDiverged {
+			return fmt.Errorf("Patroni cluster diverged, tagging of pod %q postponed", podName)
+		}
+
+		patchData, err := metaAnnotationsUpdatePatch(tags, removedTags)
+		if err != nil {
+			return fmt.Errorf("could not form patch for the pod metadata: %v", err)
+		}
+		if _, err = c.KubeClient.Pods(pod.Namespace).Patch(ctx, pod.Name, types.MergePatchType,
+			patchData, metav1.PatchOptions{}); err != nil {
+			return fmt.Errorf("could not patch annotations of pod %q: %v", podName, err)
+		}
+
+		c.logger.Infof("setting the nofailover tag of pod %q to %t and its replicatefrom tag to %q",
+			podName, noFailover, replicateFrom[pod.Name])
+		if err = c.setPatroniTags(ctx, &pods[i], noFailover, replicateFrom[pod.Name]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setPatroniTags writes the tags into the configuration file of the running Patroni and reloads it, which
+// applies them without a restart
+func (c *Cluster) setPatroniTags(ctx context.Context, pod *v1.Pod, noFailover bool, replicateFrom string) error {
+	podName := util.NameFromMeta(pod.ObjectMeta)
+	if _, err := c.execCommand(&podName, "python3", "-c", setPatroniTagsScript,
+		constants.PatroniConfigFile, fmt.Sprintf("%t", noFailover), replicateFrom); err != nil {
+		return fmt.Errorf("could not set the tags in the Patroni configuration of pod %q: %v", podName, err)
+	}
+	if err := c.patroni.Reload(ctx, pod); err != nil {
+		return fmt.Errorf("could not reload the Patroni configuration of pod %q: %v", podName, err)
+	}
+
+	return nil
+}
+
+// replicateFromPods returns the member every cascading replica of the manifest replicates from. A replica whose
+// member does not run is left untagged, so it keeps replicating from the leader meanwhile.
+func (c *Cluster) replicateFromPods(pods []v1.Pod) map[string]string {
+	running := make(map[string]bool, len(pods))
+	for _, pod := range pods {
+		running[pod.Name] = true
+	}
+
+	replicateFrom := make(map[string]string)
+	for _, replica := range c.Spec.CascadingReplicas {
+		if !running[replica.Pod] {
+			continue
+		}
+		if !running[replica.ReplicateFrom] {
+			c.logger.Warningf("cascading replica %q can not replicate from %q, the pod does not exist",
+				replica.Pod, replica.ReplicateFrom)
+			c.eventRecorder.Eventf(c.GetReference(), v1.EventTypeWarning, "CascadingReplica",
+				"Cascading replica %q can not replicate from %q, the pod does not exist", replica.Pod, replica.ReplicateFrom)
+			continue
+		}
+		replicateFrom[replica.Pod] = replica.ReplicateFrom
+	}
+	return replicateFrom
+}
+
+// noFailoverPods returns the pods selected in the manifest either by name or by the zone of their node
+func (c *Cluster) noFailoverPods(ctx context.Context, pods []v1.Pod) (map[string]bool, error) {
+	tagged := make(map[string]bool)
+	if c.Spec.NoFailover == nil {
+		return tagged, nil
+	}
+
+	names := make(map[string]bool, len(c.Spec.NoFailover.Pods))
+	for _, name := range c.Spec.NoFailover.Pods {
+		names[name] = true
+	}
+	zones := make(map[string]bool, len(c.Spec.NoFailover.Zones))
+	for _, zone := range c.Spec.NoFailover.Zones {
+		zones[zone] = true
+	}
+
+	for _, pod := range pods {
+		if names[pod.Name] {
+			tagged[pod.Name] = true
+			continue
+		}
+		if len(zones) == 0 || pod.Spec.NodeName == "" {
+			continue
+		}
+		node, err := c.KubeClient.Nodes().Get(ctx, pod.Spec.NodeName, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("could not get node %q of pod %q: %v", pod.Spec.NodeName, pod.Name, err)
+		}
+		for _, label := range zoneLabels {
+			if zone, ok := node.Labels[label]; ok {
+				tagged[pod.Name] = zones[zone]
+				break
+			}
+		}
+	}
+
+	return tagged, nil
+}
+
+// syncStandbyPromotion promotes a former standby cluster, i.e. one whose manifest or statefulset lost the standby
+// section. Patroni keeps the standby_cluster section in its dynamic configuration until the promotion, so a promoted
+// cluster is recognized by its absence and repeated syncs do not promote again. Other clusters are left alone.
+func (c *Cluster) syncStandbyPromotion(ctx context.Context) error {
+	if !c.standbyPromotionPending || c.Spec.StandbyCluster != nil || c.getNumberOfInstances(&c.Spec) <= 0 {
+		return nil
+	}
+
+	masterPods, err := c.getRolePods(ctx, Master)
+	if err != nil {
+		return fmt.Errorf("could not get master pod: %v", err)
+	}
+	if len(masterPods) == 0 {
+		return fmt.Errorf("no master pod found")
+	}
+	masterPod := &masterPods[0]
+
+	standby, err := c.patroni.IsStandbyCluster(ctx, masterPod)
+	if err != nil {
+		return fmt.Errorf("could not get Patroni configuration: %v", err)
+	}
+	if !standby {
+		c.standbyPromotionPending = false
+		return nil
+	}
+
+	c.logger.Infof("promoting standby cluster, standby leader is pod %q", masterPod.Name)
+	if err = c.patroni.PromoteStandbyCluster(ctx, masterPod); err != nil {
+		return fmt.Errorf("could not remove standby configuration: %v", err)
+	}
+	if err = c.waitForPrimary(ctx, masterPod); err != nil {
+		return err
+	}
+
+	promotionTime := metav1.Now()
+	if _, err = c.KubeClient.SetPostgresCRDPromotionTime(c.clusterName(), promotionTime); err != nil {
+		c.logger.Warningf("could not record promotion time: %v", err)
+	}
+	c.Status.PromotionTime = &promotionTime
+	c.standbyPromotionPending = false
+	c.logger.Infof("standby cluster has been promoted, pod %q is the primary", masterPod.Name)
+	c.eventRecorder.Eventf(c.GetReference(), v1.EventTypeNormal, "Promote",
+		"Standby cluster has been promoted, pod %q is the primary", masterPod.Name)
+
+	return nil
+}
+
+// hasStandbyEnvironment tells whether the Postgres container of the statefulset is configured as a standby
+func hasStandbyEnvironment(sset *appsv1.StatefulSet) bool {
+	for _, container := range sset.Spec.Template.Spec.Containers {
+		if container.Name != constants.PostgresContainerName {
+			continue
+		}
+		for _, env := range container.Env {
+			if env.Name == "STANDBY_METHOD" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// waitForPrimary waits until the standby leader has become the leader of the Patroni cluster
+func (c *Cluster) waitForPrimary(ctx context.Context, masterPod *v1.Pod) error {
+	err := retryutil.Retry(c.OpConfig.ResourceCheckInterval, c.OpConfig.ResourceCheckTimeout,
+		func() (bool, error) {
+			members, err := c.patroni.GetClusterMembers(ctx, masterPod)
+			if err != nil {
+				c.logger.Debugf("could not get Patroni cluster members: %v", err)
+				return false, nil
+			}
+			for _, member := range members {
+				if member.Name == masterPod.Name {
+					return member.Role == "leader" || member.Role == "master", nil
+				}
+			}
+			return false, nil
+		})
+	if err != nil {
+		return fmt.Errorf("pod %q did not become the primary: %v", masterPod.Name, err)
+	}
+
+	return nil
+}
+
+// checkSwitchoverCandidate makes sure the candidate is a running replica on the
+// timeline of the leader whose replication lag does not exceed maximum_lag_on_failover
+func (c *Cluster) checkSwitchoverCandidate(ctx context.Context, masterPod *v1.Pod, candidateName string) error {
+	members, err := c.patroni.GetClusterMembers(ctx, masterPod)
+	if err != nil {
+		return fmt.Errorf("could not get Patroni cluster members: %v", err)
+	}
+
+	maxLag := uint64(patroni.DefaultMaximumLagOnFailover)
+	if c.Spec.Patroni.MaximumLagOnFailover != nil {
+		maxLag = uint64(*c.Spec.Patroni.MaximumLagOnFailover)
+	}
+
+	var (
+		candidate      *patroni.ClusterMember
+		leaderTimeline int
+	)
+	for i, member := range members {
+		if member.Role == "leader" || member.Role == "master" {
+			leaderTimeline = member.Timeline
+		}
+		if member.Name == candidateName {
+			candidate = &members[i]
+		}
+	}
+
+	if candidate == nil {
+		return fmt.Errorf("pod is not a member of the Patroni cluster")
+	}
+	if candidate.Role != "replica" && candidate.Role != "sync_standby" {
+		return fmt.Errorf("member has role %q, expected a replica", candidate.Role)
+	}
+	if candidate.State != "running" {
+		return fmt.Errorf("member is in state %q, expected running", candidate.State)
+	}
+	if leaderTimeline != 0 && candidate.Timeline != leaderTimeline {
+		return fmt.Errorf("member is on timeline %d, leader is on timeline %d", candidate.Timeline, leaderTimeline)
+	}
+	if uint64(candidate.Lag) > maxLag {
+		return fmt.Errorf("replication lag of %d bytes exceeds the maximum of %d bytes", uint64(candidate.Lag), maxLag)
+	}
+
+	return nil
+}
+
 // MigrateReplicaPod recreates pod on a new node
 func (c *Cluster) MigrateReplicaPod(podName spec.NamespacedName, fromNodeName string) error {
 	replicaPod, err := c.KubeClient.Pods(podName.Namespace).Get(context.TODO(), podName.Name, metav1.GetOptions{})
@@ -276,12 +647,12 @@ func (c *Cluster) MigrateReplicaPod(podName spec.NamespacedName, fromNodeName st
 	return nil
 }
 
-func (c *Cluster) recreatePod(podName spec.NamespacedName) (*v1.Pod, error) {
+func (c *Cluster) recreatePod(ctx context.Context, podName spec.NamespacedName) (*v1.Pod, error) {
 	ch := c.registerPodSubscriber(podName)
 	defer c.unregisterPodSubscriber(podName)
 	stopChan := make(chan struct{})
 
-	if err := c.KubeClient.Pods(podName.Namespace).Delete(context.TODO(), podName.Name, c.deleteOptions); err != nil {
+	if err := c.KubeClient.Pods(podName.Namespace).Delete(ctx, podName.Name, c.deleteOptions); err != nil {
 		return nil, fmt.Errorf("could not delete pod: %v", err)
 	}
 
@@ -293,10 +664,23 @@ func (c *Cluster) recreatePod(podName spec.NamespacedName) (*v1.Pod, error) {
 		return nil, err
 	}
 	c.logger.Infof("pod %q has been recreated", podName)
+	c.requestPodRolesRefresh()
+
 	return pod, nil
 }
 
-func (c *Cluster) isSafeToRecreatePods(pods *v1.PodList) bool {
+// syncRecreatedPodTags tags the recreated pods again right away, a new pod starts without the annotations of its
+// predecessor. Pods recreated at once are tagged together by a single call.
+func (c *Cluster) syncRecreatedPodTags(ctx context.Context) {
+	if c.Spec.NoFailover == nil && len(c.Spec.CascadingReplicas) == 0 {
+		return
+	}
+	if err := c.syncPatroniTags(ctx); err != nil {
+		c.logger.Warningf("could not set the Patroni tags of the recreated pods: %v", err)
+	}
+}
+
+func (c *Cluster) isSafeToRecreatePods(ctx context.Context, pods *v1.PodList) bool {
 
 	/*
 	 Operator should not re-create pods if there is at least one replica being bootstrapped
@@ -319,7 +703,7 @@ func (c *Cluster) isSafeToRecreatePods(pods *v1.PodList) bool {
 
 				var err error
 
-				state, err = c.patroni.GetPatroniMemberState(&pod)
+				state, err = c.patroni.GetPatroniMemberState(ctx, &pod)
 
 				if err != nil {
 					return false, err
@@ -340,7 +724,7 @@ func (c *Cluster) isSafeToRecreatePods(pods *v1.PodList) bool {
 	return true
 }
 
-func (c *Cluster) recreatePods() error {
+func (c *Cluster) recreatePods(ctx context.Context) error {
 	c.setProcessName("starting to recreate pods")
 	ls := c.labelsSet(false)
 	namespace := c.Namespace
@@ -349,43 +733,39 @@ func (c *Cluster) recreatePods() error {
 		LabelSelector: ls.String(),
 	}
 
-	pods, err := c.KubeClient.Pods(namespace).List(context.TODO(), listOptions)
+	pods, err := c.KubeClient.Pods(namespace).List(ctx, listOptions)
 	if err != nil {
 		return fmt.Errorf("could not get the list of pods: %v", err)
 	}
 	c.logger.Infof("there are %d pods in the cluster to recreate", len(pods.Items))
 
-	if !c.isSafeToRecreatePods(pods) {
+	if !c.isSafeToRecreatePods(ctx, pods) {
 		return fmt.Errorf("postpone pod recreation until next Sync: recreation is unsafe because pods are being initialized")
 	}
 
-	var (
-		masterPod, newMasterPod, newPod *v1.Pod
-	)
-	replicas := make([]spec.NamespacedName, 0)
-	for i, pod := range pods.Items {
-		role := PostgresRole(pod.Labels[c.OpConfig.PodRoleLabel])
+	if err := c.syncHooks().BeforeRollingUpdate(ctx, c.clusterName(), pods.Items); err != nil {
+		return fmt.Errorf("postpone pod recreation until next Sync: rolling update vetoed: %v", err)
+	}
 
-		if role == Master {
+	var masterPod *v1.Pod
+	replicaPods := make([]v1.Pod, 0, len(pods.Items))
+	for i, pod := range pods.Items {
+		if PostgresRole(pod.Labels[c.OpConfig.PodRoleLabel]) == Master {
 			masterPod = &pods.Items[i]
 			continue
 		}
+		replicaPods = append(replicaPods, pod)
+	}
 
-		podName := util.NameFromMeta(pods.Items[i].ObjectMeta)
-		if newPod, err = c.recreatePod(podName); err != nil {
-			return fmt.Errorf("could not recreate replica pod %q: %v", util.NameFromMeta(pod.ObjectMeta), err)
-		}
-		if newRole := PostgresRole(newPod.Labels[c.OpConfig.PodRoleLabel]); newRole == Replica {
-			replicas = append(replicas, util.NameFromMeta(pod.ObjectMeta))
-		} else if newRole == Master {
-			newMasterPod = newPod
-		}
+	replicas, newMasterPod, err := c.recreateReplicaPods(ctx, replicaPods, c.maxUnavailableReplicas(len(pods.Items)), c.recreateReplicaPod)
+	if err != nil {
+		return err
 	}
 
 	if masterPod != nil {
 		// failover if we have not observed a master pod when re-creating former replicas.
 		if newMasterPod == nil && len(replicas) > 0 {
-			if err := c.Switchover(masterPod, masterCandidate(replicas)); err != nil {
+			if err := c.Switchover(ctx, masterPod, masterCandidate(replicas)); err != nil {
 				c.logger.Warningf("could not perform switch over: %v", err)
 			}
 		} else if newMasterPod == nil && len(replicas) == 0 {
@@ -393,14 +773,95 @@ func (c *Cluster) recreatePods() error {
 		}
 		c.logger.Infof("recreating old master pod %q", util.NameFromMeta(masterPod.ObjectMeta))
 
-		if _, err := c.recreatePod(util.NameFromMeta(masterPod.ObjectMeta)); err != nil {
+		if _, err := c.recreatePod(ctx, util.NameFromMeta(masterPod.ObjectMeta)); err != nil {
 			return fmt.Errorf("could not recreate old master pod %q: %v", util.NameFromMeta(masterPod.ObjectMeta), err)
 		}
+		c.syncRecreatedPodTags(ctx)
 	}
 
 	return nil
 }
 
+// maxUnavailableReplicas returns the number of replicas a rolling update recreates at once, one by default. It is
+// capped so that a majority of the instances stays up, but allows for one replica at least.
+func (c *Cluster) maxUnavailableReplicas(instances int) int {
+	maxUnavailable := 1
+	if c.Spec.MaxUnavailableReplicas != nil && *c.Spec.MaxUnavailableReplicas > 1 {
+		maxUnavailable = int(*c.Spec.MaxUnavailableReplicas)
+	}
+	if quorum := (instances - 1) / 2; maxUnavailable > quorum {
+		maxUnavailable = quorum
+	}
+	if maxUnavailable < 1 {
+		maxUnavailable = 1
+	}
+	return maxUnavailable
+}
+
+// recreateReplicaPods recreates the replicas in batches of the given size, a batch starts once the pods of the
+// previous one have been recreated. It returns the recreated replicas and the pod that became master meanwhile.
+func (c *Cluster) recreateReplicaPods(ctx context.Context, pods []v1.Pod, batchSize int,
+	recreate func(context.Context, spec.NamespacedName) (*v1.Pod, error)) ([]spec.NamespacedName, *v1.Pod, error) {
+
+	var newMasterPod *v1.Pod
+	replicas := make([]spec.NamespacedName, 0, len(pods))
+	for start := 0; start < len(pods); start += batchSize {
+		end := start + batchSize
+		if end > len(pods) {
+			end = len(pods)
+		}
+		batch := pods[start:end]
+		if len(batch) > 1 {
+			c.logger.Infof("recreating %d replica pods at once", len(batch))
+		}
+
+		newPods := make([]*v1.Pod, len(batch))
+		errs := make([]error, len(batch))
+		var wg sync.WaitGroup
+		for i := range batch {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				newPods[i], errs[i] = recreate(ctx, util.NameFromMeta(batch[i].ObjectMeta))
+			}(i)
+		}
+		wg.Wait()
+		c.syncRecreatedPodTags(ctx)
+
+		for i, pod := range batch {
+			podName := util.NameFromMeta(pod.ObjectMeta)
+			if errs[i] != nil {
+				return nil, nil, fmt.Errorf("could not recreate replica pod %q: %v", podName, errs[i])
+			}
+			if newRole := PostgresRole(newPods[i].Labels[c.OpConfig.PodRoleLabel]); newRole == Replica {
+				replicas = append(replicas, podName)
+			} else if newRole == Master {
+				newMasterPod = newPods[i]
+			}
+		}
+	}
+
+	return replicas, newMasterPod, nil
+}
+
+// recreateReplicaPod recreates a replica and waits for it to stay ready for the minReadySeconds of the manifest
+func (c *Cluster) recreateReplicaPod(ctx context.Context, podName spec.NamespacedName) (*v1.Pod, error) {
+	newPod, err := c.recreatePod(ctx, podName)
+	if err != nil {
+		return nil, err
+	}
+	// with the OnDelete strategy of the statefulset Kubernetes does not pace the pods recreated here, the
+	// minReadySeconds of the statefulset only applies to its RollingUpdate strategy and is not part of the
+	// statefulset API the operator is built against
+	if c.Spec.MinReadySeconds != nil && *c.Spec.MinReadySeconds > 0 {
+		minReady := time.Duration(*c.Spec.MinReadySeconds) * time.Second
+		if err = c.waitForPodMinReady(ctx, podName, minReady); err != nil {
+			return nil, fmt.Errorf("replica pod did not stay ready for %v: %v", minReady, err)
+		}
+	}
+	return newPod, nil
+}
+
 func (c *Cluster) podIsEndOfLife(pod *v1.Pod) (bool, error) {
 	node, err := c.KubeClient.Nodes().Get(context.TODO(), pod.Spec.NodeName, metav1.GetOptions{})
 	if err != nil {
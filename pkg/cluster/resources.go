@@ -2,6 +2,7 @@ package cluster
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"strconv"
 	"strings"
@@ -10,10 +11,13 @@ import (
 	batchv1beta1 "k8s.io/api/batch/v1beta1"
 	v1 "k8s.io/api/core/v1"
 	policybeta1 "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 
+	acidv1 "github.com/zalando/postgres-operator/pkg/apis/acid.zalan.do/v1"
 	"github.com/zalando/postgres-operator/pkg/util"
+	"github.com/zalando/postgres-operator/pkg/util/constants"
 	"github.com/zalando/postgres-operator/pkg/util/k8sutil"
 	"github.com/zalando/postgres-operator/pkg/util/retryutil"
 )
@@ -43,7 +47,7 @@ func (c *Cluster) listResources() error {
 		c.logger.Infof("found %s service: %q (uid: %q)", role, util.NameFromMeta(service.ObjectMeta), service.UID)
 	}
 
-	pods, err := c.listPods()
+	pods, err := c.listPods(context.TODO())
 	if err != nil {
 		return fmt.Errorf("could not get the list of pods: %v", err)
 	}
@@ -52,7 +56,7 @@ func (c *Cluster) listResources() error {
 		c.logger.Infof("found pod: %q (uid: %q)", util.NameFromMeta(obj.ObjectMeta), obj.UID)
 	}
 
-	pvcs, err := c.listPersistentVolumeClaims()
+	pvcs, err := c.listPersistentVolumeClaims(context.TODO())
 	if err != nil {
 		return fmt.Errorf("could not get the list of PVCs: %v", err)
 	}
@@ -64,7 +68,7 @@ func (c *Cluster) listResources() error {
 	return nil
 }
 
-func (c *Cluster) createStatefulSet() (*appsv1.StatefulSet, error) {
+func (c *Cluster) createStatefulSet(ctx context.Context) (*appsv1.StatefulSet, error) {
 	c.setProcessName("creating statefulset")
 	// check if it's allowed that spec contains initContainers
 	if c.Spec.InitContainers != nil && len(c.Spec.InitContainers) > 0 &&
@@ -77,12 +81,19 @@ func (c *Cluster) createStatefulSet() (*appsv1.StatefulSet, error) {
 		return nil, fmt.Errorf("sidecar containers specified but disabled in configuration")
 	}
 
-	statefulSetSpec, err := c.generateStatefulSet(&c.Spec)
+	sourceChecksums, err := c.podSourceChecksums(ctx, &c.Spec)
+	if err != nil {
+		return nil, err
+	}
+	statefulSetSpec, err := c.generateStatefulSet(&c.Spec, sourceChecksums)
 	if err != nil {
 		return nil, fmt.Errorf("could not generate statefulset: %v", err)
 	}
+	if err = c.checkResourceQuota(ctx, nil, statefulSetSpec); err != nil {
+		return nil, err
+	}
 	statefulSet, err := c.KubeClient.StatefulSets(statefulSetSpec.Namespace).Create(
-		context.TODO(),
+		ctx,
 		statefulSetSpec,
 		metav1.CreateOptions{})
 	if err != nil {
@@ -90,8 +101,11 @@ func (c *Cluster) createStatefulSet() (*appsv1.StatefulSet, error) {
 	}
 	c.Statefulset = statefulSet
 	c.logger.Debugf("created new statefulset %q, uid: %q", util.NameFromMeta(statefulSet.ObjectMeta), statefulSet.UID)
+	if err := c.recordStatefulSetLastApplied(ctx); err != nil {
+		c.logger.Warningf("could not record the last applied statefulset: %v", err)
+	}
 
-	return statefulSet, nil
+	return c.Statefulset, nil
 }
 
 func getPodIndex(podName string) (int32, error) {
@@ -109,8 +123,8 @@ func getPodIndex(podName string) (int32, error) {
 	return int32(res), nil
 }
 
-func (c *Cluster) preScaleDown(newStatefulSet *appsv1.StatefulSet) error {
-	masterPod, err := c.getRolePods(Master)
+func (c *Cluster) preScaleDown(ctx context.Context, newStatefulSet *appsv1.StatefulSet) error {
+	masterPod, err := c.getRolePods(ctx, Master)
 	if err != nil {
 		return fmt.Errorf("could not get master pod: %v", err)
 	}
@@ -129,7 +143,7 @@ func (c *Cluster) preScaleDown(newStatefulSet *appsv1.StatefulSet) error {
 	}
 
 	podName := fmt.Sprintf("%s-0", c.Statefulset.Name)
-	masterCandidatePod, err := c.KubeClient.Pods(c.clusterNamespace()).Get(context.TODO(), podName, metav1.GetOptions{})
+	masterCandidatePod, err := c.KubeClient.Pods(c.clusterNamespace()).Get(ctx, podName, metav1.GetOptions{})
 	if err != nil {
 		return fmt.Errorf("could not get master candidate pod: %v", err)
 	}
@@ -140,7 +154,7 @@ func (c *Cluster) preScaleDown(newStatefulSet *appsv1.StatefulSet) error {
 		return fmt.Errorf("pod %q does not belong to cluster", podName)
 	}
 
-	if err := c.patroni.Switchover(&masterPod[0], masterCandidatePod.Name); err != nil {
+	if err := c.patroni.Switchover(ctx, &masterPod[0], masterCandidatePod.Name); err != nil {
 		return fmt.Errorf("could not failover: %v", err)
 	}
 
@@ -162,9 +176,9 @@ func (c *Cluster) setRollingUpdateFlagForStatefulSet(sset *appsv1.StatefulSet, v
 
 // applyRollingUpdateFlagforStatefulSet sets the rolling update flag for the cluster's StatefulSet
 // and applies that setting to the actual running cluster.
-func (c *Cluster) applyRollingUpdateFlagforStatefulSet(val bool) error {
+func (c *Cluster) applyRollingUpdateFlagforStatefulSet(ctx context.Context, val bool) error {
 	c.setRollingUpdateFlagForStatefulSet(c.Statefulset, val, "applyRollingUpdateFlag")
-	sset, err := c.updateStatefulSetAnnotations(c.Statefulset.GetAnnotations())
+	sset, err := c.updateStatefulSetAnnotations(ctx, c.Statefulset.GetAnnotations())
 	if err != nil {
 		return err
 	}
@@ -220,14 +234,14 @@ func (c *Cluster) mergeRollingUpdateFlagUsingCache(runningStatefulSet *appsv1.St
 	return podsRollingUpdateRequired
 }
 
-func (c *Cluster) updateStatefulSetAnnotations(annotations map[string]string) (*appsv1.StatefulSet, error) {
+func (c *Cluster) updateStatefulSetAnnotations(ctx context.Context, annotations map[string]string) (*appsv1.StatefulSet, error) {
 	c.logger.Debugf("patching statefulset annotations")
 	patchData, err := metaAnnotationsPatch(annotations)
 	if err != nil {
 		return nil, fmt.Errorf("could not form patch for the statefulset metadata: %v", err)
 	}
 	result, err := c.KubeClient.StatefulSets(c.Statefulset.Namespace).Patch(
-		context.TODO(),
+		ctx,
 		c.Statefulset.Name,
 		types.MergePatchType,
 		[]byte(patchData),
@@ -239,16 +253,105 @@ func (c *Cluster) updateStatefulSetAnnotations(annotations map[string]string) (*
 	return result, nil
 
 }
-func (c *Cluster) updateStatefulSet(newStatefulSet *appsv1.StatefulSet) error {
+
+// updateStatefulSetLabels sets the labels of the statefulset to the desired ones, removing the labels not
+// desired anymore
+func (c *Cluster) updateStatefulSetLabels(ctx context.Context, desiredLabels map[string]string) error {
+	c.logger.Debugf("patching statefulset labels")
+	patchData, err := metaLabelsPatch(c.Statefulset.Labels, desiredLabels)
+	if err != nil {
+		return fmt.Errorf("could not form patch for the statefulset metadata: %v", err)
+	}
+	statefulSet, err := c.KubeClient.StatefulSets(c.Statefulset.Namespace).Patch(
+		ctx, c.Statefulset.Name, types.MergePatchType, patchData, metav1.PatchOptions{}, "")
+	if err != nil {
+		return fmt.Errorf("could not patch statefulset labels %q: %v", patchData, err)
+	}
+	c.Statefulset = statefulSet
+
+	return nil
+}
+
+// recordStatefulSetLastApplied keeps the hashes of the statefulset fields as written by the operator in an
+// annotation, to recognize manual changes on the next sync
+func (c *Cluster) recordStatefulSetLastApplied(ctx context.Context) error {
+	if c.Statefulset == nil {
+		return nil
+	}
+	lastApplied, err := lastAppliedAnnotation(statefulSetFields(c.Statefulset))
+	if err != nil {
+		return err
+	}
+	if c.Statefulset.Annotations[constants.LastAppliedAnnotationKey] == lastApplied {
+		return nil
+	}
+
+	statefulSet, err := c.updateStatefulSetAnnotations(ctx, map[string]string{constants.LastAppliedAnnotationKey: lastApplied})
+	if err != nil {
+		return err
+	}
+	c.Statefulset = statefulSet
+
+	return nil
+}
+
+// scaleStatefulSet patches only the number of replicas, so the pod template of the statefulset stays untouched
+func (c *Cluster) scaleStatefulSet(ctx context.Context, newStatefulSet *appsv1.StatefulSet) error {
+	c.setProcessName("scaling statefulset")
+	if c.Statefulset == nil {
+		return fmt.Errorf("there is no statefulset in the cluster")
+	}
+	statefulSetName := util.NameFromMeta(c.Statefulset.ObjectMeta)
+
+	if err := c.checkResourceQuota(ctx, c.Statefulset, newStatefulSet); err != nil {
+		return err
+	}
+
+	if *c.Statefulset.Spec.Replicas > *newStatefulSet.Spec.Replicas {
+		if err := c.preScaleDown(ctx, newStatefulSet); err != nil {
+			c.logger.Warningf("could not scale down: %v", err)
+		}
+	}
+	c.logger.Debugf("scaling statefulset from %d to %d replicas", *c.Statefulset.Spec.Replicas, *newStatefulSet.Spec.Replicas)
+
+	patchData, err := specPatch(map[string]int32{"replicas": *newStatefulSet.Spec.Replicas})
+	if err != nil {
+		return fmt.Errorf("could not form patch for the statefulset %q: %v", statefulSetName, err)
+	}
+
+	statefulSet, err := c.KubeClient.StatefulSets(c.Statefulset.Namespace).Patch(
+		ctx,
+		c.Statefulset.Name,
+		types.MergePatchType,
+		patchData,
+		metav1.PatchOptions{},
+		"")
+	if err != nil {
+		return fmt.Errorf("could not patch the replicas of statefulset %q: %v", statefulSetName, err)
+	}
+
+	c.Statefulset = statefulSet
+	if err := c.recordStatefulSetLastApplied(ctx); err != nil {
+		c.logger.Warningf("could not record the last applied statefulset: %v", err)
+	}
+
+	return nil
+}
+
+func (c *Cluster) updateStatefulSet(ctx context.Context, newStatefulSet *appsv1.StatefulSet) error {
 	c.setProcessName("updating statefulset")
 	if c.Statefulset == nil {
 		return fmt.Errorf("there is no statefulset in the cluster")
 	}
 	statefulSetName := util.NameFromMeta(c.Statefulset.ObjectMeta)
 
+	if err := c.checkResourceQuota(ctx, c.Statefulset, newStatefulSet); err != nil {
+		return err
+	}
+
 	//scale down
 	if *c.Statefulset.Spec.Replicas > *newStatefulSet.Spec.Replicas {
-		if err := c.preScaleDown(newStatefulSet); err != nil {
+		if err := c.preScaleDown(ctx, newStatefulSet); err != nil {
 			c.logger.Warningf("could not scale down: %v", err)
 		}
 	}
@@ -260,7 +363,7 @@ func (c *Cluster) updateStatefulSet(newStatefulSet *appsv1.StatefulSet) error {
 	}
 
 	statefulSet, err := c.KubeClient.StatefulSets(c.Statefulset.Namespace).Patch(
-		context.TODO(),
+		ctx,
 		c.Statefulset.Name,
 		types.MergePatchType,
 		patchData,
@@ -271,25 +374,32 @@ func (c *Cluster) updateStatefulSet(newStatefulSet *appsv1.StatefulSet) error {
 	}
 
 	if newStatefulSet.Annotations != nil {
-		statefulSet, err = c.updateStatefulSetAnnotations(newStatefulSet.Annotations)
+		statefulSet, err = c.updateStatefulSetAnnotations(ctx, newStatefulSet.Annotations)
 		if err != nil {
 			return err
 		}
 	}
 
 	c.Statefulset = statefulSet
+	if err := c.recordStatefulSetLastApplied(ctx); err != nil {
+		c.logger.Warningf("could not record the last applied statefulset: %v", err)
+	}
 
 	return nil
 }
 
 // replaceStatefulSet deletes an old StatefulSet and creates the new using spec in the PostgreSQL CRD.
-func (c *Cluster) replaceStatefulSet(newStatefulSet *appsv1.StatefulSet) error {
+func (c *Cluster) replaceStatefulSet(ctx context.Context, newStatefulSet *appsv1.StatefulSet) error {
 	c.setProcessName("replacing statefulset")
 	if c.Statefulset == nil {
 		return fmt.Errorf("there is no statefulset in the cluster")
 	}
 
 	statefulSetName := util.NameFromMeta(c.Statefulset.ObjectMeta)
+
+	if err := c.checkResourceQuota(ctx, c.Statefulset, newStatefulSet); err != nil {
+		return err
+	}
 	c.logger.Debugf("replacing statefulset")
 
 	// Delete the current statefulset without deleting the pods
@@ -297,7 +407,7 @@ func (c *Cluster) replaceStatefulSet(newStatefulSet *appsv1.StatefulSet) error {
 	oldStatefulset := c.Statefulset
 
 	options := metav1.DeleteOptions{PropagationPolicy: &deletePropagationPolicy}
-	err := c.KubeClient.StatefulSets(oldStatefulset.Namespace).Delete(context.TODO(), oldStatefulset.Name, options)
+	err := c.KubeClient.StatefulSets(oldStatefulset.Namespace).Delete(ctx, oldStatefulset.Name, options)
 	if err != nil {
 		return fmt.Errorf("could not delete statefulset %q: %v", statefulSetName, err)
 	}
@@ -308,7 +418,7 @@ func (c *Cluster) replaceStatefulSet(newStatefulSet *appsv1.StatefulSet) error {
 
 	err = retryutil.Retry(c.OpConfig.ResourceCheckInterval, c.OpConfig.ResourceCheckTimeout,
 		func() (bool, error) {
-			_, err2 := c.KubeClient.StatefulSets(oldStatefulset.Namespace).Get(context.TODO(), oldStatefulset.Name, metav1.GetOptions{})
+			_, err2 := c.KubeClient.StatefulSets(oldStatefulset.Namespace).Get(ctx, oldStatefulset.Name, metav1.GetOptions{})
 			if err2 == nil {
 				return false, nil
 			}
@@ -322,7 +432,7 @@ func (c *Cluster) replaceStatefulSet(newStatefulSet *appsv1.StatefulSet) error {
 	}
 
 	// create the new statefulset with the desired spec. It would take over the remaining pods.
-	createdStatefulset, err := c.KubeClient.StatefulSets(newStatefulSet.Namespace).Create(context.TODO(), newStatefulSet, metav1.CreateOptions{})
+	createdStatefulset, err := c.KubeClient.StatefulSets(newStatefulSet.Namespace).Create(ctx, newStatefulSet, metav1.CreateOptions{})
 	if err != nil {
 		return fmt.Errorf("could not create statefulset %q: %v", statefulSetName, err)
 	}
@@ -333,9 +443,135 @@ func (c *Cluster) replaceStatefulSet(newStatefulSet *appsv1.StatefulSet) error {
 	}
 
 	c.Statefulset = createdStatefulset
+	if err := c.recordStatefulSetLastApplied(ctx); err != nil {
+		c.logger.Warningf("could not record the last applied statefulset: %v", err)
+	}
 	return nil
 }
 
+// checkResourceQuota verifies that the pods and volumes added by creating or updating the statefulset fit into
+// the resource quotas of the namespace. Otherwise the statefulset would be accepted, but its pods or volumes
+// rejected, and the operator would only notice the pods never becoming ready.
+func (c *Cluster) checkResourceQuota(ctx context.Context, oldStatefulSet, newStatefulSet *appsv1.StatefulSet) error {
+	quotas, err := c.KubeClient.ResourceQuotas(newStatefulSet.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		c.logger.Warningf("could not list resource quotas, skipping the quota check: %v", err)
+		return nil
+	}
+
+	requested := statefulSetQuotaUsage(oldStatefulSet, newStatefulSet)
+	for _, quota := range quotas.Items {
+		// quotas restricted to scopes or priority classes might not apply to the pods
+		if len(quota.Spec.Scopes) > 0 || quota.Spec.ScopeSelector != nil {
+			continue
+		}
+		for name, hard := range quota.Status.Hard {
+			add, ok := requested[name]
+			if !ok || add.Sign() <= 0 {
+				continue
+			}
+			used := quota.Status.Used[name]
+			total := used.DeepCopy()
+			total.Add(add)
+			if total.Cmp(hard) > 0 {
+				err = fmt.Errorf("statefulset %q would exceed resource quota %q: %s requested %s, used %s, limited to %s",
+					util.NameFromMeta(newStatefulSet.ObjectMeta), quota.Name, name, add.String(), used.String(), hard.String())
+				c.eventRecorder.Event(c.GetReference(), v1.EventTypeWarning, "ResourceQuota", err.Error())
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// statefulSetQuotaUsage returns the quota usage the new statefulset adds on top of the old one. Pods are
+// replaced with the new spec, while volume claims of the existing pods are kept.
+func statefulSetQuotaUsage(oldStatefulSet, newStatefulSet *appsv1.StatefulSet) v1.ResourceList {
+	var oldReplicas int64
+	var oldPodUsage v1.ResourceList
+	if oldStatefulSet != nil && oldStatefulSet.Spec.Replicas != nil {
+		oldReplicas = int64(*oldStatefulSet.Spec.Replicas)
+		oldPodUsage = podQuotaUsage(&oldStatefulSet.Spec.Template.Spec)
+	}
+	newReplicas := int64(1)
+	if newStatefulSet.Spec.Replicas != nil {
+		newReplicas = int64(*newStatefulSet.Spec.Replicas)
+	}
+
+	usage := v1.ResourceList{}
+	for name, quantity := range podQuotaUsage(&newStatefulSet.Spec.Template.Spec) {
+		delta := multiplyQuantity(quantity, newReplicas)
+		if oldQuantity, ok := oldPodUsage[name]; ok {
+			delta.Sub(multiplyQuantity(oldQuantity, oldReplicas))
+		}
+		usage[name] = delta
+	}
+
+	if addedPods := newReplicas - oldReplicas; addedPods > 0 {
+		storage := resource.Quantity{}
+		for _, claim := range newStatefulSet.Spec.VolumeClaimTemplates {
+			storage.Add(claim.Spec.Resources.Requests[v1.ResourceStorage])
+		}
+		usage[v1.ResourcePersistentVolumeClaims] = *resource.NewQuantity(addedPods*int64(len(newStatefulSet.Spec.VolumeClaimTemplates)), resource.DecimalSI)
+		usage[v1.ResourceRequestsStorage] = multiplyQuantity(storage, addedPods)
+	}
+
+	return usage
+}
+
+// podQuotaUsage sums up the compute resources of a pod the way a resource quota counts them: init
+// containers run one after another, so only the biggest one matters if it exceeds the regular containers.
+func podQuotaUsage(podSpec *v1.PodSpec) v1.ResourceList {
+	requests := v1.ResourceList{}
+	limits := v1.ResourceList{}
+	for _, container := range podSpec.Containers {
+		addResources(requests, container.Resources.Requests)
+		addResources(limits, container.Resources.Limits)
+	}
+	for _, container := range podSpec.InitContainers {
+		maxResources(requests, container.Resources.Requests)
+		maxResources(limits, container.Resources.Limits)
+	}
+
+	usage := v1.ResourceList{v1.ResourcePods: *resource.NewQuantity(1, resource.DecimalSI)}
+	if cpu, ok := requests[v1.ResourceCPU]; ok {
+		usage[v1.ResourceCPU] = cpu
+		usage[v1.ResourceRequestsCPU] = cpu
+	}
+	if memory, ok := requests[v1.ResourceMemory]; ok {
+		usage[v1.ResourceMemory] = memory
+		usage[v1.ResourceRequestsMemory] = memory
+	}
+	if cpu, ok := limits[v1.ResourceCPU]; ok {
+		usage[v1.ResourceLimitsCPU] = cpu
+	}
+	if memory, ok := limits[v1.ResourceMemory]; ok {
+		usage[v1.ResourceLimitsMemory] = memory
+	}
+	return usage
+}
+
+func addResources(total, resources v1.ResourceList) {
+	for name, quantity := range resources {
+		sum := total[name]
+		sum.Add(quantity)
+		total[name] = sum
+	}
+}
+
+func maxResources(total, resources v1.ResourceList) {
+	for name, quantity := range resources {
+		if current, ok := total[name]; !ok || quantity.Cmp(current) > 0 {
+			total[name] = quantity.DeepCopy()
+		}
+	}
+}
+
+func multiplyQuantity(quantity resource.Quantity, factor int64) resource.Quantity {
+	return *resource.NewMilliQuantity(quantity.MilliValue()*factor, quantity.Format)
+}
+
 func (c *Cluster) deleteStatefulSet() error {
 	c.setProcessName("deleting statefulset")
 	c.logger.Debugln("deleting statefulset")
@@ -361,12 +597,16 @@ func (c *Cluster) deleteStatefulSet() error {
 	return nil
 }
 
-func (c *Cluster) createService(role PostgresRole) (*v1.Service, error) {
+func (c *Cluster) createService(ctx context.Context, role PostgresRole) (*v1.Service, error) {
 	c.setProcessName("creating %v service", role)
 
 	serviceSpec := c.generateService(role, &c.Spec)
-	service, err := c.KubeClient.Services(serviceSpec.Namespace).Create(context.TODO(), serviceSpec, metav1.CreateOptions{})
+	service, err := c.KubeClient.Services(serviceSpec.Namespace).Create(ctx, serviceSpec, metav1.CreateOptions{})
 	if err != nil {
+		if reason, ok := k8sutil.InvalidNodePort(err); ok {
+			return nil, fmt.Errorf("could not use node port %d for the %s service: %s",
+				serviceSpec.Spec.Ports[0].NodePort, role, reason)
+		}
 		return nil, err
 	}
 
@@ -374,7 +614,7 @@ func (c *Cluster) createService(role PostgresRole) (*v1.Service, error) {
 	return service, nil
 }
 
-func (c *Cluster) updateService(role PostgresRole, newService *v1.Service) error {
+func (c *Cluster) updateService(ctx context.Context, role PostgresRole, newService *v1.Service) error {
 	var (
 		svc *v1.Service
 		err error
@@ -388,11 +628,28 @@ func (c *Cluster) updateService(role PostgresRole, newService *v1.Service) error
 
 	serviceName := util.NameFromMeta(c.Services[role].ObjectMeta)
 
+	// keep the node port allocated by Kubernetes unless a specific one is requested
+	if newService.Spec.Type != v1.ServiceTypeClusterIP {
+		for i := range newService.Spec.Ports {
+			if newService.Spec.Ports[i].NodePort == 0 && i < len(c.Services[role].Spec.Ports) {
+				newService.Spec.Ports[i].NodePort = c.Services[role].Spec.Ports[i].NodePort
+			}
+		}
+	}
+
+	// the external DNS name is removed once neither a load balancer nor the manifest asks for it
+	var removedAnnotations []string
+	if _, ok := c.Services[role].Annotations[constants.ZalandoDNSNameAnnotation]; ok {
+		if _, ok := newService.ObjectMeta.Annotations[constants.ZalandoDNSNameAnnotation]; !ok {
+			removedAnnotations = append(removedAnnotations, constants.ZalandoDNSNameAnnotation)
+		}
+	}
+
 	// update the service annotation in order to propagate ELB notation.
-	if len(newService.ObjectMeta.Annotations) > 0 {
-		if annotationsPatchData, err := metaAnnotationsPatch(newService.ObjectMeta.Annotations); err == nil {
+	if len(newService.ObjectMeta.Annotations) > 0 || len(removedAnnotations) > 0 {
+		if annotationsPatchData, err := metaAnnotationsUpdatePatch(newService.ObjectMeta.Annotations, removedAnnotations); err == nil {
 			_, err = c.KubeClient.Services(serviceName.Namespace).Patch(
-				context.TODO(),
+				ctx,
 				serviceName.Name,
 				types.MergePatchType,
 				[]byte(annotationsPatchData),
@@ -409,12 +666,17 @@ func (c *Cluster) updateService(role PostgresRole, newService *v1.Service) error
 
 	// now, patch the service spec, but when disabling LoadBalancers do update instead
 	// patch does not work because of LoadBalancerSourceRanges field (even if set to nil)
+	// the same applies to disabling the session affinity, as the merge patch cannot reset
+	// the session affinity config, and to removing the selector
 	oldServiceType := c.Services[role].Spec.Type
 	newServiceType := newService.Spec.Type
-	if newServiceType == "ClusterIP" && newServiceType != oldServiceType {
+	disableSessionAffinity := c.Services[role].Spec.SessionAffinity == v1.ServiceAffinityClientIP &&
+		newService.Spec.SessionAffinity != v1.ServiceAffinityClientIP
+	removeSelector := len(c.Services[role].Spec.Selector) > 0 && len(newService.Spec.Selector) == 0
+	if (newServiceType == "ClusterIP" && newServiceType != oldServiceType) || disableSessionAffinity || removeSelector {
 		newService.ResourceVersion = c.Services[role].ResourceVersion
 		newService.Spec.ClusterIP = c.Services[role].Spec.ClusterIP
-		svc, err = c.KubeClient.Services(serviceName.Namespace).Update(context.TODO(), newService, metav1.UpdateOptions{})
+		svc, err = c.KubeClient.Services(serviceName.Namespace).Update(ctx, newService, metav1.UpdateOptions{})
 		if err != nil {
 			return fmt.Errorf("could not update service %q: %v", serviceName, err)
 		}
@@ -425,8 +687,12 @@ func (c *Cluster) updateService(role PostgresRole, newService *v1.Service) error
 		}
 
 		svc, err = c.KubeClient.Services(serviceName.Namespace).Patch(
-			context.TODO(), serviceName.Name, types.MergePatchType, patchData, metav1.PatchOptions{}, "")
+			ctx, serviceName.Name, types.MergePatchType, patchData, metav1.PatchOptions{}, "")
 		if err != nil {
+			if reason, ok := k8sutil.InvalidNodePort(err); ok {
+				return fmt.Errorf("could not use node port %d for the service %q: %s",
+					newService.Spec.Ports[0].NodePort, serviceName, reason)
+			}
 			return fmt.Errorf("could not patch service %q: %v", serviceName, err)
 		}
 	}
@@ -435,6 +701,84 @@ func (c *Cluster) updateService(role PostgresRole, newService *v1.Service) error
 	return nil
 }
 
+// updateServiceLabels sets the labels of the service to the desired ones, removing the labels not desired
+// anymore
+func (c *Cluster) updateServiceLabels(ctx context.Context, role PostgresRole, desiredLabels map[string]string) error {
+	svc := c.Services[role]
+	patchData, err := metaLabelsPatch(svc.Labels, desiredLabels)
+	if err != nil {
+		return fmt.Errorf("could not form patch for the service metadata: %v", err)
+	}
+	svc, err = c.KubeClient.Services(svc.Namespace).Patch(
+		ctx, svc.Name, types.MergePatchType, patchData, metav1.PatchOptions{}, "")
+	if err != nil {
+		return fmt.Errorf("could not patch labels of the %s service: %v", role, err)
+	}
+	c.Services[role] = svc
+
+	return nil
+}
+
+// recordServiceLastApplied keeps the hashes of the service fields as written by the operator in an annotation,
+// to recognize manual changes on the next sync
+func (c *Cluster) recordServiceLastApplied(ctx context.Context, role PostgresRole) error {
+	svc := c.Services[role]
+	if svc == nil {
+		return nil
+	}
+	lastApplied, err := lastAppliedAnnotation(serviceFields(svc))
+	if err != nil {
+		return err
+	}
+	if svc.Annotations[constants.LastAppliedAnnotationKey] == lastApplied {
+		return nil
+	}
+
+	patchData, err := metaAnnotationsPatch(map[string]string{constants.LastAppliedAnnotationKey: lastApplied})
+	if err != nil {
+		return fmt.Errorf("could not form patch for the service metadata: %v", err)
+	}
+	svc, err = c.KubeClient.Services(svc.Namespace).Patch(ctx, svc.Name, types.MergePatchType,
+		patchData, metav1.PatchOptions{}, "")
+	if err != nil {
+		return fmt.Errorf("could not patch annotations of the service %q: %v", util.NameFromMeta(svc.ObjectMeta), err)
+	}
+	c.Services[role] = svc
+
+	return nil
+}
+
+// removeSwitchoverAnnotation removes the switchover request from the Postgres manifest
+func (c *Cluster) removeSwitchoverAnnotation(ctx context.Context) error {
+	if err := c.removeManifestAnnotation(ctx, constants.SwitchoverCandidateAnnotationKey); err != nil {
+		return fmt.Errorf("could not remove the switchover annotation: %v", err)
+	}
+	return nil
+}
+
+// removeManifestAnnotation removes the given annotation from the Postgres manifest
+func (c *Cluster) removeManifestAnnotation(ctx context.Context, key string) error {
+	patchData, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{
+				key: nil,
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("could not form patch for the postgresql manifest: %v", err)
+	}
+
+	pg, err := c.KubeClient.Postgresqls(c.Namespace).Patch(
+		ctx, c.Name, types.MergePatchType, patchData, metav1.PatchOptions{})
+	if err != nil {
+		return err
+	}
+	c.ObjectMeta.Annotations = pg.Annotations
+
+	return nil
+}
+
 func (c *Cluster) deleteService(role PostgresRole) error {
 	c.logger.Debugf("deleting service %s", role)
 
@@ -454,7 +798,62 @@ func (c *Cluster) deleteService(role PostgresRole) error {
 	return nil
 }
 
-func (c *Cluster) createEndpoint(role PostgresRole) (*v1.Endpoints, error) {
+// deletePodServices deletes the services of single pods except the ones to keep, other services of the cluster
+// are recognized by a name not ending in a pod ordinal
+func (c *Cluster) deletePodServices(ctx context.Context, keep map[string]bool) error {
+	listOptions := metav1.ListOptions{
+		LabelSelector: c.labelsSet(false).String(),
+	}
+	services, err := c.KubeClient.Services(c.Namespace).List(ctx, listOptions)
+	if err != nil {
+		return fmt.Errorf("could not list services: %v", err)
+	}
+
+	prefix := c.statefulSetName() + "-"
+	for _, service := range services.Items {
+		if keep[service.Name] || !strings.HasPrefix(service.Name, prefix) {
+			continue
+		}
+		if _, err := strconv.ParseUint(strings.TrimPrefix(service.Name, prefix), 10, 32); err != nil {
+			continue
+		}
+		if err = c.KubeClient.Services(c.Namespace).Delete(ctx, service.Name, c.deleteOptions); err != nil &&
+			!k8sutil.ResourceNotFound(err) {
+			return fmt.Errorf("could not delete pod service %q: %v", util.NameFromMeta(service.ObjectMeta), err)
+		}
+		c.logger.Infof("pod service %q has been deleted", util.NameFromMeta(service.ObjectMeta))
+	}
+
+	return nil
+}
+
+// deleteReplicaServices deletes the additional replica services except the ones to keep, recognized by the name of
+// the replica service as prefix
+func (c *Cluster) deleteReplicaServices(ctx context.Context, keep map[string]bool) error {
+	listOptions := metav1.ListOptions{
+		LabelSelector: c.labelsSet(false).String(),
+	}
+	services, err := c.KubeClient.Services(c.Namespace).List(ctx, listOptions)
+	if err != nil {
+		return fmt.Errorf("could not list services: %v", err)
+	}
+
+	prefix := c.replicaServiceName("")
+	for _, service := range services.Items {
+		if keep[service.Name] || !strings.HasPrefix(service.Name, prefix) {
+			continue
+		}
+		if err = c.KubeClient.Services(c.Namespace).Delete(ctx, service.Name, c.deleteOptions); err != nil &&
+			!k8sutil.ResourceNotFound(err) {
+			return fmt.Errorf("could not delete replica service %q: %v", util.NameFromMeta(service.ObjectMeta), err)
+		}
+		c.logger.Infof("replica service %q has been deleted", util.NameFromMeta(service.ObjectMeta))
+	}
+
+	return nil
+}
+
+func (c *Cluster) createEndpoint(ctx context.Context, role PostgresRole) (*v1.Endpoints, error) {
 	var (
 		subsets []v1.EndpointSubset
 	)
@@ -468,7 +867,7 @@ func (c *Cluster) createEndpoint(role PostgresRole) (*v1.Endpoints, error) {
 	}
 	endpointsSpec := c.generateEndpoint(role, subsets)
 
-	endpoints, err := c.KubeClient.Endpoints(endpointsSpec.Namespace).Create(context.TODO(), endpointsSpec, metav1.CreateOptions{})
+	endpoints, err := c.KubeClient.Endpoints(endpointsSpec.Namespace).Create(ctx, endpointsSpec, metav1.CreateOptions{})
 	if err != nil {
 		return nil, fmt.Errorf("could not create %s endpoint: %v", role, err)
 	}
@@ -479,38 +878,44 @@ func (c *Cluster) createEndpoint(role PostgresRole) (*v1.Endpoints, error) {
 }
 
 func (c *Cluster) generateEndpointSubsets(role PostgresRole) []v1.EndpointSubset {
-	result := make([]v1.EndpointSubset, 0)
-	pods, err := c.getRolePods(role)
+	pods, err := c.getRolePods(context.TODO(), role)
 	if err != nil {
 		if role == Master {
 			c.logger.Warningf("could not obtain the address for %s pod: %v", role, err)
 		} else {
 			c.logger.Warningf("could not obtain the addresses for %s pods: %v", role, err)
 		}
-		return result
+		return make([]v1.EndpointSubset, 0)
 	}
 
 	endPointAddresses := make([]v1.EndpointAddress, 0)
 	for _, pod := range pods {
 		endPointAddresses = append(endPointAddresses, v1.EndpointAddress{IP: pod.Status.PodIP})
 	}
-	if len(endPointAddresses) > 0 {
+	if len(endPointAddresses) == 0 && role == Master {
+		c.logger.Warningf("master is not running, generated master endpoint does not contain any addresses")
+	}
+
+	return endpointSubsets(endPointAddresses)
+}
+
+// endpointSubsets returns the subset of an endpoint with the Postgres port of the addresses, none without addresses
+func endpointSubsets(addresses []v1.EndpointAddress) []v1.EndpointSubset {
+	result := make([]v1.EndpointSubset, 0)
+	if len(addresses) > 0 {
 		result = append(result, v1.EndpointSubset{
-			Addresses: endPointAddresses,
+			Addresses: addresses,
 			Ports:     []v1.EndpointPort{{Name: "postgresql", Port: 5432, Protocol: "TCP"}},
 		})
-	} else if role == Master {
-		c.logger.Warningf("master is not running, generated master endpoint does not contain any addresses")
 	}
-
 	return result
 }
 
-func (c *Cluster) createPodDisruptionBudget() (*policybeta1.PodDisruptionBudget, error) {
+func (c *Cluster) createPodDisruptionBudget(ctx context.Context) (*policybeta1.PodDisruptionBudget, error) {
 	podDisruptionBudgetSpec := c.generatePodDisruptionBudget()
 	podDisruptionBudget, err := c.KubeClient.
 		PodDisruptionBudgets(podDisruptionBudgetSpec.Namespace).
-		Create(context.TODO(), podDisruptionBudgetSpec, metav1.CreateOptions{})
+		Create(ctx, podDisruptionBudgetSpec, metav1.CreateOptions{})
 
 	if err != nil {
 		return nil, err
@@ -520,7 +925,7 @@ func (c *Cluster) createPodDisruptionBudget() (*policybeta1.PodDisruptionBudget,
 	return podDisruptionBudget, nil
 }
 
-func (c *Cluster) updatePodDisruptionBudget(pdb *policybeta1.PodDisruptionBudget) error {
+func (c *Cluster) updatePodDisruptionBudget(ctx context.Context, pdb *policybeta1.PodDisruptionBudget) error {
 	if c.PodDisruptionBudget == nil {
 		return fmt.Errorf("there is no pod disruption budget in the cluster")
 	}
@@ -531,7 +936,7 @@ func (c *Cluster) updatePodDisruptionBudget(pdb *policybeta1.PodDisruptionBudget
 
 	newPdb, err := c.KubeClient.
 		PodDisruptionBudgets(pdb.Namespace).
-		Create(context.TODO(), pdb, metav1.CreateOptions{})
+		Create(ctx, pdb, metav1.CreateOptions{})
 	if err != nil {
 		return fmt.Errorf("could not create pod disruption budget: %v", err)
 	}
@@ -540,6 +945,23 @@ func (c *Cluster) updatePodDisruptionBudget(pdb *policybeta1.PodDisruptionBudget
 	return nil
 }
 
+// updatePodDisruptionBudgetLabels sets the labels of the pod disruption budget to the desired ones, unlike a
+// changed spec this does not need to recreate it
+func (c *Cluster) updatePodDisruptionBudgetLabels(ctx context.Context, desiredLabels map[string]string) error {
+	patchData, err := metaLabelsPatch(c.PodDisruptionBudget.Labels, desiredLabels)
+	if err != nil {
+		return fmt.Errorf("could not form patch for the pod disruption budget metadata: %v", err)
+	}
+	pdb, err := c.KubeClient.PodDisruptionBudgets(c.PodDisruptionBudget.Namespace).Patch(
+		ctx, c.PodDisruptionBudget.Name, types.MergePatchType, patchData, metav1.PatchOptions{}, "")
+	if err != nil {
+		return fmt.Errorf("could not patch labels of the pod disruption budget: %v", err)
+	}
+	c.PodDisruptionBudget = pdb
+
+	return nil
+}
+
 func (c *Cluster) deletePodDisruptionBudget() error {
 	c.logger.Debug("deleting pod disruption budget")
 	if c.PodDisruptionBudget == nil {
@@ -593,12 +1015,107 @@ func (c *Cluster) deleteEndpoint(role PostgresRole) error {
 	return nil
 }
 
+// deletePatroniRole removes the Patroni role and its binding, objects of the same name which are
+// not labeled as part of the cluster are left alone
+func (c *Cluster) deletePatroniRole() error {
+	name := c.patroniRoleName()
+
+	roleBinding, err := c.KubeClient.RoleBindings(c.Namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil && !k8sutil.ResourceNotFound(err) {
+		return fmt.Errorf("could not get role binding %q: %v", name, err)
+	}
+	if err == nil && c.hasClusterLabels(roleBinding.Labels) {
+		if err = c.KubeClient.RoleBindings(c.Namespace).Delete(context.TODO(), name, c.deleteOptions); err != nil {
+			return fmt.Errorf("could not delete role binding %q: %v", name, err)
+		}
+		c.logger.Infof("role binding %q of the Patroni role has been deleted", name)
+	}
+
+	role, err := c.KubeClient.Roles(c.Namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil && !k8sutil.ResourceNotFound(err) {
+		return fmt.Errorf("could not get role %q: %v", name, err)
+	}
+	if err == nil && c.hasClusterLabels(role.Labels) {
+		if err = c.KubeClient.Roles(c.Namespace).Delete(context.TODO(), name, c.deleteOptions); err != nil {
+			return fmt.Errorf("could not delete role %q: %v", name, err)
+		}
+		c.logger.Infof("Patroni role %q has been deleted", name)
+	}
+
+	return nil
+}
+
+// deleteMasterTCPRoute deletes the TCPRoute to the master service, neither a missing TCPRoute nor missing CRDs of
+// the Gateway API are an error
+func (c *Cluster) deleteMasterTCPRoute(ctx context.Context) error {
+	if c.KubeClient.DynamicClient == nil {
+		return nil
+	}
+	tcpRoutes := c.KubeClient.DynamicClient.Resource(tcpRouteResource).Namespace(c.Namespace)
+	name := c.serviceName(Master)
+
+	tcpRoute, err := tcpRoutes.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if k8sutil.ResourceNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("could not get TCP route: %v", err)
+	}
+	if !c.hasClusterLabels(tcpRoute.GetLabels()) {
+		return nil
+	}
+
+	if err = tcpRoutes.Delete(ctx, name, c.deleteOptions); err != nil && !k8sutil.ResourceNotFound(err) {
+		return fmt.Errorf("could not delete TCP route: %v", err)
+	}
+	c.logger.Infof("TCP route %q has been deleted", util.NameFromMeta(metav1.ObjectMeta{Namespace: c.Namespace, Name: name}))
+
+	return nil
+}
+
+// deletePodMonitor deletes the PodMonitor of the cluster, neither a missing PodMonitor nor missing CRDs of the
+// Prometheus operator are an error
+func (c *Cluster) deletePodMonitor(ctx context.Context) error {
+	if c.KubeClient.DynamicClient == nil {
+		return nil
+	}
+	podMonitors := c.KubeClient.DynamicClient.Resource(podMonitorResource).Namespace(c.Namespace)
+
+	podMonitor, err := podMonitors.Get(ctx, c.Name, metav1.GetOptions{})
+	if err != nil {
+		if k8sutil.ResourceNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("could not get pod monitor: %v", err)
+	}
+	if !c.hasClusterLabels(podMonitor.GetLabels()) {
+		return nil
+	}
+
+	if err = podMonitors.Delete(ctx, c.Name, c.deleteOptions); err != nil && !k8sutil.ResourceNotFound(err) {
+		return fmt.Errorf("could not delete pod monitor: %v", err)
+	}
+	c.logger.Infof("pod monitor %q has been deleted", util.NameFromMeta(metav1.ObjectMeta{Namespace: c.Namespace, Name: c.Name}))
+
+	return nil
+}
+
+// hasClusterLabels checks that an object carries the labels of the cluster
+func (c *Cluster) hasClusterLabels(objectLabels map[string]string) bool {
+	for key, value := range c.labelsSet(false) {
+		if objectLabels[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
 func (c *Cluster) deleteSecrets() error {
 	c.setProcessName("deleting secrets")
 	var errors []string
 	errorCount := 0
 	for uid, secret := range c.Secrets {
-		err := c.deleteSecret(uid, *secret)
+		err := c.deleteSecret(context.TODO(), uid, *secret)
 		if err != nil {
 			errors = append(errors, fmt.Sprintf("%v", err))
 			errorCount++
@@ -612,11 +1129,11 @@ func (c *Cluster) deleteSecrets() error {
 	return nil
 }
 
-func (c *Cluster) deleteSecret(uid types.UID, secret v1.Secret) error {
+func (c *Cluster) deleteSecret(ctx context.Context, uid types.UID, secret v1.Secret) error {
 	c.setProcessName("deleting secret")
 	secretName := util.NameFromMeta(secret.ObjectMeta)
 	c.logger.Debugf("deleting secret %q", secretName)
-	err := c.KubeClient.Secrets(secret.Namespace).Delete(context.TODO(), secret.Name, c.deleteOptions)
+	err := c.KubeClient.Secrets(secret.Namespace).Delete(ctx, secret.Name, c.deleteOptions)
 	if err != nil {
 		return fmt.Errorf("could not delete secret %q: %v", secretName, err)
 	}
@@ -628,10 +1145,10 @@ func (c *Cluster) deleteSecret(uid types.UID, secret v1.Secret) error {
 
 func (c *Cluster) createRoles() (err error) {
 	// TODO: figure out what to do with duplicate names (humans and robots) among pgUsers
-	return c.syncRoles()
+	return c.syncRoles(context.TODO())
 }
 
-func (c *Cluster) createLogicalBackupJob() (err error) {
+func (c *Cluster) createLogicalBackupJob(ctx context.Context) (err error) {
 
 	c.setProcessName("creating a k8s cron job for logical backups")
 
@@ -641,7 +1158,7 @@ func (c *Cluster) createLogicalBackupJob() (err error) {
 	}
 	c.logger.Debugf("Generated cronJobSpec: %v", logicalBackupJobSpec)
 
-	_, err = c.KubeClient.CronJobsGetter.CronJobs(c.Namespace).Create(context.TODO(), logicalBackupJobSpec, metav1.CreateOptions{})
+	_, err = c.KubeClient.CronJobsGetter.CronJobs(c.Namespace).Create(ctx, logicalBackupJobSpec, metav1.CreateOptions{})
 	if err != nil {
 		return fmt.Errorf("could not create k8s cron job: %v", err)
 	}
@@ -649,7 +1166,7 @@ func (c *Cluster) createLogicalBackupJob() (err error) {
 	return nil
 }
 
-func (c *Cluster) patchLogicalBackupJob(newJob *batchv1beta1.CronJob) error {
+func (c *Cluster) patchLogicalBackupJob(ctx context.Context, newJob *batchv1beta1.CronJob) error {
 	c.setProcessName("patching logical backup job")
 
 	patchData, err := specPatch(newJob.Spec)
@@ -659,7 +1176,7 @@ func (c *Cluster) patchLogicalBackupJob(newJob *batchv1beta1.CronJob) error {
 
 	// update the backup job spec
 	_, err = c.KubeClient.CronJobsGetter.CronJobs(c.Namespace).Patch(
-		context.TODO(),
+		ctx,
 		c.getLogicalBackupJobName(),
 		types.MergePatchType,
 		patchData,
@@ -672,11 +1189,43 @@ func (c *Cluster) patchLogicalBackupJob(newJob *batchv1beta1.CronJob) error {
 	return nil
 }
 
-func (c *Cluster) deleteLogicalBackupJob() error {
+func (c *Cluster) deleteLogicalBackupJob(ctx context.Context) error {
 
 	c.logger.Info("removing the logical backup job")
 
-	return c.KubeClient.CronJobsGetter.CronJobs(c.Namespace).Delete(context.TODO(), c.getLogicalBackupJobName(), c.deleteOptions)
+	return c.KubeClient.CronJobsGetter.CronJobs(c.Namespace).Delete(ctx, c.getLogicalBackupJobName(), c.deleteOptions)
+}
+
+func (c *Cluster) patchBackupVerificationJob(ctx context.Context, newJob *batchv1beta1.CronJob) error {
+	c.setProcessName("patching backup verification job")
+
+	patchData, err := specPatch(newJob.Spec)
+	if err != nil {
+		return fmt.Errorf("could not form patch for the backup verification job: %v", err)
+	}
+
+	_, err = c.KubeClient.CronJobsGetter.CronJobs(c.Namespace).Patch(
+		ctx, c.getBackupVerificationJobName(), types.MergePatchType, patchData, metav1.PatchOptions{}, "")
+	if err != nil {
+		return fmt.Errorf("could not patch backup verification job: %v", err)
+	}
+
+	return nil
+}
+
+// deleteBackupVerificationJob removes the backup verification cron job together with its jobs and their pods, and
+// the condition reporting their result
+func (c *Cluster) deleteBackupVerificationJob(ctx context.Context) error {
+	c.logger.Info("removing the backup verification job")
+
+	propagationPolicy := metav1.DeletePropagationBackground
+	err := c.KubeClient.CronJobsGetter.CronJobs(c.Namespace).Delete(
+		ctx, c.getBackupVerificationJobName(), metav1.DeleteOptions{PropagationPolicy: &propagationPolicy})
+	if err != nil && !k8sutil.ResourceNotFound(err) {
+		return fmt.Errorf("could not delete backup verification job: %v", err)
+	}
+
+	return c.removeCondition(acidv1.ClusterConditionBackupVerified)
 }
 
 // GetServiceMaster returns cluster's kubernetes master Service
@@ -2,75 +2,158 @@ package cluster
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"math"
+	"path"
+	"reflect"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	acidv1 "github.com/zalando/postgres-operator/pkg/apis/acid.zalan.do/v1"
 	"github.com/zalando/postgres-operator/pkg/spec"
 	"github.com/zalando/postgres-operator/pkg/util"
 	"github.com/zalando/postgres-operator/pkg/util/constants"
 	"github.com/zalando/postgres-operator/pkg/util/k8sutil"
+	"github.com/zalando/postgres-operator/pkg/util/patroni"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	batchv1beta1 "k8s.io/api/batch/v1beta1"
 	v1 "k8s.io/api/core/v1"
 	policybeta1 "k8s.io/api/policy/v1beta1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
 )
 
+// time given to keep a rolling update pending after a failed sync step, whose context may have expired already
+const rollingUpdateFlagTimeout = 30 * time.Second
+
+// time given to restore the previous system passwords after a failed rotation, independent of the expired step
+const systemPasswordRevertTimeout = time.Minute
+
 // Sync syncs the cluster, making sure the actual Kubernetes objects correspond to what is defined in the manifest.
 // Unlike the update, sync does not error out if some objects do not exist and takes care of creating them.
 func (c *Cluster) Sync(newSpec *acidv1.Postgresql) error {
 	var err error
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	// the periodic sync gives up on a cluster locked by a hanging operation and is retried on the next resync
+	if err = c.mu.lockWithTimeout("sync", c.OpConfig.ClusterLockTimeout, c.logger); err != nil {
+		return err
+	}
+	defer c.mu.unlock(c.logger)
+
+	if c.syncUnchanged(newSpec) {
+		c.logger.Debugf("skipping the sync of the unchanged manifest generation %d until the next full resync",
+			newSpec.Generation)
+		return nil
+	}
 
 	oldSpec := c.Postgresql
 	c.setSpec(newSpec)
+	c.trackStandbyPromotion(&oldSpec.Spec, &newSpec.Spec)
+	c.trackRemovedLibraries(&oldSpec.Spec, &newSpec.Spec)
+	c.syncDrift = false
 
 	defer func() {
 		if err != nil {
+			c.syncDrift = true
 			c.logger.Warningf("error while syncing cluster state: %v", err)
 			c.KubeClient.SetPostgresCRDStatus(c.clusterName(), acidv1.ClusterStatusSyncFailed)
-		} else if !c.Status.Running() {
+			return
+		}
+		if !c.Status.Running() {
 			c.KubeClient.SetPostgresCRDStatus(c.clusterName(), acidv1.ClusterStatusRunning)
 		}
+		// a diverged cluster and database objects not synced yet are looked at again by the next sync
+		if c.leaderDiverged || c.databaseObjectsPending {
+			c.syncDrift = true
+		}
+		c.lastFullSync = time.Now()
+		if c.Generation != c.Status.ObservedGeneration {
+			if _, statusErr := c.KubeClient.SetPostgresCRDObservedGeneration(c.clusterName(), c.Generation); statusErr != nil {
+				c.logger.Warningf("could not record the synced generation of the manifest: %v", statusErr)
+				c.syncDrift = true
+				return
+			}
+			c.Status.ObservedGeneration = c.Generation
+		}
 	}()
 
+	forceResync := c.forceResyncRequested()
+	if forceResync {
+		c.logger.Info("forced resync requested, dropping the cached state")
+		if err = c.syncWithTimeout(c.OpConfig.SyncStepTimeout, c.refreshCachedState); err != nil {
+			err = fmt.Errorf("could not refresh the cached state: %v", err)
+			return err
+		}
+	}
+
 	if err = c.initUsers(); err != nil {
 		err = fmt.Errorf("could not init users: %v", err)
 		return err
 	}
 
-	//TODO: mind the secrets of the deleted/new users
-	if err = c.syncSecrets(); err != nil {
+	if err = c.syncWithTimeout(c.OpConfig.SyncStepTimeout, c.syncSecrets); err != nil {
 		err = fmt.Errorf("could not sync secrets: %v", err)
 		return err
 	}
 
-	if err = c.syncServices(); err != nil {
+	if err = c.syncWithTimeout(c.OpConfig.SyncStepTimeout, c.syncServices); err != nil {
 		err = fmt.Errorf("could not sync services: %v", err)
 		return err
 	}
 
 	if c.OpConfig.EnableEBSGp3Migration {
-		err = c.executeEBSMigration()
+		err = c.syncWithTimeout(c.OpConfig.SyncLongStepTimeout, c.executeEBSMigration)
 		if nil != err {
 			return err
 		}
 	}
 
-	if err = c.syncVolumes(); err != nil {
+	if err = c.syncWithTimeout(c.OpConfig.SyncStepTimeout, c.syncVolumes); err != nil {
 		return err
 	}
 
+	// the storage class of existing volume claims is immutable, a change is only reported
+	if err = c.syncWithTimeout(c.OpConfig.SyncStepTimeout, c.syncStorageClass); err != nil {
+		c.logger.Warningf("could not check the storage class of the volumes: %v", err)
+	}
+
 	if err = c.enforceMinResourceLimits(&c.Spec); err != nil {
 		err = fmt.Errorf("could not enforce minimum resource limits: %v", err)
 		return err
 	}
 
+	if err = c.syncWithTimeout(c.OpConfig.SyncStepTimeout, c.syncServiceAccount); err != nil {
+		err = fmt.Errorf("could not sync pod service account: %v", err)
+		return err
+	}
+
+	if err = c.syncWithTimeout(c.OpConfig.SyncStepTimeout, c.syncPatroniRole); err != nil {
+		err = fmt.Errorf("could not sync Patroni role: %v", err)
+		return err
+	}
+
+	// members keep being reached via plain HTTP until they serve the REST API with TLS
+	c.logger.Debug("syncing Patroni API certificate")
+	if apiTLSErr := c.syncWithTimeout(c.OpConfig.SyncStepTimeout, c.syncPatroniAPITLS); apiTLSErr != nil {
+		c.logger.Warningf("could not sync Patroni API certificate: %v", apiTLSErr)
+	}
+
+	// a cluster without a single leader is only reported, the sync holds back changes that need one
+	c.logger.Debug("syncing leader election")
+	if leaderErr := c.syncWithTimeout(c.OpConfig.SyncStepTimeout, c.syncLeaderElection); leaderErr != nil {
+		c.logger.Warningf("could not check the leader election: %v", leaderErr)
+	}
+
 	c.logger.Debugf("syncing statefulsets")
-	if err = c.syncStatefulSet(); err != nil {
+	if err = c.syncWithTimeout(c.OpConfig.SyncLongStepTimeout, c.syncStatefulSet); err != nil {
 		if !k8sutil.ResourceAlreadyExists(err) {
 			err = fmt.Errorf("could not sync statefulsets: %v", err)
 			return err
@@ -78,82 +161,575 @@ func (c *Cluster) Sync(newSpec *acidv1.Postgresql) error {
 	}
 
 	c.logger.Debug("syncing pod disruption budgets")
-	if err = c.syncPodDisruptionBudget(false); err != nil {
+	if err = c.syncWithTimeout(c.OpConfig.SyncStepTimeout, func(ctx context.Context) error {
+		return c.syncPodDisruptionBudget(ctx, false)
+	}); err != nil {
 		err = fmt.Errorf("could not sync pod disruption budget: %v", err)
 		return err
 	}
 
+	// the ready instances are only reported, pods not becoming ready do not fail the sync
+	c.logger.Debug("syncing ready instances")
+	if readyErr := c.syncWithTimeout(c.OpConfig.SyncStepTimeout, c.syncInstancesReady); readyErr != nil {
+		c.logger.Warningf("could not sync ready instances: %v", readyErr)
+	}
+
+	// the member status is informational, an unreachable Patroni API is reported as unknown state
+	// the volume claims of pods still terminating after a scale-down are deleted by the next sync
+	c.logger.Debug("syncing retained volume claims")
+	if claimsErr := c.syncWithTimeout(c.OpConfig.SyncStepTimeout, c.syncRetainedVolumeClaims); claimsErr != nil {
+		c.logger.Warningf("could not sync retained volume claims: %v", claimsErr)
+	}
+
+	c.logger.Debug("syncing member status")
+	if memberErr := c.syncWithTimeout(c.OpConfig.SyncStepTimeout, c.syncMemberStatus); memberErr != nil {
+		c.logger.Warningf("could not sync member status: %v", memberErr)
+	}
+
+	// a renewed certificate keeps working until it expires, the reload is retried on the next sync
+	c.logger.Debug("syncing TLS certificates")
+	if certErr := c.syncWithTimeout(c.OpConfig.SyncStepTimeout, c.syncCertificates); certErr != nil {
+		c.logger.Warningf("could not sync TLS certificates: %v", certErr)
+	}
+
+	// a failed switchover is not fatal, the request stays in the manifest and is retried on the next sync
+	c.logger.Debug("syncing switchover request")
+	if switchoverErr := c.syncWithTimeout(c.OpConfig.SyncLongStepTimeout, c.syncSwitchover); switchoverErr != nil {
+		c.logger.Warningf("could not switch over: %v", switchoverErr)
+	}
+
+	// an untagged pod can still be promoted, the tags are retried on the next sync
+	c.logger.Debug("syncing Patroni tags")
+	if tagsErr := c.syncWithTimeout(c.OpConfig.SyncLongStepTimeout, c.syncPatroniTags); tagsErr != nil {
+		c.logger.Warningf("could not sync Patroni tags: %v", tagsErr)
+	}
+
+	// Patroni keeps replicating in the previous synchronous mode until the next sync
+	c.logger.Debug("syncing synchronous mode")
+	if syncModeErr := c.syncWithTimeout(c.OpConfig.SyncStepTimeout, c.syncSynchronousMode); syncModeErr != nil {
+		c.logger.Warningf("could not sync synchronous mode: %v", syncModeErr)
+	}
+
+	c.logger.Debug("syncing maximum lag on failover")
+	if maxLagErr := c.syncWithTimeout(c.OpConfig.SyncStepTimeout, c.syncMaximumLagOnFailover); maxLagErr != nil {
+		c.logger.Warningf("could not sync maximum_lag_on_failover: %v", maxLagErr)
+	}
+
+	// replicas catching up or falling behind are added to or removed from the replica endpoint on the next sync or
+	// pod event
+	c.logger.Debug("syncing replica endpoint")
+	if replicaEndpointErr := c.syncWithTimeout(c.OpConfig.SyncStepTimeout, c.syncReplicaEndpoint); replicaEndpointErr != nil {
+		c.logger.Warningf("could not sync replica endpoint: %v", replicaEndpointErr)
+	}
+
+	// the cluster stays in its previous read-only state until the next sync
+	c.logger.Debug("syncing read-only state")
+	if readOnlyErr := c.syncWithTimeout(c.OpConfig.SyncStepTimeout, c.syncReadOnly); readOnlyErr != nil {
+		c.logger.Warningf("could not sync read-only state: %v", readOnlyErr)
+	}
+
+	// the previous user name maps stay in place until the next sync
+	c.logger.Debug("syncing pg_ident")
+	if pgIdentErr := c.syncWithTimeout(c.OpConfig.SyncStepTimeout, c.syncPgIdent); pgIdentErr != nil {
+		c.logger.Warningf("could not sync pg_ident: %v", pgIdentErr)
+	}
+
+	// an audit section removed while the operator was not running leaves the audit log on until the next sync
+	if c.Spec.Audit == nil {
+		c.logger.Debug("syncing audit logging")
+		if auditErr := c.syncWithTimeout(c.OpConfig.SyncStepTimeout, c.disableAuditLogging); auditErr != nil {
+			c.logger.Warningf("could not disable audit logging: %v", auditErr)
+		}
+	}
+
+	// Patroni keeps the previous permanent slots until the next sync
+	c.logger.Debug("syncing replication slots")
+	if slotsErr := c.syncWithTimeout(c.OpConfig.SyncStepTimeout, c.syncReplicationSlots); slotsErr != nil {
+		c.logger.Warningf("could not sync replication slots: %v", slotsErr)
+	}
+
+	// slots retaining WAL are only reported, the check is repeated on the next sync
+	if c.databaseObjectsAccessible(&c.Spec) {
+		c.logger.Debug("checking replication slots")
+		if slotsErr := c.syncWithTimeout(c.OpConfig.SyncStepTimeout, c.checkReplicationSlots); slotsErr != nil {
+			c.logger.Warningf("could not check replication slots: %v", slotsErr)
+		}
+	}
+
 	// create a logical backup job unless we are running without pods or disable that feature explicitly
 	if c.Spec.EnableLogicalBackup && c.getNumberOfInstances(&c.Spec) > 0 {
 
 		c.logger.Debug("syncing logical backup job")
-		if err = c.syncLogicalBackupJob(); err != nil {
+		if err = c.syncWithTimeout(c.OpConfig.SyncStepTimeout, c.syncLogicalBackupJob); err != nil {
 			err = fmt.Errorf("could not sync the logical backup job: %v", err)
 			return err
 		}
 	}
 
+	// a missed snapshot is taken on the next sync
+	if c.Spec.VolumeSnapshots != nil && c.getNumberOfInstances(&c.Spec) > 0 {
+		c.logger.Debug("syncing volume snapshots")
+		if snapshotErr := c.syncWithTimeout(c.OpConfig.SyncStepTimeout, func(ctx context.Context) error {
+			return c.syncVolumeSnapshots(ctx, time.Now())
+		}); snapshotErr != nil {
+			c.logger.Warningf("could not sync volume snapshots: %v", snapshotErr)
+		}
+	}
+
+	// the result of a backup verification job is reported on the sync after it has finished
+	if c.Spec.BackupVerification != nil && c.getNumberOfInstances(&c.Spec) > 0 {
+		c.logger.Debug("syncing backup verification job")
+		if verificationErr := c.syncWithTimeout(c.OpConfig.SyncStepTimeout, c.syncBackupVerification); verificationErr != nil {
+			c.logger.Warningf("could not sync backup verification job: %v", verificationErr)
+		}
+	}
+
+	// the pod services only serve debugging and targeted reads, a failure is retried on the next sync. Switched off
+	// pod services are deleted by the update.
+	if c.Spec.EnablePodServices {
+		c.logger.Debug("syncing pod services")
+		if podServicesErr := c.syncWithTimeout(c.OpConfig.SyncStepTimeout, c.syncPodServices); podServicesErr != nil {
+			c.logger.Warningf("could not sync pod services: %v", podServicesErr)
+		}
+	}
+
+	// the replica services route by the sync standby labels of the previous sync until the next one
+	c.logger.Debug("syncing replica services")
+	if replicaServicesErr := c.syncWithTimeout(c.OpConfig.SyncStepTimeout, c.syncReplicaServices); replicaServicesErr != nil {
+		c.logger.Warningf("could not sync replica services: %v", replicaServicesErr)
+	}
+
+	// without the pod monitor the metrics are not scraped, it is retried on the next sync. A switched off pod
+	// monitor is deleted by the update.
+	if podMonitorEnabled(&c.Spec) {
+		c.logger.Debug("syncing pod monitor")
+		if podMonitorErr := c.syncWithTimeout(c.OpConfig.SyncStepTimeout, c.syncPodMonitor); podMonitorErr != nil {
+			c.logger.Warningf("could not sync pod monitor: %v", podMonitorErr)
+		}
+	}
+
+	// clients connecting through the gateway reach the master by the master service meanwhile
+	c.logger.Debug("syncing master TCP route")
+	if tcpRouteErr := c.syncWithTimeout(c.OpConfig.SyncStepTimeout, c.syncMasterTCPRoute); tcpRouteErr != nil {
+		c.logger.Warningf("could not sync master TCP route: %v", tcpRouteErr)
+	}
+
+	// database objects can only be written once a former standby cluster has been promoted, a failed promotion is
+	// retried on the next sync
+	c.logger.Debug("syncing standby promotion")
+	if promotionErr := c.syncWithTimeout(c.OpConfig.SyncLongStepTimeout, c.syncStandbyPromotion); promotionErr != nil {
+		c.logger.Warningf("could not promote standby cluster: %v", promotionErr)
+	}
+
 	// create database objects unless we are running without pods or disabled that feature explicitly
-	if !(c.databaseAccessDisabled() || c.getNumberOfInstances(&newSpec.Spec) <= 0 || c.Spec.StandbyCluster != nil) {
-		c.logger.Debugf("syncing roles")
-		if err = c.syncRoles(); err != nil {
-			err = fmt.Errorf("could not sync roles: %v", err)
+	if c.databaseObjectsAccessible(&newSpec.Spec) {
+		if err = c.syncWithTimeout(c.OpConfig.SyncLongStepTimeout, c.syncDatabaseObjects); err != nil {
 			return err
 		}
-		c.logger.Debugf("syncing databases")
-		if err = c.syncDatabases(); err != nil {
-			err = fmt.Errorf("could not sync databases: %v", err)
-			return err
+		// init scripts only run for a new cluster, e.g. when its creation was interrupted
+		if c.initScriptsPending() {
+			c.logger.Debugf("running pending init scripts")
+			if err = c.syncWithTimeout(c.OpConfig.SyncLongStepTimeout, c.runInitScripts); err != nil {
+				err = fmt.Errorf("could not run init scripts: %v", err)
+				return err
+			}
 		}
-		c.logger.Debugf("syncing prepared databases with schemas")
-		if err = c.syncPreparedDatabases(); err != nil {
-			err = fmt.Errorf("could not sync prepared database: %v", err)
-			return err
+		// a failed rotation keeps the previous passwords and is retried on the next sync
+		c.logger.Debugf("syncing system password rotation request")
+		if rotationErr := c.syncWithTimeout(c.OpConfig.SyncStepTimeout, c.syncSystemPasswordRotation); rotationErr != nil {
+			c.logger.Warningf("could not rotate system user passwords: %v", rotationErr)
+			c.eventRecorder.Eventf(c.GetReference(), v1.EventTypeWarning, "PasswordRotation",
+				"Could not rotate system user passwords: %v", rotationErr)
 		}
+	} else {
+		c.databaseObjectsPending = true
 	}
 
 	// sync connection pooler
-	if _, err = c.syncConnectionPooler(&oldSpec, newSpec, c.installLookupFunction); err != nil {
+	if err = c.syncWithTimeout(c.OpConfig.SyncStepTimeout, func(ctx context.Context) error {
+		_, poolerErr := c.syncConnectionPooler(ctx, &oldSpec, newSpec, c.installLookupFunction)
+		return poolerErr
+	}); err != nil {
 		return fmt.Errorf("could not sync connection pooler: %v", err)
 	}
 
+	// the poolers keep running without their periodic restart. A removed restart schedule is cleaned up by the
+	// update.
+	if connectionPoolerRestartScheduled(&c.Spec) {
+		c.logger.Debug("syncing connection pooler restart job")
+		if restartErr := c.syncWithTimeout(c.OpConfig.SyncStepTimeout, c.syncConnectionPoolerRestartJob); restartErr != nil {
+			c.logger.Warningf("could not sync connection pooler restart job: %v", restartErr)
+		}
+	}
+
+	// the annotation stays in place after a failed sync, so the next one is forced as well
+	if forceResync {
+		if err = c.syncWithTimeout(c.OpConfig.SyncStepTimeout, func(ctx context.Context) error {
+			return c.removeManifestAnnotation(ctx, constants.ForceResyncAnnotationKey)
+		}); err != nil {
+			err = fmt.Errorf("could not remove the force resync annotation: %v", err)
+			return err
+		}
+		c.eventRecorder.Event(c.GetReference(), v1.EventTypeNormal, "Sync", "Forced resync done")
+	}
+
+	return err
+}
+
+// syncWithTimeout runs a single sync step with a context that is cancelled after the given timeout, so a hanging
+// call to the K8s API, Patroni or the database fails the step instead of blocking the whole sync
+func (c *Cluster) syncWithTimeout(timeout time.Duration, syncStep func(ctx context.Context) error) error {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	defer cancel()
+
+	err := syncStep(ctx)
+	if err != nil {
+		// also steps whose failure does not fail the sync are retried by the next one
+		c.syncDriftFound("sync step failed")
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("timed out after %v: %v", timeout, err)
+		}
+	}
 	return err
 }
 
-func (c *Cluster) syncServices() error {
+// syncUnchanged tells whether the sync of the manifest can be skipped. With a full_resync_period configured this is
+// the case while the manifest has the generation recorded by the last full sync, which found no drift, and the period
+// has not passed since. Changes made to the objects of the cluster meanwhile are only found by the next full sync.
+func (c *Cluster) syncUnchanged(newSpec *acidv1.Postgresql) bool {
+	if c.OpConfig.FullResyncPeriod <= 0 || c.lastFullSync.IsZero() || c.syncDrift {
+		return false
+	}
+	if time.Since(c.lastFullSync) >= c.OpConfig.FullResyncPeriod || !newSpec.Status.Running() {
+		return false
+	}
+	if newSpec.Generation == 0 || newSpec.Generation != newSpec.Status.ObservedGeneration ||
+		newSpec.Generation != c.Generation {
+		return false
+	}
+	// labels and annotations, e.g. the one forcing a resync, are changed without a new generation
+	return reflect.DeepEqual(newSpec.Labels, c.Labels) && reflect.DeepEqual(newSpec.Annotations, c.Annotations)
+}
+
+// syncDriftFound records that the sync changed an object of the cluster or left a change pending, so the next sync
+// runs in full even if the manifest is unchanged
+func (c *Cluster) syncDriftFound(format string, args ...interface{}) {
+	c.logger.Debugf("sync found drift: "+format, args...)
+	c.syncDrift = true
+}
+
+// forceResyncRequested tells if the Postgres manifest asks for a sync that ignores the state cached by the operator
+func (c *Cluster) forceResyncRequested() bool {
+	force, _ := strconv.ParseBool(c.ObjectMeta.Annotations[constants.ForceResyncAnnotationKey])
+	return force
+}
+
+// refreshCachedState replaces the statefulset and the cluster status kept in memory between syncs with the
+// live objects, e.g. after they have been changed manually
+func (c *Cluster) refreshCachedState(ctx context.Context) error {
+	sset, err := c.KubeClient.StatefulSets(c.Namespace).Get(ctx, c.statefulSetName(), metav1.GetOptions{})
+	if err != nil {
+		if !k8sutil.ResourceNotFound(err) {
+			return fmt.Errorf("could not get statefulset: %v", err)
+		}
+		sset = nil
+	}
+	c.Statefulset = sset
+
+	pg, err := c.KubeClient.Postgresqls(c.Namespace).Get(ctx, c.Name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("could not get postgresql manifest: %v", err)
+	}
+	c.Status = pg.Status
+
+	return nil
+}
+
+// forcedRollingUpdateRequired derives the need of a rolling update from the live state only: the flag of the running
+// statefulset and pods that have not been created from the current revision of its pod template
+func (c *Cluster) forcedRollingUpdateRequired(ctx context.Context, sset *appsv1.StatefulSet) (bool, error) {
+	if c.getRollingUpdateFlagFromStatefulSet(sset, false) {
+		c.logger.Infof("found a statefulset with an unfinished rolling update of the pods")
+		return true, nil
+	}
+	if sset.Status.UpdateRevision == "" {
+		return false, nil
+	}
+
+	pods, err := c.listPods(ctx)
+	if err != nil {
+		return false, fmt.Errorf("could not list pods of the statefulset: %v", err)
+	}
+	for _, pod := range pods {
+		if revision, ok := pod.Labels[appsv1.ControllerRevisionHashLabelKey]; ok && revision != sset.Status.UpdateRevision {
+			c.logger.Infof("pod %q does not run the current revision of the statefulset, rolling update required", pod.Name)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (c *Cluster) syncServices(ctx context.Context) error {
 	for _, role := range []PostgresRole{Master, Replica} {
+		if role == Replica && !replicaServiceEnabled(&c.Spec) {
+			if err := c.removeReplicaService(ctx); err != nil {
+				return fmt.Errorf("could not remove disabled replica service: %v", err)
+			}
+			continue
+		}
 		c.logger.Debugf("syncing %s service", role)
 
-		if !c.patroniKubernetesUseConfigMaps() {
-			if err := c.syncEndpoint(role); err != nil {
+		if !c.patroniKubernetesUseConfigMaps() || (role == Replica && replicaLagGateEnabled(&c.Spec)) {
+			if err := c.syncEndpoint(ctx, role); err != nil {
 				return fmt.Errorf("could not sync %s endpoint: %v", role, err)
 			}
 		}
-		if err := c.syncService(role); err != nil {
+		if err := c.syncService(ctx, role); err != nil {
 			return fmt.Errorf("could not sync %s service: %v", role, err)
 		}
 	}
 
+	// the addresses are informational, a failed status update is retried on the next sync
+	if err := c.syncLoadBalancerStatus(); err != nil {
+		c.logger.Warningf("could not update the load balancer status: %v", err)
+	}
+
+	return nil
+}
+
+// syncLoadBalancerStatus reports the addresses of the load balancers of the master and replica services in the
+// cluster status, so that clients can read the connection endpoints from the manifest
+func (c *Cluster) syncLoadBalancerStatus() error {
+	loadBalancers := c.loadBalancerStatus()
+	if reflect.DeepEqual(loadBalancers, c.Status.LoadBalancers) {
+		return nil
+	}
+	if _, err := c.KubeClient.SetPostgresCRDLoadBalancers(c.clusterName(), loadBalancers); err != nil {
+		return err
+	}
+	c.Status.LoadBalancers = loadBalancers
+	return nil
+}
+
+// loadBalancerStatus returns the hostnames, or IPs, of the ingress points of the load balancer services. A load
+// balancer the cloud provider has not assigned an ingress point to yet is reported as provisioning.
+func (c *Cluster) loadBalancerStatus() []acidv1.LoadBalancerStatus {
+	var loadBalancers []acidv1.LoadBalancerStatus
+	for _, role := range []PostgresRole{Master, Replica} {
+		svc := c.Services[role]
+		if svc == nil || svc.Spec.Type != v1.ServiceTypeLoadBalancer {
+			continue
+		}
+		loadBalancer := acidv1.LoadBalancerStatus{
+			Role:    string(role),
+			State:   acidv1.LoadBalancerStateProvisioning,
+			DNSName: svc.Annotations[constants.ZalandoDNSNameAnnotation],
+		}
+		for _, ingress := range svc.Status.LoadBalancer.Ingress {
+			if ingress.Hostname != "" {
+				loadBalancer.Addresses = append(loadBalancer.Addresses, ingress.Hostname)
+			} else if ingress.IP != "" {
+				loadBalancer.Addresses = append(loadBalancer.Addresses, ingress.IP)
+			}
+		}
+		if len(loadBalancer.Addresses) > 0 {
+			loadBalancer.State = acidv1.LoadBalancerStateReady
+		}
+		loadBalancers = append(loadBalancers, loadBalancer)
+	}
+	return loadBalancers
+}
+
+// syncPodServices keeps a service for every pod of the cluster when enabled in the manifest. The services of the
+// pods removed by a scale down, or all of them once disabled, are deleted.
+func (c *Cluster) syncPodServices(ctx context.Context) error {
+	c.setProcessName("syncing pod services")
+
+	instances := int32(0)
+	if c.Spec.EnablePodServices {
+		instances = c.getNumberOfInstances(&c.Spec)
+	}
+
+	desiredServices := make(map[string]bool, instances)
+	for ordinal := int32(0); ordinal < instances; ordinal++ {
+		desiredSvc := c.generatePodService(ordinal, &c.Spec)
+		desiredServices[desiredSvc.Name] = true
+		if err := c.syncSelectorService(ctx, "pod", desiredSvc); err != nil {
+			return err
+		}
+	}
+
+	return c.deletePodServices(ctx, desiredServices)
+}
+
+// syncReplicaServices keeps the additional replica services of the manifest, which select the replicas by the sync
+// standby label the operator sets according to the Patroni members. Services removed from the manifest are deleted.
+func (c *Cluster) syncReplicaServices(ctx context.Context) error {
+	c.setProcessName("syncing replica services")
+
+	desiredServices := make(map[string]bool, len(c.Spec.ReplicaServices))
+	for _, replicaService := range c.Spec.ReplicaServices {
+		desiredSvc := c.generateReplicaService(replicaService, &c.Spec)
+		desiredServices[desiredSvc.Name] = true
+		if err := c.syncSelectorService(ctx, "replica", desiredSvc); err != nil {
+			return err
+		}
+	}
+	if err := c.deleteReplicaServices(ctx, desiredServices); err != nil {
+		return err
+	}
+
+	return c.syncSyncStandbyLabels(ctx)
+}
+
+// syncSyncStandbyLabels labels the pods which are synchronous standbys according to Patroni, the label is removed
+// again once no replica service selects on it
+func (c *Cluster) syncSyncStandbyLabels(ctx context.Context) error {
+	patched, err := c.updateSyncStandbyLabels(ctx, &c.Spec)
+	for _, podName := range patched {
+		c.syncDriftFound("sync standby label of pod %q changed", podName)
+	}
+	return err
+}
+
+// updateSyncStandbyLabels sets the sync standby label of the pods according to the roles Patroni reports and returns
+// the patched pods. Besides the sync, pod events and recreated pods update the labels, so that a new pod or a
+// failover is followed right away. Patroni choosing another standby without any pod changing is only followed by
+// the next sync.
+func (c *Cluster) updateSyncStandbyLabels(ctx context.Context, pgSpec *acidv1.PostgresSpec) ([]string, error) {
+	c.podRolesMu.Lock()
+	defer c.podRolesMu.Unlock()
+
+	pods, err := c.listPods(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	desired := make(map[string]string, len(pods))
+	if len(pgSpec.ReplicaServices) > 0 {
+		for _, member := range c.memberStatus(ctx, pods) {
+			if member.Role == acidv1.MemberStateUnknown {
+				return nil, fmt.Errorf("could not get the synchronous standbys from the Patroni API")
+			}
+			desired[member.Name] = fmt.Sprintf("%t", member.Role == "sync_standby")
+		}
+	}
+
+	patched := make([]string, 0)
+	for _, pod := range pods {
+		value, labeled := pod.Labels[constants.SyncStandbyLabelKey]
+		var label interface{}
+		if desiredValue, ok := desired[pod.Name]; ok {
+			if labeled && value == desiredValue {
+				continue
+			}
+			label = desiredValue
+		} else if !labeled {
+			continue
+		}
+
+		patchData, err := json.Marshal(map[string]map[string]map[string]interface{}{
+			"metadata": {"labels": {constants.SyncStandbyLabelKey: label}}})
+		if err != nil {
+			return patched, fmt.Errorf("could not form patch for the pod metadata: %v", err)
+		}
+		if _, err = c.KubeClient.Pods(pod.Namespace).Patch(ctx, pod.Name, types.MergePatchType,
+			patchData, metav1.PatchOptions{}); err != nil {
+			return patched, fmt.Errorf("could not patch labels of pod %q: %v", util.NameFromMeta(pod.ObjectMeta), err)
+		}
+		patched = append(patched, util.NameFromMeta(pod.ObjectMeta).String())
+	}
+
+	return patched, nil
+}
+
+// syncSelectorService creates or updates a service of the cluster whose endpoints follow its selector, the kind
+// names the service in messages
+func (c *Cluster) syncSelectorService(ctx context.Context, kind string, desiredSvc *v1.Service) error {
+	serviceName := util.NameFromMeta(desiredSvc.ObjectMeta)
+	svc, err := c.KubeClient.Services(c.Namespace).Get(ctx, desiredSvc.Name, metav1.GetOptions{})
+	if err != nil {
+		if !k8sutil.ResourceNotFound(err) {
+			return fmt.Errorf("could not get %s service %q: %v", kind, serviceName, err)
+		}
+		c.syncDriftFound("missing %s service %q", kind, serviceName)
+		if _, err = c.KubeClient.Services(c.Namespace).Create(ctx, desiredSvc, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("could not create %s service %q: %v", kind, serviceName, err)
+		}
+		c.logger.Infof("%s service %q has been created", kind, serviceName)
+		return nil
+	}
+	if err = c.checkObjectOwnership(fmt.Sprintf("%s service", kind), svc.ObjectMeta); err != nil {
+		return err
+	}
+
+	if match, _ := k8sutil.SameService(svc, desiredSvc); match &&
+		reflect.DeepEqual(svc.Spec.Selector, desiredSvc.Spec.Selector) &&
+		labels.Equals(svc.Labels, desiredSvc.Labels) {
+		return nil
+	}
+	c.syncDriftFound("%s service %q does not match the manifest", kind, serviceName)
+	svc.Labels = desiredSvc.Labels
+	// only the annotations of the operator are set, the ones added by others are kept
+	if svc.Annotations == nil {
+		svc.Annotations = make(map[string]string, len(desiredSvc.Annotations))
+	}
+	for key, value := range desiredSvc.Annotations {
+		svc.Annotations[key] = value
+	}
+	svc.Spec.Type = desiredSvc.Spec.Type
+	svc.Spec.Selector = desiredSvc.Spec.Selector
+	svc.Spec.Ports = desiredSvc.Spec.Ports
+	if _, err = c.KubeClient.Services(c.Namespace).Update(ctx, svc, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("could not update %s service %q: %v", kind, serviceName, err)
+	}
+	c.logger.Infof("%s service %q has been updated", kind, serviceName)
+
 	return nil
 }
 
-func (c *Cluster) syncService(role PostgresRole) error {
+func (c *Cluster) syncService(ctx context.Context, role PostgresRole) error {
 	var (
 		svc *v1.Service
 		err error
 	)
 	c.setProcessName("syncing %s service", role)
 
-	if svc, err = c.KubeClient.Services(c.Namespace).Get(context.TODO(), c.serviceName(role), metav1.GetOptions{}); err == nil {
+	if svc, err = c.KubeClient.Services(c.Namespace).Get(ctx, c.serviceName(role), metav1.GetOptions{}); err == nil {
+		if err = c.checkObjectOwnership(fmt.Sprintf("%s service", role), svc.ObjectMeta); err != nil {
+			return err
+		}
 		c.Services[role] = svc
 		desiredSvc := c.generateService(role, &c.Spec)
 		if match, reason := k8sutil.SameService(svc, desiredSvc); !match {
+			c.syncDriftFound("%s service does not match the manifest", role)
 			c.logServiceChanges(role, svc, desiredSvc, false, reason)
-			if err = c.updateService(role, desiredSvc); err != nil {
+			c.reportManualChanges(fmt.Sprintf("%s service", role), util.NameFromMeta(svc.ObjectMeta),
+				manuallyChangedFields(svc.Annotations, serviceFields(svc)))
+			if err = c.updateService(ctx, role, desiredSvc); err != nil {
 				return fmt.Errorf("could not update %s service to match desired state: %v", role, err)
 			}
 			c.logger.Infof("%s service %q is in the desired state now", role, util.NameFromMeta(desiredSvc.ObjectMeta))
 		}
+		// the labels are not part of the service comparison, e.g. inherited labels removed from the manifest
+		if !labels.Equals(c.Services[role].Labels, desiredSvc.Labels) {
+			c.syncDriftFound("labels of the %s service do not match the manifest", role)
+			c.logger.Infof("updating labels of the %s service", role)
+			if err = c.updateServiceLabels(ctx, role, desiredSvc.Labels); err != nil {
+				return err
+			}
+		}
+		if err = c.recordServiceLastApplied(ctx, role); err != nil {
+			c.logger.Warningf("could not record the last applied %s service: %v", role, err)
+		}
 		return nil
 	}
 	if !k8sutil.ResourceNotFound(err) {
@@ -162,30 +738,62 @@ func (c *Cluster) syncService(role PostgresRole) error {
 	// no existing service, create new one
 	c.Services[role] = nil
 	c.logger.Infof("could not find the cluster's %s service", role)
+	c.syncDriftFound("missing %s service", role)
 
-	if svc, err = c.createService(role); err == nil {
+	if svc, err = c.createService(ctx, role); err == nil {
 		c.logger.Infof("created missing %s service %q", role, util.NameFromMeta(svc.ObjectMeta))
 	} else {
 		if !k8sutil.ResourceAlreadyExists(err) {
 			return fmt.Errorf("could not create missing %s service: %v", role, err)
 		}
-		c.logger.Infof("%s service %q already exists", role, util.NameFromMeta(svc.ObjectMeta))
-		if svc, err = c.KubeClient.Services(c.Namespace).Get(context.TODO(), c.serviceName(role), metav1.GetOptions{}); err != nil {
+		c.logger.Infof("%s service %q already exists", role, c.serviceName(role))
+		if svc, err = c.KubeClient.Services(c.Namespace).Get(ctx, c.serviceName(role), metav1.GetOptions{}); err != nil {
 			return fmt.Errorf("could not fetch existing %s service: %v", role, err)
 		}
+		if err = c.checkObjectOwnership(fmt.Sprintf("%s service", role), svc.ObjectMeta); err != nil {
+			return err
+		}
 	}
 	c.Services[role] = svc
 	return nil
 }
 
-func (c *Cluster) syncEndpoint(role PostgresRole) error {
+// removeReplicaService deletes the replica service and endpoint once the replica service is disabled in the manifest
+func (c *Cluster) removeReplicaService(ctx context.Context) error {
+	c.setProcessName("removing replica service")
+
+	err := c.KubeClient.Services(c.Namespace).Delete(ctx, c.serviceName(Replica), c.deleteOptions)
+	if err == nil {
+		c.logger.Infof("replica service %q has been deleted", c.serviceName(Replica))
+	} else if !k8sutil.ResourceNotFound(err) {
+		return fmt.Errorf("could not delete replica service: %v", err)
+	}
+	delete(c.Services, Replica)
+
+	if !c.patroniKubernetesUseConfigMaps() {
+		err = c.KubeClient.Endpoints(c.Namespace).Delete(ctx, c.endpointName(Replica), c.deleteOptions)
+		if err == nil {
+			c.logger.Infof("replica endpoint %q has been deleted", c.endpointName(Replica))
+		} else if !k8sutil.ResourceNotFound(err) {
+			return fmt.Errorf("could not delete replica endpoint: %v", err)
+		}
+	}
+	delete(c.Endpoints, Replica)
+
+	return nil
+}
+
+func (c *Cluster) syncEndpoint(ctx context.Context, role PostgresRole) error {
 	var (
 		ep  *v1.Endpoints
 		err error
 	)
 	c.setProcessName("syncing %s endpoint", role)
 
-	if ep, err = c.KubeClient.Endpoints(c.Namespace).Get(context.TODO(), c.endpointName(role), metav1.GetOptions{}); err == nil {
+	if ep, err = c.KubeClient.Endpoints(c.Namespace).Get(ctx, c.endpointName(role), metav1.GetOptions{}); err == nil {
+		if err = c.checkObjectOwnership(fmt.Sprintf("%s endpoint", role), ep.ObjectMeta); err != nil {
+			return err
+		}
 		// TODO: No syncing of endpoints here, is this covered completely by updateService?
 		c.Endpoints[role] = ep
 		return nil
@@ -196,475 +804,2791 @@ func (c *Cluster) syncEndpoint(role PostgresRole) error {
 	// no existing endpoint, create new one
 	c.Endpoints[role] = nil
 	c.logger.Infof("could not find the cluster's %s endpoint", role)
+	c.syncDriftFound("missing %s endpoint", role)
 
-	if ep, err = c.createEndpoint(role); err == nil {
+	if ep, err = c.createEndpoint(ctx, role); err == nil {
 		c.logger.Infof("created missing %s endpoint %q", role, util.NameFromMeta(ep.ObjectMeta))
 	} else {
 		if !k8sutil.ResourceAlreadyExists(err) {
 			return fmt.Errorf("could not create missing %s endpoint: %v", role, err)
 		}
-		c.logger.Infof("%s endpoint %q already exists", role, util.NameFromMeta(ep.ObjectMeta))
-		if ep, err = c.KubeClient.Endpoints(c.Namespace).Get(context.TODO(), c.endpointName(role), metav1.GetOptions{}); err != nil {
+		c.logger.Infof("%s endpoint %q already exists", role, c.endpointName(role))
+		if ep, err = c.KubeClient.Endpoints(c.Namespace).Get(ctx, c.endpointName(role), metav1.GetOptions{}); err != nil {
 			return fmt.Errorf("could not fetch existing %s endpoint: %v", role, err)
 		}
+		if err = c.checkObjectOwnership(fmt.Sprintf("%s endpoint", role), ep.ObjectMeta); err != nil {
+			return err
+		}
 	}
 	c.Endpoints[role] = ep
 	return nil
 }
 
-func (c *Cluster) syncPodDisruptionBudget(isUpdate bool) error {
-	var (
-		pdb *policybeta1.PodDisruptionBudget
-		err error
-	)
-	if pdb, err = c.KubeClient.PodDisruptionBudgets(c.Namespace).Get(context.TODO(), c.podDisruptionBudgetName(), metav1.GetOptions{}); err == nil {
-		c.PodDisruptionBudget = pdb
-		newPDB := c.generatePodDisruptionBudget()
-		if match, reason := k8sutil.SamePDB(pdb, newPDB); !match {
-			c.logPDBChanges(pdb, newPDB, isUpdate, reason)
-			if err = c.updatePodDisruptionBudget(newPDB); err != nil {
-				return err
-			}
-		} else {
-			c.PodDisruptionBudget = pdb
-		}
+// syncServiceAccount creates the service account requested in the manifest and the role binding granting it
+// the rights of the default pod service account. The default one is created by the controller for every namespace.
+func (c *Cluster) syncServiceAccount(ctx context.Context) error {
+	if !c.Spec.CreateServiceAccount || c.Spec.ServiceAccountName == "" ||
+		c.Spec.ServiceAccountName == c.OpConfig.PodServiceAccountName {
 		return nil
-
 	}
-	if !k8sutil.ResourceNotFound(err) {
-		return fmt.Errorf("could not get pod disruption budget: %v", err)
+	c.setProcessName("syncing pod service account")
+	serviceAccountName := c.Spec.ServiceAccountName
+
+	_, err := c.KubeClient.ServiceAccounts(c.Namespace).Get(ctx, serviceAccountName, metav1.GetOptions{})
+	if k8sutil.ResourceNotFound(err) {
+		c.logger.Infof("creating pod service account %q", serviceAccountName)
+		serviceAccount := &v1.ServiceAccount{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      serviceAccountName,
+				Namespace: c.Namespace,
+				Labels:    c.labelsSet(true),
+			},
+		}
+		if c.PodServiceAccount != nil {
+			serviceAccount = c.PodServiceAccount.DeepCopy()
+			serviceAccount.Name = serviceAccountName
+			serviceAccount.Namespace = c.Namespace
+			serviceAccount.Labels = c.labelsSet(true)
+		}
+		if _, err = c.KubeClient.ServiceAccounts(c.Namespace).Create(ctx, serviceAccount, metav1.CreateOptions{}); err != nil && !k8sutil.ResourceAlreadyExists(err) {
+			return fmt.Errorf("could not create service account %q: %v", serviceAccountName, err)
+		}
+	} else if err != nil {
+		return fmt.Errorf("could not get service account %q: %v", serviceAccountName, err)
 	}
-	// no existing pod disruption budget, create new one
-	c.PodDisruptionBudget = nil
-	c.logger.Infof("could not find the cluster's pod disruption budget")
 
-	if pdb, err = c.createPodDisruptionBudget(); err != nil {
-		if !k8sutil.ResourceAlreadyExists(err) {
-			return fmt.Errorf("could not create pod disruption budget: %v", err)
+	if c.PodServiceAccountRoleBinding == nil {
+		c.logger.Warningf("no role binding definition for the pod service account, service account %q is not bound", serviceAccountName)
+		return nil
+	}
+	_, err = c.KubeClient.RoleBindings(c.Namespace).Get(ctx, serviceAccountName, metav1.GetOptions{})
+	if k8sutil.ResourceNotFound(err) {
+		c.logger.Infof("creating role binding %q for the pod service account", serviceAccountName)
+		roleBinding := c.PodServiceAccountRoleBinding.DeepCopy()
+		roleBinding.Name = serviceAccountName
+		roleBinding.Namespace = c.Namespace
+		roleBinding.Labels = c.labelsSet(true)
+		roleBinding.Subjects = []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: serviceAccountName}}
+		if _, err = c.KubeClient.RoleBindings(c.Namespace).Create(ctx, roleBinding, metav1.CreateOptions{}); err != nil && !k8sutil.ResourceAlreadyExists(err) {
+			return fmt.Errorf("could not create role binding %q: %v", serviceAccountName, err)
 		}
-		c.logger.Infof("pod disruption budget %q already exists", util.NameFromMeta(pdb.ObjectMeta))
-		if pdb, err = c.KubeClient.PodDisruptionBudgets(c.Namespace).Get(context.TODO(), c.podDisruptionBudgetName(), metav1.GetOptions{}); err != nil {
-			return fmt.Errorf("could not fetch existing %q pod disruption budget", util.NameFromMeta(pdb.ObjectMeta))
+	} else if err != nil {
+		return fmt.Errorf("could not get role binding %q: %v", serviceAccountName, err)
+	}
+
+	return nil
+}
+
+// syncPatroniRole creates or updates the role with the access Patroni needs to the Kubernetes API and binds it
+// to the service account of the pods. Without the flag in the manifest nothing is done, the operator might lack
+// the permission for roles if the flag has never been used. Both are removed by the update clearing the flag.
+func (c *Cluster) syncPatroniRole(ctx context.Context) error {
+	if !c.Spec.CreatePatroniRole {
+		return nil
+	}
+	c.setProcessName("syncing Patroni role")
+
+	desiredRole := c.generatePatroniRole()
+	role, err := c.KubeClient.Roles(c.Namespace).Get(ctx, desiredRole.Name, metav1.GetOptions{})
+	if k8sutil.ResourceNotFound(err) {
+		c.logger.Infof("creating Patroni role %q", desiredRole.Name)
+		if _, err = c.KubeClient.Roles(c.Namespace).Create(ctx, desiredRole, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("could not create role %q: %v", desiredRole.Name, err)
+		}
+	} else if err != nil {
+		return fmt.Errorf("could not get role %q: %v", desiredRole.Name, err)
+	} else if !reflect.DeepEqual(role.Rules, desiredRole.Rules) || !reflect.DeepEqual(role.Labels, desiredRole.Labels) {
+		c.logger.Infof("updating Patroni role %q", desiredRole.Name)
+		role.Rules = desiredRole.Rules
+		role.Labels = desiredRole.Labels
+		if _, err = c.KubeClient.Roles(c.Namespace).Update(ctx, role, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("could not update role %q: %v", desiredRole.Name, err)
 		}
 	}
 
-	c.logger.Infof("created missing pod disruption budget %q", util.NameFromMeta(pdb.ObjectMeta))
-	c.PodDisruptionBudget = pdb
+	desiredRoleBinding := c.generatePatroniRoleBinding()
+	roleBinding, err := c.KubeClient.RoleBindings(c.Namespace).Get(ctx, desiredRoleBinding.Name, metav1.GetOptions{})
+	if err != nil && !k8sutil.ResourceNotFound(err) {
+		return fmt.Errorf("could not get role binding %q: %v", desiredRoleBinding.Name, err)
+	}
+	exists := err == nil
+	if exists && !reflect.DeepEqual(roleBinding.RoleRef, desiredRoleBinding.RoleRef) {
+		// the role reference of a binding cannot be changed, so the binding is recreated
+		c.logger.Infof("recreating role binding %q with another role reference", desiredRoleBinding.Name)
+		if err = c.KubeClient.RoleBindings(c.Namespace).Delete(ctx, roleBinding.Name, c.deleteOptions); err != nil {
+			return fmt.Errorf("could not delete role binding %q: %v", roleBinding.Name, err)
+		}
+		exists = false
+	}
+	if !exists {
+		c.logger.Infof("creating role binding %q for the Patroni role", desiredRoleBinding.Name)
+		if _, err = c.KubeClient.RoleBindings(c.Namespace).Create(ctx, desiredRoleBinding, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("could not create role binding %q: %v", desiredRoleBinding.Name, err)
+		}
+	} else if !reflect.DeepEqual(roleBinding.Subjects, desiredRoleBinding.Subjects) || !reflect.DeepEqual(roleBinding.Labels, desiredRoleBinding.Labels) {
+		c.logger.Infof("updating role binding %q of the Patroni role", desiredRoleBinding.Name)
+		roleBinding.Subjects = desiredRoleBinding.Subjects
+		roleBinding.Labels = desiredRoleBinding.Labels
+		if _, err = c.KubeClient.RoleBindings(c.Namespace).Update(ctx, roleBinding, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("could not update role binding %q: %v", desiredRoleBinding.Name, err)
+		}
+	}
 
 	return nil
 }
 
-func (c *Cluster) mustUpdatePodsAfterLazyUpdate(desiredSset *appsv1.StatefulSet) (bool, error) {
-
-	pods, err := c.listPods()
+// syncInstancesReady reports the number of ready instances compared to the desired one in the status conditions.
+// If enabled, it deletes a replica pod that has not been ready for too long to have it recreated.
+func (c *Cluster) syncInstancesReady(ctx context.Context) error {
+	pods, err := c.listPods(ctx)
 	if err != nil {
-		return false, fmt.Errorf("could not list pods of the statefulset: %v", err)
+		return fmt.Errorf("could not list pods of the statefulset: %v", err)
 	}
 
-	for _, pod := range pods {
+	desired := c.getNumberOfInstances(&c.Spec)
+	ready := int32(0)
+	details := make([]string, 0)
+	for i := range pods {
+		if reason := podNotReadyReason(&pods[i], c.OpConfig.PodRoleLabel); reason != "" {
+			details = append(details, fmt.Sprintf("pod %q %s", pods[i].Name, reason))
+			continue
+		}
+		ready++
+	}
 
-		effectivePodImage := pod.Spec.Containers[0].Image
-		ssImage := desiredSset.Spec.Template.Spec.Containers[0].Image
+	condition := acidv1.ClusterCondition{
+		Type:    acidv1.ClusterConditionInstancesReady,
+		Status:  v1.ConditionTrue,
+		Reason:  acidv1.ClusterConditionReasonAllInstancesReady,
+		Message: fmt.Sprintf("%d of %d instances are ready", ready, desired),
+	}
+	if ready < desired {
+		condition.Status = v1.ConditionFalse
+		condition.Reason = acidv1.ClusterConditionReasonInstancesNotReady
+		if len(details) > 0 {
+			condition.Message += ": " + strings.Join(details, "; ")
+		}
+		c.logger.Warning(condition.Message)
+	}
+	if err = c.setCondition(condition); err != nil {
+		return err
+	}
 
-		if ssImage != effectivePodImage {
-			c.logger.Infof("not all pods were re-started when the lazy upgrade was enabled; forcing the rolling upgrade now")
-			return true, nil
+	if c.OpConfig.EnablePodAutoHeal {
+		return c.autoHealPods(pods)
+	}
+	return nil
+}
+
+// setCondition adds the condition to the cluster status or replaces the one of the same type. The transition
+// time is kept as long as the status of the condition does not change.
+func (c *Cluster) setCondition(condition acidv1.ClusterCondition) error {
+	condition.LastTransitionTime = metav1.Now()
+	conditions := make([]acidv1.ClusterCondition, 0, len(c.Status.Conditions)+1)
+	for _, current := range c.Status.Conditions {
+		if current.Type != condition.Type {
+			conditions = append(conditions, current)
+			continue
+		}
+		if current.Status == condition.Status {
+			if current.Reason == condition.Reason && current.Message == condition.Message {
+				return nil
+			}
+			condition.LastTransitionTime = current.LastTransitionTime
+		}
+	}
+	conditions = append(conditions, condition)
+
+	if _, err := c.KubeClient.SetPostgresCRDConditions(c.clusterName(), conditions); err != nil {
+		return err
+	}
+	c.Status.Conditions = conditions
+	return nil
+}
+
+// removeCondition drops the condition of the type from the cluster status, e.g. when the feature it reports on has
+// been removed from the manifest
+func (c *Cluster) removeCondition(conditionType string) error {
+	conditions := make([]acidv1.ClusterCondition, 0, len(c.Status.Conditions))
+	for _, current := range c.Status.Conditions {
+		if current.Type != conditionType {
+			conditions = append(conditions, current)
 		}
+	}
+	if len(conditions) == len(c.Status.Conditions) {
+		return nil
+	}
 
+	if _, err := c.KubeClient.SetPostgresCRDConditions(c.clusterName(), conditions); err != nil {
+		return err
 	}
+	c.Status.Conditions = conditions
+	return nil
+}
 
-	return false, nil
+// syncMemberStatus reports the Patroni role, state and replication lag of every member in the cluster status
+func (c *Cluster) syncMemberStatus(ctx context.Context) error {
+	pods, err := c.listPods(ctx)
+	if err != nil {
+		return fmt.Errorf("could not list pods of the statefulset: %v", err)
+	}
+
+	members := c.memberStatus(ctx, pods)
+	if reflect.DeepEqual(members, c.Status.Members) {
+		return nil
+	}
+	if _, err = c.KubeClient.SetPostgresCRDMembers(c.clusterName(), members); err != nil {
+		return err
+	}
+	c.Status.Members = members
+	return nil
 }
 
-func (c *Cluster) syncStatefulSet() error {
+// memberStatus asks the Patroni API of the pods for the cluster members, starting with the master.
+// If no pod answers, the pods are reported with an unknown role and state.
+func (c *Cluster) memberStatus(ctx context.Context, pods []v1.Pod) []acidv1.MemberStatus {
+	if len(pods) == 0 {
+		return nil
+	}
+	sort.SliceStable(pods, func(i, j int) bool {
+		iMaster := PostgresRole(pods[i].Labels[c.OpConfig.PodRoleLabel]) == Master
+		jMaster := PostgresRole(pods[j].Labels[c.OpConfig.PodRoleLabel]) == Master
+		if iMaster != jMaster {
+			return iMaster
+		}
+		return pods[i].Name < pods[j].Name
+	})
+
 	var (
-		podsRollingUpdateRequired bool
+		clusterMembers []patroni.ClusterMember
+		err            error
 	)
-	// NB: Be careful to consider the codepath that acts on podsRollingUpdateRequired before returning early.
-	sset, err := c.KubeClient.StatefulSets(c.Namespace).Get(context.TODO(), c.statefulSetName(), metav1.GetOptions{})
+	for i := range pods {
+		if clusterMembers, err = c.patroni.GetClusterMembers(ctx, &pods[i]); err == nil {
+			break
+		}
+		c.logger.Debugf("could not get Patroni cluster members from pod %q: %v", pods[i].Name, err)
+	}
+
+	members := make([]acidv1.MemberStatus, 0, len(pods))
 	if err != nil {
-		if !k8sutil.ResourceNotFound(err) {
-			return fmt.Errorf("could not get statefulset: %v", err)
+		c.logger.Warningf("could not reach the Patroni API of any pod, the member state is unknown")
+		for _, pod := range pods {
+			members = append(members, acidv1.MemberStatus{
+				Name:  pod.Name,
+				Role:  acidv1.MemberStateUnknown,
+				State: acidv1.MemberStateUnknown,
+			})
 		}
-		// statefulset does not exist, try to re-create it
-		c.Statefulset = nil
-		c.logger.Infof("could not find the cluster's statefulset")
-		pods, err := c.listPods()
-		if err != nil {
-			return fmt.Errorf("could not list pods of the statefulset: %v", err)
+	} else {
+		for _, member := range clusterMembers {
+			status := acidv1.MemberStatus{
+				Name:     member.Name,
+				Role:     member.Role,
+				State:    member.State,
+				Timeline: member.Timeline,
+			}
+			// the leader has no lag, an unknown lag is left out
+			if member.Role != "leader" && member.Role != "master" && uint64(member.Lag) != math.MaxUint64 {
+				lag := int64(member.Lag)
+				status.LagBytes = &lag
+			}
+			members = append(members, status)
 		}
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].Name < members[j].Name })
 
-		sset, err = c.createStatefulSet()
-		if err != nil {
-			return fmt.Errorf("could not create missing statefulset: %v", err)
+	return members
+}
+
+// syncLeaderElection asks the Patroni API of every pod for the cluster members and reports in the status
+// whether exactly one leader is seen. Members claiming the leadership in diverging views of the cluster
+// (split-brain) or the absence of a leader are reported with a warning event. Only after a split-brain, until the
+// next sync finds a single leader, no parameters are set and no pods are recreated, retagged, switched over or
+// auto-healed, a cluster without a leader is usually in the middle of a failover. Without any answering pod
+// nothing is known about the leader and the previous state is kept.
+func (c *Cluster) syncLeaderElection(ctx context.Context) error {
+	pods, err := c.listPods(ctx)
+	if err != nil {
+		return fmt.Errorf("could not list pods of the statefulset: %v", err)
+	}
+	if len(pods) == 0 {
+		c.leaderDiverged = false
+		return nil
+	}
+
+	leaders, reachable := c.leaderClaims(ctx, pods)
+	if reachable == 0 {
+		return fmt.Errorf("could not reach the Patroni API of any pod")
+	}
+
+	condition := acidv1.ClusterCondition{
+		Type:   acidv1.ClusterConditionLeaderElected,
+		Status: v1.ConditionFalse,
+	}
+	switch len(leaders) {
+	case 1:
+		condition.Status = v1.ConditionTrue
+		condition.Reason = acidv1.ClusterConditionReasonSingleLeader
+		condition.Message = fmt.Sprintf("%s is the leader", leaders[0])
+	case 0:
+		condition.Reason = acidv1.ClusterConditionReasonNoLeader
+		condition.Message = fmt.Sprintf("none of the %d answering pods sees a leader", reachable)
+	default:
+		condition.Reason = acidv1.ClusterConditionReasonMultipleLeaders
+		condition.Message = fmt.Sprintf("%s claim to be the leader", strings.Join(leaders, ", "))
+	}
+
+	previousReason := ""
+	for _, current := range c.Status.Conditions {
+		if current.Type == acidv1.ClusterConditionLeaderElected {
+			previousReason = current.Reason
 		}
+	}
 
-		if err = c.waitStatefulsetPodsReady(); err != nil {
-			return fmt.Errorf("cluster is not ready: %v", err)
+	diverged := condition.Reason == acidv1.ClusterConditionReasonMultipleLeaders
+	switch {
+	case diverged:
+		c.logger.Errorf("Patroni cluster diverged: %s", condition.Message)
+		if !c.leaderDiverged {
+			c.eventRecorder.Eventf(c.GetReference(), v1.EventTypeWarning, "LeaderElection",
+				"Patroni cluster diverged, %s: holding back parameter changes, rolling updates and switchovers", condition.Message)
+		}
+	case condition.Status == v1.ConditionFalse:
+		c.logger.Warningf("Patroni cluster has no leader: %s", condition.Message)
+		if previousReason != acidv1.ClusterConditionReasonNoLeader {
+			c.eventRecorder.Eventf(c.GetReference(), v1.EventTypeWarning, "LeaderElection",
+				"Patroni cluster has no leader, %s", condition.Message)
 		}
+	case c.leaderDiverged:
+		c.logger.Infof("Patroni cluster converged, %s", condition.Message)
+		c.eventRecorder.Eventf(c.GetReference(), v1.EventTypeNormal, "LeaderElection",
+			"Patroni cluster converged, %s", condition.Message)
+	}
+	c.leaderDiverged = diverged
 
-		podsRollingUpdateRequired = (len(pods) > 0)
-		if podsRollingUpdateRequired {
-			c.logger.Warningf("found pods from the previous statefulset: trigger rolling update")
-			if err := c.applyRollingUpdateFlagforStatefulSet(podsRollingUpdateRequired); err != nil {
-				return fmt.Errorf("could not set rolling update flag for the statefulset: %v", err)
+	return c.setCondition(condition)
+}
+
+// leaderClaims collects the members seen as the leader in the view of the cluster of every pod answering,
+// sorted by name, and the number of those pods.
+func (c *Cluster) leaderClaims(ctx context.Context, pods []v1.Pod) ([]string, int) {
+	leaders := make(map[string]bool)
+	reachable := 0
+	for i := range pods {
+		members, err := c.patroni.GetClusterMembers(ctx, &pods[i])
+		if err != nil {
+			c.logger.Debugf("could not get Patroni cluster members from pod %q: %v", pods[i].Name, err)
+			continue
+		}
+		reachable++
+		for _, member := range members {
+			switch member.Role {
+			case "leader", "master", "standby_leader":
+				leaders[member.Name] = true
 			}
 		}
-		c.logger.Infof("created missing statefulset %q", util.NameFromMeta(sset.ObjectMeta))
+	}
 
-	} else {
-		podsRollingUpdateRequired = c.mergeRollingUpdateFlagUsingCache(sset)
-		// statefulset is already there, make sure we use its definition in order to compare with the spec.
-		c.Statefulset = sset
+	names := make([]string, 0, len(leaders))
+	for name := range leaders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, reachable
+}
+
+// autoHealPods deletes the replica pod that has not been ready for the longest time, if that exceeds the
+// auto-heal timeout. The master is left to Patroni, and only one pod is deleted per sync.
+func (c *Cluster) autoHealPods(pods []v1.Pod) error {
+	if c.leaderDiverged {
+		c.logger.Warning("Patroni cluster diverged, no pods are auto-healed")
+		return nil
+	}
+	candidate := c.autoHealCandidate(pods)
+	if candidate == nil {
+		return nil
+	}
 
-		desiredSS, err := c.generateStatefulSet(&c.Spec)
+	podName := util.NameFromMeta(candidate.ObjectMeta)
+	notReadySince := podNotReadySince(candidate)
+	c.logger.Warningf("deleting pod %q not ready since %v to have it recreated", podName, notReadySince)
+	c.eventRecorder.Eventf(c.GetReference(), v1.EventTypeWarning, "AutoHeal", "Deleting pod %q not ready since %v",
+		podName, notReadySince)
+	if err := c.deletePod(podName); err != nil {
+		return fmt.Errorf("could not delete pod %q: %v", podName, err)
+	}
+	return nil
+}
+
+// autoHealCandidate returns the replica pod not ready for the longest time beyond the auto-heal timeout, if any
+func (c *Cluster) autoHealCandidate(pods []v1.Pod) *v1.Pod {
+	var candidate *v1.Pod
+	var candidateNotReadySince time.Time
+	for i := range pods {
+		pod := &pods[i]
+		if pod.DeletionTimestamp != nil || PostgresRole(pod.Labels[c.OpConfig.PodRoleLabel]) == Master ||
+			podNotReadyReason(pod, c.OpConfig.PodRoleLabel) == "" {
+			continue
+		}
+		notReadySince := podNotReadySince(pod)
+		if time.Since(notReadySince) < c.OpConfig.PodAutoHealTimeout {
+			continue
+		}
+		if candidate == nil || notReadySince.Before(candidateNotReadySince) {
+			candidate = pod
+			candidateNotReadySince = notReadySince
+		}
+	}
+	return candidate
+}
+
+// podNotReadySince returns when the pod became not ready, or its creation time if it never reported readiness
+func podNotReadySince(pod *v1.Pod) time.Time {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodReady && condition.Status != v1.ConditionTrue {
+			return condition.LastTransitionTime.Time
+		}
+	}
+	return pod.CreationTimestamp.Time
+}
+
+// syncCertificates reloads Postgres when the contents of the TLS secrets change, e.g. when cert-manager renews
+// the certificate. The kubelet updates the mounted files with a delay, so the reload waits until all pods see
+// the new certificate. Replacing the secret with another one rolls the pods through the statefulset instead.
+func (c *Cluster) syncCertificates(ctx context.Context) error {
+	if c.Spec.TLS == nil || c.Spec.TLS.SecretName == "" {
+		c.tlsSecretHash = ""
+		return nil
+	}
+	c.setProcessName("syncing TLS certificates")
+
+	secrets, err := c.getTLSSecrets(ctx)
+	if err != nil {
+		return err
+	}
+
+	secretHash := tlsSecretsHash(secrets)
+	if secretHash == c.tlsSecretHash {
+		return nil
+	}
+	if c.tlsSecretHash == "" {
+		// first sync since the operator started, pods are expected to run with the current certificate. A
+		// created cluster records it already when its pods are started.
+		c.tlsSecretHash = secretHash
+		return nil
+	}
+
+	// the certificate is looked up the same way the statefulset mounts it
+	certificateFile := ensurePath(c.Spec.TLS.CertificateFile, constants.TLSMountPath, "tls.crt")
+	certificate, ok := secrets[0].Data[path.Base(certificateFile)]
+	if !ok {
+		return fmt.Errorf("TLS secret %q has no key %q", c.Spec.TLS.SecretName, path.Base(certificateFile))
+	}
+
+	pods, err := c.listPods(ctx)
+	if err != nil {
+		return fmt.Errorf("could not list pods of the statefulset: %v", err)
+	}
+	if mounted, err := c.certificateMounted(pods, certificateFile, certificate); err != nil || !mounted {
+		return err
+	}
+
+	for i := range pods {
+		if err := c.patroni.Reload(ctx, &pods[i]); err != nil {
+			return fmt.Errorf("could not reload pod %q: %v", util.NameFromMeta(pods[i].ObjectMeta), err)
+		}
+	}
+	c.tlsSecretHash = secretHash
+	c.logger.Infof("reloaded Postgres to use the renewed TLS certificate")
+	c.eventRecorder.Event(c.GetReference(), v1.EventTypeNormal, "TLS", "Reloaded Postgres to use the renewed TLS certificate")
+
+	return nil
+}
+
+// getTLSSecrets returns the TLS secret of the manifest, followed by its CA secret if one is set
+func (c *Cluster) getTLSSecrets(ctx context.Context) ([]*v1.Secret, error) {
+	secretNames := []string{c.Spec.TLS.SecretName}
+	if c.Spec.TLS.CASecretName != "" {
+		secretNames = append(secretNames, c.Spec.TLS.CASecretName)
+	}
+	secrets := make([]*v1.Secret, 0, len(secretNames))
+	for _, secretName := range secretNames {
+		secret, err := c.KubeClient.Secrets(c.Namespace).Get(ctx, secretName, metav1.GetOptions{})
 		if err != nil {
-			return fmt.Errorf("could not generate statefulset: %v", err)
+			return nil, fmt.Errorf("could not get TLS secret %q: %v", secretName, err)
 		}
-		c.setRollingUpdateFlagForStatefulSet(desiredSS, podsRollingUpdateRequired, "from cache")
+		secrets = append(secrets, secret)
+	}
+	return secrets, nil
+}
 
-		cmp := c.compareStatefulSetWith(desiredSS)
-		if !cmp.match {
-			if cmp.rollingUpdate && !podsRollingUpdateRequired {
-				podsRollingUpdateRequired = true
-				c.setRollingUpdateFlagForStatefulSet(desiredSS, podsRollingUpdateRequired, "statefulset changes")
-			}
+// certificateMounted checks whether all pods see the given certificate content in their mounted secret volume,
+// the kubelet updates it with a delay after the secret has changed
+func (c *Cluster) certificateMounted(pods []v1.Pod, certificateFile string, certificate []byte) (bool, error) {
+	certificateSum := sha256.Sum256(certificate)
+	certificateHash := hex.EncodeToString(certificateSum[:])
 
-			c.logStatefulSetChanges(c.Statefulset, desiredSS, false, cmp.reasons)
+	for _, pod := range pods {
+		podName := util.NameFromMeta(pod.ObjectMeta)
+		out, err := c.ExecCommand(&podName, "sha256sum", certificateFile)
+		if err != nil {
+			return false, fmt.Errorf("could not check TLS certificate in pod %q: %v", podName, err)
+		}
+		if fields := strings.Fields(out); len(fields) == 0 || fields[0] != certificateHash {
+			c.logger.Infof("renewed TLS certificate %q not yet mounted in pod %q, postponing the reload", certificateFile, podName)
+			return false, nil
+		}
+	}
+	return true, nil
+}
 
-			if !cmp.replace {
-				if err := c.updateStatefulSet(desiredSS); err != nil {
-					return fmt.Errorf("could not update statefulset: %v", err)
-				}
-			} else {
-				if err := c.replaceStatefulSet(desiredSS); err != nil {
-					return fmt.Errorf("could not replace statefulset: %v", err)
-				}
-			}
+// syncPatroniAPITLS configures the Patroni client with the certificate the REST API is served with. The secret is
+// read on every sync, so a renewed certificate is picked up without restarting the operator. Until the members are
+// reloaded with it, the previous CA stays trusted as well.
+func (c *Cluster) syncPatroniAPITLS(ctx context.Context) error {
+	apiTLS := c.Spec.Patroni.APITLS
+	if apiTLS == nil || apiTLS.SecretName == "" {
+		if c.patroniAPITLSHash != "" {
+			c.patroni.ConfigureTLS(nil)
+			c.patroniAPITLSHash = ""
+			c.patroniAPICA = nil
 		}
+		return nil
+	}
+	c.setProcessName("syncing Patroni API certificate")
 
-		c.updateStatefulSetAnnotations(c.AnnotationsToPropagate(c.annotationsSet(c.Statefulset.Annotations)))
+	secret, err := c.KubeClient.Secrets(c.Namespace).Get(ctx, apiTLS.SecretName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("could not get Patroni API TLS secret %q: %v", apiTLS.SecretName, err)
+	}
+	secretHash := tlsSecretsHash([]*v1.Secret{secret})
+	if secretHash == c.patroniAPITLSHash {
+		return nil
+	}
 
-		if !podsRollingUpdateRequired && !c.OpConfig.EnableLazySpiloUpgrade {
-			// even if desired and actual statefulsets match
-			// there still may be not up-to-date pods on condition
-			//  (a) the lazy update was just disabled
-			// and
-			//  (b) some of the pods were not restarted when the lazy update was still in place
-			podsRollingUpdateRequired, err = c.mustUpdatePodsAfterLazyUpdate(desiredSS)
-			if err != nil {
-				return fmt.Errorf("could not list pods of the statefulset: %v", err)
-			}
+	// the files are looked up the same way the statefulset mounts them
+	certificateFile := ensurePath(apiTLS.CertificateFile, constants.PatroniAPITLSMountPath, "tls.crt")
+	files := map[string]string{
+		"certificate": certificateFile,
+		"private key": ensurePath(apiTLS.PrivateKeyFile, constants.PatroniAPITLSMountPath, "tls.key"),
+	}
+	if apiTLS.CAFile != "" {
+		files["CA"] = ensurePath(apiTLS.CAFile, constants.PatroniAPITLSMountPath, "")
+	}
+	data := make(map[string][]byte, len(files))
+	for kind, file := range files {
+		content, ok := secret.Data[path.Base(file)]
+		if !ok {
+			return fmt.Errorf("Patroni API TLS secret %q has no %s key %q", apiTLS.SecretName, kind, path.Base(file))
 		}
+		data[kind] = content
+	}
+	ca := data["CA"]
+	if len(ca) == 0 {
+		// a self-signed certificate is pinned
+		ca = data["certificate"]
+	}
 
+	renewed := c.patroniAPITLSHash != ""
+	trustedCA := ca
+	if renewed {
+		trustedCA = append(append([]byte{}, c.patroniAPICA...), ca...)
+	}
+	tlsConfig, err := patroni.NewTLSConfig(trustedCA, data["certificate"], data["private key"])
+	if err != nil {
+		return fmt.Errorf("could not load Patroni API TLS secret %q: %v", apiTLS.SecretName, err)
 	}
+	c.patroni.ConfigureTLS(tlsConfig)
 
-	// Apply special PostgreSQL parameters that can only be set via the Patroni API.
-	// it is important to do it after the statefulset pods are there, but before the rolling update
-	// since those parameters require PostgreSQL restart.
-	if err := c.checkAndSetGlobalPostgreSQLConfiguration(); err != nil {
-		return fmt.Errorf("could not set cluster-wide PostgreSQL configuration options: %v", err)
+	if renewed {
+		pods, err := c.listPods(ctx)
+		if err != nil {
+			return fmt.Errorf("could not list pods of the statefulset: %v", err)
+		}
+		if mounted, err := c.certificateMounted(pods, certificateFile, data["certificate"]); err != nil || !mounted {
+			return err
+		}
+		// Patroni serves the REST API with the renewed certificate after a reload
+		for i := range pods {
+			if err := c.patroni.Reload(ctx, &pods[i]); err != nil {
+				return fmt.Errorf("could not reload pod %q: %v", util.NameFromMeta(pods[i].ObjectMeta), err)
+			}
+		}
+		c.logger.Infof("reloaded Patroni to use the renewed REST API certificate")
+		c.eventRecorder.Event(c.GetReference(), v1.EventTypeNormal, "TLS", "Reloaded Patroni to use the renewed REST API certificate")
 	}
+	c.patroniAPITLSHash = secretHash
+	c.patroniAPICA = ca
 
-	// if we get here we also need to re-create the pods (either leftovers from the old
-	// statefulset or those that got their configuration from the outdated statefulset)
-	if podsRollingUpdateRequired {
-		c.logger.Debugln("performing rolling update")
-		c.eventRecorder.Event(c.GetReference(), v1.EventTypeNormal, "Update", "Performing rolling update")
-		if err := c.recreatePods(); err != nil {
-			return fmt.Errorf("could not recreate pods: %v", err)
+	return nil
+}
+
+// tlsSecretsHash returns a hash over the data of the given secrets
+func tlsSecretsHash(secrets []*v1.Secret) string {
+	hash := sha256.New()
+	for _, secret := range secrets {
+		keys := make([]string, 0, len(secret.Data))
+		for key := range secret.Data {
+			keys = append(keys, key)
 		}
-		c.logger.Infof("pods have been recreated")
-		c.eventRecorder.Event(c.GetReference(), v1.EventTypeNormal, "Update", "Rolling update done - pods have been recreated")
-		if err := c.applyRollingUpdateFlagforStatefulSet(false); err != nil {
-			c.logger.Warningf("could not clear rolling update for the statefulset: %v", err)
+		sort.Strings(keys)
+		hash.Write([]byte(secret.Name))
+		for _, key := range keys {
+			hash.Write([]byte(key))
+			hash.Write(secret.Data[key])
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func (c *Cluster) syncPodDisruptionBudget(ctx context.Context, isUpdate bool) error {
+	var (
+		pdb *policybeta1.PodDisruptionBudget
+		err error
+	)
+	if pdb, err = c.KubeClient.PodDisruptionBudgets(c.Namespace).Get(ctx, c.podDisruptionBudgetName(), metav1.GetOptions{}); err == nil {
+		c.PodDisruptionBudget = pdb
+		newPDB := c.generatePodDisruptionBudget()
+		if match, reason := k8sutil.SamePDB(pdb, newPDB); !match {
+			c.syncDriftFound("pod disruption budget does not match the manifest")
+			c.logPDBChanges(pdb, newPDB, isUpdate, reason)
+			if err = c.updatePodDisruptionBudget(ctx, newPDB); err != nil {
+				return err
+			}
+		} else if !labels.Equals(pdb.Labels, newPDB.Labels) {
+			c.syncDriftFound("labels of the pod disruption budget do not match the manifest")
+			c.logger.Infof("updating labels of the pod disruption budget %q", util.NameFromMeta(pdb.ObjectMeta))
+			if err = c.updatePodDisruptionBudgetLabels(ctx, newPDB.Labels); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	}
+	if !k8sutil.ResourceNotFound(err) {
+		return fmt.Errorf("could not get pod disruption budget: %v", err)
+	}
+	// no existing pod disruption budget, create new one
+	c.PodDisruptionBudget = nil
+	c.logger.Infof("could not find the cluster's pod disruption budget")
+	c.syncDriftFound("missing pod disruption budget")
+
+	if pdb, err = c.createPodDisruptionBudget(ctx); err != nil {
+		if !k8sutil.ResourceAlreadyExists(err) {
+			return fmt.Errorf("could not create pod disruption budget: %v", err)
+		}
+		c.logger.Infof("pod disruption budget %q already exists", util.NameFromMeta(pdb.ObjectMeta))
+		if pdb, err = c.KubeClient.PodDisruptionBudgets(c.Namespace).Get(ctx, c.podDisruptionBudgetName(), metav1.GetOptions{}); err != nil {
+			return fmt.Errorf("could not fetch existing %q pod disruption budget", util.NameFromMeta(pdb.ObjectMeta))
+		}
+	}
+
+	c.logger.Infof("created missing pod disruption budget %q", util.NameFromMeta(pdb.ObjectMeta))
+	c.PodDisruptionBudget = pdb
+
+	return nil
+}
+
+func (c *Cluster) mustUpdatePodsAfterLazyUpdate(ctx context.Context, desiredSset *appsv1.StatefulSet) (bool, error) {
+
+	pods, err := c.listPods(ctx)
+	if err != nil {
+		return false, fmt.Errorf("could not list pods of the statefulset: %v", err)
+	}
+
+	for _, pod := range pods {
+
+		effectivePodImage := pod.Spec.Containers[0].Image
+		ssImage := desiredSset.Spec.Template.Spec.Containers[0].Image
+
+		if ssImage != effectivePodImage {
+			c.logger.Infof("not all pods were re-started when the lazy upgrade was enabled; forcing the rolling upgrade now")
+			return true, nil
+		}
+
+	}
+
+	return false, nil
+}
+
+// checkMajorVersionChange refuses a change of the Postgres major version the data directory cannot follow. Postgres
+// cannot start on data of a newer major version, and without the PGVERSION variable Spilo would start the new
+// binaries on the old data right away, instead of the old ones until the in-place upgrade is done.
+func (c *Cluster) checkMajorVersionChange(sset *appsv1.StatefulSet) error {
+	currentVersion := statefulSetPgVersion(sset)
+	if currentVersion == "" || currentVersion == c.Spec.PgVersion {
+		return nil
+	}
+	current, err := pgVersionNum(currentVersion)
+	if err != nil {
+		c.logger.Warningf("could not tell the Postgres version of the statefulset: %v", err)
+		return nil
+	}
+	desired, err := pgVersionNum(c.Spec.PgVersion)
+	if err != nil {
+		return fmt.Errorf("could not check the Postgres version of the manifest: %v", err)
+	}
+
+	switch {
+	case desired < current:
+		err = fmt.Errorf("downgrading Postgres from version %s to %s is not supported, set the version of the manifest back to %s",
+			currentVersion, c.Spec.PgVersion, currentVersion)
+	case desired > current && !c.OpConfig.EnablePgVersionEnvVar:
+		err = fmt.Errorf("upgrading Postgres from version %s to %s requires the enable_pgversion_env_var option",
+			currentVersion, c.Spec.PgVersion)
+	case desired > current:
+		c.logger.Infof("Postgres major version increased (%s -> %s), the pods keep running version %s until the in-place upgrade is done",
+			currentVersion, c.Spec.PgVersion, currentVersion)
+		c.eventRecorder.Eventf(c.GetReference(), v1.EventTypeNormal, "PostgreSQL",
+			"Postgres major version increased (%s -> %s), run the in-place upgrade on the master after the pods have been rotated",
+			currentVersion, c.Spec.PgVersion)
+		return nil
+	default:
+		// the same major version written differently
+		return nil
+	}
+	c.eventRecorder.Event(c.GetReference(), v1.EventTypeWarning, "PostgreSQL", err.Error())
+	return err
+}
+
+// checkTablespaceRemoval refuses to remove the volume of a tablespace from the statefulset while the tablespace still
+// exists, the pods would be re-created without its data. The removal is refused as well when the database cannot be
+// reached to tell.
+func (c *Cluster) checkTablespaceRemoval(ctx context.Context, sset *appsv1.StatefulSet) error {
+	removed := removedTablespaceVolumes(sset, c.Spec.Tablespaces)
+	if len(removed) == 0 {
+		return nil
+	}
+
+	remaining := make([]string, 0)
+	err := c.withDbConn("", func() error {
+		tablespaces, err := c.getTablespaces(ctx)
+		if err != nil {
+			return err
+		}
+		for tablespace := range tablespaces {
+			if util.SliceContains(removed, tablespaceVolumeName(tablespace)) {
+				remaining = append(remaining, tablespace)
+			}
+		}
+		return nil
+	})
+	switch {
+	case err != nil:
+		err = fmt.Errorf("could not check the tablespaces of the removed volumes %v: %v", removed, err)
+	case len(remaining) > 0:
+		sort.Strings(remaining)
+		err = fmt.Errorf("removing the volumes of the existing tablespaces %v is not supported, drop the tablespaces first or add them back to the manifest",
+			remaining)
+	default:
+		return nil
+	}
+	c.eventRecorder.Event(c.GetReference(), v1.EventTypeWarning, "Tablespaces", err.Error())
+	return err
+}
+
+// removedTablespaceVolumes returns the tablespace volumes of the statefulset that are no longer in the manifest
+func removedTablespaceVolumes(sset *appsv1.StatefulSet, tablespaces []acidv1.Tablespace) []string {
+	removed := make([]string, 0)
+	for _, claim := range sset.Spec.VolumeClaimTemplates {
+		if !strings.HasPrefix(claim.Name, constants.TablespaceVolumePrefix) {
+			continue
+		}
+		found := false
+		for _, tablespace := range tablespaces {
+			if tablespaceVolumeName(tablespace.Name) == claim.Name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			removed = append(removed, claim.Name)
+		}
+	}
+	return removed
+}
+
+func (c *Cluster) syncStatefulSet(ctx context.Context) (err error) {
+	var (
+		podsRollingUpdateRequired bool
+	)
+	// a sync failing before the pods have been recreated keeps the rolling update pending on the statefulset,
+	// so that it is not lost when the next sync finds the statefulset in the desired state
+	defer func() {
+		if err == nil || !podsRollingUpdateRequired || c.Statefulset == nil {
+			return
+		}
+		c.logger.Infof("keeping the rolling update of the pods pending after a failed sync")
+		flagCtx, cancel := context.WithTimeout(context.Background(), rollingUpdateFlagTimeout)
+		defer cancel()
+		if flagErr := c.applyRollingUpdateFlagforStatefulSet(flagCtx, true); flagErr != nil {
+			c.logger.Warningf("could not set rolling update flag for the statefulset: %v", flagErr)
+		}
+	}()
+
+	sset, err := c.KubeClient.StatefulSets(c.Namespace).Get(ctx, c.statefulSetName(), metav1.GetOptions{})
+	if err != nil {
+		if !k8sutil.ResourceNotFound(err) {
+			return fmt.Errorf("could not get statefulset: %v", err)
+		}
+		// statefulset does not exist, try to re-create it
+		c.Statefulset = nil
+		c.logger.Infof("could not find the cluster's statefulset")
+		c.syncDriftFound("missing statefulset")
+		pods, err := c.listPods(ctx)
+		if err != nil {
+			return fmt.Errorf("could not list pods of the statefulset: %v", err)
+		}
+		podsRollingUpdateRequired = (len(pods) > 0)
+
+		sset, err = c.createStatefulSet(ctx)
+		if err != nil {
+			return fmt.Errorf("could not create missing statefulset: %v", err)
+		}
+
+		if err = c.waitStatefulsetPodsReady(ctx); err != nil {
+			return fmt.Errorf("cluster is not ready: %v", err)
+		}
+
+		if podsRollingUpdateRequired {
+			c.logger.Warningf("found pods from the previous statefulset: trigger rolling update")
+			if err := c.applyRollingUpdateFlagforStatefulSet(ctx, podsRollingUpdateRequired); err != nil {
+				return fmt.Errorf("could not set rolling update flag for the statefulset: %v", err)
+			}
+		}
+		c.logger.Infof("created missing statefulset %q", util.NameFromMeta(sset.ObjectMeta))
+
+	} else {
+		if err = c.checkObjectOwnership("statefulset", sset.ObjectMeta); err != nil {
+			return err
+		}
+		if c.forceResyncRequested() {
+			if podsRollingUpdateRequired, err = c.forcedRollingUpdateRequired(ctx, sset); err != nil {
+				return err
+			}
+		} else {
+			podsRollingUpdateRequired = c.mergeRollingUpdateFlagUsingCache(sset)
+		}
+		// statefulset is already there, make sure we use its definition in order to compare with the spec.
+		c.Statefulset = sset
+		// the standby section may have been removed while the operator was not running
+		if c.Spec.StandbyCluster == nil && hasStandbyEnvironment(sset) {
+			c.standbyPromotionPending = true
+		}
+
+		if err = c.checkMajorVersionChange(sset); err != nil {
+			return err
+		}
+		if err = c.checkTablespaceRemoval(ctx, sset); err != nil {
+			return err
+		}
+
+		sourceChecksums, err := c.podSourceChecksums(ctx, &c.Spec)
+		if err != nil {
+			return err
+		}
+		desiredSS, err := c.generateStatefulSet(&c.Spec, sourceChecksums)
+		if err != nil {
+			return fmt.Errorf("could not generate statefulset: %v", err)
+		}
+		c.setRollingUpdateFlagForStatefulSet(desiredSS, podsRollingUpdateRequired, "from cache")
+
+		if err = c.checkSynchronousReplicas(*sset.Spec.Replicas, *desiredSS.Spec.Replicas); err != nil {
+			return err
+		}
+
+		cmp := c.compareStatefulSetWith(desiredSS)
+		if !cmp.match {
+			c.syncDriftFound("statefulset does not match the manifest")
+			if cmp.rollingUpdate && !podsRollingUpdateRequired {
+				podsRollingUpdateRequired = true
+				c.setRollingUpdateFlagForStatefulSet(desiredSS, podsRollingUpdateRequired, "statefulset changes")
+			}
+
+			c.logStatefulSetChanges(c.Statefulset, desiredSS, false, cmp.reasons)
+
+			manualChanges := manuallyChangedFields(sset.Annotations, statefulSetFields(sset))
+			if cmp.scaleOnly {
+				// scaling only overwrites the number of replicas
+				if util.SliceContains(manualChanges, "replicas") {
+					manualChanges = []string{"replicas"}
+				} else {
+					manualChanges = nil
+				}
+			}
+			c.reportManualChanges("statefulset", util.NameFromMeta(sset.ObjectMeta), manualChanges)
+
+			if err := c.syncHooks().BeforeStatefulSetUpdate(ctx, c.clusterName(), c.Statefulset, desiredSS); err != nil {
+				return fmt.Errorf("statefulset update vetoed: %v", err)
+			}
+
+			if cmp.scaleOnly {
+				if err := c.scaleStatefulSet(ctx, desiredSS); err != nil {
+					return fmt.Errorf("could not scale statefulset: %v", err)
+				}
+			} else if !cmp.replace {
+				if err := c.updateStatefulSet(ctx, desiredSS); err != nil {
+					return fmt.Errorf("could not update statefulset: %v", err)
+				}
+			} else {
+				if err := c.replaceStatefulSet(ctx, desiredSS); err != nil {
+					return fmt.Errorf("could not replace statefulset: %v", err)
+				}
+			}
+		}
+
+		c.updateStatefulSetAnnotations(ctx, c.AnnotationsToPropagate(c.annotationsSet(c.Statefulset.Annotations)))
+
+		if !labels.Equals(c.Statefulset.Labels, desiredSS.Labels) {
+			if err := c.updateStatefulSetLabels(ctx, desiredSS.Labels); err != nil {
+				return err
+			}
+		}
+
+		// writing the statefulset records it as well, this covers statefulsets written by older operator versions
+		if err := c.recordStatefulSetLastApplied(ctx); err != nil {
+			c.logger.Warningf("could not record the last applied statefulset: %v", err)
+		}
+
+		if !podsRollingUpdateRequired && !c.OpConfig.EnableLazySpiloUpgrade {
+			// even if desired and actual statefulsets match
+			// there still may be not up-to-date pods on condition
+			//  (a) the lazy update was just disabled
+			// and
+			//  (b) some of the pods were not restarted when the lazy update was still in place
+			podsRollingUpdateRequired, err = c.mustUpdatePodsAfterLazyUpdate(ctx, desiredSS)
+			if err != nil {
+				return fmt.Errorf("could not list pods of the statefulset: %v", err)
+			}
+		}
+
+	}
+
+	// Apply special PostgreSQL parameters that can only be set via the Patroni API.
+	// it is important to do it after the statefulset pods are there, but before the rolling update
+	// since those parameters require PostgreSQL restart.
+	if err := c.checkAndSetGlobalPostgreSQLConfiguration(ctx); err != nil {
+		return fmt.Errorf("could not set cluster-wide PostgreSQL configuration options: %v", err)
+	}
+
+	// if we get here we also need to re-create the pods (either leftovers from the old
+	// statefulset or those that got their configuration from the outdated statefulset)
+	if podsRollingUpdateRequired {
+		c.syncDriftFound("rolling update of the pods required")
+		// the flag on the statefulset keeps the rolling update pending until the cluster has a single leader
+		if c.leaderDiverged {
+			c.logger.Warningf("Patroni cluster diverged, rolling update postponed")
+			if err := c.applyRollingUpdateFlagforStatefulSet(ctx, true); err != nil {
+				return fmt.Errorf("could not set rolling update flag for the statefulset: %v", err)
+			}
+			return nil
+		}
+		// the flag on the statefulset keeps the rolling update pending until the maintenance window opens
+		if c.deferRollingUpdate(time.Now()) {
+			c.logger.Infof("rolling update deferred to the next maintenance window")
+			if err := c.applyRollingUpdateFlagforStatefulSet(ctx, true); err != nil {
+				return fmt.Errorf("could not set rolling update flag for the statefulset: %v", err)
+			}
+			return c.setRestartPendingCondition(true)
+		}
+		c.logger.Debugln("performing rolling update")
+		c.eventRecorder.Event(c.GetReference(), v1.EventTypeNormal, "Update", "Performing rolling update")
+		if err := c.recreatePods(ctx); err != nil {
+			return fmt.Errorf("could not recreate pods: %v", err)
+		}
+		// the pods are up to date, a later failure must not bring the rolling update back
+		podsRollingUpdateRequired = false
+		c.logger.Infof("pods have been recreated")
+		c.eventRecorder.Event(c.GetReference(), v1.EventTypeNormal, "Update", "Rolling update done - pods have been recreated")
+		if err := c.applyRollingUpdateFlagforStatefulSet(ctx, false); err != nil {
+			c.logger.Warningf("could not clear rolling update for the statefulset: %v", err)
+		}
+	}
+	return c.setRestartPendingCondition(false)
+}
+
+// deferRollingUpdate tells whether a rolling update has to wait for a maintenance window. Without any window
+// defined it is performed right away.
+func (c *Cluster) deferRollingUpdate(now time.Time) bool {
+	if !c.Spec.DeferRollingUpdates {
+		return false
+	}
+	if len(c.Spec.MaintenanceWindows) == 0 {
+		c.logger.Warning("no maintenance windows defined, rolling updates are not deferred")
+		return false
+	}
+	return !c.inMaintenanceWindow(now)
+}
+
+// setRestartPendingCondition reports a deferred rolling update in the cluster status. The condition is only
+// introduced once a rolling update got deferred.
+func (c *Cluster) setRestartPendingCondition(pending bool) error {
+	if pending {
+		return c.setCondition(acidv1.ClusterCondition{
+			Type:    acidv1.ClusterConditionRestartPending,
+			Status:  v1.ConditionTrue,
+			Reason:  acidv1.ClusterConditionReasonRollingUpdateDeferred,
+			Message: "waiting for the next maintenance window to recreate the pods",
+		})
+	}
+	for _, condition := range c.Status.Conditions {
+		if condition.Type == acidv1.ClusterConditionRestartPending {
+			return c.setCondition(acidv1.ClusterCondition{
+				Type:   acidv1.ClusterConditionRestartPending,
+				Status: v1.ConditionFalse,
+				Reason: acidv1.ClusterConditionReasonNoRestartPending,
+			})
+		}
+	}
+	return nil
+}
+
+// syncPodMonitor creates or updates the PodMonitor scraping the metrics port of the pods and deletes it once
+// it is switched off. Without the CRDs of the Prometheus operator no PodMonitor is created.
+func (c *Cluster) syncPodMonitor(ctx context.Context) error {
+	if c.KubeClient.DynamicClient == nil {
+		return nil
+	}
+	if !podMonitorEnabled(&c.Spec) {
+		return c.deletePodMonitor(ctx)
+	}
+
+	podMonitors := c.KubeClient.DynamicClient.Resource(podMonitorResource).Namespace(c.Namespace)
+	desiredPodMonitor := c.generatePodMonitor()
+	podMonitorName := util.NameFromMeta(metav1.ObjectMeta{Namespace: c.Namespace, Name: c.Name})
+
+	podMonitor, err := podMonitors.Get(ctx, c.Name, metav1.GetOptions{})
+	if err != nil {
+		if !k8sutil.ResourceNotFound(err) {
+			return fmt.Errorf("could not get pod monitor: %v", err)
+		}
+		if _, err = podMonitors.Create(ctx, desiredPodMonitor, metav1.CreateOptions{}); err != nil {
+			// the API is only served when the CRDs of the Prometheus operator are installed
+			if k8sutil.ResourceNotFound(err) {
+				c.logger.Warningf("could not create pod monitor: the PodMonitor resource is not available in the cluster")
+				return nil
+			}
+			return fmt.Errorf("could not create pod monitor: %v", err)
+		}
+		c.logger.Infof("pod monitor %q has been created", podMonitorName)
+		return nil
+	}
+
+	if !c.hasClusterLabels(podMonitor.GetLabels()) {
+		return fmt.Errorf("pod monitor %q exists, but is not managed by the operator", podMonitorName)
+	}
+	if reflect.DeepEqual(podMonitor.Object["spec"], desiredPodMonitor.Object["spec"]) &&
+		reflect.DeepEqual(podMonitor.GetLabels(), desiredPodMonitor.GetLabels()) {
+		return nil
+	}
+
+	podMonitor.Object["spec"] = desiredPodMonitor.Object["spec"]
+	podMonitor.SetLabels(desiredPodMonitor.GetLabels())
+	if _, err = podMonitors.Update(ctx, podMonitor, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("could not update pod monitor: %v", err)
+	}
+	c.logger.Infof("pod monitor %q has been updated", podMonitorName)
+
+	return nil
+}
+
+// syncMasterTCPRoute creates or updates the TCPRoute of the Gateway API routing to the master service and deletes
+// it once removed from the manifest. Without the CRDs of the Gateway API no TCPRoute is created.
+func (c *Cluster) syncMasterTCPRoute(ctx context.Context) error {
+	if c.KubeClient.DynamicClient == nil {
+		return nil
+	}
+	if c.Spec.MasterTCPRoute == nil {
+		return c.deleteMasterTCPRoute(ctx)
+	}
+
+	tcpRoutes := c.KubeClient.DynamicClient.Resource(tcpRouteResource).Namespace(c.Namespace)
+	desiredTCPRoute := c.generateMasterTCPRoute()
+	tcpRouteName := util.NameFromMeta(metav1.ObjectMeta{Namespace: c.Namespace, Name: desiredTCPRoute.GetName()})
+
+	tcpRoute, err := tcpRoutes.Get(ctx, desiredTCPRoute.GetName(), metav1.GetOptions{})
+	if err != nil {
+		if !k8sutil.ResourceNotFound(err) {
+			return fmt.Errorf("could not get TCP route: %v", err)
+		}
+		if _, err = tcpRoutes.Create(ctx, desiredTCPRoute, metav1.CreateOptions{}); err != nil {
+			// the API is only served when the CRDs of the Gateway API are installed
+			if k8sutil.ResourceNotFound(err) {
+				c.logger.Warningf("could not create TCP route: the TCPRoute resource is not available in the cluster")
+				return nil
+			}
+			return fmt.Errorf("could not create TCP route: %v", err)
+		}
+		c.logger.Infof("TCP route %q has been created", tcpRouteName)
+		return nil
+	}
+
+	if !c.hasClusterLabels(tcpRoute.GetLabels()) {
+		return fmt.Errorf("TCP route %q exists, but is not managed by the operator", tcpRouteName)
+	}
+	if reflect.DeepEqual(tcpRouteManagedSpec(tcpRoute), tcpRouteManagedSpec(desiredTCPRoute)) &&
+		reflect.DeepEqual(tcpRoute.GetLabels(), desiredTCPRoute.GetLabels()) {
+		return nil
+	}
+
+	c.syncDriftFound("TCP route %q does not match the manifest", tcpRouteName)
+	tcpRoute.Object["spec"] = desiredTCPRoute.Object["spec"]
+	tcpRoute.SetLabels(desiredTCPRoute.GetLabels())
+	if _, err = tcpRoutes.Update(ctx, tcpRoute, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("could not update TCP route: %v", err)
+	}
+	c.logger.Infof("TCP route %q has been updated", tcpRouteName)
+
+	return nil
+}
+
+// AnnotationsToPropagate get the annotations to update if required
+// based on the annotations in postgres CRD
+func (c *Cluster) AnnotationsToPropagate(annotations map[string]string) map[string]string {
+
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+
+	pgCRDAnnotations := c.ObjectMeta.Annotations
+
+	if pgCRDAnnotations != nil {
+		for _, anno := range c.OpConfig.DownscalerAnnotations {
+			for k, v := range pgCRDAnnotations {
+				matched, err := regexp.MatchString(anno, k)
+				if err != nil {
+					c.logger.Errorf("annotations matching issue: %v", err)
+					return nil
+				}
+				if matched {
+					annotations[k] = v
+				}
+			}
+		}
+	}
+
+	if len(annotations) > 0 {
+		return annotations
+	}
+
+	return nil
+}
+
+// checkAndSetGlobalPostgreSQLConfiguration checks whether cluster-wide API parameters
+// (like max_connections) or logging parameters have changed and if necessary sets them
+// via the Patroni API. Changed logging parameters are applied with a reload of Postgres,
+// all of the others require a restart. When the manifest defers those, the changes are
+// set only within a maintenance window and are reported in the status of the cluster
+// until then. The libraries of shared_preload_libraries are added to the ones already
+// loaded and a restart of Postgres is scheduled to load them. The settings of the audit
+// section are set the same way, with pgaudit added to the libraries.
+func (c *Cluster) checkAndSetGlobalPostgreSQLConfiguration(ctx context.Context) error {
+	var (
+		err               error
+		pods              []v1.Pod
+		currentParameters map[string]string
+		addedLibraries    []string
+		removedLibraries  []string
+	)
+
+	if c.leaderDiverged {
+		c.logger.Warning("Patroni cluster diverged, not setting cluster-wide PostgreSQL configuration options")
+		return nil
+	}
+
+	// we need to extract those options from the cluster manifest.
+	optionsToSet := make(map[string]string)
+	pgOptions := c.Spec.Parameters
+
+	for k, v := range pgOptions {
+		if isBootstrapOnlyParameter(k) || k == sharedPreloadLibrariesParameter {
+			if err = validateBootstrapOnlyParameter(k, v); err != nil {
+				return err
+			}
+			optionsToSet[k] = v
+		} else if isLoggingParameter(k) {
+			optionsToSet[k] = v
+		}
+	}
+
+	// the memory settings follow the memory limit of the statefulset synced before
+	if c.Spec.EnableMemoryTuning && c.Statefulset != nil {
+		for _, container := range c.Statefulset.Spec.Template.Spec.Containers {
+			if container.Name != constants.PostgresContainerName {
+				continue
+			}
+			for k, v := range memoryTunedParameters(container.Resources.Limits[v1.ResourceMemory], pgOptions) {
+				optionsToSet[k] = v
+			}
+		}
+	}
+
+	for k, v := range auditParameters(c.Spec.Audit) {
+		if k == sharedPreloadLibrariesParameter && optionsToSet[k] != "" {
+			v = optionsToSet[k] + "," + v
+		}
+		optionsToSet[k] = v
+	}
+
+	if len(optionsToSet) == 0 {
+		return c.setParametersAppliedCondition(nil)
+	}
+
+	if pods, err = c.listPods(ctx); err != nil {
+		return err
+	}
+	if len(pods) == 0 {
+		return fmt.Errorf("could not call Patroni API: cluster has no pods")
+	}
+
+	if currentParameters, err = c.getPostgresParameters(ctx, pods); err != nil {
+		return err
+	}
+	if libraries, ok := optionsToSet[sharedPreloadLibrariesParameter]; ok {
+		loaded := c.loadedSharedPreloadLibraries(ctx, currentParameters)
+		optionsToSet[sharedPreloadLibrariesParameter], addedLibraries, removedLibraries = mergeSharedPreloadLibraries(
+			loaded, libraries, c.removedLibraries)
+		for library := range c.removedLibraries {
+			if !util.SliceContains(loaded, library) {
+				delete(c.removedLibraries, library)
+			}
+		}
+	}
+	changedOptions := pendingPostgresParameters(currentParameters, optionsToSet)
+	// deferred options are found again by the next sync as well
+	if len(changedOptions) > 0 {
+		c.syncDriftFound("Postgres parameters do not match the manifest")
+	}
+
+	// the options applied with a reload are never deferred
+	if c.deferRestartParameters(time.Now()) {
+		reloadOptions := make(map[string]string)
+		pendingOptions := make(map[string]string)
+		for name, value := range changedOptions {
+			if isReloadParameter(name) {
+				reloadOptions[name] = value
+			} else {
+				pendingOptions[name] = value
+			}
+		}
+		if len(pendingOptions) > 0 {
+			c.logger.Infof("deferring the following Postgres options to the next maintenance window: %v",
+				pendingOptions)
+		}
+		if len(reloadOptions) > 0 {
+			if err = c.setPostgresParameters(ctx, pods, reloadOptions); err != nil {
+				return err
+			}
+			if err = c.applyChangedPostgresParameters(ctx, pods, reloadOptions); err != nil {
+				return err
+			}
+		}
+		return c.setParametersAppliedCondition(pendingOptions)
+	}
+
+	if err = c.setPostgresParameters(ctx, pods, optionsToSet); err != nil {
+		return err
+	}
+	// the libraries Postgres loads are read on each sync, so a restart that did not happen is scheduled again
+	if len(addedLibraries)+len(removedLibraries) > 0 && !time.Now().Before(c.librariesRestartAt) {
+		if err = c.schedulePostgresRestart(ctx, pods, librariesChange(addedLibraries, removedLibraries)); err != nil {
+			return err
+		}
+	}
+	if err = c.applyChangedPostgresParameters(ctx, pods, changedOptions); err != nil {
+		return err
+	}
+	return c.setParametersAppliedCondition(nil)
+}
+
+// setPostgresParameters sets the options via the Patroni API of the first pod that answers, as it doesn't matter
+// which pod carries the request to change configuration through
+func (c *Cluster) setPostgresParameters(ctx context.Context, pods []v1.Pod, options map[string]string) error {
+	for _, pod := range pods {
+		podName := util.NameFromMeta(pod.ObjectMeta)
+		c.logger.Debugf("calling Patroni API on a pod %s to set the following Postgres options: %v",
+			podName, options)
+		err := c.patroni.SetPostgresParameters(ctx, &pod, options)
+		if err == nil {
+			return nil
+		}
+		c.logger.Warningf("could not patch postgres parameters with a pod %s: %v", podName, err)
+	}
+	return fmt.Errorf("could not reach Patroni API to set Postgres options: failed on every pod (%d total)",
+		len(pods))
+}
+
+// applyChangedPostgresParameters reloads Postgres on every pod for the changed options taking effect with a
+// reload, so they do not wait for the next loop of Patroni. The changed options requiring a restart are recorded,
+// Patroni reports those members as pending a restart. The added libraries are left out, a restart is scheduled
+// for them.
+func (c *Cluster) applyChangedPostgresParameters(ctx context.Context, pods []v1.Pod,
+	changedOptions map[string]string) error {
+	reloadOptions := make([]string, 0)
+	restartOptions := make([]string, 0)
+	for name, value := range changedOptions {
+		option := fmt.Sprintf("%s=%s", name, value)
+		if isReloadParameter(name) {
+			reloadOptions = append(reloadOptions, option)
+		} else if name != sharedPreloadLibrariesParameter {
+			restartOptions = append(restartOptions, option)
+		}
+	}
+	sort.Strings(reloadOptions)
+	sort.Strings(restartOptions)
+
+	if len(restartOptions) > 0 {
+		c.logger.Infof("Postgres has to be restarted to apply %s", strings.Join(restartOptions, ", "))
+		c.eventRecorder.Eventf(c.GetReference(), v1.EventTypeNormal, "Parameters",
+			"Set %s requiring a restart of Postgres", strings.Join(restartOptions, ", "))
+	}
+	if len(reloadOptions) == 0 {
+		return nil
+	}
+
+	for i := range pods {
+		if err := c.patroni.Reload(ctx, &pods[i]); err != nil {
+			return fmt.Errorf("could not reload pod %q: %v", util.NameFromMeta(pods[i].ObjectMeta), err)
+		}
+	}
+	c.logger.Infof("reloaded Postgres to apply %s", strings.Join(reloadOptions, ", "))
+	return nil
+}
+
+// synchronousStandbys returns the number of synchronous standbys Patroni has to keep, none without synchronous
+// mode
+func synchronousStandbys(spec *acidv1.PostgresSpec) int32 {
+	if spec.Patroni.SynchronousMode == nil || !*spec.Patroni.SynchronousMode || spec.StandbyCluster != nil {
+		return 0
+	}
+	if spec.Patroni.SynchronousNodeCount == 0 {
+		return 1
+	}
+	return int32(spec.Patroni.SynchronousNodeCount)
+}
+
+// checkSynchronousReplicas refuses to scale the statefulset below the number of instances needed for the
+// synchronous standbys, scaling up towards that number is still allowed, as is scaling the cluster down to zero
+func (c *Cluster) checkSynchronousReplicas(current, desired int32) error {
+	minimum := synchronousStandbys(&c.Spec) + 1
+	if minimum == 1 || desired == 0 || desired >= minimum || desired >= current {
+		return nil
+	}
+	err := fmt.Errorf("refusing to scale from %d to %d instances: %d synchronous standbys require at least %d instances",
+		current, desired, minimum-1, minimum)
+	c.eventRecorder.Eventf(c.GetReference(), v1.EventTypeWarning, "Scale", "Could not scale the cluster: %v", err)
+	return err
+}
+
+// syncSynchronousMode sets the synchronous replication settings of the spec in the Patroni configuration and
+// records the effective mode in the cluster status
+func (c *Cluster) syncSynchronousMode(ctx context.Context) error {
+	if c.Spec.StandbyCluster != nil {
+		return nil
+	}
+
+	var desired *patroni.SynchronousMode
+	err := c.patroniOnAnyPod(ctx, func(pod *v1.Pod) error {
+		current, err := c.patroni.GetSynchronousMode(ctx, pod)
+		if err != nil {
+			return fmt.Errorf("could not get synchronous mode: %v", err)
+		}
+		mode := c.desiredSynchronousMode(current)
+		if mode != current {
+			c.logger.Infof("changing synchronous mode from %s with %d synchronous standbys to %s with %d",
+				synchronousModeStatus(current), current.NodeCount, synchronousModeStatus(mode), mode.NodeCount)
+			if err = c.patroni.SetSynchronousMode(ctx, pod, mode); err != nil {
+				return fmt.Errorf("could not set synchronous mode: %v", err)
+			}
+		}
+		desired = &mode
+		return nil
+	})
+	if err != nil || desired == nil {
+		return err
+	}
+	return c.setSynchronousModeStatus(synchronousModeStatus(*desired))
+}
+
+// patroniOnAnyPod calls the Patroni API through the pods of the cluster until the first call succeeds, as it doesn't
+// matter which pod carries the request to change the configuration. Without pods nothing is called.
+func (c *Cluster) patroniOnAnyPod(ctx context.Context, call func(pod *v1.Pod) error) error {
+	pods, err := c.listPods(ctx)
+	if err != nil {
+		return err
+	}
+	if len(pods) == 0 {
+		return nil
+	}
+
+	for i := range pods {
+		if err = call(&pods[i]); err == nil {
+			return nil
+		}
+		c.logger.Warningf("could not call Patroni API with a pod %s: %v", util.NameFromMeta(pods[i].ObjectMeta), err)
+	}
+	return fmt.Errorf("could not reach Patroni API: failed on every pod (%d total)", len(pods))
+}
+
+// syncReadOnly sets default_transaction_read_only in the Patroni configuration while the manifest quiesces the
+// cluster and reloads Postgres on every pod, so the leader serves read-only transactions as well. The value is set
+// back to off once the flag is cleared, a cluster that was never quiesced is left alone. The state is reported by
+// the ReadOnly condition.
+func (c *Cluster) syncReadOnly(ctx context.Context) error {
+	if c.leaderDiverged {
+		c.logger.Warning("Patroni cluster diverged, not syncing the read-only state")
+		return nil
+	}
+
+	pods, err := c.listPods(ctx)
+	if err != nil {
+		return err
+	}
+	if len(pods) == 0 {
+		return nil
+	}
+
+	currentParameters, err := c.getPostgresParameters(ctx, pods)
+	if err != nil {
+		return err
+	}
+	current := currentParameters[readOnlyParameter]
+
+	// a value in the parameters of the manifest takes precedence over the flag
+	desired := "off"
+	if value, ok := c.Spec.Parameters[readOnlyParameter]; ok {
+		desired = value
+	} else if c.Spec.ReadOnly {
+		desired = "on"
+	} else if current == "" {
+		return c.setReadOnlyCondition(current)
+	}
+	if current != desired {
+		c.syncDriftFound("read-only state does not match the manifest")
+		options := map[string]string{readOnlyParameter: desired}
+		if err = c.setPostgresParameters(ctx, pods, options); err != nil {
+			return err
+		}
+		if err = c.applyChangedPostgresParameters(ctx, pods, options); err != nil {
+			return err
+		}
+		c.eventRecorder.Eventf(c.GetReference(), v1.EventTypeNormal, "ReadOnly", "Set %s=%s", readOnlyParameter, desired)
+	}
+	return c.setReadOnlyCondition(desired)
+}
+
+// setReadOnlyCondition reports whether the cluster is quiesced, given the value of default_transaction_read_only
+// applied by Patroni. The condition is only introduced once the cluster was made read-only.
+func (c *Cluster) setReadOnlyCondition(applied string) error {
+	switch strings.ToLower(applied) {
+	case "on", "true", "yes", "1":
+		return c.setCondition(acidv1.ClusterCondition{
+			Type:    acidv1.ClusterConditionReadOnly,
+			Status:  v1.ConditionTrue,
+			Reason:  acidv1.ClusterConditionReasonReadOnlyRequested,
+			Message: fmt.Sprintf("%s is %s", readOnlyParameter, applied),
+		})
+	}
+	for _, condition := range c.Status.Conditions {
+		if condition.Type == acidv1.ClusterConditionReadOnly {
+			return c.setCondition(acidv1.ClusterCondition{
+				Type:    acidv1.ClusterConditionReadOnly,
+				Status:  v1.ConditionFalse,
+				Reason:  acidv1.ClusterConditionReasonReadWrite,
+				Message: fmt.Sprintf("%s is %s", readOnlyParameter, applied),
+			})
+		}
+	}
+	return nil
+}
+
+// desiredSynchronousMode returns the synchronous replication settings of the spec, the current ones when the spec
+// leaves synchronous mode unset. Strict mode stops the writes without enough synchronous standbys, so it is only
+// enabled if the cluster has the instances for them.
+func (c *Cluster) desiredSynchronousMode(current patroni.SynchronousMode) patroni.SynchronousMode {
+	if c.Spec.Patroni.SynchronousMode == nil {
+		return current
+	}
+	desired := patroni.SynchronousMode{
+		Enabled:   *c.Spec.Patroni.SynchronousMode,
+		Strict:    *c.Spec.Patroni.SynchronousMode && c.Spec.Patroni.SynchronousModeStrict,
+		NodeCount: current.NodeCount,
+	}
+	if desired.Enabled {
+		desired.NodeCount = int(synchronousStandbys(&c.Spec))
+	}
+
+	instances := int(c.getNumberOfInstances(&c.Spec))
+	if desired.Strict && !current.Strict && instances < desired.NodeCount+1 {
+		c.logger.Warningf("not enabling strict synchronous mode: %d synchronous standbys require at least %d instances, the cluster has %d",
+			desired.NodeCount, desired.NodeCount+1, instances)
+		c.eventRecorder.Eventf(c.GetReference(), v1.EventTypeWarning, "SynchronousMode",
+			"Could not enable strict synchronous mode: %d synchronous standbys require at least %d instances, the cluster has %d",
+			desired.NodeCount, desired.NodeCount+1, instances)
+		desired.Strict = false
+	}
+	return desired
+}
+
+// synchronousModeStatus names the synchronous mode for the cluster status
+func synchronousModeStatus(mode patroni.SynchronousMode) string {
+	switch {
+	case !mode.Enabled:
+		return acidv1.SynchronousModeOff
+	case mode.Strict:
+		return acidv1.SynchronousModeStrict
+	default:
+		return acidv1.SynchronousModeOn
+	}
+}
+
+// setSynchronousModeStatus records the effective synchronous mode in the cluster status when it changed
+func (c *Cluster) setSynchronousModeStatus(mode string) error {
+	if c.Status.SynchronousMode == mode {
+		return nil
+	}
+	if _, err := c.KubeClient.SetPostgresCRDSynchronousMode(c.clusterName(), mode); err != nil {
+		return err
+	}
+	c.Status.SynchronousMode = mode
+	return nil
+}
+
+// syncMaximumLagOnFailover sets maximum_lag_on_failover of the manifest in the Patroni configuration, Patroni
+// applies it on its next loop without a restart. Without the manifest value the one of Patroni is left alone. The
+// effective value is recorded in the cluster status.
+func (c *Cluster) syncMaximumLagOnFailover(ctx context.Context) error {
+	if c.leaderDiverged {
+		c.logger.Warning("Patroni cluster diverged, not setting maximum_lag_on_failover")
+		return nil
+	}
+
+	var desired *int64
+	err := c.patroniOnAnyPod(ctx, func(pod *v1.Pod) error {
+		current, err := c.patroni.GetMaximumLagOnFailover(ctx, pod)
+		if err != nil {
+			return fmt.Errorf("could not get maximum_lag_on_failover: %v", err)
+		}
+		maxLag := current
+		if c.Spec.Patroni.MaximumLagOnFailover != nil {
+			maxLag = *c.Spec.Patroni.MaximumLagOnFailover
+		}
+		if maxLag != current {
+			c.logger.Infof("changing maximum_lag_on_failover from %d to %d", current, maxLag)
+			if err = c.patroni.SetMaximumLagOnFailover(ctx, pod, maxLag); err != nil {
+				return fmt.Errorf("could not set maximum_lag_on_failover: %v", err)
+			}
+		}
+		desired = &maxLag
+		return nil
+	})
+	if err != nil || desired == nil {
+		return err
+	}
+	return c.setMaximumLagOnFailoverStatus(*desired)
+}
+
+// setMaximumLagOnFailoverStatus records the effective maximum_lag_on_failover in the cluster status
+func (c *Cluster) setMaximumLagOnFailoverStatus(maxLag int64) error {
+	if c.Status.MaximumLagOnFailover != nil && *c.Status.MaximumLagOnFailover == maxLag {
+		return nil
+	}
+	if _, err := c.KubeClient.SetPostgresCRDMaximumLagOnFailover(c.clusterName(), maxLag); err != nil {
+		return err
+	}
+	c.Status.MaximumLagOnFailover = &maxLag
+	return nil
+}
+
+// syncReplicaEndpoint maintains the addresses of the replica endpoint when the manifest limits the replication lag
+// of the replicas serving the replica service
+func (c *Cluster) syncReplicaEndpoint(ctx context.Context) error {
+	if !replicaServiceEnabled(&c.Spec) || !replicaLagGateEnabled(&c.Spec) {
+		return nil
+	}
+	c.setProcessName("syncing replica endpoint")
+
+	ep, err := c.updateReplicaEndpoint(ctx, &c.Spec)
+	if err != nil {
+		return err
+	}
+	c.Endpoints[Replica] = ep
+	return nil
+}
+
+// updateReplicaEndpoint keeps only the running replicas whose lag reported by Patroni is within the limit of the spec
+// in the replica endpoint, when Patroni cannot be reached the endpoint is left as it is. The endpoint is read from the
+// K8s API, since pod events update it besides the sync.
+func (c *Cluster) updateReplicaEndpoint(ctx context.Context, spec *acidv1.PostgresSpec) (*v1.Endpoints, error) {
+	c.podRolesMu.Lock()
+	defer c.podRolesMu.Unlock()
+
+	ep, err := c.KubeClient.Endpoints(c.Namespace).Get(ctx, c.endpointName(Replica), metav1.GetOptions{})
+	if err != nil {
+		if k8sutil.ResourceNotFound(err) {
+			return nil, fmt.Errorf("there is no replica endpoint in the cluster")
+		}
+		return nil, fmt.Errorf("could not get replica endpoint: %v", err)
+	}
+
+	pods, err := c.listPods(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(pods, func(i, j int) bool { return pods[i].Name < pods[j].Name })
+
+	var members []patroni.ClusterMember
+	for i := range pods {
+		if members, err = c.patroni.GetClusterMembers(ctx, &pods[i]); err == nil {
+			break
+		}
+		c.logger.Debugf("could not get Patroni cluster members from pod %q: %v", pods[i].Name, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not get the replication lag of the replicas from Patroni: %v", err)
+	}
+
+	maxLag := uint64(*spec.ReplicaServiceMaxLag)
+	serving := make(map[string]bool)
+	lagging := make([]string, 0)
+	for _, member := range members {
+		if member.Role != "replica" && member.Role != "sync_standby" {
+			continue
+		}
+		if member.State != "running" && member.State != "streaming" {
+			continue
+		}
+		if uint64(member.Lag) > maxLag {
+			lagging = append(lagging, member.Name)
+			continue
+		}
+		serving[member.Name] = true
+	}
+
+	addresses := make([]v1.EndpointAddress, 0)
+	for _, pod := range pods {
+		if serving[pod.Name] && pod.Status.PodIP != "" {
+			addresses = append(addresses, v1.EndpointAddress{IP: pod.Status.PodIP})
+		}
+	}
+	desiredSubsets := endpointSubsets(addresses)
+	if (len(ep.Subsets) == 0 && len(desiredSubsets) == 0) || reflect.DeepEqual(ep.Subsets, desiredSubsets) {
+		return ep, nil
+	}
+
+	c.logger.Infof("updating replica endpoint to %d replicas within the maximum lag of %d bytes", len(addresses), maxLag)
+	updatedEp := ep.DeepCopy()
+	updatedEp.Subsets = desiredSubsets
+	if ep, err = c.KubeClient.Endpoints(c.Namespace).Update(ctx, updatedEp, metav1.UpdateOptions{}); err != nil {
+		return nil, fmt.Errorf("could not update replica endpoint: %v", err)
+	}
+
+	if len(lagging) > 0 {
+		sort.Strings(lagging)
+		c.eventRecorder.Eventf(c.GetReference(), v1.EventTypeWarning, "ReplicaLag",
+			"replicas %s exceed the maximum lag of %d bytes and are left out of the replica endpoint",
+			strings.Join(lagging, ", "), maxLag)
+	}
+
+	return ep, nil
+}
+
+// syncPgIdent replaces the user name maps of pg_ident.conf in the dynamic configuration when they differ from the
+// manifest, including their order. Patroni rewrites pg_ident.conf of every member and reloads Postgres on its next
+// loop. It keeps the file as it is when the maps are left empty, so removed maps are replaced by a comment.
+func (c *Cluster) syncPgIdent(ctx context.Context) error {
+	if c.leaderDiverged {
+		c.logger.Warning("Patroni cluster diverged, not setting pg_ident")
+		return nil
+	}
+
+	return c.patroniOnAnyPod(ctx, func(pod *v1.Pod) error {
+		current, err := c.patroni.GetPgIdent(ctx, pod)
+		if err != nil {
+			return fmt.Errorf("could not get pg_ident: %v", err)
+		}
+		desired := c.Spec.Patroni.PgIdent
+		if len(desired) == 0 {
+			if len(current) == 0 {
+				return nil
+			}
+			desired = []string{pgIdentEmptyComment}
+		}
+		if reflect.DeepEqual(desired, current) {
+			return nil
+		}
+		c.logger.Infof("changing pg_ident from %q to %q", current, desired)
+		if err = c.patroni.SetPgIdent(ctx, pod, desired); err != nil {
+			return fmt.Errorf("could not set pg_ident: %v", err)
+		}
+		c.eventRecorder.Event(c.GetReference(), v1.EventTypeNormal, "Update", "pg_ident user name maps changed")
+		return nil
+	})
+}
+
+// syncReplicationSlots reconciles the permanent replication slots of the dynamic configuration with the manifest,
+// Patroni creates them on the primary and keeps them across failovers. The slots the operator set are recorded in
+// the cluster status, only those are removed from the configuration once they are removed from the manifest. Other
+// slots, e.g. added with patronictl, are left alone. Removed slots stay in the status until Postgres dropped them.
+func (c *Cluster) syncReplicationSlots(ctx context.Context) error {
+	if len(c.Spec.Patroni.Slots) == 0 && len(c.Status.ReplicationSlots) == 0 {
+		return nil
+	}
+	if c.leaderDiverged {
+		c.logger.Warning("Patroni cluster diverged, not setting replication slots")
+		return nil
+	}
+
+	synced := false
+	removed := c.removedReplicationSlots()
+	err := c.patroniOnAnyPod(ctx, func(pod *v1.Pod) error {
+		current, err := c.patroni.GetSlots(ctx, pod)
+		if err != nil {
+			return fmt.Errorf("could not get replication slots: %v", err)
+		}
+		changed := make(map[string]map[string]string)
+		for name, attributes := range c.Spec.Patroni.Slots {
+			if !reflect.DeepEqual(current[name], attributes) {
+				changed[name] = attributes
+			}
+		}
+		for _, name := range removed {
+			if _, ok := current[name]; ok {
+				changed[name] = nil
+			}
+		}
+		if len(changed) == 0 {
+			synced = true
+			return nil
+		}
+		c.syncDriftFound("replication slots do not match the manifest")
+		if err = c.patroni.SetSlots(ctx, pod, changed); err != nil {
+			return fmt.Errorf("could not set replication slots: %v", err)
+		}
+		for name, attributes := range changed {
+			if attributes != nil {
+				c.logger.Infof("setting replication slot %q to %v", name, attributes)
+				continue
+			}
+			c.logger.Infof("removing replication slot %q", name)
+		}
+		c.eventRecorder.Event(c.GetReference(), v1.EventTypeNormal, "Update", "permanent replication slots changed")
+		synced = true
+		return nil
+	})
+	if err != nil || !synced {
+		return err
+	}
+	return c.setReplicationSlotsStatus(removed)
+}
+
+// removedReplicationSlots returns the slots recorded in the cluster status that are no longer in the manifest
+func (c *Cluster) removedReplicationSlots() []string {
+	removed := make([]string, 0)
+	for _, name := range c.Status.ReplicationSlots {
+		if _, ok := c.Spec.Patroni.Slots[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	return removed
+}
+
+// setReplicationSlotsStatus records the slots of the manifest and the removed slots Postgres still has as the ones
+// the operator set in the cluster status
+func (c *Cluster) setReplicationSlotsStatus(removed []string) error {
+	slots := make([]string, 0, len(c.Spec.Patroni.Slots)+len(removed))
+	for name := range c.Spec.Patroni.Slots {
+		slots = append(slots, name)
+	}
+	slots = append(slots, removed...)
+	sort.Strings(slots)
+	if len(slots) == 0 && len(c.Status.ReplicationSlots) == 0 || reflect.DeepEqual(slots, c.Status.ReplicationSlots) {
+		return nil
+	}
+
+	if _, err := c.KubeClient.SetPostgresCRDReplicationSlots(c.clusterName(), slots); err != nil {
+		return err
+	}
+	c.Status.ReplicationSlots = slots
+	return nil
+}
+
+// checkReplicationSlots reports the slots of the manifest that are inactive but retain WAL on the primary, which
+// fills up its volume until the consumer is back, and the removed slots Patroni cannot drop while they are in use
+func (c *Cluster) checkReplicationSlots(ctx context.Context) error {
+	if len(c.Spec.Patroni.Slots) == 0 && len(c.Status.ReplicationSlots) == 0 {
+		return nil
+	}
+	c.setProcessName("checking replication slots")
+
+	return c.withDbConn("", func() error {
+		slots, err := c.getReplicationSlots(ctx)
+		if err != nil {
+			return fmt.Errorf("could not get replication slots: %v", err)
+		}
+		c.reportReplicationSlots(slots)
+		return c.pruneReplicationSlots(slots)
+	})
+}
+
+// pruneReplicationSlots forgets the removed slots Postgres has dropped
+func (c *Cluster) pruneReplicationSlots(slots map[string]replicationSlot) error {
+	remaining := make([]string, 0)
+	for _, name := range c.removedReplicationSlots() {
+		if _, exists := slots[name]; exists {
+			remaining = append(remaining, name)
+		}
+	}
+	return c.setReplicationSlotsStatus(remaining)
+}
+
+// reportReplicationSlots emits a warning event for the slots retaining WAL and for the removed slots that are still
+// in use, it returns the slots it warned about
+func (c *Cluster) reportReplicationSlots(slots map[string]replicationSlot) []string {
+	warned := make([]string, 0)
+	for _, name := range c.removedReplicationSlots() {
+		slot, exists := slots[name]
+		if exists && slot.Active {
+			message := fmt.Sprintf("replication slot %q was removed from the manifest but is still in use, it is dropped once its consumer disconnects", name)
+			c.logger.Warning(message)
+			c.eventRecorder.Event(c.GetReference(), v1.EventTypeWarning, "ReplicationSlot", message)
+			warned = append(warned, name)
+		}
+	}
+	for name := range c.Spec.Patroni.Slots {
+		slot, exists := slots[name]
+		if !exists || slot.Active || slot.RetainedBytes <= 0 {
+			continue
+		}
+		message := fmt.Sprintf("replication slot %q is inactive and retains %dMB of WAL", name, slot.RetainedBytes/1024/1024)
+		c.logger.Warning(message)
+		c.eventRecorder.Event(c.GetReference(), v1.EventTypeWarning, "ReplicationSlot", message)
+		warned = append(warned, name)
+	}
+	sort.Strings(warned)
+	return warned
+}
+
+// deferRestartParameters tells whether changes of parameters requiring a restart have to wait for a
+// maintenance window. Without any window defined they are applied right away.
+func (c *Cluster) deferRestartParameters(now time.Time) bool {
+	if !c.Spec.DeferRestartParameters {
+		return false
+	}
+	if len(c.Spec.MaintenanceWindows) == 0 {
+		c.logger.Warning("no maintenance windows defined, Postgres options requiring a restart are not deferred")
+		return false
+	}
+	return !c.inMaintenanceWindow(now)
+}
+
+// getPostgresParameters returns the Postgres options Patroni currently has, asking the pods until the first
+// one answers
+func (c *Cluster) getPostgresParameters(ctx context.Context, pods []v1.Pod) (map[string]string, error) {
+	for _, pod := range pods {
+		podName := util.NameFromMeta(pod.ObjectMeta)
+		currentParameters, err := c.patroni.GetPostgresParameters(ctx, &pod)
+		if err == nil {
+			return currentParameters, nil
+		}
+		c.logger.Warningf("could not get postgres parameters with a pod %s: %v", podName, err)
+	}
+	return nil, fmt.Errorf("could not reach Patroni API to get Postgres options: failed on every pod (%d total)",
+		len(pods))
+}
+
+// pendingPostgresParameters returns the options whose values differ from the ones Patroni currently has
+func pendingPostgresParameters(currentParameters, options map[string]string) map[string]string {
+	pendingOptions := make(map[string]string)
+	for name, value := range options {
+		if currentParameters[name] != value {
+			pendingOptions[name] = value
+		}
+	}
+	return pendingOptions
+}
+
+// loadedSharedPreloadLibraries returns the libraries the running Postgres loaded. Without access to the database
+// the value Patroni has is taken instead.
+func (c *Cluster) loadedSharedPreloadLibraries(ctx context.Context, currentParameters map[string]string) []string {
+	if !c.databaseAccessDisabled() {
+		var libraries []string
+		err := c.withDbConn("", func() error {
+			var err error
+			libraries, err = c.getSharedPreloadLibraries(ctx)
+			return err
+		})
+		if err == nil {
+			return libraries
+		}
+		c.logger.Warningf("could not get the loaded libraries, using the ones of the Patroni configuration: %v", err)
+	}
+	return splitLibraries(currentParameters[sharedPreloadLibrariesParameter])
+}
+
+// librariesChange describes the added and removed preloaded libraries a restart of Postgres applies
+func librariesChange(added, removed []string) string {
+	changes := make([]string, 0, 2)
+	if len(added) > 0 {
+		changes = append(changes, "load "+strings.Join(added, ", "))
+	}
+	if len(removed) > 0 {
+		changes = append(changes, "unload "+strings.Join(removed, ", "))
+	}
+	return strings.Join(changes, " and ")
+}
+
+// schedulePostgresRestart asks Patroni to restart Postgres on every pod to load or unload the changed libraries.
+// The restart is scheduled after two Patroni loops, so that every member picked up the changed option by then,
+// and the master is restarted one delay after the replicas. Until the restart of the master is due no other one
+// is scheduled, a failure lets the next sync try again.
+func (c *Cluster) schedulePostgresRestart(ctx context.Context, pods []v1.Pod, change string) error {
+	loopWait := c.Spec.Patroni.LoopWait
+	if loopWait == 0 {
+		loopWait = defaultPatroniLoopWait
+	}
+	delay := time.Duration(2*loopWait) * time.Second
+	replicasAt := time.Now().Add(delay)
+
+	failed := make([]string, 0)
+	for _, pod := range pods {
+		podName := util.NameFromMeta(pod.ObjectMeta)
+		at := replicasAt
+		if PostgresRole(pod.Labels[c.OpConfig.PodRoleLabel]) == Master {
+			at = replicasAt.Add(delay)
+		}
+		if err := c.patroni.ScheduleRestart(ctx, &pod, at); err != nil {
+			c.logger.Warningf("could not schedule a restart of pod %s: %v", podName, err)
+			failed = append(failed, podName.Name)
+			continue
+		}
+		c.logger.Infof("scheduled a restart of pod %s at %s to %s", podName, at.Format(time.RFC3339), change)
+	}
+	if len(failed) > 0 {
+		c.librariesRestartAt = time.Time{}
+		return fmt.Errorf("could not schedule a restart of the pods %s", strings.Join(failed, ", "))
+	}
+
+	c.librariesRestartAt = replicasAt.Add(2 * delay)
+	c.eventRecorder.Eventf(c.GetReference(), v1.EventTypeNormal, "Restart",
+		"Scheduled a restart of Postgres to %s", change)
+	return nil
+}
+
+// setParametersAppliedCondition reports the deferred options in the cluster status. The condition is only
+// introduced once options got deferred.
+func (c *Cluster) setParametersAppliedCondition(pendingOptions map[string]string) error {
+	if len(pendingOptions) == 0 {
+		for _, condition := range c.Status.Conditions {
+			if condition.Type == acidv1.ClusterConditionParametersApplied {
+				return c.setCondition(acidv1.ClusterCondition{
+					Type:   acidv1.ClusterConditionParametersApplied,
+					Status: v1.ConditionTrue,
+					Reason: acidv1.ClusterConditionReasonAllParametersApplied,
+				})
+			}
+		}
+		return nil
+	}
+
+	options := make([]string, 0, len(pendingOptions))
+	for name, value := range pendingOptions {
+		options = append(options, fmt.Sprintf("%s=%s", name, value))
+	}
+	sort.Strings(options)
+
+	return c.setCondition(acidv1.ClusterCondition{
+		Type:    acidv1.ClusterConditionParametersApplied,
+		Status:  v1.ConditionFalse,
+		Reason:  acidv1.ClusterConditionReasonParametersDeferred,
+		Message: fmt.Sprintf("waiting for the next maintenance window to set %s", strings.Join(options, ", ")),
+	})
+}
+
+// syncSecrets creates the missing secrets of the users and reads the passwords of the existing ones, including
+// the externally managed ones. A failing secret does not stop the others from being synced, the errors of all of
+// them are returned together and the failed secrets are retried on the next sync.
+func (c *Cluster) syncSecrets(ctx context.Context) error {
+	c.logger.Info("syncing secrets")
+	c.setProcessName("syncing secrets")
+	secrets := c.generateUserSecrets()
+
+	// sync in a stable order, so that the combined error reads the same on every sync
+	usernames := make([]string, 0, len(secrets))
+	for secretUsername := range secrets {
+		usernames = append(usernames, secretUsername)
+	}
+	sort.Strings(usernames)
+
+	var errors []string
+	for _, secretUsername := range usernames {
+		if err := c.syncSecret(ctx, secretUsername, secrets[secretUsername]); err != nil {
+			errors = append(errors, err.Error())
+		}
+	}
+	c.logger.Debugf("synced %d of %d secrets", len(secrets)-len(errors), len(secrets))
+
+	externalUsernames := make([]string, 0, len(c.Spec.ExternalSecrets))
+	for username := range c.Spec.ExternalSecrets {
+		externalUsernames = append(externalUsernames, username)
+	}
+	sort.Strings(externalUsernames)
+	for _, username := range externalUsernames {
+		if err := c.readExternalSecret(ctx, username, c.Spec.ExternalSecrets[username]); err != nil {
+			errors = append(errors, err.Error())
+		}
+	}
+
+	if err := c.deleteOrphanedSecrets(ctx, secrets); err != nil {
+		errors = append(errors, fmt.Sprintf("could not delete orphaned secrets: %v", err))
+	}
+
+	if len(errors) > 0 {
+		return fmt.Errorf("could not sync all secrets: %v", strings.Join(errors, "; "))
+	}
+
+	return nil
+}
+
+// syncSecret creates the secret of a user or, if it exists, takes over its password. Only a synced
+// secret is added to the secrets of the cluster.
+func (c *Cluster) syncSecret(ctx context.Context, secretUsername string, secretSpec *v1.Secret) error {
+	secret, err := c.KubeClient.Secrets(secretSpec.Namespace).Create(ctx, secretSpec, metav1.CreateOptions{})
+	if err == nil {
+		c.Secrets[secret.UID] = secret
+		c.logger.Debugf("created new secret %q, uid: %q", util.NameFromMeta(secret.ObjectMeta), secret.UID)
+		c.syncDriftFound("missing secret %q", util.NameFromMeta(secret.ObjectMeta))
+		return nil
+	}
+	if !k8sutil.ResourceAlreadyExists(err) {
+		return fmt.Errorf("could not create secret for user %q: %v", secretUsername, err)
+	}
+
+	var userMap map[string]spec.PgUser
+	if secret, err = c.KubeClient.Secrets(secretSpec.Namespace).Get(ctx, secretSpec.Name, metav1.GetOptions{}); err != nil {
+		return fmt.Errorf("could not get current secret for user %q: %v", secretUsername, err)
+	}
+	if secretUsername != string(secret.Data["username"]) {
+		c.logger.Errorf("secret %s does not contain the role %q", secretSpec.Name, secretUsername)
+		return nil
+	}
+	c.logger.Debugf("secret %s already exists, fetching its password", util.NameFromMeta(secret.ObjectMeta))
+	if secretUsername == c.systemUsers[constants.SuperuserKeyName].Name {
+		secretUsername = constants.SuperuserKeyName
+		userMap = c.systemUsers
+	} else if secretUsername == c.systemUsers[constants.ReplicationUserKeyName].Name {
+		secretUsername = constants.ReplicationUserKeyName
+		userMap = c.systemUsers
+	} else {
+		userMap = c.pgUsers
+	}
+	pwdUser := userMap[secretUsername]
+	// if this secret belongs to the infrastructure role and the password has changed - replace it in the secret
+	if pwdUser.Password != string(secret.Data["password"]) &&
+		pwdUser.Origin == spec.RoleOriginInfrastructure {
+
+		c.logger.Debugf("updating the secret %q from the infrastructure roles", secretSpec.Name)
+		if _, err = c.KubeClient.Secrets(secretSpec.Namespace).Update(ctx, secretSpec, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("could not update infrastructure role secret for role %q: %v", secretUsername, err)
+		}
+	} else {
+		// for non-infrastructure role - update the role with the password from the secret
+		pwdUser.Password = string(secret.Data["password"])
+		userMap[secretUsername] = pwdUser
+	}
+	if !labels.Equals(secret.Labels, secretSpec.Labels) {
+		c.logger.Debugf("updating labels of the secret %q", util.NameFromMeta(secret.ObjectMeta))
+		patchData, err := metaLabelsPatch(secret.Labels, secretSpec.Labels)
+		if err != nil {
+			return fmt.Errorf("could not form patch for the secret metadata: %v", err)
+		}
+		if secret, err = c.KubeClient.Secrets(secret.Namespace).Patch(ctx, secret.Name,
+			types.MergePatchType, patchData, metav1.PatchOptions{}, ""); err != nil {
+			return fmt.Errorf("could not patch labels of the secret for user %q: %v", secretUsername, err)
+		}
+	}
+	c.Secrets[secret.UID] = secret
+
+	return nil
+}
+
+// readExternalSecret takes the password of a user from its externally managed secret. No password is generated
+// in its place, a user whose secret is missing keeps an empty password and is skipped when syncing the roles.
+func (c *Cluster) readExternalSecret(ctx context.Context, username string, externalSecret acidv1.ExternalSecret) error {
+	user, ok := c.pgUsers[username]
+	if !ok {
+		c.logger.Warningf("external secret %q refers to user %q not defined in the manifest", externalSecret.SecretName, username)
+		return nil
+	}
+
+	passwordKey := externalSecret.PasswordKey
+	if passwordKey == "" {
+		passwordKey = "password"
+	}
+	secret, err := c.KubeClient.Secrets(c.Namespace).Get(ctx, externalSecret.SecretName, metav1.GetOptions{})
+	if err != nil {
+		if k8sutil.ResourceNotFound(err) {
+			return fmt.Errorf("external secret %q of user %q does not exist", externalSecret.SecretName, username)
+		}
+		return fmt.Errorf("could not get external secret %q of user %q: %v", externalSecret.SecretName, username, err)
+	}
+	password := secret.Data[passwordKey]
+	if len(password) == 0 {
+		return fmt.Errorf("external secret %q of user %q has no password under the key %q",
+			externalSecret.SecretName, username, passwordKey)
+	}
+
+	user.Password = string(password)
+	c.pgUsers[username] = user
+	return nil
+}
+
+// syncSystemPasswordRotation rotates the passwords of the superuser and the replication user when requested via
+// the annotation of the Postgres manifest and removes the annotation once the rotation has succeeded
+func (c *Cluster) syncSystemPasswordRotation(ctx context.Context) (err error) {
+	if rotate, _ := strconv.ParseBool(c.ObjectMeta.Annotations[constants.RotateSystemPasswordsAnnotationKey]); !rotate {
+		return nil
+	}
+
+	if err = c.withDbConn("", func() error {
+		return c.rotateSystemPasswords(ctx)
+	}); err != nil {
+		return err
+	}
+	c.logger.Info("passwords of the system users have been rotated")
+	c.eventRecorder.Event(c.GetReference(), v1.EventTypeNormal, "PasswordRotation",
+		"Passwords of the system users have been rotated")
+
+	return c.removeManifestAnnotation(ctx, constants.RotateSystemPasswordsAnnotationKey)
+}
+
+// systemPasswordRotation holds the state of rotating the password of one system user
+type systemPasswordRotation struct {
+	key      string
+	previous spec.PgUser
+	rotated  spec.PgUser
+	secret   *v1.Secret
+}
+
+// rotateSystemPasswords sets new passwords for the superuser and the replication user.
+//
+// The roles are altered in Postgres first. Then the new credentials are written into the configuration of the
+// Patroni of every pod, which picks them up with a reload through its API, and finally the secrets are updated,
+// from which Spilo renders the credentials when a pod starts. Open connections, including the streaming
+// replication, are not affected by the new passwords.
+//
+// The rotation succeeds or fails as a whole:
+//   - when altering a role fails, the roles altered before get their previous password back and neither Patroni
+//     nor a secret is touched
+//   - when updating Patroni fails on a pod, the pods updated before, including the failed one if its
+//     configuration file has been written, and all roles get their previous password back and no secret
+//     is touched
+//   - when updating a secret fails, the secrets updated before, all pods and all roles get their previous
+//     password back
+//
+// Should the revert fail as well, the returned error names what could not be reverted. Postgres, Patroni and the
+// secrets then disagree on the password of that user, which has to be fixed manually.
+func (c *Cluster) rotateSystemPasswords(ctx context.Context) error {
+	rotations := make([]systemPasswordRotation, 0, 2)
+	for _, key := range []string{constants.SuperuserKeyName, constants.ReplicationUserKeyName} {
+		user := c.systemUsers[key]
+		secretName := c.credentialSecretName(user.Name)
+		secret, err := c.KubeClient.Secrets(c.Namespace).Get(ctx, secretName, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("could not get secret %q of user %q: %v", secretName, user.Name, err)
+		}
+		rotations = append(rotations, systemPasswordRotation{
+			key:      key,
+			previous: spec.PgUser{Name: user.Name, Password: string(secret.Data["password"])},
+			rotated:  spec.PgUser{Name: user.Name, Password: util.RandomPassword(constants.PasswordLength)},
+			secret:   secret,
+		})
+	}
+	pods, err := c.listPods(ctx)
+	if err != nil {
+		return err
+	}
+
+	// the step may fail because its context expired, the previous passwords are restored with a context of their own
+	// so that Postgres, Patroni and the secrets keep the same passwords
+	revertContext := func() (context.Context, context.CancelFunc) {
+		return context.WithTimeout(context.Background(), systemPasswordRevertTimeout)
+	}
+
+	for i, rotation := range rotations {
+		if err := c.alterSystemUserPassword(ctx, rotation.rotated); err != nil {
+			err = fmt.Errorf("could not set new password of user %q: %v", rotation.rotated.Name, err)
+			revertCtx, cancel := revertContext()
+			defer cancel()
+			return revertSystemPasswordRotation(err, c.revertSystemPasswordRoles(revertCtx, rotations[:i]))
+		}
+	}
+
+	for i := range pods {
+		if written, err := c.setPatroniPasswords(ctx, &pods[i], rotations, true); err != nil {
+			updatedPods := pods[:i]
+			if written {
+				updatedPods = pods[:i+1]
+			}
+			revertCtx, cancel := revertContext()
+			defer cancel()
+			revertErrors := c.revertPatroniPasswords(revertCtx, updatedPods, rotations)
+			revertErrors = append(revertErrors, c.revertSystemPasswordRoles(revertCtx, rotations)...)
+			return revertSystemPasswordRotation(err, revertErrors)
+		}
+	}
+
+	for i, rotation := range rotations {
+		secret := rotation.secret.DeepCopy()
+		secret.Data["password"] = []byte(rotation.rotated.Password)
+		updatedSecret, err := c.KubeClient.Secrets(secret.Namespace).Update(ctx, secret, metav1.UpdateOptions{})
+		if err != nil {
+			err = fmt.Errorf("could not update secret %q: %v", secret.Name, err)
+			revertCtx, cancel := revertContext()
+			defer cancel()
+			revertErrors := c.revertSystemPasswordSecrets(revertCtx, rotations[:i])
+			revertErrors = append(revertErrors, c.revertPatroniPasswords(revertCtx, pods, rotations)...)
+			revertErrors = append(revertErrors, c.revertSystemPasswordRoles(revertCtx, rotations)...)
+			return revertSystemPasswordRotation(err, revertErrors)
+		}
+		rotations[i].secret = updatedSecret
+	}
+
+	for _, rotation := range rotations {
+		user := c.systemUsers[rotation.key]
+		user.Password = rotation.rotated.Password
+		c.systemUsers[rotation.key] = user
+	}
+	return nil
+}
+
+func (c *Cluster) alterSystemUserPassword(ctx context.Context, user spec.PgUser) error {
+	request := spec.PgSyncUserRequest{Kind: spec.PGsyncUserAlter, User: user, PasswordEncryption: passwordEncryption(&c.Spec)}
+	return c.userSyncStrategy.ExecuteSyncRequests(ctx, []spec.PgSyncUserRequest{request}, c.pgDb)
+}
+
+// setPatroniPasswords writes the rotated or the previous passwords into the authentication section of the
+// configuration file of the running Patroni and reloads it, it reports whether the file has been written
+func (c *Cluster) setPatroniPasswords(ctx context.Context, pod *v1.Pod, rotations []systemPasswordRotation, rotated bool) (bool, error) {
+	podName := util.NameFromMeta(pod.ObjectMeta)
+	passwords := make(map[string]string, len(rotations))
+	for _, rotation := range rotations {
+		user := rotation.previous
+		if rotated {
+			user = rotation.rotated
+		}
+		passwords[rotation.key] = user.Password
+	}
+	input, err := json.Marshal(passwords)
+	if err != nil {
+		return false, fmt.Errorf("could not marshal the passwords for the Patroni configuration: %v", err)
+	}
+
+	// the passwords are passed on the standard input, the arguments are visible in the process list of the pod
+	if _, err := c.execCommandWithInput(&podName, string(input),
+		"python3", "-c", setPatroniPasswordsScript, constants.PatroniConfigFile); err != nil {
+		return false, fmt.Errorf("could not set the passwords in the Patroni configuration of pod %q: %v", podName, err)
+	}
+	if err := c.patroni.Reload(ctx, pod); err != nil {
+		return true, fmt.Errorf("could not reload the Patroni configuration of pod %q: %v", podName, err)
+	}
+	return true, nil
+}
+
+// revertSystemPasswordRoles sets the previous passwords of the rotated roles again
+func (c *Cluster) revertSystemPasswordRoles(ctx context.Context, rotations []systemPasswordRotation) []string {
+	var revertErrors []string
+	for _, rotation := range rotations {
+		if err := c.alterSystemUserPassword(ctx, rotation.previous); err != nil {
+			revertErrors = append(revertErrors, fmt.Sprintf("could not restore password of user %q: %v",
+				rotation.previous.Name, err))
+		}
+	}
+	return revertErrors
+}
+
+// revertPatroniPasswords puts the previous passwords into the Patroni configuration of the pods again
+func (c *Cluster) revertPatroniPasswords(ctx context.Context, pods []v1.Pod, rotations []systemPasswordRotation) []string {
+	var revertErrors []string
+	for i := range pods {
+		if _, err := c.setPatroniPasswords(ctx, &pods[i], rotations, false); err != nil {
+			revertErrors = append(revertErrors, fmt.Sprintf("could not restore passwords in Patroni: %v", err))
+		}
+	}
+	return revertErrors
+}
+
+// revertSystemPasswordSecrets puts the previous passwords into the updated secrets again
+func (c *Cluster) revertSystemPasswordSecrets(ctx context.Context, rotations []systemPasswordRotation) []string {
+	var revertErrors []string
+	for _, rotation := range rotations {
+		secret := rotation.secret.DeepCopy()
+		secret.Data["password"] = []byte(rotation.previous.Password)
+		if _, err := c.KubeClient.Secrets(secret.Namespace).Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+			revertErrors = append(revertErrors, fmt.Sprintf("could not restore secret %q: %v", secret.Name, err))
+		}
+	}
+	return revertErrors
+}
+
+func revertSystemPasswordRotation(err error, revertErrors []string) error {
+	if len(revertErrors) > 0 {
+		return fmt.Errorf("%v, reverting the rotation failed: %s", err, strings.Join(revertErrors, "; "))
+	}
+	return fmt.Errorf("%v, the previous passwords have been restored", err)
+}
+
+// deleteOrphanedSecrets removes the credential secrets the operator created for users that are no longer
+// defined for the cluster. Secrets of infrastructure roles and secrets annotated to be kept are never deleted.
+func (c *Cluster) deleteOrphanedSecrets(ctx context.Context, desiredSecrets map[string]*v1.Secret) error {
+	desiredSecretNames := make(map[string]bool, len(desiredSecrets))
+	for _, secret := range desiredSecrets {
+		desiredSecretNames[secret.Name] = true
+	}
+
+	protectedSecretNames := map[string]bool{c.OpConfig.InfrastructureRolesSecretName.Name: true}
+	for _, infraRole := range c.OpConfig.InfrastructureRoles {
+		protectedSecretNames[infraRole.SecretName.Name] = true
+	}
+	for username := range c.InfrastructureRoles {
+		protectedSecretNames[c.credentialSecretName(username)] = true
+	}
+	for _, externalSecret := range c.Spec.ExternalSecrets {
+		protectedSecretNames[externalSecret.SecretName] = true
+	}
+
+	listOptions := metav1.ListOptions{
+		LabelSelector: c.labelsSet(false).String(),
+	}
+	secrets, err := c.KubeClient.Secrets(c.Namespace).List(ctx, listOptions)
+	if err != nil {
+		return fmt.Errorf("could not list secrets: %v", err)
+	}
+
+	for _, secret := range secrets.Items {
+		if desiredSecretNames[secret.Name] || protectedSecretNames[secret.Name] {
+			continue
+		}
+		// only consider credential secrets following the operator's naming scheme
+		username, ok := secret.Data["username"]
+		if !ok || secret.Name != c.credentialSecretName(string(username)) {
+			continue
+		}
+		if keep, _ := strconv.ParseBool(secret.Annotations[constants.KeepSecretAnnotationKey]); keep {
+			c.logger.Debugf("keeping orphaned secret %q as requested by its annotation", util.NameFromMeta(secret.ObjectMeta))
+			continue
 		}
+
+		c.logger.Infof("deleting secret %q of user %q that is no longer defined", util.NameFromMeta(secret.ObjectMeta), username)
+		if err = c.deleteSecret(ctx, secret.UID, secret); err != nil {
+			return err
+		}
+		delete(c.Secrets, secret.UID)
 	}
+
 	return nil
 }
 
-// AnnotationsToPropagate get the annotations to update if required
-// based on the annotations in postgres CRD
-func (c *Cluster) AnnotationsToPropagate(annotations map[string]string) map[string]string {
-
-	if annotations == nil {
-		annotations = make(map[string]string)
+// syncDatabaseObjects syncs all roles and databases of the cluster, which are no longer pending afterwards
+func (c *Cluster) syncDatabaseObjects(ctx context.Context) error {
+	c.logger.Debugf("syncing roles")
+	if err := c.syncRoles(ctx); err != nil {
+		return fmt.Errorf("could not sync roles: %v", err)
 	}
-
-	pgCRDAnnotations := c.ObjectMeta.Annotations
-
-	if pgCRDAnnotations != nil {
-		for _, anno := range c.OpConfig.DownscalerAnnotations {
-			for k, v := range pgCRDAnnotations {
-				matched, err := regexp.MatchString(anno, k)
-				if err != nil {
-					c.logger.Errorf("annotations matching issue: %v", err)
-					return nil
-				}
-				if matched {
-					annotations[k] = v
-				}
-			}
-		}
+	c.logger.Debugf("syncing databases")
+	if err := c.syncDatabases(ctx); err != nil {
+		return fmt.Errorf("could not sync databases: %v", err)
 	}
-
-	if len(annotations) > 0 {
-		return annotations
+	c.logger.Debugf("syncing prepared databases with schemas")
+	if err := c.syncPreparedDatabases(ctx); err != nil {
+		return fmt.Errorf("could not sync prepared database: %v", err)
+	}
+	if err := c.syncMonitoringExtension(ctx); err != nil {
+		return fmt.Errorf("could not sync monitoring extension: %v", err)
+	}
+	if err := c.syncAuditExtension(ctx); err != nil {
+		return fmt.Errorf("could not sync audit extension: %v", err)
+	}
+	c.logger.Debugf("syncing backup role grants")
+	if err := c.syncBackupGrants(ctx); err != nil {
+		return fmt.Errorf("could not sync backup role grants: %v", err)
 	}
+	c.databaseObjectsPending = false
 
 	return nil
 }
 
-// checkAndSetGlobalPostgreSQLConfiguration checks whether cluster-wide API parameters
-// (like max_connections) has changed and if necessary sets it via the Patroni API
-func (c *Cluster) checkAndSetGlobalPostgreSQLConfiguration() error {
-	var (
-		err  error
-		pods []v1.Pod
-	)
+func (c *Cluster) syncRoles(ctx context.Context) error {
+	c.setProcessName("syncing roles")
 
-	// we need to extract those options from the cluster manifest.
-	optionsToSet := make(map[string]string)
-	pgOptions := c.Spec.Parameters
+	var roleNames []string
+	err := c.withDbConn("", func() error {
+		var userNames []string
+		for _, u := range c.pgUsers {
+			userNames = append(userNames, u.Name)
+		}
 
-	for k, v := range pgOptions {
-		if isBootstrapOnlyParameter(k) {
-			optionsToSet[k] = v
+		if needMasterConnectionPooler(&c.Spec) || needReplicaConnectionPooler(&c.Spec) {
+			connectionPoolerUser := c.systemUsers[constants.ConnectionPoolerUserKeyName]
+			userNames = append(userNames, connectionPoolerUser.Name)
+
+			if _, exists := c.pgUsers[connectionPoolerUser.Name]; !exists {
+				c.pgUsers[connectionPoolerUser.Name] = connectionPoolerUser
+			}
 		}
-	}
 
-	if len(optionsToSet) == 0 {
-		return nil
-	}
+		dbUsers, err := c.readPgUsersFromDatabase(ctx, userNames)
+		if err != nil {
+			return fmt.Errorf("error getting users from the database: %v", err)
+		}
+
+		// users waiting for the password of their external secret are left untouched
+		pgUsers := make(spec.PgUserMap, len(c.pgUsers))
+		for name, user := range c.pgUsers {
+			if _, external := c.Spec.ExternalSecrets[name]; external && user.Password == "" {
+				c.logger.Warningf("skipping user %q without a password from its external secret", name)
+				continue
+			}
+			pgUsers[name] = user
+		}
+
+		// a changed password encryption of the manifest applies to the roles synced next
+		pgSyncRequests := c.userSyncStrategy.ProduceSyncRequests(dbUsers, pgUsers, passwordEncryption(&c.Spec))
+		if len(pgSyncRequests) > 0 {
+			c.syncDriftFound("roles do not match the manifest")
+		}
+		if err := c.userSyncStrategy.ExecuteSyncRequests(ctx, pgSyncRequests, c.pgDb); err != nil {
+			return fmt.Errorf("error executing sync statements: %v", err)
+		}
+		c.reportExpiredRoles(time.Now())
+
+		roleNames = make([]string, 0, len(pgUsers))
+		for name := range pgUsers {
+			roleNames = append(roleNames, name)
+		}
+		sort.Strings(roleNames)
 
-	if pods, err = c.listPods(); err != nil {
+		return nil
+	})
+	if err != nil {
 		return err
 	}
-	if len(pods) == 0 {
-		return fmt.Errorf("could not call Patroni API: cluster has no pods")
+
+	// the hook may take its time, it is called without holding the database connection
+	if err := c.syncHooks().AfterRolesSync(ctx, c.clusterName(), roleNames); err != nil {
+		return fmt.Errorf("roles sync hook failed: %v", err)
 	}
-	// try all pods until the first one that is successful, as it doesn't matter which pod
-	// carries the request to change configuration through
-	for _, pod := range pods {
-		podName := util.NameFromMeta(pod.ObjectMeta)
-		c.logger.Debugf("calling Patroni API on a pod %s to set the following Postgres options: %v",
-			podName, optionsToSet)
-		if err = c.patroni.SetPostgresParameters(&pod, optionsToSet); err == nil {
-			return nil
+	return nil
+}
+
+// reportExpiredRoles emits a warning event for the manifest roles whose expiry has passed, they are kept as is
+func (c *Cluster) reportExpiredRoles(now time.Time) []string {
+	expired := make([]string, 0)
+	for name, user := range c.pgUsers {
+		if user.ValidUntil == nil || user.ValidUntil.IsZero() || user.ValidUntil.After(now) {
+			continue
 		}
-		c.logger.Warningf("could not patch postgres parameters with a pod %s: %v", podName, err)
+		expired = append(expired, name)
 	}
-	return fmt.Errorf("could not reach Patroni API to set Postgres options: failed on every pod (%d total)",
-		len(pods))
+	if len(expired) == 0 {
+		return expired
+	}
+
+	sort.Strings(expired)
+	message := fmt.Sprintf("roles %s have expired and can no longer log in", strings.Join(expired, ", "))
+	c.logger.Warning(message)
+	c.eventRecorder.Event(c.GetReference(), v1.EventTypeWarning, "RoleExpired", message)
+	return expired
 }
 
-func (c *Cluster) syncSecrets() error {
-	var (
-		err    error
-		secret *v1.Secret
-	)
-	c.logger.Info("syncing secrets")
-	c.setProcessName("syncing secrets")
-	secrets := c.generateUserSecrets()
+func (c *Cluster) syncDatabases(ctx context.Context) error {
+	c.setProcessName("syncing databases")
 
-	for secretUsername, secretSpec := range secrets {
-		if secret, err = c.KubeClient.Secrets(secretSpec.Namespace).Create(context.TODO(), secretSpec, metav1.CreateOptions{}); err == nil {
-			c.Secrets[secret.UID] = secret
-			c.logger.Debugf("created new secret %q, uid: %q", util.NameFromMeta(secret.ObjectMeta), secret.UID)
-			continue
+	createDatabases := make(map[string]string)
+	alterOwnerDatabases := make(map[string]string)
+	preparedDatabases := make([]string, 0)
+
+	return c.withDbConn("", func() error {
+		if err := c.syncTablespaces(ctx); err != nil {
+			return fmt.Errorf("could not sync tablespaces: %v", err)
 		}
-		if k8sutil.ResourceAlreadyExists(err) {
-			var userMap map[string]spec.PgUser
-			if secret, err = c.KubeClient.Secrets(secretSpec.Namespace).Get(context.TODO(), secretSpec.Name, metav1.GetOptions{}); err != nil {
-				return fmt.Errorf("could not get current secret: %v", err)
+
+		currentDatabases, err := c.getDatabases(ctx)
+		if err != nil {
+			return fmt.Errorf("could not get current databases: %v", err)
+		}
+
+		// if no prepared databases are specified create a database named like the cluster
+		if c.Spec.PreparedDatabases != nil && len(c.Spec.PreparedDatabases) == 0 { // TODO: add option to disable creating such a default DB
+			c.Spec.PreparedDatabases = map[string]acidv1.PreparedDatabase{strings.Replace(c.Name, "-", "_", -1): {}}
+		}
+		for preparedDatabaseName := range c.Spec.PreparedDatabases {
+			_, exists := currentDatabases[preparedDatabaseName]
+			if !exists {
+				createDatabases[preparedDatabaseName] = preparedDatabaseName + constants.OwnerRoleNameSuffix
+				preparedDatabases = append(preparedDatabases, preparedDatabaseName)
 			}
-			if secretUsername != string(secret.Data["username"]) {
-				c.logger.Errorf("secret %s does not contain the role %q", secretSpec.Name, secretUsername)
-				continue
+		}
+
+		for databaseName, newOwner := range c.Spec.Databases {
+			currentOwner, exists := currentDatabases[databaseName]
+			if !exists {
+				createDatabases[databaseName] = newOwner
+			} else if currentOwner != newOwner {
+				alterOwnerDatabases[databaseName] = newOwner
 			}
-			c.Secrets[secret.UID] = secret
-			c.logger.Debugf("secret %s already exists, fetching its password", util.NameFromMeta(secret.ObjectMeta))
-			if secretUsername == c.systemUsers[constants.SuperuserKeyName].Name {
-				secretUsername = constants.SuperuserKeyName
-				userMap = c.systemUsers
-			} else if secretUsername == c.systemUsers[constants.ReplicationUserKeyName].Name {
-				secretUsername = constants.ReplicationUserKeyName
-				userMap = c.systemUsers
-			} else {
-				userMap = c.pgUsers
+		}
+
+		if len(createDatabases)+len(alterOwnerDatabases) == 0 {
+			return nil
+		}
+
+		for databaseName, owner := range createDatabases {
+			if err = c.executeCreateDatabase(ctx, databaseName, owner); err != nil {
+				return err
+			}
+		}
+		for databaseName, owner := range alterOwnerDatabases {
+			if err = c.executeAlterDatabaseOwner(ctx, databaseName, owner); err != nil {
+				return err
 			}
-			pwdUser := userMap[secretUsername]
-			// if this secret belongs to the infrastructure role and the password has changed - replace it in the secret
-			if pwdUser.Password != string(secret.Data["password"]) &&
-				pwdUser.Origin == spec.RoleOriginInfrastructure {
+		}
 
-				c.logger.Debugf("updating the secret %q from the infrastructure roles", secretSpec.Name)
-				if _, err = c.KubeClient.Secrets(secretSpec.Namespace).Update(context.TODO(), secretSpec, metav1.UpdateOptions{}); err != nil {
-					return fmt.Errorf("could not update infrastructure role secret for role %q: %v", secretUsername, err)
-				}
-			} else {
-				// for non-infrastructure role - update the role with the password from the secret
-				pwdUser.Password = string(secret.Data["password"])
-				userMap[secretUsername] = pwdUser
+		// set default privileges for prepared database
+		for _, preparedDatabase := range preparedDatabases {
+			if err = c.execAlterGlobalDefaultPrivileges(ctx, preparedDatabase+constants.OwnerRoleNameSuffix, preparedDatabase); err != nil {
+				return err
 			}
-		} else {
-			return fmt.Errorf("could not create secret for user %q: %v", secretUsername, err)
 		}
-	}
 
-	return nil
+		return nil
+	})
 }
 
-func (c *Cluster) syncRoles() (err error) {
-	c.setProcessName("syncing roles")
-
-	var (
-		dbUsers   spec.PgUserMap
-		userNames []string
-	)
+// syncTablespaces creates the tablespaces defined in the manifest. Every pod must have
+// the volume of a tablespace mounted first, since replicas replay the creation as well.
+// The caller is responsible for opening and closing the database connection
+func (c *Cluster) syncTablespaces(ctx context.Context) error {
+	if len(c.Spec.Tablespaces) == 0 {
+		return nil
+	}
+	c.setProcessName("syncing tablespaces")
 
-	err = c.initDbConn()
+	currentTablespaces, err := c.getTablespaces(ctx)
 	if err != nil {
-		return fmt.Errorf("could not init db connection: %v", err)
+		return fmt.Errorf("could not get current tablespaces: %v", err)
 	}
 
-	defer func() {
-		if err2 := c.closeDbConn(); err2 != nil {
-			if err == nil {
-				err = fmt.Errorf("could not close database connection: %v", err2)
-			} else {
-				err = fmt.Errorf("could not close database connection: %v (prior error: %v)", err2, err)
+	var pods []v1.Pod
+	for _, tablespace := range c.Spec.Tablespaces {
+		if currentTablespaces[tablespace.Name] {
+			continue
+		}
+		if pods == nil {
+			if pods, err = c.listPods(ctx); err != nil {
+				return err
 			}
 		}
-	}()
 
-	for _, u := range c.pgUsers {
-		userNames = append(userNames, u.Name)
-	}
+		volumeName := tablespaceVolumeName(tablespace.Name)
+		location := tablespaceLocation(tablespace.Name)
+		if podName, mounted := podsHaveVolumeMounted(pods, volumeName); !mounted {
+			c.logger.Warningf("postponing creation of tablespace %q: volume %q is not mounted in pod %q yet",
+				tablespace.Name, volumeName, podName)
+			continue
+		}
 
-	if needMasterConnectionPooler(&c.Spec) || needReplicaConnectionPooler(&c.Spec) {
-		connectionPoolerUser := c.systemUsers[constants.ConnectionPoolerUserKeyName]
-		userNames = append(userNames, connectionPoolerUser.Name)
+		for _, pod := range pods {
+			podName := util.NameFromMeta(pod.ObjectMeta)
+			// Postgres requires the location to be owned by the postgres user
+			cmd := fmt.Sprintf("mkdir -p %[1]s && chmod 700 %[1]s && if [ \"$(id -u)\" = 0 ]; then chown postgres:postgres %[1]s; fi", location)
+			if _, err := c.ExecCommand(&podName, "bash", "-c", cmd); err != nil {
+				return fmt.Errorf("could not create directory for tablespace %q in pod %q: %v", tablespace.Name, podName, err)
+			}
+		}
 
-		if _, exists := c.pgUsers[connectionPoolerUser.Name]; !exists {
-			c.pgUsers[connectionPoolerUser.Name] = connectionPoolerUser
+		if err = c.executeCreateTablespace(ctx, tablespace.Name, location); err != nil {
+			return err
 		}
 	}
 
-	dbUsers, err = c.readPgUsersFromDatabase(userNames)
-	if err != nil {
-		return fmt.Errorf("error getting users from the database: %v", err)
+	return nil
+}
+
+// podsHaveVolumeMounted checks if the Postgres container of every pod mounts the given
+// volume and returns the first pod without it
+func podsHaveVolumeMounted(pods []v1.Pod, volumeName string) (string, bool) {
+	for _, pod := range pods {
+		mounted := false
+		for _, container := range pod.Spec.Containers {
+			if container.Name != constants.PostgresContainerName {
+				continue
+			}
+			for _, volumeMount := range container.VolumeMounts {
+				if volumeMount.Name == volumeName {
+					mounted = true
+				}
+			}
+		}
+		if !mounted {
+			return pod.Name, false
+		}
 	}
+	return "", true
+}
 
-	pgSyncRequests := c.userSyncStrategy.ProduceSyncRequests(dbUsers, c.pgUsers)
-	if err = c.userSyncStrategy.ExecuteSyncRequests(pgSyncRequests, c.pgDb); err != nil {
-		return fmt.Errorf("error executing sync statements: %v", err)
+func (c *Cluster) syncPreparedDatabases(ctx context.Context) error {
+	c.setProcessName("syncing prepared databases")
+	for preparedDbName, preparedDB := range c.Spec.PreparedDatabases {
+		c.logger.Debugf("syncing prepared database %q", preparedDbName)
+		// the schemas and extensions are created inside the prepared database
+		err := c.withDbConn(preparedDbName, func() error {
+			preparedSchemas := preparedDB.PreparedSchemas
+			if len(preparedDB.PreparedSchemas) == 0 {
+				preparedSchemas = map[string]acidv1.PreparedSchema{"data": {DefaultRoles: util.True()}}
+			}
+			if err := c.syncPreparedSchemas(ctx, preparedDbName, preparedSchemas); err != nil {
+				return err
+			}
+
+			// install extensions
+			return c.syncExtensions(ctx, preparedDB.Extensions)
+		})
+		if err != nil {
+			return fmt.Errorf("could not sync prepared database %q: %v", preparedDbName, err)
+		}
 	}
 
 	return nil
 }
 
-func (c *Cluster) syncDatabases() error {
-	c.setProcessName("syncing databases")
+// syncMonitoringExtension installs pg_stat_statements into the postgres database, where the monitoring role
+// reads the statement statistics of all databases
+func (c *Cluster) syncMonitoringExtension(ctx context.Context) error {
+	if !c.Spec.EnableMonitoringRole {
+		return nil
+	}
+	c.setProcessName("syncing monitoring extension")
 
-	createDatabases := make(map[string]string)
-	alterOwnerDatabases := make(map[string]string)
-	preparedDatabases := make([]string, 0)
+	return c.withDbConn("", func() error {
+		return c.syncExtensions(ctx, map[string]string{constants.MonitoringExtensionName: "public"})
+	})
+}
 
-	if err := c.initDbConn(); err != nil {
-		return fmt.Errorf("could not init database connection")
+// syncAuditExtension installs pgaudit into the postgres database and the databases of the manifest, where it
+// logs the objects of DDL statements. The extension can only be created once Postgres loaded the library, until
+// the scheduled restart it is left to the next sync.
+func (c *Cluster) syncAuditExtension(ctx context.Context) error {
+	if c.Spec.Audit == nil {
+		return nil
 	}
-	defer func() {
-		if err := c.closeDbConn(); err != nil {
-			c.logger.Errorf("could not close database connection: %v", err)
-		}
-	}()
+	c.setProcessName("syncing audit extension")
 
-	currentDatabases, err := c.getDatabases()
+	var libraries []string
+	err := c.withDbConn("", func() error {
+		var err error
+		libraries, err = c.getSharedPreloadLibraries(ctx)
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf("could not get current databases: %v", err)
-	}
-
-	// if no prepared databases are specified create a database named like the cluster
-	if c.Spec.PreparedDatabases != nil && len(c.Spec.PreparedDatabases) == 0 { // TODO: add option to disable creating such a default DB
-		c.Spec.PreparedDatabases = map[string]acidv1.PreparedDatabase{strings.Replace(c.Name, "-", "_", -1): {}}
+		return err
 	}
-	for preparedDatabaseName := range c.Spec.PreparedDatabases {
-		_, exists := currentDatabases[preparedDatabaseName]
-		if !exists {
-			createDatabases[preparedDatabaseName] = preparedDatabaseName + constants.OwnerRoleNameSuffix
-			preparedDatabases = append(preparedDatabases, preparedDatabaseName)
-		}
+	if !util.SliceContains(libraries, auditLibrary) {
+		c.logger.Infof("%s is not loaded by Postgres yet, installing the extension after the restart", auditLibrary)
+		return nil
 	}
 
-	for databaseName, newOwner := range c.Spec.Databases {
-		currentOwner, exists := currentDatabases[databaseName]
-		if !exists {
-			createDatabases[databaseName] = newOwner
-		} else if currentOwner != newOwner {
-			alterOwnerDatabases[databaseName] = newOwner
+	for _, databaseName := range append([]string{""}, c.manifestDatabases()...) {
+		err = c.withDbConn(databaseName, func() error {
+			return c.syncExtensions(ctx, map[string]string{auditLibrary: "public"})
+		})
+		if err != nil {
+			return fmt.Errorf("could not install %s into database %q: %v", auditLibrary, databaseName, err)
 		}
 	}
+	return nil
+}
 
-	if len(createDatabases)+len(alterOwnerDatabases) == 0 {
+// disableAuditLogging turns off the audit log Patroni still has for a cluster without an audit section, unless the
+// parameters of the manifest set it. The library stays loaded and the extension installed, as dropping them would
+// take a restart of Postgres for nothing.
+func (c *Cluster) disableAuditLogging(ctx context.Context) error {
+	if c.Spec.Audit != nil {
+		return nil
+	}
+	if _, ok := c.Spec.Parameters[auditLogParameter]; ok {
+		return nil
+	}
+	if c.leaderDiverged {
+		c.logger.Warning("Patroni cluster diverged, not disabling the audit log")
 		return nil
 	}
 
-	for databaseName, owner := range createDatabases {
-		if err = c.executeCreateDatabase(databaseName, owner); err != nil {
-			return err
-		}
+	pods, err := c.listPods(ctx)
+	if err != nil {
+		return err
 	}
-	for databaseName, owner := range alterOwnerDatabases {
-		if err = c.executeAlterDatabaseOwner(databaseName, owner); err != nil {
-			return err
-		}
+	if len(pods) == 0 {
+		return nil
 	}
 
-	// set default privileges for prepared database
-	for _, preparedDatabase := range preparedDatabases {
-		if err = c.execAlterGlobalDefaultPrivileges(preparedDatabase+constants.OwnerRoleNameSuffix, preparedDatabase); err != nil {
-			return err
-		}
+	currentParameters, err := c.getPostgresParameters(ctx, pods)
+	if err != nil {
+		return err
+	}
+	if value, ok := currentParameters[auditLogParameter]; !ok || value == "none" {
+		return nil
 	}
 
-	return nil
+	c.syncDriftFound("audit log does not match the manifest")
+	options := map[string]string{auditLogParameter: "none"}
+	if err = c.setPostgresParameters(ctx, pods, options); err != nil {
+		return err
+	}
+	return c.applyChangedPostgresParameters(ctx, pods, options)
 }
 
-func (c *Cluster) syncPreparedDatabases() error {
-	c.setProcessName("syncing prepared databases")
-	for preparedDbName, preparedDB := range c.Spec.PreparedDatabases {
-		if err := c.initDbConnWithName(preparedDbName); err != nil {
-			return fmt.Errorf("could not init connection to database %s: %v", preparedDbName, err)
-		}
-
-		c.logger.Debugf("syncing prepared database %q", preparedDbName)
-		// now, prepare defined schemas
-		preparedSchemas := preparedDB.PreparedSchemas
-		if len(preparedDB.PreparedSchemas) == 0 {
-			preparedSchemas = map[string]acidv1.PreparedSchema{"data": {DefaultRoles: util.True()}}
-		}
-		if err := c.syncPreparedSchemas(preparedDbName, preparedSchemas); err != nil {
-			return err
+// manifestDatabases returns the databases of the manifest, including the prepared ones, in a stable order
+func (c *Cluster) manifestDatabases() []string {
+	databases := make([]string, 0, len(c.Spec.Databases)+len(c.Spec.PreparedDatabases))
+	for databaseName := range c.Spec.Databases {
+		databases = append(databases, databaseName)
+	}
+	for preparedDbName := range c.Spec.PreparedDatabases {
+		if _, exists := c.Spec.Databases[preparedDbName]; !exists {
+			databases = append(databases, preparedDbName)
 		}
+	}
+	sort.Strings(databases)
+	return databases
+}
 
-		// install extensions
-		if err := c.syncExtensions(preparedDB.Extensions); err != nil {
-			return err
-		}
+// syncBackupGrants gives the backup role read access to all schemas, tables and sequences of the databases of the
+// manifest. The grants are repeated on every sync, so that added databases and objects become readable as well.
+func (c *Cluster) syncBackupGrants(ctx context.Context) error {
+	if !c.Spec.EnableBackupRole {
+		return nil
+	}
+	c.setProcessName("syncing backup role grants")
 
-		if err := c.closeDbConn(); err != nil {
-			c.logger.Errorf("could not close database connection: %v", err)
+	backupUser := constants.BackupUserName
+	for _, databaseName := range c.manifestDatabases() {
+		err := c.withDbConn(databaseName, func() error {
+			return c.executeGrantBackupPrivileges(ctx, databaseName, backupUser)
+		})
+		if err != nil {
+			return fmt.Errorf("could not grant backup privileges in database %q: %v", databaseName, err)
 		}
 	}
 
 	return nil
 }
 
-func (c *Cluster) syncPreparedSchemas(databaseName string, preparedSchemas map[string]acidv1.PreparedSchema) error {
+func (c *Cluster) syncPreparedSchemas(ctx context.Context, databaseName string, preparedSchemas map[string]acidv1.PreparedSchema) error {
 	c.setProcessName("syncing prepared schemas")
 
-	currentSchemas, err := c.getSchemas()
+	currentSchemas, err := c.getSchemas(ctx)
 	if err != nil {
 		return fmt.Errorf("could not get current schemas: %v", err)
 	}
@@ -684,7 +3608,7 @@ func (c *Cluster) syncPreparedSchemas(databaseName string, preparedSchemas map[s
 			} else {
 				owner = dbOwner
 			}
-			if err = c.executeCreateDatabaseSchema(databaseName, schemaName, dbOwner, owner); err != nil {
+			if err = c.executeCreateDatabaseSchema(ctx, databaseName, schemaName, dbOwner, owner); err != nil {
 				return err
 			}
 		}
@@ -693,13 +3617,13 @@ func (c *Cluster) syncPreparedSchemas(databaseName string, preparedSchemas map[s
 	return nil
 }
 
-func (c *Cluster) syncExtensions(extensions map[string]string) error {
+func (c *Cluster) syncExtensions(ctx context.Context, extensions map[string]string) error {
 	c.setProcessName("syncing database extensions")
 
 	createExtensions := make(map[string]string)
 	alterExtensions := make(map[string]string)
 
-	currentExtensions, err := c.getExtensions()
+	currentExtensions, err := c.getExtensions(ctx)
 	if err != nil {
 		return fmt.Errorf("could not get current database extensions: %v", err)
 	}
@@ -714,12 +3638,12 @@ func (c *Cluster) syncExtensions(extensions map[string]string) error {
 	}
 
 	for extName, schema := range createExtensions {
-		if err = c.executeCreateExtension(extName, schema); err != nil {
+		if err = c.executeCreateExtension(ctx, extName, schema); err != nil {
 			return err
 		}
 	}
 	for extName, schema := range alterExtensions {
-		if err = c.executeAlterExtension(extName, schema); err != nil {
+		if err = c.executeAlterExtension(ctx, extName, schema); err != nil {
 			return err
 		}
 	}
@@ -727,7 +3651,114 @@ func (c *Cluster) syncExtensions(extensions map[string]string) error {
 	return nil
 }
 
-func (c *Cluster) syncLogicalBackupJob() error {
+// syncBackupVerification keeps the cron job restoring the latest backup on the schedule of the manifest and reports
+// the result of the last finished job in the BackupVerified condition
+func (c *Cluster) syncBackupVerification(ctx context.Context) error {
+	c.setProcessName("syncing the backup verification job")
+
+	desiredJob, err := c.generateBackupVerificationJob()
+	if err != nil {
+		return fmt.Errorf("could not generate the desired backup verification job: %v", err)
+	}
+
+	jobName := c.getBackupVerificationJobName()
+	job, err := c.KubeClient.CronJobsGetter.CronJobs(c.Namespace).Get(ctx, jobName, metav1.GetOptions{})
+	if err == nil {
+		if match, reason := sameBackupVerificationJob(job, desiredJob); !match {
+			c.logger.Infof("backup verification job %s is not in the desired state and needs to be updated: %s",
+				jobName, reason)
+			if err = c.patchBackupVerificationJob(ctx, desiredJob); err != nil {
+				return err
+			}
+		}
+	} else if k8sutil.ResourceNotFound(err) {
+		if _, err = c.KubeClient.CronJobsGetter.CronJobs(c.Namespace).Create(ctx, desiredJob, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("could not create backup verification job: %v", err)
+		}
+		c.logger.Infof("created backup verification job %s", jobName)
+	} else {
+		return fmt.Errorf("could not get backup verification job: %v", err)
+	}
+
+	return c.reportBackupVerification(ctx)
+}
+
+// sameBackupVerificationJob compares the schedule, the image and the environment with the query of the jobs
+func sameBackupVerificationJob(cur, new *batchv1beta1.CronJob) (bool, string) {
+	if match, reason := k8sutil.SameLogicalBackupJob(cur, new); !match {
+		return false, reason
+	}
+	curContainers := cur.Spec.JobTemplate.Spec.Template.Spec.Containers
+	newContainers := new.Spec.JobTemplate.Spec.Template.Spec.Containers
+	if len(curContainers) == 0 || len(newContainers) == 0 {
+		return len(curContainers) == len(newContainers), "new job's containers do not match the current ones"
+	}
+	if !reflect.DeepEqual(curContainers[0].Env, newContainers[0].Env) {
+		return false, "new job's environment does not match the current one"
+	}
+	return true, ""
+}
+
+// reportBackupVerification sets the BackupVerified condition from the last finished backup verification job, the
+// result of every new job is announced with an event
+func (c *Cluster) reportBackupVerification(ctx context.Context) error {
+	jobs, err := c.KubeClient.JobsGetter.Jobs(c.Namespace).List(ctx,
+		metav1.ListOptions{LabelSelector: c.backupVerificationLabels().String()})
+	if err != nil {
+		return fmt.Errorf("could not list backup verification jobs: %v", err)
+	}
+
+	var (
+		lastJob    *batchv1.Job
+		lastResult batchv1.JobCondition
+	)
+	for i, job := range jobs.Items {
+		for _, jobCondition := range job.Status.Conditions {
+			if jobCondition.Status != v1.ConditionTrue ||
+				(jobCondition.Type != batchv1.JobComplete && jobCondition.Type != batchv1.JobFailed) {
+				continue
+			}
+			if lastJob == nil || lastJob.CreationTimestamp.Before(&job.CreationTimestamp) {
+				lastJob = &jobs.Items[i]
+				lastResult = jobCondition
+			}
+		}
+	}
+	if lastJob == nil {
+		return nil
+	}
+
+	condition := acidv1.ClusterCondition{
+		Type:    acidv1.ClusterConditionBackupVerified,
+		Status:  v1.ConditionTrue,
+		Reason:  acidv1.ClusterConditionReasonBackupRestored,
+		Message: fmt.Sprintf("job %s restored the latest backup", lastJob.Name),
+	}
+	if lastResult.Type == batchv1.JobFailed {
+		condition.Status = v1.ConditionFalse
+		condition.Reason = acidv1.ClusterConditionReasonBackupNotRestored
+		condition.Message = fmt.Sprintf("job %s could not restore the latest backup: %s", lastJob.Name, lastResult.Message)
+	}
+	for _, current := range c.Status.Conditions {
+		if current.Type == condition.Type && current.Message == condition.Message {
+			return nil
+		}
+	}
+
+	if err = c.setCondition(condition); err != nil {
+		return err
+	}
+	if condition.Status == v1.ConditionTrue {
+		c.eventRecorder.Event(c.GetReference(), v1.EventTypeNormal, "BackupVerification", condition.Message)
+	} else {
+		c.logger.Warningf("backup verification failed: %s", condition.Message)
+		c.eventRecorder.Event(c.GetReference(), v1.EventTypeWarning, "BackupVerification", condition.Message)
+	}
+
+	return nil
+}
+
+func (c *Cluster) syncLogicalBackupJob(ctx context.Context) error {
 	var (
 		job        *batchv1beta1.CronJob
 		desiredJob *batchv1beta1.CronJob
@@ -738,7 +3769,7 @@ func (c *Cluster) syncLogicalBackupJob() error {
 	// sync the job if it exists
 
 	jobName := c.getLogicalBackupJobName()
-	if job, err = c.KubeClient.CronJobsGetter.CronJobs(c.Namespace).Get(context.TODO(), jobName, metav1.GetOptions{}); err == nil {
+	if job, err = c.KubeClient.CronJobsGetter.CronJobs(c.Namespace).Get(ctx, jobName, metav1.GetOptions{}); err == nil {
 
 		desiredJob, err = c.generateLogicalBackupJob()
 		if err != nil {
@@ -751,7 +3782,7 @@ func (c *Cluster) syncLogicalBackupJob() error {
 			if reason != "" {
 				c.logger.Infof("reason: %s", reason)
 			}
-			if err = c.patchLogicalBackupJob(desiredJob); err != nil {
+			if err = c.patchLogicalBackupJob(ctx, desiredJob); err != nil {
 				return fmt.Errorf("could not update logical backup job to match desired state: %v", err)
 			}
 			c.logger.Info("the logical backup job is synced")
@@ -765,14 +3796,14 @@ func (c *Cluster) syncLogicalBackupJob() error {
 	// no existing logical backup job, create new one
 	c.logger.Info("could not find the cluster's logical backup job")
 
-	if err = c.createLogicalBackupJob(); err == nil {
+	if err = c.createLogicalBackupJob(ctx); err == nil {
 		c.logger.Infof("created missing logical backup job %s", jobName)
 	} else {
 		if !k8sutil.ResourceAlreadyExists(err) {
 			return fmt.Errorf("could not create missing logical backup job: %v", err)
 		}
 		c.logger.Infof("logical backup job %s already exists", jobName)
-		if _, err = c.KubeClient.CronJobsGetter.CronJobs(c.Namespace).Get(context.TODO(), jobName, metav1.GetOptions{}); err != nil {
+		if _, err = c.KubeClient.CronJobsGetter.CronJobs(c.Namespace).Get(ctx, jobName, metav1.GetOptions{}); err != nil {
 			return fmt.Errorf("could not fetch existing logical backup job: %v", err)
 		}
 	}
@@ -0,0 +1,4169 @@
+package cluster
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"database/sql"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	acidv1 "github.com/zalando/postgres-operator/pkg/apis/acid.zalan.do/v1"
+	fakeacidv1 "github.com/zalando/postgres-operator/pkg/generated/clientset/versioned/fake"
+	"github.com/zalando/postgres-operator/pkg/spec"
+	"github.com/zalando/postgres-operator/pkg/util"
+	"github.com/zalando/postgres-operator/pkg/util/config"
+	"github.com/zalando/postgres-operator/pkg/util/constants"
+	"github.com/zalando/postgres-operator/pkg/util/k8sutil"
+	"github.com/zalando/postgres-operator/pkg/util/patroni"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8sFake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+)
+
+func newFakeK8sSecretsClient() (k8sutil.KubernetesClient, *k8sFake.Clientset) {
+	clientSet := k8sFake.NewSimpleClientset()
+
+	return k8sutil.KubernetesClient{
+		SecretsGetter: clientSet.CoreV1(),
+	}, clientSet
+}
+
+func secretNames(t *testing.T, client k8sutil.KubernetesClient, namespace string) []string {
+	secrets, err := client.Secrets(namespace).List(context.TODO(), metav1.ListOptions{})
+	assert.NoError(t, err)
+
+	names := make([]string, 0, len(secrets.Items))
+	for _, secret := range secrets.Items {
+		names = append(names, secret.Name)
+	}
+	return names
+}
+
+func TestSyncSecretsOrphaned(t *testing.T) {
+	client, _ := newFakeK8sSecretsClient()
+	clusterName := "acid-test-cluster"
+	namespace := "default"
+
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterName,
+			Namespace: namespace,
+		},
+	}
+
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				Auth: config.Auth{
+					SecretNameTemplate:  "{username}.{cluster}.credentials.{tprkind}.{tprgroup}",
+					SuperUsername:       superUserName,
+					ReplicationUsername: replicationUserName,
+				},
+				Resources: config.Resources{
+					ClusterLabels:    map[string]string{"application": "spilo"},
+					ClusterNameLabel: "cluster-name",
+				},
+			},
+			InfrastructureRoles: map[string]spec.PgUser{
+				"robot_zmon": {Origin: spec.RoleOriginInfrastructure, Name: "robot_zmon", Password: "zmon"},
+			},
+		}, client, pg, logger, eventRecorder)
+
+	cluster.systemUsers = map[string]spec.PgUser{
+		constants.SuperuserKeyName:       {Origin: spec.RoleOriginSystem, Name: superUserName, Password: "secret"},
+		constants.ReplicationUserKeyName: {Origin: spec.RoleOriginSystem, Name: replicationUserName, Password: "secret"},
+	}
+	cluster.pgUsers = map[string]spec.PgUser{
+		"foo":        {Origin: spec.RoleOriginManifest, Name: "foo", Password: "foo"},
+		"robot_zmon": {Origin: spec.RoleOriginInfrastructure, Name: "robot_zmon", Password: "zmon"},
+	}
+
+	err := cluster.syncSecrets(context.TODO())
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		cluster.credentialSecretName(superUserName),
+		cluster.credentialSecretName(replicationUserName),
+		cluster.credentialSecretName("foo"),
+		cluster.credentialSecretName("robot_zmon"),
+	}, secretNames(t, client, namespace))
+
+	// secrets not matching the operator's naming scheme or annotated to be kept must survive
+	for _, secret := range []*v1.Secret{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "tls-secret",
+				Namespace: namespace,
+				Labels:    cluster.labelsSet(false),
+			},
+			Data: map[string][]byte{"tls.crt": []byte("cert")},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        cluster.credentialSecretName("manual"),
+				Namespace:   namespace,
+				Labels:      cluster.labelsSet(false),
+				Annotations: map[string]string{constants.KeepSecretAnnotationKey: "true"},
+			},
+			Data: map[string][]byte{"username": []byte("manual"), "password": []byte("manual")},
+		},
+	} {
+		_, err = client.Secrets(namespace).Create(context.TODO(), secret, metav1.CreateOptions{})
+		assert.NoError(t, err)
+	}
+
+	// add a user
+	cluster.pgUsers["bar"] = spec.PgUser{Origin: spec.RoleOriginManifest, Name: "bar", Password: "bar"}
+	err = cluster.syncSecrets(context.TODO())
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		cluster.credentialSecretName(superUserName),
+		cluster.credentialSecretName(replicationUserName),
+		cluster.credentialSecretName("foo"),
+		cluster.credentialSecretName("bar"),
+		cluster.credentialSecretName("robot_zmon"),
+		cluster.credentialSecretName("manual"),
+		"tls-secret",
+	}, secretNames(t, client, namespace))
+
+	// remove a user, the secret of the infrastructure role is never deleted
+	delete(cluster.pgUsers, "foo")
+	delete(cluster.pgUsers, "robot_zmon")
+	err = cluster.syncSecrets(context.TODO())
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		cluster.credentialSecretName(superUserName),
+		cluster.credentialSecretName(replicationUserName),
+		cluster.credentialSecretName("bar"),
+		cluster.credentialSecretName("robot_zmon"),
+		cluster.credentialSecretName("manual"),
+		"tls-secret",
+	}, secretNames(t, client, namespace))
+}
+
+func TestSyncSecretsPartialFailure(t *testing.T) {
+	client, clientSet := newFakeK8sSecretsClient()
+	namespace := "default"
+
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "acid-test-cluster",
+			Namespace: namespace,
+		},
+	}
+
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				Auth: config.Auth{
+					SecretNameTemplate:  "{username}.{cluster}.credentials.{tprkind}.{tprgroup}",
+					SuperUsername:       superUserName,
+					ReplicationUsername: replicationUserName,
+				},
+				Resources: config.Resources{
+					ClusterLabels:    map[string]string{"application": "spilo"},
+					ClusterNameLabel: "cluster-name",
+				},
+			},
+		}, client, pg, logger, eventRecorder)
+
+	cluster.systemUsers = map[string]spec.PgUser{
+		constants.SuperuserKeyName:       {Origin: spec.RoleOriginSystem, Name: superUserName, Password: "secret"},
+		constants.ReplicationUserKeyName: {Origin: spec.RoleOriginSystem, Name: replicationUserName, Password: "secret"},
+	}
+	cluster.pgUsers = map[string]spec.PgUser{
+		"bar": {Origin: spec.RoleOriginManifest, Name: "bar", Password: "bar"},
+		"foo": {Origin: spec.RoleOriginManifest, Name: "foo", Password: "foo"},
+		"zoo": {Origin: spec.RoleOriginManifest, Name: "zoo", Password: "zoo"},
+	}
+
+	failingSecret := cluster.credentialSecretName("foo")
+	failing := true
+	clientSet.PrependReactor("create", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		secret := action.(k8stesting.CreateAction).GetObject().(*v1.Secret)
+		if failing && secret.Name == failingSecret {
+			return true, nil, fmt.Errorf("quota exceeded")
+		}
+		return false, nil, nil
+	})
+
+	// the failing secret does not block the others
+	err := cluster.syncSecrets(context.TODO())
+	assert.EqualError(t, err, `could not sync all secrets: could not create secret for user "foo": quota exceeded`)
+	assert.ElementsMatch(t, []string{
+		cluster.credentialSecretName(superUserName),
+		cluster.credentialSecretName(replicationUserName),
+		cluster.credentialSecretName("bar"),
+		cluster.credentialSecretName("zoo"),
+	}, secretNames(t, client, namespace))
+
+	// the next sync creates the missing secret and keeps the existing ones
+	failing = false
+	err = cluster.syncSecrets(context.TODO())
+	assert.NoError(t, err)
+	assert.Contains(t, secretNames(t, client, namespace), failingSecret)
+}
+
+func TestSyncExternalSecrets(t *testing.T) {
+	client, _ := newFakeK8sSecretsClient()
+	namespace := "default"
+
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "acid-test-cluster",
+			Namespace: namespace,
+		},
+		Spec: acidv1.PostgresSpec{
+			TeamID: "acid",
+			Users: map[string]acidv1.UserFlags{
+				"app":   {},
+				"other": {},
+			},
+			ExternalSecrets: map[string]acidv1.ExternalSecret{
+				"app": {SecretName: "app-db-password", PasswordKey: "db-password"},
+			},
+		},
+	}
+
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				Auth: config.Auth{
+					SecretNameTemplate:  "{username}.{cluster}.credentials.{tprkind}.{tprgroup}",
+					SuperUsername:       superUserName,
+					ReplicationUsername: replicationUserName,
+				},
+				Resources: config.Resources{
+					ClusterLabels:    map[string]string{"application": "spilo"},
+					ClusterNameLabel: "cluster-name",
+				},
+			},
+		}, client, pg, logger, eventRecorder)
+
+	err := cluster.initUsers()
+	assert.NoError(t, err)
+	assert.Empty(t, cluster.pgUsers["app"].Password, "no password is generated for a user with an external secret")
+
+	// a missing external secret fails the sync instead of falling back to a generated password
+	err = cluster.syncSecrets(context.TODO())
+	assert.EqualError(t, err, `could not sync all secrets: external secret "app-db-password" of user "app" does not exist`)
+	assert.Empty(t, cluster.pgUsers["app"].Password)
+	assert.NotContains(t, secretNames(t, client, namespace), cluster.credentialSecretName("app"))
+
+	_, err = client.Secrets(namespace).Create(context.TODO(), &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app-db-password",
+			Namespace: namespace,
+		},
+		Data: map[string][]byte{"db-password": []byte("external")},
+	}, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	err = cluster.syncSecrets(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, "external", cluster.pgUsers["app"].Password)
+	assert.ElementsMatch(t, []string{
+		cluster.credentialSecretName(superUserName),
+		cluster.credentialSecretName(replicationUserName),
+		cluster.credentialSecretName("other"),
+		"app-db-password",
+	}, secretNames(t, client, namespace))
+}
+
+func TestSyncMasterNodePortService(t *testing.T) {
+	clientSet := k8sFake.NewSimpleClientset()
+	client := k8sutil.KubernetesClient{
+		ServicesGetter: clientSet.CoreV1(),
+	}
+	clusterName := "acid-test-cluster"
+	namespace := "default"
+	enableNodePort := true
+	nodePort := int32(30432)
+
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterName,
+			Namespace: namespace,
+		},
+		Spec: acidv1.PostgresSpec{
+			EnableMasterNodePort: &enableNodePort,
+			MasterNodePort:       &nodePort,
+		},
+	}
+
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				Resources: config.Resources{
+					ClusterLabels:    map[string]string{"application": "spilo"},
+					ClusterNameLabel: "cluster-name",
+				},
+			},
+		}, client, pg, logger, eventRecorder)
+
+	err := cluster.syncService(context.TODO(), Master)
+	assert.NoError(t, err)
+
+	svc, err := client.Services(namespace).Get(context.TODO(), cluster.serviceName(Master), metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, v1.ServiceTypeNodePort, svc.Spec.Type)
+	assert.Equal(t, nodePort, svc.Spec.Ports[0].NodePort)
+
+	// the second sync finds the service in the desired state
+	err = cluster.syncService(context.TODO(), Master)
+	assert.NoError(t, err)
+
+	// a node port rejected by the API server is reported with the reason
+	err = client.Services(namespace).Delete(context.TODO(), cluster.serviceName(Master), metav1.DeleteOptions{})
+	assert.NoError(t, err)
+	clientSet.PrependReactor("create", "services", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewInvalid(
+			schema.GroupKind{Kind: "Service"},
+			cluster.serviceName(Master),
+			field.ErrorList{field.Invalid(field.NewPath("spec", "ports").Index(0).Child("nodePort"), nodePort, "provided port is already allocated")})
+	})
+
+	err = cluster.syncService(context.TODO(), Master)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "could not use node port 30432 for the master service")
+	assert.Contains(t, err.Error(), "provided port is already allocated")
+}
+
+func TestSyncMetricsExporterService(t *testing.T) {
+	clientSet := k8sFake.NewSimpleClientset()
+	client := k8sutil.KubernetesClient{
+		ServicesGetter: clientSet.CoreV1(),
+	}
+	namespace := "default"
+
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "acid-test-cluster",
+			Namespace: namespace,
+		},
+		Spec: acidv1.PostgresSpec{
+			MetricsExporter: &acidv1.MetricsExporter{Sidecar: "exporter", Port: 9187},
+		},
+	}
+
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				Resources: config.Resources{
+					ClusterLabels:    map[string]string{"application": "spilo"},
+					ClusterNameLabel: "cluster-name",
+					PodRoleLabel:     "spilo-role",
+				},
+			},
+		}, client, pg, logger, eventRecorder)
+
+	metricsPort := func() *v1.ServicePort {
+		svc, err := client.Services(namespace).Get(context.TODO(), cluster.serviceName(Replica), metav1.GetOptions{})
+		assert.NoError(t, err)
+		for i, port := range svc.Spec.Ports {
+			if port.Name == metricsPortName {
+				return &svc.Spec.Ports[i]
+			}
+		}
+		return nil
+	}
+
+	// the replica service selects the pods, so the metrics port is exposed on it
+	err := cluster.syncService(context.TODO(), Replica)
+	assert.NoError(t, err)
+	port := metricsPort()
+	if assert.NotNil(t, port) {
+		assert.Equal(t, int32(9187), port.Port)
+		assert.Equal(t, int32(9187), port.TargetPort.IntVal)
+	}
+
+	// a changed port is reconciled
+	cluster.Spec.MetricsExporter.Port = 9100
+	err = cluster.syncService(context.TODO(), Replica)
+	assert.NoError(t, err)
+	port = metricsPort()
+	if assert.NotNil(t, port) {
+		assert.Equal(t, int32(9100), port.Port)
+	}
+
+	// removing the exporter removes the port
+	cluster.Spec.MetricsExporter = nil
+	err = cluster.syncService(context.TODO(), Replica)
+	assert.NoError(t, err)
+	assert.Nil(t, metricsPort())
+}
+
+func TestSyncReplicaServiceExternalTrafficPolicy(t *testing.T) {
+	clientSet := k8sFake.NewSimpleClientset()
+	client := k8sutil.KubernetesClient{
+		ServicesGetter: clientSet.CoreV1(),
+	}
+	namespace := "default"
+
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "acid-test-cluster",
+			Namespace: namespace,
+		},
+		Spec: acidv1.PostgresSpec{
+			EnableReplicaLoadBalancer: util.True(),
+		},
+	}
+
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				ExternalTrafficPolicy: "Cluster",
+				Resources: config.Resources{
+					ClusterLabels:    map[string]string{"application": "spilo"},
+					ClusterNameLabel: "cluster-name",
+					PodRoleLabel:     "spilo-role",
+				},
+			},
+		}, client, pg, logger, eventRecorder)
+
+	policy := func() v1.ServiceExternalTrafficPolicyType {
+		svc, err := client.Services(namespace).Get(context.TODO(), cluster.serviceName(Replica), metav1.GetOptions{})
+		assert.NoError(t, err)
+		return svc.Spec.ExternalTrafficPolicy
+	}
+
+	err := cluster.syncService(context.TODO(), Replica)
+	assert.NoError(t, err)
+	assert.Equal(t, v1.ServiceExternalTrafficPolicyTypeCluster, policy())
+
+	// the manifest takes precedence over the configuration, the running service is updated
+	for _, expected := range []v1.ServiceExternalTrafficPolicyType{
+		v1.ServiceExternalTrafficPolicyTypeLocal, v1.ServiceExternalTrafficPolicyTypeCluster} {
+		cluster.Spec.ReplicaExternalTrafficPolicy = string(expected)
+		clientSet.ClearActions()
+		err = cluster.syncService(context.TODO(), Replica)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, policy())
+
+		updated := false
+		for _, action := range clientSet.Actions() {
+			if action.GetResource().Resource == "services" && (action.GetVerb() == "patch" || action.GetVerb() == "update") {
+				updated = true
+			}
+		}
+		assert.True(t, updated, "the service is updated for the policy %q", expected)
+	}
+}
+
+func TestSyncMasterDNSNameAnnotation(t *testing.T) {
+	clientSet := k8sFake.NewSimpleClientset()
+	client := k8sutil.KubernetesClient{
+		ServicesGetter: clientSet.CoreV1(),
+	}
+	namespace := "default"
+
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "acid-test-cluster",
+			Namespace: namespace,
+		},
+		Spec: acidv1.PostgresSpec{
+			ClusterName:         "test-cluster",
+			TeamID:              "acid",
+			MasterDNSNameFormat: "{cluster}.{team}.db.example.com",
+		},
+	}
+
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				Resources: config.Resources{
+					ClusterLabels:    map[string]string{"application": "spilo"},
+					ClusterNameLabel: "cluster-name",
+					PodRoleLabel:     "spilo-role",
+				},
+			},
+		}, client, pg, logger, eventRecorder)
+
+	dnsName := func() (string, bool) {
+		svc, err := client.Services(namespace).Get(context.TODO(), cluster.serviceName(Master), metav1.GetOptions{})
+		assert.NoError(t, err)
+		name, ok := svc.Annotations[constants.ZalandoDNSNameAnnotation]
+		return name, ok
+	}
+
+	err := cluster.syncService(context.TODO(), Master)
+	assert.NoError(t, err)
+	name, _ := dnsName()
+	assert.Equal(t, "test-cluster.acid.db.example.com", name)
+
+	// a changed template is detected as drift and updates the annotation
+	cluster.Spec.MasterDNSNameFormat = "{cluster}-primary.{team}.db.example.com"
+	err = cluster.syncService(context.TODO(), Master)
+	assert.NoError(t, err)
+	name, _ = dnsName()
+	assert.Equal(t, "test-cluster-primary.acid.db.example.com", name)
+
+	// without a template the annotation is removed
+	cluster.Spec.MasterDNSNameFormat = ""
+	err = cluster.syncService(context.TODO(), Master)
+	assert.NoError(t, err)
+	_, ok := dnsName()
+	assert.False(t, ok)
+}
+
+func TestSyncPodServices(t *testing.T) {
+	clientSet := k8sFake.NewSimpleClientset()
+	client := k8sutil.KubernetesClient{
+		ServicesGetter: clientSet.CoreV1(),
+	}
+	clusterName := "acid-test-cluster"
+	namespace := "default"
+
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterName,
+			Namespace: namespace,
+		},
+		Spec: acidv1.PostgresSpec{
+			EnablePodServices: true,
+			NumberOfInstances: 2,
+		},
+	}
+
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				Resources: config.Resources{
+					ClusterLabels:    map[string]string{"application": "spilo"},
+					ClusterNameLabel: "cluster-name",
+					PodRoleLabel:     "spilo-role",
+					MinInstances:     -1,
+					MaxInstances:     -1,
+				},
+			},
+		}, client, pg, logger, eventRecorder)
+
+	serviceNames := func() []string {
+		services, err := client.Services(namespace).List(context.TODO(), metav1.ListOptions{})
+		assert.NoError(t, err)
+		names := make([]string, 0, len(services.Items))
+		for _, service := range services.Items {
+			names = append(names, service.Name)
+		}
+		return names
+	}
+
+	// the replica service of the cluster is never taken for a pod service
+	err := cluster.syncService(context.TODO(), Replica)
+	assert.NoError(t, err)
+
+	err = cluster.syncPodServices(context.TODO())
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{clusterName + "-repl", clusterName + "-0", clusterName + "-1"}, serviceNames())
+
+	svc, err := client.Services(namespace).Get(context.TODO(), clusterName+"-1", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, v1.ServiceTypeClusterIP, svc.Spec.Type)
+	assert.Equal(t, clusterName+"-1", svc.Spec.Selector[appsv1.StatefulSetPodNameLabel])
+	assert.Equal(t, clusterName, svc.Spec.Selector["cluster-name"])
+
+	// scale up
+	cluster.Spec.NumberOfInstances = 3
+	err = cluster.syncPodServices(context.TODO())
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{clusterName + "-repl", clusterName + "-0", clusterName + "-1", clusterName + "-2"},
+		serviceNames())
+
+	// scale down removes the services of the removed pods
+	cluster.Spec.NumberOfInstances = 1
+	err = cluster.syncPodServices(context.TODO())
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{clusterName + "-repl", clusterName + "-0"}, serviceNames())
+
+	// a drifted service is repaired, annotations added by others are kept
+	svc, err = client.Services(namespace).Get(context.TODO(), clusterName+"-0", metav1.GetOptions{})
+	assert.NoError(t, err)
+	svc.Labels = map[string]string{"foo": "bar"}
+	svc.Annotations = map[string]string{"cloud.example.com/load-balancer": "internal"}
+	_, err = client.Services(namespace).Update(context.TODO(), svc, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+	err = cluster.syncPodServices(context.TODO())
+	assert.NoError(t, err)
+	svc, err = client.Services(namespace).Get(context.TODO(), clusterName+"-0", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, clusterName, svc.Labels["cluster-name"])
+	assert.Equal(t, "internal", svc.Annotations["cloud.example.com/load-balancer"])
+
+	// disabling removes all of them
+	cluster.Spec.EnablePodServices = false
+	err = cluster.syncPodServices(context.TODO())
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{clusterName + "-repl"}, serviceNames())
+}
+
+func TestSyncReplicaServices(t *testing.T) {
+	clientSet := k8sFake.NewSimpleClientset()
+	client := k8sutil.KubernetesClient{
+		PodsGetter:     clientSet.CoreV1(),
+		ServicesGetter: clientSet.CoreV1(),
+	}
+	clusterName := "acid-test-cluster"
+	namespace := "default"
+
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterName,
+			Namespace: namespace,
+		},
+		Spec: acidv1.PostgresSpec{
+			NumberOfInstances: 3,
+			ReplicaServices: []acidv1.ReplicaService{
+				{Name: "sync", Members: "sync"},
+				{Name: "async", Members: "async"},
+			},
+		},
+	}
+
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				Resources: config.Resources{
+					ClusterLabels:    map[string]string{"application": "spilo"},
+					ClusterNameLabel: "cluster-name",
+					PodRoleLabel:     "spilo-role",
+				},
+			},
+		}, client, pg, logger, eventRecorder)
+
+	for i, role := range []PostgresRole{Master, Replica, Replica} {
+		pod := v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("%s-%d", clusterName, i),
+				Namespace: namespace,
+				Labels:    map[string]string{"application": "spilo", "cluster-name": clusterName, "spilo-role": string(role)},
+			},
+		}
+		_, err := clientSet.CoreV1().Pods(namespace).Create(context.TODO(), &pod, metav1.CreateOptions{})
+		assert.NoError(t, err)
+	}
+
+	mockClient := &mockPatroni{
+		members: []patroni.ClusterMember{
+			{Name: "acid-test-cluster-0", Role: "leader", State: "running"},
+			{Name: "acid-test-cluster-1", Role: "sync_standby", State: "running"},
+			{Name: "acid-test-cluster-2", Role: "replica", State: "running"},
+		},
+	}
+	cluster.patroni = mockClient
+
+	syncStandbyLabels := func() map[string]string {
+		labels := make(map[string]string)
+		pods, err := clientSet.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{})
+		assert.NoError(t, err)
+		for _, pod := range pods.Items {
+			if value, ok := pod.Labels[constants.SyncStandbyLabelKey]; ok {
+				labels[pod.Name] = value
+			}
+		}
+		return labels
+	}
+
+	err := cluster.syncReplicaServices(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"acid-test-cluster-0": "false",
+		"acid-test-cluster-1": "true",
+		"acid-test-cluster-2": "false",
+	}, syncStandbyLabels())
+
+	svc, err := client.Services(namespace).Get(context.TODO(), clusterName+"-repl-sync", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "replica", svc.Spec.Selector["spilo-role"])
+	assert.Equal(t, "true", svc.Spec.Selector[constants.SyncStandbyLabelKey])
+	svc, err = client.Services(namespace).Get(context.TODO(), clusterName+"-repl-async", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "false", svc.Spec.Selector[constants.SyncStandbyLabelKey])
+
+	// the labels follow the synchronous standby chosen by Patroni
+	mockClient.members[1].Role = "replica"
+	mockClient.members[2].Role = "sync_standby"
+	err = cluster.syncReplicaServices(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"acid-test-cluster-0": "false",
+		"acid-test-cluster-1": "false",
+		"acid-test-cluster-2": "true",
+	}, syncStandbyLabels())
+
+	// the labels are kept while the Patroni API cannot be reached
+	mockClient.membersErr = fmt.Errorf("connection refused")
+	err = cluster.syncReplicaServices(context.TODO())
+	assert.Error(t, err)
+	assert.Equal(t, "true", syncStandbyLabels()["acid-test-cluster-2"])
+	mockClient.membersErr = nil
+
+	// a recreated pod starting without the label gets it on the pod events between two syncs
+	err = clientSet.CoreV1().Pods(namespace).Delete(context.TODO(), "acid-test-cluster-1", metav1.DeleteOptions{})
+	assert.NoError(t, err)
+	_, err = clientSet.CoreV1().Pods(namespace).Create(context.TODO(), &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "acid-test-cluster-1",
+			Namespace: namespace,
+			Labels:    map[string]string{"application": "spilo", "cluster-name": clusterName, "spilo-role": string(Replica)},
+		},
+	}, metav1.CreateOptions{})
+	assert.NoError(t, err)
+	cluster.refreshPodRoles(&cluster.Spec)
+	assert.Equal(t, "false", syncStandbyLabels()["acid-test-cluster-1"])
+
+	// services removed from the manifest are deleted, the labels once no service is left
+	cluster.Spec.ReplicaServices = cluster.Spec.ReplicaServices[:1]
+	err = cluster.syncReplicaServices(context.TODO())
+	assert.NoError(t, err)
+	_, err = client.Services(namespace).Get(context.TODO(), clusterName+"-repl-async", metav1.GetOptions{})
+	assert.True(t, k8sutil.ResourceNotFound(err))
+
+	cluster.Spec.ReplicaServices = nil
+	err = cluster.syncReplicaServices(context.TODO())
+	assert.NoError(t, err)
+	_, err = client.Services(namespace).Get(context.TODO(), clusterName+"-repl-sync", metav1.GetOptions{})
+	assert.True(t, k8sutil.ResourceNotFound(err))
+	assert.Empty(t, syncStandbyLabels())
+}
+
+func TestSyncReplicaServiceDisabled(t *testing.T) {
+	clientSet := k8sFake.NewSimpleClientset()
+	client := k8sutil.KubernetesClient{
+		PodsGetter:      clientSet.CoreV1(),
+		ServicesGetter:  clientSet.CoreV1(),
+		EndpointsGetter: clientSet.CoreV1(),
+	}
+	namespace := "default"
+
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "acid-test-cluster",
+			Namespace: namespace,
+		},
+	}
+
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				Resources: config.Resources{
+					ClusterLabels:    map[string]string{"application": "spilo"},
+					ClusterNameLabel: "cluster-name",
+				},
+			},
+		}, client, pg, logger, eventRecorder)
+
+	err := cluster.syncServices(context.TODO())
+	assert.NoError(t, err)
+	_, err = client.Services(namespace).Get(context.TODO(), cluster.serviceName(Replica), metav1.GetOptions{})
+	assert.NoError(t, err)
+	_, err = client.Endpoints(namespace).Get(context.TODO(), cluster.endpointName(Replica), metav1.GetOptions{})
+	assert.NoError(t, err)
+
+	// switching the replica service off removes the existing service and endpoint
+	enableReplicaService := false
+	cluster.Spec.EnableReplicaService = &enableReplicaService
+	err = cluster.syncServices(context.TODO())
+	assert.NoError(t, err)
+
+	_, err = client.Services(namespace).Get(context.TODO(), cluster.serviceName(Replica), metav1.GetOptions{})
+	assert.True(t, k8sutil.ResourceNotFound(err))
+	_, err = client.Endpoints(namespace).Get(context.TODO(), cluster.endpointName(Replica), metav1.GetOptions{})
+	assert.True(t, k8sutil.ResourceNotFound(err))
+	assert.Nil(t, cluster.GetServiceReplica())
+	assert.Nil(t, cluster.GetEndpointReplica())
+	_, err = client.Services(namespace).Get(context.TODO(), cluster.serviceName(Master), metav1.GetOptions{})
+	assert.NoError(t, err)
+
+	// absent replica objects are no error
+	err = cluster.syncServices(context.TODO())
+	assert.NoError(t, err)
+
+	// switching it back on recreates them
+	enableReplicaService = true
+	err = cluster.syncServices(context.TODO())
+	assert.NoError(t, err)
+	_, err = client.Services(namespace).Get(context.TODO(), cluster.serviceName(Replica), metav1.GetOptions{})
+	assert.NoError(t, err)
+}
+
+func TestSyncLoadBalancerStatus(t *testing.T) {
+	clientSet := k8sFake.NewSimpleClientset()
+	acidClientSet := fakeacidv1.NewSimpleClientset()
+	client := k8sutil.KubernetesClient{
+		ServicesGetter:    clientSet.CoreV1(),
+		EndpointsGetter:   clientSet.CoreV1(),
+		PostgresqlsGetter: acidClientSet.AcidV1(),
+	}
+	clusterName := "acid-test-cluster"
+	namespace := "default"
+
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterName,
+			Namespace: namespace,
+		},
+		Spec: acidv1.PostgresSpec{
+			ClusterName:              "test-cluster",
+			TeamID:                   "acid",
+			EnableMasterLoadBalancer: util.True(),
+		},
+	}
+	_, err := acidClientSet.AcidV1().Postgresqls(namespace).Create(context.TODO(), &pg, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				Resources: config.Resources{
+					ClusterLabels:    map[string]string{"application": "spilo"},
+					ClusterNameLabel: "cluster-name",
+				},
+				MasterDNSNameFormat: "{cluster}.{team}.{hostedzone}",
+				DbHostedZone:        "db.example.com",
+			},
+		}, client, pg, logger, eventRecorder)
+
+	loadBalancers := func() []acidv1.LoadBalancerStatus {
+		updated, err := acidClientSet.AcidV1().Postgresqls(namespace).Get(context.TODO(), clusterName, metav1.GetOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, cluster.Status.LoadBalancers, updated.Status.LoadBalancers)
+		return updated.Status.LoadBalancers
+	}
+
+	// a new load balancer is provisioning until the cloud provider assigns an ingress point
+	err = cluster.syncServices(context.TODO())
+	assert.NoError(t, err)
+	dnsName := cluster.masterDNSName(&cluster.Spec)
+	assert.Equal(t, []acidv1.LoadBalancerStatus{
+		{Role: "master", State: acidv1.LoadBalancerStateProvisioning, DNSName: dnsName},
+	}, loadBalancers())
+
+	svc, err := clientSet.CoreV1().Services(namespace).Get(context.TODO(), cluster.serviceName(Master), metav1.GetOptions{})
+	assert.NoError(t, err)
+	svc.Status.LoadBalancer.Ingress = []v1.LoadBalancerIngress{{Hostname: "elb-1.eu-central-1.elb.amazonaws.com"}, {IP: "10.0.0.1"}}
+	_, err = clientSet.CoreV1().Services(namespace).UpdateStatus(context.TODO(), svc, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+
+	err = cluster.syncServices(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, []acidv1.LoadBalancerStatus{
+		{Role: "master", State: acidv1.LoadBalancerStateReady, DNSName: dnsName,
+			Addresses: []string{"elb-1.eu-central-1.elb.amazonaws.com", "10.0.0.1"}},
+	}, loadBalancers())
+
+	// services without a load balancer are not reported
+	cluster.Spec.EnableMasterLoadBalancer = util.False()
+	err = cluster.syncServices(context.TODO())
+	assert.NoError(t, err)
+	assert.Empty(t, loadBalancers())
+}
+
+func TestSyncForeignObjects(t *testing.T) {
+	clientSet := k8sFake.NewSimpleClientset()
+	client := k8sutil.KubernetesClient{
+		ServicesGetter:  clientSet.CoreV1(),
+		EndpointsGetter: clientSet.CoreV1(),
+	}
+	namespace := "default"
+	recorder := record.NewFakeRecorder(2)
+
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "acid-test-cluster",
+			Namespace: namespace,
+		},
+	}
+
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				Resources: config.Resources{
+					ClusterLabels:    map[string]string{"application": "spilo"},
+					ClusterNameLabel: "cluster-name",
+				},
+			},
+		}, client, pg, logger, recorder)
+
+	// objects of another cluster with the same names are not adopted
+	foreignLabels := map[string]string{"application": "spilo", "cluster-name": "acid-other-cluster"}
+	_, err := client.Services(namespace).Create(context.TODO(), &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: cluster.serviceName(Master), Namespace: namespace, Labels: foreignLabels},
+	}, metav1.CreateOptions{})
+	assert.NoError(t, err)
+	_, err = client.Endpoints(namespace).Create(context.TODO(), &v1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: cluster.endpointName(Master), Namespace: namespace},
+	}, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	err = cluster.syncService(context.TODO(), Master)
+	assert.EqualError(t, err, `master service "default/acid-test-cluster" does not belong to the cluster: its "cluster-name" label is "acid-other-cluster" instead of "acid-test-cluster"`)
+	assert.Nil(t, cluster.Services[Master])
+
+	err = cluster.syncEndpoint(context.TODO(), Master)
+	assert.EqualError(t, err, `master endpoint "default/acid-test-cluster" does not belong to the cluster: its "cluster-name" label is "" instead of "acid-test-cluster"`)
+	assert.Nil(t, cluster.Endpoints[Master])
+	assert.Contains(t, <-recorder.Events, "Warning Conflict master service")
+	assert.Contains(t, <-recorder.Events, "Warning Conflict master endpoint")
+
+	// the objects of the cluster itself are adopted
+	err = cluster.syncService(context.TODO(), Replica)
+	assert.NoError(t, err)
+	err = cluster.syncService(context.TODO(), Replica)
+	assert.NoError(t, err)
+	assert.NotNil(t, cluster.Services[Replica])
+}
+
+type mockUserSyncer struct {
+	passwords  map[string]string
+	encryption string
+	failUser   string
+}
+
+func (m *mockUserSyncer) ProduceSyncRequests(dbUsers spec.PgUserMap, newUsers spec.PgUserMap, passwordEncryption string) []spec.PgSyncUserRequest {
+	return nil
+}
+
+func (m *mockUserSyncer) ExecuteSyncRequests(ctx context.Context, requests []spec.PgSyncUserRequest, db *sql.DB) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	for _, request := range requests {
+		if request.User.Name == m.failUser {
+			return fmt.Errorf("could not alter user %q", request.User.Name)
+		}
+		m.passwords[request.User.Name] = request.User.Password
+		m.encryption = request.PasswordEncryption
+	}
+	return nil
+}
+
+func TestRotateSystemPasswords(t *testing.T) {
+	client, clientSet := newFakeK8sSecretsClient()
+	client.PodsGetter = clientSet.CoreV1()
+	clusterName := "acid-test-cluster"
+	namespace := "default"
+
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterName,
+			Namespace: namespace,
+		},
+	}
+
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				Auth: config.Auth{
+					SecretNameTemplate:  "{username}.{cluster}.credentials.{tprkind}.{tprgroup}",
+					SuperUsername:       superUserName,
+					ReplicationUsername: replicationUserName,
+				},
+				Resources: config.Resources{
+					ClusterLabels:    map[string]string{"application": "spilo"},
+					ClusterNameLabel: "cluster-name",
+				},
+			},
+		}, client, pg, logger, eventRecorder)
+
+	cluster.systemUsers = map[string]spec.PgUser{
+		constants.SuperuserKeyName:       {Origin: spec.RoleOriginSystem, Name: superUserName, Password: "superuser"},
+		constants.ReplicationUserKeyName: {Origin: spec.RoleOriginSystem, Name: replicationUserName, Password: "standby"},
+	}
+	cluster.pgUsers = map[string]spec.PgUser{}
+	err := cluster.syncSecrets(context.TODO())
+	assert.NoError(t, err)
+
+	for _, podName := range []string{clusterName + "-0", clusterName + "-1"} {
+		pod := v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: podName, Namespace: namespace, Labels: cluster.labelsSet(false)}}
+		_, err = clientSet.CoreV1().Pods(namespace).Create(context.TODO(), &pod, metav1.CreateOptions{})
+		assert.NoError(t, err)
+	}
+	mockClient := &mockPatroni{}
+	cluster.patroni = mockClient
+	// the passwords in the Patroni configuration of each pod, as superuser and replication password
+	patroniPasswords := make(map[string][]string)
+	failPod := ""
+	onFail := func() {}
+	cluster.execCommandWithInput = func(podName *spec.NamespacedName, input string, command ...string) (string, error) {
+		if podName.Name == failPod {
+			onFail()
+			return "", fmt.Errorf("container not running")
+		}
+		// the passwords are never part of the command
+		for _, arg := range command {
+			assert.NotContains(t, []string{"superuser", "standby"}, arg)
+		}
+		var passwords map[string]string
+		assert.NoError(t, json.Unmarshal([]byte(input), &passwords))
+		patroniPasswords[podName.Name] = []string{
+			passwords[constants.SuperuserKeyName], passwords[constants.ReplicationUserKeyName]}
+		return "", nil
+	}
+
+	secretPassword := func(username string) string {
+		secret, err := client.Secrets(namespace).Get(context.TODO(), cluster.credentialSecretName(username), metav1.GetOptions{})
+		assert.NoError(t, err)
+		return string(secret.Data["password"])
+	}
+	syncer := &mockUserSyncer{passwords: map[string]string{superUserName: "superuser", replicationUserName: "standby"}}
+	cluster.userSyncStrategy = syncer
+
+	// a role that cannot be altered reverts the roles altered before and leaves the secrets untouched
+	syncer.failUser = replicationUserName
+	err = cluster.rotateSystemPasswords(context.TODO())
+	assert.EqualError(t, err, `could not set new password of user "standby": could not alter user "standby", the previous passwords have been restored`)
+	assert.Equal(t, "superuser", syncer.passwords[superUserName])
+	assert.Equal(t, "superuser", secretPassword(superUserName))
+	assert.Equal(t, "standby", secretPassword(replicationUserName))
+	assert.Empty(t, patroniPasswords)
+
+	// a pod whose Patroni cannot be updated reverts the pods updated before and all roles
+	syncer.failUser = ""
+	failPod = clusterName + "-1"
+	err = cluster.rotateSystemPasswords(context.TODO())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "the previous passwords have been restored")
+	assert.Equal(t, map[string]string{superUserName: "superuser", replicationUserName: "standby"}, syncer.passwords)
+	for _, passwords := range patroniPasswords {
+		assert.Equal(t, []string{"superuser", "standby"}, passwords)
+	}
+	assert.Equal(t, "superuser", secretPassword(superUserName))
+	assert.Equal(t, "standby", secretPassword(replicationUserName))
+
+	// a secret that cannot be updated reverts the other secret, all pods and all roles
+	failPod = ""
+	clientSet.PrependReactor("update", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		secret := action.(k8stesting.UpdateAction).GetObject().(*v1.Secret)
+		if secret.Name == cluster.credentialSecretName(replicationUserName) {
+			return true, nil, fmt.Errorf("secret update refused")
+		}
+		return false, nil, nil
+	})
+	err = cluster.rotateSystemPasswords(context.TODO())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "the previous passwords have been restored")
+	assert.Equal(t, map[string]string{superUserName: "superuser", replicationUserName: "standby"}, syncer.passwords)
+	for _, passwords := range patroniPasswords {
+		assert.Equal(t, []string{"superuser", "standby"}, passwords)
+	}
+	assert.Equal(t, "superuser", secretPassword(superUserName))
+	assert.Equal(t, "standby", secretPassword(replicationUserName))
+
+	// a successful rotation sets the same new password in Postgres, in Patroni and in the secrets
+	clientSet.ReactionChain = clientSet.ReactionChain[1:]
+	mockClient.reloads = nil
+	err = cluster.rotateSystemPasswords(context.TODO())
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{clusterName + "-0", clusterName + "-1"}, mockClient.reloads)
+	for _, passwords := range patroniPasswords {
+		assert.Equal(t, []string{cluster.systemUsers[constants.SuperuserKeyName].Password,
+			cluster.systemUsers[constants.ReplicationUserKeyName].Password}, passwords)
+	}
+	for _, key := range []string{constants.SuperuserKeyName, constants.ReplicationUserKeyName} {
+		user := cluster.systemUsers[key]
+		assert.NotEqual(t, "superuser", user.Password)
+		assert.NotEqual(t, "standby", user.Password)
+		assert.Equal(t, user.Password, syncer.passwords[user.Name])
+		assert.Equal(t, user.Password, secretPassword(user.Name))
+	}
+
+	// the previous passwords are restored even when the step failed because its context expired
+	previous := map[string]string{
+		superUserName:       cluster.systemUsers[constants.SuperuserKeyName].Password,
+		replicationUserName: cluster.systemUsers[constants.ReplicationUserKeyName].Password,
+	}
+	stepCtx, cancelStep := context.WithCancel(context.Background())
+	defer cancelStep()
+	failPod = clusterName + "-1"
+	onFail = cancelStep
+	err = cluster.rotateSystemPasswords(stepCtx)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "the previous passwords have been restored")
+	assert.Equal(t, previous, syncer.passwords)
+	assert.Equal(t, previous[superUserName], secretPassword(superUserName))
+}
+
+func TestSetSpecKeepsUserSyncStrategy(t *testing.T) {
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "acid-test-cluster",
+			Namespace: "default",
+		},
+	}
+	var cluster = New(Config{}, k8sutil.KubernetesClient{}, pg, logger, eventRecorder)
+	syncer := &mockUserSyncer{passwords: map[string]string{}}
+	cluster.userSyncStrategy = syncer
+
+	// the configured strategy survives a spec update, which only changes the method the requests carry
+	newSpec := pg.DeepCopy()
+	newSpec.Spec.PasswordEncryption = "scram-sha-256"
+	cluster.setSpec(newSpec)
+	assert.True(t, cluster.userSyncStrategy == syncer)
+
+	err := cluster.alterSystemUserPassword(context.TODO(), spec.PgUser{Name: superUserName, Password: "secret"})
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", syncer.passwords[superUserName])
+	assert.Equal(t, "scram-sha-256", syncer.encryption)
+}
+
+func TestInitScripts(t *testing.T) {
+	clientSet := k8sFake.NewSimpleClientset()
+	acidClientSet := fakeacidv1.NewSimpleClientset()
+	client := k8sutil.KubernetesClient{
+		ConfigMapsGetter:  clientSet.CoreV1(),
+		PostgresqlsGetter: acidClientSet.AcidV1(),
+	}
+	clusterName := "acid-test-cluster"
+	namespace := "default"
+
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterName,
+			Namespace: namespace,
+		},
+		Spec: acidv1.PostgresSpec{
+			InitScripts: []acidv1.InitScript{
+				{Name: "roles", ConfigMap: "init-sql", Key: "roles.sql"},
+				{Name: "seed", Database: "app", ConfigMap: "init-sql", Key: "seed.sql"},
+			},
+		},
+	}
+	_, err := acidClientSet.AcidV1().Postgresqls(namespace).Create(context.TODO(), &pg, metav1.CreateOptions{})
+	assert.NoError(t, err)
+	_, err = clientSet.CoreV1().ConfigMaps(namespace).Create(context.TODO(), &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "init-sql", Namespace: namespace},
+		Data:       map[string]string{"roles.sql": "CREATE ROLE app_reader;"},
+	}, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	var cluster = New(Config{}, client, pg, logger, eventRecorder)
+
+	// only a cluster marked at creation has pending init scripts
+	assert.False(t, cluster.initScriptsPending())
+	err = cluster.markInitScriptsPending()
+	assert.NoError(t, err)
+	assert.True(t, cluster.initScriptsPending())
+
+	statement, err := cluster.initScriptSQL(context.TODO(), pg.Spec.InitScripts[0])
+	assert.NoError(t, err)
+	assert.Equal(t, "CREATE ROLE app_reader;", statement)
+	_, err = cluster.initScriptSQL(context.TODO(), pg.Spec.InitScripts[1])
+	assert.EqualError(t, err, `config map "init-sql" has no key "seed.sql" for init script "seed"`)
+
+	// scripts recorded in the status, e.g. before an operator restart, do not run again
+	cluster.Status.InitScripts = []string{"roles", "seed"}
+	err = cluster.runInitScripts(context.TODO())
+	assert.NoError(t, err)
+	assert.False(t, cluster.initScriptsPending())
+	updated, err := acidClientSet.AcidV1().Postgresqls(namespace).Get(context.TODO(), clusterName, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, acidv1.ClusterConditionReasonAllInitScriptsCompleted, updated.Status.Conditions[0].Reason)
+}
+
+func TestReportExpiredRoles(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	var cluster = New(Config{}, k8sutil.KubernetesClient{}, acidv1.Postgresql{}, logger, recorder)
+
+	now := time.Date(2021, time.June, 30, 18, 0, 0, 0, time.UTC)
+	never := time.Time{}
+	past := now.Add(-time.Hour)
+	future := now.Add(time.Hour)
+	cluster.pgUsers = map[string]spec.PgUser{
+		"contractor": {Name: "contractor", ValidUntil: &past},
+		"intern":     {Name: "intern", ValidUntil: &future},
+		"app_user":   {Name: "app_user", ValidUntil: &never},
+		"unmanaged":  {Name: "unmanaged"},
+	}
+
+	assert.Equal(t, []string{"contractor"}, cluster.reportExpiredRoles(now))
+	assert.Len(t, recorder.Events, 1, "expired roles are reported as a warning event")
+
+	assert.Empty(t, cluster.reportExpiredRoles(past.Add(-time.Minute)))
+	assert.Len(t, recorder.Events, 1, "no event without expired roles")
+}
+
+func TestSyncMemberStatus(t *testing.T) {
+	clientSet := k8sFake.NewSimpleClientset()
+	acidClientSet := fakeacidv1.NewSimpleClientset()
+	client := k8sutil.KubernetesClient{
+		PodsGetter:        clientSet.CoreV1(),
+		PostgresqlsGetter: acidClientSet.AcidV1(),
+	}
+	clusterName := "acid-test-cluster"
+	namespace := "default"
+
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterName,
+			Namespace: namespace,
+		},
+	}
+	_, err := acidClientSet.AcidV1().Postgresqls(namespace).Create(context.TODO(), &pg, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				Resources: config.Resources{
+					ClusterLabels:    map[string]string{"application": "spilo"},
+					ClusterNameLabel: "cluster-name",
+					PodRoleLabel:     "spilo-role",
+				},
+			},
+		}, client, pg, logger, eventRecorder)
+
+	for i, role := range []PostgresRole{Master, Replica} {
+		pod := v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("%s-%d", clusterName, i),
+				Namespace: namespace,
+				Labels:    map[string]string{"application": "spilo", "cluster-name": clusterName, "spilo-role": string(role)},
+			},
+		}
+		_, err = clientSet.CoreV1().Pods(namespace).Create(context.TODO(), &pod, metav1.CreateOptions{})
+		assert.NoError(t, err)
+	}
+
+	mockClient := &mockPatroni{
+		members: []patroni.ClusterMember{
+			{Name: "acid-test-cluster-1", Role: "replica", State: "running", Timeline: 2, Lag: 1024},
+			{Name: "acid-test-cluster-0", Role: "leader", State: "running", Timeline: 2},
+		},
+	}
+	cluster.patroni = mockClient
+
+	err = cluster.syncMemberStatus(context.TODO())
+	assert.NoError(t, err)
+	lag := int64(1024)
+	expected := []acidv1.MemberStatus{
+		{Name: "acid-test-cluster-0", Role: "leader", State: "running", Timeline: 2},
+		{Name: "acid-test-cluster-1", Role: "replica", State: "running", Timeline: 2, LagBytes: &lag},
+	}
+	updated, err := acidClientSet.AcidV1().Postgresqls(namespace).Get(context.TODO(), clusterName, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, expected, updated.Status.Members)
+
+	// an unreachable Patroni API does not fail the sync but reports the members as unknown
+	mockClient.membersErr = fmt.Errorf("connection refused")
+	err = cluster.syncMemberStatus(context.TODO())
+	assert.NoError(t, err)
+	expected = []acidv1.MemberStatus{
+		{Name: "acid-test-cluster-0", Role: acidv1.MemberStateUnknown, State: acidv1.MemberStateUnknown},
+		{Name: "acid-test-cluster-1", Role: acidv1.MemberStateUnknown, State: acidv1.MemberStateUnknown},
+	}
+	updated, err = acidClientSet.AcidV1().Postgresqls(namespace).Get(context.TODO(), clusterName, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, expected, updated.Status.Members)
+}
+
+func TestSyncLeaderElection(t *testing.T) {
+	clientSet := k8sFake.NewSimpleClientset()
+	acidClientSet := fakeacidv1.NewSimpleClientset()
+	client := k8sutil.KubernetesClient{
+		PodsGetter:        clientSet.CoreV1(),
+		PostgresqlsGetter: acidClientSet.AcidV1(),
+	}
+	clusterName := "acid-test-cluster"
+	namespace := "default"
+
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterName,
+			Namespace: namespace,
+		},
+	}
+	_, err := acidClientSet.AcidV1().Postgresqls(namespace).Create(context.TODO(), &pg, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	recorder := record.NewFakeRecorder(5)
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				Resources: config.Resources{
+					ClusterLabels:    map[string]string{"application": "spilo"},
+					ClusterNameLabel: "cluster-name",
+					PodRoleLabel:     "spilo-role",
+				},
+			},
+		}, client, pg, logger, recorder)
+
+	for i, role := range []PostgresRole{Master, Replica} {
+		pod := v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("%s-%d", clusterName, i),
+				Namespace: namespace,
+				Labels:    map[string]string{"application": "spilo", "cluster-name": clusterName, "spilo-role": string(role)},
+			},
+		}
+		_, err = clientSet.CoreV1().Pods(namespace).Create(context.TODO(), &pod, metav1.CreateOptions{})
+		assert.NoError(t, err)
+	}
+
+	mockClient := &mockPatroni{
+		members: []patroni.ClusterMember{
+			{Name: "acid-test-cluster-0", Role: "leader", State: "running"},
+			{Name: "acid-test-cluster-1", Role: "replica", State: "running"},
+		},
+	}
+	cluster.patroni = mockClient
+
+	leaderCondition := func() acidv1.ClusterCondition {
+		updated, err := acidClientSet.AcidV1().Postgresqls(namespace).Get(context.TODO(), clusterName, metav1.GetOptions{})
+		assert.NoError(t, err)
+		for _, condition := range updated.Status.Conditions {
+			if condition.Type == acidv1.ClusterConditionLeaderElected {
+				return condition
+			}
+		}
+		t.Fatalf("no %s condition in the status", acidv1.ClusterConditionLeaderElected)
+		return acidv1.ClusterCondition{}
+	}
+
+	err = cluster.syncLeaderElection(context.TODO())
+	assert.NoError(t, err)
+	assert.False(t, cluster.leaderDiverged)
+	condition := leaderCondition()
+	assert.Equal(t, v1.ConditionTrue, condition.Status)
+	assert.Equal(t, acidv1.ClusterConditionReasonSingleLeader, condition.Reason)
+	assert.Empty(t, recorder.Events)
+
+	// the replica lost the DCS and promoted itself while the former leader still holds on
+	mockClient.podMembers = map[string][]patroni.ClusterMember{
+		"acid-test-cluster-1": {
+			{Name: "acid-test-cluster-1", Role: "leader", State: "running"},
+		},
+	}
+	err = cluster.syncLeaderElection(context.TODO())
+	assert.NoError(t, err)
+	assert.True(t, cluster.leaderDiverged)
+	condition = leaderCondition()
+	assert.Equal(t, v1.ConditionFalse, condition.Status)
+	assert.Equal(t, acidv1.ClusterConditionReasonMultipleLeaders, condition.Reason)
+	assert.Equal(t, "acid-test-cluster-0, acid-test-cluster-1 claim to be the leader", condition.Message)
+	assert.Contains(t, <-recorder.Events, "Warning LeaderElection Patroni cluster diverged")
+
+	// nothing is set on a diverged cluster
+	cluster.Spec.Parameters = map[string]string{"max_connections": "200"}
+	err = cluster.checkAndSetGlobalPostgreSQLConfiguration(context.TODO())
+	assert.NoError(t, err)
+	assert.Nil(t, mockClient.setOptions)
+
+	// the event is only emitted when the cluster diverges
+	err = cluster.syncLeaderElection(context.TODO())
+	assert.NoError(t, err)
+	assert.Empty(t, recorder.Events)
+
+	mockClient.podMembers = nil
+	mockClient.members = []patroni.ClusterMember{
+		{Name: "acid-test-cluster-0", Role: "leader", State: "running"},
+		{Name: "acid-test-cluster-1", Role: "replica", State: "running"},
+	}
+	err = cluster.syncLeaderElection(context.TODO())
+	assert.NoError(t, err)
+	assert.False(t, cluster.leaderDiverged)
+	assert.Equal(t, acidv1.ClusterConditionReasonSingleLeader, leaderCondition().Reason)
+	assert.Contains(t, <-recorder.Events, "Normal LeaderElection Patroni cluster converged")
+
+	// a cluster without a leader, e.g. during a failover, is reported but not held back
+	mockClient.members[0].Role = "replica"
+	err = cluster.syncLeaderElection(context.TODO())
+	assert.NoError(t, err)
+	assert.False(t, cluster.leaderDiverged)
+	assert.Equal(t, acidv1.ClusterConditionReasonNoLeader, leaderCondition().Reason)
+	assert.Contains(t, <-recorder.Events, "Warning LeaderElection Patroni cluster has no leader")
+	err = cluster.syncLeaderElection(context.TODO())
+	assert.NoError(t, err)
+	assert.Empty(t, recorder.Events)
+
+	mockClient.members[0].Role = "leader"
+	err = cluster.syncLeaderElection(context.TODO())
+	assert.NoError(t, err)
+	assert.False(t, cluster.leaderDiverged)
+	assert.Equal(t, acidv1.ClusterConditionReasonSingleLeader, leaderCondition().Reason)
+
+	// without any answer the state is unknown and kept
+	mockClient.membersErr = fmt.Errorf("connection refused")
+	err = cluster.syncLeaderElection(context.TODO())
+	assert.Error(t, err)
+	assert.False(t, cluster.leaderDiverged)
+}
+
+func TestSyncPgIdent(t *testing.T) {
+	clientSet := k8sFake.NewSimpleClientset()
+	client := k8sutil.KubernetesClient{
+		PodsGetter: clientSet.CoreV1(),
+	}
+	clusterName := "acid-test-cluster"
+	namespace := "default"
+
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterName,
+			Namespace: namespace,
+		},
+	}
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				Resources: config.Resources{
+					ClusterLabels:    map[string]string{"application": "spilo"},
+					ClusterNameLabel: "cluster-name",
+					PodRoleLabel:     "spilo-role",
+				},
+			},
+		}, client, pg, logger, record.NewFakeRecorder(5))
+
+	pod := v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterName + "-0",
+			Namespace: namespace,
+			Labels:    map[string]string{"application": "spilo", "cluster-name": clusterName, "spilo-role": "master"},
+		},
+	}
+	_, err := clientSet.CoreV1().Pods(namespace).Create(context.TODO(), &pod, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	mockClient := &mockPatroni{}
+	cluster.patroni = mockClient
+
+	// nothing to do without maps in the manifest and in Patroni
+	err = cluster.syncPgIdent(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, mockClient.pgIdentSet)
+
+	cluster.Spec.Patroni.PgIdent = []string{"krb /^(.*)@EXAMPLE\\.COM$ \\1", "cert app app_user"}
+	err = cluster.syncPgIdent(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, mockClient.pgIdentSet)
+	assert.Equal(t, cluster.Spec.Patroni.PgIdent, mockClient.pgIdent)
+
+	err = cluster.syncPgIdent(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, mockClient.pgIdentSet, "unchanged maps are not set again")
+
+	// the order of the lines matters
+	cluster.Spec.Patroni.PgIdent = []string{"cert app app_user", "krb /^(.*)@EXAMPLE\\.COM$ \\1"}
+	err = cluster.syncPgIdent(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, mockClient.pgIdentSet)
+	assert.Equal(t, cluster.Spec.Patroni.PgIdent, mockClient.pgIdent)
+
+	// removed maps are replaced by a comment, Patroni would keep the file otherwise
+	cluster.Spec.Patroni.PgIdent = nil
+	err = cluster.syncPgIdent(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, 3, mockClient.pgIdentSet)
+	assert.Equal(t, []string{pgIdentEmptyComment}, mockClient.pgIdent)
+
+	err = cluster.syncPgIdent(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, 3, mockClient.pgIdentSet)
+}
+
+func TestSyncReadOnly(t *testing.T) {
+	clientSet := k8sFake.NewSimpleClientset()
+	acidClientSet := fakeacidv1.NewSimpleClientset()
+	client := k8sutil.KubernetesClient{
+		PodsGetter:        clientSet.CoreV1(),
+		PostgresqlsGetter: acidClientSet.AcidV1(),
+	}
+	clusterName := "acid-test-cluster"
+	namespace := "default"
+	recorder := record.NewFakeRecorder(5)
+
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterName,
+			Namespace: namespace,
+		},
+	}
+	_, err := acidClientSet.AcidV1().Postgresqls(namespace).Create(context.TODO(), &pg, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				Resources: config.Resources{
+					ClusterLabels:    map[string]string{"application": "spilo"},
+					ClusterNameLabel: "cluster-name",
+					PodRoleLabel:     "spilo-role",
+				},
+			},
+		}, client, pg, logger, recorder)
+	mock := &mockPatroni{parameters: map[string]string{}}
+	cluster.patroni = mock
+
+	for i, role := range []PostgresRole{Master, Replica} {
+		labels := cluster.labelsSet(false)
+		labels["spilo-role"] = string(role)
+		_, err = client.Pods(namespace).Create(context.TODO(), &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("%s-%d", clusterName, i), Namespace: namespace, Labels: labels},
+		}, metav1.CreateOptions{})
+		assert.NoError(t, err)
+	}
+
+	// a cluster that was never quiesced is left alone
+	err = cluster.syncReadOnly(context.TODO())
+	assert.NoError(t, err)
+	assert.Nil(t, mock.setOptions)
+	assert.Empty(t, cluster.Status.Conditions)
+
+	// quiescing sets the parameter and reloads every pod, the leader included
+	cluster.Spec.ReadOnly = true
+	err = cluster.syncReadOnly(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"default_transaction_read_only": "on"}, mock.setOptions)
+	assert.Equal(t, []string{clusterName + "-0", clusterName + "-1"}, mock.reloads)
+	assert.Equal(t, "Normal ReadOnly Set default_transaction_read_only=on", <-recorder.Events)
+	assert.Len(t, cluster.Status.Conditions, 1)
+	assert.Equal(t, acidv1.ClusterConditionReadOnly, cluster.Status.Conditions[0].Type)
+	assert.Equal(t, v1.ConditionTrue, cluster.Status.Conditions[0].Status)
+
+	// nothing is set again while Patroni has the value
+	mock.parameters = mock.setOptions
+	mock.setOptions = nil
+	mock.reloads = nil
+	err = cluster.syncReadOnly(context.TODO())
+	assert.NoError(t, err)
+	assert.Nil(t, mock.setOptions)
+	assert.Empty(t, mock.reloads)
+
+	// clearing the flag reverts the parameter and the condition
+	cluster.Spec.ReadOnly = false
+	err = cluster.syncReadOnly(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"default_transaction_read_only": "off"}, mock.setOptions)
+	assert.Equal(t, []string{clusterName + "-0", clusterName + "-1"}, mock.reloads)
+	assert.Equal(t, "Normal ReadOnly Set default_transaction_read_only=off", <-recorder.Events)
+	assert.Equal(t, v1.ConditionFalse, cluster.Status.Conditions[0].Status)
+	assert.Equal(t, acidv1.ClusterConditionReasonReadWrite, cluster.Status.Conditions[0].Reason)
+
+	// the condition reports the value applied from the parameters of the manifest, which take precedence
+	mock.parameters = mock.setOptions
+	mock.setOptions = nil
+	cluster.Spec.Parameters = map[string]string{"default_transaction_read_only": "on"}
+	err = cluster.syncReadOnly(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"default_transaction_read_only": "on"}, mock.setOptions)
+	assert.Equal(t, "Normal ReadOnly Set default_transaction_read_only=on", <-recorder.Events)
+	assert.Equal(t, v1.ConditionTrue, cluster.Status.Conditions[0].Status)
+	assert.Equal(t, "default_transaction_read_only is on", cluster.Status.Conditions[0].Message)
+}
+
+func TestSyncReplicationSlots(t *testing.T) {
+	clientSet := k8sFake.NewSimpleClientset()
+	acidClientSet := fakeacidv1.NewSimpleClientset()
+	client := k8sutil.KubernetesClient{
+		PodsGetter:        clientSet.CoreV1(),
+		PostgresqlsGetter: acidClientSet.AcidV1(),
+	}
+	clusterName := "acid-test-cluster"
+	namespace := "default"
+
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterName,
+			Namespace: namespace,
+		},
+	}
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				Resources: config.Resources{
+					ClusterLabels:    map[string]string{"application": "spilo"},
+					ClusterNameLabel: "cluster-name",
+					PodRoleLabel:     "spilo-role",
+				},
+			},
+		}, client, pg, logger, record.NewFakeRecorder(10))
+
+	_, err := acidClientSet.AcidV1().Postgresqls(namespace).Create(context.TODO(), &pg, metav1.CreateOptions{})
+	assert.NoError(t, err)
+	pod := v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterName + "-0",
+			Namespace: namespace,
+			Labels:    map[string]string{"application": "spilo", "cluster-name": clusterName, "spilo-role": "master"},
+		},
+	}
+	_, err = clientSet.CoreV1().Pods(namespace).Create(context.TODO(), &pod, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	// slots created with patronictl are left alone
+	mockClient := &mockPatroni{slots: map[string]map[string]string{"manual": {"type": "physical"}}}
+	cluster.patroni = mockClient
+	err = cluster.syncReplicationSlots(context.TODO())
+	assert.NoError(t, err)
+	assert.Empty(t, mockClient.slotsSet)
+
+	cdc := map[string]string{"type": "logical", "database": "foo", "plugin": "pgoutput"}
+	archiver := map[string]string{"type": "physical"}
+	cluster.Spec.Patroni.Slots = map[string]map[string]string{"cdc": cdc, "archiver": archiver}
+	err = cluster.syncReplicationSlots(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, []map[string]map[string]string{{"cdc": cdc, "archiver": archiver}}, mockClient.slotsSet)
+	assert.Equal(t, map[string]map[string]string{"cdc": cdc, "archiver": archiver, "manual": {"type": "physical"}}, mockClient.slots)
+	assert.Equal(t, []string{"archiver", "cdc"}, cluster.Status.ReplicationSlots)
+
+	err = cluster.syncReplicationSlots(context.TODO())
+	assert.NoError(t, err)
+	assert.Len(t, mockClient.slotsSet, 1, "unchanged slots are not set again")
+
+	// slots removed together with the slots field are removed as well, the slots of patronictl are kept
+	cluster.Spec.Patroni.Slots = nil
+	err = cluster.syncReplicationSlots(context.TODO())
+	assert.NoError(t, err)
+	assert.Len(t, mockClient.slotsSet, 2)
+	assert.Equal(t, map[string]map[string]string{"cdc": nil, "archiver": nil}, mockClient.slotsSet[1])
+	assert.Equal(t, map[string]map[string]string{"manual": {"type": "physical"}}, mockClient.slots)
+	assert.Equal(t, []string{"archiver", "cdc"}, cluster.Status.ReplicationSlots)
+
+	// the removed slots are remembered until Postgres dropped them, an active slot cannot be dropped
+	cluster.Spec.Patroni.Slots = map[string]map[string]string{"orders": cdc, "audit": cdc}
+	slots := map[string]replicationSlot{
+		"cdc":    {Active: true, RetainedBytes: 1 << 20},
+		"orders": {Active: false, RetainedBytes: 512 << 20},
+		"audit":  {Active: true, RetainedBytes: 64 << 20},
+	}
+	warned := cluster.reportReplicationSlots(slots)
+	assert.Equal(t, []string{"cdc", "orders"}, warned)
+	err = cluster.pruneReplicationSlots(slots)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"audit", "cdc", "orders"}, cluster.Status.ReplicationSlots)
+	pgUpdated, err := acidClientSet.AcidV1().Postgresqls(namespace).Get(context.TODO(), clusterName, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"audit", "cdc", "orders"}, pgUpdated.Status.ReplicationSlots)
+}
+
+func TestSyncStandbyPromotion(t *testing.T) {
+	clientSet := k8sFake.NewSimpleClientset()
+	acidClientSet := fakeacidv1.NewSimpleClientset()
+	client := k8sutil.KubernetesClient{
+		PodsGetter:        clientSet.CoreV1(),
+		PostgresqlsGetter: acidClientSet.AcidV1(),
+	}
+	clusterName := "acid-test-cluster"
+	namespace := "default"
+
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterName,
+			Namespace: namespace,
+		},
+		Spec: acidv1.PostgresSpec{
+			NumberOfInstances: 1,
+			StandbyCluster:    &acidv1.StandbyDescription{S3WalPath: "s3://bucket/path"},
+		},
+	}
+	_, err := acidClientSet.AcidV1().Postgresqls(namespace).Create(context.TODO(), &pg, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	recorder := record.NewFakeRecorder(5)
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				Resources: config.Resources{
+					ClusterLabels:         map[string]string{"application": "spilo"},
+					ClusterNameLabel:      "cluster-name",
+					PodRoleLabel:          "spilo-role",
+					MinInstances:          -1,
+					MaxInstances:          -1,
+					ResourceCheckInterval: time.Millisecond,
+					ResourceCheckTimeout:  10 * time.Millisecond,
+				},
+			},
+		}, client, pg, logger, recorder)
+
+	pod := v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "acid-test-cluster-0",
+			Namespace: namespace,
+			Labels:    map[string]string{"application": "spilo", "cluster-name": clusterName, "spilo-role": string(Master)},
+		},
+	}
+	_, err = clientSet.CoreV1().Pods(namespace).Create(context.TODO(), &pod, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	mockClient := &mockPatroni{
+		members: []patroni.ClusterMember{
+			{Name: "acid-test-cluster-0", Role: "standby_leader", State: "running", Timeline: 1},
+		},
+		standby: true,
+	}
+	cluster.patroni = mockClient
+
+	// a standby cluster in the manifest is not promoted
+	err = cluster.syncStandbyPromotion(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, mockClient.promoted)
+
+	// a cluster that never was a standby is not looked at
+	oldSpec := cluster.Spec
+	cluster.Spec.StandbyCluster = nil
+	err = cluster.syncStandbyPromotion(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, mockClient.promoted)
+
+	// removing the standby section promotes the standby leader and records the promotion
+	cluster.trackStandbyPromotion(&oldSpec, &cluster.Spec)
+	err = cluster.syncStandbyPromotion(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, mockClient.promoted)
+	assert.Equal(t, "leader", mockClient.members[0].Role)
+	assert.NotNil(t, cluster.Status.PromotionTime)
+	updated, err := acidClientSet.AcidV1().Postgresqls(namespace).Get(context.TODO(), clusterName, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.NotNil(t, updated.Status.PromotionTime)
+	assert.Contains(t, <-recorder.Events, "Standby cluster has been promoted")
+
+	// the promoted cluster is not promoted again
+	err = cluster.syncStandbyPromotion(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, mockClient.promoted)
+	assert.Empty(t, recorder.Events)
+
+	// a statefulset still configured as a standby marks the cluster as a former standby
+	sset := &appsv1.StatefulSet{}
+	sset.Spec.Template.Spec.Containers = []v1.Container{{
+		Name: constants.PostgresContainerName,
+		Env:  []v1.EnvVar{{Name: "STANDBY_METHOD", Value: "STANDBY_WITH_WALE"}},
+	}}
+	assert.True(t, hasStandbyEnvironment(sset))
+	sset.Spec.Template.Spec.Containers[0].Env = nil
+	assert.False(t, hasStandbyEnvironment(sset))
+}
+
+func TestSyncNoFailover(t *testing.T) {
+	clientSet := k8sFake.NewSimpleClientset()
+	client := k8sutil.KubernetesClient{
+		PodsGetter:  clientSet.CoreV1(),
+		NodesGetter: clientSet.CoreV1(),
+	}
+	clusterName := "acid-test-cluster"
+	namespace := "default"
+
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterName,
+			Namespace: namespace,
+		},
+		Spec: acidv1.PostgresSpec{
+			NumberOfInstances: 3,
+			NoFailover: &acidv1.NoFailover{
+				Pods:  []string{clusterName + "-0"},
+				Zones: []string{"eu-central-1b"},
+			},
+		},
+	}
+
+	recorder := record.NewFakeRecorder(5)
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				Resources: config.Resources{
+					ClusterLabels:    map[string]string{"application": "spilo"},
+					ClusterNameLabel: "cluster-name",
+					PodRoleLabel:     "spilo-role",
+				},
+			},
+		}, client, pg, logger, recorder)
+	mockClient := &mockPatroni{}
+	cluster.patroni = mockClient
+	tagCommands := make(map[string][]string)
+	cluster.execCommand = func(podName *spec.NamespacedName, command ...string) (string, error) {
+		tagCommands[podName.Name] = command[len(command)-2:]
+		return "", nil
+	}
+
+	for _, node := range []v1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "node-a", Labels: map[string]string{"topology.kubernetes.io/zone": "eu-central-1a"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "node-b", Labels: map[string]string{"failure-domain.beta.kubernetes.io/zone": "eu-central-1b"}}},
+	} {
+		_, err := clientSet.CoreV1().Nodes().Create(context.TODO(), &node, metav1.CreateOptions{})
+		assert.NoError(t, err)
+	}
+
+	pods := []struct {
+		role       PostgresRole
+		node       string
+		noFailover string
+	}{
+		{role: Master, node: "node-a"},
+		{role: Replica, node: "node-b", noFailover: "true"},
+		{role: Replica, node: "node-a"},
+	}
+	for i, p := range pods {
+		labels := cluster.labelsSet(false)
+		labels["spilo-role"] = string(p.role)
+		pod := v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("%s-%d", clusterName, i),
+				Namespace: namespace,
+				Labels:    labels,
+			},
+			Spec: v1.PodSpec{NodeName: p.node},
+		}
+		if p.noFailover != "" {
+			pod.Annotations = map[string]string{constants.NoFailoverAnnotationKey: p.noFailover}
+		}
+		_, err := clientSet.CoreV1().Pods(namespace).Create(context.TODO(), &pod, metav1.CreateOptions{})
+		assert.NoError(t, err)
+	}
+
+	// pods are selected by name and by the zone of their node
+	podList, err := cluster.listPods(context.TODO())
+	assert.NoError(t, err)
+	tagged, err := cluster.noFailoverPods(context.TODO(), podList)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{clusterName + "-0": true, clusterName + "-1": true, clusterName + "-2": false}, tagged)
+
+	// the leader is not tagged, the tagged replica stays untouched
+	err = cluster.syncPatroniTags(context.TODO())
+	assert.NoError(t, err)
+	leader, err := clientSet.CoreV1().Pods(namespace).Get(context.TODO(), clusterName+"-0", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Empty(t, leader.Annotations[constants.NoFailoverAnnotationKey])
+	assert.Equal(t, `Warning NoFailover Leader "acid-test-cluster-0" can not be tagged as nofailover, switch over to another pod first`, <-recorder.Events)
+	assert.Empty(t, tagCommands)
+
+	// a recreated pod comes back without its annotation and is tagged in the running Patroni, nothing is restarted
+	err = clientSet.CoreV1().Pods(namespace).Delete(context.TODO(), clusterName+"-1", metav1.DeleteOptions{})
+	assert.NoError(t, err)
+	replicaLabels := cluster.labelsSet(false)
+	replicaLabels["spilo-role"] = string(Replica)
+	recreated := v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterName + "-1",
+			Namespace: namespace,
+			Labels:    replicaLabels,
+		},
+		Spec: v1.PodSpec{NodeName: "node-b"},
+	}
+	_, err = clientSet.CoreV1().Pods(namespace).Create(context.TODO(), &recreated, metav1.CreateOptions{})
+	assert.NoError(t, err)
+	err = cluster.syncPatroniTags(context.TODO())
+	assert.NoError(t, err)
+	<-recorder.Events
+	replica, err := clientSet.CoreV1().Pods(namespace).Get(context.TODO(), clusterName+"-1", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "true", replica.Annotations[constants.NoFailoverAnnotationKey])
+	assert.Equal(t, map[string][]string{clusterName + "-1": {"true", ""}}, tagCommands)
+	assert.Equal(t, []string{clusterName + "-1"}, mockClient.reloads)
+	podList, err = cluster.listPods(context.TODO())
+	assert.NoError(t, err)
+	assert.Len(t, podList, 3)
+
+	// the tagged pod stays untouched on the next sync
+	tagCommands = make(map[string][]string)
+	err = cluster.syncPatroniTags(context.TODO())
+	assert.NoError(t, err)
+	<-recorder.Events
+	assert.Empty(t, tagCommands)
+	assert.Len(t, mockClient.reloads, 1)
+
+	// the tags are kept while the cluster is diverged
+	cluster.leaderDiverged = true
+	cluster.Spec.NoFailover = nil
+	err = cluster.syncPatroniTags(context.TODO())
+	assert.EqualError(t, err, `Patroni cluster diverged, tagging of pod "default/acid-test-cluster-1" postponed`)
+	assert.Empty(t, tagCommands)
+	cluster.leaderDiverged = false
+
+	// without the section the tags are removed
+	err = cluster.syncPatroniTags(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{clusterName + "-1": {"false", ""}}, tagCommands)
+	replica, err = clientSet.CoreV1().Pods(namespace).Get(context.TODO(), clusterName+"-1", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "false", replica.Annotations[constants.NoFailoverAnnotationKey])
+}
+
+func TestSyncPatroniTagsCascadingReplicas(t *testing.T) {
+	clientSet := k8sFake.NewSimpleClientset()
+	client := k8sutil.KubernetesClient{
+		PodsGetter: clientSet.CoreV1(),
+	}
+	clusterName := "acid-test-cluster"
+	namespace := "default"
+
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterName,
+			Namespace: namespace,
+		},
+		Spec: acidv1.PostgresSpec{
+			NumberOfInstances: 6,
+			CascadingReplicas: []acidv1.CascadingReplica{
+				{Pod: clusterName + "-2", ReplicateFrom: clusterName + "-1"},
+				{Pod: clusterName + "-3", ReplicateFrom: clusterName + "-5"},
+			},
+		},
+	}
+
+	recorder := record.NewFakeRecorder(5)
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				Resources: config.Resources{
+					ClusterLabels:    map[string]string{"application": "spilo"},
+					ClusterNameLabel: "cluster-name",
+					PodRoleLabel:     "spilo-role",
+				},
+			},
+		}, client, pg, logger, recorder)
+	mockClient := &mockPatroni{}
+	cluster.patroni = mockClient
+	tagCommands := make(map[string][]string)
+	cluster.execCommand = func(podName *spec.NamespacedName, command ...string) (string, error) {
+		tagCommands[podName.Name] = command[len(command)-2:]
+		return "", nil
+	}
+
+	for i, role := range []PostgresRole{Master, Replica, Replica, Replica} {
+		labels := cluster.labelsSet(false)
+		labels["spilo-role"] = string(role)
+		pod := v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("%s-%d", clusterName, i),
+				Namespace: namespace,
+				Labels:    labels,
+			},
+		}
+		if i == 2 {
+			pod.Annotations = map[string]string{
+				constants.NoFailoverAnnotationKey:    "true",
+				constants.ReplicateFromAnnotationKey: clusterName + "-1",
+			}
+		}
+		_, err := clientSet.CoreV1().Pods(namespace).Create(context.TODO(), &pod, metav1.CreateOptions{})
+		assert.NoError(t, err)
+	}
+
+	// the replica of a missing pod is left untagged
+	podList, err := cluster.listPods(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{clusterName + "-2": clusterName + "-1"}, cluster.replicateFromPods(podList))
+	assert.Equal(t, `Warning CascadingReplica Cascading replica "acid-test-cluster-3" can not replicate from "acid-test-cluster-5", the pod does not exist`, <-recorder.Events)
+
+	// the tagged cascading replica stays untouched, the missing pod is reported again
+	err = cluster.syncPatroniTags(context.TODO())
+	assert.NoError(t, err)
+	assert.Contains(t, <-recorder.Events, "CascadingReplica")
+	assert.Empty(t, recorder.Events)
+	assert.Empty(t, tagCommands)
+
+	// a recreated cascading replica is tagged again in the running Patroni and keeps running
+	err = clientSet.CoreV1().Pods(namespace).Delete(context.TODO(), clusterName+"-2", metav1.DeleteOptions{})
+	assert.NoError(t, err)
+	replicaLabels := cluster.labelsSet(false)
+	replicaLabels["spilo-role"] = string(Replica)
+	recreated := v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterName + "-2",
+			Namespace: namespace,
+			Labels:    replicaLabels,
+		},
+	}
+	_, err = clientSet.CoreV1().Pods(namespace).Create(context.TODO(), &recreated, metav1.CreateOptions{})
+	assert.NoError(t, err)
+	err = cluster.syncPatroniTags(context.TODO())
+	assert.NoError(t, err)
+	<-recorder.Events
+	replica, err := clientSet.CoreV1().Pods(namespace).Get(context.TODO(), clusterName+"-2", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "true", replica.Annotations[constants.NoFailoverAnnotationKey])
+	assert.Equal(t, clusterName+"-1", replica.Annotations[constants.ReplicateFromAnnotationKey])
+	assert.Equal(t, map[string][]string{clusterName + "-2": {"true", clusterName + "-1"}}, tagCommands)
+	assert.Equal(t, []string{clusterName + "-2"}, mockClient.reloads)
+
+	// nothing changes on the next sync
+	tagCommands = make(map[string][]string)
+	err = cluster.syncPatroniTags(context.TODO())
+	assert.NoError(t, err)
+	<-recorder.Events
+	assert.Empty(t, tagCommands)
+
+	// without the section the tags are removed
+	cluster.Spec.CascadingReplicas = nil
+	err = cluster.syncPatroniTags(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{clusterName + "-2": {"false", ""}}, tagCommands)
+	replica, err = clientSet.CoreV1().Pods(namespace).Get(context.TODO(), clusterName+"-2", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "false", replica.Annotations[constants.NoFailoverAnnotationKey])
+	assert.NotContains(t, replica.Annotations, constants.ReplicateFromAnnotationKey)
+}
+
+func TestCheckAndSetGlobalPostgreSQLConfigurationInvalid(t *testing.T) {
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "acid-test-cluster",
+			Namespace: "default",
+		},
+		Spec: acidv1.PostgresSpec{
+			PostgresqlParam: acidv1.PostgresqlParam{
+				Parameters: map[string]string{"max_connections": "abc"},
+			},
+		},
+	}
+
+	// the pods are never listed nor Patroni called for an invalid value
+	var cluster = New(Config{}, k8sutil.KubernetesClient{}, pg, logger, eventRecorder)
+
+	err := cluster.checkAndSetGlobalPostgreSQLConfiguration(context.TODO())
+	assert.EqualError(t, err, `invalid value "abc" for parameter "max_connections": must be an integer`)
+}
+
+func TestCheckAndSetGlobalPostgreSQLConfigurationDeferred(t *testing.T) {
+	clientSet := k8sFake.NewSimpleClientset()
+	acidClientSet := fakeacidv1.NewSimpleClientset()
+	client := k8sutil.KubernetesClient{
+		PodsGetter:        clientSet.CoreV1(),
+		PostgresqlsGetter: acidClientSet.AcidV1(),
+	}
+	clusterName := "acid-test-cluster"
+	namespace := "default"
+	recorder := record.NewFakeRecorder(1)
+
+	// a window two days ahead is never open now
+	window := acidv1.MaintenanceWindow{
+		Weekday:   (time.Now().UTC().Weekday() + 2) % 7,
+		StartTime: metav1.Time{Time: time.Date(0, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		EndTime:   metav1.Time{Time: time.Date(0, time.January, 1, 23, 0, 0, 0, time.UTC)},
+	}
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterName,
+			Namespace: namespace,
+		},
+		Spec: acidv1.PostgresSpec{
+			PostgresqlParam: acidv1.PostgresqlParam{
+				Parameters: map[string]string{"max_connections": "200", "max_worker_processes": "8"},
+			},
+			MaintenanceWindows:     []acidv1.MaintenanceWindow{window},
+			DeferRestartParameters: true,
+		},
+	}
+	_, err := acidClientSet.AcidV1().Postgresqls(namespace).Create(context.TODO(), &pg, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				Resources: config.Resources{
+					ClusterLabels:    map[string]string{"application": "spilo"},
+					ClusterNameLabel: "cluster-name",
+					PodRoleLabel:     "spilo-role",
+				},
+			},
+		}, client, pg, logger, recorder)
+	mock := &mockPatroni{parameters: map[string]string{"max_connections": "100", "max_worker_processes": "8"}}
+	cluster.patroni = mock
+
+	_, err = client.Pods(namespace).Create(context.TODO(), &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: clusterName + "-0", Namespace: namespace, Labels: cluster.labelsSet(false)},
+	}, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	// outside of the maintenance window only the changed option is reported as deferred
+	err = cluster.checkAndSetGlobalPostgreSQLConfiguration(context.TODO())
+	assert.NoError(t, err)
+	assert.Nil(t, mock.setOptions)
+	updated, err := acidClientSet.AcidV1().Postgresqls(namespace).Get(context.TODO(), clusterName, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, updated.Status.Conditions, 1)
+	condition := updated.Status.Conditions[0]
+	assert.Equal(t, acidv1.ClusterConditionParametersApplied, condition.Type)
+	assert.Equal(t, v1.ConditionFalse, condition.Status)
+	assert.Equal(t, acidv1.ClusterConditionReasonParametersDeferred, condition.Reason)
+	assert.Equal(t, "waiting for the next maintenance window to set max_connections=200", condition.Message)
+
+	// without maintenance windows the options are set right away
+	cluster.Spec.MaintenanceWindows = nil
+	err = cluster.checkAndSetGlobalPostgreSQLConfiguration(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, pg.Spec.Parameters, mock.setOptions)
+	assert.Empty(t, mock.reloads)
+	assert.Equal(t, "Normal Parameters Set max_connections=200 requiring a restart of Postgres", <-recorder.Events)
+	updated, err = acidClientSet.AcidV1().Postgresqls(namespace).Get(context.TODO(), clusterName, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, v1.ConditionTrue, updated.Status.Conditions[0].Status)
+	assert.Equal(t, acidv1.ClusterConditionReasonAllParametersApplied, updated.Status.Conditions[0].Reason)
+}
+
+func TestCheckAndSetGlobalPostgreSQLConfigurationMemoryTuning(t *testing.T) {
+	clientSet := k8sFake.NewSimpleClientset()
+	acidClientSet := fakeacidv1.NewSimpleClientset()
+	client := k8sutil.KubernetesClient{
+		PodsGetter:        clientSet.CoreV1(),
+		PostgresqlsGetter: acidClientSet.AcidV1(),
+	}
+	clusterName := "acid-test-cluster"
+	namespace := "default"
+
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterName,
+			Namespace: namespace,
+		},
+		Spec: acidv1.PostgresSpec{
+			PostgresqlParam: acidv1.PostgresqlParam{
+				Parameters: map[string]string{"effective_cache_size": "1GB"},
+			},
+			EnableMemoryTuning: true,
+		},
+	}
+	_, err := acidClientSet.AcidV1().Postgresqls(namespace).Create(context.TODO(), &pg, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				Resources: config.Resources{
+					ClusterLabels:    map[string]string{"application": "spilo"},
+					ClusterNameLabel: "cluster-name",
+					PodRoleLabel:     "spilo-role",
+				},
+			},
+		}, client, pg, logger, record.NewFakeRecorder(5))
+	mock := &mockPatroni{parameters: map[string]string{}}
+	cluster.patroni = mock
+
+	_, err = client.Pods(namespace).Create(context.TODO(), &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: clusterName + "-0", Namespace: namespace, Labels: cluster.labelsSet(false)},
+	}, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	statefulSetWithMemoryLimit := func(limit string) *appsv1.StatefulSet {
+		return &appsv1.StatefulSet{
+			Spec: appsv1.StatefulSetSpec{
+				Template: v1.PodTemplateSpec{
+					Spec: v1.PodSpec{
+						Containers: []v1.Container{{
+							Name: constants.PostgresContainerName,
+							Resources: v1.ResourceRequirements{
+								Limits: v1.ResourceList{v1.ResourceMemory: resource.MustParse(limit)},
+							},
+						}},
+					},
+				},
+			},
+		}
+	}
+
+	// the derived values are set, the one of the manifest wins
+	cluster.Statefulset = statefulSetWithMemoryLimit("2Gi")
+	err = cluster.checkAndSetGlobalPostgreSQLConfiguration(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"shared_buffers":       "512MB",
+		"effective_cache_size": "1GB",
+		"maintenance_work_mem": "102MB",
+	}, mock.setOptions)
+
+	// a changed memory limit changes the derived values
+	mock.parameters = mock.setOptions
+	cluster.Statefulset = statefulSetWithMemoryLimit("4Gi")
+	err = cluster.checkAndSetGlobalPostgreSQLConfiguration(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, "1024MB", mock.setOptions["shared_buffers"])
+	assert.Equal(t, "204MB", mock.setOptions["maintenance_work_mem"])
+
+	// nothing is derived unless enabled
+	mock.setOptions = nil
+	cluster.Spec.EnableMemoryTuning = false
+	err = cluster.checkAndSetGlobalPostgreSQLConfiguration(context.TODO())
+	assert.NoError(t, err)
+	assert.Nil(t, mock.setOptions)
+}
+
+func TestCheckAndSetGlobalPostgreSQLConfigurationLogging(t *testing.T) {
+	clientSet := k8sFake.NewSimpleClientset()
+	acidClientSet := fakeacidv1.NewSimpleClientset()
+	client := k8sutil.KubernetesClient{
+		PodsGetter:        clientSet.CoreV1(),
+		PostgresqlsGetter: acidClientSet.AcidV1(),
+	}
+	clusterName := "acid-test-cluster"
+	namespace := "default"
+	recorder := record.NewFakeRecorder(1)
+
+	// a window two days ahead is never open now
+	window := acidv1.MaintenanceWindow{
+		Weekday:   (time.Now().UTC().Weekday() + 2) % 7,
+		StartTime: metav1.Time{Time: time.Date(0, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		EndTime:   metav1.Time{Time: time.Date(0, time.January, 1, 23, 0, 0, 0, time.UTC)},
+	}
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterName,
+			Namespace: namespace,
+		},
+		Spec: acidv1.PostgresSpec{
+			PostgresqlParam: acidv1.PostgresqlParam{
+				Parameters: map[string]string{
+					"log_min_duration_statement": "250",
+					"logging_collector":          "on",
+					"work_mem":                   "16MB",
+				},
+			},
+			MaintenanceWindows:     []acidv1.MaintenanceWindow{window},
+			DeferRestartParameters: true,
+		},
+	}
+	_, err := acidClientSet.AcidV1().Postgresqls(namespace).Create(context.TODO(), &pg, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				Resources: config.Resources{
+					ClusterLabels:    map[string]string{"application": "spilo"},
+					ClusterNameLabel: "cluster-name",
+					PodRoleLabel:     "spilo-role",
+				},
+			},
+		}, client, pg, logger, recorder)
+	mock := &mockPatroni{parameters: map[string]string{"log_min_duration_statement": "-1", "logging_collector": "off"}}
+	cluster.patroni = mock
+
+	for i := 0; i < 2; i++ {
+		_, err = client.Pods(namespace).Create(context.TODO(), &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("%s-%d", clusterName, i), Namespace: namespace, Labels: cluster.labelsSet(false)},
+		}, metav1.CreateOptions{})
+		assert.NoError(t, err)
+	}
+
+	// outside of the maintenance window the reload-safe option is set and reloaded on every pod, the one
+	// requiring a restart is deferred and the other parameters stay in the local configuration
+	err = cluster.checkAndSetGlobalPostgreSQLConfiguration(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"log_min_duration_statement": "250"}, mock.setOptions)
+	assert.Equal(t, []string{clusterName + "-0", clusterName + "-1"}, mock.reloads)
+	updated, err := acidClientSet.AcidV1().Postgresqls(namespace).Get(context.TODO(), clusterName, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "waiting for the next maintenance window to set logging_collector=on", updated.Status.Conditions[0].Message)
+
+	// without maintenance windows the option requiring a restart is set and recorded, nothing is reloaded
+	// for the unchanged ones
+	mock.parameters = map[string]string{"log_min_duration_statement": "250", "logging_collector": "off"}
+	mock.reloads = nil
+	cluster.Spec.MaintenanceWindows = nil
+	err = cluster.checkAndSetGlobalPostgreSQLConfiguration(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"log_min_duration_statement": "250", "logging_collector": "on"}, mock.setOptions)
+	assert.Empty(t, mock.reloads)
+	assert.Equal(t, "Normal Parameters Set logging_collector=on requiring a restart of Postgres", <-recorder.Events)
+}
+
+func TestCheckAndSetGlobalPostgreSQLConfigurationSharedPreloadLibraries(t *testing.T) {
+	clientSet := k8sFake.NewSimpleClientset()
+	acidClientSet := fakeacidv1.NewSimpleClientset()
+	client := k8sutil.KubernetesClient{
+		PodsGetter:        clientSet.CoreV1(),
+		PostgresqlsGetter: acidClientSet.AcidV1(),
+	}
+	clusterName := "acid-test-cluster"
+	namespace := "default"
+	recorder := record.NewFakeRecorder(1)
+
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterName,
+			Namespace: namespace,
+		},
+		Spec: acidv1.PostgresSpec{
+			PostgresqlParam: acidv1.PostgresqlParam{
+				Parameters: map[string]string{"shared_preload_libraries": "pg_stat_statements, pg_cron"},
+			},
+		},
+	}
+	_, err := acidClientSet.AcidV1().Postgresqls(namespace).Create(context.TODO(), &pg, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				Resources: config.Resources{
+					ClusterLabels:    map[string]string{"application": "spilo"},
+					ClusterNameLabel: "cluster-name",
+					PodRoleLabel:     "spilo-role",
+				},
+			},
+		}, client, pg, logger, recorder)
+	mock := &mockPatroni{parameters: map[string]string{"shared_preload_libraries": "bg_mon,pg_stat_statements"}}
+	cluster.patroni = mock
+
+	for i, role := range []PostgresRole{Master, Replica} {
+		labels := cluster.labelsSet(false)
+		labels["spilo-role"] = string(role)
+		_, err = client.Pods(namespace).Create(context.TODO(), &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("%s-%d", clusterName, i), Namespace: namespace, Labels: labels},
+		}, metav1.CreateOptions{})
+		assert.NoError(t, err)
+	}
+
+	// the new library is appended to the loaded ones and a restart of every pod is scheduled, the master last
+	err = cluster.checkAndSetGlobalPostgreSQLConfiguration(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"shared_preload_libraries": "bg_mon,pg_stat_statements,pg_cron"}, mock.setOptions)
+	assert.Len(t, mock.restarts, 2)
+	assert.True(t, mock.restarts[clusterName+"-0"].After(mock.restarts[clusterName+"-1"]))
+	assert.Equal(t, "Normal Restart Scheduled a restart of Postgres to load pg_cron", <-recorder.Events)
+
+	assert.True(t, cluster.syncDrift)
+
+	// once loaded no further restart is scheduled and the parameters are not reported as drift
+	mock.parameters = mock.setOptions
+	mock.restarts = nil
+	cluster.syncDrift = false
+	err = cluster.checkAndSetGlobalPostgreSQLConfiguration(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, "bg_mon,pg_stat_statements,pg_cron", mock.setOptions["shared_preload_libraries"])
+	assert.Empty(t, mock.restarts)
+	assert.False(t, cluster.syncDrift)
+
+	// a library removed from the manifest is removed from the loaded ones, the defaults of Spilo are kept
+	oldSpec := cluster.Spec
+	cluster.Spec.Parameters = map[string]string{"shared_preload_libraries": "pg_stat_statements"}
+	cluster.trackRemovedLibraries(&oldSpec, &cluster.Spec)
+	err = cluster.checkAndSetGlobalPostgreSQLConfiguration(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, "bg_mon,pg_stat_statements", mock.setOptions["shared_preload_libraries"])
+	assert.Empty(t, mock.restarts, "no restart is scheduled before the previous one is due")
+
+	// a restart that could not be scheduled is scheduled again by the next sync
+	cluster.librariesRestartAt = time.Time{}
+	mock.restartErr = fmt.Errorf("could not reach Patroni")
+	err = cluster.checkAndSetGlobalPostgreSQLConfiguration(context.TODO())
+	assert.Error(t, err)
+	mock.restartErr = nil
+	err = cluster.checkAndSetGlobalPostgreSQLConfiguration(context.TODO())
+	assert.NoError(t, err)
+	assert.Len(t, mock.restarts, 2)
+	assert.Equal(t, "Normal Restart Scheduled a restart of Postgres to unload pg_cron", <-recorder.Events)
+
+	// once Postgres no longer loads the library it is forgotten
+	mock.parameters = mock.setOptions
+	err = cluster.checkAndSetGlobalPostgreSQLConfiguration(context.TODO())
+	assert.NoError(t, err)
+	assert.Empty(t, cluster.removedLibraries)
+}
+
+func TestCheckAndSetGlobalPostgreSQLConfigurationAudit(t *testing.T) {
+	clientSet := k8sFake.NewSimpleClientset()
+	acidClientSet := fakeacidv1.NewSimpleClientset()
+	client := k8sutil.KubernetesClient{
+		PodsGetter:        clientSet.CoreV1(),
+		PostgresqlsGetter: acidClientSet.AcidV1(),
+	}
+	clusterName := "acid-test-cluster"
+	namespace := "default"
+	recorder := record.NewFakeRecorder(2)
+
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterName,
+			Namespace: namespace,
+		},
+		Spec: acidv1.PostgresSpec{
+			PostgresqlParam: acidv1.PostgresqlParam{
+				Parameters: map[string]string{"shared_preload_libraries": "pg_cron"},
+			},
+			Audit: &acidv1.Audit{
+				Log:          []string{"ddl", "role"},
+				LogParameter: true,
+				Role:         "auditor",
+			},
+		},
+	}
+	_, err := acidClientSet.AcidV1().Postgresqls(namespace).Create(context.TODO(), &pg, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				Resources: config.Resources{
+					ClusterLabels:    map[string]string{"application": "spilo"},
+					ClusterNameLabel: "cluster-name",
+					PodRoleLabel:     "spilo-role",
+				},
+			},
+		}, client, pg, logger, recorder)
+	mock := &mockPatroni{parameters: map[string]string{"shared_preload_libraries": "bg_mon"}}
+	cluster.patroni = mock
+
+	for i, role := range []PostgresRole{Master, Replica} {
+		labels := cluster.labelsSet(false)
+		labels["spilo-role"] = string(role)
+		_, err = client.Pods(namespace).Create(context.TODO(), &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("%s-%d", clusterName, i), Namespace: namespace, Labels: labels},
+		}, metav1.CreateOptions{})
+		assert.NoError(t, err)
+	}
+
+	// pgaudit is preloaded after the libraries of the manifest with a restart, its settings are reloaded
+	err = cluster.checkAndSetGlobalPostgreSQLConfiguration(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"shared_preload_libraries": "bg_mon,pg_cron,pgaudit",
+		"pgaudit.log":              "ddl,role",
+		"pgaudit.log_catalog":      "on",
+		"pgaudit.log_parameter":    "on",
+		"pgaudit.log_relation":     "off",
+		"pgaudit.role":             "auditor",
+	}, mock.setOptions)
+	assert.Len(t, mock.restarts, 2)
+	assert.Equal(t, []string{clusterName + "-0", clusterName + "-1"}, mock.reloads)
+	assert.Equal(t, "Normal Restart Scheduled a restart of Postgres to load pg_cron, pgaudit", <-recorder.Events)
+
+	// a changed setting is reloaded without another restart
+	mock.parameters = mock.setOptions
+	mock.restarts = nil
+	mock.reloads = nil
+	cluster.Spec.Audit.Log = []string{"write"}
+	err = cluster.checkAndSetGlobalPostgreSQLConfiguration(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, "write", mock.setOptions["pgaudit.log"])
+	assert.Empty(t, mock.restarts)
+	assert.Equal(t, []string{clusterName + "-0", clusterName + "-1"}, mock.reloads)
+
+	// removing the section turns the audit log off, the library stays loaded
+	mock.reloads = nil
+	cluster.Spec.Audit = nil
+	err = cluster.disableAuditLogging(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"pgaudit.log": "none"}, mock.setOptions)
+	assert.Equal(t, []string{clusterName + "-0", clusterName + "-1"}, mock.reloads)
+
+	// the sync leaves an audit log that is off alone
+	mock.parameters = mock.setOptions
+	mock.setOptions = nil
+	mock.reloads = nil
+	err = cluster.disableAuditLogging(context.TODO())
+	assert.NoError(t, err)
+	assert.Nil(t, mock.setOptions)
+	assert.Empty(t, mock.reloads)
+}
+
+func TestDeferRollingUpdate(t *testing.T) {
+	acidClientSet := fakeacidv1.NewSimpleClientset()
+	client := k8sutil.KubernetesClient{
+		PostgresqlsGetter: acidClientSet.AcidV1(),
+	}
+	clusterName := "acid-test-cluster"
+	namespace := "default"
+
+	now := time.Date(2021, time.March, 3, 12, 0, 0, 0, time.UTC)
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterName,
+			Namespace: namespace,
+		},
+		Spec: acidv1.PostgresSpec{
+			MaintenanceWindows: []acidv1.MaintenanceWindow{{
+				Everyday:  true,
+				StartTime: metav1.Time{Time: time.Date(0, time.January, 1, 1, 0, 0, 0, time.UTC)},
+				EndTime:   metav1.Time{Time: time.Date(0, time.January, 1, 6, 0, 0, 0, time.UTC)},
+			}},
+		},
+	}
+	_, err := acidClientSet.AcidV1().Postgresqls(namespace).Create(context.TODO(), &pg, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	var cluster = New(Config{}, client, pg, logger, eventRecorder)
+
+	// rolling updates are only deferred when asked for
+	assert.False(t, cluster.deferRollingUpdate(now))
+	cluster.Spec.DeferRollingUpdates = true
+	assert.True(t, cluster.deferRollingUpdate(now))
+	assert.False(t, cluster.deferRollingUpdate(now.Add(-8*time.Hour)))
+	cluster.Spec.MaintenanceWindowsTimezone = "America/New_York"
+	assert.False(t, cluster.deferRollingUpdate(now.Add(-4*time.Hour)))
+
+	// the condition is only reported once a rolling update got deferred
+	err = cluster.setRestartPendingCondition(false)
+	assert.NoError(t, err)
+	assert.Empty(t, cluster.Status.Conditions)
+
+	err = cluster.setRestartPendingCondition(true)
+	assert.NoError(t, err)
+	updated, err := acidClientSet.AcidV1().Postgresqls(namespace).Get(context.TODO(), clusterName, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, updated.Status.Conditions, 1)
+	assert.Equal(t, acidv1.ClusterConditionRestartPending, updated.Status.Conditions[0].Type)
+	assert.Equal(t, v1.ConditionTrue, updated.Status.Conditions[0].Status)
+
+	err = cluster.setRestartPendingCondition(false)
+	assert.NoError(t, err)
+	assert.Equal(t, v1.ConditionFalse, cluster.Status.Conditions[0].Status)
+	assert.Equal(t, acidv1.ClusterConditionReasonNoRestartPending, cluster.Status.Conditions[0].Reason)
+}
+
+func TestSyncStatefulSetKeepsRollingUpdateFlag(t *testing.T) {
+	clientSet := k8sFake.NewSimpleClientset()
+	client := k8sutil.KubernetesClient{
+		PodsGetter:           clientSet.CoreV1(),
+		ResourceQuotasGetter: clientSet.CoreV1(),
+		StatefulSetsGetter:   clientSet.AppsV1(),
+	}
+	clusterName := "acid-test-cluster"
+	namespace := "default"
+
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterName,
+			Namespace: namespace,
+		},
+		Spec: acidv1.PostgresSpec{
+			NumberOfInstances: 1,
+			Volume: acidv1.Volume{
+				Size: "1Gi",
+			},
+		},
+	}
+
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				PodManagementPolicy: "ordered_ready",
+				Resources: config.Resources{
+					ClusterLabels:        map[string]string{"application": "spilo"},
+					ClusterNameLabel:     "cluster-name",
+					DefaultCPURequest:    "300m",
+					DefaultCPULimit:      "300m",
+					DefaultMemoryRequest: "300Mi",
+					DefaultMemoryLimit:   "300Mi",
+					PodRoleLabel:         "spilo-role",
+				},
+			},
+		}, client, pg, logger, eventRecorder)
+
+	sts, err := cluster.createStatefulSet(context.TODO())
+	assert.NoError(t, err)
+
+	// the statefulset is in the desired state, but its pod still runs an outdated image
+	pod := v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterName + "-0",
+			Namespace: namespace,
+			Labels:    cluster.labelsSet(false),
+		},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{{Name: "postgres", Image: "spilo:outdated"}},
+		},
+	}
+	_, err = clientSet.CoreV1().Pods(namespace).Create(context.TODO(), &pod, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	// setting the Postgres options fails before the pods are recreated
+	cluster.Spec.Parameters = map[string]string{"max_connections": "abc"}
+	err = cluster.syncStatefulSet(context.TODO())
+	assert.Error(t, err)
+
+	updatedSts, err := client.StatefulSets(namespace).Get(context.TODO(), sts.Name, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "true", updatedSts.Annotations[rollingUpdateStatefulsetAnnotationKey])
+
+	// the next sync still finds the rolling update pending
+	assert.True(t, cluster.mergeRollingUpdateFlagUsingCache(updatedSts))
+
+	// the flag is kept as well when the step failed because its context expired
+	updatedSts.Annotations[rollingUpdateStatefulsetAnnotationKey] = "false"
+	_, err = client.StatefulSets(namespace).Update(context.TODO(), updatedSts, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+	expiredCtx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	<-expiredCtx.Done()
+	err = cluster.syncStatefulSet(expiredCtx)
+	assert.Error(t, err)
+	updatedSts, err = client.StatefulSets(namespace).Get(context.TODO(), sts.Name, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "true", updatedSts.Annotations[rollingUpdateStatefulsetAnnotationKey])
+}
+
+// vetoingSyncHooks records the statefulsets and pods it was asked about and vetoes the phases
+type vetoingSyncHooks struct {
+	NoopSyncHooks
+	current, desired *appsv1.StatefulSet
+	pods             []v1.Pod
+}
+
+func (h *vetoingSyncHooks) BeforeStatefulSetUpdate(ctx context.Context, cluster spec.NamespacedName, current, desired *appsv1.StatefulSet) error {
+	h.current, h.desired = current, desired
+	return fmt.Errorf("change freeze")
+}
+
+func (h *vetoingSyncHooks) BeforeRollingUpdate(ctx context.Context, cluster spec.NamespacedName, pods []v1.Pod) error {
+	h.pods = pods
+	return fmt.Errorf("change freeze")
+}
+
+func TestSyncHooksVeto(t *testing.T) {
+	clientSet := k8sFake.NewSimpleClientset()
+	client := k8sutil.KubernetesClient{
+		PodsGetter:           clientSet.CoreV1(),
+		ResourceQuotasGetter: clientSet.CoreV1(),
+		StatefulSetsGetter:   clientSet.AppsV1(),
+	}
+	clusterName := "acid-test-cluster"
+	namespace := "default"
+
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterName,
+			Namespace: namespace,
+		},
+		Spec: acidv1.PostgresSpec{
+			NumberOfInstances: 1,
+			Volume: acidv1.Volume{
+				Size: "1Gi",
+			},
+		},
+	}
+
+	hooks := &vetoingSyncHooks{}
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				PodManagementPolicy: "ordered_ready",
+				Resources: config.Resources{
+					ClusterLabels:        map[string]string{"application": "spilo"},
+					ClusterNameLabel:     "cluster-name",
+					DefaultCPURequest:    "300m",
+					DefaultCPULimit:      "300m",
+					DefaultMemoryRequest: "300Mi",
+					DefaultMemoryLimit:   "300Mi",
+					PodRoleLabel:         "spilo-role",
+				},
+			},
+			SyncHooks: hooks,
+		}, client, pg, logger, eventRecorder)
+	cluster.patroni = &mockPatroni{}
+
+	sts, err := cluster.createStatefulSet(context.TODO())
+	assert.NoError(t, err)
+
+	// scaling the statefulset is vetoed, it is left as is
+	cluster.Spec.NumberOfInstances = 2
+	err = cluster.syncStatefulSet(context.TODO())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "statefulset update vetoed: change freeze")
+	assert.Equal(t, int32(1), *hooks.current.Spec.Replicas)
+	assert.Equal(t, int32(2), *hooks.desired.Spec.Replicas)
+
+	updatedSts, err := client.StatefulSets(namespace).Get(context.TODO(), sts.Name, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), *updatedSts.Spec.Replicas)
+
+	// recreating the pods is vetoed, they are kept
+	pod := v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterName + "-0",
+			Namespace: namespace,
+			Labels:    cluster.labelsSet(false),
+		},
+	}
+	_, err = clientSet.CoreV1().Pods(namespace).Create(context.TODO(), &pod, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	err = cluster.recreatePods(context.TODO())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "rolling update vetoed: change freeze")
+	assert.Len(t, hooks.pods, 1)
+	_, err = clientSet.CoreV1().Pods(namespace).Get(context.TODO(), pod.Name, metav1.GetOptions{})
+	assert.NoError(t, err)
+
+	// without hooks every phase is allowed
+	cluster.Config.SyncHooks = nil
+	assert.NoError(t, cluster.syncHooks().BeforeRollingUpdate(context.TODO(), cluster.clusterName(), nil))
+}
+
+func TestResourceQuotaCheck(t *testing.T) {
+	clientSet := k8sFake.NewSimpleClientset()
+	client := k8sutil.KubernetesClient{
+		ResourceQuotasGetter: clientSet.CoreV1(),
+		StatefulSetsGetter:   clientSet.AppsV1(),
+	}
+	namespace := "default"
+	recorder := record.NewFakeRecorder(1)
+
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "acid-test-cluster",
+			Namespace: namespace,
+		},
+		Spec: acidv1.PostgresSpec{
+			NumberOfInstances: 2,
+			Volume: acidv1.Volume{
+				Size: "1Gi",
+			},
+		},
+	}
+
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				PodManagementPolicy: "ordered_ready",
+				Resources: config.Resources{
+					ClusterLabels:        map[string]string{"application": "spilo"},
+					ClusterNameLabel:     "cluster-name",
+					DefaultCPURequest:    "300m",
+					DefaultCPULimit:      "300m",
+					DefaultMemoryRequest: "300Mi",
+					DefaultMemoryLimit:   "300Mi",
+					PodRoleLabel:         "spilo-role",
+				},
+			},
+		}, client, pg, logger, recorder)
+
+	quota := &v1.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "compute",
+			Namespace: namespace,
+		},
+		Status: v1.ResourceQuotaStatus{
+			Hard: v1.ResourceList{v1.ResourceLimitsCPU: resource.MustParse("1")},
+			Used: v1.ResourceList{v1.ResourceLimitsCPU: resource.MustParse("500m")},
+		},
+	}
+	_, err := client.ResourceQuotas(namespace).Create(context.TODO(), quota, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	// two pods with a CPU limit of 300m each do not fit into the remaining 500m
+	_, err = cluster.createStatefulSet(context.TODO())
+	assert.EqualError(t, err, `statefulset "default/acid-test-cluster" would exceed resource quota "compute": limits.cpu requested 600m, used 500m, limited to 1`)
+	assert.Contains(t, <-recorder.Events, "Warning ResourceQuota statefulset")
+
+	quota.Status.Hard[v1.ResourceLimitsCPU] = resource.MustParse("2")
+	_, err = client.ResourceQuotas(namespace).Update(context.TODO(), quota, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+
+	sts, err := cluster.createStatefulSet(context.TODO())
+	assert.NoError(t, err)
+
+	// scaling up only requests the resources of the additional pod and its volume
+	cluster.Spec.NumberOfInstances = 3
+	desiredSts, err := cluster.generateStatefulSet(&cluster.Spec, nil)
+	assert.NoError(t, err)
+
+	usage := statefulSetQuotaUsage(sts, desiredSts)
+	pods := usage[v1.ResourcePods]
+	cpu := usage[v1.ResourceLimitsCPU]
+	storage := usage[v1.ResourceRequestsStorage]
+	assert.Equal(t, int64(1), pods.Value())
+	assert.Equal(t, int64(300), cpu.MilliValue())
+	assert.Equal(t, int64(1<<30), storage.Value())
+}
+
+func TestForceResync(t *testing.T) {
+	clientSet := k8sFake.NewSimpleClientset()
+	acidClientSet := fakeacidv1.NewSimpleClientset()
+	client := k8sutil.KubernetesClient{
+		PodsGetter:         clientSet.CoreV1(),
+		StatefulSetsGetter: clientSet.AppsV1(),
+		PostgresqlsGetter:  acidClientSet.AcidV1(),
+	}
+	clusterName := "acid-test-cluster"
+	namespace := "default"
+
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        clusterName,
+			Namespace:   namespace,
+			Annotations: map[string]string{constants.ForceResyncAnnotationKey: "true"},
+		},
+		Status: acidv1.PostgresStatus{
+			PostgresClusterStatus: acidv1.ClusterStatusRunning,
+			Members:               []acidv1.MemberStatus{{Name: clusterName + "-0", Role: "leader", State: "running"}},
+		},
+	}
+	_, err := acidClientSet.AcidV1().Postgresqls(namespace).Create(context.TODO(), &pg, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				Resources: config.Resources{
+					ClusterLabels:    map[string]string{"application": "spilo"},
+					ClusterNameLabel: "cluster-name",
+				},
+			},
+		}, client, pg, logger, eventRecorder)
+	assert.True(t, cluster.forceResyncRequested())
+
+	sset := appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        clusterName,
+			Namespace:   namespace,
+			Annotations: map[string]string{rollingUpdateStatefulsetAnnotationKey: "false"},
+		},
+		Status: appsv1.StatefulSetStatus{UpdateRevision: "rev2"},
+	}
+	_, err = clientSet.AppsV1().StatefulSets(namespace).Create(context.TODO(), &sset, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	// the cached state diverges from the live objects
+	cluster.Statefulset = &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: clusterName, Namespace: namespace}}
+	cluster.Status = acidv1.PostgresStatus{}
+	err = cluster.refreshCachedState(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, "false", cluster.Statefulset.Annotations[rollingUpdateStatefulsetAnnotationKey])
+	assert.Equal(t, pg.Status.Members, cluster.Status.Members)
+
+	for i, revision := range []string{"rev2", "rev1"} {
+		pod := v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("%s-%d", clusterName, i),
+				Namespace: namespace,
+				Labels:    labels.Merge(cluster.labelsSet(false), labels.Set{appsv1.ControllerRevisionHashLabelKey: revision}),
+			},
+		}
+		_, err = clientSet.CoreV1().Pods(namespace).Create(context.TODO(), &pod, metav1.CreateOptions{})
+		assert.NoError(t, err)
+	}
+
+	// a pod of an older revision needs to be recreated, although the flag of the statefulset is cleared
+	required, err := cluster.forcedRollingUpdateRequired(context.TODO(), cluster.Statefulset)
+	assert.NoError(t, err)
+	assert.True(t, required)
+
+	err = clientSet.CoreV1().Pods(namespace).Delete(context.TODO(), clusterName+"-1", metav1.DeleteOptions{})
+	assert.NoError(t, err)
+	required, err = cluster.forcedRollingUpdateRequired(context.TODO(), cluster.Statefulset)
+	assert.NoError(t, err)
+	assert.False(t, required)
+}
+
+func TestScaleStatefulSet(t *testing.T) {
+	clientSet := k8sFake.NewSimpleClientset()
+	client := k8sutil.KubernetesClient{
+		ResourceQuotasGetter: clientSet.CoreV1(),
+		StatefulSetsGetter:   clientSet.AppsV1(),
+	}
+	namespace := "default"
+
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "acid-test-cluster",
+			Namespace: namespace,
+		},
+		Spec: acidv1.PostgresSpec{
+			NumberOfInstances: 2,
+			Volume: acidv1.Volume{
+				Size: "1Gi",
+			},
+		},
+	}
+
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				PodManagementPolicy: "ordered_ready",
+				Resources: config.Resources{
+					ClusterLabels:        map[string]string{"application": "spilo"},
+					ClusterNameLabel:     "cluster-name",
+					DefaultCPURequest:    "300m",
+					DefaultCPULimit:      "300m",
+					DefaultMemoryRequest: "300Mi",
+					DefaultMemoryLimit:   "300Mi",
+					PodRoleLabel:         "spilo-role",
+				},
+			},
+		}, client, pg, logger, eventRecorder)
+
+	sts, err := cluster.createStatefulSet(context.TODO())
+	assert.NoError(t, err)
+	lastApplied, err := lastAppliedAnnotation(statefulSetFields(sts))
+	assert.NoError(t, err)
+	assert.Equal(t, lastApplied, sts.Annotations[constants.LastAppliedAnnotationKey], "the created statefulset is recorded")
+
+	// changing only the number of instances neither rolls nor replaces the pods
+	cluster.Spec.NumberOfInstances = 3
+	desiredSts, err := cluster.generateStatefulSet(&cluster.Spec, nil)
+	assert.NoError(t, err)
+
+	cmp := cluster.compareStatefulSetWith(desiredSts)
+	assert.False(t, cmp.match)
+	assert.False(t, cmp.rollingUpdate)
+	assert.False(t, cmp.replace)
+	assert.True(t, cmp.scaleOnly)
+
+	assert.NoError(t, cluster.scaleStatefulSet(context.TODO(), desiredSts))
+	scaledSts, err := client.StatefulSets(namespace).Get(context.TODO(), sts.Name, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), *scaledSts.Spec.Replicas)
+	assert.Equal(t, sts.Spec.Template, scaledSts.Spec.Template)
+	assert.Empty(t, manuallyChangedFields(scaledSts.Annotations, statefulSetFields(scaledSts)), "the scaled statefulset is recorded")
+
+	// the same holds for a change which only updates the statefulset without rolling the pods
+	cluster.Spec.ImagePullSecrets = []v1.LocalObjectReference{{Name: "registry-credentials"}}
+	cluster.Spec.NumberOfInstances = 4
+	desiredSts, err = cluster.generateStatefulSet(&cluster.Spec, nil)
+	assert.NoError(t, err)
+
+	cmp = cluster.compareStatefulSetWith(desiredSts)
+	assert.False(t, cmp.match)
+	assert.False(t, cmp.rollingUpdate)
+	assert.False(t, cmp.scaleOnly)
+
+	// a template change on top of the scaling is no longer a scale only change
+	cluster.Spec.PodPriorityClassName = "critical"
+	cluster.Spec.NumberOfInstances = 4
+	desiredSts, err = cluster.generateStatefulSet(&cluster.Spec, nil)
+	assert.NoError(t, err)
+
+	cmp = cluster.compareStatefulSetWith(desiredSts)
+	assert.True(t, cmp.rollingUpdate)
+	assert.False(t, cmp.scaleOnly)
+
+	assert.NoError(t, cluster.updateStatefulSet(context.TODO(), desiredSts))
+	updatedSts, err := client.StatefulSets(namespace).Get(context.TODO(), sts.Name, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.NotEqual(t, scaledSts.Annotations[constants.LastAppliedAnnotationKey], updatedSts.Annotations[constants.LastAppliedAnnotationKey])
+	assert.Empty(t, manuallyChangedFields(updatedSts.Annotations, statefulSetFields(updatedSts)), "the updated statefulset is recorded")
+}
+
+func TestSyncServiceAccount(t *testing.T) {
+	clientSet := k8sFake.NewSimpleClientset()
+	client := k8sutil.KubernetesClient{
+		ServiceAccountsGetter: clientSet.CoreV1(),
+		RoleBindingsGetter:    clientSet.RbacV1(),
+	}
+	namespace := "default"
+	serviceAccountName := "postgres-workload-identity"
+
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "acid-test-cluster",
+			Namespace: namespace,
+		},
+		Spec: acidv1.PostgresSpec{
+			ServiceAccountName:   serviceAccountName,
+			CreateServiceAccount: true,
+		},
+	}
+
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				Resources: config.Resources{
+					ClusterLabels:    map[string]string{"application": "spilo"},
+					ClusterNameLabel: "cluster-name",
+				},
+				PodServiceAccountName: "postgres-pod",
+			},
+			PodServiceAccountRoleBinding: &rbacv1.RoleBinding{
+				ObjectMeta: metav1.ObjectMeta{Name: "postgres-pod"},
+				RoleRef:    rbacv1.RoleRef{APIGroup: "rbac.authorization.k8s.io", Kind: "ClusterRole", Name: "postgres-pod"},
+				Subjects:   []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: "postgres-pod"}},
+			},
+		}, client, pg, logger, eventRecorder)
+
+	err := cluster.syncServiceAccount(context.TODO())
+	assert.NoError(t, err)
+
+	_, err = client.ServiceAccounts(namespace).Get(context.TODO(), serviceAccountName, metav1.GetOptions{})
+	assert.NoError(t, err)
+	roleBinding, err := client.RoleBindings(namespace).Get(context.TODO(), serviceAccountName, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "postgres-pod", roleBinding.RoleRef.Name)
+	assert.Equal(t, []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: serviceAccountName}}, roleBinding.Subjects)
+
+	// existing objects are left as they are
+	err = cluster.syncServiceAccount(context.TODO())
+	assert.NoError(t, err)
+}
+
+func TestSyncPatroniRole(t *testing.T) {
+	clientSet := k8sFake.NewSimpleClientset()
+	client := k8sutil.KubernetesClient{
+		RolesGetter:        clientSet.RbacV1(),
+		RoleBindingsGetter: clientSet.RbacV1(),
+	}
+	namespace := "default"
+	roleName := "acid-test-cluster-patroni"
+
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "acid-test-cluster",
+			Namespace: namespace,
+		},
+		Spec: acidv1.PostgresSpec{
+			CreatePatroniRole: true,
+		},
+	}
+
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				Resources: config.Resources{
+					ClusterLabels:    map[string]string{"application": "spilo"},
+					ClusterNameLabel: "cluster-name",
+				},
+				PodServiceAccountName: "postgres-pod",
+			},
+		}, client, pg, logger, eventRecorder)
+
+	err := cluster.syncPatroniRole(context.TODO())
+	assert.NoError(t, err)
+
+	role, err := client.Roles(namespace).Get(context.TODO(), roleName, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, cluster.generatePatroniRole().Rules, role.Rules)
+	assert.Equal(t, []string{"endpoints"}, role.Rules[0].Resources)
+	roleBinding, err := client.RoleBindings(namespace).Get(context.TODO(), roleName, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, roleName, roleBinding.RoleRef.Name)
+	assert.Equal(t, []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: "postgres-pod", Namespace: namespace}}, roleBinding.Subjects)
+
+	// drifted rules and a changed service account are reconciled
+	role.Rules = role.Rules[:1]
+	_, err = client.Roles(namespace).Update(context.TODO(), role, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+	cluster.Spec.ServiceAccountName = "postgres-workload-identity"
+	err = cluster.syncPatroniRole(context.TODO())
+	assert.NoError(t, err)
+	role, err = client.Roles(namespace).Get(context.TODO(), roleName, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, cluster.generatePatroniRole().Rules, role.Rules)
+	roleBinding, err = client.RoleBindings(namespace).Get(context.TODO(), roleName, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "postgres-workload-identity", roleBinding.Subjects[0].Name)
+
+	// the sync leaves both alone without the flag, the update clearing it removes them
+	cluster.Spec.CreatePatroniRole = false
+	err = cluster.syncPatroniRole(context.TODO())
+	assert.NoError(t, err)
+	_, err = client.Roles(namespace).Get(context.TODO(), roleName, metav1.GetOptions{})
+	assert.NoError(t, err)
+	err = cluster.deletePatroniRole()
+	assert.NoError(t, err)
+	_, err = client.Roles(namespace).Get(context.TODO(), roleName, metav1.GetOptions{})
+	assert.True(t, k8sutil.ResourceNotFound(err))
+	_, err = client.RoleBindings(namespace).Get(context.TODO(), roleName, metav1.GetOptions{})
+	assert.True(t, k8sutil.ResourceNotFound(err))
+
+	// a role of the same name which is not part of the cluster is kept
+	_, err = client.Roles(namespace).Create(context.TODO(), &rbacv1.Role{ObjectMeta: metav1.ObjectMeta{Name: roleName}}, metav1.CreateOptions{})
+	assert.NoError(t, err)
+	err = cluster.deletePatroniRole()
+	assert.NoError(t, err)
+	_, err = client.Roles(namespace).Get(context.TODO(), roleName, metav1.GetOptions{})
+	assert.NoError(t, err)
+}
+
+func TestSyncInstancesReady(t *testing.T) {
+	clientSet := k8sFake.NewSimpleClientset()
+	acidClientSet := fakeacidv1.NewSimpleClientset()
+	client := k8sutil.KubernetesClient{
+		PodsGetter:        clientSet.CoreV1(),
+		PostgresqlsGetter: acidClientSet.AcidV1(),
+	}
+	clusterName := "acid-test-cluster"
+	namespace := "default"
+
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterName,
+			Namespace: namespace,
+		},
+		Spec: acidv1.PostgresSpec{
+			NumberOfInstances: 2,
+		},
+	}
+	_, err := acidClientSet.AcidV1().Postgresqls(namespace).Create(context.TODO(), &pg, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				Resources: config.Resources{
+					ClusterLabels:      map[string]string{"application": "spilo"},
+					ClusterNameLabel:   "cluster-name",
+					PodRoleLabel:       "spilo-role",
+					PodAutoHealTimeout: 15 * time.Minute,
+				},
+			},
+		}, client, pg, logger, eventRecorder)
+
+	podLabels := func(role string) map[string]string {
+		labels := cluster.labelsSet(false)
+		labels["spilo-role"] = role
+		return labels
+	}
+	notReadySince := metav1.NewTime(time.Now().Add(-time.Hour))
+	for _, pod := range []*v1.Pod{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: clusterName + "-0", Namespace: namespace, Labels: podLabels("master")},
+			Status: v1.PodStatus{
+				Phase:      v1.PodRunning,
+				Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionTrue}},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: clusterName + "-1", Namespace: namespace, Labels: podLabels("replica")},
+			Status: v1.PodStatus{
+				Phase:      v1.PodRunning,
+				Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionFalse, LastTransitionTime: notReadySince}},
+				ContainerStatuses: []v1.ContainerStatus{{
+					Name:         "postgres",
+					State:        v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+					RestartCount: 7,
+				}},
+			},
+		},
+	} {
+		_, err = client.Pods(namespace).Create(context.TODO(), pod, metav1.CreateOptions{})
+		assert.NoError(t, err)
+	}
+
+	err = cluster.syncInstancesReady(context.TODO())
+	assert.NoError(t, err)
+
+	updated, err := acidClientSet.AcidV1().Postgresqls(namespace).Get(context.TODO(), clusterName, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, updated.Status.Conditions, 1)
+	condition := updated.Status.Conditions[0]
+	assert.Equal(t, acidv1.ClusterConditionInstancesReady, condition.Type)
+	assert.Equal(t, v1.ConditionFalse, condition.Status)
+	assert.Equal(t, acidv1.ClusterConditionReasonInstancesNotReady, condition.Reason)
+	assert.Equal(t, `1 of 2 instances are ready: pod "acid-test-cluster-1" has container "postgres" waiting: CrashLoopBackOff (7 restarts)`, condition.Message)
+
+	// an unchanged state keeps the transition time
+	transitionTime := cluster.Status.Conditions[0].LastTransitionTime
+	err = cluster.syncInstancesReady(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, transitionTime, cluster.Status.Conditions[0].LastTransitionTime)
+
+	// only the replica crash looping for longer than the timeout is picked for the auto-heal
+	pods, err := cluster.listPods(context.TODO())
+	assert.NoError(t, err)
+	candidate := cluster.autoHealCandidate(pods)
+	if assert.NotNil(t, candidate) {
+		assert.Equal(t, clusterName+"-1", candidate.Name)
+	}
+	cluster.OpConfig.PodAutoHealTimeout = 2 * time.Hour
+	assert.Nil(t, cluster.autoHealCandidate(pods))
+}
+
+func TestSyncCertificates(t *testing.T) {
+	clientSet := k8sFake.NewSimpleClientset()
+	client := k8sutil.KubernetesClient{
+		PodsGetter:    clientSet.CoreV1(),
+		SecretsGetter: clientSet.CoreV1(),
+	}
+	namespace := "default"
+	secretName := "acid-test-tls"
+
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "acid-test-cluster",
+			Namespace: namespace,
+		},
+		Spec: acidv1.PostgresSpec{
+			TLS: &acidv1.TLSDescription{SecretName: secretName},
+		},
+	}
+
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				Resources: config.Resources{
+					ClusterLabels:    map[string]string{"application": "spilo"},
+					ClusterNameLabel: "cluster-name",
+				},
+			},
+		}, client, pg, logger, eventRecorder)
+	cluster.patroni = &mockPatroni{}
+
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: secretName, Namespace: namespace},
+		Data:       map[string][]byte{"tls.crt": []byte("cert"), "tls.key": []byte("key")},
+	}
+	_, err := client.Secrets(namespace).Create(context.TODO(), secret, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	// the first sync only records the certificate the pods are running with
+	err = cluster.syncCertificates(context.TODO())
+	assert.NoError(t, err)
+	initialHash := cluster.tlsSecretHash
+	assert.Equal(t, tlsSecretsHash([]*v1.Secret{secret}), initialHash)
+
+	// the CA secret follows the TLS secret
+	cluster.Spec.TLS.CASecretName = "acid-test-ca"
+	_, err = cluster.getTLSSecrets(context.TODO())
+	assert.EqualError(t, err, `could not get TLS secret "acid-test-ca": secrets "acid-test-ca" not found`)
+	caSecret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "acid-test-ca", Namespace: namespace},
+		Data:       map[string][]byte{"ca.crt": []byte("ca")},
+	}
+	_, err = client.Secrets(namespace).Create(context.TODO(), caSecret, metav1.CreateOptions{})
+	assert.NoError(t, err)
+	secrets, err := cluster.getTLSSecrets(context.TODO())
+	assert.NoError(t, err)
+	if assert.Equal(t, 2, len(secrets)) {
+		assert.Equal(t, secretName, secrets[0].Name)
+		assert.Equal(t, "acid-test-ca", secrets[1].Name)
+	}
+	cluster.Spec.TLS.CASecretName = ""
+
+	// a renewed certificate is detected, there are no pods to reload
+	secret.Data["tls.crt"] = []byte("renewed cert")
+	_, err = client.Secrets(namespace).Update(context.TODO(), secret, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+	err = cluster.syncCertificates(context.TODO())
+	assert.NoError(t, err)
+	assert.NotEqual(t, initialHash, cluster.tlsSecretHash)
+
+	// a certificate file missing in the secret is reported
+	cluster.Spec.TLS.CertificateFile = "server.crt"
+	secret.Data["tls.crt"] = []byte("cert")
+	_, err = client.Secrets(namespace).Update(context.TODO(), secret, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+	err = cluster.syncCertificates(context.TODO())
+	assert.EqualError(t, err, `TLS secret "acid-test-tls" has no key "server.crt"`)
+
+	// removing TLS from the manifest forgets the certificate
+	cluster.Spec.TLS = nil
+	err = cluster.syncCertificates(context.TODO())
+	assert.NoError(t, err)
+	assert.Empty(t, cluster.tlsSecretHash)
+}
+
+// selfSignedCertificate returns the PEM encoded certificate and private key of a self-signed certificate
+func selfSignedCertificate(t *testing.T) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "acid-test-cluster-0"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+func TestSyncPatroniAPITLS(t *testing.T) {
+	clientSet := k8sFake.NewSimpleClientset()
+	client := k8sutil.KubernetesClient{
+		PodsGetter:    clientSet.CoreV1(),
+		SecretsGetter: clientSet.CoreV1(),
+	}
+	namespace := "default"
+	secretName := "acid-test-patroni-api-tls"
+
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "acid-test-cluster",
+			Namespace: namespace,
+		},
+		Spec: acidv1.PostgresSpec{
+			Patroni: acidv1.Patroni{
+				APITLS: &acidv1.PatroniAPITLS{SecretName: secretName},
+			},
+		},
+	}
+
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				Resources: config.Resources{
+					ClusterLabels:    map[string]string{"application": "spilo"},
+					ClusterNameLabel: "cluster-name",
+				},
+			},
+		}, client, pg, logger, eventRecorder)
+	mock := &mockPatroni{}
+	cluster.patroni = mock
+
+	// the secret has to exist
+	err := cluster.syncPatroniAPITLS(context.TODO())
+	assert.Error(t, err)
+	assert.Nil(t, mock.tlsConfig)
+
+	cert, key := selfSignedCertificate(t)
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: secretName, Namespace: namespace},
+		Data:       map[string][]byte{"tls.crt": cert, "tls.key": key},
+	}
+	_, err = client.Secrets(namespace).Create(context.TODO(), secret, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	// the first sync configures the client, the self-signed certificate is pinned
+	err = cluster.syncPatroniAPITLS(context.TODO())
+	assert.NoError(t, err)
+	assert.NotNil(t, mock.tlsConfig)
+	assert.Equal(t, tlsSecretsHash([]*v1.Secret{secret}), cluster.patroniAPITLSHash)
+	assert.Equal(t, cert, cluster.patroniAPICA)
+
+	// an unchanged secret keeps the configuration
+	configured := mock.tlsConfig
+	err = cluster.syncPatroniAPITLS(context.TODO())
+	assert.NoError(t, err)
+	assert.True(t, configured == mock.tlsConfig)
+
+	// a renewed certificate is picked up, there are no pods to reload
+	renewedCert, renewedKey := selfSignedCertificate(t)
+	secret.Data = map[string][]byte{"tls.crt": renewedCert, "tls.key": renewedKey}
+	_, err = client.Secrets(namespace).Update(context.TODO(), secret, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+	err = cluster.syncPatroniAPITLS(context.TODO())
+	assert.NoError(t, err)
+	assert.False(t, configured == mock.tlsConfig)
+	assert.Equal(t, tlsSecretsHash([]*v1.Secret{secret}), cluster.patroniAPITLSHash)
+	assert.Equal(t, renewedCert, cluster.patroniAPICA)
+
+	// a CA file missing in the secret is reported
+	cluster.Spec.Patroni.APITLS.CAFile = "ca.crt"
+	cluster.patroniAPITLSHash = ""
+	err = cluster.syncPatroniAPITLS(context.TODO())
+	assert.EqualError(t, err, `Patroni API TLS secret "acid-test-patroni-api-tls" has no CA key "ca.crt"`)
+
+	// removing TLS from the manifest switches back to plain HTTP
+	cluster.Spec.Patroni.APITLS = nil
+	cluster.patroniAPITLSHash = "outdated"
+	err = cluster.syncPatroniAPITLS(context.TODO())
+	assert.NoError(t, err)
+	assert.Nil(t, mock.tlsConfig)
+	assert.Empty(t, cluster.patroniAPITLSHash)
+}
+
+func TestSyncPodMonitor(t *testing.T) {
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	client := k8sutil.KubernetesClient{DynamicClient: dynamicClient}
+	clusterName := "acid-test-cluster"
+	namespace := "default"
+
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterName,
+			Namespace: namespace,
+		},
+		Spec: acidv1.PostgresSpec{
+			MetricsExporter: &acidv1.MetricsExporter{Sidecar: "exporter", Port: 9187, PodMonitor: true},
+		},
+	}
+
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				Resources: config.Resources{
+					ClusterLabels:    map[string]string{"application": "spilo"},
+					ClusterNameLabel: "cluster-name",
+				},
+			},
+		}, client, pg, logger, eventRecorder)
+	podMonitors := dynamicClient.Resource(podMonitorResource).Namespace(namespace)
+
+	// the pod monitor selects the pods of the cluster and scrapes their metrics port
+	err := cluster.syncPodMonitor(context.TODO())
+	assert.NoError(t, err)
+	podMonitor, err := podMonitors.Get(context.TODO(), clusterName, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "PodMonitor", podMonitor.GetKind())
+	assert.Equal(t, map[string]string(cluster.labelsSet(true)), podMonitor.GetLabels())
+	matchLabels, _, _ := unstructured.NestedStringMap(podMonitor.Object, "spec", "selector", "matchLabels")
+	assert.Equal(t, map[string]string(cluster.labelsSet(false)), matchLabels)
+	endpoints, _, _ := unstructured.NestedSlice(podMonitor.Object, "spec", "podMetricsEndpoints")
+	assert.Equal(t, []interface{}{map[string]interface{}{"port": "metrics", "path": "/metrics"}}, endpoints)
+
+	// a changed metrics path is updated
+	cluster.Spec.MetricsExporter.Path = "/custom"
+	err = cluster.syncPodMonitor(context.TODO())
+	assert.NoError(t, err)
+	podMonitor, err = podMonitors.Get(context.TODO(), clusterName, metav1.GetOptions{})
+	assert.NoError(t, err)
+	endpoints, _, _ = unstructured.NestedSlice(podMonitor.Object, "spec", "podMetricsEndpoints")
+	assert.Equal(t, "/custom", endpoints[0].(map[string]interface{})["path"])
+
+	// switching it off deletes the pod monitor
+	cluster.Spec.MetricsExporter.PodMonitor = false
+	err = cluster.syncPodMonitor(context.TODO())
+	assert.NoError(t, err)
+	_, err = podMonitors.Get(context.TODO(), clusterName, metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+
+	// without the CRDs of the Prometheus operator the pod monitor is skipped
+	dynamicClient.PrependReactor("create", "podmonitors", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewNotFound(schema.GroupResource{Group: "monitoring.coreos.com", Resource: "podmonitors"}, clusterName)
+	})
+	cluster.Spec.MetricsExporter.PodMonitor = true
+	err = cluster.syncPodMonitor(context.TODO())
+	assert.NoError(t, err)
+}
+
+func TestSyncMasterTCPRoute(t *testing.T) {
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	client := k8sutil.KubernetesClient{DynamicClient: dynamicClient}
+	clusterName := "acid-test-cluster"
+	namespace := "default"
+
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterName,
+			Namespace: namespace,
+		},
+		Spec: acidv1.PostgresSpec{
+			MasterTCPRoute: &acidv1.MasterTCPRoute{GatewayName: "postgres-gateway", SectionName: "postgres"},
+		},
+	}
+
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				Resources: config.Resources{
+					ClusterLabels:    map[string]string{"application": "spilo"},
+					ClusterNameLabel: "cluster-name",
+				},
+			},
+		}, client, pg, logger, eventRecorder)
+	tcpRoutes := dynamicClient.Resource(tcpRouteResource).Namespace(namespace)
+
+	// the route is attached to the listener of the gateway and routes to the master service
+	err := cluster.syncMasterTCPRoute(context.TODO())
+	assert.NoError(t, err)
+	tcpRoute, err := tcpRoutes.Get(context.TODO(), clusterName, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "TCPRoute", tcpRoute.GetKind())
+	assert.Equal(t, map[string]string(cluster.labelsSet(true)), tcpRoute.GetLabels())
+	parentRefs, _, _ := unstructured.NestedSlice(tcpRoute.Object, "spec", "parentRefs")
+	assert.Equal(t, []interface{}{map[string]interface{}{"name": "postgres-gateway", "sectionName": "postgres"}}, parentRefs)
+	rules, _, _ := unstructured.NestedSlice(tcpRoute.Object, "spec", "rules")
+	assert.Equal(t, []interface{}{map[string]interface{}{
+		"backendRefs": []interface{}{map[string]interface{}{"name": clusterName, "port": int64(5432)}},
+	}}, rules)
+
+	// the defaults of the Gateway API do not count as a change
+	parentRefs[0].(map[string]interface{})["group"] = "gateway.networking.k8s.io"
+	parentRefs[0].(map[string]interface{})["kind"] = "Gateway"
+	assert.NoError(t, unstructured.SetNestedSlice(tcpRoute.Object, parentRefs, "spec", "parentRefs"))
+	backendRef := rules[0].(map[string]interface{})["backendRefs"].([]interface{})[0].(map[string]interface{})
+	backendRef["group"] = ""
+	backendRef["kind"] = "Service"
+	backendRef["weight"] = int64(1)
+	assert.NoError(t, unstructured.SetNestedSlice(tcpRoute.Object, rules, "spec", "rules"))
+	_, err = tcpRoutes.Update(context.TODO(), tcpRoute, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+	dynamicClient.ClearActions()
+	err = cluster.syncMasterTCPRoute(context.TODO())
+	assert.NoError(t, err)
+	for _, action := range dynamicClient.Actions() {
+		assert.NotEqual(t, "update", action.GetVerb())
+	}
+
+	// a gateway in another namespace is updated
+	cluster.Spec.MasterTCPRoute.GatewayNamespace = "gateways"
+	err = cluster.syncMasterTCPRoute(context.TODO())
+	assert.NoError(t, err)
+	tcpRoute, err = tcpRoutes.Get(context.TODO(), clusterName, metav1.GetOptions{})
+	assert.NoError(t, err)
+	parentRefs, _, _ = unstructured.NestedSlice(tcpRoute.Object, "spec", "parentRefs")
+	assert.Equal(t, "gateways", parentRefs[0].(map[string]interface{})["namespace"])
+
+	// removing it from the manifest deletes the route
+	cluster.Spec.MasterTCPRoute = nil
+	err = cluster.syncMasterTCPRoute(context.TODO())
+	assert.NoError(t, err)
+	_, err = tcpRoutes.Get(context.TODO(), clusterName, metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+
+	// a route not managed by the operator is left alone
+	foreignRoute := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": tcpRouteResource.GroupVersion().String(),
+		"kind":       "TCPRoute",
+	}}
+	foreignRoute.SetName(clusterName)
+	foreignRoute.SetNamespace(namespace)
+	_, err = tcpRoutes.Create(context.TODO(), foreignRoute, metav1.CreateOptions{})
+	assert.NoError(t, err)
+	cluster.Spec.MasterTCPRoute = &acidv1.MasterTCPRoute{GatewayName: "postgres-gateway"}
+	err = cluster.syncMasterTCPRoute(context.TODO())
+	assert.Error(t, err)
+	assert.NoError(t, cluster.deleteMasterTCPRoute(context.TODO()))
+	_, err = tcpRoutes.Get(context.TODO(), clusterName, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.NoError(t, tcpRoutes.Delete(context.TODO(), clusterName, metav1.DeleteOptions{}))
+
+	// without the CRDs of the Gateway API the route is skipped
+	dynamicClient.PrependReactor("create", "tcproutes", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewNotFound(schema.GroupResource{Group: "gateway.networking.k8s.io", Resource: "tcproutes"}, clusterName)
+	})
+	err = cluster.syncMasterTCPRoute(context.TODO())
+	assert.NoError(t, err)
+}
+
+func TestSyncSynchronousReplication(t *testing.T) {
+	clientSet := k8sFake.NewSimpleClientset()
+	acidClientSet := fakeacidv1.NewSimpleClientset()
+	client := k8sutil.KubernetesClient{
+		PodsGetter:        clientSet.CoreV1(),
+		PostgresqlsGetter: acidClientSet.AcidV1(),
+	}
+	clusterName := "acid-test-cluster"
+	namespace := "default"
+
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterName,
+			Namespace: namespace,
+		},
+		Spec: acidv1.PostgresSpec{
+			NumberOfInstances: 3,
+			Patroni: acidv1.Patroni{
+				SynchronousMode:       util.True(),
+				SynchronousModeStrict: true,
+				SynchronousNodeCount:  2,
+			},
+		},
+	}
+	_, err := acidClientSet.AcidV1().Postgresqls(namespace).Create(context.TODO(), &pg, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				Resources: config.Resources{
+					ClusterLabels:    map[string]string{"application": "spilo"},
+					ClusterNameLabel: "cluster-name",
+					MinInstances:     -1,
+					MaxInstances:     -1,
+				},
+			},
+		}, client, pg, logger, record.NewFakeRecorder(5))
+
+	// scaling below the synchronous standbys plus the master is refused
+	assert.Error(t, cluster.checkSynchronousReplicas(3, 2))
+	assert.NoError(t, cluster.checkSynchronousReplicas(3, 4))
+	// a cluster not having enough instances yet can still grow
+	assert.NoError(t, cluster.checkSynchronousReplicas(1, 2))
+	// a cluster can be stopped by scaling it to zero
+	assert.NoError(t, cluster.checkSynchronousReplicas(3, 0))
+
+	pod := v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterName + "-0",
+			Namespace: namespace,
+			Labels:    cluster.labelsSet(false),
+		},
+	}
+	_, err = clientSet.CoreV1().Pods(namespace).Create(context.TODO(), &pod, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	mock := &mockPatroni{syncMode: patroni.SynchronousMode{NodeCount: 1}}
+	cluster.patroni = mock
+	assert.NoError(t, cluster.syncSynchronousMode(context.TODO()))
+	assert.Equal(t, patroni.SynchronousMode{Enabled: true, Strict: true, NodeCount: 2}, mock.syncMode)
+	updated, err := acidClientSet.AcidV1().Postgresqls(namespace).Get(context.TODO(), clusterName, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, acidv1.SynchronousModeStrict, updated.Status.SynchronousMode)
+
+	// strict mode is not enabled without enough instances for the synchronous standbys
+	cluster.Spec.NumberOfInstances = 2
+	mock.syncMode = patroni.SynchronousMode{Enabled: true, NodeCount: 2}
+	assert.NoError(t, cluster.syncSynchronousMode(context.TODO()))
+	assert.False(t, mock.syncMode.Strict)
+	assert.Equal(t, acidv1.SynchronousModeOn, cluster.Status.SynchronousMode)
+
+	// without synchronous mode there is no minimum and Patroni replicates asynchronously
+	cluster.Spec.Patroni.SynchronousMode = util.False()
+	assert.NoError(t, cluster.checkSynchronousReplicas(3, 1))
+	assert.NoError(t, cluster.syncSynchronousMode(context.TODO()))
+	assert.Equal(t, patroni.SynchronousMode{NodeCount: 2}, mock.syncMode)
+	assert.Equal(t, acidv1.SynchronousModeOff, cluster.Status.SynchronousMode)
+
+	// a manifest leaving synchronous mode unset keeps the mode of the Patroni configuration
+	cluster.Spec.Patroni.SynchronousMode = nil
+	mock.syncMode = patroni.SynchronousMode{Enabled: true, NodeCount: 1}
+	assert.NoError(t, cluster.syncSynchronousMode(context.TODO()))
+	assert.Equal(t, patroni.SynchronousMode{Enabled: true, NodeCount: 1}, mock.syncMode)
+	assert.Equal(t, acidv1.SynchronousModeOn, cluster.Status.SynchronousMode)
+}
+
+func TestSyncMaximumLagOnFailover(t *testing.T) {
+	clientSet := k8sFake.NewSimpleClientset()
+	acidClientSet := fakeacidv1.NewSimpleClientset()
+	client := k8sutil.KubernetesClient{
+		PodsGetter:        clientSet.CoreV1(),
+		PostgresqlsGetter: acidClientSet.AcidV1(),
+	}
+	clusterName := "acid-test-cluster"
+	namespace := "default"
+
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterName,
+			Namespace: namespace,
+		},
+	}
+	_, err := acidClientSet.AcidV1().Postgresqls(namespace).Create(context.TODO(), &pg, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				Resources: config.Resources{
+					ClusterLabels:    map[string]string{"application": "spilo"},
+					ClusterNameLabel: "cluster-name",
+				},
+			},
+		}, client, pg, logger, record.NewFakeRecorder(5))
+
+	pod := v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterName + "-0",
+			Namespace: namespace,
+			Labels:    cluster.labelsSet(false),
+		},
+	}
+	_, err = clientSet.CoreV1().Pods(namespace).Create(context.TODO(), &pod, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	// without a value in the manifest the one of Patroni is kept and recorded
+	mock := &mockPatroni{maxLag: 33554432}
+	cluster.patroni = mock
+	assert.NoError(t, cluster.syncMaximumLagOnFailover(context.TODO()))
+	assert.Equal(t, int64(33554432), mock.maxLag)
+	updated, err := acidClientSet.AcidV1().Postgresqls(namespace).Get(context.TODO(), clusterName, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(33554432), *updated.Status.MaximumLagOnFailover)
+
+	// the value of the manifest is set in the Patroni configuration
+	maxLag := int64(1048576)
+	cluster.Spec.Patroni.MaximumLagOnFailover = &maxLag
+	assert.NoError(t, cluster.syncMaximumLagOnFailover(context.TODO()))
+	assert.Equal(t, int64(1048576), mock.maxLag)
+	updated, err = acidClientSet.AcidV1().Postgresqls(namespace).Get(context.TODO(), clusterName, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1048576), *updated.Status.MaximumLagOnFailover)
+}
+
+func TestSyncReplicaEndpoint(t *testing.T) {
+	clientSet := k8sFake.NewSimpleClientset()
+	client := k8sutil.KubernetesClient{
+		EndpointsGetter: clientSet.CoreV1(),
+		PodsGetter:      clientSet.CoreV1(),
+	}
+	clusterName := "acid-test-cluster"
+	namespace := "default"
+	maxLag := int64(16 * 1024 * 1024)
+
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterName,
+			Namespace: namespace,
+		},
+		Spec: acidv1.PostgresSpec{
+			ReplicaServiceMaxLag: &maxLag,
+		},
+	}
+	eventRecorder := record.NewFakeRecorder(5)
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				Resources: config.Resources{
+					ClusterLabels:    map[string]string{"application": "spilo"},
+					ClusterNameLabel: "cluster-name",
+					PodRoleLabel:     "spilo-role",
+				},
+			},
+		}, client, pg, logger, eventRecorder)
+
+	// the replica service leaves its endpoint to the operator
+	assert.Empty(t, cluster.generateService(Replica, &cluster.Spec).Spec.Selector)
+
+	for i := 0; i < 3; i++ {
+		pod := v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("%s-%d", clusterName, i),
+				Namespace: namespace,
+				Labels:    cluster.labelsSet(false),
+			},
+			Status: v1.PodStatus{PodIP: fmt.Sprintf("10.0.0.%d", i+1)},
+		}
+		_, err := clientSet.CoreV1().Pods(namespace).Create(context.TODO(), &pod, metav1.CreateOptions{})
+		assert.NoError(t, err)
+	}
+	ep, err := clientSet.CoreV1().Endpoints(namespace).Create(context.TODO(),
+		cluster.generateEndpoint(Replica, nil), metav1.CreateOptions{})
+	assert.NoError(t, err)
+	cluster.Endpoints[Replica] = ep
+
+	mock := &mockPatroni{
+		members: []patroni.ClusterMember{
+			{Name: clusterName + "-0", Role: "leader", State: "running"},
+			{Name: clusterName + "-1", Role: "replica", State: "streaming"},
+			{Name: clusterName + "-2", Role: "replica", State: "running", Lag: patroni.ReplicationLag(maxLag + 1)},
+		},
+	}
+	cluster.patroni = mock
+
+	replicaAddresses := func() []string {
+		ep, err := clientSet.CoreV1().Endpoints(namespace).Get(context.TODO(), cluster.endpointName(Replica), metav1.GetOptions{})
+		assert.NoError(t, err)
+		ips := make([]string, 0)
+		for _, subset := range ep.Subsets {
+			for _, address := range subset.Addresses {
+				ips = append(ips, address.IP)
+			}
+		}
+		return ips
+	}
+
+	// the lagging replica is left out
+	assert.NoError(t, cluster.syncReplicaEndpoint(context.TODO()))
+	assert.Equal(t, []string{"10.0.0.2"}, replicaAddresses())
+	assert.Len(t, eventRecorder.Events, 1)
+	assert.Contains(t, <-eventRecorder.Events, clusterName+"-2 exceed the maximum lag")
+
+	// the replica is added again once it has caught up
+	mock.members[2].Lag = 0
+	assert.NoError(t, cluster.syncReplicaEndpoint(context.TODO()))
+	assert.Equal(t, []string{"10.0.0.2", "10.0.0.3"}, replicaAddresses())
+	assert.Len(t, eventRecorder.Events, 0)
+
+	// without Patroni the endpoint stays as it is
+	mock.members = nil
+	mock.membersErr = fmt.Errorf("connection refused")
+	assert.Error(t, cluster.syncReplicaEndpoint(context.TODO()))
+	assert.Equal(t, []string{"10.0.0.2", "10.0.0.3"}, replicaAddresses())
+
+	// pod events request an update of the endpoint between two syncs, pending requests are merged
+	mock.membersErr = nil
+	mock.members = []patroni.ClusterMember{
+		{Name: clusterName + "-0", Role: "leader", State: "running"},
+		{Name: clusterName + "-1", Role: "replica", State: "streaming"},
+		{Name: clusterName + "-2", Role: "replica", State: "stopped"},
+	}
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, cluster.processPodEvent(PodEvent{
+			PodName:   types.NamespacedName{Namespace: namespace, Name: clusterName + "-2"},
+			EventType: PodEventUpdate,
+		}))
+	}
+	assert.Len(t, cluster.podRolesRefresh, 1)
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go cluster.processPodRolesRefresh(stopCh)
+	assert.Eventually(t, func() bool {
+		ep, err := clientSet.CoreV1().Endpoints(namespace).Get(context.TODO(), cluster.endpointName(Replica), metav1.GetOptions{})
+		return err == nil && len(ep.Subsets) == 1 && len(ep.Subsets[0].Addresses) == 1
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestSyncBackupVerification(t *testing.T) {
+	clientSet := k8sFake.NewSimpleClientset()
+	acidClientSet := fakeacidv1.NewSimpleClientset()
+	client := k8sutil.KubernetesClient{
+		CronJobsGetter:    clientSet.BatchV1beta1(),
+		JobsGetter:        clientSet.BatchV1(),
+		PostgresqlsGetter: acidClientSet.AcidV1(),
+	}
+	clusterName := "acid-test-cluster"
+	namespace := "default"
+
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterName,
+			Namespace: namespace,
+		},
+		Spec: acidv1.PostgresSpec{
+			NumberOfInstances: 1,
+			Resources: acidv1.Resources{
+				ResourceRequests: acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+				ResourceLimits:   acidv1.ResourceDescription{CPU: "1", Memory: "10"},
+			},
+			Volume:             acidv1.Volume{Size: "1Gi"},
+			BackupVerification: &acidv1.BackupVerification{Schedule: "0 3 * * *"},
+		},
+	}
+	_, err := acidClientSet.AcidV1().Postgresqls(namespace).Create(context.TODO(), &pg, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	eventRecorder := record.NewFakeRecorder(5)
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				Resources: config.Resources{
+					ClusterLabels:    map[string]string{"application": "spilo"},
+					ClusterNameLabel: "cluster-name",
+				},
+				DockerImage:  "spilo",
+				WALES3Bucket: "wal-bucket",
+			},
+		}, client, pg, logger, eventRecorder)
+
+	jobEnv := func() map[string]string {
+		cronJob, err := clientSet.BatchV1beta1().CronJobs(namespace).Get(context.TODO(),
+			cluster.getBackupVerificationJobName(), metav1.GetOptions{})
+		assert.NoError(t, err)
+		env := make(map[string]string)
+		for _, envVar := range cronJob.Spec.JobTemplate.Spec.Template.Spec.Containers[0].Env {
+			env[envVar.Name] = envVar.Value
+		}
+		return env
+	}
+	verifiedCondition := func() *acidv1.ClusterCondition {
+		for _, condition := range cluster.Status.Conditions {
+			if condition.Type == acidv1.ClusterConditionBackupVerified {
+				return &condition
+			}
+		}
+		return nil
+	}
+	finishJob := func(name string, created time.Time, result batchv1.JobConditionType, message string) {
+		job := batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         namespace,
+				Labels:            cluster.backupVerificationLabels(),
+				CreationTimestamp: metav1.NewTime(created),
+			},
+			Status: batchv1.JobStatus{
+				Conditions: []batchv1.JobCondition{{Type: result, Status: v1.ConditionTrue, Message: message}},
+			},
+		}
+		_, err := clientSet.BatchV1().Jobs(namespace).Create(context.TODO(), &job, metav1.CreateOptions{})
+		assert.NoError(t, err)
+	}
+
+	// the cron job restores the backups of the WAL archive as the postgres user of Spilo
+	assert.NoError(t, cluster.syncBackupVerification(context.TODO()))
+	cronJob, err := clientSet.BatchV1beta1().CronJobs(namespace).Get(context.TODO(),
+		cluster.getBackupVerificationJobName(), metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "0 3 * * *", cronJob.Spec.Schedule)
+	assert.Equal(t, int64(101), *cronJob.Spec.JobTemplate.Spec.Template.Spec.SecurityContext.RunAsUser)
+	assert.Equal(t, "wal-bucket", jobEnv()["WAL_S3_BUCKET"])
+	assert.Equal(t, "SELECT 1", jobEnv()["VERIFY_QUERY"])
+	dataVolume := cronJob.Spec.JobTemplate.Spec.Template.Spec.Volumes[len(cronJob.Spec.JobTemplate.Spec.Template.Spec.Volumes)-1]
+	assert.Equal(t, resource.MustParse("1Gi"), dataVolume.Ephemeral.VolumeClaimTemplate.Spec.Resources.Requests[v1.ResourceStorage])
+	assert.Nil(t, verifiedCondition())
+
+	// a failed job is reported with a warning
+	finishJob("backup-verification-1", time.Now().Add(-time.Hour), batchv1.JobFailed, "BackoffLimitExceeded")
+	assert.NoError(t, cluster.syncBackupVerification(context.TODO()))
+	assert.Equal(t, v1.ConditionFalse, verifiedCondition().Status)
+	assert.Equal(t, acidv1.ClusterConditionReasonBackupNotRestored, verifiedCondition().Reason)
+	assert.Contains(t, <-eventRecorder.Events, "Warning BackupVerification job backup-verification-1")
+
+	// the result of the newest job counts, and is announced once
+	finishJob("backup-verification-2", time.Now(), batchv1.JobComplete, "")
+	assert.NoError(t, cluster.syncBackupVerification(context.TODO()))
+	assert.NoError(t, cluster.syncBackupVerification(context.TODO()))
+	assert.Equal(t, v1.ConditionTrue, verifiedCondition().Status)
+	assert.Equal(t, acidv1.ClusterConditionReasonBackupRestored, verifiedCondition().Reason)
+	assert.Len(t, eventRecorder.Events, 1)
+	assert.Contains(t, <-eventRecorder.Events, "Normal BackupVerification job backup-verification-2")
+
+	// a changed query is patched into the cron job
+	cluster.Spec.BackupVerification.Query = "SELECT count(*) FROM pg_class"
+	assert.NoError(t, cluster.syncBackupVerification(context.TODO()))
+	assert.Equal(t, "SELECT count(*) FROM pg_class", jobEnv()["VERIFY_QUERY"])
+
+	// removing the verification deletes the cron job and its condition
+	assert.NoError(t, cluster.deleteBackupVerificationJob(context.TODO()))
+	_, err = clientSet.BatchV1beta1().CronJobs(namespace).Get(context.TODO(),
+		cluster.getBackupVerificationJobName(), metav1.GetOptions{})
+	assert.True(t, k8sutil.ResourceNotFound(err))
+	assert.Nil(t, verifiedCondition())
+
+	// without a WAL archive there is no backup to verify
+	cluster.OpConfig.WALES3Bucket = ""
+	assert.Error(t, cluster.syncBackupVerification(context.TODO()))
+}
+
+func TestSyncWithTimeout(t *testing.T) {
+	clientSet := k8sFake.NewSimpleClientset()
+	client := k8sutil.KubernetesClient{
+		PodsGetter: clientSet.CoreV1(),
+	}
+	clusterName := "acid-test-cluster"
+	namespace := "default"
+
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterName,
+			Namespace: namespace,
+		},
+		Spec: acidv1.PostgresSpec{
+			NumberOfInstances: 1,
+			Patroni:           acidv1.Patroni{SynchronousMode: util.True()},
+		},
+	}
+
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				Resources: config.Resources{
+					ClusterLabels:       map[string]string{"application": "spilo"},
+					ClusterNameLabel:    "cluster-name",
+					PodRoleLabel:        "spilo-role",
+					MinInstances:        -1,
+					MaxInstances:        -1,
+					SyncStepTimeout:     10 * time.Millisecond,
+					SyncLongStepTimeout: 20 * time.Millisecond,
+				},
+			},
+		}, client, pg, logger, record.NewFakeRecorder(5))
+
+	pod := v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterName + "-0",
+			Namespace: namespace,
+			Labels:    cluster.roleLabelsSet(false, Master),
+		},
+	}
+	_, err := clientSet.CoreV1().Pods(namespace).Create(context.TODO(), &pod, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	// a hanging Patroni API is cancelled once the step timeout is reached
+	cluster.patroni = &mockPatroni{hang: true}
+	err = cluster.syncWithTimeout(cluster.OpConfig.SyncStepTimeout, cluster.syncSynchronousMode)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "timed out after 10ms")
+
+	cluster.standbyPromotionPending = true
+	err = cluster.syncWithTimeout(cluster.OpConfig.SyncLongStepTimeout, cluster.syncStandbyPromotion)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "timed out after 20ms")
+
+	// errors of a step finishing in time are returned as they are, any failed step lets the next sync run in full
+	cluster.syncDrift = false
+	stepErr := fmt.Errorf("could not sync")
+	assert.Equal(t, stepErr, cluster.syncWithTimeout(time.Minute, func(ctx context.Context) error {
+		return stepErr
+	}))
+	assert.True(t, cluster.syncDrift)
+
+	// without a timeout the step only ends with the context cancelled after it returns
+	var stepCtx context.Context
+	assert.NoError(t, cluster.syncWithTimeout(0, func(ctx context.Context) error {
+		stepCtx = ctx
+		_, hasDeadline := ctx.Deadline()
+		assert.False(t, hasDeadline)
+		return nil
+	}))
+	assert.Equal(t, context.Canceled, stepCtx.Err())
+}
+
+func TestSyncUnchanged(t *testing.T) {
+	synced := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "acid-test-cluster",
+			Namespace:   "default",
+			Generation:  3,
+			Labels:      map[string]string{"team": "acid"},
+			Annotations: map[string]string{"owner": "acid"},
+		},
+		Status: acidv1.PostgresStatus{
+			PostgresClusterStatus: acidv1.ClusterStatusRunning,
+			ObservedGeneration:    3,
+		},
+	}
+
+	tests := []struct {
+		subTest          string
+		fullResyncPeriod time.Duration
+		lastFullSync     time.Duration
+		drift            bool
+		update           func(pg *acidv1.Postgresql)
+		unchanged        bool
+	}{
+		{
+			subTest:          "unchanged manifest",
+			fullResyncPeriod: time.Hour,
+			lastFullSync:     time.Minute,
+			unchanged:        true,
+		},
+		{
+			subTest:          "full resync period not configured",
+			fullResyncPeriod: 0,
+			lastFullSync:     time.Minute,
+			unchanged:        false,
+		},
+		{
+			subTest:          "full resync period passed",
+			fullResyncPeriod: time.Hour,
+			lastFullSync:     2 * time.Hour,
+			unchanged:        false,
+		},
+		{
+			subTest:          "drift found by the last sync",
+			fullResyncPeriod: time.Hour,
+			lastFullSync:     time.Minute,
+			drift:            true,
+			unchanged:        false,
+		},
+		{
+			subTest:          "new generation",
+			fullResyncPeriod: time.Hour,
+			lastFullSync:     time.Minute,
+			update: func(pg *acidv1.Postgresql) {
+				pg.Generation = 4
+			},
+			unchanged: false,
+		},
+		{
+			subTest:          "changed annotations",
+			fullResyncPeriod: time.Hour,
+			lastFullSync:     time.Minute,
+			update: func(pg *acidv1.Postgresql) {
+				pg.Annotations = map[string]string{constants.ForceResyncAnnotationKey: "true"}
+			},
+			unchanged: false,
+		},
+		{
+			subTest:          "failed cluster",
+			fullResyncPeriod: time.Hour,
+			lastFullSync:     time.Minute,
+			update: func(pg *acidv1.Postgresql) {
+				pg.Status.PostgresClusterStatus = acidv1.ClusterStatusSyncFailed
+			},
+			unchanged: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.subTest, func(t *testing.T) {
+			var cluster = New(
+				Config{
+					OpConfig: config.Config{
+						CRD: config.CRD{FullResyncPeriod: tt.fullResyncPeriod},
+					},
+				}, k8sutil.KubernetesClient{}, synced, logger, eventRecorder)
+			cluster.lastFullSync = time.Now().Add(-tt.lastFullSync)
+			cluster.syncDrift = tt.drift
+
+			newSpec := synced.DeepCopy()
+			if tt.update != nil {
+				tt.update(newSpec)
+			}
+			assert.Equal(t, tt.unchanged, cluster.syncUnchanged(newSpec))
+		})
+	}
+}
+
+func TestRemovedTablespaceVolumes(t *testing.T) {
+	statefulSet := &appsv1.StatefulSet{
+		Spec: appsv1.StatefulSetSpec{
+			VolumeClaimTemplates: []v1.PersistentVolumeClaim{
+				{ObjectMeta: metav1.ObjectMeta{Name: constants.DataVolumeName}},
+				{ObjectMeta: metav1.ObjectMeta{Name: "tablespace-fast-space"}},
+				{ObjectMeta: metav1.ObjectMeta{Name: "tablespace-archive"}},
+			},
+		},
+	}
+
+	assert.Empty(t, removedTablespaceVolumes(statefulSet, []acidv1.Tablespace{{Name: "fast_space"}, {Name: "archive"}}))
+	assert.Equal(t, []string{"tablespace-archive"},
+		removedTablespaceVolumes(statefulSet, []acidv1.Tablespace{{Name: "fast_space"}}))
+	assert.Equal(t, []string{"tablespace-fast-space", "tablespace-archive"}, removedTablespaceVolumes(statefulSet, nil),
+		"the data volume is never reported")
+}
+
+func TestCheckMajorVersionChange(t *testing.T) {
+	statefulSet := &appsv1.StatefulSet{
+		Spec: appsv1.StatefulSetSpec{
+			Template: v1.PodTemplateSpec{
+				Spec: v1.PodSpec{
+					Containers: []v1.Container{{
+						Name: constants.PostgresContainerName,
+						Env:  []v1.EnvVar{{Name: "PGVERSION", Value: "12"}},
+					}},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		subTest      string
+		version      string
+		pgVersionEnv bool
+		err          string
+	}{
+		{
+			subTest:      "unchanged version",
+			version:      "12",
+			pgVersionEnv: true,
+		},
+		{
+			subTest:      "upgrade",
+			version:      "13",
+			pgVersionEnv: true,
+		},
+		{
+			subTest:      "upgrade without PGVERSION",
+			version:      "13",
+			pgVersionEnv: false,
+			err:          "upgrading Postgres from version 12 to 13 requires the enable_pgversion_env_var option",
+		},
+		{
+			subTest:      "downgrade",
+			version:      "11",
+			pgVersionEnv: true,
+			err:          "downgrading Postgres from version 12 to 11 is not supported, set the version of the manifest back to 12",
+		},
+		{
+			subTest:      "downgrade compared as numbers",
+			version:      "9.6",
+			pgVersionEnv: true,
+			err:          "downgrading Postgres from version 12 to 9.6 is not supported, set the version of the manifest back to 12",
+		},
+	}
+
+	for _, tt := range tests {
+		pg := acidv1.Postgresql{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "acid-test-cluster",
+				Namespace: "default",
+			},
+			Spec: acidv1.PostgresSpec{
+				PostgresqlParam: acidv1.PostgresqlParam{PgVersion: tt.version},
+			},
+		}
+		cluster := New(
+			Config{
+				OpConfig: config.Config{
+					EnablePgVersionEnvVar: tt.pgVersionEnv,
+				},
+			}, k8sutil.KubernetesClient{}, pg, logger, record.NewFakeRecorder(5))
+
+		err := cluster.checkMajorVersionChange(statefulSet)
+		if tt.err == "" {
+			assert.NoError(t, err, tt.subTest)
+		} else {
+			assert.EqualError(t, err, tt.err, tt.subTest)
+		}
+	}
+}
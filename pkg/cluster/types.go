@@ -1,9 +1,11 @@
 package cluster
 
 import (
+	"context"
 	"time"
 
 	acidv1 "github.com/zalando/postgres-operator/pkg/apis/acid.zalan.do/v1"
+	"github.com/zalando/postgres-operator/pkg/spec"
 	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
 	policybeta1 "k8s.io/api/policy/v1beta1"
@@ -78,3 +80,33 @@ type SyncReason []string
 
 // no sync happened, empty value
 var NoSync SyncReason = []string{}
+
+// SyncHooks are invoked at the phases of a sync, e.g. to ask a change management system for approval or to
+// notify it. An error returned by a Before hook vetoes the phase, the sync fails with it and the phase is tried
+// again on the next sync. An error returned by an After hook fails the sync as well.
+type SyncHooks interface {
+	// BeforeStatefulSetUpdate is called before the existing statefulset is scaled, updated or replaced
+	BeforeStatefulSetUpdate(ctx context.Context, cluster spec.NamespacedName, current, desired *appsv1.StatefulSet) error
+	// BeforeRollingUpdate is called before the pods are recreated, the rolling update stays pending on a veto
+	BeforeRollingUpdate(ctx context.Context, cluster spec.NamespacedName, pods []v1.Pod) error
+	// AfterRolesSync is called with the names of the manifest roles after they have been synced with the database
+	AfterRolesSync(ctx context.Context, cluster spec.NamespacedName, roles []string) error
+}
+
+// NoopSyncHooks allows every phase, embed it to implement only some of the hooks
+type NoopSyncHooks struct{}
+
+// BeforeStatefulSetUpdate allows the statefulset update
+func (NoopSyncHooks) BeforeStatefulSetUpdate(ctx context.Context, cluster spec.NamespacedName, current, desired *appsv1.StatefulSet) error {
+	return nil
+}
+
+// BeforeRollingUpdate allows the rolling update
+func (NoopSyncHooks) BeforeRollingUpdate(ctx context.Context, cluster spec.NamespacedName, pods []v1.Pod) error {
+	return nil
+}
+
+// AfterRolesSync ignores the synced roles
+func (NoopSyncHooks) AfterRolesSync(ctx context.Context, cluster spec.NamespacedName, roles []string) error {
+	return nil
+}
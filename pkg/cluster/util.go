@@ -3,7 +3,9 @@ package cluster
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/gob"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"math/rand"
@@ -23,6 +25,7 @@ import (
 	acidv1 "github.com/zalando/postgres-operator/pkg/apis/acid.zalan.do/v1"
 	"github.com/zalando/postgres-operator/pkg/spec"
 	"github.com/zalando/postgres-operator/pkg/util"
+	"github.com/zalando/postgres-operator/pkg/util/config"
 	"github.com/zalando/postgres-operator/pkg/util/constants"
 	"github.com/zalando/postgres-operator/pkg/util/k8sutil"
 	"github.com/zalando/postgres-operator/pkg/util/nicediff"
@@ -123,13 +126,9 @@ func normalizeUserFlags(userFlags []string) ([]string, error) {
 
 	flags := []string{}
 	for k := range uniqueFlags {
+		// NOLOGIN is kept for group roles, the sync removes the LOGIN attribute of a role turned into one
 		if k == constants.RoleFlagNoLogin || k == constants.RoleFlagLogin {
 			addLogin = false
-			if k == constants.RoleFlagNoLogin {
-				// we don't add NOLOGIN to the list of flags to be consistent with what we get
-				// from the readPgUsersFromDatabase in SyncUsers
-				continue
-			}
 		}
 		flags = append(flags, k)
 	}
@@ -159,6 +158,34 @@ func metaAnnotationsPatch(annotations map[string]string) ([]byte, error) {
 	}{&meta})
 }
 
+// metaAnnotationsUpdatePatch produces a JSON merge patch of the object metadata setting the desired annotations
+// and removing the given ones by setting them to null
+func metaAnnotationsUpdatePatch(desired map[string]string, removed []string) ([]byte, error) {
+	annotations := make(map[string]interface{}, len(desired)+len(removed))
+	for _, k := range removed {
+		annotations[k] = nil
+	}
+	for k, v := range desired {
+		annotations[k] = v
+	}
+	return json.Marshal(map[string]map[string]interface{}{"metadata": {"annotations": annotations}})
+}
+
+// metaLabelsPatch produces a JSON merge patch of the object metadata setting the labels to the desired ones,
+// the labels not desired anymore are removed by setting them to null
+func metaLabelsPatch(current, desired map[string]string) ([]byte, error) {
+	lbls := make(map[string]interface{}, len(current)+len(desired))
+	for k := range current {
+		if _, ok := desired[k]; !ok {
+			lbls[k] = nil
+		}
+	}
+	for k, v := range desired {
+		lbls[k] = v
+	}
+	return json.Marshal(map[string]map[string]interface{}{"metadata": {"labels": lbls}})
+}
+
 func (c *Cluster) logPDBChanges(old, new *policybeta1.PodDisruptionBudget, isUpdate bool, reason string) {
 	if isUpdate {
 		c.logger.Infof("pod disruption budget %q has been changed", util.NameFromMeta(old.ObjectMeta))
@@ -334,13 +361,43 @@ func (c *Cluster) waitForPodDeletion(podEvents chan PodEvent) error {
 	}
 }
 
-func (c *Cluster) waitStatefulsetReady() error {
-	return retryutil.Retry(c.OpConfig.ResourceCheckInterval, c.OpConfig.ResourceCheckTimeout,
+// podReadyBackoff returns the intervals to check whether the pods are ready
+func (c *Cluster) podReadyBackoff() retryutil.Backoff {
+	return retryutil.Backoff{
+		Interval:      c.OpConfig.PodReadyWaitInterval,
+		MaxInterval:   c.OpConfig.PodReadyWaitMaxInterval,
+		Timeout:       c.OpConfig.PodReadyWaitTimeout,
+		JitterPercent: c.OpConfig.PodReadyWaitJitterPercent,
+	}
+}
+
+// waitForPodMinReady waits until the pod has been ready for at least the given time without interruption, the pod
+// gets the usual time to become ready on top of it
+func (c *Cluster) waitForPodMinReady(ctx context.Context, podName spec.NamespacedName, minReady time.Duration) error {
+	backoff := c.podReadyBackoff()
+	backoff.Timeout += minReady
+	return retryutil.RetryWithBackoff(backoff,
+		func() (bool, error) {
+			pod, err := c.KubeClient.Pods(podName.Namespace).Get(ctx, podName.Name, metav1.GetOptions{})
+			if err != nil {
+				return false, err
+			}
+			for _, condition := range pod.Status.Conditions {
+				if condition.Type == v1.PodReady && condition.Status == v1.ConditionTrue {
+					return time.Since(condition.LastTransitionTime.Time) >= minReady, nil
+				}
+			}
+			return false, nil
+		})
+}
+
+func (c *Cluster) waitStatefulsetReady(ctx context.Context) error {
+	return retryutil.RetryWithBackoff(c.podReadyBackoff(),
 		func() (bool, error) {
 			listOptions := metav1.ListOptions{
 				LabelSelector: c.labelsSet(false).String(),
 			}
-			ss, err := c.KubeClient.StatefulSets(c.Namespace).List(context.TODO(), listOptions)
+			ss, err := c.KubeClient.StatefulSets(c.Namespace).List(ctx, listOptions)
 			if err != nil {
 				return false, err
 			}
@@ -353,7 +410,7 @@ func (c *Cluster) waitStatefulsetReady() error {
 		})
 }
 
-func (c *Cluster) _waitPodLabelsReady(anyReplica bool) error {
+func (c *Cluster) _waitPodLabelsReady(ctx context.Context, anyReplica bool) error {
 	var (
 		podsNumber int
 	)
@@ -375,7 +432,7 @@ func (c *Cluster) _waitPodLabelsReady(anyReplica bool) error {
 	}
 	podsNumber = 1
 	if !anyReplica {
-		pods, err := c.KubeClient.Pods(namespace).List(context.TODO(), listOptions)
+		pods, err := c.KubeClient.Pods(namespace).List(ctx, listOptions)
 		if err != nil {
 			return err
 		}
@@ -385,11 +442,11 @@ func (c *Cluster) _waitPodLabelsReady(anyReplica bool) error {
 		c.logger.Debugf("Waiting for any replica pod to become ready")
 	}
 
-	err := retryutil.Retry(c.OpConfig.ResourceCheckInterval, c.OpConfig.ResourceCheckTimeout,
+	err := retryutil.RetryWithBackoff(c.podReadyBackoff(),
 		func() (bool, error) {
 			masterCount := 0
 			if !anyReplica {
-				masterPods, err2 := c.KubeClient.Pods(namespace).List(context.TODO(), masterListOption)
+				masterPods, err2 := c.KubeClient.Pods(namespace).List(ctx, masterListOption)
 				if err2 != nil {
 					return false, err2
 				}
@@ -399,7 +456,7 @@ func (c *Cluster) _waitPodLabelsReady(anyReplica bool) error {
 				}
 				masterCount = len(masterPods.Items)
 			}
-			replicaPods, err2 := c.KubeClient.Pods(namespace).List(context.TODO(), replicaListOption)
+			replicaPods, err2 := c.KubeClient.Pods(namespace).List(ctx, replicaListOption)
 			if err2 != nil {
 				return false, err2
 			}
@@ -415,29 +472,77 @@ func (c *Cluster) _waitPodLabelsReady(anyReplica bool) error {
 	return err
 }
 
-func (c *Cluster) waitForAnyReplicaLabelReady() error {
-	return c._waitPodLabelsReady(true)
+func (c *Cluster) waitForAnyReplicaLabelReady(ctx context.Context) error {
+	return c._waitPodLabelsReady(ctx, true)
 }
 
-func (c *Cluster) waitForAllPodsLabelReady() error {
-	return c._waitPodLabelsReady(false)
+func (c *Cluster) waitForAllPodsLabelReady(ctx context.Context) error {
+	return c._waitPodLabelsReady(ctx, false)
 }
 
-func (c *Cluster) waitStatefulsetPodsReady() error {
+func (c *Cluster) waitStatefulsetPodsReady(ctx context.Context) error {
 	c.setProcessName("waiting for the pods of the statefulset")
 	// TODO: wait for the first Pod only
-	if err := c.waitStatefulsetReady(); err != nil {
-		return fmt.Errorf("stateful set error: %v", err)
+	if err := c.waitStatefulsetReady(ctx); err != nil {
+		return fmt.Errorf("stateful set error: %v%s", err, c.notReadyPodsDetails(ctx))
 	}
 
 	// TODO: wait only for master
-	if err := c.waitForAllPodsLabelReady(); err != nil {
-		return fmt.Errorf("pod labels error: %v", err)
+	if err := c.waitForAllPodsLabelReady(ctx); err != nil {
+		return fmt.Errorf("pod labels error: %v%s", err, c.notReadyPodsDetails(ctx))
 	}
 
 	return nil
 }
 
+// notReadyPodsDetails lists the pods which are not ready and why, to be appended to a wait error
+func (c *Cluster) notReadyPodsDetails(ctx context.Context) string {
+	pods, err := c.listPods(ctx)
+	if err != nil {
+		return fmt.Sprintf(", %v", err)
+	}
+
+	details := make([]string, 0)
+	if c.Statefulset != nil && c.Statefulset.Spec.Replicas != nil && int(*c.Statefulset.Spec.Replicas) > len(pods) {
+		details = append(details, fmt.Sprintf("only %d of %d pods exist", len(pods), *c.Statefulset.Spec.Replicas))
+	}
+	for _, pod := range pods {
+		if reason := podNotReadyReason(&pod, c.OpConfig.PodRoleLabel); reason != "" {
+			details = append(details, fmt.Sprintf("pod %q %s", pod.Name, reason))
+		}
+	}
+	if len(details) == 0 {
+		return ""
+	}
+	return ", pods not ready: " + strings.Join(details, "; ")
+}
+
+// podNotReadyReason returns why the pod is not ready, or an empty string if it is
+func podNotReadyReason(pod *v1.Pod, roleLabel string) string {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodScheduled && condition.Status == v1.ConditionFalse {
+			return fmt.Sprintf("is not scheduled: %s: %s", condition.Reason, condition.Message)
+		}
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.State.Waiting != nil {
+			return fmt.Sprintf("has container %q waiting: %s (%d restarts)",
+				status.Name, status.State.Waiting.Reason, status.RestartCount)
+		}
+		if status.State.Terminated != nil {
+			return fmt.Sprintf("has container %q terminated: %s (exit code %d)",
+				status.Name, status.State.Terminated.Reason, status.State.Terminated.ExitCode)
+		}
+	}
+	if pod.Status.Phase != v1.PodRunning {
+		return fmt.Sprintf("is in phase %s", pod.Status.Phase)
+	}
+	if _, ok := pod.Labels[roleLabel]; !ok {
+		return fmt.Sprintf("has no %q label assigned by Patroni yet", roleLabel)
+	}
+	return ""
+}
+
 // Returns labels used to create or list k8s objects such as pods
 // For backward compatibility, shouldAddExtraLabels must be false
 // when listing k8s objects. See operator PR #252
@@ -452,10 +557,12 @@ func (c *Cluster) labelsSet(shouldAddExtraLabels bool) labels.Set {
 		// enables filtering resources owned by a team
 		lbls["team"] = c.Postgresql.Spec.TeamID
 
-		// allow to inherit certain labels from the 'postgres' object
+		// allow to inherit certain labels from the 'postgres' object, listed either in the configuration
+		// or in the manifest itself
 		if spec, err := c.GetSpec(); err == nil {
+			inheritedLabels := append(append([]string{}, c.OpConfig.InheritedLabels...), spec.Spec.InheritedLabels...)
 			for k, v := range spec.ObjectMeta.Labels {
-				for _, match := range c.OpConfig.InheritedLabels {
+				for _, match := range inheritedLabels {
 					if k == match {
 						lbls[k] = v
 					}
@@ -476,14 +583,123 @@ func (c *Cluster) labelsSelector() *metav1.LabelSelector {
 	}
 }
 
+// checkObjectOwnership guards against adopting an object created for another cluster with a conflicting name,
+// the objects of this cluster carry its name in the cluster name label
+func (c *Cluster) checkObjectOwnership(kind string, objectMeta metav1.ObjectMeta) error {
+	if owner, ok := objectMeta.Labels[c.OpConfig.ClusterNameLabel]; ok && owner == c.Name {
+		return nil
+	}
+	err := fmt.Errorf("%s %q does not belong to the cluster: its %q label is %q instead of %q", kind,
+		util.NameFromMeta(objectMeta), c.OpConfig.ClusterNameLabel, objectMeta.Labels[c.OpConfig.ClusterNameLabel], c.Name)
+	c.eventRecorder.Event(c.GetReference(), v1.EventTypeWarning, "Conflict", err.Error())
+	return err
+}
+
+// statefulSetFields returns the fields of the statefulset written by the operator by their path
+func statefulSetFields(sset *appsv1.StatefulSet) map[string]interface{} {
+	podSpec := sset.Spec.Template.Spec
+	return map[string]interface{}{
+		"replicas":                                    sset.Spec.Replicas,
+		"podManagementPolicy":                         sset.Spec.PodManagementPolicy,
+		"updateStrategy":                              sset.Spec.UpdateStrategy,
+		"volumeClaimTemplates":                        sset.Spec.VolumeClaimTemplates,
+		"template.metadata.labels":                    sset.Spec.Template.Labels,
+		"template.metadata.annotations":               sset.Spec.Template.Annotations,
+		"template.spec.containers":                    podSpec.Containers,
+		"template.spec.initContainers":                podSpec.InitContainers,
+		"template.spec.volumes":                       podSpec.Volumes,
+		"template.spec.affinity":                      podSpec.Affinity,
+		"template.spec.tolerations":                   podSpec.Tolerations,
+		"template.spec.nodeSelector":                  podSpec.NodeSelector,
+		"template.spec.securityContext":               podSpec.SecurityContext,
+		"template.spec.serviceAccountName":            podSpec.ServiceAccountName,
+		"template.spec.priorityClassName":             podSpec.PriorityClassName,
+		"template.spec.terminationGracePeriodSeconds": podSpec.TerminationGracePeriodSeconds,
+	}
+}
+
+// serviceFields returns the fields of the service written by the operator by their path
+func serviceFields(svc *v1.Service) map[string]interface{} {
+	return map[string]interface{}{
+		"type":                     svc.Spec.Type,
+		"ports":                    svc.Spec.Ports,
+		"selector":                 svc.Spec.Selector,
+		"loadBalancerSourceRanges": svc.Spec.LoadBalancerSourceRanges,
+		"externalTrafficPolicy":    svc.Spec.ExternalTrafficPolicy,
+		"sessionAffinity":          svc.Spec.SessionAffinity,
+		"sessionAffinityConfig":    svc.Spec.SessionAffinityConfig,
+	}
+}
+
+// lastAppliedAnnotation hashes the fields of an object as written by the operator, so a later manual change of
+// a field is recognized without storing the whole object in the annotation
+func lastAppliedAnnotation(fields map[string]interface{}) (string, error) {
+	hashes := make(map[string]string, len(fields))
+	for path, value := range fields {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return "", fmt.Errorf("could not marshal field %q: %v", path, err)
+		}
+		sum := sha256.Sum256(data)
+		hashes[path] = hex.EncodeToString(sum[:8])
+	}
+	annotation, err := json.Marshal(hashes)
+	if err != nil {
+		return "", fmt.Errorf("could not marshal field hashes: %v", err)
+	}
+	return string(annotation), nil
+}
+
+// manuallyChangedFields returns the fields whose values differ from the ones the operator applied last, objects
+// without a valid last applied annotation have no manual changes
+func manuallyChangedFields(annotations map[string]string, fields map[string]interface{}) []string {
+	lastApplied := make(map[string]string)
+	if err := json.Unmarshal([]byte(annotations[constants.LastAppliedAnnotationKey]), &lastApplied); err != nil {
+		return nil
+	}
+	current, err := lastAppliedAnnotation(fields)
+	if err != nil {
+		return nil
+	}
+	currentHashes := make(map[string]string)
+	if err = json.Unmarshal([]byte(current), &currentHashes); err != nil {
+		return nil
+	}
+
+	changed := make([]string, 0)
+	for path, hash := range currentHashes {
+		if lastHash, ok := lastApplied[path]; ok && lastHash != hash {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// reportManualChanges warns that the operator is about to revert manual changes of an object
+func (c *Cluster) reportManualChanges(kind string, name spec.NamespacedName, fields []string) {
+	if len(fields) == 0 {
+		return
+	}
+	msg := fmt.Sprintf("Reverting manual changes of %s %q: %s", kind, name, strings.Join(fields, ", "))
+	c.logger.Warning(msg)
+	c.eventRecorder.Event(c.GetReference(), v1.EventTypeWarning, "ManualChange", msg)
+}
+
 func (c *Cluster) roleLabelsSet(shouldAddExtraLabels bool, role PostgresRole) labels.Set {
 	lbls := c.labelsSet(shouldAddExtraLabels)
 	lbls[c.OpConfig.PodRoleLabel] = string(role)
 	return lbls
 }
 
-func (c *Cluster) masterDNSName() string {
-	return strings.ToLower(c.OpConfig.MasterDNSNameFormat.Format(
+// masterDNSName returns the DNS name of the master service, a template of the manifest takes precedence over the
+// one of the configuration
+func (c *Cluster) masterDNSName(spec *acidv1.PostgresSpec) string {
+	format := c.OpConfig.MasterDNSNameFormat
+	if spec.MasterDNSNameFormat != "" {
+		format = config.StringTemplate(spec.MasterDNSNameFormat)
+	}
+	return strings.ToLower(format.Format(
 		"cluster", c.Spec.ClusterName,
 		"team", c.teamName(),
 		"hostedzone", c.OpConfig.DbHostedZone))
@@ -538,6 +754,18 @@ func (c *Cluster) setSpec(newSpec *acidv1.Postgresql) {
 	c.specMu.Unlock()
 }
 
+// passwordEncryption returns the method the passwords of the roles are encrypted with, taken from the
+// password_encryption parameter if the manifest does not set it explicitly, md5 by default
+func passwordEncryption(spec *acidv1.PostgresSpec) string {
+	if spec.PasswordEncryption != "" {
+		return spec.PasswordEncryption
+	}
+	if encryption, ok := spec.Parameters["password_encryption"]; ok {
+		return encryption
+	}
+	return "md5"
+}
+
 // GetSpec returns a copy of the operator-side spec of a Postgres cluster in a thread-safe manner
 func (c *Cluster) GetSpec() (*acidv1.Postgresql, error) {
 	c.specMu.RLock()
@@ -558,6 +786,39 @@ func (c *Cluster) patroniKubernetesUseConfigMaps() bool {
 	return c.OpConfig.KubernetesUseConfigMaps
 }
 
+// isInMaintenanceWindow checks whether the given time falls into one of the maintenance windows. Windows are
+// taken in the time zone of the given time, the start time is inclusive and the end time exclusive.
+func isInMaintenanceWindow(windows []acidv1.MaintenanceWindow, now time.Time) bool {
+	minuteOfDay := func(t time.Time) int {
+		return t.Hour()*60 + t.Minute()
+	}
+	current := minuteOfDay(now)
+
+	for _, window := range windows {
+		if !window.Everyday && window.Weekday != now.Weekday() {
+			continue
+		}
+		if current >= minuteOfDay(window.StartTime.Time) && current < minuteOfDay(window.EndTime.Time) {
+			return true
+		}
+	}
+	return false
+}
+
+// inMaintenanceWindow checks whether one of the maintenance windows of the manifest is open. The windows are
+// given in the time zone of the manifest, UTC by default.
+func (c *Cluster) inMaintenanceWindow(now time.Time) bool {
+	location := time.UTC
+	if c.Spec.MaintenanceWindowsTimezone != "" {
+		var err error
+		if location, err = time.LoadLocation(c.Spec.MaintenanceWindowsTimezone); err != nil {
+			c.logger.Warningf("could not load time zone of the maintenance windows, using UTC: %v", err)
+			location = time.UTC
+		}
+	}
+	return isInMaintenanceWindow(c.Spec.MaintenanceWindows, now.In(location))
+}
+
 // Earlier arguments take priority
 func mergeContainers(containers ...[]v1.Container) ([]v1.Container, []string) {
 	containerNameTaken := map[string]bool{}
@@ -2,14 +2,21 @@ package cluster
 
 import (
 	"context"
+	"fmt"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	acidv1 "github.com/zalando/postgres-operator/pkg/apis/acid.zalan.do/v1"
 	fakeacidv1 "github.com/zalando/postgres-operator/pkg/generated/clientset/versioned/fake"
+	"github.com/zalando/postgres-operator/pkg/spec"
 	"github.com/zalando/postgres-operator/pkg/util"
 	"github.com/zalando/postgres-operator/pkg/util/config"
+	"github.com/zalando/postgres-operator/pkg/util/constants"
 	"github.com/zalando/postgres-operator/pkg/util/k8sutil"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	k8sFake "k8s.io/client-go/kubernetes/fake"
 )
@@ -22,6 +29,7 @@ func newFakeK8sAnnotationsClient() (k8sutil.KubernetesClient, *k8sFake.Clientset
 		PodDisruptionBudgetsGetter: clientSet.PolicyV1beta1(),
 		ServicesGetter:             clientSet.CoreV1(),
 		StatefulSetsGetter:         clientSet.AppsV1(),
+		ResourceQuotasGetter:       clientSet.CoreV1(),
 		PostgresqlsGetter:          acidClientSet.AcidV1(),
 	}, clientSet
 }
@@ -84,7 +92,7 @@ func TestInheritedAnnotations(t *testing.T) {
 	}
 
 	// check statefulset annotations
-	_, err := cluster.createStatefulSet()
+	_, err := cluster.createStatefulSet(context.TODO())
 	assert.NoError(t, err)
 
 	stsList, err := client.StatefulSets(namespace).List(context.TODO(), listOptions)
@@ -104,7 +112,7 @@ func TestInheritedAnnotations(t *testing.T) {
 	}
 
 	// check service annotations
-	cluster.createService(Master)
+	cluster.createService(context.TODO(), Master)
 	svcList, err := client.Services(namespace).List(context.TODO(), listOptions)
 	assert.NoError(t, err)
 	for _, svc := range svcList.Items {
@@ -114,7 +122,7 @@ func TestInheritedAnnotations(t *testing.T) {
 	}
 
 	// check pod disruption budget annotations
-	cluster.createPodDisruptionBudget()
+	cluster.createPodDisruptionBudget(context.TODO())
 	pdbList, err := client.PodDisruptionBudgets(namespace).List(context.TODO(), listOptions)
 	assert.NoError(t, err)
 	for _, pdb := range pdbList.Items {
@@ -139,3 +147,413 @@ func TestInheritedAnnotations(t *testing.T) {
 	}
 
 }
+
+func TestPodNotReadyReason(t *testing.T) {
+	roleLabel := "spilo-role"
+	tests := []struct {
+		subTest string
+		pod     v1.Pod
+		reason  string
+	}{
+		{
+			subTest: "ready pod",
+			pod: v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{roleLabel: "master"}},
+				Status:     v1.PodStatus{Phase: v1.PodRunning},
+			},
+			reason: "",
+		},
+		{
+			subTest: "unschedulable pod",
+			pod: v1.Pod{
+				Status: v1.PodStatus{
+					Phase: v1.PodPending,
+					Conditions: []v1.PodCondition{{
+						Type:    v1.PodScheduled,
+						Status:  v1.ConditionFalse,
+						Reason:  "Unschedulable",
+						Message: "0/3 nodes are available: 3 Insufficient memory.",
+					}},
+				},
+			},
+			reason: "is not scheduled: Unschedulable: 0/3 nodes are available: 3 Insufficient memory.",
+		},
+		{
+			subTest: "crash looping container",
+			pod: v1.Pod{
+				Status: v1.PodStatus{
+					Phase: v1.PodRunning,
+					ContainerStatuses: []v1.ContainerStatus{{
+						Name:         "postgres",
+						RestartCount: 5,
+						State:        v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+					}},
+				},
+			},
+			reason: `has container "postgres" waiting: CrashLoopBackOff (5 restarts)`,
+		},
+		{
+			subTest: "running pod without role label",
+			pod: v1.Pod{
+				Status: v1.PodStatus{Phase: v1.PodRunning},
+			},
+			reason: `has no "spilo-role" label assigned by Patroni yet`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.subTest, func(t *testing.T) {
+			assert.Equal(t, tt.reason, podNotReadyReason(&tt.pod, roleLabel))
+		})
+	}
+}
+
+func TestWaitForPodMinReady(t *testing.T) {
+	clientSet := k8sFake.NewSimpleClientset()
+	client := k8sutil.KubernetesClient{
+		PodsGetter: clientSet.CoreV1(),
+	}
+	namespace := "default"
+
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				PodReadyWaitInterval:    10 * time.Millisecond,
+				PodReadyWaitMaxInterval: 10 * time.Millisecond,
+				PodReadyWaitTimeout:     100 * time.Millisecond,
+			},
+		}, client, acidv1.Postgresql{}, logger, eventRecorder)
+
+	tests := []struct {
+		subTest    string
+		conditions []v1.PodCondition
+		minReady   time.Duration
+		ready      bool
+	}{
+		{
+			subTest: "pod ready for long enough",
+			conditions: []v1.PodCondition{{
+				Type:               v1.PodReady,
+				Status:             v1.ConditionTrue,
+				LastTransitionTime: metav1.NewTime(time.Now().Add(-time.Minute)),
+			}},
+			minReady: 30 * time.Second,
+			ready:    true,
+		},
+		{
+			subTest: "pod ready only recently stays ready longer than the wait timeout",
+			conditions: []v1.PodCondition{{
+				Type:               v1.PodReady,
+				Status:             v1.ConditionTrue,
+				LastTransitionTime: metav1.Now(),
+			}},
+			minReady: 150 * time.Millisecond,
+			ready:    true,
+		},
+		{
+			subTest: "pod not ready",
+			conditions: []v1.PodCondition{{
+				Type:               v1.PodReady,
+				Status:             v1.ConditionFalse,
+				LastTransitionTime: metav1.NewTime(time.Now().Add(-time.Minute)),
+			}},
+			minReady: 150 * time.Millisecond,
+			ready:    false,
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.subTest, func(t *testing.T) {
+			pod := v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      fmt.Sprintf("acid-test-cluster-%d", i),
+					Namespace: namespace,
+				},
+				Status: v1.PodStatus{Conditions: tt.conditions},
+			}
+			_, err := clientSet.CoreV1().Pods(namespace).Create(context.TODO(), &pod, metav1.CreateOptions{})
+			assert.NoError(t, err)
+
+			err = cluster.waitForPodMinReady(context.TODO(), util.NameFromMeta(pod.ObjectMeta), tt.minReady)
+			assert.Equal(t, tt.ready, err == nil)
+		})
+	}
+}
+
+func TestIsInMaintenanceWindow(t *testing.T) {
+	windowTime := func(hour, minute int) metav1.Time {
+		return metav1.Time{Time: time.Date(0, time.January, 1, hour, minute, 0, 0, time.UTC)}
+	}
+	windows := []acidv1.MaintenanceWindow{
+		{Everyday: true, StartTime: windowTime(1, 0), EndTime: windowTime(6, 0)},
+		{Weekday: time.Saturday, StartTime: windowTime(12, 30), EndTime: windowTime(14, 0)},
+	}
+
+	tests := []struct {
+		subTest  string
+		now      time.Time
+		expected bool
+	}{
+		{"start of the daily window", time.Date(2021, time.March, 3, 1, 0, 0, 0, time.UTC), true},
+		{"end of the daily window", time.Date(2021, time.March, 3, 6, 0, 0, 0, time.UTC), false},
+		{"weekday window on a Saturday", time.Date(2021, time.March, 6, 13, 15, 0, 0, time.UTC), true},
+		{"weekday window on a Sunday", time.Date(2021, time.March, 7, 13, 15, 0, 0, time.UTC), false},
+		{"windows in the zone of the time", time.Date(2021, time.March, 3, 6, 30, 0, 0, time.FixedZone("CET", 3600)), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.subTest, func(t *testing.T) {
+			assert.Equal(t, tt.expected, isInMaintenanceWindow(windows, tt.now))
+		})
+	}
+	assert.False(t, isInMaintenanceWindow(nil, time.Now()))
+
+	// the windows of the manifest are given in its time zone
+	cluster := New(Config{}, k8sutil.KubernetesClient{}, acidv1.Postgresql{
+		Spec: acidv1.PostgresSpec{
+			MaintenanceWindows:         windows,
+			MaintenanceWindowsTimezone: "Asia/Tokyo",
+		},
+	}, logger, eventRecorder)
+	assert.True(t, cluster.inMaintenanceWindow(time.Date(2021, time.March, 2, 17, 0, 0, 0, time.UTC)))
+	assert.False(t, cluster.inMaintenanceWindow(time.Date(2021, time.March, 3, 2, 0, 0, 0, time.UTC)))
+}
+
+func TestNormalizeUserFlags(t *testing.T) {
+	tests := []struct {
+		subTest  string
+		flags    []string
+		expected []string
+	}{
+		{"login role by default", []string{"createdb"}, []string{"CREATEDB", "LOGIN"}},
+		{"login role", []string{"login", "inherit"}, []string{"INHERIT", "LOGIN"}},
+		{"group role", []string{"nologin", "inherit"}, []string{"INHERIT", "NOLOGIN"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.subTest, func(t *testing.T) {
+			flags, err := normalizeUserFlags(tt.flags)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, flags)
+		})
+	}
+	_, err := normalizeUserFlags([]string{"login", "nologin"})
+	assert.EqualError(t, err, `conflicting user flags: "NOLOGIN" and "LOGIN"`)
+
+	// a group role cannot log in and gets no secret
+	groupRole := spec.PgUser{Name: "app_group", Password: "secret", Flags: []string{constants.RoleFlagNoLogin}}
+	assert.Nil(t, cl.generateSingleUserSecret(cl.Namespace, groupRole))
+	loginRole := spec.PgUser{Name: "app_user", Password: "secret", Flags: []string{constants.RoleFlagLogin}}
+	assert.NotNil(t, cl.generateSingleUserSecret(cl.Namespace, loginRole))
+}
+
+func TestManuallyChangedFields(t *testing.T) {
+	replicas := int32(2)
+	sset := &appsv1.StatefulSet{
+		Spec: appsv1.StatefulSetSpec{
+			Replicas: &replicas,
+			Template: v1.PodTemplateSpec{
+				Spec: v1.PodSpec{
+					Containers: []v1.Container{{Name: "postgres", Image: "spilo"}},
+				},
+			},
+		},
+	}
+	lastApplied, err := lastAppliedAnnotation(statefulSetFields(sset))
+	assert.NoError(t, err)
+
+	// no changes without an annotation
+	assert.Empty(t, manuallyChangedFields(nil, statefulSetFields(sset)))
+	annotations := map[string]string{constants.LastAppliedAnnotationKey: lastApplied}
+	assert.Empty(t, manuallyChangedFields(annotations, statefulSetFields(sset)))
+
+	replicas = 3
+	sset.Spec.Template.Spec.Containers[0].Image = "spilo-custom"
+	assert.Equal(t, []string{"replicas", "template.spec.containers"}, manuallyChangedFields(annotations, statefulSetFields(sset)))
+
+	// an invalid annotation is ignored
+	annotations[constants.LastAppliedAnnotationKey] = "{"
+	assert.Empty(t, manuallyChangedFields(annotations, statefulSetFields(sset)))
+}
+
+func TestInheritedLabels(t *testing.T) {
+	client, _ := newFakeK8sAnnotationsClient()
+	clusterName := "acid-test-cluster"
+	namespace := "default"
+
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterName,
+			Namespace: namespace,
+			Labels: map[string]string{
+				"environment": "test",
+				"cost-center": "1234",
+				"owner":       "team-a",
+			},
+		},
+		Spec: acidv1.PostgresSpec{
+			InheritedLabels: []string{"cost-center"},
+			Volume: acidv1.Volume{
+				Size: "1Gi",
+			},
+		},
+	}
+
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				PodManagementPolicy: "ordered_ready",
+				Resources: config.Resources{
+					ClusterLabels:        map[string]string{"application": "spilo"},
+					ClusterNameLabel:     "cluster-name",
+					DefaultCPURequest:    "300m",
+					DefaultCPULimit:      "300m",
+					DefaultMemoryRequest: "300Mi",
+					DefaultMemoryLimit:   "300Mi",
+					InheritedLabels:      []string{"environment"},
+					PodRoleLabel:         "spilo-role",
+				},
+			},
+		}, client, pg, logger, eventRecorder)
+
+	// labels listed in the configuration or in the manifest are inherited, others are not
+	inheritedLabels := map[string]string{"environment": "test", "cost-center": "1234"}
+
+	sts, err := cluster.generateStatefulSet(&cluster.Spec, nil)
+	assert.NoError(t, err)
+	assert.True(t, util.MapContains(sts.Labels, inheritedLabels))
+	assert.True(t, util.MapContains(sts.Spec.Template.Labels, inheritedLabels))
+	assert.NotContains(t, sts.Labels, "owner")
+
+	for _, role := range []PostgresRole{Master, Replica} {
+		svc := cluster.generateService(role, &cluster.Spec)
+		assert.True(t, util.MapContains(svc.Labels, inheritedLabels))
+		assert.NotContains(t, svc.Labels, "owner")
+	}
+
+	pdb := cluster.generatePodDisruptionBudget()
+	assert.True(t, util.MapContains(pdb.Labels, inheritedLabels))
+
+	// removing a label from the manifest removes it from the existing objects
+	_, err = cluster.createService(context.TODO(), Master)
+	assert.NoError(t, err)
+	cluster.Spec.InheritedLabels = nil
+	assert.NoError(t, cluster.syncService(context.TODO(), Master))
+
+	svc, err := client.Services(namespace).Get(context.TODO(), cluster.serviceName(Master), metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.NotContains(t, svc.Labels, "cost-center")
+	assert.Equal(t, "test", svc.Labels["environment"])
+}
+
+func TestMetaLabelsPatch(t *testing.T) {
+	patch, err := metaLabelsPatch(
+		map[string]string{"application": "spilo", "cost-center": "1234"},
+		map[string]string{"application": "spilo", "environment": "test"})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"metadata": {"labels": {"application": "spilo", "cost-center": null, "environment": "test"}}}`, string(patch))
+}
+
+func TestRecreateReplicaPodsMaxUnavailable(t *testing.T) {
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "acid-test-cluster",
+			Namespace: "default",
+		},
+	}
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				Resources: config.Resources{
+					PodRoleLabel: "spilo-role",
+				},
+			},
+		}, k8sutil.KubernetesClient{}, pg, logger, eventRecorder)
+
+	tests := []struct {
+		about          string
+		maxUnavailable *int32
+		instances      int
+		expected       int
+	}{
+		{"one replica by default", nil, 7, 1},
+		{"configured number of replicas", int32ToPointer(2), 7, 2},
+		{"capped to keep a majority", int32ToPointer(5), 7, 3},
+		{"one replica at least", int32ToPointer(3), 2, 1},
+	}
+	for _, tt := range tests {
+		cluster.Spec.MaxUnavailableReplicas = tt.maxUnavailable
+		batchSize := cluster.maxUnavailableReplicas(tt.instances)
+		assert.Equal(t, tt.expected, batchSize, tt.about)
+
+		replicaPods := make([]v1.Pod, 0)
+		for i := 1; i < tt.instances; i++ {
+			replicaPods = append(replicaPods, v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      fmt.Sprintf("acid-test-cluster-%d", i),
+					Namespace: "default",
+				},
+			})
+		}
+
+		// the recreated pods are tracked to find the number of replicas down at the same time, a pod stays down
+		// until as many pods as expected in a batch have been started or the wait times out
+		var (
+			mu                  sync.Mutex
+			down, most, started int
+			recreated           []string
+			recreatedAt         = make(map[string]int)
+		)
+		recreate := func(ctx context.Context, podName spec.NamespacedName) (*v1.Pod, error) {
+			mu.Lock()
+			down++
+			started++
+			if down > most {
+				most = down
+			}
+			recreatedAt[podName.Name] = len(recreated)
+			batchEnd := (started + tt.expected - 1) / tt.expected * tt.expected
+			mu.Unlock()
+
+			for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+				mu.Lock()
+				batchStarted := started >= batchEnd || started == len(replicaPods)
+				mu.Unlock()
+				if batchStarted {
+					break
+				}
+			}
+
+			mu.Lock()
+			down--
+			recreated = append(recreated, podName.Name)
+			mu.Unlock()
+			return &v1.Pod{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"spilo-role": "replica"}}}, nil
+		}
+
+		replicas, newMasterPod, err := cluster.recreateReplicaPods(context.TODO(), replicaPods, batchSize, recreate)
+		assert.NoError(t, err, tt.about)
+		assert.Nil(t, newMasterPod, tt.about)
+		assert.Len(t, replicas, tt.instances-1, tt.about)
+		assert.Equal(t, tt.expected, most, "%s: replicas down at the same time", tt.about)
+
+		// a batch starts once the previous one has been recreated
+		for i, pod := range replicaPods {
+			assert.Equal(t, i/batchSize*batchSize, recreatedAt[pod.Name], "%s: start of %s", tt.about, pod.Name)
+		}
+	}
+
+	// a failed replica stops the rolling update after its batch
+	var calls int
+	failing := func(ctx context.Context, podName spec.NamespacedName) (*v1.Pod, error) {
+		calls++
+		return nil, fmt.Errorf("pod did not start")
+	}
+	replicaPods := []v1.Pod{
+		{ObjectMeta: metav1.ObjectMeta{Name: "acid-test-cluster-1", Namespace: "default"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "acid-test-cluster-2", Namespace: "default"}},
+	}
+	_, _, err := cluster.recreateReplicaPods(context.TODO(), replicaPods, 1, failing)
+	assert.EqualError(t, err, `could not recreate replica pod "default/acid-test-cluster-1": pod did not start`)
+	assert.Equal(t, 1, calls)
+}
@@ -2,13 +2,19 @@ package cluster
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 
 	"github.com/aws/aws-sdk-go/aws"
 	acidv1 "github.com/zalando/postgres-operator/pkg/apis/acid.zalan.do/v1"
@@ -16,10 +22,21 @@ import (
 	"github.com/zalando/postgres-operator/pkg/util"
 	"github.com/zalando/postgres-operator/pkg/util/constants"
 	"github.com/zalando/postgres-operator/pkg/util/filesystems"
+	"github.com/zalando/postgres-operator/pkg/util/k8sutil"
 	"github.com/zalando/postgres-operator/pkg/util/volumes"
 )
 
-func (c *Cluster) syncVolumes() error {
+// volumesManaged returns false only if the volumes are explicitly left to an external controller in the manifest
+func volumesManaged(spec *acidv1.PostgresSpec) bool {
+	return spec.ManageVolumes == nil || *spec.ManageVolumes
+}
+
+func (c *Cluster) syncVolumes(ctx context.Context) error {
+	if !volumesManaged(&c.Spec) {
+		c.logger.Debugf("volumes are not managed by the operator (manageVolumes is false), skipping volume sync")
+		return nil
+	}
+
 	c.logger.Debugf("syncing volumes using %q storage resize mode", c.OpConfig.StorageResizeMode)
 	var err error
 
@@ -29,27 +46,32 @@ func (c *Cluster) syncVolumes() error {
 		return fmt.Errorf("could not parse volume size from the manifest: %v", err)
 	}
 
+	// the metadata of the claims does not affect the volumes, a failure is retried on the next sync
+	if err = c.syncVolumeClaimMetadata(ctx); err != nil {
+		c.logger.Warningf("could not sync labels and annotations of persistent volume claims: %v", err)
+	}
+
 	if c.OpConfig.StorageResizeMode == "mixed" {
 		// mixed op uses AWS API to adjust size, throughput, iops, and calls pvc change for file system resize
 		// in case of errors we proceed to let K8s do its work, favoring disk space increase of other adjustments
 
-		err = c.populateVolumeMetaData()
+		err = c.populateVolumeMetaData(ctx)
 		if err != nil {
 			c.logger.Errorf("populating EBS meta data failed, skipping potential adjustements: %v", err)
 		} else {
-			err = c.syncUnderlyingEBSVolume()
+			err = c.syncUnderlyingEBSVolume(ctx)
 			if err != nil {
 				c.logger.Errorf("errors occured during EBS volume adjustments: %v", err)
 			}
 		}
 
 		// resize pvc to adjust filesystem size until better K8s support
-		if err = c.syncVolumeClaims(); err != nil {
+		if err = c.syncVolumeClaims(ctx); err != nil {
 			err = fmt.Errorf("could not sync persistent volume claims: %v", err)
 			return err
 		}
 	} else if c.OpConfig.StorageResizeMode == "pvc" {
-		if err = c.syncVolumeClaims(); err != nil {
+		if err = c.syncVolumeClaims(ctx); err != nil {
 			err = fmt.Errorf("could not sync persistent volume claims: %v", err)
 			return err
 		}
@@ -60,7 +82,7 @@ func (c *Cluster) syncVolumes() error {
 		// TODO: handle the case of the cluster that is downsized and enlarged again
 		// (there will be a volume from the old pod for which we can't act before the
 		//  the statefulset modification is concluded)
-		if err = c.syncEbsVolumes(); err != nil {
+		if err = c.syncEbsVolumes(ctx); err != nil {
 			err = fmt.Errorf("could not sync persistent volumes: %v", err)
 			return err
 		}
@@ -71,7 +93,7 @@ func (c *Cluster) syncVolumes() error {
 	return nil
 }
 
-func (c *Cluster) syncUnderlyingEBSVolume() error {
+func (c *Cluster) syncUnderlyingEBSVolume(ctx context.Context) error {
 	c.logger.Infof("starting to sync EBS volumes: type, iops, throughput, and size")
 
 	var err error
@@ -137,10 +159,10 @@ func (c *Cluster) syncUnderlyingEBSVolume() error {
 	return nil
 }
 
-func (c *Cluster) populateVolumeMetaData() error {
+func (c *Cluster) populateVolumeMetaData(ctx context.Context) error {
 	c.logger.Infof("starting reading ebs meta data")
 
-	pvs, err := c.listPersistentVolumes()
+	pvs, err := c.listPersistentVolumes(ctx)
 	if err != nil {
 		return fmt.Errorf("could not list persistent volumes: %v", err)
 	}
@@ -176,10 +198,10 @@ func (c *Cluster) populateVolumeMetaData() error {
 }
 
 // syncVolumeClaims reads all persistent volume claims and checks that their size matches the one declared in the statefulset.
-func (c *Cluster) syncVolumeClaims() error {
+func (c *Cluster) syncVolumeClaims(ctx context.Context) error {
 	c.setProcessName("syncing volume claims")
 
-	needsResizing, err := c.volumeClaimsNeedResizing(c.Spec.Volume)
+	needsResizing, err := c.volumeClaimsNeedResizing(ctx, c.Spec.Volume)
 	if err != nil {
 		return fmt.Errorf("could not compare size of the volume claims: %v", err)
 	}
@@ -189,7 +211,7 @@ func (c *Cluster) syncVolumeClaims() error {
 		return nil
 	}
 
-	if err := c.resizeVolumeClaims(c.Spec.Volume); err != nil {
+	if err := c.resizeVolumeClaims(ctx, c.Spec.Volume); err != nil {
 		return fmt.Errorf("could not sync volume claims: %v", err)
 	}
 
@@ -199,10 +221,10 @@ func (c *Cluster) syncVolumeClaims() error {
 }
 
 // syncVolumes reads all persistent volumes and checks that their size matches the one declared in the statefulset.
-func (c *Cluster) syncEbsVolumes() error {
+func (c *Cluster) syncEbsVolumes(ctx context.Context) error {
 	c.setProcessName("syncing EBS and Claims volumes")
 
-	act, err := c.volumesNeedResizing()
+	act, err := c.volumesNeedResizing(ctx)
 	if err != nil {
 		return fmt.Errorf("could not compare size of the volumes: %v", err)
 	}
@@ -210,7 +232,7 @@ func (c *Cluster) syncEbsVolumes() error {
 		return nil
 	}
 
-	if err := c.resizeVolumes(); err != nil {
+	if err := c.resizeVolumes(ctx); err != nil {
 		return fmt.Errorf("could not sync volumes: %v", err)
 	}
 
@@ -219,22 +241,210 @@ func (c *Cluster) syncEbsVolumes() error {
 	return nil
 }
 
-func (c *Cluster) listPersistentVolumeClaims() ([]v1.PersistentVolumeClaim, error) {
+func (c *Cluster) listPersistentVolumeClaims(ctx context.Context) ([]v1.PersistentVolumeClaim, error) {
 	ns := c.Namespace
 	listOptions := metav1.ListOptions{
 		LabelSelector: c.labelsSet(false).String(),
 	}
 
-	pvcs, err := c.KubeClient.PersistentVolumeClaims(ns).List(context.TODO(), listOptions)
+	pvcs, err := c.KubeClient.PersistentVolumeClaims(ns).List(ctx, listOptions)
 	if err != nil {
 		return nil, fmt.Errorf("could not list of PersistentVolumeClaims: %v", err)
 	}
 	return pvcs.Items, nil
 }
 
+// syncVolumeClaimMetadata sets the labels and annotations of the volume section on the existing volume claims of
+// the cluster. The claim template of the statefulset is left alone, as changing it replaces the statefulset, so the
+// claims of added pods get them with the next sync. The keys set by the operator are recorded on the claims, the
+// ones removed from the manifest are removed from the claims as well, while the keys of others are kept.
+func (c *Cluster) syncVolumeClaimMetadata(ctx context.Context) error {
+	c.setProcessName("syncing volume claim metadata")
+
+	pvcs, err := c.listPersistentVolumeClaims(ctx)
+	if err != nil {
+		return err
+	}
+
+	// the cluster labels select the claims, they are never overwritten
+	desiredLabels := make(map[string]string, len(c.Spec.Volume.Labels))
+	clusterLabels := c.labelsSet(false)
+	for k, v := range c.Spec.Volume.Labels {
+		if _, ok := clusterLabels[k]; ok {
+			c.logger.Warningf("label %q of the volume section is a cluster label and is not set on the volume claims", k)
+			continue
+		}
+		desiredLabels[k] = v
+	}
+
+	for _, pvc := range pvcs {
+		patchData, err := volumeClaimMetadataPatch(pvc.ObjectMeta, desiredLabels, c.Spec.Volume.Annotations)
+		if err != nil {
+			return fmt.Errorf("could not form patch for volume claim %q: %v", pvc.Name, err)
+		}
+		if patchData == nil {
+			continue
+		}
+		c.syncDriftFound("labels or annotations of volume claim %q do not match the manifest", pvc.Name)
+		if _, err = c.KubeClient.PersistentVolumeClaims(pvc.Namespace).Patch(ctx, pvc.Name, types.MergePatchType,
+			patchData, metav1.PatchOptions{}); err != nil {
+			return fmt.Errorf("could not patch volume claim %q: %v", pvc.Name, err)
+		}
+		c.logger.Infof("labels and annotations of volume claim %q have been updated", pvc.Name)
+	}
+
+	return nil
+}
+
+// volumeClaimMetadataPatch produces a JSON merge patch setting the desired labels and annotations on a volume claim
+// and removing the ones the operator set before that are not desired anymore. It returns nil if the claim matches.
+func volumeClaimMetadataPatch(meta metav1.ObjectMeta, labels, annotations map[string]string) ([]byte, error) {
+	patchLabels := metadataChanges(meta.Labels, labels, meta.Annotations[constants.VolumeLabelsAnnotationKey])
+	patchAnnotations := metadataChanges(meta.Annotations, annotations,
+		meta.Annotations[constants.VolumeAnnotationsAnnotationKey])
+
+	// record the keys set by the operator
+	for key, desired := range map[string]map[string]string{
+		constants.VolumeLabelsAnnotationKey:      labels,
+		constants.VolumeAnnotationsAnnotationKey: annotations,
+	} {
+		keys := make([]string, 0, len(desired))
+		for k := range desired {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		current, exists := meta.Annotations[key]
+		if len(keys) == 0 && exists {
+			patchAnnotations[key] = nil
+		} else if len(keys) > 0 && current != strings.Join(keys, ",") {
+			patchAnnotations[key] = strings.Join(keys, ",")
+		}
+	}
+
+	if len(patchLabels) == 0 && len(patchAnnotations) == 0 {
+		return nil, nil
+	}
+	patch := make(map[string]map[string]interface{})
+	if len(patchLabels) > 0 {
+		patch["labels"] = patchLabels
+	}
+	if len(patchAnnotations) > 0 {
+		patch["annotations"] = patchAnnotations
+	}
+	return json.Marshal(map[string]interface{}{"metadata": patch})
+}
+
+// metadataChanges returns the desired values that differ from the current ones, and the keys of the previously set
+// ones that are not desired anymore with a nil value to remove them
+func metadataChanges(current, desired map[string]string, previousKeys string) map[string]interface{} {
+	changes := make(map[string]interface{})
+	for _, k := range strings.Split(previousKeys, ",") {
+		if _, ok := desired[k]; ok || k == "" {
+			continue
+		}
+		if _, exists := current[k]; exists {
+			changes[k] = nil
+		}
+	}
+	for k, v := range desired {
+		if value, exists := current[k]; !exists || value != v {
+			changes[k] = v
+		}
+	}
+	return changes
+}
+
+// isDataVolumeClaim checks if the claim holds the Postgres data directory, as opposed to a tablespace
+func isDataVolumeClaim(pvc v1.PersistentVolumeClaim) bool {
+	return strings.HasPrefix(pvc.Name, constants.DataVolumeName+"-")
+}
+
+// volumeClaimOrdinal returns the ordinal of the pod a claim of the statefulset belongs to
+func volumeClaimOrdinal(pvcName string) (int32, bool) {
+	lastDash := strings.LastIndex(pvcName, "-")
+	if lastDash <= 0 || lastDash == len(pvcName)-1 {
+		return 0, false
+	}
+	ordinal, err := strconv.ParseInt(pvcName[lastDash+1:], 10, 32)
+	if err != nil || ordinal < 0 {
+		return 0, false
+	}
+	return int32(ordinal), true
+}
+
+// syncRetainedVolumeClaims deletes the volume claims of the pods removed by a scale-down beyond the number retained
+// by the manifest. The claims of the lowest ordinals are kept, a scale-up recreates those pods first. Claims still
+// used by a pod, e.g. one that is still terminating, are left for the next sync.
+func (c *Cluster) syncRetainedVolumeClaims(ctx context.Context) error {
+	if c.Spec.RetainedVolumeClaims == nil || !volumesManaged(&c.Spec) {
+		return nil
+	}
+	// a stopped cluster keeps all of its data, the claims are not scaled down pods
+	instances := c.getNumberOfInstances(&c.Spec)
+	if instances == 0 {
+		c.logger.Debugf("keeping all persistent volume claims of the stopped cluster")
+		return nil
+	}
+	c.setProcessName("syncing retained volume claims")
+
+	pvcs, err := c.listPersistentVolumeClaims(ctx)
+	if err != nil {
+		return err
+	}
+	pods, err := c.listPods(ctx)
+	if err != nil {
+		return fmt.Errorf("could not list pods of the cluster: %v", err)
+	}
+	usedClaims := make(map[string]bool)
+	for _, pod := range pods {
+		for _, volume := range pod.Spec.Volumes {
+			if volume.PersistentVolumeClaim != nil {
+				usedClaims[volume.PersistentVolumeClaim.ClaimName] = true
+			}
+		}
+	}
+
+	// the statefulset may not have been scaled down yet, its pods are not removed
+	if c.Statefulset != nil && c.Statefulset.Spec.Replicas != nil && *c.Statefulset.Spec.Replicas > instances {
+		instances = *c.Statefulset.Spec.Replicas
+	}
+	// the claim of the first pod holds the data of the cluster and is never deleted
+	retainedBelow := instances + *c.Spec.RetainedVolumeClaims
+	if retainedBelow < 1 {
+		retainedBelow = 1
+	}
+	deleted := make([]string, 0)
+	for _, pvc := range pvcs {
+		ordinal, ok := volumeClaimOrdinal(pvc.Name)
+		if !ok || ordinal < retainedBelow || pvc.DeletionTimestamp != nil {
+			continue
+		}
+		if usedClaims[pvc.Name] {
+			c.logger.Infof("keeping persistent volume claim %q still used by a pod", pvc.Name)
+			continue
+		}
+		c.syncDriftFound("persistent volume claim %q is not retained", pvc.Name)
+		if err := c.KubeClient.PersistentVolumeClaims(pvc.Namespace).Delete(ctx, pvc.Name, c.deleteOptions); err != nil {
+			if k8sutil.ResourceNotFound(err) {
+				continue
+			}
+			return fmt.Errorf("could not delete persistent volume claim %q: %v", pvc.Name, err)
+		}
+		c.logger.Infof("deleted persistent volume claim %q of a removed pod", pvc.Name)
+		deleted = append(deleted, pvc.Name)
+	}
+	if len(deleted) > 0 {
+		sort.Strings(deleted)
+		c.eventRecorder.Eventf(c.GetReference(), v1.EventTypeNormal, "Delete",
+			"Deleted persistent volume claims %s of removed pods", strings.Join(deleted, ", "))
+	}
+
+	return nil
+}
+
 func (c *Cluster) deletePersistentVolumeClaims() error {
 	c.logger.Debugln("deleting PVCs")
-	pvcs, err := c.listPersistentVolumeClaims()
+	pvcs, err := c.listPersistentVolumeClaims(context.TODO())
 	if err != nil {
 		return err
 	}
@@ -253,9 +463,9 @@ func (c *Cluster) deletePersistentVolumeClaims() error {
 	return nil
 }
 
-func (c *Cluster) resizeVolumeClaims(newVolume acidv1.Volume) error {
+func (c *Cluster) resizeVolumeClaims(ctx context.Context, newVolume acidv1.Volume) error {
 	c.logger.Debugln("resizing PVCs")
-	pvcs, err := c.listPersistentVolumeClaims()
+	pvcs, err := c.listPersistentVolumeClaims(ctx)
 	if err != nil {
 		return err
 	}
@@ -265,6 +475,9 @@ func (c *Cluster) resizeVolumeClaims(newVolume acidv1.Volume) error {
 	}
 	newSize := quantityToGigabyte(newQuantity)
 	for _, pvc := range pvcs {
+		if !isDataVolumeClaim(pvc) {
+			continue
+		}
 		volumeSize := quantityToGigabyte(pvc.Spec.Resources.Requests[v1.ResourceStorage])
 		if volumeSize >= newSize {
 			if volumeSize > newSize {
@@ -274,7 +487,7 @@ func (c *Cluster) resizeVolumeClaims(newVolume acidv1.Volume) error {
 		}
 		pvc.Spec.Resources.Requests[v1.ResourceStorage] = newQuantity
 		c.logger.Debugf("updating persistent volume claim definition for volume %q", pvc.Name)
-		if _, err := c.KubeClient.PersistentVolumeClaims(pvc.Namespace).Update(context.TODO(), &pvc, metav1.UpdateOptions{}); err != nil {
+		if _, err := c.KubeClient.PersistentVolumeClaims(pvc.Namespace).Update(ctx, &pvc, metav1.UpdateOptions{}); err != nil {
 			return fmt.Errorf("could not update persistent volume claim: %q", err)
 		}
 		c.logger.Debugf("successfully updated persistent volume claim %q", pvc.Name)
@@ -282,15 +495,15 @@ func (c *Cluster) resizeVolumeClaims(newVolume acidv1.Volume) error {
 	return nil
 }
 
-func (c *Cluster) listPersistentVolumes() ([]*v1.PersistentVolume, error) {
+func (c *Cluster) listPersistentVolumes(ctx context.Context) ([]*v1.PersistentVolume, error) {
 	result := make([]*v1.PersistentVolume, 0)
 
-	pvcs, err := c.listPersistentVolumeClaims()
+	pvcs, err := c.listPersistentVolumeClaims(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("could not list cluster's PersistentVolumeClaims: %v", err)
 	}
 
-	pods, err := c.listPods()
+	pods, err := c.listPods(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("could not get list of running pods for resizing persistent volumes: %v", err)
 	}
@@ -298,6 +511,9 @@ func (c *Cluster) listPersistentVolumes() ([]*v1.PersistentVolume, error) {
 	lastPodIndex := len(pods) - 1
 
 	for _, pvc := range pvcs {
+		if !isDataVolumeClaim(pvc) {
+			continue
+		}
 		lastDash := strings.LastIndex(pvc.Name, "-")
 		if lastDash > 0 && lastDash < len(pvc.Name)-1 {
 			pvcNumber, err := strconv.Atoi(pvc.Name[lastDash+1:])
@@ -309,7 +525,7 @@ func (c *Cluster) listPersistentVolumes() ([]*v1.PersistentVolume, error) {
 				continue
 			}
 		}
-		pv, err := c.KubeClient.PersistentVolumes().Get(context.TODO(), pvc.Spec.VolumeName, metav1.GetOptions{})
+		pv, err := c.KubeClient.PersistentVolumes().Get(ctx, pvc.Spec.VolumeName, metav1.GetOptions{})
 		if err != nil {
 			return nil, fmt.Errorf("could not get PersistentVolume: %v", err)
 		}
@@ -320,7 +536,7 @@ func (c *Cluster) listPersistentVolumes() ([]*v1.PersistentVolume, error) {
 }
 
 // resizeVolumes resize persistent volumes compatible with the given resizer interface
-func (c *Cluster) resizeVolumes() error {
+func (c *Cluster) resizeVolumes(ctx context.Context) error {
 	if c.VolumeResizer == nil {
 		return fmt.Errorf("no volume resizer set for EBS volume handling")
 	}
@@ -336,7 +552,7 @@ func (c *Cluster) resizeVolumes() error {
 	resizer := c.VolumeResizer
 	var totalIncompatible int
 
-	pvs, err := c.listPersistentVolumes()
+	pvs, err := c.listPersistentVolumes(ctx)
 	if err != nil {
 		return fmt.Errorf("could not list persistent volumes: %v", err)
 	}
@@ -382,7 +598,7 @@ func (c *Cluster) resizeVolumes() error {
 		c.logger.Debugf("filesystem resize successful on volume %q", pv.Name)
 		pv.Spec.Capacity[v1.ResourceStorage] = newQuantity
 		c.logger.Debugf("updating persistent volume definition for volume %q", pv.Name)
-		if _, err := c.KubeClient.PersistentVolumes().Update(context.TODO(), pv, metav1.UpdateOptions{}); err != nil {
+		if _, err := c.KubeClient.PersistentVolumes().Update(ctx, pv, metav1.UpdateOptions{}); err != nil {
 			return fmt.Errorf("could not update persistent volume: %q", err)
 		}
 		c.logger.Debugf("successfully updated persistent volume %q", pv.Name)
@@ -398,17 +614,20 @@ func (c *Cluster) resizeVolumes() error {
 	return nil
 }
 
-func (c *Cluster) volumeClaimsNeedResizing(newVolume acidv1.Volume) (bool, error) {
+func (c *Cluster) volumeClaimsNeedResizing(ctx context.Context, newVolume acidv1.Volume) (bool, error) {
 	newSize, err := resource.ParseQuantity(newVolume.Size)
 	manifestSize := quantityToGigabyte(newSize)
 	if err != nil {
 		return false, fmt.Errorf("could not parse volume size from the manifest: %v", err)
 	}
-	pvcs, err := c.listPersistentVolumeClaims()
+	pvcs, err := c.listPersistentVolumeClaims(ctx)
 	if err != nil {
 		return false, fmt.Errorf("could not receive persistent volume claims: %v", err)
 	}
 	for _, pvc := range pvcs {
+		if !isDataVolumeClaim(pvc) {
+			continue
+		}
 		currentSize := quantityToGigabyte(pvc.Spec.Resources.Requests[v1.ResourceStorage])
 		if currentSize != manifestSize {
 			return true, nil
@@ -417,11 +636,11 @@ func (c *Cluster) volumeClaimsNeedResizing(newVolume acidv1.Volume) (bool, error
 	return false, nil
 }
 
-func (c *Cluster) volumesNeedResizing() (bool, error) {
+func (c *Cluster) volumesNeedResizing(ctx context.Context) (bool, error) {
 	newQuantity, _ := resource.ParseQuantity(c.Spec.Volume.Size)
 	newSize := quantityToGigabyte(newQuantity)
 
-	vols, err := c.listPersistentVolumes()
+	vols, err := c.listPersistentVolumes(ctx)
 	if err != nil {
 		return false, err
 	}
@@ -445,13 +664,13 @@ func quantityToGigabyte(q resource.Quantity) int64 {
 	return q.ScaledValue(0) / (1 * constants.Gigabyte)
 }
 
-func (c *Cluster) executeEBSMigration() error {
+func (c *Cluster) executeEBSMigration(ctx context.Context) error {
 	if !c.OpConfig.EnableEBSGp3Migration {
 		return nil
 	}
 	c.logger.Infof("starting EBS gp2 to gp3 migration")
 
-	pvs, err := c.listPersistentVolumes()
+	pvs, err := c.listPersistentVolumes(ctx)
 	if err != nil {
 		return fmt.Errorf("could not list persistent volumes: %v", err)
 	}
@@ -505,3 +724,200 @@ func (c *Cluster) executeEBSMigration() error {
 
 	return nil
 }
+
+// defaultVolumeSnapshotRetention is the number of volume snapshots kept when the manifest does not set a retention
+const defaultVolumeSnapshotRetention = 7
+
+var volumeSnapshotResource = schema.GroupVersionResource{
+	Group:    "snapshot.storage.k8s.io",
+	Version:  "v1",
+	Resource: "volumesnapshots",
+}
+
+// storageClassMigrationAllowed tells if the statefulset may be replaced to change the storage class of the data volume
+func (c *Cluster) storageClassMigrationAllowed() bool {
+	migrate, _ := strconv.ParseBool(c.ObjectMeta.Annotations[constants.MigrateStorageClassAnnotationKey])
+	return migrate
+}
+
+// syncStorageClass reports data volume claims whose storage class differs from the manifest. The storage class
+// of a claim can not be changed, the data has to be migrated to new claims by re-creating the pods one by one.
+func (c *Cluster) syncStorageClass(ctx context.Context) error {
+	storageClass := c.Spec.Volume.StorageClass
+	if storageClass == "" {
+		return nil
+	}
+
+	pvcs, err := c.listPersistentVolumeClaims(ctx)
+	if err != nil {
+		return err
+	}
+
+	mismatched := make([]string, 0)
+	for _, pvc := range pvcs {
+		if !isDataVolumeClaim(pvc) {
+			continue
+		}
+		if pvc.Spec.StorageClassName == nil || *pvc.Spec.StorageClassName != storageClass {
+			mismatched = append(mismatched, pvc.Name)
+		}
+	}
+
+	condition := acidv1.ClusterCondition{
+		Type:    acidv1.ClusterConditionStorageClassMatches,
+		Status:  v1.ConditionTrue,
+		Reason:  acidv1.ClusterConditionReasonStorageClassesMatch,
+		Message: fmt.Sprintf("all data volumes use storage class %q", storageClass),
+	}
+	if len(mismatched) > 0 {
+		sort.Strings(mismatched)
+		condition.Status = v1.ConditionFalse
+		condition.Reason = acidv1.ClusterConditionReasonMigrationRequired
+		condition.Message = fmt.Sprintf("persistent volume claims %s do not use storage class %q and can not be changed in place, "+
+			"set the %q annotation to migrate them", strings.Join(mismatched, ", "), storageClass, constants.MigrateStorageClassAnnotationKey)
+		if c.storageClassMigrationAllowed() {
+			condition.Message = fmt.Sprintf("persistent volume claims %s do not use storage class %q yet, "+
+				"re-create the pods together with their claims one by one", strings.Join(mismatched, ", "), storageClass)
+		}
+		c.logger.Warning(condition.Message)
+		c.eventRecorder.Event(c.GetReference(), v1.EventTypeWarning, "StorageClass", condition.Message)
+	}
+
+	return c.setCondition(condition)
+}
+
+// syncVolumeSnapshots takes a snapshot of the data volume once the newest one is older than the interval
+// and deletes the oldest snapshots exceeding the retention
+func (c *Cluster) syncVolumeSnapshots(ctx context.Context, now time.Time) error {
+	if c.Spec.VolumeSnapshots == nil || c.KubeClient.DynamicClient == nil {
+		return nil
+	}
+	c.setProcessName("syncing volume snapshots")
+
+	interval, err := time.ParseDuration(c.Spec.VolumeSnapshots.Interval)
+	if err != nil {
+		return fmt.Errorf("could not parse the volume snapshot interval: %v", err)
+	}
+
+	snapshotsClient := c.KubeClient.DynamicClient.Resource(volumeSnapshotResource).Namespace(c.Namespace)
+	snapshotList, err := snapshotsClient.List(ctx, metav1.ListOptions{LabelSelector: c.labelsSet(false).String()})
+	if err != nil {
+		// the snapshot API is only served when the VolumeSnapshot CRDs of the CSI snapshotter are installed
+		if k8sutil.ResourceNotFound(err) {
+			c.logger.Warningf("could not take volume snapshots: the VolumeSnapshot resource is not available in the cluster")
+			return nil
+		}
+		return fmt.Errorf("could not list volume snapshots: %v", err)
+	}
+
+	snapshots := snapshotList.Items
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].GetCreationTimestamp().Time.Before(snapshots[j].GetCreationTimestamp().Time)
+	})
+
+	if len(snapshots) == 0 || !now.Before(snapshots[len(snapshots)-1].GetCreationTimestamp().Add(interval)) {
+		pvcName, err := c.volumeSnapshotSourcePVC(ctx)
+		if err != nil {
+			return fmt.Errorf("could not find the volume to snapshot: %v", err)
+		}
+		snapshot, err := snapshotsClient.Create(ctx, c.generateVolumeSnapshot(pvcName, now), metav1.CreateOptions{})
+		if err != nil {
+			return fmt.Errorf("could not create volume snapshot of %q: %v", pvcName, err)
+		}
+		c.logger.Infof("created volume snapshot %q of %q", snapshot.GetName(), pvcName)
+		c.eventRecorder.Eventf(c.GetReference(), v1.EventTypeNormal, "VolumeSnapshot",
+			"Created volume snapshot %q of %q", snapshot.GetName(), pvcName)
+		snapshots = append(snapshots, *snapshot)
+	}
+
+	retention := int(c.Spec.VolumeSnapshots.Retention)
+	if retention == 0 {
+		retention = defaultVolumeSnapshotRetention
+	}
+	for _, snapshot := range expiredVolumeSnapshots(snapshots, retention) {
+		if err = snapshotsClient.Delete(ctx, snapshot.GetName(), metav1.DeleteOptions{}); err != nil && !k8sutil.ResourceNotFound(err) {
+			return fmt.Errorf("could not delete expired volume snapshot %q: %v", snapshot.GetName(), err)
+		}
+		c.logger.Infof("deleted expired volume snapshot %q", snapshot.GetName())
+	}
+
+	return nil
+}
+
+// volumeSnapshotSourcePVC returns the data volume claim of a replica to not impact the I/O of the master,
+// only a cluster without replicas is snapshotted from its master
+func (c *Cluster) volumeSnapshotSourcePVC(ctx context.Context) (string, error) {
+	pods, err := c.getRolePods(ctx, Replica)
+	if err != nil {
+		return "", err
+	}
+	if len(pods) == 0 {
+		c.logger.Debugf("no replica found, taking the volume snapshot from the master")
+		if pods, err = c.getRolePods(ctx, Master); err != nil {
+			return "", err
+		}
+	}
+	if len(pods) == 0 {
+		return "", fmt.Errorf("no pods of the cluster found")
+	}
+	sort.Slice(pods, func(i, j int) bool { return pods[i].Name < pods[j].Name })
+
+	return fmt.Sprintf("%s-%s", constants.DataVolumeName, pods[0].Name), nil
+}
+
+func (c *Cluster) generateVolumeSnapshot(pvcName string, now time.Time) *unstructured.Unstructured {
+	snapshotSpec := map[string]interface{}{
+		"source": map[string]interface{}{
+			"persistentVolumeClaimName": pvcName,
+		},
+	}
+	if className := c.Spec.VolumeSnapshots.VolumeSnapshotClassName; className != "" {
+		snapshotSpec["volumeSnapshotClassName"] = className
+	}
+
+	snapshot := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": volumeSnapshotResource.GroupVersion().String(),
+			"kind":       "VolumeSnapshot",
+			"spec":       snapshotSpec,
+		},
+	}
+	snapshot.SetName(fmt.Sprintf("%s-%s", c.Name, now.UTC().Format("20060102-150405")))
+	snapshot.SetNamespace(c.Namespace)
+	snapshot.SetLabels(c.labelsSet(true))
+
+	return snapshot
+}
+
+// expiredVolumeSnapshots returns the snapshots exceeding the retention, the snapshots are sorted from the oldest
+func expiredVolumeSnapshots(snapshots []unstructured.Unstructured, retention int) []unstructured.Unstructured {
+	if len(snapshots) <= retention {
+		return nil
+	}
+	return snapshots[:len(snapshots)-retention]
+}
+
+// deleteVolumeSnapshots deletes the volume snapshots of the cluster, like its volume claims they do not outlive it
+func (c *Cluster) deleteVolumeSnapshots(ctx context.Context) error {
+	if c.KubeClient.DynamicClient == nil {
+		return nil
+	}
+	c.logger.Debugln("deleting volume snapshots")
+	snapshotsClient := c.KubeClient.DynamicClient.Resource(volumeSnapshotResource).Namespace(c.Namespace)
+	snapshotList, err := snapshotsClient.List(ctx, metav1.ListOptions{LabelSelector: c.labelsSet(false).String()})
+	if err != nil {
+		// without the VolumeSnapshot CRDs there is nothing to delete
+		if k8sutil.ResourceNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("could not list volume snapshots: %v", err)
+	}
+	for _, snapshot := range snapshotList.Items {
+		if err = snapshotsClient.Delete(ctx, snapshot.GetName(), c.deleteOptions); err != nil && !k8sutil.ResourceNotFound(err) {
+			return fmt.Errorf("could not delete volume snapshot %q: %v", snapshot.GetName(), err)
+		}
+		c.logger.Infof("volume snapshot %q has been deleted", snapshot.GetName())
+	}
+
+	return nil
+}
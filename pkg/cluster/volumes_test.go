@@ -3,13 +3,18 @@ package cluster
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"context"
 
+	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/golang/mock/gomock"
@@ -17,11 +22,14 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/zalando/postgres-operator/mocks"
 	acidv1 "github.com/zalando/postgres-operator/pkg/apis/acid.zalan.do/v1"
+	fakeacidv1 "github.com/zalando/postgres-operator/pkg/generated/clientset/versioned/fake"
 	"github.com/zalando/postgres-operator/pkg/util/config"
 	"github.com/zalando/postgres-operator/pkg/util/constants"
 	"github.com/zalando/postgres-operator/pkg/util/k8sutil"
 	"github.com/zalando/postgres-operator/pkg/util/volumes"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
 	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
 )
 
 func newFakeK8sPVCclient() (k8sutil.KubernetesClient, *fake.Clientset) {
@@ -71,9 +79,9 @@ func TestResizeVolumeClaim(t *testing.T) {
 	}
 
 	// test resizing
-	cluster.resizeVolumeClaims(acidv1.Volume{Size: newVolumeSize})
+	cluster.resizeVolumeClaims(context.TODO(), acidv1.Volume{Size: newVolumeSize})
 
-	pvcs, err := cluster.listPersistentVolumeClaims()
+	pvcs, err := cluster.listPersistentVolumeClaims(context.TODO())
 	assert.NoError(t, err)
 
 	// check if listPersistentVolumeClaims returns only the PVCs matching the filter
@@ -217,7 +225,7 @@ func TestMigrateEBS(t *testing.T) {
 	resizer.EXPECT().ModifyVolume(gomock.Eq("ebs-volume-1"), gomock.Eq(aws.String("gp3")), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
 
 	cluster.VolumeResizer = resizer
-	cluster.executeEBSMigration()
+	cluster.executeEBSMigration(context.TODO())
 }
 
 type testVolume struct {
@@ -340,7 +348,7 @@ func TestMigrateGp3Support(t *testing.T) {
 	// resizer.EXPECT().ModifyVolume(gomock.Eq("ebs-volume-3"), gomock.Eq(aws.String("gp3")), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
 
 	cluster.VolumeResizer = resizer
-	cluster.syncVolumes()
+	cluster.syncVolumes(context.TODO())
 }
 
 func TestManualGp2Gp3Support(t *testing.T) {
@@ -401,7 +409,7 @@ func TestManualGp2Gp3Support(t *testing.T) {
 	resizer.EXPECT().ModifyVolume(gomock.Eq("ebs-volume-2"), gomock.Eq(aws.String("gp3")), gomock.Nil(), gomock.Eq(aws.Int64(6000)), gomock.Eq(aws.Int64(275))).Return(nil)
 
 	cluster.VolumeResizer = resizer
-	cluster.syncVolumes()
+	cluster.syncVolumes(context.TODO())
 }
 
 func TestDontTouchType(t *testing.T) {
@@ -460,5 +468,425 @@ func TestDontTouchType(t *testing.T) {
 	resizer.EXPECT().ModifyVolume(gomock.Eq("ebs-volume-2"), gomock.Nil(), gomock.Eq(aws.Int64(177)), gomock.Nil(), gomock.Nil()).Return(nil)
 
 	cluster.VolumeResizer = resizer
-	cluster.syncVolumes()
+	cluster.syncVolumes(context.TODO())
+}
+
+func TestVolumeSnapshots(t *testing.T) {
+	client, _ := newFakeK8sPVCclient()
+	clusterName := "acid-test-cluster"
+	namespace := "default"
+
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				Resources: config.Resources{
+					ClusterLabels:    map[string]string{"application": "spilo"},
+					ClusterNameLabel: "cluster-name",
+					PodRoleLabel:     "spilo-role",
+				},
+			},
+		}, client, acidv1.Postgresql{}, logger, eventRecorder)
+	cluster.Name = clusterName
+	cluster.Namespace = namespace
+	cluster.Spec.VolumeSnapshots = &acidv1.VolumeSnapshots{Interval: "24h", VolumeSnapshotClassName: "csi-snapclass"}
+
+	for i, role := range []PostgresRole{Master, Replica, Replica} {
+		pod := v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("%s-%d", clusterName, i),
+				Namespace: namespace,
+				Labels:    labels.Merge(cluster.labelsSet(false), labels.Set{"spilo-role": string(role)}),
+			},
+		}
+		_, err := cluster.KubeClient.Pods(namespace).Create(context.TODO(), &pod, metav1.CreateOptions{})
+		assert.NoError(t, err)
+	}
+
+	// the first replica is snapshotted to not impact the master
+	pvcName, err := cluster.volumeSnapshotSourcePVC(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, constants.DataVolumeName+"-"+clusterName+"-1", pvcName)
+
+	now := time.Date(2021, time.March, 1, 3, 0, 0, 0, time.UTC)
+	snapshot := cluster.generateVolumeSnapshot(pvcName, now)
+	assert.Equal(t, clusterName+"-20210301-030000", snapshot.GetName())
+	assert.Equal(t, "VolumeSnapshot", snapshot.GetKind())
+	assert.Equal(t, map[string]string(cluster.labelsSet(true)), snapshot.GetLabels())
+	source, _, _ := unstructured.NestedString(snapshot.Object, "spec", "source", "persistentVolumeClaimName")
+	assert.Equal(t, pvcName, source)
+	className, _, _ := unstructured.NestedString(snapshot.Object, "spec", "volumeSnapshotClassName")
+	assert.Equal(t, "csi-snapclass", className)
+
+	// only the snapshots exceeding the retention expire, the oldest first
+	snapshots := make([]unstructured.Unstructured, 4)
+	for i := range snapshots {
+		snapshots[i].SetName(fmt.Sprintf("snapshot-%d", i))
+	}
+	expired := expiredVolumeSnapshots(snapshots, 3)
+	assert.Equal(t, 1, len(expired))
+	assert.Equal(t, "snapshot-0", expired[0].GetName())
+	assert.Empty(t, expiredVolumeSnapshots(snapshots, 4))
+}
+
+func TestDeleteVolumeSnapshots(t *testing.T) {
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	client := k8sutil.KubernetesClient{DynamicClient: dynamicClient}
+	clusterName := "acid-test-cluster"
+	namespace := "default"
+
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				Resources: config.Resources{
+					ClusterLabels:    map[string]string{"application": "spilo"},
+					ClusterNameLabel: "cluster-name",
+				},
+			},
+		}, client, acidv1.Postgresql{ObjectMeta: metav1.ObjectMeta{Name: clusterName, Namespace: namespace}},
+		logger, eventRecorder)
+	snapshotsClient := dynamicClient.Resource(volumeSnapshotResource).Namespace(namespace)
+
+	now := time.Date(2021, time.March, 1, 3, 0, 0, 0, time.UTC)
+	for _, snapshot := range []*unstructured.Unstructured{
+		cluster.generateVolumeSnapshot("pgdata-"+clusterName+"-0", now),
+		cluster.generateVolumeSnapshot("pgdata-"+clusterName+"-0", now.Add(24*time.Hour)),
+	} {
+		_, err := snapshotsClient.Create(context.TODO(), snapshot, metav1.CreateOptions{})
+		assert.NoError(t, err)
+	}
+	foreign := cluster.generateVolumeSnapshot("pgdata-other-0", now)
+	foreign.SetName("other-snapshot")
+	foreign.SetLabels(map[string]string{"cluster-name": "other"})
+	_, err := snapshotsClient.Create(context.TODO(), foreign, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	// only the snapshots of the cluster are deleted
+	err = cluster.deleteVolumeSnapshots(context.TODO())
+	assert.NoError(t, err)
+	_, err = snapshotsClient.Get(context.TODO(), clusterName+"-20210301-030000", metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+	_, err = snapshotsClient.Get(context.TODO(), clusterName+"-20210302-030000", metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+	_, err = snapshotsClient.Get(context.TODO(), "other-snapshot", metav1.GetOptions{})
+	assert.NoError(t, err)
+}
+
+func TestSyncStorageClass(t *testing.T) {
+	client, _ := newFakeK8sPVCclient()
+	acidClientSet := fakeacidv1.NewSimpleClientset()
+	client.PostgresqlsGetter = acidClientSet.AcidV1()
+	clusterName := "acid-test-cluster"
+	namespace := "default"
+
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterName,
+			Namespace: namespace,
+		},
+		Spec: acidv1.PostgresSpec{
+			Volume: acidv1.Volume{Size: "1Gi", StorageClass: "fast"},
+		},
+	}
+	_, err := acidClientSet.AcidV1().Postgresqls(namespace).Create(context.TODO(), &pg, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	recorder := record.NewFakeRecorder(10)
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				Resources: config.Resources{
+					ClusterLabels:    map[string]string{"application": "spilo"},
+					ClusterNameLabel: "cluster-name",
+				},
+			},
+		}, client, pg, logger, recorder)
+
+	for i, storageClass := range []string{"fast", "standard"} {
+		class := storageClass
+		pvc := v1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("%s-%s-%d", constants.DataVolumeName, clusterName, i),
+				Namespace: namespace,
+				Labels:    cluster.labelsSet(false),
+			},
+			Spec: v1.PersistentVolumeClaimSpec{StorageClassName: &class},
+		}
+		_, err = cluster.KubeClient.PersistentVolumeClaims(namespace).Create(context.TODO(), &pvc, metav1.CreateOptions{})
+		assert.NoError(t, err)
+	}
+
+	err = cluster.syncStorageClass(context.TODO())
+	assert.NoError(t, err)
+	assert.Len(t, cluster.Status.Conditions, 1)
+	assert.Equal(t, acidv1.ClusterConditionStorageClassMatches, cluster.Status.Conditions[0].Type)
+	assert.Equal(t, v1.ConditionFalse, cluster.Status.Conditions[0].Status)
+	assert.Equal(t, acidv1.ClusterConditionReasonMigrationRequired, cluster.Status.Conditions[0].Reason)
+	assert.Contains(t, cluster.Status.Conditions[0].Message, constants.DataVolumeName+"-"+clusterName+"-1")
+	assert.Len(t, recorder.Events, 1, "the drift is reported as a warning event")
+
+	// the drift is gone once the claim has been re-created with the new storage class
+	err = cluster.KubeClient.PersistentVolumeClaims(namespace).Delete(context.TODO(), constants.DataVolumeName+"-"+clusterName+"-1", metav1.DeleteOptions{})
+	assert.NoError(t, err)
+	err = cluster.syncStorageClass(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, v1.ConditionTrue, cluster.Status.Conditions[0].Status)
+}
+
+func TestSyncVolumesNotManaged(t *testing.T) {
+	client, _ := newFakeK8sPVCclient()
+	clusterName := "acid-test-cluster"
+	namespace := "default"
+
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				Resources: config.Resources{
+					ClusterLabels:    map[string]string{"application": "spilo"},
+					ClusterNameLabel: "cluster-name",
+				},
+				StorageResizeMode: "mixed",
+			},
+		}, client, acidv1.Postgresql{}, logger, eventRecorder)
+
+	manageVolumes := false
+	cluster.Spec.ManageVolumes = &manageVolumes
+	cluster.Spec.Volume.Size = "150Gi"
+	cluster.Name = clusterName
+	cluster.Namespace = namespace
+
+	initTestVolumesAndPods(cluster.KubeClient, namespace, clusterName, cluster.labelsSet(false), []testVolume{{size: 100}, {size: 100}})
+
+	// the resizer fails the test on any call
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cluster.VolumeResizer = mocks.NewMockVolumeResizer(ctrl)
+
+	err := cluster.syncVolumes(context.TODO())
+	assert.NoError(t, err)
+
+	pvcs, err := cluster.listPersistentVolumeClaims(context.TODO())
+	assert.NoError(t, err)
+	assert.Len(t, pvcs, 2)
+	for _, pvc := range pvcs {
+		size := pvc.Spec.Resources.Requests[v1.ResourceStorage]
+		assert.Equal(t, "100", size.String(), "claim %s must not be resized", pvc.Name)
+	}
+}
+
+func TestSyncRetainedVolumeClaims(t *testing.T) {
+	client, _ := newFakeK8sPVCclient()
+	clusterName := "acid-test-cluster"
+	namespace := "default"
+
+	pg := acidv1.Postgresql{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterName,
+			Namespace: namespace,
+		},
+		Spec: acidv1.PostgresSpec{
+			NumberOfInstances: 1,
+			Volume:            acidv1.Volume{Size: "1Gi"},
+		},
+	}
+
+	recorder := record.NewFakeRecorder(10)
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				Resources: config.Resources{
+					ClusterLabels:    map[string]string{"application": "spilo"},
+					ClusterNameLabel: "cluster-name",
+				},
+			},
+		}, client, pg, logger, recorder)
+
+	claimName := func(prefix string, ordinal int) string {
+		return fmt.Sprintf("%s-%s-%d", prefix, clusterName, ordinal)
+	}
+	claims := []string{
+		claimName(constants.DataVolumeName, 0),
+		claimName(constants.DataVolumeName, 1),
+		claimName(constants.DataVolumeName, 2),
+		claimName(constants.DataVolumeName, 3),
+		claimName(constants.DataVolumeName, 4),
+		claimName("tbs", 3),
+	}
+	for _, name := range claims {
+		pvc := v1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+				Labels:    cluster.labelsSet(false),
+			},
+		}
+		_, err := client.PersistentVolumeClaims(namespace).Create(context.TODO(), &pvc, metav1.CreateOptions{})
+		assert.NoError(t, err)
+	}
+
+	// the pod of the master and a removed pod still terminating
+	for _, ordinal := range []int{0, 4} {
+		pod := v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("%s-%d", clusterName, ordinal),
+				Namespace: namespace,
+				Labels:    cluster.labelsSet(false),
+			},
+			Spec: v1.PodSpec{
+				Volumes: []v1.Volume{
+					{
+						Name: constants.DataVolumeName,
+						VolumeSource: v1.VolumeSource{
+							PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{
+								ClaimName: claimName(constants.DataVolumeName, ordinal),
+							},
+						},
+					},
+				},
+			},
+		}
+		_, err := client.Pods(namespace).Create(context.TODO(), &pod, metav1.CreateOptions{})
+		assert.NoError(t, err)
+	}
+
+	claimNames := func() []string {
+		pvcs, err := cluster.listPersistentVolumeClaims(context.TODO())
+		assert.NoError(t, err)
+		names := make([]string, 0, len(pvcs))
+		for _, pvc := range pvcs {
+			names = append(names, pvc.Name)
+		}
+		return names
+	}
+
+	// all claims are kept without a retention
+	err := cluster.syncRetainedVolumeClaims(context.TODO())
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, claims, claimNames())
+
+	// the claims of the first removed pod are retained, the one of the terminating pod is still used
+	retained := int32(1)
+	cluster.Spec.RetainedVolumeClaims = &retained
+	err = cluster.syncRetainedVolumeClaims(context.TODO())
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		claimName(constants.DataVolumeName, 0),
+		claimName(constants.DataVolumeName, 1),
+		claimName(constants.DataVolumeName, 4),
+	}, claimNames())
+	assert.Len(t, recorder.Events, 1)
+
+	// a statefulset not scaled down yet keeps the claims of its pods
+	cluster.Spec.NumberOfInstances = 1
+	retained = 0
+	replicas := int32(2)
+	cluster.Statefulset = &appsv1.StatefulSet{Spec: appsv1.StatefulSetSpec{Replicas: &replicas}}
+	err = cluster.syncRetainedVolumeClaims(context.TODO())
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		claimName(constants.DataVolumeName, 0),
+		claimName(constants.DataVolumeName, 1),
+		claimName(constants.DataVolumeName, 4),
+	}, claimNames())
+
+	// a stopped cluster keeps the claims of its data, even once its pods are gone
+	cluster.Spec.NumberOfInstances = 0
+	replicas = 0
+	for _, ordinal := range []int{0, 4} {
+		err = client.Pods(namespace).Delete(context.TODO(), fmt.Sprintf("%s-%d", clusterName, ordinal), metav1.DeleteOptions{})
+		assert.NoError(t, err)
+	}
+	err = cluster.syncRetainedVolumeClaims(context.TODO())
+	assert.NoError(t, err)
+	assert.Contains(t, claimNames(), claimName(constants.DataVolumeName, 0))
+	assert.Contains(t, claimNames(), claimName(constants.DataVolumeName, 1))
+}
+
+func TestVolumeClaimOrdinal(t *testing.T) {
+	tests := []struct {
+		name    string
+		ordinal int32
+		ok      bool
+	}{
+		{"pgdata-acid-test-cluster-2", 2, true},
+		{"pgdata-acid-test-cluster-12", 12, true},
+		{"pgdata-acid-test-cluster", 0, false},
+		{"pgdata-acid-test-cluster-", 0, false},
+		{"pgdata", 0, false},
+	}
+	for _, tt := range tests {
+		ordinal, ok := volumeClaimOrdinal(tt.name)
+		assert.Equal(t, tt.ok, ok, tt.name)
+		assert.Equal(t, tt.ordinal, ordinal, tt.name)
+	}
+}
+
+func TestSyncVolumeClaimMetadata(t *testing.T) {
+	client, clientSet := newFakeK8sPVCclient()
+	clusterName := "acid-test-cluster"
+	namespace := "default"
+
+	var cluster = New(
+		Config{
+			OpConfig: config.Config{
+				Resources: config.Resources{
+					ClusterLabels:    map[string]string{"application": "spilo"},
+					ClusterNameLabel: "cluster-name",
+				},
+				StorageResizeMode: "off",
+			},
+		}, client, acidv1.Postgresql{}, logger, eventRecorder)
+	cluster.Name = clusterName
+	cluster.Namespace = namespace
+	cluster.Spec.Volume.Size = "1Gi"
+
+	// the claims carry a label of another tool besides the cluster labels
+	claimLabels := labels.Set{"owner": "backup-tool"}
+	for k, v := range cluster.labelsSet(false) {
+		claimLabels[k] = v
+	}
+	for _, pvc := range CreatePVCs(namespace, clusterName, claimLabels, 2, "1Gi").Items {
+		_, err := clientSet.CoreV1().PersistentVolumeClaims(namespace).Create(context.TODO(), &pvc, metav1.CreateOptions{})
+		assert.NoError(t, err)
+	}
+
+	cluster.Spec.Volume.Labels = map[string]string{"cost-center": "dbs", "cluster-name": "other"}
+	cluster.Spec.Volume.Annotations = map[string]string{"billing.example.com/id": "42"}
+	err := cluster.syncVolumes(context.TODO())
+	assert.NoError(t, err)
+
+	pvcs, err := cluster.listPersistentVolumeClaims(context.TODO())
+	assert.NoError(t, err)
+	assert.Len(t, pvcs, 2)
+	for _, pvc := range pvcs {
+		assert.Equal(t, "dbs", pvc.Labels["cost-center"], pvc.Name)
+		assert.Equal(t, clusterName, pvc.Labels["cluster-name"], "cluster labels are never overwritten")
+		assert.Equal(t, "backup-tool", pvc.Labels["owner"], pvc.Name)
+		assert.Equal(t, "42", pvc.Annotations["billing.example.com/id"], pvc.Name)
+		assert.Equal(t, "cost-center", pvc.Annotations[constants.VolumeLabelsAnnotationKey], pvc.Name)
+	}
+
+	// matching claims are not patched again
+	clientSet.ClearActions()
+	err = cluster.syncVolumes(context.TODO())
+	assert.NoError(t, err)
+	for _, action := range clientSet.Actions() {
+		assert.NotEqual(t, "patch", action.GetVerb())
+	}
+
+	// removed keys are removed from the claims, the ones of others are kept
+	cluster.Spec.Volume.Labels = map[string]string{"team": "acid"}
+	cluster.Spec.Volume.Annotations = nil
+	err = cluster.syncVolumes(context.TODO())
+	assert.NoError(t, err)
+
+	pvcs, err = cluster.listPersistentVolumeClaims(context.TODO())
+	assert.NoError(t, err)
+	for _, pvc := range pvcs {
+		assert.NotContains(t, pvc.Labels, "cost-center", pvc.Name)
+		assert.Equal(t, "acid", pvc.Labels["team"], pvc.Name)
+		assert.Equal(t, "backup-tool", pvc.Labels["owner"], pvc.Name)
+		assert.NotContains(t, pvc.Annotations, "billing.example.com/id", pvc.Name)
+		assert.NotContains(t, pvc.Annotations, constants.VolumeAnnotationsAnnotationKey, pvc.Name)
+		assert.Equal(t, "team", pvc.Annotations[constants.VolumeLabelsAnnotationKey], pvc.Name)
+	}
 }
@@ -72,6 +72,8 @@ type Controller struct {
 
 	PodServiceAccount            *v1.ServiceAccount
 	PodServiceAccountRoleBinding *rbacv1.RoleBinding
+
+	syncHooks cluster.SyncHooks
 }
 
 // NewController creates a new controller
@@ -118,6 +120,12 @@ func NewController(controllerConfig *spec.ControllerConfig, controllerId string)
 	return c
 }
 
+// SetSyncHooks sets the hooks invoked at the phases of a cluster sync, it has to be called before Run. There is no
+// configuration option for the hooks, only a build embedding the controller can set them.
+func (c *Controller) SetSyncHooks(hooks cluster.SyncHooks) {
+	c.syncHooks = hooks
+}
+
 func (c *Controller) initClients() {
 	var err error
 
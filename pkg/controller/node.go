@@ -133,7 +133,7 @@ func (c *Controller) attemptToMoveMasterPodsOffNode(node *v1.Node) error {
 	}
 
 	for cl := range clusters {
-		cl.Lock()
+		cl.Lock("moving master pods")
 	}
 
 	for pod, cl := range masterPods {
@@ -45,6 +45,7 @@ func (c *Controller) importConfigurationFromCRD(fromCRD *acidv1.OperatorConfigur
 	result.MaxInstances = fromCRD.MaxInstances
 	result.ResyncPeriod = util.CoalesceDuration(time.Duration(fromCRD.ResyncPeriod), "30m")
 	result.RepairPeriod = util.CoalesceDuration(time.Duration(fromCRD.RepairPeriod), "5m")
+	result.FullResyncPeriod = time.Duration(fromCRD.FullResyncPeriod)
 	result.SetMemoryRequestToLimit = fromCRD.SetMemoryRequestToLimit
 	result.ShmVolume = util.CoalesceBool(fromCRD.ShmVolume, util.True())
 	result.SidecarImages = fromCRD.SidecarImages
@@ -71,6 +72,7 @@ func (c *Controller) importConfigurationFromCRD(fromCRD *acidv1.OperatorConfigur
 	result.WatchedNamespace = fromCRD.Kubernetes.WatchedNamespace
 	result.PDBNameFormat = fromCRD.Kubernetes.PDBNameFormat
 	result.EnablePodDisruptionBudget = util.CoalesceBool(fromCRD.Kubernetes.EnablePodDisruptionBudget, util.True())
+	result.EnablePodAutoHeal = fromCRD.Kubernetes.EnablePodAutoHeal
 	result.StorageResizeMode = util.Coalesce(fromCRD.Kubernetes.StorageResizeMode, "pvc")
 	result.EnableInitContainers = util.CoalesceBool(fromCRD.Kubernetes.EnableInitContainers, util.True())
 	result.EnableSidecars = util.CoalesceBool(fromCRD.Kubernetes.EnableSidecars, util.True())
@@ -96,6 +98,7 @@ func (c *Controller) importConfigurationFromCRD(fromCRD *acidv1.OperatorConfigur
 	result.ClusterLabels = util.CoalesceStrMap(fromCRD.Kubernetes.ClusterLabels, map[string]string{"application": "spilo"})
 	result.InheritedLabels = fromCRD.Kubernetes.InheritedLabels
 	result.InheritedAnnotations = fromCRD.Kubernetes.InheritedAnnotations
+	result.IgnoredAnnotations = fromCRD.Kubernetes.IgnoredAnnotations
 	result.DownscalerAnnotations = fromCRD.Kubernetes.DownscalerAnnotations
 	result.ClusterNameLabel = util.Coalesce(fromCRD.Kubernetes.ClusterNameLabel, "cluster-name")
 	result.DeleteAnnotationDateKey = fromCRD.Kubernetes.DeleteAnnotationDateKey
@@ -120,6 +123,16 @@ func (c *Controller) importConfigurationFromCRD(fromCRD *acidv1.OperatorConfigur
 	result.ResourceCheckTimeout = util.CoalesceDuration(time.Duration(fromCRD.Timeouts.ResourceCheckTimeout), "10m")
 	result.PodLabelWaitTimeout = util.CoalesceDuration(time.Duration(fromCRD.Timeouts.PodLabelWaitTimeout), "10m")
 	result.PodDeletionWaitTimeout = util.CoalesceDuration(time.Duration(fromCRD.Timeouts.PodDeletionWaitTimeout), "10m")
+	result.PodReadyWaitInterval = util.CoalesceDuration(time.Duration(fromCRD.Timeouts.PodReadyWaitInterval), "3s")
+	result.PodReadyWaitMaxInterval = util.CoalesceDuration(time.Duration(fromCRD.Timeouts.PodReadyWaitMaxInterval), "30s")
+	result.PodReadyWaitTimeout = util.CoalesceDuration(time.Duration(fromCRD.Timeouts.PodReadyWaitTimeout), "10m")
+	result.PodReadyWaitJitterPercent = *util.CoalesceInt32(fromCRD.Timeouts.PodReadyWaitJitterPercent, int32ToPointer(20))
+	result.DBStatementTimeout = util.CoalesceDuration(time.Duration(fromCRD.Timeouts.DBStatementTimeout), "1m")
+	result.DBLongStatementTimeout = util.CoalesceDuration(time.Duration(fromCRD.Timeouts.DBLongStatementTimeout), "10m")
+	result.SyncStepTimeout = util.CoalesceDuration(time.Duration(fromCRD.Timeouts.SyncStepTimeout), "2m")
+	result.SyncLongStepTimeout = util.CoalesceDuration(time.Duration(fromCRD.Timeouts.SyncLongStepTimeout), "1h")
+	result.ClusterLockTimeout = util.CoalesceDuration(time.Duration(fromCRD.Timeouts.ClusterLockTimeout), "10m")
+	result.PodAutoHealTimeout = util.CoalesceDuration(time.Duration(fromCRD.Timeouts.PodAutoHealTimeout), "15m")
 	result.ReadyWaitInterval = util.CoalesceDuration(time.Duration(fromCRD.Timeouts.ReadyWaitInterval), "4s")
 	result.ReadyWaitTimeout = util.CoalesceDuration(time.Duration(fromCRD.Timeouts.ReadyWaitTimeout), "30s")
 
@@ -220,6 +233,10 @@ func (c *Controller) importConfigurationFromCRD(fromCRD *acidv1.OperatorConfigur
 		fromCRD.ConnectionPooler.Mode,
 		constants.ConnectionPoolerDefaultMode)
 
+	result.ConnectionPooler.RestartImage = util.Coalesce(
+		fromCRD.ConnectionPooler.RestartImage,
+		constants.ConnectionPoolerDefaultRestartImage)
+
 	result.ConnectionPooler.ConnectionPoolerDefaultCPURequest = util.Coalesce(
 		fromCRD.ConnectionPooler.DefaultCPURequest,
 		constants.ConnectionPoolerDefaultCpuRequest)
@@ -362,8 +362,8 @@ func (c *Controller) warnOnDeprecatedPostgreSQLSpecParameters(spec *acidv1.Postg
 		deprecate("replicaLoadBalancer", "enableReplicaLoadBalancer")
 	}
 
-	if len(spec.MaintenanceWindows) > 0 {
-		noeffect("maintenanceWindows", "Not implemented.")
+	if len(spec.MaintenanceWindows) > 0 && !spec.DeferRestartParameters && !spec.DeferRollingUpdates {
+		noeffect("maintenanceWindows", "Only used to defer parameters requiring a restart or rolling updates.")
 	}
 
 	if (spec.UseLoadBalancer != nil || spec.ReplicaLoadBalancer != nil) &&
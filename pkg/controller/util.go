@@ -34,6 +34,7 @@ func (c *Controller) makeClusterConfig() cluster.Config {
 		PgTeamMap:           c.pgTeamMap,
 		InfrastructureRoles: infrastructureRoles,
 		PodServiceAccount:   c.PodServiceAccount,
+		SyncHooks:           c.syncHooks,
 	}
 }
 
@@ -1,6 +1,7 @@
 package spec
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -53,6 +54,10 @@ type PgUser struct {
 	MemberOf   []string          `yaml:"inrole"`
 	Parameters map[string]string `yaml:"db_parameters"`
 	AdminRole  string            `yaml:"admin_role"`
+	// ConnectionLimit is nil when the limit is not managed, -1 means no limit
+	ConnectionLimit *int64 `yaml:"connection_limit"`
+	// ValidUntil is nil when the expiry is not managed, the zero time means the role never expires
+	ValidUntil *time.Time `yaml:"valid_until"`
 }
 
 func (user *PgUser) Valid() bool {
@@ -66,12 +71,14 @@ type PgUserMap map[string]PgUser
 type PgSyncUserRequest struct {
 	Kind syncUserOperation
 	User PgUser
+	// PasswordEncryption is the method the password is encrypted with, md5 if empty
+	PasswordEncryption string
 }
 
 // UserSyncer defines an interface for the implementations to sync users from the manifest to the DB.
 type UserSyncer interface {
-	ProduceSyncRequests(dbUsers PgUserMap, newUsers PgUserMap) (req []PgSyncUserRequest)
-	ExecuteSyncRequests(req []PgSyncUserRequest, db *sql.DB) error
+	ProduceSyncRequests(dbUsers PgUserMap, newUsers PgUserMap, passwordEncryption string) (req []PgSyncUserRequest)
+	ExecuteSyncRequests(ctx context.Context, req []PgSyncUserRequest, db *sql.DB) error
 }
 
 // LogEntry describes log entry in the RingLogger
@@ -18,6 +18,7 @@ type CRD struct {
 	ReadyWaitTimeout    time.Duration `name:"ready_wait_timeout" default:"30s"`
 	ResyncPeriod        time.Duration `name:"resync_period" default:"30m"`
 	RepairPeriod        time.Duration `name:"repair_period" default:"5m"`
+	FullResyncPeriod    time.Duration `name:"full_resync_period"`
 	EnableCRDValidation *bool         `name:"enable_crd_validation" default:"true"`
 }
 
@@ -27,6 +28,16 @@ type Resources struct {
 	ResourceCheckTimeout      time.Duration       `name:"resource_check_timeout" default:"10m"`
 	PodLabelWaitTimeout       time.Duration       `name:"pod_label_wait_timeout" default:"10m"`
 	PodDeletionWaitTimeout    time.Duration       `name:"pod_deletion_wait_timeout" default:"10m"`
+	PodReadyWaitInterval      time.Duration       `name:"pod_ready_wait_interval" default:"3s"`
+	PodReadyWaitMaxInterval   time.Duration       `name:"pod_ready_wait_max_interval" default:"30s"`
+	PodReadyWaitTimeout       time.Duration       `name:"pod_ready_wait_timeout" default:"10m"`
+	PodReadyWaitJitterPercent int32               `name:"pod_ready_wait_jitter_percent" default:"20"`
+	DBStatementTimeout        time.Duration       `name:"db_statement_timeout" default:"1m"`
+	DBLongStatementTimeout    time.Duration       `name:"db_long_statement_timeout" default:"10m"`
+	SyncStepTimeout           time.Duration       `name:"sync_step_timeout" default:"2m"`
+	SyncLongStepTimeout       time.Duration       `name:"sync_long_step_timeout" default:"1h"`
+	ClusterLockTimeout        time.Duration       `name:"cluster_lock_timeout" default:"10m"`
+	PodAutoHealTimeout        time.Duration       `name:"pod_auto_heal_timeout" default:"15m"`
 	PodTerminateGracePeriod   time.Duration       `name:"pod_terminate_grace_period" default:"5m"`
 	SpiloRunAsUser            *int64              `json:"spilo_runasuser,omitempty"`
 	SpiloRunAsGroup           *int64              `json:"spilo_runasgroup,omitempty"`
@@ -38,6 +49,7 @@ type Resources struct {
 	ClusterLabels             map[string]string   `name:"cluster_labels" default:"application:spilo"`
 	InheritedLabels           []string            `name:"inherited_labels" default:""`
 	InheritedAnnotations      []string            `name:"inherited_annotations" default:""`
+	IgnoredAnnotations        []string            `name:"ignored_annotations" default:""`
 	DownscalerAnnotations     []string            `name:"downscaler_annotations"`
 	ClusterNameLabel          string              `name:"cluster_name_label" default:"cluster-name"`
 	DeleteAnnotationDateKey   string              `name:"delete_annotation_date_key"`
@@ -137,6 +149,7 @@ type ConnectionPooler struct {
 	ConnectionPoolerDefaultMemoryRequest string `name:"connection_pooler_default_memory_request" default:"100Mi"`
 	ConnectionPoolerDefaultCPULimit      string `name:"connection_pooler_default_cpu_limit" default:"1"`
 	ConnectionPoolerDefaultMemoryLimit   string `name:"connection_pooler_default_memory_limit" default:"100Mi"`
+	RestartImage                         string `name:"connection_pooler_restart_image" default:"bitnami/kubectl:1.19"`
 }
 
 // Config describes operator config
@@ -191,6 +204,7 @@ type Config struct {
 	ReplicaDNSNameFormat                   StringTemplate    `name:"replica_dns_name_format" default:"{cluster}-repl.{team}.{hostedzone}"`
 	PDBNameFormat                          StringTemplate    `name:"pdb_name_format" default:"postgres-{cluster}-pdb"`
 	EnablePodDisruptionBudget              *bool             `name:"enable_pod_disruption_budget" default:"true"`
+	EnablePodAutoHeal                      bool              `name:"enable_pod_auto_heal" default:"false"`
 	EnableInitContainers                   *bool             `name:"enable_init_containers" default:"true"`
 	EnableSidecars                         *bool             `name:"enable_sidecars" default:"true"`
 	Workers                                uint32            `name:"workers" default:"8"`
@@ -8,4 +8,21 @@ const (
 	KubeIAmAnnotation                  = "iam.amazonaws.com/role"
 	VolumeStorateProvisionerAnnotation = "pv.kubernetes.io/provisioned-by"
 	PostgresqlControllerAnnotationKey  = "acid.zalan.do/controller"
+	SwitchoverCandidateAnnotationKey   = "acid.zalan.do/switchover-candidate"
+	KeepSecretAnnotationKey            = "acid.zalan.do/keep-secret"
+	NoFailoverAnnotationKey            = "acid.zalan.do/nofailover"
+	ReplicateFromAnnotationKey         = "acid.zalan.do/replicatefrom"
+	RotateSystemPasswordsAnnotationKey = "acid.zalan.do/rotate-system-passwords"
+	EnvChecksumAnnotationKey           = "acid.zalan.do/env-checksum"
+	VolumeChecksumAnnotationKey        = "acid.zalan.do/volume-checksum"
+	MigrateStorageClassAnnotationKey   = "acid.zalan.do/migrate-storage-class"
+	ForceResyncAnnotationKey           = "acid.zalan.do/force-resync"
+	LastAppliedAnnotationKey           = "acid.zalan.do/last-applied"
+	VolumeLabelsAnnotationKey          = "acid.zalan.do/volume-labels"
+	VolumeAnnotationsAnnotationKey     = "acid.zalan.do/volume-annotations"
+)
+
+// Names of Kubernetes labels the operator maintains on pods
+const (
+	SyncStandbyLabelKey = "acid.zalan.do/sync-standby"
 )
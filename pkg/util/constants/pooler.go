@@ -10,9 +10,12 @@ const (
 	ConnectionPoolerDefaultCpuLimit      = "1"
 	ConnectionPoolerDefaultMemoryRequest = "100Mi"
 	ConnectionPoolerDefaultMemoryLimit   = "100Mi"
+	ConnectionPoolerDefaultRestartImage  = "bitnami/kubectl:1.19"
 
 	ConnectionPoolerContainer            = 0
 	ConnectionPoolerMaxDBConnections     = 60
 	ConnectionPoolerMaxClientConnections = 10000
 	ConnectionPoolerMinInstances         = 1
+
+	ConnectionPoolerDefaultTargetCPUUtilization = 80
 )
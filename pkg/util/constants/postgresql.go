@@ -8,6 +8,16 @@ const (
 	PostgresDataMount = "/home/postgres/pgdata"
 	PostgresDataPath  = PostgresDataMount + "/pgroot"
 
+	TablespaceVolumePrefix = "tablespace-"
+	TablespacesMount       = "/home/postgres/tablespaces"
+
+	TLSMountPath           = "/tls"
+	PatroniAPITLSMountPath = "/tls-patroni-api"
+	PatroniAPITLSVolume    = "patroni-api-tls"
+
+	// local configuration Spilo writes for Patroni on start
+	PatroniConfigFile = "/home/postgres/postgres.yml"
+
 	PostgresConnectRetryTimeout = 2 * time.Minute
 	PostgresConnectTimeout      = 15 * time.Second
 
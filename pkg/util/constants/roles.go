@@ -19,4 +19,8 @@ const (
 	WriterRoleNameSuffix        = "_writer"
 	UserRoleNameSuffix          = "_user"
 	DefaultSearchPath           = "\"$user\""
+	MonitoringUserName          = "monitoring"
+	MonitoringRoleName          = "pg_monitor"
+	MonitoringExtensionName     = "pg_stat_statements"
+	BackupUserName              = "backup"
 )
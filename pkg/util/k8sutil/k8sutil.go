@@ -4,11 +4,14 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"sort"
+	"strings"
 
 	b64 "encoding/base64"
 	"encoding/json"
 
 	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	clientbatchv1 "k8s.io/client-go/kubernetes/typed/batch/v1"
 	clientbatchv1beta1 "k8s.io/client-go/kubernetes/typed/batch/v1beta1"
 
 	apiacidv1 "github.com/zalando/postgres-operator/pkg/apis/acid.zalan.do/v1"
@@ -23,8 +26,10 @@ import (
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	appsv1 "k8s.io/client-go/kubernetes/typed/apps/v1"
+	autoscalingv1 "k8s.io/client-go/kubernetes/typed/autoscaling/v1"
 	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	policyv1beta1 "k8s.io/client-go/kubernetes/typed/policy/v1beta1"
 	rbacv1 "k8s.io/client-go/kubernetes/typed/rbac/v1"
@@ -49,17 +54,22 @@ type KubernetesClient struct {
 	corev1.NamespacesGetter
 	corev1.ServiceAccountsGetter
 	corev1.EventsGetter
+	corev1.ResourceQuotasGetter
 	appsv1.StatefulSetsGetter
 	appsv1.DeploymentsGetter
+	autoscalingv1.HorizontalPodAutoscalersGetter
 	rbacv1.RoleBindingsGetter
+	rbacv1.RolesGetter
 	policyv1beta1.PodDisruptionBudgetsGetter
 	apiextv1.CustomResourceDefinitionsGetter
 	clientbatchv1beta1.CronJobsGetter
+	clientbatchv1.JobsGetter
 	acidv1.OperatorConfigurationsGetter
 	acidv1.PostgresTeamsGetter
 	acidv1.PostgresqlsGetter
 
 	RESTClient      rest.Interface
+	DynamicClient   dynamic.Interface
 	AcidV1ClientSet *acidv1client.Clientset
 }
 
@@ -124,6 +134,24 @@ func ResourceNotFound(err error) bool {
 	return apierrors.IsNotFound(err)
 }
 
+// InvalidNodePort checks if error corresponds to a rejected node port of a service
+// and returns the reason, e.g. the port is out of range or already allocated
+func InvalidNodePort(err error) (string, bool) {
+	if !apierrors.IsInvalid(err) {
+		return "", false
+	}
+	status, ok := err.(apierrors.APIStatus)
+	if !ok || status.Status().Details == nil {
+		return "", false
+	}
+	for _, cause := range status.Status().Details.Causes {
+		if strings.HasSuffix(cause.Field, ".nodePort") {
+			return cause.Message, true
+		}
+	}
+	return "", false
+}
+
 // NewFromConfig create Kubernetes Interface using REST config
 func NewFromConfig(cfg *rest.Config) (KubernetesClient, error) {
 	kubeClient := KubernetesClient{}
@@ -145,11 +173,15 @@ func NewFromConfig(cfg *rest.Config) (KubernetesClient, error) {
 	kubeClient.NamespacesGetter = client.CoreV1()
 	kubeClient.StatefulSetsGetter = client.AppsV1()
 	kubeClient.DeploymentsGetter = client.AppsV1()
+	kubeClient.HorizontalPodAutoscalersGetter = client.AutoscalingV1()
 	kubeClient.PodDisruptionBudgetsGetter = client.PolicyV1beta1()
 	kubeClient.RESTClient = client.CoreV1().RESTClient()
 	kubeClient.RoleBindingsGetter = client.RbacV1()
+	kubeClient.RolesGetter = client.RbacV1()
 	kubeClient.CronJobsGetter = client.BatchV1beta1()
+	kubeClient.JobsGetter = client.BatchV1()
 	kubeClient.EventsGetter = client.CoreV1()
+	kubeClient.ResourceQuotasGetter = client.CoreV1()
 
 	apiextClient, err := apiextclient.NewForConfig(cfg)
 	if err != nil {
@@ -158,6 +190,12 @@ func NewFromConfig(cfg *rest.Config) (KubernetesClient, error) {
 
 	kubeClient.CustomResourceDefinitionsGetter = apiextClient.ApiextensionsV1()
 
+	// custom resources without a typed client, e.g. volume snapshots, are accessed dynamically
+	kubeClient.DynamicClient, err = dynamic.NewForConfig(cfg)
+	if err != nil {
+		return kubeClient, fmt.Errorf("could not create dynamic client: %v", err)
+	}
+
 	kubeClient.AcidV1ClientSet = acidv1client.NewForConfigOrDie(cfg)
 	if err != nil {
 		return kubeClient, fmt.Errorf("could not create acid.zalan.do clientset: %v", err)
@@ -197,6 +235,97 @@ func (client *KubernetesClient) SetPostgresCRDStatus(clusterName spec.Namespaced
 	return pg, nil
 }
 
+// SetPostgresCRDConditions replaces the conditions in the status of the Postgres cluster
+func (client *KubernetesClient) SetPostgresCRDConditions(clusterName spec.NamespacedName, conditions []apiacidv1.ClusterCondition) (*apiacidv1.Postgresql, error) {
+	return client.patchPostgresCRDStatus(clusterName, map[string]interface{}{"conditions": conditions})
+}
+
+// SetPostgresCRDInitScripts records the completed init scripts in the status of the Postgres cluster
+func (client *KubernetesClient) SetPostgresCRDInitScripts(clusterName spec.NamespacedName, initScripts []string) (*apiacidv1.Postgresql, error) {
+	return client.patchPostgresCRDStatus(clusterName, map[string]interface{}{"initScripts": initScripts})
+}
+
+// SetPostgresCRDMembers replaces the Patroni members in the status of the Postgres cluster
+func (client *KubernetesClient) SetPostgresCRDMembers(clusterName spec.NamespacedName, members []apiacidv1.MemberStatus) (*apiacidv1.Postgresql, error) {
+	return client.patchPostgresCRDStatus(clusterName, map[string]interface{}{"members": members})
+}
+
+// SetPostgresCRDPromotionTime records when the standby cluster was promoted in the status of the Postgres cluster
+func (client *KubernetesClient) SetPostgresCRDPromotionTime(clusterName spec.NamespacedName, promotionTime metav1.Time) (*apiacidv1.Postgresql, error) {
+	return client.patchPostgresCRDStatus(clusterName, map[string]interface{}{"promotionTime": promotionTime})
+}
+
+// SetPostgresCRDSynchronousMode records the effective synchronous mode of Patroni in the status of the Postgres cluster
+func (client *KubernetesClient) SetPostgresCRDSynchronousMode(clusterName spec.NamespacedName, mode string) (*apiacidv1.Postgresql, error) {
+	return client.patchPostgresCRDStatus(clusterName, map[string]interface{}{"synchronousMode": mode})
+}
+
+// SetPostgresCRDMaximumLagOnFailover records the effective maximum_lag_on_failover of Patroni in the status of the
+// Postgres cluster
+func (client *KubernetesClient) SetPostgresCRDMaximumLagOnFailover(clusterName spec.NamespacedName, maxLag int64) (*apiacidv1.Postgresql, error) {
+	return client.patchPostgresCRDStatus(clusterName, map[string]interface{}{"maximumLagOnFailover": maxLag})
+}
+
+// SetPostgresCRDLoadBalancers replaces the load balancers of the master and replica services in the status of the
+// Postgres cluster
+func (client *KubernetesClient) SetPostgresCRDLoadBalancers(clusterName spec.NamespacedName, loadBalancers []apiacidv1.LoadBalancerStatus) (*apiacidv1.Postgresql, error) {
+	return client.patchPostgresCRDStatus(clusterName, map[string]interface{}{"loadBalancers": loadBalancers})
+}
+
+// SetPostgresCRDReplicationSlots records the permanent replication slots the operator set in the Patroni
+// configuration in the status of the Postgres cluster
+func (client *KubernetesClient) SetPostgresCRDReplicationSlots(clusterName spec.NamespacedName, slots []string) (*apiacidv1.Postgresql, error) {
+	return client.patchPostgresCRDStatus(clusterName, map[string]interface{}{"replicationSlots": slots})
+}
+
+// SetPostgresCRDObservedGeneration records the generation of the manifest the last successful sync was based on
+func (client *KubernetesClient) SetPostgresCRDObservedGeneration(clusterName spec.NamespacedName, generation int64) (*apiacidv1.Postgresql, error) {
+	return client.patchPostgresCRDStatus(clusterName, map[string]interface{}{"observedGeneration": generation})
+}
+
+// patchPostgresCRDStatus sets the given fields in the status of the Postgres cluster with a merge patch, leaving
+// the other fields alone
+func (client *KubernetesClient) patchPostgresCRDStatus(clusterName spec.NamespacedName, status map[string]interface{}) (*apiacidv1.Postgresql, error) {
+	var pg *apiacidv1.Postgresql
+
+	fields := make([]string, 0, len(status))
+	for field := range status {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	patch, err := json.Marshal(struct {
+		PgStatus interface{} `json:"status"`
+	}{status})
+	if err != nil {
+		return pg, fmt.Errorf("could not marshal status %s: %v", strings.Join(fields, ", "), err)
+	}
+
+	pg, err = client.PostgresqlsGetter.Postgresqls(clusterName.Namespace).Patch(
+		context.TODO(), clusterName.Name, types.MergePatchType, patch, metav1.PatchOptions{}, "status")
+	if err != nil {
+		return pg, fmt.Errorf("could not update status %s: %v", strings.Join(fields, ", "), err)
+	}
+
+	return pg, nil
+}
+
+// sessionAffinity returns the effective session affinity of a service and its timeout
+func sessionAffinity(svc *v1.Service) (v1.ServiceAffinity, int32) {
+	if svc.Spec.SessionAffinity != v1.ServiceAffinityClientIP {
+		return v1.ServiceAffinityNone, 0
+	}
+
+	timeout := v1.DefaultClientIPServiceAffinitySeconds
+	if svc.Spec.SessionAffinityConfig != nil &&
+		svc.Spec.SessionAffinityConfig.ClientIP != nil &&
+		svc.Spec.SessionAffinityConfig.ClientIP.TimeoutSeconds != nil {
+		timeout = *svc.Spec.SessionAffinityConfig.ClientIP.TimeoutSeconds
+	}
+
+	return v1.ServiceAffinityClientIP, timeout
+}
+
 // SameService compares the Services
 func SameService(cur, new *v1.Service) (match bool, reason string) {
 	//TODO: improve comparison
@@ -205,6 +334,11 @@ func SameService(cur, new *v1.Service) (match bool, reason string) {
 			new.Spec.Type, cur.Spec.Type)
 	}
 
+	// the endpoints of a service without selector are maintained by Patroni or the operator
+	if (len(cur.Spec.Selector) != 0 || len(new.Spec.Selector) != 0) && !reflect.DeepEqual(cur.Spec.Selector, new.Spec.Selector) {
+		return false, "new service's selector does not match the current one"
+	}
+
 	oldSourceRanges := cur.Spec.LoadBalancerSourceRanges
 	newSourceRanges := new.Spec.LoadBalancerSourceRanges
 
@@ -215,6 +349,48 @@ func SameService(cur, new *v1.Service) (match bool, reason string) {
 		}
 	}
 
+	// Kubernetes defaults the policy of load balancers and node ports to "Cluster", so compare only a requested one
+	if new.Spec.ExternalTrafficPolicy != "" && cur.Spec.ExternalTrafficPolicy != new.Spec.ExternalTrafficPolicy {
+		return false, fmt.Sprintf("new service's external traffic policy %q does not match the current one %q",
+			new.Spec.ExternalTrafficPolicy, cur.Spec.ExternalTrafficPolicy)
+	}
+
+	// Kubernetes defaults an empty session affinity to "None" and the timeout to three hours,
+	// so compare the effective values only
+	curSessionAffinity, curSessionAffinityTimeout := sessionAffinity(cur)
+	newSessionAffinity, newSessionAffinityTimeout := sessionAffinity(new)
+	if curSessionAffinity != newSessionAffinity {
+		return false, fmt.Sprintf("new service's session affinity %q does not match the current one %q",
+			newSessionAffinity, curSessionAffinity)
+	}
+	if curSessionAffinityTimeout != newSessionAffinityTimeout {
+		return false, fmt.Sprintf("new service's session affinity timeout %d does not match the current one %d",
+			newSessionAffinityTimeout, curSessionAffinityTimeout)
+	}
+
+	// Kubernetes defaults the protocol of the ports, so compare only the fields set by the operator
+	if len(cur.Spec.Ports) != len(new.Spec.Ports) {
+		return false, fmt.Sprintf("new service's number of ports %d does not match the current one %d",
+			len(new.Spec.Ports), len(cur.Spec.Ports))
+	}
+	for i, port := range new.Spec.Ports {
+		curPort := cur.Spec.Ports[i]
+		if curPort.Name != port.Name || curPort.Port != port.Port || curPort.TargetPort != port.TargetPort {
+			return false, fmt.Sprintf("new service's port %q does not match the current one", port.Name)
+		}
+	}
+
+	// Kubernetes allocates a node port if none is requested, so compare only the requested ones
+	for i, port := range new.Spec.Ports {
+		if port.NodePort == 0 || i >= len(cur.Spec.Ports) {
+			continue
+		}
+		if cur.Spec.Ports[i].NodePort != port.NodePort {
+			return false, fmt.Sprintf("new service's node port %d does not match the current one %d",
+				port.NodePort, cur.Spec.Ports[i].NodePort)
+		}
+	}
+
 	match = true
 
 	reasonPrefix := "new service's annotations does not match the current one:"
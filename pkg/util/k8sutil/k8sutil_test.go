@@ -7,6 +7,7 @@ import (
 	"github.com/zalando/postgres-operator/pkg/util/constants"
 
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 func newsService(ann map[string]string, svcT v1.ServiceType, lbSr []string) *v1.Service {
@@ -309,3 +310,291 @@ func TestSameService(t *testing.T) {
 		})
 	}
 }
+
+func newsServiceWithSessionAffinity(affinity v1.ServiceAffinity, timeout *int32) *v1.Service {
+	svc := newsService(nil, v1.ServiceTypeClusterIP, nil)
+	svc.Spec.SessionAffinity = affinity
+	if timeout != nil {
+		svc.Spec.SessionAffinityConfig = &v1.SessionAffinityConfig{
+			ClientIP: &v1.ClientIPConfig{TimeoutSeconds: timeout},
+		}
+	}
+	return svc
+}
+
+func TestSameServiceSessionAffinity(t *testing.T) {
+	defaultTimeout := v1.DefaultClientIPServiceAffinitySeconds
+	customTimeout := int32(600)
+
+	tests := []struct {
+		about   string
+		current *v1.Service
+		new     *v1.Service
+		reason  string
+		match   bool
+	}{
+		{
+			about:   "empty session affinity equals None",
+			current: newsServiceWithSessionAffinity(v1.ServiceAffinityNone, nil),
+			new:     newsServiceWithSessionAffinity("", nil),
+			match:   true,
+		},
+		{
+			about:   "session affinity enabled",
+			current: newsServiceWithSessionAffinity(v1.ServiceAffinityNone, nil),
+			new:     newsServiceWithSessionAffinity(v1.ServiceAffinityClientIP, &defaultTimeout),
+			match:   false,
+			reason:  `new service's session affinity "ClientIP" does not match the current one "None"`,
+		},
+		{
+			about:   "session affinity disabled",
+			current: newsServiceWithSessionAffinity(v1.ServiceAffinityClientIP, &defaultTimeout),
+			new:     newsServiceWithSessionAffinity("", nil),
+			match:   false,
+			reason:  `new service's session affinity "None" does not match the current one "ClientIP"`,
+		},
+		{
+			about:   "default timeout equals an omitted one",
+			current: newsServiceWithSessionAffinity(v1.ServiceAffinityClientIP, nil),
+			new:     newsServiceWithSessionAffinity(v1.ServiceAffinityClientIP, &defaultTimeout),
+			match:   true,
+		},
+		{
+			about:   "session affinity timeout changed",
+			current: newsServiceWithSessionAffinity(v1.ServiceAffinityClientIP, &defaultTimeout),
+			new:     newsServiceWithSessionAffinity(v1.ServiceAffinityClientIP, &customTimeout),
+			match:   false,
+			reason:  `new service's session affinity timeout 600 does not match the current one 10800`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.about, func(t *testing.T) {
+			match, reason := SameService(tt.current, tt.new)
+			if match != tt.match {
+				t.Errorf("expected match to be %t, got %t (reason: %s)", tt.match, match, reason)
+				return
+			}
+			if !match && reason != tt.reason {
+				t.Errorf("expected reason '%s', found '%s'", tt.reason, reason)
+			}
+		})
+	}
+}
+
+func TestSameServiceExternalTrafficPolicy(t *testing.T) {
+	withPolicy := func(policy v1.ServiceExternalTrafficPolicyType) *v1.Service {
+		svc := newsService(nil, v1.ServiceTypeLoadBalancer, []string{"127.0.0.1/32"})
+		svc.Spec.ExternalTrafficPolicy = policy
+		return svc
+	}
+
+	tests := []struct {
+		about   string
+		current *v1.Service
+		new     *v1.Service
+		reason  string
+		match   bool
+	}{
+		{
+			about:   "same policy",
+			current: withPolicy(v1.ServiceExternalTrafficPolicyTypeLocal),
+			new:     withPolicy(v1.ServiceExternalTrafficPolicyTypeLocal),
+			match:   true,
+		},
+		{
+			about:   "policy changed to Local",
+			current: withPolicy(v1.ServiceExternalTrafficPolicyTypeCluster),
+			new:     withPolicy(v1.ServiceExternalTrafficPolicyTypeLocal),
+			match:   false,
+			reason:  `new service's external traffic policy "Local" does not match the current one "Cluster"`,
+		},
+		{
+			about:   "policy changed back to Cluster",
+			current: withPolicy(v1.ServiceExternalTrafficPolicyTypeLocal),
+			new:     withPolicy(v1.ServiceExternalTrafficPolicyTypeCluster),
+			match:   false,
+			reason:  `new service's external traffic policy "Cluster" does not match the current one "Local"`,
+		},
+		{
+			about:   "defaulted policy equals an omitted one",
+			current: withPolicy(v1.ServiceExternalTrafficPolicyTypeCluster),
+			new:     withPolicy(""),
+			match:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.about, func(t *testing.T) {
+			match, reason := SameService(tt.current, tt.new)
+			if match != tt.match {
+				t.Errorf("expected match to be %t, got %t (reason: %s)", tt.match, match, reason)
+				return
+			}
+			if !match && reason != tt.reason {
+				t.Errorf("expected reason '%s', found '%s'", tt.reason, reason)
+			}
+		})
+	}
+}
+
+func newsServiceWithNodePort(nodePort int32) *v1.Service {
+	svc := newsService(nil, v1.ServiceTypeNodePort, nil)
+	svc.Spec.Ports = []v1.ServicePort{{Name: "postgresql", Port: 5432, NodePort: nodePort}}
+	return svc
+}
+
+func TestSameServicePorts(t *testing.T) {
+	postgresPort := v1.ServicePort{Name: "postgresql", Port: 5432, TargetPort: intstr.IntOrString{IntVal: 5432}}
+	metricsPort := v1.ServicePort{Name: "metrics", Port: 9187, TargetPort: intstr.IntOrString{IntVal: 9187}}
+	withPorts := func(ports ...v1.ServicePort) *v1.Service {
+		svc := newsService(map[string]string{}, v1.ServiceTypeClusterIP, nil)
+		svc.Spec.Ports = ports
+		return svc
+	}
+	// Kubernetes defaults the protocol of the current ports
+	defaulted := withPorts(postgresPort, metricsPort)
+	for i := range defaulted.Spec.Ports {
+		defaulted.Spec.Ports[i].Protocol = v1.ProtocolTCP
+	}
+	changedPort := metricsPort
+	changedPort.Port = 9100
+	changedPort.TargetPort = intstr.IntOrString{IntVal: 9100}
+
+	tests := []struct {
+		about   string
+		current *v1.Service
+		new     *v1.Service
+		reason  string
+		match   bool
+	}{
+		{
+			about:   "defaulted protocol",
+			current: defaulted,
+			new:     withPorts(postgresPort, metricsPort),
+			match:   true,
+		},
+		{
+			about:   "added metrics port",
+			current: withPorts(postgresPort),
+			new:     withPorts(postgresPort, metricsPort),
+			match:   false,
+			reason:  `new service's number of ports 2 does not match the current one 1`,
+		},
+		{
+			about:   "changed metrics port",
+			current: withPorts(postgresPort, metricsPort),
+			new:     withPorts(postgresPort, changedPort),
+			match:   false,
+			reason:  `new service's port "metrics" does not match the current one`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.about, func(t *testing.T) {
+			match, reason := SameService(tt.current, tt.new)
+			if match != tt.match {
+				t.Errorf("expected match to be %t, got %t (reason: %s)", tt.match, match, reason)
+				return
+			}
+			if !match && reason != tt.reason {
+				t.Errorf("expected reason '%s', found '%s'", tt.reason, reason)
+			}
+		})
+	}
+}
+
+func TestSameServiceSelector(t *testing.T) {
+	withSelector := func(selector map[string]string) *v1.Service {
+		svc := newsService(map[string]string{}, v1.ServiceTypeClusterIP, nil)
+		svc.Spec.Selector = selector
+		return svc
+	}
+	replicaSelector := map[string]string{"cluster-name": "acid-test-cluster", "spilo-role": "replica"}
+
+	tests := []struct {
+		about   string
+		current *v1.Service
+		new     *v1.Service
+		reason  string
+		match   bool
+	}{
+		{
+			about:   "same selector",
+			current: withSelector(replicaSelector),
+			new:     withSelector(replicaSelector),
+			match:   true,
+		},
+		{
+			about:   "both without selector",
+			current: withSelector(nil),
+			new:     withSelector(map[string]string{}),
+			match:   true,
+		},
+		{
+			about:   "selector removed",
+			current: withSelector(replicaSelector),
+			new:     withSelector(nil),
+			match:   false,
+			reason:  `new service's selector does not match the current one`,
+		},
+		{
+			about:   "selector added",
+			current: withSelector(nil),
+			new:     withSelector(replicaSelector),
+			match:   false,
+			reason:  `new service's selector does not match the current one`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.about, func(t *testing.T) {
+			match, reason := SameService(tt.current, tt.new)
+			if match != tt.match {
+				t.Errorf("expected match to be %t, got %t (reason: %s)", tt.match, match, reason)
+				return
+			}
+			if !match && reason != tt.reason {
+				t.Errorf("expected reason '%s', found '%s'", tt.reason, reason)
+			}
+		})
+	}
+}
+
+func TestSameServiceNodePort(t *testing.T) {
+	tests := []struct {
+		about   string
+		current *v1.Service
+		new     *v1.Service
+		reason  string
+		match   bool
+	}{
+		{
+			about:   "allocated node port is kept if none is requested",
+			current: newsServiceWithNodePort(31234),
+			new:     newsServiceWithNodePort(0),
+			match:   true,
+		},
+		{
+			about:   "requested node port is allocated",
+			current: newsServiceWithNodePort(30432),
+			new:     newsServiceWithNodePort(30432),
+			match:   true,
+		},
+		{
+			about:   "requested node port changed",
+			current: newsServiceWithNodePort(31234),
+			new:     newsServiceWithNodePort(30432),
+			match:   false,
+			reason:  `new service's node port 30432 does not match the current one 31234`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.about, func(t *testing.T) {
+			match, reason := SameService(tt.current, tt.new)
+			if match != tt.match {
+				t.Errorf("expected match to be %t, got %t (reason: %s)", tt.match, match, reason)
+				return
+			}
+			if !match && reason != tt.reason {
+				t.Errorf("expected reason '%s', found '%s'", tt.reason, reason)
+			}
+		})
+	}
+}
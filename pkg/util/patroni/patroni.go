@@ -2,13 +2,18 @@ package patroni
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"net"
 	"net/http"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -18,19 +23,87 @@ import (
 const (
 	failoverPath = "/failover"
 	configPath   = "/config"
+	clusterPath  = "/cluster"
+	reloadPath   = "/reload"
+	restartPath  = "/restart"
 	apiPort      = 8008
 	timeout      = 30 * time.Second
+
+	// RestAPICertificateEnvVar is set by the operator on the Spilo container when the REST API is served with TLS
+	RestAPICertificateEnvVar = "SSL_RESTAPI_CERTIFICATE_FILE"
+
+	// DefaultMaximumLagOnFailover is the maximum_lag_on_failover Patroni uses when it is not configured
+	DefaultMaximumLagOnFailover = 1048576
 )
 
 // Interface describe patroni methods
 type Interface interface {
-	Switchover(master *v1.Pod, candidate string) error
-	SetPostgresParameters(server *v1.Pod, options map[string]string) error
-	GetPatroniMemberState(pod *v1.Pod) (string, error)
+	Switchover(ctx context.Context, master *v1.Pod, candidate string) error
+	SetPostgresParameters(ctx context.Context, server *v1.Pod, options map[string]string) error
+	GetPostgresParameters(ctx context.Context, server *v1.Pod) (map[string]string, error)
+	GetPatroniMemberState(ctx context.Context, pod *v1.Pod) (string, error)
+	GetClusterMembers(ctx context.Context, server *v1.Pod) ([]ClusterMember, error)
+	Reload(ctx context.Context, server *v1.Pod) error
+	IsStandbyCluster(ctx context.Context, server *v1.Pod) (bool, error)
+	PromoteStandbyCluster(ctx context.Context, server *v1.Pod) error
+	ScheduleRestart(ctx context.Context, server *v1.Pod, at time.Time) error
+	GetSynchronousMode(ctx context.Context, server *v1.Pod) (SynchronousMode, error)
+	SetSynchronousMode(ctx context.Context, server *v1.Pod, mode SynchronousMode) error
+	GetMaximumLagOnFailover(ctx context.Context, server *v1.Pod) (int64, error)
+	SetMaximumLagOnFailover(ctx context.Context, server *v1.Pod, maxLag int64) error
+	GetPgIdent(ctx context.Context, server *v1.Pod) ([]string, error)
+	SetPgIdent(ctx context.Context, server *v1.Pod, lines []string) error
+	GetSlots(ctx context.Context, server *v1.Pod) (map[string]map[string]string, error)
+	SetSlots(ctx context.Context, server *v1.Pod, slots map[string]map[string]string) error
+	ConfigureTLS(config *tls.Config)
+}
+
+// SynchronousMode holds the synchronous replication settings of the dynamic configuration
+type SynchronousMode struct {
+	Enabled   bool `json:"synchronous_mode"`
+	Strict    bool `json:"synchronous_mode_strict"`
+	NodeCount int  `json:"synchronous_node_count"`
+}
+
+// ClusterMember represents a member of the Patroni cluster as returned by the /cluster endpoint
+type ClusterMember struct {
+	Name     string         `json:"name"`
+	Role     string         `json:"role"`
+	State    string         `json:"state"`
+	Timeline int            `json:"timeline"`
+	Lag      ReplicationLag `json:"lag"`
+}
+
+// ReplicationLag is the replication lag of a cluster member in bytes
+type ReplicationLag uint64
+
+// UnmarshalJSON converts the lag reported by Patroni, an "unknown" lag is treated as infinite
+func (rl *ReplicationLag) UnmarshalJSON(data []byte) error {
+	var lag interface{}
+	if err := json.Unmarshal(data, &lag); err != nil {
+		return err
+	}
+
+	switch v := lag.(type) {
+	case float64:
+		*rl = ReplicationLag(v)
+	case string:
+		if v != "unknown" {
+			return fmt.Errorf("unexpected replication lag %q", v)
+		}
+		*rl = ReplicationLag(math.MaxUint64)
+	case nil:
+		*rl = 0
+	default:
+		return fmt.Errorf("unexpected replication lag type %T", v)
+	}
+
+	return nil
 }
 
 // Patroni API client
 type Patroni struct {
+	mu         sync.RWMutex
 	httpClient *http.Client
 	logger     *logrus.Entry
 }
@@ -47,6 +120,83 @@ func New(logger *logrus.Entry) *Patroni {
 	}
 }
 
+// NewTLSConfig returns the TLS configuration to connect to a REST API served with the given certificate. The server
+// certificate is verified against the CA, or pinned when there is none, e.g. for a self-signed certificate. Members
+// are addressed by their pod IP, which certificates rarely contain, so only the chain is verified and not the host.
+// The certificate is presented as client certificate as well, in case Patroni is configured to verify clients.
+func NewTLSConfig(caCert, cert, key []byte) (*tls.Config, error) {
+	keyPair, err := tls.X509KeyPair(cert, key)
+	if err != nil {
+		return nil, fmt.Errorf("could not load certificate: %v", err)
+	}
+	if len(caCert) == 0 {
+		caCert = cert
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caCert) {
+		return nil, fmt.Errorf("could not parse CA certificate")
+	}
+
+	return &tls.Config{
+		Certificates:       []tls.Certificate{keyPair},
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return fmt.Errorf("no server certificate presented")
+			}
+			certs := make([]*x509.Certificate, 0, len(rawCerts))
+			for _, rawCert := range rawCerts {
+				parsed, err := x509.ParseCertificate(rawCert)
+				if err != nil {
+					return fmt.Errorf("could not parse server certificate: %v", err)
+				}
+				certs = append(certs, parsed)
+			}
+			intermediates := x509.NewCertPool()
+			for _, intermediate := range certs[1:] {
+				intermediates.AddCert(intermediate)
+			}
+			_, err := certs[0].Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+			return err
+		},
+		MinVersion: tls.VersionTLS12,
+	}, nil
+}
+
+// ConfigureTLS replaces the TLS configuration used for members serving the REST API with TLS, this takes effect
+// with the next request, so that a renewed certificate does not require a restart of the operator
+func (p *Patroni) ConfigureTLS(config *tls.Config) {
+	cl := &http.Client{
+		Timeout: timeout,
+	}
+	if config != nil {
+		cl.Transport = &http.Transport{TLSClientConfig: config}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.httpClient = cl
+}
+
+func (p *Patroni) client() *http.Client {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.httpClient
+}
+
+// usesTLS tells whether the Spilo container of the pod serves the REST API with TLS, pods not yet rolled out with
+// the certificate keep being reached via plain HTTP
+func usesTLS(pod *v1.Pod) bool {
+	for _, container := range pod.Spec.Containers {
+		for _, env := range container.Env {
+			if env.Name == RestAPICertificateEnvVar && env.Value != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func apiURL(masterPod *v1.Pod) (string, error) {
 	ip := net.ParseIP(masterPod.Status.PodIP)
 	if ip == nil {
@@ -59,18 +209,22 @@ func apiURL(masterPod *v1.Pod) (string, error) {
 			return "", fmt.Errorf("%s is not a valid IPv4/IPv6 address", masterPod.Status.PodIP)
 		}
 	}
-	return fmt.Sprintf("http://%s", net.JoinHostPort(ip.String(), strconv.Itoa(apiPort))), nil
+	scheme := "http"
+	if usesTLS(masterPod) {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(ip.String(), strconv.Itoa(apiPort))), nil
 }
 
-func (p *Patroni) httpPostOrPatch(method string, url string, body *bytes.Buffer) (err error) {
-	request, err := http.NewRequest(method, url, body)
+func (p *Patroni) httpPostOrPatch(ctx context.Context, method string, url string, body *bytes.Buffer) (err error) {
+	request, err := http.NewRequestWithContext(ctx, method, url, body)
 	if err != nil {
 		return fmt.Errorf("could not create request: %v", err)
 	}
 
 	p.logger.Debugf("making %s http request: %s", method, request.URL.String())
 
-	resp, err := p.httpClient.Do(request)
+	resp, err := p.client().Do(request)
 	if err != nil {
 		return fmt.Errorf("could not make request: %v", err)
 	}
@@ -85,7 +239,8 @@ func (p *Patroni) httpPostOrPatch(method string, url string, body *bytes.Buffer)
 		}
 	}()
 
-	if resp.StatusCode != http.StatusOK {
+	// scheduled actions are acknowledged with 202 Accepted
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
 		bodyBytes, err := ioutil.ReadAll(resp.Body)
 		if err != nil {
 			return fmt.Errorf("could not read response: %v", err)
@@ -97,7 +252,7 @@ func (p *Patroni) httpPostOrPatch(method string, url string, body *bytes.Buffer)
 }
 
 // Switchover by calling Patroni REST API
-func (p *Patroni) Switchover(master *v1.Pod, candidate string) error {
+func (p *Patroni) Switchover(ctx context.Context, master *v1.Pod, candidate string) error {
 	buf := &bytes.Buffer{}
 	err := json.NewEncoder(buf).Encode(map[string]string{"leader": master.Name, "member": candidate})
 	if err != nil {
@@ -107,13 +262,13 @@ func (p *Patroni) Switchover(master *v1.Pod, candidate string) error {
 	if err != nil {
 		return err
 	}
-	return p.httpPostOrPatch(http.MethodPost, apiURLString+failoverPath, buf)
+	return p.httpPostOrPatch(ctx, http.MethodPost, apiURLString+failoverPath, buf)
 }
 
 //TODO: add an option call /patroni to check if it is necessary to restart the server
 
 //SetPostgresParameters sets Postgres options via Patroni patch API call.
-func (p *Patroni) SetPostgresParameters(server *v1.Pod, parameters map[string]string) error {
+func (p *Patroni) SetPostgresParameters(ctx context.Context, server *v1.Pod, parameters map[string]string) error {
 	buf := &bytes.Buffer{}
 	err := json.NewEncoder(buf).Encode(map[string]map[string]interface{}{"postgresql": {"parameters": parameters}})
 	if err != nil {
@@ -123,25 +278,309 @@ func (p *Patroni) SetPostgresParameters(server *v1.Pod, parameters map[string]st
 	if err != nil {
 		return err
 	}
-	return p.httpPostOrPatch(http.MethodPatch, apiURLString+configPath, buf)
+	return p.httpPostOrPatch(ctx, http.MethodPatch, apiURLString+configPath, buf)
 }
 
-//GetPatroniMemberState returns a state of member of a Patroni cluster
-func (p *Patroni) GetPatroniMemberState(server *v1.Pod) (string, error) {
-
+// getConfig returns the raw dynamic configuration of the Patroni cluster
+func (p *Patroni) getConfig(ctx context.Context, server *v1.Pod) ([]byte, error) {
 	apiURLString, err := apiURL(server)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	return p.httpGet(ctx, apiURLString+configPath)
+}
+
+// httpGet returns the body of a GET request, the request is cancelled together with the context
+func (p *Patroni) httpGet(ctx context.Context, url string) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not create request: %v", err)
 	}
-	response, err := p.httpClient.Get(apiURLString)
+	response, err := p.client().Do(request)
 	if err != nil {
-		return "", fmt.Errorf("could not perform Get request: %v", err)
+		return nil, fmt.Errorf("could not perform Get request: %v", err)
 	}
 	defer response.Body.Close()
 
 	body, err := ioutil.ReadAll(response.Body)
 	if err != nil {
-		return "", fmt.Errorf("could not read response: %v", err)
+		return nil, fmt.Errorf("could not read response: %v", err)
+	}
+
+	return body, nil
+}
+
+//GetPostgresParameters returns the Postgres options of the dynamic configuration via Patroni API call.
+func (p *Patroni) GetPostgresParameters(ctx context.Context, server *v1.Pod) (map[string]string, error) {
+	body, err := p.getConfig(ctx, server)
+	if err != nil {
+		return nil, err
+	}
+
+	return parsePostgresParameters(body)
+}
+
+//IsStandbyCluster reports whether the dynamic configuration still contains the standby_cluster section
+func (p *Patroni) IsStandbyCluster(ctx context.Context, server *v1.Pod) (bool, error) {
+	body, err := p.getConfig(ctx, server)
+	if err != nil {
+		return false, err
+	}
+
+	return parseStandbyCluster(body)
+}
+
+// parseStandbyCluster checks the dynamic configuration for a standby_cluster section, Patroni drops the
+// section entirely once it is set to null, but an explicit null is treated as absent as well
+func parseStandbyCluster(body []byte) (bool, error) {
+	data := struct {
+		StandbyCluster map[string]interface{} `json:"standby_cluster"`
+	}{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return false, fmt.Errorf("could not unmarshal Patroni configuration: %v", err)
+	}
+
+	return data.StandbyCluster != nil, nil
+}
+
+//PromoteStandbyCluster removes the standby_cluster section from the dynamic configuration, which makes the
+//standby leader promote itself to a primary
+func (p *Patroni) PromoteStandbyCluster(ctx context.Context, server *v1.Pod) error {
+	buf := &bytes.Buffer{}
+	err := json.NewEncoder(buf).Encode(map[string]interface{}{"standby_cluster": nil})
+	if err != nil {
+		return fmt.Errorf("could not encode json: %v", err)
+	}
+	apiURLString, err := apiURL(server)
+	if err != nil {
+		return err
+	}
+	return p.httpPostOrPatch(ctx, http.MethodPatch, apiURLString+configPath, buf)
+}
+
+//GetSynchronousMode returns the synchronous replication settings of the dynamic configuration
+func (p *Patroni) GetSynchronousMode(ctx context.Context, server *v1.Pod) (SynchronousMode, error) {
+	body, err := p.getConfig(ctx, server)
+	if err != nil {
+		return SynchronousMode{}, err
+	}
+
+	return parseSynchronousMode(body)
+}
+
+//SetSynchronousMode sets the synchronous replication settings via Patroni patch API call, Patroni applies
+//them on its next loop without a restart
+func (p *Patroni) SetSynchronousMode(ctx context.Context, server *v1.Pod, mode SynchronousMode) error {
+	buf := &bytes.Buffer{}
+	err := json.NewEncoder(buf).Encode(mode)
+	if err != nil {
+		return fmt.Errorf("could not encode json: %v", err)
+	}
+	apiURLString, err := apiURL(server)
+	if err != nil {
+		return err
+	}
+	return p.httpPostOrPatch(ctx, http.MethodPatch, apiURLString+configPath, buf)
+}
+
+// parseSynchronousMode extracts the synchronous replication settings from the dynamic configuration,
+// Patroni uses one synchronous standby when the number is absent
+func parseSynchronousMode(body []byte) (SynchronousMode, error) {
+	mode := SynchronousMode{NodeCount: 1}
+	if err := json.Unmarshal(body, &mode); err != nil {
+		return SynchronousMode{}, fmt.Errorf("could not unmarshal Patroni configuration: %v", err)
+	}
+
+	return mode, nil
+}
+
+//GetMaximumLagOnFailover returns the maximum_lag_on_failover of the dynamic configuration
+func (p *Patroni) GetMaximumLagOnFailover(ctx context.Context, server *v1.Pod) (int64, error) {
+	body, err := p.getConfig(ctx, server)
+	if err != nil {
+		return 0, err
+	}
+
+	return parseMaximumLagOnFailover(body)
+}
+
+//SetMaximumLagOnFailover sets maximum_lag_on_failover via Patroni patch API call, Patroni applies it on its next
+//loop without a restart
+func (p *Patroni) SetMaximumLagOnFailover(ctx context.Context, server *v1.Pod, maxLag int64) error {
+	buf := &bytes.Buffer{}
+	err := json.NewEncoder(buf).Encode(map[string]int64{"maximum_lag_on_failover": maxLag})
+	if err != nil {
+		return fmt.Errorf("could not encode json: %v", err)
+	}
+	apiURLString, err := apiURL(server)
+	if err != nil {
+		return err
+	}
+	return p.httpPostOrPatch(ctx, http.MethodPatch, apiURLString+configPath, buf)
+}
+
+// parseMaximumLagOnFailover extracts maximum_lag_on_failover from the dynamic configuration, Patroni uses its
+// default when the value is absent
+func parseMaximumLagOnFailover(body []byte) (int64, error) {
+	var config struct {
+		MaximumLagOnFailover *float64 `json:"maximum_lag_on_failover"`
+	}
+	if err := json.Unmarshal(body, &config); err != nil {
+		return 0, fmt.Errorf("could not unmarshal Patroni configuration: %v", err)
+	}
+	if config.MaximumLagOnFailover == nil {
+		return DefaultMaximumLagOnFailover, nil
+	}
+
+	return int64(*config.MaximumLagOnFailover), nil
+}
+
+//GetPgIdent returns the pg_ident lines of the dynamic configuration, nil if Patroni does not manage pg_ident.conf
+func (p *Patroni) GetPgIdent(ctx context.Context, server *v1.Pod) ([]string, error) {
+	body, err := p.getConfig(ctx, server)
+	if err != nil {
+		return nil, err
+	}
+
+	return parsePgIdent(body)
+}
+
+//SetPgIdent replaces the pg_ident lines of the dynamic configuration via Patroni patch API call, Patroni rewrites
+//pg_ident.conf of every member in the given order on its next loop
+func (p *Patroni) SetPgIdent(ctx context.Context, server *v1.Pod, lines []string) error {
+	buf := &bytes.Buffer{}
+	err := json.NewEncoder(buf).Encode(map[string]map[string]interface{}{"postgresql": {"pg_ident": lines}})
+	if err != nil {
+		return fmt.Errorf("could not encode json: %v", err)
+	}
+	apiURLString, err := apiURL(server)
+	if err != nil {
+		return err
+	}
+	return p.httpPostOrPatch(ctx, http.MethodPatch, apiURLString+configPath, buf)
+}
+
+// parsePgIdent extracts the pg_ident lines from the dynamic configuration
+func parsePgIdent(body []byte) ([]string, error) {
+	data := struct {
+		Postgresql struct {
+			PgIdent []string `json:"pg_ident"`
+		} `json:"postgresql"`
+	}{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, fmt.Errorf("could not unmarshal Patroni configuration: %v", err)
+	}
+
+	return data.Postgresql.PgIdent, nil
+}
+
+//GetSlots returns the permanent replication slots of the dynamic configuration
+func (p *Patroni) GetSlots(ctx context.Context, server *v1.Pod) (map[string]map[string]string, error) {
+	body, err := p.getConfig(ctx, server)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseSlots(body)
+}
+
+//SetSlots adds or changes the given permanent replication slots of the dynamic configuration via Patroni patch
+//API call, a slot without attributes is removed. Patroni creates and drops the slots on the primary on its next loop.
+func (p *Patroni) SetSlots(ctx context.Context, server *v1.Pod, slots map[string]map[string]string) error {
+	buf := &bytes.Buffer{}
+	err := json.NewEncoder(buf).Encode(map[string]map[string]map[string]string{"slots": slots})
+	if err != nil {
+		return fmt.Errorf("could not encode json: %v", err)
+	}
+	apiURLString, err := apiURL(server)
+	if err != nil {
+		return err
+	}
+	return p.httpPostOrPatch(ctx, http.MethodPatch, apiURLString+configPath, buf)
+}
+
+// parseSlots extracts the permanent replication slots from the dynamic configuration, the attributes are converted
+// to their literal string form like the Postgres options
+func parseSlots(body []byte) (map[string]map[string]string, error) {
+	data := struct {
+		Slots map[string]map[string]interface{} `json:"slots"`
+	}{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&data); err != nil {
+		return nil, fmt.Errorf("could not unmarshal Patroni configuration: %v", err)
+	}
+
+	slots := make(map[string]map[string]string, len(data.Slots))
+	for name, attributes := range data.Slots {
+		slots[name] = make(map[string]string, len(attributes))
+		for key, value := range attributes {
+			slots[name][key] = fmt.Sprintf("%v", value)
+		}
+	}
+
+	return slots, nil
+}
+
+// parsePostgresParameters extracts the Postgres options from the dynamic configuration, Patroni keeps the
+// values as given, so numbers are converted to their literal string form
+func parsePostgresParameters(body []byte) (map[string]string, error) {
+	data := struct {
+		Postgresql struct {
+			Parameters map[string]interface{} `json:"parameters"`
+		} `json:"postgresql"`
+	}{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&data); err != nil {
+		return nil, fmt.Errorf("could not unmarshal Patroni configuration: %v", err)
+	}
+
+	parameters := make(map[string]string, len(data.Postgresql.Parameters))
+	for name, value := range data.Postgresql.Parameters {
+		parameters[name] = fmt.Sprintf("%v", value)
+	}
+
+	return parameters, nil
+}
+
+// Reload makes Patroni reload its configuration and Postgres, which also picks up renewed TLS certificates
+func (p *Patroni) Reload(ctx context.Context, server *v1.Pod) error {
+	apiURLString, err := apiURL(server)
+	if err != nil {
+		return err
+	}
+	return p.httpPostOrPatch(ctx, http.MethodPost, apiURLString+reloadPath, &bytes.Buffer{})
+}
+
+// ScheduleRestart schedules a restart of the member, which Patroni only performs if a changed option still
+// requires one at that time
+func (p *Patroni) ScheduleRestart(ctx context.Context, server *v1.Pod, at time.Time) error {
+	buf := &bytes.Buffer{}
+	err := json.NewEncoder(buf).Encode(map[string]interface{}{
+		"schedule":        at.Format(time.RFC3339),
+		"restart_pending": true,
+	})
+	if err != nil {
+		return fmt.Errorf("could not encode json: %v", err)
+	}
+	apiURLString, err := apiURL(server)
+	if err != nil {
+		return err
+	}
+	return p.httpPostOrPatch(ctx, http.MethodPost, apiURLString+restartPath, buf)
+}
+
+//GetPatroniMemberState returns a state of member of a Patroni cluster
+func (p *Patroni) GetPatroniMemberState(ctx context.Context, server *v1.Pod) (string, error) {
+
+	apiURLString, err := apiURL(server)
+	if err != nil {
+		return "", err
+	}
+	body, err := p.httpGet(ctx, apiURLString)
+	if err != nil {
+		return "", err
 	}
 
 	data := make(map[string]interface{})
@@ -158,3 +597,25 @@ func (p *Patroni) GetPatroniMemberState(server *v1.Pod) (string, error) {
 	return state, nil
 
 }
+
+//GetClusterMembers returns the members of a Patroni cluster as seen by the given member
+func (p *Patroni) GetClusterMembers(ctx context.Context, server *v1.Pod) ([]ClusterMember, error) {
+
+	apiURLString, err := apiURL(server)
+	if err != nil {
+		return nil, err
+	}
+	body, err := p.httpGet(ctx, apiURLString+clusterPath)
+	if err != nil {
+		return nil, err
+	}
+
+	data := struct {
+		Members []ClusterMember `json:"members"`
+	}{}
+	if err = json.Unmarshal(body, &data); err != nil {
+		return nil, fmt.Errorf("could not unmarshal cluster members: %v", err)
+	}
+
+	return data.Members, nil
+}
@@ -1,10 +1,28 @@
 package patroni
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"fmt"
-	"k8s.io/api/core/v1"
+	"math"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
 )
 
 func newMockPod(ip string) *v1.Pod {
@@ -57,6 +75,14 @@ func TestApiURL(t *testing.T) {
 			errors.New("::: is not a valid IP"),
 		},
 	}
+	tlsPod := newMockPod("127.0.0.1")
+	tlsPod.Spec.Containers = []v1.Container{
+		{Env: []v1.EnvVar{{Name: RestAPICertificateEnvVar, Value: "/tls-patroni-api/tls.crt"}}},
+	}
+	if resp, err := apiURL(tlsPod); err != nil || resp != fmt.Sprintf("https://127.0.0.1:%d", apiPort) {
+		t.Errorf("expected an https URL for a pod serving the REST API with TLS, got %q (error: %v)", resp, err)
+	}
+
 	for _, test := range testTable {
 		resp, err := apiURL(newMockPod(test.podIP))
 		if resp != test.expectedResponse {
@@ -72,3 +98,291 @@ func TestApiURL(t *testing.T) {
 		}
 	}
 }
+
+func TestClusterMembersUnmarshal(t *testing.T) {
+	body := `{"members": [
+		{"name": "acid-test-0", "role": "leader", "state": "running", "host": "10.0.0.1", "port": 5432, "timeline": 2},
+		{"name": "acid-test-1", "role": "replica", "state": "running", "host": "10.0.0.2", "port": 5432, "timeline": 2, "lag": 0},
+		{"name": "acid-test-2", "role": "replica", "state": "starting", "host": "10.0.0.3", "port": 5432, "lag": "unknown"},
+		{"name": "acid-test-3", "role": "sync_standby", "state": "running", "host": "10.0.0.4", "port": 5432, "timeline": 2, "lag": 16777216}
+	]}`
+	expected := []ClusterMember{
+		{Name: "acid-test-0", Role: "leader", State: "running", Timeline: 2, Lag: 0},
+		{Name: "acid-test-1", Role: "replica", State: "running", Timeline: 2, Lag: 0},
+		{Name: "acid-test-2", Role: "replica", State: "starting", Timeline: 0, Lag: math.MaxUint64},
+		{Name: "acid-test-3", Role: "sync_standby", State: "running", Timeline: 2, Lag: 16777216},
+	}
+
+	data := struct {
+		Members []ClusterMember `json:"members"`
+	}{}
+	if err := json.Unmarshal([]byte(body), &data); err != nil {
+		t.Fatalf("could not unmarshal cluster members: %v", err)
+	}
+	if !reflect.DeepEqual(data.Members, expected) {
+		t.Errorf("expected cluster members %#v, got %#v", expected, data.Members)
+	}
+
+	var lag ReplicationLag
+	if err := json.Unmarshal([]byte(`"foobar"`), &lag); err == nil {
+		t.Errorf("expected an error for an invalid replication lag")
+	}
+}
+
+func TestParsePostgresParameters(t *testing.T) {
+	body := `{"loop_wait": 10, "postgresql": {"parameters": {"max_connections": 100, "max_wal_size": 1000000, "wal_level": "logical", "track_commit_timestamp": "off"}}}`
+	expected := map[string]string{"max_connections": "100", "max_wal_size": "1000000", "wal_level": "logical", "track_commit_timestamp": "off"}
+
+	parameters, err := parsePostgresParameters([]byte(body))
+	if err != nil {
+		t.Fatalf("could not parse Postgres parameters: %v", err)
+	}
+	if !reflect.DeepEqual(parameters, expected) {
+		t.Errorf("expected Postgres parameters %#v, got %#v", expected, parameters)
+	}
+
+	if _, err := parsePostgresParameters([]byte(`{"postgresql": []}`)); err == nil {
+		t.Errorf("expected an error for an invalid configuration")
+	}
+}
+
+func TestParsePgIdent(t *testing.T) {
+	tests := []struct {
+		body  string
+		lines []string
+	}{
+		{`{"loop_wait": 10, "postgresql": {"pg_ident": ["krb /^(.*)@EXAMPLE\\.COM$ \\1", "cert app app_user"]}}`,
+			[]string{`krb /^(.*)@EXAMPLE\.COM$ \1`, "cert app app_user"}},
+		{`{"loop_wait": 10, "postgresql": {"parameters": {"max_connections": 100}}}`, nil},
+		{`{"loop_wait": 10}`, nil},
+	}
+
+	for _, tt := range tests {
+		lines, err := parsePgIdent([]byte(tt.body))
+		if err != nil {
+			t.Fatalf("could not parse Patroni configuration %s: %v", tt.body, err)
+		}
+		if !reflect.DeepEqual(lines, tt.lines) {
+			t.Errorf("expected pg_ident %#v for configuration %s, got %#v", tt.lines, tt.body, lines)
+		}
+	}
+
+	if _, err := parsePgIdent([]byte(`{"postgresql": {"pg_ident": "cert app app_user"}}`)); err == nil {
+		t.Errorf("expected an error for an invalid configuration")
+	}
+}
+
+func TestParseSlots(t *testing.T) {
+	tests := []struct {
+		body  string
+		slots map[string]map[string]string
+	}{
+		{`{"loop_wait": 10, "slots": {"cdc": {"type": "logical", "database": "foo", "plugin": "pgoutput"}, "standby": {"type": "physical"}}}`,
+			map[string]map[string]string{
+				"cdc":     {"type": "logical", "database": "foo", "plugin": "pgoutput"},
+				"standby": {"type": "physical"},
+			}},
+		{`{"loop_wait": 10, "slots": {"cdc": {"type": "logical", "failover": true}}}`,
+			map[string]map[string]string{"cdc": {"type": "logical", "failover": "true"}}},
+		{`{"loop_wait": 10}`, map[string]map[string]string{}},
+	}
+
+	for _, tt := range tests {
+		slots, err := parseSlots([]byte(tt.body))
+		if err != nil {
+			t.Fatalf("could not parse Patroni configuration %s: %v", tt.body, err)
+		}
+		if !reflect.DeepEqual(slots, tt.slots) {
+			t.Errorf("expected slots %#v for configuration %s, got %#v", tt.slots, tt.body, slots)
+		}
+	}
+
+	if _, err := parseSlots([]byte(`{"slots": ["cdc"]}`)); err == nil {
+		t.Errorf("expected an error for an invalid configuration")
+	}
+}
+
+func TestParseStandbyCluster(t *testing.T) {
+	tests := []struct {
+		body    string
+		standby bool
+	}{
+		{`{"loop_wait": 10, "standby_cluster": {"create_replica_methods": ["bootstrap_standby_with_wale", "basebackup_fast_xlog"]}}`, true},
+		{`{"loop_wait": 10, "standby_cluster": null}`, false},
+		{`{"loop_wait": 10}`, false},
+	}
+
+	for _, tt := range tests {
+		standby, err := parseStandbyCluster([]byte(tt.body))
+		if err != nil {
+			t.Fatalf("could not parse Patroni configuration %s: %v", tt.body, err)
+		}
+		if standby != tt.standby {
+			t.Errorf("expected standby %t for configuration %s, got %t", tt.standby, tt.body, standby)
+		}
+	}
+
+	if _, err := parseStandbyCluster([]byte(`{"standby_cluster": []}`)); err == nil {
+		t.Errorf("expected an error for an invalid configuration")
+	}
+}
+
+func TestParseSynchronousMode(t *testing.T) {
+	tests := []struct {
+		body string
+		mode SynchronousMode
+	}{
+		{`{"loop_wait": 10, "synchronous_mode": true, "synchronous_mode_strict": true, "synchronous_node_count": 2}`,
+			SynchronousMode{Enabled: true, Strict: true, NodeCount: 2}},
+		{`{"loop_wait": 10, "synchronous_mode": true}`, SynchronousMode{Enabled: true, NodeCount: 1}},
+		{`{"loop_wait": 10}`, SynchronousMode{NodeCount: 1}},
+	}
+
+	for _, tt := range tests {
+		mode, err := parseSynchronousMode([]byte(tt.body))
+		if err != nil {
+			t.Fatalf("could not parse Patroni configuration %s: %v", tt.body, err)
+		}
+		if mode != tt.mode {
+			t.Errorf("expected synchronous mode %#v for configuration %s, got %#v", tt.mode, tt.body, mode)
+		}
+	}
+
+	if _, err := parseSynchronousMode([]byte(`{"synchronous_node_count": "two"}`)); err == nil {
+		t.Errorf("expected an error for an invalid configuration")
+	}
+}
+
+func TestParseMaximumLagOnFailover(t *testing.T) {
+	tests := []struct {
+		body   string
+		maxLag int64
+	}{
+		{`{"loop_wait": 10, "maximum_lag_on_failover": 33554432}`, 33554432},
+		{`{"maximum_lag_on_failover": 0}`, 0},
+		{`{"loop_wait": 10}`, DefaultMaximumLagOnFailover},
+	}
+
+	for _, tt := range tests {
+		maxLag, err := parseMaximumLagOnFailover([]byte(tt.body))
+		if err != nil {
+			t.Fatalf("could not parse Patroni configuration %s: %v", tt.body, err)
+		}
+		if maxLag != tt.maxLag {
+			t.Errorf("expected maximum_lag_on_failover %d for configuration %s, got %d", tt.maxLag, tt.body, maxLag)
+		}
+	}
+
+	if _, err := parseMaximumLagOnFailover([]byte(`{"maximum_lag_on_failover": "1MB"}`)); err == nil {
+		t.Errorf("expected an error for an invalid configuration")
+	}
+}
+
+// hangingTransport never answers a request, it only returns once the request context is done
+type hangingTransport struct{}
+
+func (hangingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	<-request.Context().Done()
+	return nil, request.Context().Err()
+}
+
+func TestCancelledRequest(t *testing.T) {
+	p := &Patroni{httpClient: &http.Client{Transport: hangingTransport{}}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := p.GetClusterMembers(ctx, newMockPod("192.168.100.1")); err == nil ||
+		!strings.Contains(err.Error(), context.DeadlineExceeded.Error()) {
+		t.Errorf("expected the request to be cancelled with a deadline exceeded error, got %v", err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	if _, err := p.GetSynchronousMode(ctx, newMockPod("192.168.100.1")); err == nil ||
+		!strings.Contains(err.Error(), context.Canceled.Error()) {
+		t.Errorf("expected the request to be cancelled, got %v", err)
+	}
+}
+
+// selfSignedCertificate returns the PEM encoded certificate and private key of a self-signed server certificate
+func selfSignedCertificate(t *testing.T) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "acid-test-cluster-0"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("could not create certificate: %v", err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("could not marshal key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+func TestConfigureTLS(t *testing.T) {
+	cert, key := selfSignedCertificate(t)
+	otherCert, otherKey := selfSignedCertificate(t)
+
+	serverCert, err := tls.X509KeyPair(cert, key)
+	if err != nil {
+		t.Fatalf("could not load server certificate: %v", err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"synchronous_mode": true}`))
+	}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{serverCert}}
+	server.StartTLS()
+	defer server.Close()
+
+	p := New(logrus.NewEntry(logrus.New()))
+
+	// the server certificate is issued for a pod name, it is verified without the host
+	tlsConfig, err := NewTLSConfig(nil, cert, key)
+	if err != nil {
+		t.Fatalf("could not create TLS configuration: %v", err)
+	}
+	p.ConfigureTLS(tlsConfig)
+	if _, err := p.httpGet(context.Background(), server.URL+configPath); err != nil {
+		t.Errorf("expected the pinned certificate to be accepted, got %v", err)
+	}
+
+	// a certificate signed by another CA is rejected
+	tlsConfig, err = NewTLSConfig(otherCert, otherCert, otherKey)
+	if err != nil {
+		t.Fatalf("could not create TLS configuration: %v", err)
+	}
+	p.ConfigureTLS(tlsConfig)
+	if _, err := p.httpGet(context.Background(), server.URL+configPath); err == nil {
+		t.Errorf("expected a certificate of an untrusted CA to be rejected")
+	}
+
+	// during a renewal both CAs are trusted
+	tlsConfig, err = NewTLSConfig(append(append([]byte{}, otherCert...), cert...), otherCert, otherKey)
+	if err != nil {
+		t.Fatalf("could not create TLS configuration: %v", err)
+	}
+	p.ConfigureTLS(tlsConfig)
+	if _, err := p.httpGet(context.Background(), server.URL+configPath); err != nil {
+		t.Errorf("expected the previous CA to be accepted during a renewal, got %v", err)
+	}
+
+	if _, err := NewTLSConfig(nil, []byte("cert"), []byte("key")); err == nil {
+		t.Errorf("expected an error for an invalid certificate")
+	}
+}
@@ -2,6 +2,7 @@ package retryutil
 
 import (
 	"fmt"
+	"math/rand"
 	"time"
 )
 
@@ -61,3 +62,60 @@ func RetryWorker(
 	}
 	return fmt.Errorf("still failing after %d retries", maxRetries)
 }
+
+// Backoff defines the intervals between retries, growing exponentially from
+// Interval up to MaxInterval with a random jitter of up to JitterPercent added
+type Backoff struct {
+	Interval      time.Duration
+	MaxInterval   time.Duration
+	Timeout       time.Duration
+	JitterPercent int32
+}
+
+// RetryWithBackoff is a wrapper around RetryBackoffWorker that sleeps between the retries
+func RetryWithBackoff(backoff Backoff, f func() (bool, error)) error {
+	if backoff.Interval <= 0 {
+		return fmt.Errorf("interval(%v) should be greater than zero", backoff.Interval)
+	}
+	if backoff.Timeout < backoff.Interval {
+		return fmt.Errorf("timeout(%s) should be greater than interval(%v)", backoff.Timeout, backoff.Interval)
+	}
+	return RetryBackoffWorker(backoff, time.Sleep, f)
+}
+
+// RetryBackoffWorker calls ConditionFunc until either:
+// * it returns boolean true
+// * the sum of the waits between the calls reaches the timeout
+// * an error occurs
+func RetryBackoffWorker(backoff Backoff, sleep func(time.Duration), f func() (bool, error)) error {
+	var waited time.Duration
+	interval := backoff.Interval
+
+	for i := 1; ; i++ {
+		ok, err := f()
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		if waited >= backoff.Timeout {
+			return fmt.Errorf("still failing after %d retries within %v", i, backoff.Timeout)
+		}
+
+		wait := interval
+		if backoff.JitterPercent > 0 {
+			wait += time.Duration(rand.Int63n(int64(interval)*int64(backoff.JitterPercent)/100 + 1))
+		}
+		if waited+wait > backoff.Timeout {
+			wait = backoff.Timeout - waited
+		}
+		sleep(wait)
+		waited += wait
+
+		interval *= 2
+		if backoff.MaxInterval > 0 && interval > backoff.MaxInterval {
+			interval = backoff.MaxInterval
+		}
+	}
+}
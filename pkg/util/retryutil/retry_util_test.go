@@ -3,6 +3,7 @@ package retryutil
 import (
 	"errors"
 	"testing"
+	"time"
 )
 
 type mockTicker struct {
@@ -61,3 +62,59 @@ func TestRetryWorkerError(t *testing.T) {
 		t.Errorf("Wrong result, expected: %#v, got: %#v", fail, result)
 	}
 }
+
+func TestRetryBackoffWorkerIntervals(t *testing.T) {
+	var waits []time.Duration
+	backoff := Backoff{Interval: time.Second, MaxInterval: 4 * time.Second, Timeout: 10 * time.Second}
+
+	result := RetryBackoffWorker(backoff, func(d time.Duration) { waits = append(waits, d) }, func() (bool, error) {
+		return false, nil
+	})
+
+	if result == nil {
+		t.Errorf("Expected an error after the timeout, got nil")
+	}
+
+	// the intervals double up to the max interval, the last one is cut at the timeout
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 3 * time.Second}
+	if len(waits) != len(expected) {
+		t.Fatalf("Expected waits %v, got %v", expected, waits)
+	}
+	for i := range expected {
+		if waits[i] != expected[i] {
+			t.Errorf("Expected waits %v, got %v", expected, waits)
+			break
+		}
+	}
+}
+
+func TestRetryBackoffWorkerJitter(t *testing.T) {
+	var counter = 0
+	backoff := Backoff{Interval: time.Second, MaxInterval: time.Second, Timeout: time.Minute, JitterPercent: 50}
+
+	result := RetryBackoffWorker(backoff, func(d time.Duration) {
+		if d < time.Second || d > 1500*time.Millisecond {
+			t.Errorf("Expected a wait between 1s and 1.5s, got %v", d)
+		}
+	}, func() (bool, error) {
+		counter++
+		return counter > 10, nil
+	})
+
+	if result != nil {
+		t.Errorf("Wrong result, expected: %#v, got: %#v", nil, result)
+	}
+}
+
+func TestRetryBackoffWorkerError(t *testing.T) {
+	fail := errors.New("Error")
+	backoff := Backoff{Interval: time.Second, Timeout: time.Minute}
+
+	result := RetryBackoffWorker(backoff, func(time.Duration) {}, func() (bool, error) {
+		return false, fail
+	})
+
+	if result != fail {
+		t.Errorf("Wrong result, expected: %#v, got: %#v", fail, result)
+	}
+}
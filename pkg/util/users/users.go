@@ -1,19 +1,21 @@
 package users
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"sort"
 	"strings"
-
-	"reflect"
+	"time"
 
 	"github.com/zalando/postgres-operator/pkg/spec"
 	"github.com/zalando/postgres-operator/pkg/util"
+	"github.com/zalando/postgres-operator/pkg/util/constants"
 )
 
 const (
 	createUserSQL        = `SET LOCAL synchronous_commit = 'local'; CREATE ROLE "%s" %s %s;`
-	alterUserSQL         = `ALTER ROLE "%s" %s`
+	alterUserSQL         = `ALTER ROLE "%s" WITH %s`
 	alterRoleResetAllSQL = `ALTER ROLE "%s" RESET ALL`
 	alterRoleSetSQL      = `ALTER ROLE "%s" SET %s TO %s`
 	grantToUserSQL       = `GRANT %s TO "%s"`
@@ -21,76 +23,170 @@ const (
 	passwordTemplate     = "ENCRYPTED PASSWORD '%s'"
 	inRoleTemplate       = `IN ROLE %s`
 	adminTemplate        = `ADMIN %s`
+
+	connectionLimitTemplate = `CONNECTION LIMIT %d`
+	// noConnectionLimit is the rolconnlimit of roles without a connection limit
+	noConnectionLimit int64 = -1
+
+	validUntilTemplate = `VALID UNTIL '%s'`
+
+	// negatedFlagPrefix turns a role attribute into the flag removing it, e.g. NOCREATEDB
+	negatedFlagPrefix = "NO"
 )
 
+// superuserAttributes are the role attributes a superuser has implicitly, whatever its role says
+var superuserAttributes = []string{
+	constants.RoleFlagCreateRole,
+	constants.RoleFlagCreateDB,
+	constants.RoleFlagReplication,
+	constants.RoleFlagByPassRLS,
+}
+
 // DefaultUserSyncStrategy implements a user sync strategy that merges already existing database users
 // with those defined in the manifest, altering existing users when necessary. It will never strips
-// an existing roles of another role membership, nor it removes the already assigned flag
-// (except for the NOLOGIN). TODO: process other NOflags, i.e. NOSUPERUSER correctly.
-type DefaultUserSyncStrategy struct {
-	PasswordEncryption string
-}
+// an existing roles of another role membership, nor it removes an already assigned flag unless the
+// manifest asks for it with the NO flag, e.g. NOBYPASSRLS.
+type DefaultUserSyncStrategy struct{}
 
-// ProduceSyncRequests figures out the types of changes that need to happen with the given users.
+// ProduceSyncRequests figures out the types of changes that need to happen with the given users, their passwords
+// are encrypted with the given method.
 func (strategy DefaultUserSyncStrategy) ProduceSyncRequests(dbUsers spec.PgUserMap,
-	newUsers spec.PgUserMap) []spec.PgSyncUserRequest {
+	newUsers spec.PgUserMap, passwordEncryption string) []spec.PgSyncUserRequest {
 
 	var reqs []spec.PgSyncUserRequest
 	// No existing roles are deleted or stripped of role memebership/flags
 	for name, newUser := range newUsers {
 		dbUser, exists := dbUsers[name]
 		if !exists {
-			reqs = append(reqs, spec.PgSyncUserRequest{Kind: spec.PGSyncUserAdd, User: newUser})
-			if len(newUser.Parameters) > 0 {
-				reqs = append(reqs, spec.PgSyncUserRequest{Kind: spec.PGSyncAlterSet, User: newUser})
-			}
+			// the settings of the role are set together with its creation
+			reqs = append(reqs, spec.PgSyncUserRequest{Kind: spec.PGSyncUserAdd, User: newUser, PasswordEncryption: passwordEncryption})
 		} else {
-			r := spec.PgSyncUserRequest{}
-			newMD5Password := util.NewEncryptor(strategy.PasswordEncryption).PGUserPassword(newUser)
+			r := spec.PgSyncUserRequest{PasswordEncryption: passwordEncryption}
+			encryptor := util.NewEncryptor(passwordEncryption)
 
-			if dbUser.Password != newMD5Password {
-				r.User.Password = newMD5Password
+			// a password stored with another encryption method, e.g. md5 after migrating to SCRAM-SHA-256,
+			// is set again with the current one
+			if !encryptor.PGUserPasswordMatches(newUser, dbUser.Password) {
+				r.User.Password = encryptor.PGUserPassword(newUser)
 				r.Kind = spec.PGsyncUserAlter
 			}
 			if addNewRoles, equal := util.SubstractStringSlices(newUser.MemberOf, dbUser.MemberOf); !equal {
 				r.User.MemberOf = addNewRoles
 				r.Kind = spec.PGsyncUserAlter
 			}
-			if addNewFlags, equal := util.SubstractStringSlices(newUser.Flags, dbUser.Flags); !equal {
-				r.User.Flags = addNewFlags
+			if alterFlags := flagsToAlter(newUser.Flags, dbUser.Flags); len(alterFlags) > 0 {
+				r.User.Flags = alterFlags
+				r.Kind = spec.PGsyncUserAlter
+			}
+			if newUser.ConnectionLimit != nil && *newUser.ConnectionLimit != connectionLimit(dbUser) {
+				r.User.ConnectionLimit = newUser.ConnectionLimit
+				r.Kind = spec.PGsyncUserAlter
+			}
+			if expiry := desiredValidUntil(newUser); expiry != nil && !expiry.Equal(validUntil(dbUser)) {
+				r.User.ValidUntil = expiry
 				r.Kind = spec.PGsyncUserAlter
 			}
+			parametersChanged := newUser.Parameters != nil && !sameParameters(dbUser.Parameters, newUser.Parameters)
 			if r.Kind == spec.PGsyncUserAlter {
+				// changed settings are altered in the same round-trip as the attributes
 				r.User.Name = newUser.Name
+				if parametersChanged {
+					r.User.Parameters = newUser.Parameters
+				}
 				reqs = append(reqs, r)
-			}
-			if len(newUser.Parameters) > 0 && !reflect.DeepEqual(dbUser.Parameters, newUser.Parameters) {
+			} else if parametersChanged {
 				reqs = append(reqs, spec.PgSyncUserRequest{Kind: spec.PGSyncAlterSet, User: newUser})
 			}
 		}
 	}
 
-	return reqs
+	return orderSyncRequests(reqs)
+}
+
+// orderSyncRequests sorts the requests so that a role is created before the roles granted into it, or administered
+// by it, are created or altered. Roles are otherwise ordered by name, the statements do not depend on the iteration
+// order of the users. Roles are never dropped by the sync, so no order is needed for removing their members. Roles
+// of a membership cycle are appended last and left to the retries of ExecuteSyncRequests.
+func orderSyncRequests(reqs []spec.PgSyncUserRequest) []spec.PgSyncUserRequest {
+	created := make(map[string]bool)
+	byRole := make(map[string][]spec.PgSyncUserRequest)
+	names := make([]string, 0)
+	for _, r := range reqs {
+		if r.Kind == spec.PGSyncUserAdd {
+			created[r.User.Name] = true
+		}
+		if _, exists := byRole[r.User.Name]; !exists {
+			names = append(names, r.User.Name)
+		}
+		byRole[r.User.Name] = append(byRole[r.User.Name], r)
+	}
+	sort.Strings(names)
+
+	// only the roles created by the same sync have to come first, the others exist already
+	dependencies := make(map[string][]string)
+	for _, name := range names {
+		for _, r := range byRole[name] {
+			groups := append([]string{r.User.AdminRole}, r.User.MemberOf...)
+			for _, group := range groups {
+				if group != name && created[group] {
+					dependencies[name] = append(dependencies[name], group)
+				}
+			}
+		}
+	}
+
+	// the first role by name whose groups are done comes next
+	ordered := make([]spec.PgSyncUserRequest, 0, len(reqs))
+	done := make(map[string]bool)
+	for len(done) < len(names) {
+		next := ""
+		for _, name := range names {
+			if done[name] {
+				continue
+			}
+			ready := true
+			for _, group := range dependencies[name] {
+				ready = ready && done[group]
+			}
+			if ready {
+				next = name
+				break
+			}
+		}
+		if next == "" {
+			for _, name := range names {
+				if !done[name] {
+					ordered = append(ordered, byRole[name]...)
+					done[name] = true
+				}
+			}
+			break
+		}
+		ordered = append(ordered, byRole[next]...)
+		done[next] = true
+	}
+
+	return ordered
 }
 
 // ExecuteSyncRequests makes actual database changes from the requests passed in its arguments.
-func (strategy DefaultUserSyncStrategy) ExecuteSyncRequests(requests []spec.PgSyncUserRequest, db *sql.DB) error {
+func (strategy DefaultUserSyncStrategy) ExecuteSyncRequests(ctx context.Context, requests []spec.PgSyncUserRequest, db *sql.DB) error {
 	var reqretries []spec.PgSyncUserRequest
 	var errors []string
 	for _, request := range requests {
 		switch request.Kind {
 		case spec.PGSyncUserAdd:
-			if err := strategy.createPgUser(request.User, db); err != nil {
+			if err := strategy.createPgUser(ctx, request.User, request.PasswordEncryption, db); err != nil {
 				reqretries = append(reqretries, request)
 				errors = append(errors, fmt.Sprintf("could not create user %q: %v", request.User.Name, err))
 			}
 		case spec.PGsyncUserAlter:
-			if err := strategy.alterPgUser(request.User, db); err != nil {
+			if err := strategy.alterPgUser(ctx, request.User, request.PasswordEncryption, db); err != nil {
 				reqretries = append(reqretries, request)
 				errors = append(errors, fmt.Sprintf("could not alter user %q: %v", request.User.Name, err))
 			}
 		case spec.PGSyncAlterSet:
-			if err := strategy.alterPgUserSet(request.User, db); err != nil {
+			if err := strategy.alterPgUserSet(ctx, request.User, db); err != nil {
 				reqretries = append(reqretries, request)
 				errors = append(errors, fmt.Sprintf("could not set custom user %q parameters: %v", request.User.Name, err))
 			}
@@ -104,7 +200,7 @@ func (strategy DefaultUserSyncStrategy) ExecuteSyncRequests(requests []spec.PgSy
 	// retry adding roles as long as the number of failed attempts is shrinking
 	if len(reqretries) > 0 {
 		if len(reqretries) < len(requests) {
-			if err := strategy.ExecuteSyncRequests(reqretries, db); err != nil {
+			if err := strategy.ExecuteSyncRequests(ctx, reqretries, db); err != nil {
 				return err
 			}
 		} else {
@@ -115,21 +211,21 @@ func (strategy DefaultUserSyncStrategy) ExecuteSyncRequests(requests []spec.PgSy
 	return nil
 }
 
-func (strategy DefaultUserSyncStrategy) alterPgUserSet(user spec.PgUser, db *sql.DB) error {
+func (strategy DefaultUserSyncStrategy) alterPgUserSet(ctx context.Context, user spec.PgUser, db *sql.DB) error {
 	queries := produceAlterRoleSetStmts(user)
 	query := fmt.Sprintf(doBlockStmt, strings.Join(queries, ";"))
-	if _, err := db.Exec(query); err != nil {
+	if _, err := db.ExecContext(ctx, query); err != nil {
 		return fmt.Errorf("dB error: %v, query: %s", err, query)
 	}
 	return nil
 }
 
-func (strategy DefaultUserSyncStrategy) createPgUser(user spec.PgUser, db *sql.DB) error {
+func (strategy DefaultUserSyncStrategy) createPgUser(ctx context.Context, user spec.PgUser, encryption string, db *sql.DB) error {
 	var userFlags []string
 	var userPassword string
 
 	if len(user.Flags) > 0 {
-		userFlags = append(userFlags, user.Flags...)
+		userFlags = append(userFlags, combinableFlags(user.Flags)...)
 	}
 	if len(user.MemberOf) > 0 {
 		userFlags = append(userFlags, fmt.Sprintf(inRoleTemplate, quoteMemberList(user)))
@@ -137,43 +233,51 @@ func (strategy DefaultUserSyncStrategy) createPgUser(user spec.PgUser, db *sql.D
 	if user.AdminRole != "" {
 		userFlags = append(userFlags, fmt.Sprintf(adminTemplate, user.AdminRole))
 	}
+	if user.ConnectionLimit != nil {
+		userFlags = append(userFlags, fmt.Sprintf(connectionLimitTemplate, *user.ConnectionLimit))
+	}
+	if user.ValidUntil != nil {
+		userFlags = append(userFlags, fmt.Sprintf(validUntilTemplate, formatValidUntil(*user.ValidUntil)))
+	}
 
 	if user.Password == "" {
 		userPassword = "PASSWORD NULL"
 	} else {
-		userPassword = fmt.Sprintf(passwordTemplate, util.NewEncryptor(strategy.PasswordEncryption).PGUserPassword(user))
+		userPassword = fmt.Sprintf(passwordTemplate, util.NewEncryptor(encryption).PGUserPassword(user))
 	}
 	query := fmt.Sprintf(createUserSQL, user.Name, strings.Join(userFlags, " "), userPassword)
-
-	if _, err := db.Exec(query); err != nil { // TODO: Try several times
-		return fmt.Errorf("dB error: %v, query: %s", err, query)
+	// the statements of a single query run in one transaction, a role is not created without its settings
+	if len(user.Parameters) > 0 {
+		query += " " + strings.Join(produceAlterRoleSetStmts(user), "; ") + ";"
 	}
 
-	if len(user.Parameters) > 0 {
-		if err := strategy.alterPgUserSet(user, db); err != nil {
-			return fmt.Errorf("incomplete setup for user %s: %v", user.Name, err)
-		}
+	if _, err := db.ExecContext(ctx, query); err != nil { // TODO: Try several times
+		return fmt.Errorf("dB error: %v, query: %s", err, query)
 	}
 
 	return nil
 }
 
-func (strategy DefaultUserSyncStrategy) alterPgUser(user spec.PgUser, db *sql.DB) error {
+func (strategy DefaultUserSyncStrategy) alterPgUser(ctx context.Context, user spec.PgUser, encryption string, db *sql.DB) error {
 	var resultStmt []string
 
-	if user.Password != "" || len(user.Flags) > 0 {
-		alterStmt := produceAlterStmt(user, strategy.PasswordEncryption)
+	if user.Password != "" || len(user.Flags) > 0 || user.ConnectionLimit != nil || user.ValidUntil != nil {
+		alterStmt := produceAlterStmt(user, encryption)
 		resultStmt = append(resultStmt, alterStmt)
 	}
+	// memberships and settings cannot be part of the ALTER ROLE, they are sent in the same round-trip though
 	if len(user.MemberOf) > 0 {
 		grantStmt := produceGrantStmt(user)
 		resultStmt = append(resultStmt, grantStmt)
 	}
+	if user.Parameters != nil {
+		resultStmt = append(resultStmt, produceAlterRoleSetStmts(user)...)
+	}
 
 	if len(resultStmt) > 0 {
 		query := fmt.Sprintf(doBlockStmt, strings.Join(resultStmt, ";"))
 
-		if _, err := db.Exec(query); err != nil { // TODO: Try several times
+		if _, err := db.ExecContext(ctx, query); err != nil { // TODO: Try several times
 			return fmt.Errorf("dB error: %v query %s", err, query)
 		}
 	}
@@ -181,11 +285,12 @@ func (strategy DefaultUserSyncStrategy) alterPgUser(user spec.PgUser, db *sql.DB
 	return nil
 }
 
+// produceAlterStmt combines all attribute changes of the role into a single ALTER ROLE
 func produceAlterStmt(user spec.PgUser, encryption string) string {
-	// ALTER ROLE ... LOGIN ENCRYPTED PASSWORD ..
+	// ALTER ROLE ... WITH LOGIN ENCRYPTED PASSWORD ..
 	result := make([]string, 0)
 	password := user.Password
-	flags := user.Flags
+	flags := combinableFlags(user.Flags)
 
 	if password != "" {
 		result = append(result, fmt.Sprintf(passwordTemplate, util.NewEncryptor(encryption).PGUserPassword(user)))
@@ -193,14 +298,130 @@ func produceAlterStmt(user spec.PgUser, encryption string) string {
 	if len(flags) != 0 {
 		result = append(result, strings.Join(flags, " "))
 	}
+	if user.ConnectionLimit != nil {
+		result = append(result, fmt.Sprintf(connectionLimitTemplate, *user.ConnectionLimit))
+	}
+	if user.ValidUntil != nil {
+		result = append(result, fmt.Sprintf(validUntilTemplate, formatValidUntil(*user.ValidUntil)))
+	}
 	return fmt.Sprintf(alterUserSQL, user.Name, strings.Join(result, " "))
 }
 
+// combinableFlags drops repeated attributes, Postgres rejects an ALTER ROLE naming an attribute twice, e.g. both
+// LOGIN and NOLOGIN. The last flag of an attribute wins and keeps the position of its first one.
+func combinableFlags(flags []string) []string {
+	result := make([]string, 0, len(flags))
+	position := make(map[string]int)
+	for _, flag := range flags {
+		attribute := strings.TrimPrefix(flag, negatedFlagPrefix)
+		if i, seen := position[attribute]; seen {
+			result[i] = flag
+			continue
+		}
+		position[attribute] = len(result)
+		result = append(result, flag)
+	}
+	return result
+}
+
+// flagsToAlter returns the flags of the manifest the role in the database does not comply with yet: an attribute
+// is set if the role lacks it and a NO flag removes an attribute the role has. The attributes a superuser has
+// implicitly are not altered for a role staying superuser.
+func flagsToAlter(newFlags, dbFlags []string) []string {
+	superuser := util.SliceContains(dbFlags, constants.RoleFlagSuperuser) &&
+		!util.SliceContains(newFlags, negatedFlagPrefix+constants.RoleFlagSuperuser)
+
+	var result []string
+	for _, flag := range newFlags {
+		attribute := strings.TrimPrefix(flag, negatedFlagPrefix)
+		if superuser && util.SliceContains(superuserAttributes, attribute) {
+			continue
+		}
+		if attribute == flag && !util.SliceContains(dbFlags, attribute) {
+			result = append(result, flag)
+		} else if attribute != flag && util.SliceContains(dbFlags, attribute) {
+			result = append(result, flag)
+		}
+	}
+	return result
+}
+
+// connectionLimit returns the connection limit of the user, roles without one are unlimited
+func connectionLimit(user spec.PgUser) int64 {
+	if user.ConnectionLimit == nil {
+		return noConnectionLimit
+	}
+	return *user.ConnectionLimit
+}
+
+// desiredValidUntil returns the expiry the role is synced to. Manifest roles without one never expire, so an expiry
+// left in the database, e.g. after removing the entry of the role, is reset. It is nil for roles with an unmanaged
+// expiry.
+func desiredValidUntil(user spec.PgUser) *time.Time {
+	if user.ValidUntil == nil && user.Origin == spec.RoleOriginManifest {
+		return &time.Time{}
+	}
+	return user.ValidUntil
+}
+
+// validUntil returns the expiry of the user, roles without one never expire
+func validUntil(user spec.PgUser) time.Time {
+	if user.ValidUntil == nil {
+		return time.Time{}
+	}
+	return *user.ValidUntil
+}
+
+// formatValidUntil renders the expiry for VALID UNTIL, the zero time removes the expiry
+func formatValidUntil(expiry time.Time) string {
+	if expiry.IsZero() {
+		return "infinity"
+	}
+	return expiry.UTC().Format(time.RFC3339)
+}
+
+// sameParameters compares the role settings read from the database with the desired ones, Postgres keeps the
+// values without quotes and a search_path with its schemas separated by ", "
+func sameParameters(dbParameters, newParameters map[string]string) bool {
+	if len(dbParameters) != len(newParameters) {
+		return false
+	}
+	for name, value := range newParameters {
+		dbValue, ok := dbParameters[name]
+		if !ok || normalizeParameterValue(name, dbValue) != normalizeParameterValue(name, value) {
+			return false
+		}
+	}
+	return true
+}
+
+func normalizeParameterValue(name, val string) string {
+	val = strings.TrimSpace(val)
+	if len(val) > 1 && val[0] == '\'' && val[len(val)-1] == '\'' {
+		val = val[1 : len(val)-1]
+	}
+	if name != "search_path" {
+		return val
+	}
+	schemas := strings.Split(val, ",")
+	for i := range schemas {
+		schemas[i] = strings.TrimSpace(schemas[i])
+	}
+	return strings.Join(schemas, ", ")
+}
+
+// produceAlterRoleSetStmts resets all settings of the role before setting the desired ones,
+// so settings removed from the manifest are reset as well
 func produceAlterRoleSetStmts(user spec.PgUser) []string {
 	result := make([]string, 0)
 	result = append(result, fmt.Sprintf(alterRoleResetAllSQL, user.Name))
-	for name, value := range user.Parameters {
-		result = append(result, fmt.Sprintf(alterRoleSetSQL, user.Name, name, quoteParameterValue(name, value)))
+	names := make([]string, 0, len(user.Parameters))
+	for name := range user.Parameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		result = append(result, fmt.Sprintf(alterRoleSetSQL, user.Name, name, quoteParameterValue(name, user.Parameters[name])))
 	}
 	return result
 }
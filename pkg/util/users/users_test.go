@@ -0,0 +1,437 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zalando/postgres-operator/pkg/spec"
+	"github.com/zalando/postgres-operator/pkg/util"
+)
+
+func int64ToPointer(value int64) *int64 {
+	return &value
+}
+
+func TestProduceSyncRequestsConnectionLimit(t *testing.T) {
+	strategy := DefaultUserSyncStrategy{}
+	newUser := spec.PgUser{Name: "app_user", Password: "secret", Flags: []string{"LOGIN"}}
+	dbUser := spec.PgUser{Name: "app_user", Flags: []string{"LOGIN"}, ConnectionLimit: int64ToPointer(-1)}
+	dbUser.Password = util.NewEncryptor("md5").PGUserPassword(newUser)
+
+	tests := []struct {
+		about    string
+		newLimit *int64
+		dbLimit  *int64
+		expected *int64
+	}{
+		{"unmanaged limit", nil, int64ToPointer(20), nil},
+		{"unlimited in both", int64ToPointer(-1), int64ToPointer(-1), nil},
+		{"unlimited default of a role read without limit", int64ToPointer(-1), nil, nil},
+		{"same limit", int64ToPointer(10), int64ToPointer(10), nil},
+		{"new limit", int64ToPointer(10), int64ToPointer(-1), int64ToPointer(10)},
+		{"removed limit", int64ToPointer(-1), int64ToPointer(10), int64ToPointer(-1)},
+	}
+	for _, tt := range tests {
+		newUser.ConnectionLimit = tt.newLimit
+		dbUser.ConnectionLimit = tt.dbLimit
+		reqs := strategy.ProduceSyncRequests(spec.PgUserMap{"app_user": dbUser}, spec.PgUserMap{"app_user": newUser}, "md5")
+
+		if tt.expected == nil {
+			if len(reqs) != 0 {
+				t.Errorf("%s: expected no sync requests, got %#v", tt.about, reqs)
+			}
+			continue
+		}
+		if len(reqs) != 1 || reqs[0].Kind != spec.PGsyncUserAlter {
+			t.Fatalf("%s: expected one alter request, got %#v", tt.about, reqs)
+		}
+		if reqs[0].User.ConnectionLimit == nil || *reqs[0].User.ConnectionLimit != *tt.expected {
+			t.Errorf("%s: expected connection limit %d, got %v", tt.about, *tt.expected, reqs[0].User.ConnectionLimit)
+		}
+		expectedStmt := fmt.Sprintf(`ALTER ROLE "app_user" WITH CONNECTION LIMIT %d`, *tt.expected)
+		if stmt := produceAlterStmt(reqs[0].User, reqs[0].PasswordEncryption); stmt != expectedStmt {
+			t.Errorf("%s: expected statement %q, got %q", tt.about, expectedStmt, stmt)
+		}
+	}
+}
+
+func TestProduceSyncRequestsPasswordEncryption(t *testing.T) {
+	strategy := DefaultUserSyncStrategy{}
+	newUser := spec.PgUser{Name: "app_user", Password: "secret", Flags: []string{"LOGIN"}}
+	md5User := spec.PgUser{Name: "app_user", Flags: []string{"LOGIN"}}
+	md5User.Password = util.NewEncryptor("md5").PGUserPassword(newUser)
+	scramUser := spec.PgUser{Name: "app_user", Flags: []string{"LOGIN"}}
+	scramUser.Password = util.NewEncryptor("scram-sha-256").PGUserPassword(newUser)
+
+	// a role still using md5 gets its password set again with SCRAM-SHA-256
+	reqs := strategy.ProduceSyncRequests(spec.PgUserMap{"app_user": md5User}, spec.PgUserMap{"app_user": newUser}, "scram-sha-256")
+	if len(reqs) != 1 || reqs[0].Kind != spec.PGsyncUserAlter {
+		t.Fatalf("expected one alter request for the md5 password, got %#v", reqs)
+	}
+	if !strings.HasPrefix(reqs[0].User.Password, "SCRAM-SHA-256$") {
+		t.Errorf("expected a SCRAM-SHA-256 password, got %q", reqs[0].User.Password)
+	}
+	if reqs[0].PasswordEncryption != "scram-sha-256" {
+		t.Errorf("expected the request to carry the encryption method, got %q", reqs[0].PasswordEncryption)
+	}
+
+	// a role migrated already is left untouched, although the salt of its password differs on every hash
+	if reqs = strategy.ProduceSyncRequests(spec.PgUserMap{"app_user": scramUser}, spec.PgUserMap{"app_user": newUser}, "scram-sha-256"); len(reqs) != 0 {
+		t.Errorf("expected no sync requests for the SCRAM-SHA-256 password, got %#v", reqs)
+	}
+}
+
+func TestProduceSyncRequestsValidUntil(t *testing.T) {
+	strategy := DefaultUserSyncStrategy{}
+	newUser := spec.PgUser{Name: "contractor", Password: "secret", Flags: []string{"LOGIN"}}
+	dbUser := spec.PgUser{Name: "contractor", Flags: []string{"LOGIN"}}
+	dbUser.Password = util.NewEncryptor("md5").PGUserPassword(newUser)
+
+	never := time.Time{}
+	expiry := time.Date(2021, time.June, 30, 18, 0, 0, 0, time.UTC)
+	sameExpiry := expiry.In(time.FixedZone("CEST", 2*60*60))
+	later := expiry.Add(24 * time.Hour)
+
+	tests := []struct {
+		about        string
+		newExpiry    *time.Time
+		dbExpiry     *time.Time
+		expectedStmt string
+	}{
+		{"unmanaged expiry", nil, &expiry, ""},
+		{"never expires in both", &never, &never, ""},
+		{"never expires for a role read without expiry", &never, nil, ""},
+		{"same expiry in another time zone", &sameExpiry, &expiry, ""},
+		{"new expiry", &expiry, &never, `ALTER ROLE "contractor" WITH VALID UNTIL '2021-06-30T18:00:00Z'`},
+		{"extended expiry", &later, &expiry, `ALTER ROLE "contractor" WITH VALID UNTIL '2021-07-01T18:00:00Z'`},
+		{"removed expiry", &never, &expiry, `ALTER ROLE "contractor" WITH VALID UNTIL 'infinity'`},
+	}
+	for _, tt := range tests {
+		newUser.ValidUntil = tt.newExpiry
+		dbUser.ValidUntil = tt.dbExpiry
+		reqs := strategy.ProduceSyncRequests(spec.PgUserMap{"contractor": dbUser}, spec.PgUserMap{"contractor": newUser}, "md5")
+
+		if tt.expectedStmt == "" {
+			if len(reqs) != 0 {
+				t.Errorf("%s: expected no sync requests, got %#v", tt.about, reqs)
+			}
+			continue
+		}
+		if len(reqs) != 1 || reqs[0].Kind != spec.PGsyncUserAlter {
+			t.Fatalf("%s: expected one alter request, got %#v", tt.about, reqs)
+		}
+		if stmt := produceAlterStmt(reqs[0].User, reqs[0].PasswordEncryption); stmt != tt.expectedStmt {
+			t.Errorf("%s: expected statement %q, got %q", tt.about, tt.expectedStmt, stmt)
+		}
+	}
+
+	// a manifest role without an expiry never expires, the expiry left in the database is reset
+	newUser.Origin = spec.RoleOriginManifest
+	newUser.ValidUntil = nil
+	dbUser.ValidUntil = &expiry
+	reqs := strategy.ProduceSyncRequests(spec.PgUserMap{"contractor": dbUser}, spec.PgUserMap{"contractor": newUser}, "md5")
+	if len(reqs) != 1 || reqs[0].Kind != spec.PGsyncUserAlter {
+		t.Fatalf("expected one alter request for the manifest role, got %#v", reqs)
+	}
+	if stmt, expected := produceAlterStmt(reqs[0].User, reqs[0].PasswordEncryption), `ALTER ROLE "contractor" WITH VALID UNTIL 'infinity'`; stmt != expected {
+		t.Errorf("expected statement %q, got %q", expected, stmt)
+	}
+	dbUser.ValidUntil = &never
+	if reqs = strategy.ProduceSyncRequests(spec.PgUserMap{"contractor": dbUser}, spec.PgUserMap{"contractor": newUser}, "md5"); len(reqs) != 0 {
+		t.Errorf("expected no sync requests for a manifest role that never expires, got %#v", reqs)
+	}
+}
+
+func TestProduceSyncRequestsParameters(t *testing.T) {
+	strategy := DefaultUserSyncStrategy{}
+	newUser := spec.PgUser{Name: "app_user", Password: "secret", Flags: []string{"LOGIN"}}
+	dbUser := spec.PgUser{Name: "app_user", Flags: []string{"LOGIN"}}
+	dbUser.Password = util.NewEncryptor("md5").PGUserPassword(newUser)
+
+	tests := []struct {
+		about         string
+		newParameters map[string]string
+		dbParameters  map[string]string
+		expectedStmts []string
+	}{
+		{"unmanaged parameters", nil, map[string]string{"search_path": "app, public"}, nil},
+		{"same search_path", map[string]string{"search_path": "'app,public'"}, map[string]string{"search_path": "app, public"}, nil},
+		{"same parameters", map[string]string{"statement_timeout": "5s"}, map[string]string{"statement_timeout": "5s"}, nil},
+		{"nothing to reset", map[string]string{}, map[string]string{}, nil},
+		{"new parameter", map[string]string{"search_path": "app, public", "statement_timeout": "5s"}, map[string]string{"search_path": "app, public"},
+			[]string{`ALTER ROLE "app_user" RESET ALL`, `ALTER ROLE "app_user" SET search_path TO app, public`, `ALTER ROLE "app_user" SET statement_timeout TO '5s'`}},
+		{"removed parameter", map[string]string{"search_path": "app"}, map[string]string{"search_path": "app", "statement_timeout": "5s"},
+			[]string{`ALTER ROLE "app_user" RESET ALL`, `ALTER ROLE "app_user" SET search_path TO app`}},
+		{"reset parameters", map[string]string{}, map[string]string{"search_path": "app"},
+			[]string{`ALTER ROLE "app_user" RESET ALL`}},
+	}
+	for _, tt := range tests {
+		newUser.Parameters = tt.newParameters
+		dbUser.Parameters = tt.dbParameters
+		reqs := strategy.ProduceSyncRequests(spec.PgUserMap{"app_user": dbUser}, spec.PgUserMap{"app_user": newUser}, "md5")
+
+		if tt.expectedStmts == nil {
+			if len(reqs) != 0 {
+				t.Errorf("%s: expected no sync requests, got %#v", tt.about, reqs)
+			}
+			continue
+		}
+		if len(reqs) != 1 || reqs[0].Kind != spec.PGSyncAlterSet {
+			t.Fatalf("%s: expected one alter set request, got %#v", tt.about, reqs)
+		}
+		if stmts := produceAlterRoleSetStmts(reqs[0].User); !reflect.DeepEqual(stmts, tt.expectedStmts) {
+			t.Errorf("%s: expected statements %q, got %q", tt.about, tt.expectedStmts, stmts)
+		}
+	}
+}
+
+func TestProduceSyncRequestsFlags(t *testing.T) {
+	strategy := DefaultUserSyncStrategy{}
+	newUser := spec.PgUser{Name: "app_user", Password: "secret"}
+	dbUser := spec.PgUser{Name: "app_user"}
+	dbUser.Password = util.NewEncryptor("md5").PGUserPassword(newUser)
+
+	tests := []struct {
+		about    string
+		newFlags []string
+		dbFlags  []string
+		expected string
+	}{
+		{"same flags", []string{"LOGIN", "REPLICATION"}, []string{"INHERIT", "LOGIN", "REPLICATION"}, ""},
+		{"grant bypassrls", []string{"BYPASSRLS", "LOGIN"}, []string{"LOGIN"}, "BYPASSRLS"},
+		{"revoke bypassrls", []string{"LOGIN", "NOBYPASSRLS"}, []string{"BYPASSRLS", "LOGIN"}, "NOBYPASSRLS"},
+		{"grant replication", []string{"LOGIN", "REPLICATION"}, []string{"LOGIN"}, "REPLICATION"},
+		{"revoke replication", []string{"LOGIN", "NOREPLICATION"}, []string{"LOGIN", "REPLICATION"}, "NOREPLICATION"},
+		{"grant createdb", []string{"CREATEDB", "LOGIN"}, []string{"LOGIN"}, "CREATEDB"},
+		{"revoke createdb", []string{"LOGIN", "NOCREATEDB"}, []string{"CREATEDB", "LOGIN"}, "NOCREATEDB"},
+		{"grant createrole", []string{"CREATEROLE", "LOGIN"}, []string{"LOGIN"}, "CREATEROLE"},
+		{"revoke createrole", []string{"LOGIN", "NOCREATEROLE"}, []string{"CREATEROLE", "LOGIN"}, "NOCREATEROLE"},
+		{"revoked attribute stays revoked", []string{"LOGIN", "NOCREATEDB"}, []string{"LOGIN"}, ""},
+		{"attributes not in the manifest are kept", []string{"LOGIN"}, []string{"BYPASSRLS", "LOGIN"}, ""},
+		{"several attributes", []string{"LOGIN", "NOCREATEDB", "REPLICATION"}, []string{"CREATEDB", "LOGIN"}, "NOCREATEDB REPLICATION"},
+		{"superuser has the attributes implicitly", []string{"BYPASSRLS", "NOCREATEDB", "SUPERUSER"}, []string{"CREATEDB", "SUPERUSER"}, ""},
+		{"attributes of a former superuser", []string{"BYPASSRLS", "NOSUPERUSER"}, []string{"SUPERUSER"}, "BYPASSRLS NOSUPERUSER"},
+		{"login role", []string{"INHERIT", "LOGIN"}, []string{"INHERIT", "LOGIN"}, ""},
+		{"group role", []string{"INHERIT", "NOLOGIN"}, []string{"INHERIT"}, ""},
+		{"login role turned into a group role", []string{"INHERIT", "NOLOGIN"}, []string{"INHERIT", "LOGIN"}, "NOLOGIN"},
+		{"group role turned into a login role", []string{"INHERIT", "LOGIN"}, []string{"INHERIT"}, "LOGIN"},
+	}
+	for _, tt := range tests {
+		newUser.Flags = tt.newFlags
+		dbUser.Flags = tt.dbFlags
+		reqs := strategy.ProduceSyncRequests(spec.PgUserMap{"app_user": dbUser}, spec.PgUserMap{"app_user": newUser}, "md5")
+
+		if tt.expected == "" {
+			if len(reqs) != 0 {
+				t.Errorf("%s: expected no sync requests, got %#v", tt.about, reqs)
+			}
+			continue
+		}
+		if len(reqs) != 1 || reqs[0].Kind != spec.PGsyncUserAlter {
+			t.Fatalf("%s: expected one alter request, got %#v", tt.about, reqs)
+		}
+		expectedStmt := fmt.Sprintf(`ALTER ROLE "app_user" WITH %s`, tt.expected)
+		if stmt := produceAlterStmt(reqs[0].User, reqs[0].PasswordEncryption); stmt != expectedStmt {
+			t.Errorf("%s: expected statement %q, got %q", tt.about, expectedStmt, stmt)
+		}
+	}
+}
+
+// recordingDriver records the statements executed on its connections
+type recordingDriver struct {
+	statements *[]string
+}
+
+type recordingConn struct {
+	statements *[]string
+}
+
+func (d recordingDriver) Open(name string) (driver.Conn, error) {
+	return recordingConn{statements: d.statements}, nil
+}
+
+func (c recordingConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c recordingConn) Close() error {
+	return nil
+}
+
+func (c recordingConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c recordingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	*c.statements = append(*c.statements, query)
+	return driver.RowsAffected(0), nil
+}
+
+var executedStatements []string
+
+func init() {
+	sql.Register("recording", recordingDriver{statements: &executedStatements})
+}
+
+func TestSyncRequestsRoleHierarchy(t *testing.T) {
+	strategy := DefaultUserSyncStrategy{}
+	newUsers := spec.PgUserMap{
+		"app_user":   {Name: "app_user", Password: "secret", Flags: []string{"LOGIN"}, MemberOf: []string{"zz_writer"}},
+		"zz_writer":  {Name: "zz_writer", Flags: []string{"NOLOGIN"}, MemberOf: []string{"zz_reader"}},
+		"zz_reader":  {Name: "zz_reader", Flags: []string{"NOLOGIN"}},
+		"aa_admin":   {Name: "aa_admin", Flags: []string{"NOLOGIN"}, AdminRole: "zz_owner"},
+		"zz_owner":   {Name: "zz_owner", Flags: []string{"NOLOGIN"}},
+		"existing":   {Name: "existing", Flags: []string{"LOGIN"}, MemberOf: []string{"zz_reader"}},
+		"standalone": {Name: "standalone", Flags: []string{"LOGIN"}},
+	}
+	dbUsers := spec.PgUserMap{
+		"existing": {Name: "existing", Flags: []string{"LOGIN"}},
+	}
+
+	reqs := strategy.ProduceSyncRequests(dbUsers, newUsers, "md5")
+	names := make([]string, 0, len(reqs))
+	for _, r := range reqs {
+		names = append(names, r.User.Name)
+	}
+	// the group roles come before their members, the roles are ordered by name otherwise
+	expected := []string{"standalone", "zz_owner", "aa_admin", "zz_reader", "existing", "zz_writer", "app_user"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected the requests for %v, got %v", expected, names)
+	}
+
+	// the order is the same for every iteration order of the users
+	for i := 0; i < 10; i++ {
+		again := strategy.ProduceSyncRequests(dbUsers, newUsers, "md5")
+		if !reflect.DeepEqual(reqs, again) {
+			t.Fatalf("expected the same order of the requests, got %v and %v", reqs, again)
+		}
+	}
+
+	// the statements are executed in the order of the requests
+	executedStatements = nil
+	db, err := sql.Open("recording", "")
+	if err != nil {
+		t.Fatalf("could not open the database: %v", err)
+	}
+	defer db.Close()
+	if err := strategy.ExecuteSyncRequests(context.TODO(), reqs, db); err != nil {
+		t.Fatalf("could not execute the sync requests: %v", err)
+	}
+	var executed []string
+	for _, stmt := range executedStatements {
+		for _, name := range expected {
+			if strings.Contains(stmt, `CREATE ROLE "`+name+`"`) || strings.Contains(stmt, `TO "`+name+`"`) {
+				executed = append(executed, name)
+			}
+		}
+	}
+	if !reflect.DeepEqual(executed, expected) {
+		t.Errorf("expected the statements for %v, got %v", expected, executed)
+	}
+}
+
+func TestOrderSyncRequestsCycle(t *testing.T) {
+	reqs := []spec.PgSyncUserRequest{
+		{Kind: spec.PGSyncUserAdd, User: spec.PgUser{Name: "b", MemberOf: []string{"a"}}},
+		{Kind: spec.PGSyncUserAdd, User: spec.PgUser{Name: "a", MemberOf: []string{"b"}}},
+		{Kind: spec.PGSyncUserAdd, User: spec.PgUser{Name: "c"}},
+	}
+	// the roles of the cycle are kept and come last
+	ordered := orderSyncRequests(reqs)
+	names := make([]string, 0, len(ordered))
+	for _, r := range ordered {
+		names = append(names, r.User.Name)
+	}
+	if expected := []string{"c", "a", "b"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected the requests for %v, got %v", expected, names)
+	}
+}
+
+func TestSyncRequestsCombinedAlter(t *testing.T) {
+	strategy := DefaultUserSyncStrategy{}
+	expiry := time.Date(2021, 6, 30, 18, 0, 0, 0, time.UTC)
+	newUser := spec.PgUser{
+		Name:            "app_user",
+		Password:        "secret",
+		Flags:           []string{"LOGIN", "NOCREATEDB"},
+		MemberOf:        []string{"app_group"},
+		ConnectionLimit: int64ToPointer(10),
+		ValidUntil:      &expiry,
+		Parameters:      map[string]string{"statement_timeout": "5s"},
+	}
+	dbUser := spec.PgUser{Name: "app_user", Password: "md5outdated", Flags: []string{"CREATEDB", "LOGIN"}}
+
+	// the attributes, the membership and the settings of the role are altered by a single request
+	reqs := strategy.ProduceSyncRequests(spec.PgUserMap{"app_user": dbUser}, spec.PgUserMap{"app_user": newUser}, "md5")
+	if len(reqs) != 1 || reqs[0].Kind != spec.PGsyncUserAlter {
+		t.Fatalf("expected one alter request, got %#v", reqs)
+	}
+
+	executedStatements = nil
+	db, err := sql.Open("recording", "")
+	if err != nil {
+		t.Fatalf("could not open the database: %v", err)
+	}
+	defer db.Close()
+	if err := strategy.ExecuteSyncRequests(context.TODO(), reqs, db); err != nil {
+		t.Fatalf("could not execute the sync requests: %v", err)
+	}
+
+	// sent in one round-trip with all attributes in a single ALTER ROLE
+	if len(executedStatements) != 1 {
+		t.Fatalf("expected one query, got %q", executedStatements)
+	}
+	query := executedStatements[0]
+	if count := strings.Count(query, `ALTER ROLE "app_user" WITH`); count != 1 {
+		t.Errorf("expected a single ALTER ROLE with the attributes, got %d in %q", count, query)
+	}
+	password := util.NewEncryptor("md5").PGUserPassword(newUser)
+	expectedAlter := fmt.Sprintf(`ALTER ROLE "app_user" WITH ENCRYPTED PASSWORD '%s' NOCREATEDB CONNECTION LIMIT 10 VALID UNTIL '2021-06-30T18:00:00Z'`, password)
+	for _, stmt := range []string{
+		expectedAlter,
+		`GRANT "app_group" TO "app_user"`,
+		`ALTER ROLE "app_user" RESET ALL`,
+		`ALTER ROLE "app_user" SET statement_timeout TO '5s'`,
+	} {
+		if !strings.Contains(query, stmt) {
+			t.Errorf("expected %q in query %q", stmt, query)
+		}
+	}
+
+	// a new role is created with its settings in one round-trip as well
+	executedStatements = nil
+	reqs = strategy.ProduceSyncRequests(spec.PgUserMap{}, spec.PgUserMap{"app_user": newUser}, "md5")
+	if len(reqs) != 1 || reqs[0].Kind != spec.PGSyncUserAdd {
+		t.Fatalf("expected one add request, got %#v", reqs)
+	}
+	if err := strategy.ExecuteSyncRequests(context.TODO(), reqs, db); err != nil {
+		t.Fatalf("could not execute the sync requests: %v", err)
+	}
+	if len(executedStatements) != 1 || !strings.Contains(executedStatements[0], `ALTER ROLE "app_user" SET statement_timeout TO '5s'`) {
+		t.Errorf("expected the role to be created with its settings in one query, got %q", executedStatements)
+	}
+}
+
+func TestCombinableFlags(t *testing.T) {
+	tests := []struct {
+		flags    []string
+		expected []string
+	}{
+		{[]string{"LOGIN", "CREATEDB"}, []string{"LOGIN", "CREATEDB"}},
+		{[]string{"LOGIN", "CREATEDB", "NOLOGIN"}, []string{"NOLOGIN", "CREATEDB"}},
+		{[]string{"CREATEDB", "CREATEDB"}, []string{"CREATEDB"}},
+		{[]string{}, []string{}},
+	}
+	for _, tt := range tests {
+		if flags := combinableFlags(tt.flags); !reflect.DeepEqual(flags, tt.expected) {
+			t.Errorf("expected flags %v for %v, got %v", tt.expected, tt.flags, flags)
+		}
+	}
+}
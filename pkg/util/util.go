@@ -13,6 +13,7 @@ import (
 	"reflect"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -76,6 +77,7 @@ type Random func(n int) string
 type Encryptor struct {
 	encrypt Hasher
 	random  Random
+	scram   bool
 }
 
 func NewEncryptor(encryption string) *Encryptor {
@@ -89,26 +91,66 @@ func NewEncryptor(encryption string) *Encryptor {
 		hasher = e.PGUserPasswordMD5
 	}
 	e.encrypt = hasher
+	e.scram = encryption == "scram-sha-256"
 	return &e
 }
 
 func (e *Encryptor) PGUserPassword(user spec.PgUser) string {
-	if (len(user.Password) == md5.Size*2+len(md5prefix) && user.Password[:3] == md5prefix) ||
-		(len(user.Password) > len(scramsha256prefix) && user.Password[:len(scramsha256prefix)] == scramsha256prefix) || user.Password == "" {
+	if encryptedOrEmpty(user.Password) {
 		// Avoid processing already encrypted or empty passwords
 		return user.Password
 	}
 	return e.encrypt(user)
 }
 
+// PGUserPasswordMatches tells whether the password Postgres stores for the user is the password of the user
+// encrypted with the method of the encryptor. A password stored with another method does not match, so it is set
+// again after the method has changed, e.g. from md5 to SCRAM-SHA-256. As the salt of a SCRAM-SHA-256 password is
+// random, the password of the user is hashed again with the salt and iterations of the stored one.
+func (e *Encryptor) PGUserPasswordMatches(user spec.PgUser, stored string) bool {
+	if encryptedOrEmpty(user.Password) {
+		return stored == user.Password
+	}
+	if !e.scram {
+		return stored == e.PGUserPasswordMD5(user)
+	}
+
+	// SCRAM-SHA-256$<iterations>:<salt>$<stored key>:<server key>
+	fields := strings.Split(stored, "$")
+	if len(fields) != 3 || fields[0] != scramsha256prefix {
+		return false
+	}
+	parameters := strings.SplitN(fields[1], ":", 2)
+	if len(parameters) != 2 {
+		return false
+	}
+	storedIterations, err := strconv.Atoi(parameters[0])
+	if err != nil || storedIterations <= 0 {
+		return false
+	}
+	salt, err := base64.StdEncoding.DecodeString(parameters[1])
+	if err != nil {
+		return false
+	}
+	return hmac.Equal([]byte(stored), []byte(scramSHA256Password(user.Password, salt, storedIterations)))
+}
+
+func encryptedOrEmpty(password string) bool {
+	return (len(password) == md5.Size*2+len(md5prefix) && password[:3] == md5prefix) ||
+		(len(password) > len(scramsha256prefix) && password[:len(scramsha256prefix)] == scramsha256prefix) || password == ""
+}
+
 func (e *Encryptor) PGUserPasswordMD5(user spec.PgUser) string {
 	s := md5.Sum([]byte(user.Password + user.Name)) // #nosec, using md5 since PostgreSQL uses it for hashing passwords.
 	return md5prefix + hex.EncodeToString(s[:])
 }
 
 func (e *Encryptor) PGUserPasswordScramSHA256(user spec.PgUser) string {
-	salt := []byte(e.random(saltlength))
-	key := pbkdf2.Key([]byte(user.Password), salt, iterations, 32, sha256.New)
+	return scramSHA256Password(user.Password, []byte(e.random(saltlength)), iterations)
+}
+
+func scramSHA256Password(password string, salt []byte, iterationCount int) string {
+	key := pbkdf2.Key([]byte(password), salt, iterationCount, 32, sha256.New)
 	mac := hmac.New(sha256.New, key)
 	mac.Write([]byte("Server Key"))
 	serverKey := mac.Sum(nil)
@@ -118,7 +160,7 @@ func (e *Encryptor) PGUserPasswordScramSHA256(user spec.PgUser) string {
 	storedKey := sha256.Sum256(clientKey)
 	pass := fmt.Sprintf("%s$%v:%s$%s:%s",
 		scramsha256prefix,
-		iterations,
+		iterationCount,
 		base64.StdEncoding.EncodeToString(salt),
 		base64.StdEncoding.EncodeToString(storedKey[:]),
 		base64.StdEncoding.EncodeToString(serverKey),
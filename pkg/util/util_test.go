@@ -149,6 +149,33 @@ func TestPGUserPassword(t *testing.T) {
 	}
 }
 
+func TestPGUserPasswordMatches(t *testing.T) {
+	user := spec.PgUser{Name: "test", Password: "password"}
+	md5Password := "md587f77988ccb5aa917c93201ba314fcd4"
+	scramPassword := "SCRAM-SHA-256$4096:c2FsdA==$lF4cRm/Jky763CN4HtxdHnjV4Q8AWTNlKvGmEFFU8IQ=:ub8OgRsftnk2ccDMOt7ffHXNcikRkQkq1lh4xaAqrSw="
+
+	tests := []struct {
+		encryption string
+		user       spec.PgUser
+		stored     string
+		matches    bool
+	}{
+		{"md5", user, md5Password, true},
+		{"md5", user, scramPassword, false},
+		{"scram-sha-256", user, scramPassword, true},
+		{"scram-sha-256", user, NewEncryptor("scram-sha-256").PGUserPassword(user), true},
+		{"scram-sha-256", user, md5Password, false},
+		{"scram-sha-256", spec.PgUser{Name: "test", Password: "other"}, scramPassword, false},
+		{"scram-sha-256", user, "SCRAM-SHA-256$abc:c2FsdA==$x:y", false},
+		{"scram-sha-256", spec.PgUser{Name: "test", Password: md5Password}, md5Password, true},
+	}
+	for _, tt := range tests {
+		if matches := NewEncryptor(tt.encryption).PGUserPasswordMatches(tt.user, tt.stored); matches != tt.matches {
+			t.Errorf("PGUserPasswordMatches with %s for %q expected %t, got %t", tt.encryption, tt.stored, tt.matches, matches)
+		}
+	}
+}
+
 func TestPrettyDiff(t *testing.T) {
 	for _, tt := range prettyDiffTest {
 		if actual := PrettyDiff(tt.inA, tt.inB); actual != tt.out {